@@ -0,0 +1,120 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// hashedFile is the outcome of hashing one file for add.
+type hashedFile struct {
+	path string
+	hash []byte
+	err  error
+}
+
+// hashFilesParallel hashes the files at paths, their line endings
+// converted by conv, on one worker per CPU and, unless options.dryRun is
+// set, writes their blobs. Results come back in the order of paths. Once a
+// file fails, files not yet started are left out (with an empty path)
+// unless options.ignoreErrors is set; since workers take paths in order,
+// every left-out file comes after a failure. Once ctx is done, the files
+// not yet started fail with its error.
+func hashFilesParallel(ctx context.Context, paths []string, conv contentConversion, options addOptions) []hashedFile {
+	results := make([]hashedFile, len(paths))
+	progress := newProgress(options.progress, "Adding files", len(paths))
+
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), len(paths)) {
+		wg.Go(func() {
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(paths) || failed.Load() {
+					return
+				}
+
+				result := hashedFile{path: paths[i]}
+				if result.err = ctx.Err(); result.err == nil {
+					result.hash, result.err = conv.hashWorkTreeFile(ctx, paths[i], !options.dryRun)
+				}
+				if result.err != nil && !options.ignoreErrors {
+					failed.Store(true)
+				}
+
+				results[i] = result
+				progress.add(1)
+			}
+		})
+	}
+	wg.Wait()
+	progress.finish()
+
+	return results
+}
+
+// progress reports how much of a long operation is done as a single line
+// that is rewritten in place. A progress with a nil writer reports nothing.
+type progress struct {
+	w     io.Writer
+	title string
+	total int
+
+	mu      sync.Mutex
+	done    int
+	percent int // last percentage written, -1 before the first
+}
+
+// newProgress returns a progress of total steps that writes to w.
+func newProgress(w io.Writer, title string, total int) *progress {
+	return &progress{w: w, title: title, total: total, percent: -1}
+}
+
+// add records n more steps as done, rewriting the line when the
+// percentage changes.
+func (p *progress) add(n int) {
+	if p.w == nil || p.total == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += n
+	if percent := p.done * 100 / p.total; percent != p.percent {
+		p.percent = percent
+		fmt.Fprintf(p.w, "\r%s: %3d%% (%d/%d)", p.title, percent, p.done, p.total)
+	}
+}
+
+// finish ends the progress line.
+func (p *progress) finish() {
+	if p.w == nil || p.percent < 0 {
+		return
+	}
+
+	if p.done == p.total {
+		fmt.Fprint(p.w, ", done.")
+	}
+	fmt.Fprintln(p.w)
+}
+
+// terminalProgress returns os.Stderr when it is a terminal, for progress
+// that would only clutter a redirected log, and nil otherwise.
+func terminalProgress() io.Writer {
+	if quiet {
+		return nil
+	}
+
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+
+	return os.Stderr
+}
@@ -0,0 +1,50 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddDirectoryParallel(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		for i := range 40 {
+			path := filepath.Join("tree", fmt.Sprintf("d%d", i%4), fmt.Sprintf("f%02d.txt", i))
+			assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			assert.NoError(t, os.WriteFile(path, []byte(path), 0644))
+		}
+
+		var progress bytes.Buffer
+		failures, err := addDirectory(t.Context(), "tree", addOptions{progress: &progress})
+		assert.NoError(t, err)
+		assert.Empty(t, failures)
+		assert.Contains(t, progress.String(), "\rAdding files: 100% (40/40), done.\n")
+
+		index, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Len(t, index, 40)
+		for path, hash := range index {
+			assert.Equal(t, hashObject([]byte(path)), hash, path)
+			assert.True(t, objectExists(hash), path)
+		}
+
+		// a failure stops the add before the index is written
+		assert.NoError(t, os.WriteFile("tree/d0/f00.txt", []byte("changed"), 0644))
+		if err := os.Symlink("missing", "tree/d1/broken.txt"); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		_, err = addDirectory(t.Context(), "tree", addOptions{})
+		assert.Error(t, err)
+
+		index, err = readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, hashObject([]byte(filepath.Join("tree", "d0", "f00.txt"))), index["tree/d0/f00.txt"])
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
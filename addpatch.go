@@ -0,0 +1,206 @@
+package mygit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// addPatchHelp explains the answers add -p accepts.
+const addPatchHelp = `y - stage this hunk
+n - do not stage this hunk
+s - split the current hunk into smaller hunks
+q - quit; do not stage this hunk or any of the remaining ones
+`
+
+// splitHunkRange splits the hunk script[r[0]:r[1]] into one hunk per run of
+// changes, each with up to context unchanged lines around it that do not
+// reach into the next run. It returns nil if the hunk holds a single run.
+func splitHunkRange(script []diffLine, r [2]int, context int) [][2]int {
+	var runs [][2]int
+	for i := r[0]; i < r[1]; {
+		if script[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		j := i
+		for j < r[1] && script[j].kind != ' ' {
+			j++
+		}
+		runs = append(runs, [2]int{i, j})
+		i = j
+	}
+
+	if len(runs) < 2 {
+		return nil
+	}
+
+	parts := make([][2]int, len(runs))
+	for n, run := range runs {
+		start, end := max(run[0]-context, r[0]), min(run[1]+context, r[1])
+		if n > 0 {
+			start = max(start, runs[n-1][1])
+		}
+		if n < len(runs)-1 {
+			end = min(end, runs[n+1][0])
+		}
+		parts[n] = [2]int{start, end}
+	}
+
+	return parts
+}
+
+// partiallyStagedContent returns the old side of the edit script with only
+// the changes marked in take applied: their removed lines dropped and
+// their added lines inserted.
+func partiallyStagedContent(script []diffLine, take []bool) []byte {
+	var sb strings.Builder
+
+	for i, line := range script {
+		switch {
+		case line.kind == ' ',
+			line.kind == '-' && !take[i],
+			line.kind == '+' && take[i]:
+			sb.WriteString(line.text)
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+// chooseHunks shows the hunks of one file's edit script and asks, reading
+// answers from in, which to stage. It returns the changes to stage, marked
+// by their position in the script, and whether the user asked to quit. An
+// exhausted input quits too.
+func chooseHunks(script []diffLine, in *bufio.Reader, out io.Writer) ([]bool, bool, error) {
+	take := make([]bool, len(script))
+	queue := hunkRanges(script, diffContextLines)
+
+	for len(queue) > 0 {
+		hunk := queue[0]
+		fmt.Fprint(out, formatHunk(script, hunk[0], hunk[1]))
+		fmt.Fprint(out, "Stage this hunk [y,n,s,q,?]? ")
+
+		answer, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, false, fmt.Errorf("error reading answer: %w", err)
+		}
+		if errors.Is(err, io.EOF) && answer == "" {
+			fmt.Fprintln(out)
+			return take, true, nil
+		}
+
+		switch strings.TrimSpace(answer) {
+		case "y":
+			for i := hunk[0]; i < hunk[1]; i++ {
+				take[i] = script[i].kind != ' '
+			}
+			queue = queue[1:]
+		case "n":
+			queue = queue[1:]
+		case "s":
+			parts := splitHunkRange(script, hunk, diffContextLines)
+			if parts == nil {
+				fmt.Fprintln(out, "Sorry, cannot split this hunk")
+				continue
+			}
+			fmt.Fprintf(out, "Split into %d hunks.\n", len(parts))
+			queue = append(parts, queue[1:]...)
+		case "q":
+			return take, true, nil
+		default:
+			fmt.Fprint(out, addPatchHelp)
+		}
+	}
+
+	return take, false, nil
+}
+
+// addPatch goes through the tracked files at or below the given
+// repository-relative paths, or all of them when paths is empty, and stages
+// the hunks of their working tree changes the user picks. Files deleted
+// from the working tree and submodules are left out. It returns the paths
+// whose index entry changed.
+func addPatch(ctx context.Context, paths []string, in io.Reader, out io.Writer) ([]string, error) {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := configuredDiffAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(in)
+	var changed []string
+	for _, filePath := range slices.Sorted(maps.Keys(index)) {
+		if !withinPaths(filePath, paths) || gitlinks[filePath] {
+			continue
+		}
+
+		newContent, err := os.ReadFile(workTreePath(filePath))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return changed, fmt.Errorf("error reading file %s: %w", filePath, err)
+		}
+		if newContent, err = conv.toObject(ctx, filePath, newContent, true); err != nil {
+			return changed, err
+		}
+
+		oldContent, err := readBlobFromCatFile(index[filePath])
+		if err != nil {
+			return changed, err
+		}
+
+		if isBinaryDiff(conv.attrs, filePath, oldContent, newContent) {
+			continue // binary content has no hunks to pick
+		}
+
+		script := diffLines(splitLines(oldContent), splitLines(newContent), algorithm)
+		if !slices.ContainsFunc(script, func(line diffLine) bool { return line.kind != ' ' }) {
+			continue
+		}
+
+		fmt.Fprintf(out, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", filePath, filePath, filePath, filePath)
+		take, quit, err := chooseHunks(script, reader, out)
+		if err != nil {
+			return changed, err
+		}
+
+		if slices.Contains(take, true) {
+			blobHash, err := createObject(partiallyStagedContent(script, take))
+			if err != nil {
+				return changed, err
+			}
+			if err := updateIndex(ctx, filePath, blobHash); err != nil {
+				return changed, err
+			}
+			changed = append(changed, filePath)
+		}
+
+		if quit {
+			break
+		}
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,67 @@
+package mygit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartiallyStagedContent(t *testing.T) {
+	oldLines := splitLines([]byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"))
+	newLines := splitLines([]byte("1\ntwo\n3\n4\n5\n6\nseven\n8\n9\n10\n"))
+	script := myersDiff(oldLines, newLines)
+
+	// the two changes are close enough to share a hunk, which splits in two
+	ranges := hunkRanges(script, diffContextLines)
+	assert.Len(t, ranges, 1)
+	parts := splitHunkRange(script, ranges[0], diffContextLines)
+	assert.Len(t, parts, 2)
+	assert.Nil(t, splitHunkRange(script, parts[0], diffContextLines))
+
+	take := make([]bool, len(script))
+	for i := parts[1][0]; i < parts[1][1]; i++ {
+		take[i] = script[i].kind != ' '
+	}
+	assert.Equal(t, "1\n2\n3\n4\n5\n6\nseven\n8\n9\n10\n", string(partiallyStagedContent(script, take)))
+}
+
+func TestAddPatch(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("add-patch-test")
+
+	assert.NoError(t, os.MkdirAll("add-patch-test", 0755))
+	base := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	for _, file := range []string{"add-patch-test/a.txt", "add-patch-test/b.txt"} {
+		blobHash, err := createObject([]byte(base))
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), file, blobHash))
+	}
+	assert.NoError(t, os.WriteFile("add-patch-test/a.txt", []byte(strings.Replace(strings.Replace(base, "2\n", "two\n", 1), "14\n", "fourteen\n", 1)), 0644))
+	assert.NoError(t, os.WriteFile("add-patch-test/b.txt", []byte(base+"16\n"), 0644))
+
+	// stage the first hunk of a.txt, skip the second, then quit before b.txt
+	changed, err := addPatch(t.Context(), []string{"add-patch-test"}, strings.NewReader("y\nn\nq\n"), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"add-patch-test/a.txt"}, changed)
+
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	staged, err := readBlobFromCatFile(index["add-patch-test/a.txt"])
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Replace(base, "2\n", "two\n", 1), string(staged))
+	staged, err = readBlobFromCatFile(index["add-patch-test/b.txt"])
+	assert.NoError(t, err)
+	assert.Equal(t, base, string(staged))
+
+	// running out of answers stops without staging the rest
+	changed, err = addPatch(t.Context(), nil, strings.NewReader(""), io.Discard)
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+}
@@ -0,0 +1,90 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+)
+
+// addUpdate brings the index entries at or below the given
+// repository-relative paths, or all of them when paths is empty, up to date
+// with the working tree: changed files are restaged, entries of deleted
+// files are removed, and submodules are restaged at their current commit.
+// Untracked files are never added, and entries outside the sparse-checkout
+// cone are left alone. It returns the paths whose entry changed.
+func addUpdate(ctx context.Context, paths []string) ([]string, error) {
+	cone, err := loadSparseCone()
+	if err != nil {
+		return nil, err
+	}
+	index, err := readConeIndex(ctx, cone)
+	if err != nil {
+		return nil, err
+	}
+
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, filePath := range slices.Sorted(maps.Keys(index)) {
+		if !withinPaths(filePath, paths) || isSparseDirEntry(filePath) || !cone.contains(filePath) {
+			continue
+		}
+
+		if gitlinks[filePath] {
+			if !isNestedRepository(filePath) {
+				continue // not checked out, nothing to stage
+			}
+
+			head, err := submoduleHead(filePath)
+			if err != nil {
+				return nil, err
+			}
+			if head != nil && !slices.Equal(head, index[filePath]) {
+				index[filePath] = head
+				changed = append(changed, filePath)
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(workTreePath(filePath))
+		if errors.Is(err, fs.ErrNotExist) {
+			delete(index, filePath)
+			changed = append(changed, filePath)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", filePath, err)
+		}
+
+		if content, err = conv.toObject(ctx, filePath, content, true); err != nil {
+			return nil, err
+		}
+		if slices.Equal(hashObject(content), index[filePath]) {
+			continue
+		}
+
+		blobHash, err := createObject(content)
+		if err != nil {
+			return nil, fmt.Errorf("error creating object for file %s: %w", filePath, err)
+		}
+		index[filePath] = blobHash
+		changed = append(changed, filePath)
+	}
+
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	return changed, writeIndex(ctx, index)
+}
@@ -0,0 +1,50 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddUpdate(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("add-update-test")
+
+	assert.NoError(t, os.MkdirAll("add-update-test/sub", 0755))
+	for _, file := range []string{"add-update-test/same.txt", "add-update-test/edited.txt", "add-update-test/deleted.txt", "add-update-test/sub/other.txt"} {
+		assert.NoError(t, os.WriteFile(file, []byte(file), 0644))
+		blobHash, err := createObject([]byte(file))
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), file, blobHash))
+	}
+
+	assert.NoError(t, os.WriteFile("add-update-test/edited.txt", []byte("edited\n"), 0644))
+	assert.NoError(t, os.WriteFile("add-update-test/sub/other.txt", []byte("edited\n"), 0644))
+	assert.NoError(t, os.WriteFile("add-update-test/untracked.txt", []byte("new\n"), 0644))
+	assert.NoError(t, os.Remove("add-update-test/deleted.txt"))
+
+	// the subdirectory is left out of the scope
+	changed, err := addUpdate(t.Context(), []string{"add-update-test/edited.txt", "add-update-test/deleted.txt", "add-update-test/untracked.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"add-update-test/deleted.txt", "add-update-test/edited.txt"}, changed)
+
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.NotContains(t, index, "add-update-test/deleted.txt")
+	assert.NotContains(t, index, "add-update-test/untracked.txt")
+	assert.Equal(t, hashObject([]byte("edited\n")), index["add-update-test/edited.txt"])
+	assert.Equal(t, hashObject([]byte("add-update-test/sub/other.txt")), index["add-update-test/sub/other.txt"])
+
+	changed, err = addUpdate(t.Context(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"add-update-test/sub/other.txt"}, changed)
+
+	changed, err = addUpdate(t.Context(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+}
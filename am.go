@@ -0,0 +1,432 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mboxFromLine matches the line that starts each message of a mailbox.
+var mboxFromLine = regexp.MustCompile(`^From \S+ .*\d{4}$`)
+
+// subjectPrefix matches the "[PATCH n/m]" style tags at the start of a subject.
+var subjectPrefix = regexp.MustCompile(`^(\s*\[[^\]]*\])+\s*`)
+
+// amState records a patch series being applied by am. The patches
+// themselves are kept next to the state as numbered files.
+type amState struct {
+	origHead []byte // commit am started from (for --abort)
+	current  int    // number of the next patch to apply, from 1
+	total    int
+}
+
+// mailPatch is one message of a patch series.
+type mailPatch struct {
+	author  string // "Name <email>", with a time unless it is the epoch
+	subject string
+	message string
+	patch   []byte // the whole message; apply skips all but the diff
+}
+
+// amDir returns the directory holding the state of an am session.
+func amDir() string {
+	return fmt.Sprintf("%s/am", gitDir)
+}
+
+// isAmInProgress checks if a stopped am session exists.
+func isAmInProgress() (bool, error) {
+	_, err := os.Stat(amDir())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking %s: %w", amDir(), err)
+	}
+
+	return true, nil
+}
+
+// readAmState reads the state of the stopped am session.
+func readAmState() (amState, error) {
+	content, err := os.ReadFile(filepath.Join(amDir(), "state"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return amState{}, fmt.Errorf("no am session in progress")
+	}
+	if err != nil {
+		return amState{}, fmt.Errorf("error reading am state: %w", err)
+	}
+
+	var state amState
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return amState{}, fmt.Errorf("invalid am state entry: %s", line)
+		}
+
+		switch key {
+		case "orig":
+			state.origHead, err = hex.DecodeString(value)
+		case "current":
+			state.current, err = strconv.Atoi(value)
+		case "total":
+			state.total, err = strconv.Atoi(value)
+		default:
+			return amState{}, fmt.Errorf("invalid am state entry: %s", line)
+		}
+		if err != nil {
+			return amState{}, fmt.Errorf("invalid am state entry: %s", line)
+		}
+	}
+
+	return state, nil
+}
+
+// writeAmState writes the am session state to disk.
+func writeAmState(state amState) error {
+	content := fmt.Sprintf("orig %x\ncurrent %d\ntotal %d\n", state.origHead, state.current, state.total)
+	if err := os.WriteFile(filepath.Join(amDir(), "state"), []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing am state: %w", err)
+	}
+
+	return nil
+}
+
+// amPatchPath returns the path of the numbered patch of the session.
+func amPatchPath(number int) string {
+	return filepath.Join(amDir(), fmt.Sprintf("%04d", number))
+}
+
+// splitMailbox splits a mailbox into its messages. Input without "From "
+// separator lines is a single message.
+func splitMailbox(data []byte) [][]byte {
+	var messages [][]byte
+	var current []string
+
+	atBoundary := true // a separator follows a blank line or starts the input
+	for _, line := range splitLines(data) {
+		if atBoundary && mboxFromLine.MatchString(strings.TrimRight(line, "\r\n")) {
+			if len(current) > 0 {
+				messages = append(messages, []byte(strings.Join(current, "")))
+			}
+			current = nil
+		}
+
+		current = append(current, line)
+		atBoundary = strings.TrimSpace(line) == ""
+	}
+
+	if len(current) > 0 {
+		messages = append(messages, []byte(strings.Join(current, "")))
+	}
+
+	return messages
+}
+
+// parseMailPatch reads the author and commit message of a patch email. The
+// message is the subject, without its "[PATCH]" tags, followed by the body
+// up to the "---" line that separates it from the diff.
+func parseMailPatch(data []byte) (mailPatch, error) {
+	lines := splitLines(data)
+
+	// headers end at the first blank line and may be folded onto
+	// lines that start with whitespace
+	headers := make(map[string]string)
+	var last string
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if line == "" {
+			i++
+			break
+		}
+		if i == 0 && mboxFromLine.MatchString(line) {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			headers[last] += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			break // not an email; the diff starts here
+		}
+		last = strings.ToLower(name)
+		headers[last] = strings.TrimSpace(value)
+	}
+
+	author := headers["from"]
+	if !strings.Contains(author, "<") {
+		return mailPatch{}, fmt.Errorf("patch does not have a valid author (From: header)")
+	}
+
+	if date, ok := headers["date"]; ok {
+		when, err := time.Parse(patchDateLayout, date)
+		if err != nil {
+			return mailPatch{}, fmt.Errorf("invalid Date header: %s", date)
+		}
+		// mygit's own commits carry no time and are sent dated at the epoch
+		if when.Unix() != 0 {
+			author = fmt.Sprintf("%s %d %s", author, when.Unix(), when.Format("-0700"))
+		}
+	}
+
+	subject := subjectPrefix.ReplaceAllString(headers["subject"], "")
+	if subject == "" {
+		return mailPatch{}, fmt.Errorf("patch does not have a subject")
+	}
+
+	var body []string
+	for ; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if line == "---" || strings.HasPrefix(line, "diff --git ") {
+			break
+		}
+		body = append(body, line)
+	}
+
+	message := subject
+	if text := strings.TrimSpace(strings.Join(body, "\n")); text != "" {
+		message += "\n\n" + text
+	}
+
+	return mailPatch{author: author, subject: subject, message: message, patch: data}, nil
+}
+
+// startAm saves the messages of the mailboxes as a new session and applies
+// them on top of HEAD.
+func startAm(ctx context.Context, mailboxes [][]byte) error {
+	if yes, err := isAmInProgress(); err != nil {
+		return err
+	} else if yes {
+		return fmt.Errorf("am session in progress; use --continue, --skip, or --abort")
+	}
+
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if yes {
+		return errorOf(ErrConflict, "merge in progress; please resolve conflicts and commit first")
+	}
+
+	origHead, err := resolveRevision("HEAD")
+	if err != nil {
+		return fmt.Errorf("am needs a commit to apply patches on: %w", err)
+	}
+
+	// patches are applied through the index, which must match HEAD
+	index, err := readIndex(ctx)
+	if err != nil {
+		return err
+	}
+	headIndex, err := commitIndex(ctx, origHead)
+	if err != nil {
+		return err
+	}
+	if len(diffIndexes(headIndex, index)) > 0 {
+		return errorOf(ErrDirtyWorktree, "your index has uncommitted changes; commit or reset them first")
+	}
+
+	var messages [][]byte
+	for _, mailbox := range mailboxes {
+		messages = append(messages, splitMailbox(mailbox)...)
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("no patches found in input")
+	}
+
+	// check every message before starting, so a bad mailbox stops nothing
+	for i, message := range messages {
+		if _, err := parseMailPatch(message); err != nil {
+			return fmt.Errorf("error in patch %d: %w", i+1, err)
+		}
+	}
+
+	if err := os.MkdirAll(amDir(), 0755); err != nil {
+		return fmt.Errorf("error creating am state: %w", err)
+	}
+	for i, message := range messages {
+		if err := os.WriteFile(amPatchPath(i+1), message, 0644); err != nil {
+			os.RemoveAll(amDir())
+			return fmt.Errorf("error writing am state: %w", err)
+		}
+	}
+
+	state := amState{origHead: origHead, current: 1, total: len(messages)}
+	if err := writeAmState(state); err != nil {
+		os.RemoveAll(amDir())
+		return err
+	}
+
+	return runAm(ctx, state)
+}
+
+// runAm applies and commits the session's patches from state.current on.
+// When a patch does not apply it records where it stopped and returns.
+func runAm(ctx context.Context, state amState) error {
+	for ; state.current <= state.total; state.current++ {
+		mail, err := readAmPatch(state.current)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Applying: %s\n", mail.subject)
+
+		results, err := applyPatch(ctx, mail.patch, applyOptions{strip: 1, index: true})
+		if err != nil {
+			if err := writeAmState(state); err != nil {
+				return err
+			}
+
+			fmt.Println(err)
+			fmt.Printf("Patch failed at %04d %s\n", state.current, mail.subject)
+			fmt.Printf("Apply it by hand and stage the result, then run '%s am --continue'; or use '%s am --skip' or '%s am --abort'\n", vcsName, vcsName, vcsName)
+			return nil
+		}
+		for _, applied := range results {
+			for _, note := range applied.notes {
+				fmt.Printf("%s: %s\n", displayPath(applied.path), note)
+			}
+		}
+
+		if _, err := commitMailPatch(ctx, mail); err != nil {
+			if err := writeAmState(state); err != nil {
+				return err
+			}
+			return err
+		}
+	}
+
+	return removeAmState()
+}
+
+// readAmPatch reads and parses the numbered patch of the session.
+func readAmPatch(number int) (mailPatch, error) {
+	data, err := os.ReadFile(amPatchPath(number))
+	if err != nil {
+		return mailPatch{}, fmt.Errorf("error reading am patch %d: %w", number, err)
+	}
+
+	return parseMailPatch(data)
+}
+
+// commitMailPatch commits the index on top of HEAD with the author and
+// message of the patch. The committer is the current user.
+func commitMailPatch(ctx context.Context, mail mailPatch) ([]byte, error) {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := getHEAD()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := getRef(head)
+	if err != nil {
+		return nil, err
+	}
+
+	parentIndex, err := commitIndex(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	if len(diffIndexes(parentIndex, index)) == 0 {
+		return nil, fmt.Errorf("no changes staged for %q; stage the patch's changes or use --skip", mail.subject)
+	}
+
+	treeHash, err := writeIndexTree(index)
+	if err != nil {
+		return nil, err
+	}
+
+	_, committer, err := commitIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	commitHash, err := writeCommitObjectAs(treeHash, [][]byte{parent}, mail.author, committer, mail.message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := compareAndSwapRef(head, parent, commitHash); err != nil {
+		return nil, err
+	}
+
+	return commitHash, nil
+}
+
+// continueAm commits the patch the session stopped at, which the user has
+// applied and staged, and resumes with the next one.
+func continueAm(ctx context.Context) error {
+	state, err := readAmState()
+	if err != nil {
+		return err
+	}
+
+	mail, err := readAmPatch(state.current)
+	if err != nil {
+		return err
+	}
+
+	if _, err := commitMailPatch(ctx, mail); err != nil {
+		return err
+	}
+
+	state.current++
+	return runAm(ctx, state)
+}
+
+// skipAm discards the changes of the patch the session stopped at and
+// resumes with the next one.
+func skipAm(ctx context.Context) error {
+	state, err := readAmState()
+	if err != nil {
+		return err
+	}
+
+	head, err := resolveRevision("HEAD")
+	if err != nil {
+		return err
+	}
+	if err := resetToCommit(ctx, head, resetModeHard); err != nil {
+		return err
+	}
+
+	fmt.Printf("Skipped patch %04d\n", state.current)
+	state.current++
+	return runAm(ctx, state)
+}
+
+// abortAm abandons the session and restores the commit it started from.
+func abortAm(ctx context.Context) error {
+	state, err := readAmState()
+	if err != nil {
+		return err
+	}
+
+	if err := resetToCommit(ctx, state.origHead, resetModeHard); err != nil {
+		return err
+	}
+
+	fmt.Printf("am aborted; reset to %x\n", state.origHead)
+	return removeAmState()
+}
+
+// removeAmState deletes the am session directory.
+func removeAmState() error {
+	if err := os.RemoveAll(amDir()); err != nil {
+		return fmt.Errorf("error removing am state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMailPatch(t *testing.T) {
+	mailbox := strings.Join([]string{
+		"From 1111111111111111111111111111111111111111 Mon Sep 17 00:00:00 2001",
+		"From: A U Thor <author@example.com>",
+		"Date: Tue, 14 Nov 2023 23:13:20 +0100",
+		"Subject: [PATCH 1/2] Fix the parser",
+		" for long lines",
+		"",
+		"It used to stop early.",
+		"---",
+		" a.txt | 2 +-",
+		"",
+		"diff --git a/a.txt b/a.txt",
+		"--- a/a.txt",
+		"+++ b/a.txt",
+		"@@ -1 +1 @@",
+		"-old",
+		"+new",
+		"-- ",
+		"mygit",
+		"",
+		"From 2222222222222222222222222222222222222222 Mon Sep 17 00:00:00 2001",
+		"From: Author <author@example.com>",
+		"Date: Thu, 1 Jan 1970 00:00:00 +0000",
+		"Subject: [PATCH 2/2] Second",
+		"",
+		"---",
+		"",
+	}, "\n")
+
+	messages := splitMailbox([]byte(mailbox))
+	assert.Len(t, messages, 2)
+
+	first, err := parseMailPatch(messages[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "A U Thor <author@example.com> 1700000000 +0100", first.author)
+	assert.Equal(t, "Fix the parser for long lines\n\nIt used to stop early.", first.message)
+
+	// patches of commits without a time keep the identity as it was
+	second, err := parseMailPatch(messages[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "Author <author@example.com>", second.author)
+	assert.Equal(t, "Second", second.message)
+
+	_, err = parseMailPatch([]byte("Subject: no author\n\nbody\n"))
+	assert.Error(t, err)
+}
+
+func TestAm(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("am-test")
+
+	if err := updateConfig("email", "am@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	assert.NoError(t, os.MkdirAll("am-test", 0755))
+	assert.NoError(t, os.WriteFile("am-test/notes.txt", []byte("one\ntwo\n"), 0644))
+	blobHash, err := createObject([]byte("one\ntwo\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "am-test/notes.txt", blobHash))
+	base, err := createCommit(t.Context(), "base")
+	assert.NoError(t, err)
+
+	patch := func(subject, oldLine, newLine string) string {
+		return strings.Join([]string{
+			"From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001",
+			"From: Contributor <contrib@example.com>",
+			"Date: Tue, 14 Nov 2023 22:13:20 +0000",
+			"Subject: [PATCH] " + subject,
+			"",
+			"---",
+			"diff --git a/am-test/notes.txt b/am-test/notes.txt",
+			"--- a/am-test/notes.txt",
+			"+++ b/am-test/notes.txt",
+			"@@ -1,2 +1,2 @@",
+			oldLine,
+			newLine,
+			"",
+		}, "\n")
+	}
+	mailbox := patch("Rename two", " one\n-two", "+2") + "\n" + patch("Rename one", "-one\n two", "+1")
+
+	// the second patch still expects "two" and stops the session
+	assert.NoError(t, startAm(t.Context(), [][]byte{[]byte(mailbox)}))
+
+	inProgress, err := isAmInProgress()
+	assert.NoError(t, err)
+	assert.True(t, inProgress)
+	state, err := readAmState()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, state.current)
+
+	head, err := resolveRevision("HEAD")
+	assert.NoError(t, err)
+	commit, err := readCommit(head)
+	assert.NoError(t, err)
+	assert.Equal(t, "Contributor <contrib@example.com> 1700000000 +0000", commit.author)
+	assert.Equal(t, "Committer <am@example.com>", commit.committer)
+	assert.Equal(t, "Rename two", commit.message)
+	assert.Equal(t, [][]byte{base}, commit.parents)
+
+	// resolve by hand and continue
+	assert.NoError(t, os.WriteFile("am-test/notes.txt", []byte("1\n2\n"), 0644))
+	resolved, err := createObject([]byte("1\n2\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "am-test/notes.txt", resolved))
+	assert.NoError(t, continueAm(t.Context()))
+
+	inProgress, err = isAmInProgress()
+	assert.NoError(t, err)
+	assert.False(t, inProgress)
+	head, err = resolveRevision("HEAD")
+	assert.NoError(t, err)
+	commit, err = readCommit(head)
+	assert.NoError(t, err)
+	assert.Equal(t, "Rename one", commit.message)
+
+	// a session that is aborted leaves HEAD where it started
+	assert.NoError(t, startAm(t.Context(), [][]byte{[]byte(patch("Again", " one\n-two", "+2"))}))
+	assert.NoError(t, abortAm(t.Context()))
+	after, err := resolveRevision("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, head, after)
+	content, err := os.ReadFile("am-test/notes.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n", string(content))
+}
@@ -0,0 +1,546 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader matches "@@ -a,b +c,d @@", where the counts are optional.
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// patchHunk is one hunk of a unified diff. Line texts keep their trailing
+// newline unless the patch marks the line with "\ No newline at end of file".
+type patchHunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	lines              []diffLine
+}
+
+// filePatch is the part of a patch that changes one file. oldPath is empty
+// for a new file and newPath is empty for a deleted one.
+type filePatch struct {
+	oldPath, newPath string
+	hunks            []patchHunk
+}
+
+// applyOptions controls how applyPatch matches and writes a patch.
+type applyOptions struct {
+	strip   int  // leading path components removed from patch paths
+	fuzz    int  // context lines a hunk may ignore at each end
+	reverse bool // apply the patch as if old and new were swapped
+	index   bool // update the index as well as the working tree
+	check   bool // only report whether the patch applies
+}
+
+// appliedFile is the outcome of applying one file patch.
+type appliedFile struct {
+	path    string
+	oldPath string // differs from path for a rename
+	content []byte
+	deleted bool
+	notes   []string // hunks that applied at an offset or with fuzz
+}
+
+// parsePatch reads the file patches of a unified diff. Text outside of file
+// patches, such as an email header or a signature, is ignored.
+func parsePatch(data []byte, strip int) ([]filePatch, error) {
+	lines := splitLines(data)
+
+	var patches []filePatch
+	var current *filePatch
+	var gitNew, gitDeleted bool
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\n")
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, newPath, err := gitDiffPaths(strings.TrimPrefix(line, "diff --git "), strip)
+			if err != nil {
+				return nil, err
+			}
+			patches = append(patches, filePatch{oldPath: oldPath, newPath: newPath})
+			current = &patches[len(patches)-1]
+			gitNew, gitDeleted = false, false
+
+		case current != nil && strings.HasPrefix(line, "new file mode "):
+			gitNew = true
+			current.oldPath = ""
+
+		case current != nil && strings.HasPrefix(line, "deleted file mode "):
+			gitDeleted = true
+			current.newPath = ""
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath, err := patchPath(strings.TrimPrefix(line, "--- "), strip)
+			if err != nil {
+				return nil, err
+			}
+			newPath, err := patchPath(strings.TrimPrefix(strings.TrimSuffix(lines[i+1], "\n"), "+++ "), strip)
+			if err != nil {
+				return nil, err
+			}
+			i++
+
+			// a plain diff has no "diff --git" line to start the file patch
+			if current == nil || len(current.hunks) > 0 {
+				patches = append(patches, filePatch{})
+				current = &patches[len(patches)-1]
+				gitNew, gitDeleted = false, false
+			}
+			if !gitNew {
+				current.oldPath = oldPath
+			}
+			if !gitDeleted {
+				current.newPath = newPath
+			}
+
+		case strings.HasPrefix(line, "@@ "):
+			if current == nil {
+				return nil, fmt.Errorf("error parsing patch: hunk without file header at line %d", i+1)
+			}
+
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.hunks = append(current.hunks, hunk)
+			i = next - 1
+		}
+	}
+
+	for _, patch := range patches {
+		if patch.oldPath == "" && patch.newPath == "" {
+			return nil, fmt.Errorf("error parsing patch: file patch without a path")
+		}
+	}
+
+	return patches, nil
+}
+
+// parseHunk parses the hunk whose header is lines[start] and returns it
+// together with the index of the first line after it. The body is read by
+// the counts in the header, so whatever follows the hunk is left alone.
+func parseHunk(lines []string, start int) (patchHunk, int, error) {
+	header := strings.TrimSuffix(lines[start], "\n")
+	match := hunkHeader.FindStringSubmatch(header)
+	if match == nil {
+		return patchHunk{}, 0, fmt.Errorf("error parsing patch: bad hunk header at line %d: %s", start+1, header)
+	}
+
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	var hunk patchHunk
+	hunk.oldStart, _ = strconv.Atoi(match[1])
+	hunk.oldCount = count(match[2])
+	hunk.newStart, _ = strconv.Atoi(match[3])
+	hunk.newCount = count(match[4])
+
+	oldLeft, newLeft := hunk.oldCount, hunk.newCount
+	i := start + 1
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0); i++ {
+		line := lines[i]
+
+		kind := byte(' ') // editors may strip the space of an empty context line
+		text := line
+		if line != "\n" {
+			kind, text = line[0], line[1:]
+		}
+
+		switch kind {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+			markNoNewline(&hunk)
+			continue
+		default:
+			return patchHunk{}, 0, fmt.Errorf("error parsing patch: unexpected line %d in hunk: %s", i+1, strings.TrimSuffix(line, "\n"))
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return patchHunk{}, 0, fmt.Errorf("error parsing patch: hunk at line %d has more lines than its header says", start+1)
+		}
+
+		hunk.lines = append(hunk.lines, diffLine{kind: kind, text: text})
+	}
+
+	if oldLeft > 0 || newLeft > 0 {
+		return patchHunk{}, 0, fmt.Errorf("error parsing patch: truncated hunk at line %d", start+1)
+	}
+
+	// the marker for the hunk's last line follows the counted lines
+	if i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+		markNoNewline(&hunk)
+		i++
+	}
+
+	return hunk, i, nil
+}
+
+// markNoNewline records that the hunk's last line has no trailing newline.
+func markNoNewline(hunk *patchHunk) {
+	if len(hunk.lines) > 0 {
+		last := &hunk.lines[len(hunk.lines)-1]
+		last.text = strings.TrimSuffix(last.text, "\n")
+	}
+}
+
+// gitDiffPaths reads the two paths of a "diff --git a/x b/x" line. Only
+// paths without spaces can be split unambiguously; the "---" and "+++"
+// lines, when present, replace them.
+func gitDiffPaths(rest string, strip int) (string, string, error) {
+	fields := strings.Fields(rest)
+	if len(fields) != 2 {
+		return "", "", nil
+	}
+
+	oldPath, err := patchPath(fields[0], strip)
+	if err != nil {
+		return "", "", err
+	}
+	newPath, err := patchPath(fields[1], strip)
+	if err != nil {
+		return "", "", err
+	}
+
+	return oldPath, newPath, nil
+}
+
+// patchPath converts a path from a patch header into a repository-relative
+// path, removing strip leading components. /dev/null becomes "".
+func patchPath(name string, strip int) (string, error) {
+	name, _, _ = strings.Cut(name, "\t") // diff(1) appends a timestamp
+	name = strings.TrimSpace(name)
+	if name == "/dev/null" {
+		return "", nil
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) <= strip {
+		return "", fmt.Errorf("error parsing patch: cannot strip %d components from %s", strip, name)
+	}
+
+	path := filepath.ToSlash(filepath.Clean(strings.Join(parts[strip:], "/")))
+	if path == ".." || strings.HasPrefix(path, "../") || filepath.IsAbs(path) {
+		return "", fmt.Errorf("error parsing patch: path %s is outside the repository", name)
+	}
+	if err := checkIndexPath(path); err != nil {
+		return "", fmt.Errorf("error parsing patch: %w", err)
+	}
+
+	return path, nil
+}
+
+// reversePatch swaps the old and new sides of a file patch.
+func reversePatch(patch filePatch) filePatch {
+	reversed := filePatch{oldPath: patch.newPath, newPath: patch.oldPath}
+
+	for _, hunk := range patch.hunks {
+		swapped := patchHunk{
+			oldStart: hunk.newStart, oldCount: hunk.newCount,
+			newStart: hunk.oldStart, newCount: hunk.oldCount,
+		}
+		for _, line := range hunk.lines {
+			switch line.kind {
+			case '-':
+				line.kind = '+'
+			case '+':
+				line.kind = '-'
+			}
+			swapped.lines = append(swapped.lines, line)
+		}
+		reversed.hunks = append(reversed.hunks, swapped)
+	}
+
+	return reversed
+}
+
+// applyHunks applies hunks to content in order. Each hunk is looked for at
+// the line its header names, shifted by how far earlier hunks moved, and
+// then at increasing distances from there. If its full context does not
+// match anywhere, up to fuzz context lines are dropped from each end. The
+// returned notes describe hunks that did not apply exactly where expected.
+func applyHunks(content []byte, hunks []patchHunk, fuzz int) ([]byte, []string, error) {
+	lines := splitLines(content)
+
+	var result []string
+	var notes []string
+	cursor, offset := 0, 0
+
+	for n, hunk := range hunks {
+		var preimage, postimage []string
+		for _, line := range hunk.lines {
+			if line.kind != '+' {
+				preimage = append(preimage, line.text)
+			}
+			if line.kind != '-' {
+				postimage = append(postimage, line.text)
+			}
+		}
+
+		expected := hunk.oldStart - 1
+		if hunk.oldCount == 0 {
+			expected = hunk.oldStart // pure additions name the line they follow
+		}
+
+		pos, used := -1, 0
+		for f := 0; f <= fuzz && pos < 0; f++ {
+			lead := min(f, leadingContext(hunk.lines))
+			trail := min(f, trailingContext(hunk.lines))
+			if f > 0 && lead == 0 && trail == 0 {
+				break // nothing left to drop
+			}
+
+			pos = findLines(lines, preimage[lead:len(preimage)-trail], expected+offset+lead, cursor)
+			if pos >= 0 {
+				used = f
+				preimage = preimage[lead : len(preimage)-trail]
+				postimage = postimage[lead : len(postimage)-trail]
+			}
+		}
+		if pos < 0 {
+			return nil, nil, fmt.Errorf("hunk #%d does not apply", n+1)
+		}
+
+		// the shift of this hunk carries over to the ones after it
+		start := pos - min(used, leadingContext(hunk.lines))
+		if shift := start - expected; shift != offset || used > 0 {
+			offset = shift
+			note := fmt.Sprintf("Hunk #%d succeeded at %d", n+1, start+1)
+			if shift != 0 {
+				note += fmt.Sprintf(" (offset %d lines)", shift)
+			}
+			if used > 0 {
+				note += fmt.Sprintf(" with fuzz %d", used)
+			}
+			notes = append(notes, note+".")
+		}
+
+		result = append(result, lines[cursor:pos]...)
+		result = append(result, postimage...)
+		cursor = pos + len(preimage)
+	}
+
+	result = append(result, lines[cursor:]...)
+	return []byte(strings.Join(result, "")), notes, nil
+}
+
+// leadingContext returns how many context lines start the hunk.
+func leadingContext(lines []diffLine) int {
+	n := 0
+	for n < len(lines) && lines[n].kind == ' ' {
+		n++
+	}
+	return n
+}
+
+// trailingContext returns how many context lines end the hunk.
+func trailingContext(lines []diffLine) int {
+	n := 0
+	for n < len(lines) && lines[len(lines)-1-n].kind == ' ' {
+		n++
+	}
+	return n
+}
+
+// findLines returns the position of want in lines closest to expected, not
+// before from, or -1 if it does not occur there.
+func findLines(lines, want []string, expected, from int) int {
+	last := len(lines) - len(want)
+	if last < from {
+		return -1
+	}
+	expected = min(max(expected, from), last)
+
+	for distance := 0; expected-distance >= from || expected+distance <= last; distance++ {
+		if pos := expected - distance; pos >= from && slices.Equal(lines[pos:pos+len(want)], want) {
+			return pos
+		}
+		if pos := expected + distance; distance > 0 && pos <= last && slices.Equal(lines[pos:pos+len(want)], want) {
+			return pos
+		}
+	}
+
+	return -1
+}
+
+// applyFilePatch computes the result of one file patch against the working
+// tree. Nothing is written.
+func applyFilePatch(ctx context.Context, patch filePatch, opts applyOptions, index map[string][]byte) (appliedFile, error) {
+	applied := appliedFile{path: patch.newPath, oldPath: patch.oldPath, deleted: patch.newPath == ""}
+	if applied.deleted {
+		applied.path = patch.oldPath
+	}
+
+	var current []byte
+	if patch.oldPath == "" {
+		if _, err := os.Lstat(workTreePath(patch.newPath)); err == nil {
+			return applied, fmt.Errorf("%s: already exists in working directory", patch.newPath)
+		}
+		if _, ok := index[patch.newPath]; opts.index && ok {
+			return applied, fmt.Errorf("%s: already exists in index", patch.newPath)
+		}
+	} else {
+		var err error
+		current, err = os.ReadFile(workTreePath(patch.oldPath))
+		if errors.Is(err, fs.ErrNotExist) {
+			return applied, fmt.Errorf("%s: does not exist in working directory", patch.oldPath)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("error reading %s: %w", patch.oldPath, err)
+		}
+
+		if opts.index {
+			staged, ok := index[patch.oldPath]
+			if !ok {
+				return applied, fmt.Errorf("%s: does not exist in index", patch.oldPath)
+			}
+			conv, err := loadContentConversion()
+			if err != nil {
+				return applied, err
+			}
+			currentHash, err := conv.hashWorkTreeContent(ctx, patch.oldPath, current)
+			if err != nil {
+				return applied, err
+			}
+			if !slices.Equal(staged, currentHash) {
+				return applied, fmt.Errorf("%s: does not match index", patch.oldPath)
+			}
+		}
+	}
+
+	if patch.newPath != "" && patch.newPath != patch.oldPath {
+		if _, err := os.Lstat(workTreePath(patch.newPath)); err == nil {
+			return applied, fmt.Errorf("%s: already exists in working directory", patch.newPath)
+		}
+	}
+
+	content, notes, err := applyHunks(current, patch.hunks, opts.fuzz)
+	if err != nil {
+		return applied, fmt.Errorf("%s: %w", applied.path, err)
+	}
+	if applied.deleted && len(content) > 0 {
+		return applied, fmt.Errorf("%s: deleted file still has contents", applied.path)
+	}
+
+	applied.content = content
+	applied.notes = notes
+	return applied, nil
+}
+
+// applyPatch applies the file patches in data to the working tree, and to
+// the index with opts.index. Every file patch is checked before anything is
+// written, so a patch that does not apply leaves the tree untouched.
+func applyPatch(ctx context.Context, data []byte, opts applyOptions) ([]appliedFile, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	patches, err := parsePatch(data, opts.strip)
+	if err != nil {
+		return nil, err
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("error: no valid patches in input")
+	}
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []appliedFile
+	seen := make(map[string]bool)
+	for _, patch := range patches {
+		if opts.reverse {
+			patch = reversePatch(patch)
+		}
+
+		for _, path := range []string{patch.oldPath, patch.newPath} {
+			if path != "" && seen[path] {
+				return nil, fmt.Errorf("error: %s is patched more than once", path)
+			}
+		}
+		seen[patch.oldPath], seen[patch.newPath] = true, true
+
+		applied, err := applyFilePatch(ctx, patch, opts, index)
+		if err != nil {
+			return nil, fmt.Errorf("error: patch failed: %w", err)
+		}
+		results = append(results, applied)
+	}
+
+	if opts.check {
+		return results, nil
+	}
+
+	for _, applied := range results {
+		if err := writeAppliedFile(ctx, applied, opts.index); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// writeAppliedFile writes one patched file to the working tree and, with
+// updateIdx, stages it.
+func writeAppliedFile(ctx context.Context, applied appliedFile, updateIdx bool) error {
+	renamed := applied.oldPath != "" && applied.oldPath != applied.path
+
+	if applied.deleted || renamed {
+		if err := os.Remove(workTreePath(applied.oldPath)); err != nil {
+			return fmt.Errorf("error removing %s: %w", applied.oldPath, err)
+		}
+		if updateIdx {
+			if err := removeIndexEntry(ctx, applied.oldPath); err != nil {
+				return err
+			}
+		}
+		if applied.deleted {
+			return nil
+		}
+	}
+
+	perm := workTreeFileMode
+	if info, err := os.Stat(workTreePath(applied.path)); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	if err := os.MkdirAll(workTreePath(filepath.Dir(applied.path)), workTreeDirMode); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", applied.path, err)
+	}
+	if err := os.WriteFile(workTreePath(applied.path), applied.content, perm); err != nil {
+		return fmt.Errorf("error writing %s: %w", applied.path, err)
+	}
+
+	if updateIdx {
+		hash, err := createObject(applied.content)
+		if err != nil {
+			return err
+		}
+		if err := updateIndex(ctx, applied.path, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyHunks(t *testing.T) {
+	patch := strings.Join([]string{
+		"diff --git a/f.txt b/f.txt",
+		"--- a/f.txt",
+		"+++ b/f.txt",
+		"@@ -2,3 +2,3 @@",
+		" 2",
+		"-3",
+		"+three",
+		" 4",
+		"@@ -8,3 +8,3 @@",
+		" 8",
+		"-9",
+		"+nine",
+		" 10",
+		"-- ",
+		"signature",
+		"",
+	}, "\n")
+
+	patches, err := parsePatch([]byte(patch), 1)
+	assert.NoError(t, err)
+	assert.Len(t, patches, 1)
+	assert.Equal(t, "f.txt", patches[0].oldPath)
+	assert.Len(t, patches[0].hunks, 2)
+
+	// a line added at the top moves both hunks down by one
+	content := []byte("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")
+	result, notes, err := applyHunks(content, patches[0].hunks, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "0\n1\n2\nthree\n4\n5\n6\n7\n8\nnine\n10\n", string(result))
+	assert.Equal(t, []string{"Hunk #1 succeeded at 3 (offset 1 lines)."}, notes)
+
+	// changed context only matches when fuzz lets the hunk ignore it
+	content = []byte("1\n2\n3\n4\n5\n6\n7\nEIGHT\n9\n10\n")
+	_, _, err = applyHunks(content, patches[0].hunks, 0)
+	assert.Error(t, err)
+
+	result, notes, err = applyHunks(content, patches[0].hunks, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\nthree\n4\n5\n6\n7\nEIGHT\nnine\n10\n", string(result))
+	assert.Equal(t, []string{"Hunk #2 succeeded at 8 with fuzz 1."}, notes)
+
+	// reversing undoes the patch
+	reversed := reversePatch(patches[0])
+	result, _, err = applyHunks(result, reversed.hunks, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, string(content), string(result))
+}
+
+func TestApplyPatch(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("apply-test")
+
+	assert.NoError(t, os.MkdirAll("apply-test", 0755))
+	assert.NoError(t, os.WriteFile("apply-test/keep.txt", []byte("a\nb\n"), 0644))
+	assert.NoError(t, os.WriteFile("apply-test/gone.txt", []byte("bye\n"), 0644))
+	for _, path := range []string{"apply-test/keep.txt", "apply-test/gone.txt"} {
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		hash, err := createObject(content)
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), path, hash))
+	}
+
+	patch := strings.Join([]string{
+		"diff --git a/apply-test/keep.txt b/apply-test/keep.txt",
+		"--- a/apply-test/keep.txt",
+		"+++ b/apply-test/keep.txt",
+		"@@ -1,2 +1,2 @@",
+		" a",
+		"-b",
+		"+c",
+		"\\ No newline at end of file",
+		"diff --git a/apply-test/gone.txt b/apply-test/gone.txt",
+		"deleted file mode 100644",
+		"--- a/apply-test/gone.txt",
+		"+++ /dev/null",
+		"@@ -1 +0,0 @@",
+		"-bye",
+		"diff --git a/apply-test/new/file.txt b/apply-test/new/file.txt",
+		"new file mode 100644",
+		"--- /dev/null",
+		"+++ b/apply-test/new/file.txt",
+		"@@ -0,0 +1 @@",
+		"+hello",
+		"",
+	}, "\n")
+
+	_, err := applyPatch(t.Context(), []byte(patch), applyOptions{strip: 1, index: true})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile("apply-test/keep.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nc", string(content))
+	assert.NoFileExists(t, "apply-test/gone.txt")
+	content, err = os.ReadFile("apply-test/new/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(content))
+
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, hashObject([]byte("a\nc")), index["apply-test/keep.txt"])
+	assert.Equal(t, hashObject([]byte("hello\n")), index["apply-test/new/file.txt"])
+	assert.NotContains(t, index, "apply-test/gone.txt")
+
+	// applying again fails without touching anything
+	_, err = applyPatch(t.Context(), []byte(patch), applyOptions{strip: 1})
+	assert.Error(t, err)
+	content, err = os.ReadFile("apply-test/keep.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nc", string(content))
+
+	// in reverse the patch restores the original files
+	_, err = applyPatch(t.Context(), []byte(patch), applyOptions{strip: 1, reverse: true, index: true})
+	assert.NoError(t, err)
+	content, err = os.ReadFile("apply-test/keep.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\n", string(content))
+	assert.FileExists(t, "apply-test/gone.txt")
+	assert.NoFileExists(t, "apply-test/new/file.txt")
+}
@@ -0,0 +1,239 @@
+package mygit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveModTime is the modification time of every archive entry. Commits
+// carry no timestamps, and a fixed time makes the same tree always produce
+// the same archive. 1980 is the earliest time zip can represent.
+var archiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveWriter adds files and directories to an archive.
+type archiveWriter interface {
+	addDir(name string) error
+	addFile(name string, mode int64, content []byte) error
+	Close() error
+}
+
+type tarArchive struct{ w *tar.Writer }
+
+func (a tarArchive) addDir(name string) error {
+	return a.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  archiveModTime,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (a tarArchive) addFile(name string, mode int64, content []byte) error {
+	err := a.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     mode,
+		Size:     int64(len(content)),
+		ModTime:  archiveModTime,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = a.w.Write(content)
+	return err
+}
+
+func (a tarArchive) Close() error { return a.w.Close() }
+
+type zipArchive struct{ w *zip.Writer }
+
+func (a zipArchive) addDir(name string) error {
+	header := &zip.FileHeader{Name: name + "/", Modified: archiveModTime}
+	header.SetMode(0755 | fs.ModeDir)
+	_, err := a.w.CreateHeader(header)
+	return err
+}
+
+func (a zipArchive) addFile(name string, mode int64, content []byte) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archiveModTime}
+	header.SetMode(fs.FileMode(mode))
+
+	w, err := a.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+func (a zipArchive) Close() error { return a.w.Close() }
+
+// newArchiveWriter returns a writer for the given archive format.
+func newArchiveWriter(w io.Writer, format string) (archiveWriter, error) {
+	switch format {
+	case "tar":
+		return tarArchive{tar.NewWriter(w)}, nil
+	case "zip":
+		return zipArchive{zip.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format: %s (expected tar or zip)", format)
+	}
+}
+
+// writeArchive writes the files of a tree to w as a tar or zip archive, with
+// every path prefixed by prefix. Paths with the export-ignore attribute, in
+// the tree's own attributes file, are left out. Blobs are read from the
+// object store one at a time, so the archive is never held in memory.
+func writeArchive(w io.Writer, format string, treeHash []byte, prefix string) error {
+	attrs, err := loadTreeAttributes(treeHash)
+	if err != nil {
+		return err
+	}
+
+	archive, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	if prefix = path.Clean("/" + prefix)[1:]; prefix != "" {
+		if err := archive.addDir(prefix); err != nil {
+			return fmt.Errorf("error writing archive: %w", err)
+		}
+	}
+
+	if err := archiveTree(archive, attrs, treeHash, prefix, ""); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+
+	return nil
+}
+
+// archiveTree adds the entries of the tree at treePath, recursively, below
+// dir in the archive.
+func archiveTree(archive archiveWriter, attrs attributeRules, treeHash []byte, dir, treePath string) error {
+	entries, err := listTreeEntries(treeHash, "", false)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(treePath, entry.name)
+		if attrs.get(entryPath, "export-ignore") == attrSet {
+			continue
+		}
+
+		name := entry.name
+		if dir != "" {
+			name = dir + "/" + entry.name
+		}
+
+		switch entry.objType {
+		case "tree":
+			if err := archive.addDir(name); err != nil {
+				return fmt.Errorf("error writing archive: %w", err)
+			}
+			if err := archiveTree(archive, attrs, entry.hash, name, entryPath); err != nil {
+				return err
+			}
+		case "commit":
+			// submodule contents live in another repository
+			if err := archive.addDir(name); err != nil {
+				return fmt.Errorf("error writing archive: %w", err)
+			}
+		default:
+			content, err := readBlobFromCatFile(entry.hash)
+			if err != nil {
+				return err
+			}
+
+			mode, err := strconv.ParseInt(entry.mode, 8, 64)
+			if err != nil {
+				return fmt.Errorf("invalid mode %s for %s: %w", entry.mode, name, err)
+			}
+
+			if err := archive.addFile(name, mode&0777, content); err != nil {
+				return fmt.Errorf("error writing archive: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// uploadArchive is the server side of archive --remote: it resolves rev in
+// the current repository and streams its tree to w. Like a server, it only
+// hands out what its refs name (HEAD, a branch, or a tag, optionally with
+// ~N and ^N suffixes) unless uploadArchive.allowUnreachable is true, so a
+// client cannot fetch commits that were never published by guessing a hash.
+func uploadArchive(w io.Writer, format, rev, prefix string) error {
+	base := rev
+	if i := strings.IndexAny(rev, "~^"); i != -1 {
+		base = rev[:i]
+	}
+
+	if value, err := getConfig("allowUnreachable"); err != nil || !strings.EqualFold(value, "true") {
+		named, err := namedByRef(base)
+		if err != nil {
+			return err
+		}
+		if !named {
+			return fmt.Errorf("remote refused revision %s: only refs can be archived", rev)
+		}
+	}
+
+	hash, err := resolveRevision(rev)
+	if err != nil {
+		return err
+	}
+
+	treeHash, err := resolveTreeHash(hash)
+	if err != nil {
+		return err
+	}
+
+	return writeArchive(w, format, treeHash, prefix)
+}
+
+// namedByRef reports whether name is HEAD, a branch, or a tag.
+func namedByRef(name string) (bool, error) {
+	if name == "HEAD" {
+		return true, nil
+	}
+
+	for _, refPath := range []string{"refs/heads/" + name, "refs/tags/" + name} {
+		if exists, err := refExists(refPath); err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return false, nil
+}
+
+// fetchRemoteArchive writes the archive of rev in the repository at url to
+// w. The archive is generated in the remote repository and streamed back,
+// so nothing is copied into a local repository and none is needed.
+func fetchRemoteArchive(url string, w io.Writer, format, rev, prefix string) error {
+	// check the format before asking the remote
+	if _, err := newArchiveWriter(io.Discard, format); err != nil {
+		return err
+	}
+
+	return withRepository(url, func() error {
+		return uploadArchive(w, format, rev, prefix)
+	})
+}
@@ -0,0 +1,129 @@
+package mygit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteArchive(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	readme, err := createObject([]byte("readme"))
+	assert.NoError(t, err)
+	source, err := createObject([]byte("package main"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{
+		"README":        readme,
+		"src/main.go":   source,
+		"src/util/a.go": source,
+	})
+	assert.NoError(t, err)
+
+	expected := map[string]string{
+		"v1/":              "",
+		"v1/README":        "readme",
+		"v1/src/":          "",
+		"v1/src/main.go":   "package main",
+		"v1/src/util/":     "",
+		"v1/src/util/a.go": "package main",
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeArchive(&buf, "tar", treeHash, "v1/"))
+
+	files := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+
+		content, err := io.ReadAll(tr)
+		assert.NoError(t, err)
+		files[header.Name] = string(content)
+		if header.Typeflag == tar.TypeReg {
+			assert.Equal(t, int64(0644), header.Mode)
+		}
+	}
+	assert.Equal(t, expected, files)
+
+	buf.Reset()
+	assert.NoError(t, writeArchive(&buf, "zip", treeHash, "v1"))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	files = make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	assert.Equal(t, expected, files)
+
+	assert.Error(t, writeArchive(&buf, "rar", treeHash, ""))
+}
+
+func TestFetchRemoteArchive(t *testing.T) {
+	remote := filepath.Join(t.TempDir(), "remote")
+	assert.NoError(t, os.MkdirAll(remote, 0755))
+
+	var commitHash []byte
+	err := withRepositoryInit(remote, func() error {
+		blob, err := createObject([]byte("released"))
+		if err != nil {
+			return err
+		}
+		treeHash, err := buildTreeObject(map[string][]byte{"NOTES": blob})
+		if err != nil {
+			return err
+		}
+		if commitHash, err = writeCommitObjectAs(treeHash, nil, synthIdentity, synthIdentity, "release"); err != nil {
+			return err
+		}
+		return updateRef("refs/tags/v1", commitHash)
+	})
+	if err != nil {
+		t.Fatalf("Failed to create remote: %v", err)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, fetchRemoteArchive(remote, &buf, "tar", "v1", "v1/"))
+
+	tr := tar.NewReader(&buf)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{"v1/", "v1/NOTES"}, names)
+
+	// a bare hash is refused unless the remote allows it
+	hexHash := hex.EncodeToString(commitHash)
+	assert.ErrorContains(t, fetchRemoteArchive(remote, io.Discard, "tar", hexHash, ""), "refused")
+	assert.NoError(t, withRepository(remote, func() error { return updateConfig("allowUnreachable", "true") }))
+	assert.NoError(t, fetchRemoteArchive(remote, io.Discard, "tar", hexHash, ""))
+
+	assert.Error(t, fetchRemoteArchive(remote, io.Discard, "rar", "v1", ""))
+	assert.Error(t, fetchRemoteArchive(filepath.Join(t.TempDir(), "missing"), io.Discard, "tar", "v1", ""))
+}
@@ -0,0 +1,213 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// attributesFileName is the tracked file at the root of the working tree
+// that sets attributes of paths, one pattern and its attributes per line.
+const attributesFileName = "." + vcsName + "attributes"
+
+// attrValue is the state of one attribute of a path, as check-attr prints
+// it: set ("text"), unset ("-text"), a value ("eol=lf"), or unspecified.
+type attrValue string
+
+const (
+	attrUnspecified attrValue = ""
+	attrSet         attrValue = "set"
+	attrUnset       attrValue = "unset"
+)
+
+// String returns the value as check-attr prints it.
+func (v attrValue) String() string {
+	if v == attrUnspecified {
+		return "unspecified"
+	}
+	return string(v)
+}
+
+// attributeMacros are the attributes that stand for others, as git's
+// "binary" stands for "-diff -merge -text".
+var attributeMacros = map[string][]string{
+	"binary": {"-diff", "-merge", "-text"},
+}
+
+// attributeSetting is one attribute on an attributes line. "!name" sets it
+// back to unspecified.
+type attributeSetting struct {
+	name  string
+	value attrValue
+}
+
+// attributeRule is one line of an attributes file.
+type attributeRule struct {
+	pattern  string
+	anchored bool // a pattern with a slash is matched from the root
+	settings []attributeSetting
+}
+
+// attributeRules are the rules of the attributes files, in order. For each
+// attribute, the last rule matching a path and mentioning the attribute
+// decides its value.
+type attributeRules []attributeRule
+
+// loadAttributes reads the attributes file of the working tree and then the
+// repository's own info/attributes file, which overrides it. Missing files
+// have no rules.
+func loadAttributes() (attributeRules, error) {
+	content, err := os.ReadFile(workTreePath(attributesFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading %s: %w", attributesFileName, err)
+	}
+
+	return withInfoAttributes(parseAttributes(content))
+}
+
+// loadTreeAttributes is loadAttributes for content taken from the root tree
+// treeHash rather than the working tree: the attributes file is the one in
+// the tree, if any, as for checking out or archiving the tree.
+func loadTreeAttributes(treeHash []byte) (attributeRules, error) {
+	entries, err := listTreeEntries(treeHash, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules attributeRules
+	for _, entry := range entries {
+		if entry.name != attributesFileName || entry.objType != "blob" {
+			continue
+		}
+
+		content, err := readBlobFromCatFile(entry.hash)
+		if err != nil {
+			return nil, err
+		}
+		rules = parseAttributes(content)
+	}
+
+	return withInfoAttributes(rules)
+}
+
+// withInfoAttributes appends the rules of the repository's info/attributes
+// file to rules.
+func withInfoAttributes(rules attributeRules) (attributeRules, error) {
+	infoPath := filepath.Join(commonDir, "info", "attributes")
+	content, err := os.ReadFile(infoPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", infoPath, err)
+	}
+
+	return append(rules, parseAttributes(content)...), nil
+}
+
+// parseAttributes parses attributes file content. Each line is a pattern,
+// matched as in the ignore file, followed by attributes separated by
+// spaces: "name" sets one, "-name" unsets it, "name=value" gives it a
+// value, and "!name" makes it unspecified again. Blank lines and lines
+// starting with "#" are skipped.
+func parseAttributes(content []byte) attributeRules {
+	var rules attributeRules
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		rule := attributeRule{anchored: strings.Contains(fields[0], "/")}
+		rule.pattern = strings.TrimPrefix(fields[0], "/")
+		for _, attr := range fields[1:] {
+			rule.settings = append(rule.settings, parseAttributeSetting(attr))
+			for _, expanded := range attributeMacros[attr] {
+				rule.settings = append(rule.settings, parseAttributeSetting(expanded))
+			}
+		}
+
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// parseAttributeSetting parses one attribute of an attributes line.
+func parseAttributeSetting(attr string) attributeSetting {
+	if name, ok := strings.CutPrefix(attr, "-"); ok {
+		return attributeSetting{name: name, value: attrUnset}
+	}
+	if name, ok := strings.CutPrefix(attr, "!"); ok {
+		return attributeSetting{name: name, value: attrUnspecified}
+	}
+	if name, value, ok := strings.Cut(attr, "="); ok {
+		return attributeSetting{name: name, value: attrValue(value)}
+	}
+
+	return attributeSetting{name: attr, value: attrSet}
+}
+
+// matches reports whether the rule's pattern matches the repository-relative
+// path, which uses forward slashes.
+func (r attributeRule) matches(filePath string) bool {
+	target := filePath
+	if !r.anchored {
+		target = path.Base(filePath)
+	}
+
+	return matchIgnorePattern(strings.Split(r.pattern, "/"), strings.Split(target, "/"))
+}
+
+// get returns the value of the attribute name for the repository-relative
+// path.
+func (r attributeRules) get(filePath, name string) attrValue {
+	filePath = filepath.ToSlash(filePath)
+
+	for i := len(r) - 1; i >= 0; i-- {
+		if !r[i].matches(filePath) {
+			continue
+		}
+		for j := len(r[i].settings) - 1; j >= 0; j-- {
+			if r[i].settings[j].name == name {
+				return r[i].settings[j].value
+			}
+		}
+	}
+
+	return attrUnspecified
+}
+
+// all returns every attribute the rules specify for the repository-relative
+// path, sorted by name.
+func (r attributeRules) all(filePath string) []attributeSetting {
+	filePath = filepath.ToSlash(filePath)
+
+	values := make(map[string]attrValue)
+	for _, rule := range r {
+		if !rule.matches(filePath) {
+			continue
+		}
+		for _, setting := range rule.settings {
+			values[setting.name] = setting.value
+		}
+	}
+
+	var settings []attributeSetting
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if values[name] != attrUnspecified {
+			settings = append(settings, attributeSetting{name: name, value: values[name]})
+		}
+	}
+
+	return settings
+}
@@ -0,0 +1,84 @@
+package mygit
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributes(t *testing.T) {
+	rules := parseAttributes([]byte("# comment\n*.png binary\n*.txt text eol=crlf\ndocs/** export-ignore\nnotes.txt -text !eol diff=words\n"))
+
+	assert.Equal(t, attrUnset, rules.get("img/logo.png", "text"))
+	assert.Equal(t, attrUnset, rules.get("img/logo.png", "diff"))
+	assert.Equal(t, attrSet, rules.get("img/logo.png", "binary"))
+	assert.Equal(t, attrSet, rules.get("a/b.txt", "text"))
+	assert.Equal(t, attrValue("crlf"), rules.get("a/b.txt", "eol"))
+	assert.Equal(t, attrSet, rules.get("docs/guide/intro.md", "export-ignore"))
+	assert.Equal(t, attrUnspecified, rules.get("src/docs/intro.md", "export-ignore"))
+
+	// a later line overrides only the attributes it mentions
+	assert.Equal(t, []attributeSetting{
+		{name: "diff", value: "words"},
+		{name: "text", value: attrUnset},
+	}, rules.all("notes.txt"))
+	assert.Equal(t, "unspecified", rules.get("notes.txt", "eol").String())
+
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, os.WriteFile(attributesFileName, []byte("*.bin -diff\nsecret.txt export-ignore\n"), 0644))
+		assert.NoError(t, os.MkdirAll(filepath.Join(commonDir, "info"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(commonDir, "info", "attributes"), []byte("keep.bin diff\n"), 0644))
+
+		attrs, err := loadAttributes()
+		assert.NoError(t, err)
+		assert.Equal(t, attrUnset, attrs.get("data.bin", "diff"))
+		assert.Equal(t, attrSet, attrs.get("keep.bin", "diff"))
+
+		// diff reports binary paths without hunks
+		oldBlob, err := createObject([]byte("one\n"))
+		assert.NoError(t, err)
+		newBlob, err := createObject([]byte("two\n"))
+		assert.NoError(t, err)
+		diff, err := formatIndexDiff(
+			map[string][]byte{"data.bin": oldBlob, "keep.bin": oldBlob},
+			map[string][]byte{"data.bin": newBlob, "keep.bin": newBlob},
+			readBlobFromCatFile)
+		assert.NoError(t, err)
+		assert.Contains(t, diff, "Binary files a/data.bin and b/data.bin differ\n")
+		assert.Contains(t, diff, "-one\n+two\n")
+		assert.NotContains(t, diff, "Binary files a/keep.bin")
+
+		// archive follows the attributes file of the archived tree
+		attributesBlob, err := createObject([]byte("secret.txt export-ignore\n"))
+		assert.NoError(t, err)
+		tree, err := buildTreeObject(map[string][]byte{
+			attributesFileName: attributesBlob,
+			"secret.txt":       oldBlob,
+			"docs/secret.txt":  oldBlob,
+			"public.txt":       newBlob,
+		})
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		assert.NoError(t, writeArchive(&buf, "tar", tree, ""))
+		var names []string
+		tr := tar.NewReader(&buf)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			names = append(names, header.Name)
+		}
+		assert.ElementsMatch(t, []string{attributesFileName, "docs/", "public.txt"}, names)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
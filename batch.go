@@ -0,0 +1,115 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// stagedBlob is the result of hashing and storing one batch entry.
+type stagedBlob struct {
+	path string
+	hash []byte
+	err  error
+}
+
+// addBlobs stores every (path, content) pair produced by sources as a blob
+// and stages it under path, relative to the repository root. Content is
+// hashed and written by a pool of workers, and the index is read and
+// written only once for the whole batch, under the index lock. If any entry
+// fails, including a path checkIndexPath refuses, nothing is staged and the
+// first error is returned, as is ctx's error once it is done.
+func addBlobs(ctx context.Context, sources iter.Seq2[string, io.Reader], workers int) ([]string, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type job struct {
+		path   string
+		reader io.Reader
+	}
+
+	jobs := make(chan job)
+	results := make(chan stagedBlob)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := checkIndexPath(j.path); err != nil {
+					results <- stagedBlob{path: j.path, err: err}
+					continue
+				}
+
+				content, err := io.ReadAll(canceledReader{ctx, j.reader})
+				if err != nil {
+					results <- stagedBlob{path: j.path, err: fmt.Errorf("error reading content for %s: %w", j.path, err)}
+					continue
+				}
+
+				hash, err := createObject(content)
+				results <- stagedBlob{path: j.path, hash: hash, err: err}
+			}
+		}()
+	}
+
+	// feed the workers, then close results once they are all done
+	go func() {
+		for path, reader := range sources {
+			jobs <- job{path: filepath.ToSlash(path), reader: reader}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	staged := make(map[string][]byte)
+	var firstErr error
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		staged[result.path] = result.hash
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// flush the index once, holding the lock from reading it to writing it
+	// back so a concurrent add cannot lose its entries
+	paths := make([]string, 0, len(staged))
+	err := withIndexLock(func() error {
+		index, err := readIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		for path, hash := range staged {
+			index[path] = hash
+			paths = append(paths, path)
+		}
+
+		return writeIndex(ctx, index)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	return paths, nil
+}
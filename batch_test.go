@@ -0,0 +1,64 @@
+package mygit
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readerSources yields each path of files with a reader over its content.
+func readerSources(files map[string]string) func(yield func(string, io.Reader) bool) {
+	return func(yield func(string, io.Reader) bool) {
+		for path, content := range files {
+			if !yield(path, strings.NewReader(content)) {
+				return
+			}
+		}
+	}
+}
+
+func TestAddBlobs(t *testing.T) {
+	ctx := t.Context()
+	repo, err := Init(filepath.Join(t.TempDir(), "work"))
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+
+	files := map[string]string{}
+	for i := range 50 {
+		files[fmt.Sprintf("gen/file%02d.txt", i)] = fmt.Sprintf("generated content %d\n", i)
+	}
+
+	paths, err := repo.AddBlobs(ctx, readerSources(files))
+	assert.NoError(t, err)
+	assert.Equal(t, slices.Sorted(maps.Keys(files)), paths)
+
+	index, err := repo.ReadIndex(ctx)
+	assert.NoError(t, err)
+	for path, content := range files {
+		assert.Equal(t, fmt.Sprintf("%x", hashObject([]byte(content))), index[path], "hash mismatch for %s", path)
+	}
+
+	// a path outside the work tree, or into the repository, stages nothing
+	for _, path := range []string{"../escape.txt", "/abs.txt", ".mygit/config", "a//b"} {
+		_, err := repo.AddBlobs(ctx, readerSources(map[string]string{"ok.txt": "ok\n", path: "bad\n"}))
+		assert.Error(t, err, path)
+	}
+	index, err = repo.ReadIndex(ctx)
+	assert.NoError(t, err)
+	assert.NotContains(t, index, "ok.txt")
+
+	// the index is updated under its lock
+	lockPath := filepath.Join(repo.Root(), "."+vcsName, "index.lock")
+	assert.NoError(t, os.WriteFile(lockPath, nil, 0644))
+	_, err = repo.AddBlobs(ctx, readerSources(map[string]string{"locked.txt": "locked\n"}))
+	assert.ErrorContains(t, err, "index.lock")
+	assert.NoError(t, os.Remove(lockPath))
+}
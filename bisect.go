@@ -0,0 +1,474 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/bits"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// bisectBranch is the branch HEAD is moved to while bisecting, since HEAD
+// cannot point at a commit directly.
+const bisectBranch = "bisect"
+
+// bisectSkipCode is the exit code with which a "bisect run" command says
+// the commit cannot be tested.
+const bisectSkipCode = 125
+
+// bisectState records a bisect session: the branch to go back to, the
+// newest commit known to be bad, and the commits known to be good or
+// that cannot be tested.
+type bisectState struct {
+	origHead string // ref HEAD pointed to before the session
+	bad      []byte // nil until the first "bisect bad"
+	good     [][]byte
+	skip     [][]byte
+}
+
+// bisectStatePath returns the path of the bisect session file.
+func bisectStatePath() string {
+	return fmt.Sprintf("%s/BISECT", gitDir)
+}
+
+// isBisectInProgress checks if a bisect session exists.
+func isBisectInProgress() (bool, error) {
+	_, err := os.Stat(bisectStatePath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking BISECT: %w", err)
+	}
+
+	return true, nil
+}
+
+// readBisectState reads the state of the bisect session.
+func readBisectState() (bisectState, error) {
+	content, err := os.ReadFile(bisectStatePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return bisectState{}, fmt.Errorf("no bisect in progress; use '%s bisect start'", vcsName)
+	}
+	if err != nil {
+		return bisectState{}, fmt.Errorf("error reading BISECT: %w", err)
+	}
+
+	var state bisectState
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return bisectState{}, fmt.Errorf("invalid BISECT entry: %s", line)
+		}
+
+		if key == "orig" {
+			state.origHead = value
+			continue
+		}
+
+		hash, err := hex.DecodeString(value)
+		if err != nil {
+			return bisectState{}, fmt.Errorf("invalid BISECT entry: %s", line)
+		}
+		switch key {
+		case "bad":
+			state.bad = hash
+		case "good":
+			state.good = append(state.good, hash)
+		case "skip":
+			state.skip = append(state.skip, hash)
+		default:
+			return bisectState{}, fmt.Errorf("invalid BISECT entry: %s", line)
+		}
+	}
+
+	return state, nil
+}
+
+// writeBisectState writes the bisect session state to disk.
+func writeBisectState(state bisectState) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "orig %s\n", state.origHead)
+	if state.bad != nil {
+		fmt.Fprintf(&sb, "bad %x\n", state.bad)
+	}
+	for _, hash := range state.good {
+		fmt.Fprintf(&sb, "good %x\n", hash)
+	}
+	for _, hash := range state.skip {
+		fmt.Fprintf(&sb, "skip %x\n", hash)
+	}
+
+	if err := os.WriteFile(bisectStatePath(), []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("error writing BISECT: %w", err)
+	}
+
+	return nil
+}
+
+// startBisect starts a session from the current branch, optionally with
+// a known bad commit and good commits. The working tree must be clean,
+// since each step checks out another commit.
+func startBisect(ctx context.Context, bad string, good []string) error {
+	if yes, err := isBisectInProgress(); err != nil {
+		return err
+	} else if yes {
+		return fmt.Errorf("bisect already in progress; use '%s bisect reset' first", vcsName)
+	}
+
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if yes {
+		return errorOf(ErrConflict, "merge in progress; please resolve conflicts and commit first")
+	}
+
+	if exists, err := refExists("refs/heads/" + bisectBranch); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("a branch named %s already exists; rename or delete it to bisect", bisectBranch)
+	}
+
+	if err := checkUncommittedChanges(ctx); err != nil {
+		return fmt.Errorf("please commit your changes before bisecting: %w", err)
+	}
+	if err := checkUnstagedChanges(ctx); err != nil {
+		return fmt.Errorf("please stage and commit your changes before bisecting: %w", err)
+	}
+
+	head, err := getHEAD()
+	if err != nil {
+		return err
+	}
+
+	state := bisectState{origHead: head}
+	if bad != "" {
+		if state.bad, err = resolveCommit(bad); err != nil {
+			return err
+		}
+	}
+	for _, rev := range good {
+		hash, err := resolveCommit(rev)
+		if err != nil {
+			return err
+		}
+		state.good = append(state.good, hash)
+	}
+
+	if err := writeBisectState(state); err != nil {
+		return err
+	}
+
+	_, _, err = bisectNext(ctx, state)
+	return err
+}
+
+// markBisect records the commits named by revs, or HEAD when revs is
+// empty, as "good", "bad", or "skip", and checks out the next commit to
+// test. done is set once the session has found the first bad commit,
+// which is returned, or has only untestable commits left.
+func markBisect(ctx context.Context, term string, revs []string) (first []byte, done bool, err error) {
+	state, err := readBisectState()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+	if term == "bad" && len(revs) > 1 {
+		return nil, false, fmt.Errorf("only one commit can be marked bad")
+	}
+
+	for _, rev := range revs {
+		hash, err := resolveCommit(rev)
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch term {
+		case "bad":
+			state.bad = hash
+		case "good":
+			state.good = append(state.good, hash)
+		case "skip":
+			state.skip = append(state.skip, hash)
+		default:
+			return nil, false, fmt.Errorf("unknown bisect term: %s", term)
+		}
+	}
+
+	if err := writeBisectState(state); err != nil {
+		return nil, false, err
+	}
+
+	return bisectNext(ctx, state)
+}
+
+// bisectCandidates returns the commits reachable from bad but from none of
+// good, nearest first, with how many of them each commit reaches
+// (counting itself).
+func bisectCandidates(ctx context.Context, bad []byte, good [][]byte) ([][]byte, map[string]int, error) {
+	graph, err := loadCommitGraph()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// walk breadth first from starts, skipping commits in stop
+	walk := func(starts [][]byte, stop map[string]bool) ([][]byte, error) {
+		var commits [][]byte
+		seen := make(map[string]bool)
+		pending := slices.Clone(starts)
+		for len(pending) > 0 {
+			current := pending[0]
+			pending = pending[1:]
+
+			key := hex.EncodeToString(current)
+			if seen[key] || stop[key] {
+				continue
+			}
+			seen[key] = true
+			commits = append(commits, current)
+
+			parents, err := graph.parentsOf(ctx, current)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, parents...)
+		}
+
+		return commits, nil
+	}
+
+	goodAncestors, err := walk(good, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	excluded := make(map[string]bool)
+	for _, hash := range goodAncestors {
+		excluded[hex.EncodeToString(hash)] = true
+	}
+
+	candidates, err := walk([][]byte{bad}, excluded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reach := make(map[string]int)
+	for _, hash := range candidates {
+		reached, err := walk([][]byte{hash}, excluded)
+		if err != nil {
+			return nil, nil, err
+		}
+		reach[hex.EncodeToString(hash)] = len(reached)
+	}
+
+	return candidates, reach, nil
+}
+
+// bisectNext checks out the commit that best halves the commits still in
+// question: of the n candidates, the one reaching closest to n/2 of them.
+// When nothing is left to test, the outcome is reported and done is set.
+func bisectNext(ctx context.Context, state bisectState) (first []byte, done bool, err error) {
+	if state.bad == nil || len(state.good) == 0 {
+		switch {
+		case state.bad == nil && len(state.good) == 0:
+			fmt.Println("status: waiting for both good and bad commits")
+		case state.bad == nil:
+			fmt.Println("status: waiting for a bad commit, 1 good commit known")
+		default:
+			fmt.Println("status: waiting for good commit(s), bad commit known")
+		}
+		return nil, false, nil
+	}
+
+	for _, good := range state.good {
+		if ok, err := isAncestor(good, state.bad); err != nil {
+			return nil, false, err
+		} else if !ok {
+			return nil, false, fmt.Errorf("good commit %s is not an ancestor of bad commit %s", abbrevHash(good), abbrevHash(state.bad))
+		}
+	}
+
+	candidates, reach, err := bisectCandidates(ctx, state.bad, state.good)
+	if err != nil {
+		return nil, false, err
+	}
+
+	skipped := make(map[string]bool)
+	for _, hash := range state.skip {
+		skipped[hex.EncodeToString(hash)] = true
+	}
+
+	n := len(candidates)
+	var next []byte
+	best := 0
+	for _, hash := range candidates {
+		key := hex.EncodeToString(hash)
+		if skipped[key] {
+			continue
+		}
+		if score := min(reach[key], n-reach[key]); score > best {
+			next, best = hash, score
+		}
+	}
+
+	if next == nil {
+		first, err := reportFirstBad(state.bad, candidates, skipped)
+		return first, true, err
+	}
+
+	// whichever way the test goes, one side of next stays in question
+	left := max(reach[hex.EncodeToString(next)]-1, n-reach[hex.EncodeToString(next)]-1)
+	fmt.Printf("Bisecting: %d revisions left to test after this (roughly %d steps)\n", left, bits.Len(uint(left)))
+
+	if err := checkoutBisectCommit(ctx, next); err != nil {
+		return nil, false, err
+	}
+
+	commit, err := readCommit(next)
+	if err != nil {
+		return nil, false, err
+	}
+	fmt.Printf("[%x] %s\n", next, commitSubject(commit))
+	return nil, false, nil
+}
+
+// reportFirstBad prints the outcome of a finished session. When commits
+// between the last good ones and bad were skipped, any of them may be the
+// first bad commit and all are listed; otherwise bad is returned.
+func reportFirstBad(bad []byte, candidates [][]byte, skipped map[string]bool) ([]byte, error) {
+	var untested [][]byte
+	for _, hash := range candidates {
+		if skipped[hex.EncodeToString(hash)] {
+			untested = append(untested, hash)
+		}
+	}
+
+	if len(untested) > 0 {
+		fmt.Println("There are only 'skip'ped commits left to test.")
+		fmt.Println("The first bad commit could be any of:")
+		for _, hash := range append(untested, bad) {
+			fmt.Printf("%x\n", hash)
+		}
+		return nil, nil
+	}
+
+	commit, err := readCommit(bad)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("%x is the first bad commit\n", bad)
+	printCommitHeader(bad, commit)
+	return bad, nil
+}
+
+// checkoutBisectCommit moves the bisect branch to commitHash, checking it
+// out. The first step switches from the original branch to it.
+func checkoutBisectCommit(ctx context.Context, commitHash []byte) error {
+	head, err := getHEAD()
+	if err != nil {
+		return err
+	}
+	if head == "refs/heads/"+bisectBranch {
+		return resetToCommit(ctx, commitHash, resetModeHard)
+	}
+
+	if err := createBranch(bisectBranch, commitHash); err != nil {
+		return err
+	}
+
+	return checkoutJournaled(ctx, commitHash, bisectBranch)
+}
+
+// resetBisect ends the session, checking the original branch out again
+// and deleting the bisect branch.
+func resetBisect(ctx context.Context) error {
+	state, err := readBisectState()
+	if err != nil {
+		return err
+	}
+
+	head, err := getHEAD()
+	if err != nil {
+		return err
+	}
+	if head == "refs/heads/"+bisectBranch {
+		origHash, err := readRefIfExists(state.origHead)
+		if err != nil {
+			return err
+		}
+		if origHash == nil {
+			return fmt.Errorf("%s no longer exists; check out a branch before resetting", state.origHead)
+		}
+		if err := checkoutJournaled(ctx, origHash, strings.TrimPrefix(state.origHead, "refs/heads/")); err != nil {
+			return err
+		}
+	}
+
+	if exists, err := refExists("refs/heads/" + bisectBranch); err != nil {
+		return err
+	} else if exists {
+		if err := deleteRef("refs/heads/" + bisectBranch); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(bisectStatePath()); err != nil {
+		return fmt.Errorf("error removing BISECT: %w", err)
+	}
+
+	return nil
+}
+
+// runBisect runs command at each step and marks the commit by its exit
+// code: 0 is good, 125 is skip, and 1 to 127 otherwise is bad. Any other
+// outcome, such as the command not starting or being killed, stops the
+// run. It returns the first bad commit, or nil if only untestable commits
+// were left.
+func runBisect(ctx context.Context, command []string) ([]byte, error) {
+	state, err := readBisectState()
+	if err != nil {
+		return nil, err
+	}
+	if state.bad == nil || len(state.good) == 0 {
+		return nil, fmt.Errorf("bisect run needs a bad and a good commit; mark them first")
+	}
+
+	for {
+		fmt.Printf("running %s\n", strings.Join(command, " "))
+
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Dir = workTreeRoot
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err := cmd.Run()
+
+		term := "good"
+		if err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return nil, fmt.Errorf("bisect run failed: %w", err)
+			}
+
+			code := exitErr.ExitCode()
+			switch {
+			case code == bisectSkipCode:
+				term = "skip"
+			case code > 0 && code < 128:
+				term = "bad"
+			default:
+				return nil, fmt.Errorf("bisect run failed: %s exited with %w", command[0], err)
+			}
+		}
+
+		first, done, err := markBisect(ctx, term, nil)
+		if err != nil || done {
+			return first, err
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBisect(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("bisect-test")
+
+	if err := updateConfig("email", "bisect@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	assert.NoError(t, os.MkdirAll("bisect-test", 0755))
+	var commits [][]byte
+	for i := 1; i <= 8; i++ {
+		content := []byte(fmt.Sprintf("%d\n", i))
+		assert.NoError(t, os.WriteFile("bisect-test/version", content, 0644))
+		blobHash, err := createObject(content)
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), "bisect-test/version", blobHash))
+		commitHash, err := createCommit(t.Context(), fmt.Sprintf("version %d", i))
+		assert.NoError(t, err)
+		commits = append(commits, commitHash)
+	}
+
+	// the commits after the good one, nearest first, and how many each reaches
+	candidates, reach, err := bisectCandidates(t.Context(), commits[7], [][]byte{commits[0]})
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 7)
+	assert.Equal(t, commits[7], candidates[0])
+	assert.Equal(t, 3, reach[fmt.Sprintf("%x", commits[3])]) // versions 4, 3, and 2
+
+	// version 5 introduced the bug
+	assert.NoError(t, startBisect(t.Context(), "HEAD", []string{fmt.Sprintf("%x", commits[0])}))
+	version := func() int {
+		content, err := os.ReadFile("bisect-test/version")
+		assert.NoError(t, err)
+		var n int
+		fmt.Sscanf(string(content), "%d", &n)
+		return n
+	}
+
+	var first []byte
+	for steps := 0; steps < 8; steps++ {
+		term := "good"
+		if version() >= 5 {
+			term = "bad"
+		}
+
+		var done bool
+		first, done, err = markBisect(t.Context(), term, nil)
+		assert.NoError(t, err)
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, commits[4], first)
+
+	head, err := getHEAD()
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/"+bisectBranch, head)
+
+	// reset returns to the branch and its latest commit
+	assert.NoError(t, resetBisect(t.Context()))
+	head, err = getHEAD()
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/main", head)
+	assert.Equal(t, 8, version())
+	exists, err := refExists("refs/heads/" + bisectBranch)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	inProgress, err := isBisectInProgress()
+	assert.NoError(t, err)
+	assert.False(t, inProgress)
+}
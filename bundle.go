@@ -0,0 +1,453 @@
+package mygit
+
+import (
+	"bufio"
+	"compress/flate"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// bundleSignature is the first line of every bundle file.
+const bundleSignature = "# " + vcsName + " bundle v1"
+
+// bundle is the parsed header of a bundle file: the refs it carries, the
+// commits a repository must already have to use it, and the branch HEAD
+// pointed to when it was created. The objects follow the header as a
+// compressed pack of "<hex id> <size>\n<object data>" records.
+type bundle struct {
+	format        string
+	head          string            // ref path, or "" if HEAD's branch is not included
+	refs          map[string][]byte // ref path -> commit
+	prerequisites [][]byte
+}
+
+// bundleRevisions turns bundle create arguments into the refs to include,
+// the commits to start from, and the commits whose history is left out.
+// Arguments are ref names, HEAD, --all, ^<rev> exclusions and <a>..<b> ranges.
+func bundleRevisions(ctx context.Context, args []string) (map[string][]byte, [][]byte, [][]byte, error) {
+	refs := make(map[string][]byte)
+	var include, exclude [][]byte
+
+	addRef := func(name string) error {
+		if name == "HEAD" {
+			head, err := getHEAD()
+			if err != nil {
+				return err
+			}
+			name = head
+		}
+
+		for _, refPath := range []string{name, "refs/heads/" + name, "refs/tags/" + name} {
+			if !strings.HasPrefix(refPath, "refs/") {
+				continue
+			}
+			hash, err := readRefIfExists(refPath)
+			if err != nil {
+				return err
+			}
+			if hash != nil {
+				refs[refPath] = hash
+				include = append(include, hash)
+				return nil
+			}
+		}
+
+		// a plain revision contributes history but no ref
+		hash, err := resolveRevision(name)
+		if err != nil {
+			return err
+		}
+		include = append(include, hash)
+		return nil
+	}
+
+	for _, arg := range args {
+		switch {
+		case arg == "--all":
+			for _, dir := range []string{"refs/heads", "refs/tags"} {
+				names, err := listRefNames(ctx, dir)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				for _, name := range names {
+					if err := addRef(dir + "/" + name); err != nil {
+						return nil, nil, nil, err
+					}
+				}
+			}
+		case strings.HasPrefix(arg, "^"):
+			hash, err := resolveRevision(arg[1:])
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			exclude = append(exclude, hash)
+		case strings.Contains(arg, ".."):
+			from, to, _ := strings.Cut(arg, "..")
+			hash, err := resolveRevision(from)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			exclude = append(exclude, hash)
+			if err := addRef(to); err != nil {
+				return nil, nil, nil, err
+			}
+		default:
+			if err := addRef(arg); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	if len(refs) == 0 {
+		return nil, nil, nil, fmt.Errorf("refusing to create a bundle without any refs")
+	}
+
+	return refs, include, exclude, nil
+}
+
+// createBundle writes a bundle with the refs named by args and every object
+// reachable from them that is not reachable from the excluded commits. It
+// returns the number of objects written.
+func createBundle(ctx context.Context, w io.Writer, args []string) (int, error) {
+	if err := checkVCSRepo(); err != nil {
+		return 0, err
+	}
+
+	refs, include, exclude, err := bundleRevisions(ctx, args)
+	if err != nil {
+		return 0, err
+	}
+
+	wanted, err := reachableObjects(include)
+	if err != nil {
+		return 0, err
+	}
+	have, err := reachableObjects(exclude)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	for id := range wanted {
+		if _, ok := have[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	// header
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, bundleSignature)
+	fmt.Fprintf(bw, "@object-format=%s\n", objectFormat())
+	if head, err := getHEAD(); err == nil {
+		if _, ok := refs[head]; ok {
+			fmt.Fprintf(bw, "@head=%s\n", head)
+		}
+	}
+	for _, hash := range exclude {
+		fmt.Fprintf(bw, "-%x\n", hash)
+	}
+	for _, refPath := range slices.Sorted(maps.Keys(refs)) {
+		fmt.Fprintf(bw, "%x %s\n", refs[refPath], refPath)
+	}
+	fmt.Fprintln(bw)
+
+	// pack
+	fw, err := flate.NewWriter(bw, flate.BestCompression)
+	if err != nil {
+		return 0, fmt.Errorf("error creating bundle: %w", err)
+	}
+	for _, id := range ids {
+		hash, _ := hex.DecodeString(id)
+		data, _, _, err := readRawObject(hash)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := fmt.Fprintf(fw, "%s %d\n", id, len(data)); err != nil {
+			return 0, fmt.Errorf("error writing bundle: %w", err)
+		}
+		if _, err := fw.Write(data); err != nil {
+			return 0, fmt.Errorf("error writing bundle: %w", err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		return 0, fmt.Errorf("error writing bundle: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("error writing bundle: %w", err)
+	}
+
+	return len(ids), nil
+}
+
+// readBundleHeader parses the header of a bundle and leaves r at the
+// start of the pack.
+func readBundleHeader(r *bufio.Reader) (bundle, error) {
+	b := bundle{format: "sha1", refs: make(map[string][]byte)}
+
+	line, err := r.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != bundleSignature {
+		return b, fmt.Errorf("not a %s bundle", vcsName)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return b, fmt.Errorf("error reading bundle header: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			return b, nil
+		case strings.HasPrefix(line, "@object-format="):
+			b.format = strings.TrimPrefix(line, "@object-format=")
+		case strings.HasPrefix(line, "@head="):
+			b.head = strings.TrimPrefix(line, "@head=")
+		case strings.HasPrefix(line, "-"):
+			hash, err := hex.DecodeString(line[1:])
+			if err != nil {
+				return b, fmt.Errorf("invalid bundle prerequisite: %s", line)
+			}
+			b.prerequisites = append(b.prerequisites, hash)
+		default:
+			hexHash, refPath, ok := strings.Cut(line, " ")
+			hash, err := hex.DecodeString(hexHash)
+			if !ok || err != nil || !strings.HasPrefix(refPath, "refs/") {
+				return b, fmt.Errorf("invalid bundle ref: %s", line)
+			}
+			b.refs[refPath] = hash
+		}
+	}
+}
+
+// openBundle opens a bundle file and parses its header.
+func openBundle(path string) (*os.File, *bufio.Reader, bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, bundle{}, fmt.Errorf("error opening bundle: %w", err)
+	}
+
+	r := bufio.NewReader(f)
+	b, err := readBundleHeader(r)
+	if err != nil {
+		f.Close()
+		return nil, nil, bundle{}, err
+	}
+
+	return f, r, b, nil
+}
+
+// verifyBundle checks that the repository can use the bundle: the object
+// formats match and every prerequisite commit is present.
+func verifyBundle(b bundle) error {
+	if b.format != objectFormat() {
+		return fmt.Errorf("bundle uses %s object ids but this repository uses %s", b.format, objectFormat())
+	}
+
+	for _, hash := range b.prerequisites {
+		if !objectExists(hash) {
+			return fmt.Errorf("repository lacks the prerequisite commit %x", hash)
+		}
+	}
+
+	return nil
+}
+
+// unpackBundle stores every object of the bundle pack, verifying each id
+// against its content, and returns the number of objects stored. It stops
+// between objects once ctx is done.
+func unpackBundle(ctx context.Context, r io.Reader) (int, error) {
+	pack := bufio.NewReader(flate.NewReader(r))
+	count := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		line, err := pack.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("error reading bundle objects: %w", err)
+		}
+
+		id, sizeText, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		size, err := strconv.Atoi(sizeText)
+		if !ok || err != nil || size < 0 {
+			return count, fmt.Errorf("invalid bundle object record: %q", line)
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(pack, data); err != nil {
+			return count, fmt.Errorf("error reading bundle object %s: %w", id, err)
+		}
+
+		hash := sumObject(data)
+		if hex.EncodeToString(hash) != id {
+			return count, fmt.Errorf("bundle object %s is corrupt", id)
+		}
+
+		if !objectExists(hash) {
+			if err := writeObjectFile(hash, data); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+}
+
+// fetchBundle stores the bundle's objects and updates each of its refs
+// that is new or fast-forwards. It returns one line per ref describing the
+// outcome. Unless updateHead is set or the repository is bare, the checked
+// out branch is left alone so the working tree keeps matching HEAD.
+func fetchBundle(ctx context.Context, path string, updateHead bool) ([]string, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	f, r, b, err := openBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := verifyBundle(b); err != nil {
+		return nil, err
+	}
+	if _, err := unpackBundle(ctx, r); err != nil {
+		return nil, err
+	}
+
+	current := ""
+	if !updateHead && !bareRepository {
+		current, _ = getHEAD()
+	}
+
+	var results []string
+	for _, refPath := range slices.Sorted(maps.Keys(b.refs)) {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		hash := b.refs[refPath]
+
+		old, err := readRefIfExists(refPath)
+		if err != nil {
+			return results, err
+		}
+
+		switch {
+		case slices.Equal(old, hash):
+			results = append(results, fmt.Sprintf("%s: up to date", refPath))
+			continue
+		case refPath == current:
+			results = append(results, fmt.Sprintf("%s: rejected (checked out)", refPath))
+			continue
+		case old != nil:
+			if ok, err := isAncestor(old, hash); err != nil {
+				return results, err
+			} else if !ok {
+				results = append(results, fmt.Sprintf("%s: rejected (non-fast-forward)", refPath))
+				continue
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fmt.Sprintf("%s/%s", commonDir, refPath)), 0755); err != nil {
+			return results, fmt.Errorf("error creating ref directory: %w", err)
+		}
+		if err := compareAndSwapRef(refPath, old, hash); err != nil {
+			return results, err
+		}
+		results = append(results, fmt.Sprintf("%s: %s", refPath, abbrevHash(hash)))
+	}
+
+	return results, nil
+}
+
+// cloneBundle creates a repository at dir from a bundle without
+// prerequisites and checks out the branch HEAD pointed to when the bundle
+// was created.
+func cloneBundle(ctx context.Context, path, dir string) error {
+	absBundle, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", path, err)
+	}
+
+	f, _, b, err := openBundle(absBundle)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	if len(b.prerequisites) > 0 {
+		return fmt.Errorf("cannot clone from a bundle with prerequisites; use bundle unbundle in a repository that has them")
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", dir, err)
+	}
+
+	clone := worktreeInfo{path: absDir, metaDir: filepath.Join(absDir, "."+vcsName)}
+	return withWorktree(clone, func() error {
+		if err := createDirectoriesFiles(); err != nil {
+			return err
+		}
+		if err := updateConfig("objectFormat", b.format); err != nil {
+			return err
+		}
+
+		head := b.head
+		if head == "" {
+			// fall back to the first branch in the bundle
+			for _, refPath := range slices.Sorted(maps.Keys(b.refs)) {
+				if strings.HasPrefix(refPath, "refs/heads/") {
+					head = refPath
+					break
+				}
+			}
+		}
+		if head != "" {
+			if err := os.WriteFile(fmt.Sprintf("%s/HEAD", gitDir), []byte("ref: "+head), 0644); err != nil {
+				return fmt.Errorf("error updating HEAD: %w", err)
+			}
+		}
+		if head != "" && head != "refs/heads/main" {
+			if err := deleteRef("refs/heads/main"); err != nil {
+				return err
+			}
+		}
+
+		// the working tree is checked out below
+		if _, err := fetchBundle(ctx, absBundle, true); err != nil {
+			return err
+		}
+
+		if head == "" {
+			return nil
+		}
+		commitHash, err := readRefIfExists(head)
+		if err != nil || commitHash == nil {
+			return err
+		}
+
+		return checkoutCommit(ctx, commitHash)
+	})
+}
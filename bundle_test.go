@@ -0,0 +1,90 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundleCloneAndUnbundle(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "bundle@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	commit := func(content string, parents ...[]byte) []byte {
+		blobHash, err := createObject([]byte(content))
+		assert.NoError(t, err)
+		treeHash, err := buildTreeObject(map[string][]byte{"file.txt": blobHash})
+		assert.NoError(t, err)
+		commitHash, err := writeCommitObject(treeHash, parents, content)
+		assert.NoError(t, err)
+		return commitHash
+	}
+
+	first := commit("first")
+	second := commit("second", first)
+	assert.NoError(t, updateRef("refs/heads/main", second))
+
+	dir := t.TempDir()
+	fullBundle := filepath.Join(dir, "full.bundle")
+	f, err := os.Create(fullBundle)
+	assert.NoError(t, err)
+	count, err := createBundle(t.Context(), f, []string{"main"})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.Equal(t, 6, count) // a commit, tree, and blob per commit
+
+	clonePath := filepath.Join(dir, "clone")
+	assert.NoError(t, cloneBundle(t.Context(), fullBundle, clonePath))
+
+	content, err := os.ReadFile(filepath.Join(clonePath, "file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+
+	// an incremental bundle only carries what the clone is missing
+	third := commit("third", second)
+	assert.NoError(t, updateRef("refs/heads/feature", third))
+
+	incremental := filepath.Join(dir, "incremental.bundle")
+	f, err = os.Create(incremental)
+	assert.NoError(t, err)
+	count, err = createBundle(t.Context(), f, []string{"main..feature"})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.Equal(t, 3, count)
+
+	clone := worktreeInfo{path: clonePath, metaDir: filepath.Join(clonePath, "."+vcsName)}
+	err = withWorktree(clone, func() error {
+		results, err := fetchBundle(t.Context(), incremental, false)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, []string{fmt.Sprintf("refs/heads/feature: %s", abbrevHash(third))}, results)
+
+		hash, err := readRefIfExists("refs/heads/feature")
+		assert.Equal(t, third, hash)
+		return err
+	})
+	assert.NoError(t, err)
+
+	// a repository without the prerequisite commits cannot use it
+	emptyPath := filepath.Join(dir, "empty")
+	assert.NoError(t, os.MkdirAll(emptyPath, 0755))
+	empty := worktreeInfo{path: emptyPath, metaDir: filepath.Join(emptyPath, "."+vcsName)}
+	err = withWorktree(empty, func() error {
+		if err := createDirectoriesFiles(); err != nil {
+			return err
+		}
+		_, err := fetchBundle(t.Context(), incremental, false)
+		return err
+	})
+	assert.ErrorContains(t, err, "prerequisite")
+}
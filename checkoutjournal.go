@@ -0,0 +1,437 @@
+package mygit
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// checkoutJournalFile records a checkout while it runs. It is written before
+// the working tree is touched and removed once the index and HEAD match the
+// new commit, so its presence means a checkout was interrupted.
+const checkoutJournalFile = "CHECKOUT_JOURNAL"
+
+// checkoutJournal describes a checkout: the commit being checked out, where
+// HEAD pointed before and where it moves to, and every path whose content
+// changes, with its old and new object id (nil when absent).
+type checkoutJournal struct {
+	target     []byte
+	origHead   string // the branch ref, or the commit id of a detached HEAD
+	targetHead string // "" if HEAD does not move, detachedHead to detach it at target
+	changes    []fileChange
+}
+
+// checkoutJournalPath returns the path of the journal in the current
+// worktree's metadata directory.
+func checkoutJournalPath() string {
+	return filepath.Join(gitDir, checkoutJournalFile)
+}
+
+// isCheckoutInterrupted reports whether a checkout journal was left behind.
+func isCheckoutInterrupted() (bool, error) {
+	_, err := os.Stat(checkoutJournalPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking %s: %w", checkoutJournalFile, err)
+	}
+
+	return true, nil
+}
+
+// requireNoInterruptedCheckout refuses to run a command that reads or
+// writes the working tree while it may disagree with the index and HEAD.
+func requireNoInterruptedCheckout() error {
+	interrupted, err := isCheckoutInterrupted()
+	if err != nil {
+		return err
+	}
+	if interrupted {
+		return fmt.Errorf("a checkout was interrupted; run '%s checkout --continue' to finish it or '%s checkout --abort' to go back", vcsName, vcsName)
+	}
+
+	return nil
+}
+
+// writeCheckoutJournal records the planned checkout. The file is written
+// to a temporary name and renamed, so a journal is never half written.
+func writeCheckoutJournal(journal checkoutJournal) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("target %x\n", journal.target))
+	sb.WriteString(fmt.Sprintf("orig-head %s\n", journal.origHead))
+	sb.WriteString(fmt.Sprintf("target-head %s\n", journal.targetHead))
+	for _, change := range journal.changes {
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", journalHash(change.oldHash), journalHash(change.newHash), change.path))
+	}
+
+	path := checkoutJournalPath()
+	if err := os.WriteFile(path+".tmp", []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", checkoutJournalFile, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error writing %s: %w", checkoutJournalFile, err)
+	}
+
+	return nil
+}
+
+// journalHash formats an object id for the journal, "-" standing for none.
+func journalHash(hash []byte) string {
+	if hash == nil {
+		return "-"
+	}
+
+	return hex.EncodeToString(hash)
+}
+
+// readCheckoutJournal reads the journal of an interrupted checkout.
+func readCheckoutJournal() (checkoutJournal, error) {
+	var journal checkoutJournal
+
+	f, err := os.Open(checkoutJournalPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return journal, fmt.Errorf("no interrupted checkout to recover")
+		}
+		return journal, fmt.Errorf("error reading %s: %w", checkoutJournalFile, err)
+	}
+	defer f.Close()
+
+	decode := func(s string) ([]byte, error) {
+		if s == "-" {
+			return nil, nil
+		}
+		return hex.DecodeString(s)
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if value, ok := strings.CutPrefix(line, "target "); ok {
+			if journal.target, err = hex.DecodeString(value); err != nil {
+				return journal, fmt.Errorf("invalid %s line: %s", checkoutJournalFile, line)
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "orig-head "); ok {
+			journal.origHead = value
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "target-head "); ok {
+			journal.targetHead = value
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return journal, fmt.Errorf("invalid %s line: %s", checkoutJournalFile, line)
+		}
+		oldHash, err := decode(fields[0])
+		if err != nil {
+			return journal, fmt.Errorf("invalid %s line: %s", checkoutJournalFile, line)
+		}
+		newHash, err := decode(fields[1])
+		if err != nil {
+			return journal, fmt.Errorf("invalid %s line: %s", checkoutJournalFile, line)
+		}
+		journal.changes = append(journal.changes, fileChange{path: fields[2], oldHash: oldHash, newHash: newHash})
+	}
+	if err := scanner.Err(); err != nil {
+		return journal, fmt.Errorf("error reading %s: %w", checkoutJournalFile, err)
+	}
+
+	if journal.target == nil || journal.origHead == "" {
+		return journal, fmt.Errorf("%s is incomplete", checkoutJournalFile)
+	}
+
+	return journal, nil
+}
+
+// checkoutJournaled checks out commitHash and, if branchName is not empty,
+// points HEAD at that branch, or detaches it at commitHash for
+// detachedHead. The planned changes are journaled first, so a checkout
+// that fails part way can be finished or undone.
+func checkoutJournaled(ctx context.Context, commitHash []byte, branchName string) error {
+	treeHash, err := resolveTreeHash(commitHash)
+	if err != nil {
+		return err
+	}
+
+	oldIndex, err := readIndex(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading old index: %w", err)
+	}
+	newIndex, err := buildIndexFromTree(ctx, treeHash, "", false)
+	if err != nil {
+		return fmt.Errorf("error reading tree: %w", err)
+	}
+
+	origHead, err := getHEAD()
+	if err != nil {
+		return err
+	}
+	if origHead == detachedHead {
+		headHash, err := getRef(detachedHead)
+		if err != nil {
+			return err
+		}
+		origHead = hex.EncodeToString(headHash)
+	}
+
+	journal := checkoutJournal{target: commitHash, origHead: origHead, changes: diffIndexes(oldIndex, newIndex)}
+	switch branchName {
+	case "":
+	case detachedHead:
+		journal.targetHead = detachedHead
+	default:
+		journal.targetHead = fmt.Sprintf("refs/heads/%s", branchName)
+	}
+	slices.SortFunc(journal.changes, func(a, b fileChange) int { return strings.Compare(a.path, b.path) })
+
+	if err := writeCheckoutJournal(journal); err != nil {
+		return err
+	}
+
+	return finishCheckout(ctx, journal)
+}
+
+// switchBranch switches the working tree, index, and HEAD to the named
+// branch, refusing while there are uncommitted or unstaged changes. Any
+// other revision, such as a tag, a short hash, or HEAD~2, is checked out
+// with HEAD detached at its commit. It reports false if the branch or
+// commit was already checked out.
+func switchBranch(ctx context.Context, branchName string) (bool, error) {
+	if err := requireNoInterruptedCheckout(); err != nil {
+		return false, err
+	}
+
+	// check if branch is current branch
+	currentBranch, err := getCurrentBranch()
+	if err != nil {
+		return false, err
+	}
+	if branchName == currentBranch || branchName == detachedHead {
+		return false, nil
+	}
+
+	// resolve the target first, so a revision that names nothing is
+	// reported as such rather than as changes in the way
+	target := branchName
+	refPath := fmt.Sprintf("refs/heads/%s", branchName)
+	exists, err := refExists(refPath)
+	if err != nil {
+		return false, err
+	}
+
+	var commitHash []byte
+	if exists {
+		// a branch can only be checked out in one working tree
+		if other, ok, err := worktreeForBranch(branchName); err != nil {
+			return false, err
+		} else if ok {
+			return false, fmt.Errorf("branch %s is already checked out at %s", branchName, other)
+		}
+
+		if commitHash, err = getRef(refPath); err != nil {
+			return false, err
+		}
+		if commitHash == nil {
+			return false, fmt.Errorf("branch %s has no commits", branchName)
+		}
+	} else {
+		// a revision that is not a branch detaches HEAD
+		if commitHash, err = resolveCommit(branchName); err != nil {
+			return false, err
+		}
+		target = detachedHead
+
+		if currentBranch == detachedHead {
+			headHash, err := getRef(detachedHead)
+			if err != nil {
+				return false, err
+			}
+			if slices.Equal(headHash, commitHash) {
+				return false, nil
+			}
+		}
+	}
+
+	// check for uncommitted changes
+	if err := checkUncommittedChanges(ctx); err != nil {
+		return false, fmt.Errorf("please commit your changes before switching branches: %w", err)
+	}
+
+	// check for unstaged changes
+	if err := checkUnstagedChanges(ctx); err != nil {
+		return false, fmt.Errorf("please stage your changes before switching branches: %w", err)
+	}
+
+	// restore working directory to that commit and point HEAD at the branch
+	if err := checkoutJournaled(ctx, commitHash, target); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// finishCheckout applies a journaled checkout: the working tree, then the
+// index, then HEAD. Each step can be repeated, so it also rolls an
+// interrupted checkout forward. Once ctx is done it stops between files and
+// leaves the journal, so the checkout can be finished or aborted later.
+func finishCheckout(ctx context.Context, journal checkoutJournal) error {
+	treeHash, err := resolveTreeHash(journal.target)
+	if err != nil {
+		return err
+	}
+
+	index, err := restoreTree(ctx, treeHash, "", true)
+	if err != nil {
+		return fmt.Errorf("error restoring tree: %w", err)
+	}
+
+	if err := removeJournaledFiles(journal.changes, false); err != nil {
+		return err
+	}
+
+	if err := writeIndex(ctx, index); err != nil {
+		return fmt.Errorf("error updating index: %w", err)
+	}
+
+	switch journal.targetHead {
+	case "":
+	case detachedHead:
+		if err := detachHead(journal.target); err != nil {
+			return err
+		}
+	default:
+		if err := checkoutBranch(strings.TrimPrefix(journal.targetHead, "refs/heads/")); err != nil {
+			return err
+		}
+	}
+
+	return removeCheckoutJournal()
+}
+
+// abortCheckout rolls an interrupted checkout back: every journaled path
+// gets its old content again, and the index and HEAD are restored.
+func abortCheckout(ctx context.Context, journal checkoutJournal) error {
+	treeHash, err := resolveTreeHash(journal.target)
+	if err != nil {
+		return err
+	}
+
+	// the old index is the new one with the journaled changes undone
+	index, err := buildIndexFromTree(ctx, treeHash, "", false)
+	if err != nil {
+		return fmt.Errorf("error reading tree: %w", err)
+	}
+	cone, err := loadSparseCone()
+	if err != nil {
+		return err
+	}
+
+	for _, change := range journal.changes {
+		if change.oldHash == nil {
+			delete(index, change.path)
+			continue
+		}
+		index[change.path] = change.oldHash
+
+		if !cone.contains(filepath.ToSlash(change.path)) {
+			continue // not checked out
+		}
+		if err := restoreJournaledFile(ctx, change.path, change.oldHash); err != nil {
+			return err
+		}
+	}
+
+	if err := removeJournaledFiles(journal.changes, true); err != nil {
+		return err
+	}
+
+	if err := writeIndex(ctx, index); err != nil {
+		return fmt.Errorf("error updating index: %w", err)
+	}
+
+	// a detached HEAD was recorded by its commit id
+	head := "ref: " + journal.origHead
+	if !strings.HasPrefix(journal.origHead, "refs/") {
+		head = journal.origHead
+	}
+	headPath := fmt.Sprintf("%s/HEAD", gitDir)
+	if err := os.WriteFile(headPath, []byte(head), 0644); err != nil {
+		return fmt.Errorf("error updating HEAD: %w", err)
+	}
+
+	return removeCheckoutJournal()
+}
+
+// restoreJournaledFile writes the blob hash to path. Submodule commits are
+// not in this repository's store; their directory is recreated instead.
+func restoreJournaledFile(ctx context.Context, path string, hash []byte) error {
+	if !objectExists(hash) {
+		if err := os.MkdirAll(workTreePath(path), workTreeDirMode); err != nil {
+			return fmt.Errorf("error creating directory %s: %w", path, err)
+		}
+		return nil
+	}
+
+	obj, err := catFile(hash)
+	if err != nil {
+		return err
+	}
+	blob, ok := obj.(blobObject)
+	if !ok {
+		return fmt.Errorf("object %x is not a blob", hash)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(workTreePath(dir), workTreeDirMode); err != nil {
+			return fmt.Errorf("error creating directory %s: %w", dir, err)
+		}
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return err
+	}
+	return conv.writeWorkTreeFile(ctx, path, path, blob.content)
+}
+
+// removeJournaledFiles deletes the paths a checkout removes (or, when
+// rolling back, the paths it added). Files already gone are fine, and a
+// submodule's checkout is never deleted.
+func removeJournaledFiles(changes []fileChange, rollback bool) error {
+	for _, change := range changes {
+		gone := change.newHash == nil
+		if rollback {
+			gone = change.oldHash == nil
+		}
+		if !gone || isNestedRepository(change.path) {
+			continue
+		}
+
+		if err := os.Remove(workTreePath(change.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error removing obsolete file %s: %w", change.path, err)
+		}
+	}
+
+	return nil
+}
+
+// removeCheckoutJournal marks the checkout as complete.
+func removeCheckoutJournal() error {
+	if err := os.Remove(checkoutJournalPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing %s: %w", checkoutJournalFile, err)
+	}
+
+	return nil
+}
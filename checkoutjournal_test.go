@@ -0,0 +1,155 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterruptedCheckout(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("journal-test")
+
+	if err := updateConfig("email", "journal@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	blobHash, err := createObject([]byte("feature"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{"journal-test/feature.txt": blobHash})
+	assert.NoError(t, err)
+	commitHash, err := writeCommitObject(treeHash, nil, "feature")
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef("refs/heads/feature", commitHash))
+
+	// a directory in the way makes the checkout fail part way
+	assert.NoError(t, os.MkdirAll("journal-test/feature.txt/blocker", 0755))
+
+	err = checkoutJournaled(t.Context(), commitHash, "feature")
+	assert.Error(t, err)
+
+	assert.ErrorContains(t, requireNoInterruptedCheckout(), "interrupted")
+	journal, err := readCheckoutJournal()
+	assert.NoError(t, err)
+	assert.Equal(t, commitHash, journal.target)
+	assert.Equal(t, "refs/heads/main", journal.origHead)
+	assert.Equal(t, "refs/heads/feature", journal.targetHead)
+	assert.Len(t, journal.changes, 1)
+
+	// rolling back leaves HEAD and the index where they were
+	assert.NoError(t, os.RemoveAll("journal-test/feature.txt"))
+	assert.NoError(t, abortCheckout(t.Context(), journal))
+	assert.NoError(t, requireNoInterruptedCheckout())
+
+	head, err := getHEAD()
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/main", head)
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Empty(t, index)
+
+	// a canceled checkout stops before it changes anything
+	canceled, cancel := context.WithCancel(t.Context())
+	cancel()
+	assert.ErrorIs(t, checkoutJournaled(canceled, commitHash, "feature"), context.Canceled)
+	assert.NoError(t, requireNoInterruptedCheckout())
+	_, err = os.Stat("journal-test/feature.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	// a checkout that stopped part way can also be rolled forward
+	assert.NoError(t, os.MkdirAll("journal-test/feature.txt/blocker", 0755))
+	assert.Error(t, checkoutJournaled(t.Context(), commitHash, "feature"))
+	assert.NoError(t, os.RemoveAll("journal-test/feature.txt"))
+
+	journal, err = readCheckoutJournal()
+	assert.NoError(t, err)
+	assert.NoError(t, finishCheckout(t.Context(), journal))
+
+	head, err = getHEAD()
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/feature", head)
+	content, err := os.ReadFile("journal-test/feature.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "feature", string(content))
+
+	_, err = readCheckoutJournal()
+	assert.Error(t, err)
+}
+
+func TestCheckoutRevision(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("email", "detach@example.com"))
+
+		var commits [][]byte
+		for _, content := range []string{"one\n", "two\n", "three\n"} {
+			assert.NoError(t, os.WriteFile("a.txt", []byte(content), 0644))
+			_, _, err := addPaths(t.Context(), []string{"a.txt"}, addOptions{})
+			assert.NoError(t, err)
+			hash, err := createCommit(t.Context(), content)
+			assert.NoError(t, err)
+			commits = append(commits, hash)
+		}
+		assert.NoError(t, createTag("v1", commits[0]))
+
+		assertDetachedAt := func(hash []byte, content string) {
+			head, err := getHEAD()
+			assert.NoError(t, err)
+			assert.Equal(t, detachedHead, head)
+			headHash, err := resolveRevision("HEAD")
+			assert.NoError(t, err)
+			assert.Equal(t, hash, headHash)
+			assertWorkTreeFile(t, "a.txt", content)
+		}
+
+		// ancestry, short hashes, and tags detach HEAD at their commit
+		switched, err := switchBranch(t.Context(), "HEAD~1")
+		assert.NoError(t, err)
+		assert.True(t, switched)
+		assertDetachedAt(commits[1], "two\n")
+
+		switched, err = switchBranch(t.Context(), hex.EncodeToString(commits[0])[:7])
+		assert.NoError(t, err)
+		assert.True(t, switched)
+		assertDetachedAt(commits[0], "one\n")
+
+		switched, err = switchBranch(t.Context(), "v1")
+		assert.NoError(t, err)
+		assert.False(t, switched)
+
+		// a commit on a detached HEAD moves HEAD, not a branch
+		assert.NoError(t, os.WriteFile("a.txt", []byte("detached\n"), 0644))
+		_, _, err = addPaths(t.Context(), []string{"a.txt"}, addOptions{})
+		assert.NoError(t, err)
+
+		// a revision that names nothing is reported before staged changes
+		_, err = switchBranch(t.Context(), "no-such-revision")
+		var revision *RevisionError
+		assert.ErrorAs(t, err, &revision)
+
+		detached, err := createCommit(t.Context(), "detached")
+		assert.NoError(t, err)
+		assertDetachedAt(detached, "detached\n")
+		mainHash, err := getRef("refs/heads/main")
+		assert.NoError(t, err)
+		assert.Equal(t, commits[2], mainHash)
+
+		// a branch is checked out by name again
+		switched, err = switchBranch(t.Context(), "main")
+		assert.NoError(t, err)
+		assert.True(t, switched)
+		head, err := getHEAD()
+		assert.NoError(t, err)
+		assert.Equal(t, "refs/heads/main", head)
+		assertWorkTreeFile(t, "a.txt", "three\n")
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,153 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cleanOptions selects what clean removes.
+type cleanOptions struct {
+	dryRun      bool // only report what would be removed
+	directories bool // remove untracked directories too
+	ignored     bool // remove ignored files too
+}
+
+// cleanWorkTree removes untracked files at or below the given paths, or in
+// the whole working tree when paths is empty, and returns what it removed
+// (or, with dryRun, would remove). Directories are listed with a trailing
+// slash. Untracked directories are left alone unless options.directories
+// is set, ignored paths unless options.ignored is set, and nested
+// repositories always.
+func cleanWorkTree(ctx context.Context, paths []string, options cleanOptions) ([]string, error) {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, err
+	}
+
+	// directories holding tracked files are walked into, never removed
+	trackedDirs := make(map[string]bool)
+	for filePath := range index {
+		for dir := filepath.Dir(filePath); dir != "."; dir = filepath.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+
+	// inScope reports whether a path is at or below one of paths (within),
+	// or is a directory above one of them (above)
+	inScope := func(filePath string) (within, above bool) {
+		if len(paths) == 0 {
+			return true, false
+		}
+
+		for _, spec := range paths {
+			if spec == "." || filePath == spec || strings.HasPrefix(filePath, spec+"/") {
+				return true, false
+			}
+			if strings.HasPrefix(spec, filePath+"/") {
+				above = true
+			}
+		}
+		return false, above
+	}
+
+	// keeps reports whether anything below an untracked directory must stay
+	keeps := func(dir string) (bool, error) {
+		keep := false
+		err := walkWorkTree(dir, func(filePath string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err != nil {
+				return err
+			}
+			if filePath != dir && d.IsDir() && isNestedRepository(filePath) {
+				keep = true
+			} else if !options.ignored && rules.ignored(filePath, d.IsDir()) {
+				keep = true
+			}
+			if keep {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		return keep, err
+	}
+
+	var removed []string
+	err = walkWorkTree(".", func(filePath string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if filePath == "." {
+			return nil
+		}
+
+		if isVCSEntry(filePath, d) {
+			return skipWalkEntry(d) // skip VCS dir
+		}
+
+		within, above := inScope(filePath)
+		if !within {
+			if above {
+				return nil // walk down to the path that was asked for
+			}
+			return skipWalkEntry(d)
+		}
+
+		if _, tracked := index[filePath]; tracked {
+			return skipWalkEntry(d) // files and submodules
+		}
+		if !options.ignored && rules.ignored(filePath, d.IsDir()) {
+			return skipWalkEntry(d)
+		}
+
+		if !d.IsDir() {
+			removed = append(removed, filePath)
+			return nil
+		}
+
+		switch {
+		case isNestedRepository(filePath):
+			return filepath.SkipDir
+		case trackedDirs[filePath]:
+			return nil
+		case !options.directories:
+			return filepath.SkipDir
+		}
+
+		// an untracked directory goes as a whole unless something in it stays
+		keep, err := keeps(filePath)
+		if err != nil || keep {
+			return err
+		}
+		removed = append(removed, filePath+"/")
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking working tree: %w", err)
+	}
+
+	if options.dryRun {
+		return removed, nil
+	}
+
+	for _, filePath := range removed {
+		if err := os.RemoveAll(workTreePath(strings.TrimSuffix(filePath, "/"))); err != nil {
+			return nil, fmt.Errorf("error removing %s: %w", filePath, err)
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,110 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules := parseIgnoreRules([]byte("# build output\n*.o\nbuild/\n/root.txt\ndocs/**/*.tmp\n!keep.o\n"))
+
+	assert.True(t, rules.ignored("main.o", false))
+	assert.True(t, rules.ignored("src/deep/main.o", false))
+	assert.False(t, rules.ignored("keep.o", false))
+	assert.True(t, rules.ignored("build", true))
+	assert.False(t, rules.ignored("build", false)) // only directories
+	assert.True(t, rules.ignored("build/keep.o", false))
+	assert.True(t, rules.ignored("root.txt", false))
+	assert.False(t, rules.ignored("src/root.txt", false))
+	assert.True(t, rules.ignored("docs/a.tmp", false))
+	assert.True(t, rules.ignored("docs/a/b/c.tmp", false))
+	assert.False(t, rules.ignored("src/a.tmp", false))
+}
+
+func TestClean(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("clean-test")
+	defer os.Remove(ignoreFileName)
+
+	assert.NoError(t, os.WriteFile(ignoreFileName, []byte("*.log\n"), 0644))
+	for _, dir := range []string{"clean-test/src", "clean-test/out/logs"} {
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	for _, file := range []string{"clean-test/src/main.go", "clean-test/src/main.o", "clean-test/build.log", "clean-test/out/a.bin", "clean-test/out/logs/run.log"} {
+		assert.NoError(t, os.WriteFile(file, []byte(file), 0644))
+	}
+
+	blobHash, err := createObject([]byte("clean-test/src/main.go"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "clean-test/src/main.go", blobHash))
+
+	scope := []string{"clean-test"}
+
+	// untracked directories and ignored files stay unless asked for
+	removed, err := cleanWorkTree(t.Context(), scope, cleanOptions{dryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"clean-test/src/main.o"}, removed)
+
+	// a directory holding ignored files is emptied of everything else
+	removed, err = cleanWorkTree(t.Context(), scope, cleanOptions{dryRun: true, directories: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"clean-test/out/a.bin", "clean-test/src/main.o"}, removed)
+
+	removed, err = cleanWorkTree(t.Context(), scope, cleanOptions{directories: true, ignored: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"clean-test/build.log", "clean-test/out/", "clean-test/src/main.o"}, removed)
+
+	_, err = os.Stat("clean-test/out")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat("clean-test/src/main.go")
+	assert.NoError(t, err)
+}
+
+func TestCheckIgnoreGitignore(t *testing.T) {
+	dir := t.TempDir()
+
+	err := withRepositoryInit(dir, func() error {
+		assert.NoError(t, os.WriteFile(gitignoreFileName, []byte("*.log\nbuild/\n"), 0644))
+		assert.NoError(t, os.WriteFile(ignoreFileName, []byte("# keep this one\n!keep.log\n"), 0644))
+		assert.NoError(t, os.MkdirAll("build", 0755))
+
+		blobHash, err := createObject([]byte("tracked"))
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), "tracked.log", blobHash))
+
+		paths := []string{"a.log", "keep.log", "build/out.bin", "tracked.log", "main.go"}
+
+		// .gitignore is only read when asked for
+		matches, err := checkIgnore(t.Context(), paths, false)
+		assert.NoError(t, err)
+		if assert.Len(t, matches, 1) {
+			assert.Equal(t, ".mygitignore:2:!keep.log\tkeep.log", matches[0].String())
+			assert.False(t, matches[0].ignored)
+		}
+
+		assert.NoError(t, updateConfig("readGitignore", "true"))
+		matches, err = checkIgnore(t.Context(), paths, false)
+		assert.NoError(t, err)
+		var lines []string
+		for _, match := range matches {
+			lines = append(lines, match.String())
+		}
+		assert.Equal(t, []string{
+			".gitignore:1:*.log\ta.log",
+			".mygitignore:2:!keep.log\tkeep.log", // .mygitignore wins
+			".gitignore:2:build/\tbuild/out.bin",
+		}, lines)
+
+		matches, err = checkIgnore(t.Context(), []string{"tracked.log"}, true)
+		assert.NoError(t, err)
+		assert.Len(t, matches, 1)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,3224 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	vcsName = "mygit" // Name of the version control system
+)
+
+// Exit statuses of the command line.
+const (
+	exitFailure  = 1   // the command failed, or found nothing (grep, check-ignore, merge-base)
+	exitConflict = 2   // merge conflicts, a merge in progress, or a ref that moved
+	exitUsage    = 128 // the command line itself is wrong
+)
+
+// exitError ends the command with a given status. A nil err exits without
+// a message, for commands that have already said why.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// usageError reports a command line that does not match usage.
+func usageError(usage string) error {
+	return &exitError{code: exitUsage, err: errors.New(usage)}
+}
+
+// quietExit ends the command with status code and no message.
+func quietExit(code int) error {
+	return &exitError{code: code}
+}
+
+// exitStatus returns the status the process exits with after err.
+func exitStatus(err error) int {
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return exit.code
+	}
+	if errors.Is(err, ErrConflict) {
+		return exitConflict
+	}
+
+	return exitFailure
+}
+
+// reportError writes err to w: its message on a line of its own, or an
+// error record with --porcelain-errors.
+func reportError(w io.Writer, err error) {
+	if exit, ok := err.(*exitError); ok && exit.err == nil {
+		return
+	}
+
+	if porcelainErrors {
+		writeErrorRecord(w, classifyError(err))
+		return
+	}
+
+	fmt.Fprintln(w, err)
+}
+
+// parseFlags parses a command's flags, which may come before, between, or
+// after its arguments, and leaves the arguments to cmd.Args. Everything
+// after a "--" is an argument; a "--" after the first argument is kept,
+// for commands that take paths after one. -h or --help prints the
+// command's usage and flags. When parsing fails, the flag package has
+// already printed what was wrong, and the usage follows it.
+func parseFlags(cmd *flag.FlagSet, args []string) error {
+	cmd.Usage = func() {}
+
+	var positional []string
+	for {
+		err := cmd.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			printFlagUsage(os.Stdout, cmd)
+			return quietExit(0)
+		}
+		if err != nil {
+			printFlagUsage(cmd.Output(), cmd)
+			return quietExit(exitUsage)
+		}
+
+		rest := cmd.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+		if len(args) > 0 && args[0] == "--" {
+			positional = append(positional, args...)
+			break
+		}
+	}
+
+	return cmd.Parse(append([]string{"--"}, positional...))
+}
+
+// printFlagUsage writes the usage of the command cmd parses the flags of,
+// and its flags.
+func printFlagUsage(w io.Writer, cmd *flag.FlagSet) {
+	if info, ok := lookupCommand(strings.Fields(cmd.Name() + " ")[0]); ok {
+		printCommandUsage(w, info)
+	}
+
+	hasFlags := false
+	cmd.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if !hasFlags {
+		return
+	}
+
+	fmt.Fprintln(w, "\nFlags:")
+	output := cmd.Output()
+	cmd.SetOutput(w)
+	cmd.PrintDefaults()
+	cmd.SetOutput(output)
+}
+
+// Main runs the mygit command line on os.Args and exits on failure. The
+// mygit binary in cmd/mygit is nothing more than a call to it.
+func Main() {
+	if err := runCommand(); err != nil {
+		reportError(os.Stderr, err)
+		os.Exit(exitStatus(err))
+	}
+}
+
+// runCommand runs the command named by os.Args. Handlers return their
+// errors rather than exiting, so everything up to here is safe to call
+// in-process.
+func runCommand() error {
+	// strip global options so handlers only see their own arguments
+	overrides, args, err := parseGlobalOptions(os.Args[1:])
+	if err != nil {
+		return &exitError{code: exitUsage, err: err}
+	}
+	os.Args = append(os.Args[:1], args...)
+
+	// without a command, show what the commands are
+	if len(os.Args) < 2 {
+		printHelp(os.Stderr)
+		return quietExit(exitUsage)
+	}
+
+	info, ok := lookupCommand(os.Args[1])
+	if !ok {
+		return usageError(fmt.Sprintf("unknown command: %s", os.Args[1]))
+	}
+
+	if jsonOutput && !info.json {
+		return usageError(fmt.Sprintf("--json is not supported by %s", info.name))
+	}
+
+	// locate the repository root (a new repository is created in place)
+	if err := setupRepository(overrides, info.name == "init"); err != nil {
+		return err
+	}
+	configureColor()
+
+	if quiet {
+		restore, err := discardOutput()
+		if err != nil {
+			return err
+		}
+		defer restore()
+	} else if info.pager {
+		stopPager, err := startPager()
+		if err != nil {
+			return err
+		}
+		defer stopPager()
+	}
+
+	if info.workTree {
+		if err := requireWorkTree(info.name); err != nil {
+			return err
+		}
+
+		// checkout itself offers to finish or undo the interrupted checkout
+		if info.name != "checkout" {
+			if err := requireNoInterruptedCheckout(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// commands that read, change, and write back the index hold its lock
+	// throughout, so a concurrent one cannot lose their entries
+	if info.index {
+		return withIndexLock(info.run)
+	}
+
+	return info.run()
+}
+
+// stringListFlag is a flag.Value that collects every occurrence of a repeated flag.
+type stringListFlag []string
+
+// String returns the collected values joined by commas.
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set appends a value for each occurrence of the flag.
+func (s *stringListFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// handleInit initializes the VCS repository.
+func handleInit() error {
+	// define a flag set for init
+	cmd := flag.NewFlagSet("init", flag.ContinueOnError)
+	template := cmd.String("template", "", "directory whose contents are copied into the new repository")
+	bare := cmd.Bool("bare", false, "create a repository without a working tree")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) > 1 || (!*bare && len(args) != 0) {
+		return usageError("usage: " + vcsName + " init [--template=<dir>] [--bare [<dir>]]")
+	}
+
+	// a bare repository keeps its metadata directly in the target directory
+	if *bare {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if err := useGitDir(absDir); err != nil {
+			return err
+		}
+	}
+
+	// Initialize VCS
+	err := createDirectoriesFiles()
+	if err != nil {
+		return err
+	}
+
+	if *bare {
+		if err := updateConfig("bare", "true"); err != nil {
+			return err
+		}
+	}
+
+	// copy template files (explicit flag or global default)
+	if templateDir := resolveTemplateDir(*template); templateDir != "" {
+		if err := applyTemplate(templateDir); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Initialized empty %s repository in %s/\n", vcsName, gitDir)
+
+	return nil
+}
+
+// handleHashObject handles the hash-object command.
+func handleHashObject() error {
+	// define a flag set for hash-object
+	cmd := flag.NewFlagSet("hash-object", flag.ContinueOnError)
+	write := cmd.Bool("w", false, "write the object into the object store")
+	stdin := cmd.Bool("stdin", false, "read the content from standard input instead of a file")
+	objType := cmd.String("t", "blob", "object type: "+objectTypeNames())
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if (*stdin && len(args) != 0) || (!*stdin && len(args) != 1) {
+		return usageError("usage: " + vcsName + " hash-object [-w] [-t <type>] (--stdin | <file>)")
+	}
+
+	var content []byte
+	var err error
+	if *stdin {
+		content, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading standard input: %w", err)
+		}
+	} else {
+		content, err = os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("error reading file %s: %w", args[0], err)
+		}
+	}
+
+	var dataHash []byte
+	if *write {
+		dataHash, err = createTypedObject(*objType, content)
+		if err != nil {
+			return err
+		}
+	} else {
+		header := fmt.Sprintf("%s %d\x00", *objType, len(content))
+		if err := validateTypedObject(*objType, append([]byte(header), content...)); err != nil {
+			return err
+		}
+		dataHash = hashTypedObject(*objType, content)
+	}
+
+	fmt.Printf("%x\n", dataHash)
+
+	return nil
+}
+
+// handleAdd handles the add command.
+func handleAdd() error {
+	// define a flag set for add
+	cmd := flag.NewFlagSet("add", flag.ContinueOnError)
+	patch := cmd.Bool("p", false, "choose hunks of tracked files to stage interactively")
+	update := cmd.Bool("u", false, "stage changes and deletions of tracked files only")
+	ignoreErrors := cmd.Bool("ignore-errors", false, "skip files that cannot be read and report them at the end")
+	dryRun := cmd.Bool("dry-run", false, "list the files that would be staged without writing anything")
+	verbose := cmd.Bool("verbose", false, "list each file as it is staged")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if (len(args) == 0 && !*patch && !*update) || (*patch && *update) {
+		return usageError("usage: " + vcsName + " add [--dry-run] [--verbose] [--ignore-errors] <pathspec>... | add (-p | -u) [<pathspec>...]")
+	}
+
+	if *patch || *update {
+		// both work on tracked files only
+		index, err := readIndex(context.Background())
+		if err != nil {
+			return err
+		}
+
+		targetPaths, err := expandPathspecs(args, slices.Sorted(maps.Keys(index)))
+		if err != nil {
+			return err
+		}
+
+		var changedPaths []string
+		if *patch {
+			changedPaths, err = addPatch(context.Background(), targetPaths, os.Stdin, os.Stdout)
+		} else {
+			changedPaths, err = addUpdate(context.Background(), targetPaths)
+		}
+		if err != nil {
+			return err
+		}
+
+		warnForeignLocks(changedPaths)
+		return nil
+	}
+
+	// globs are matched against the files add would pick up
+	var candidates []string
+	if slices.ContainsFunc(args, isGlobPathspec) {
+		var err error
+		if candidates, err = workTreeFiles(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	targetPaths, err := expandPathspecs(args, candidates)
+	if err != nil {
+		return err
+	}
+
+	options := addOptions{ignoreErrors: *ignoreErrors, dryRun: *dryRun, verbose: *verbose, progress: terminalProgress()}
+
+	// collect staged paths to report those locked by others
+	changedPaths, failures, err := addPaths(context.Background(), targetPaths, options)
+	if err != nil {
+		return err
+	}
+
+	warnForeignLocks(changedPaths)
+
+	// everything readable is staged; say what was not
+	if len(failures) > 0 {
+		for _, failure := range failures {
+			fmt.Fprintf(os.Stderr, "error: %v\n", failure.err)
+		}
+		return fmt.Errorf("%d path(s) could not be added", len(failures))
+	}
+
+	return nil
+}
+
+// handleWriteTree handles the write-tree command.
+func handleWriteTree() error {
+	// define a flag set for write-tree
+	cmd := flag.NewFlagSet("write-tree", flag.ContinueOnError)
+	prefix := cmd.String("prefix", ".", "write only the tree for this subdirectory of the index")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	// read the index file
+	index, err := readIndex(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// limit the tree to the given paths, if any
+	paths, err := expandPathspecs(cmd.Args(), slices.Sorted(maps.Keys(index)))
+	if err != nil {
+		return err
+	}
+
+	// build the tree structure and write to disk
+	treeHash, err := writeIndexSubtree(index, *prefix, paths)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", treeHash)
+
+	return nil
+}
+
+// handleCatFile handles the cat-file command.
+func handleCatFile() error {
+	// define a flag set for cat-file
+	cmd := flag.NewFlagSet("cat-file", flag.ContinueOnError)
+	showType := cmd.Bool("t", false, "print the object type")
+	showSize := cmd.Bool("s", false, "print the object size from its header")
+	prettyPrint := cmd.Bool("p", false, "pretty-print the object (default)")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) < 1 {
+		return usageError("usage: " + vcsName + " cat-file [-t | -s | -p] <hash>")
+	}
+
+	modes := 0
+	for _, set := range []bool{*showType, *showSize, *prettyPrint} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return usageError("please specify only one of -t, -s, or -p")
+	}
+
+	// resolve full or abbreviated hash from CLI to binary hash
+	hashBytes, err := resolveRevision(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	if *showType || *showSize {
+		_, objType, size, err := readRawObject(hashBytes)
+		if err != nil {
+			return err
+		}
+
+		if *showType {
+			fmt.Println(objType)
+		} else {
+			fmt.Println(size)
+		}
+		return nil
+	}
+
+	content, err := catFile(hashBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", content)
+
+	return nil
+}
+
+// handleCommit handles the commit command.
+func handleCommit() error {
+	// define a flag set for commit
+	cmd := flag.NewFlagSet("commit", flag.ContinueOnError)
+	dryRun := cmd.Bool("dry-run", false, "report what would be committed without writing objects or refs")
+	only := cmd.Bool("only", false, "commit only the given paths (implied by giving paths)")
+	include := cmd.Bool("include", false, "commit the working tree state of the given paths instead of their staged state")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1], args[2:]...)
+	}
+
+	usage := "usage: " + vcsName + " commit [--dry-run] <message> | commit [--only] [--include] <message> [--] <path>..."
+	paths := args[min(len(args), 1):]
+	if ((*only || *include) && len(paths) == 0) || (*dryRun && len(paths) > 0) {
+		return usageError(usage)
+	}
+
+	// during a merge the message defaults to the one in MERGE_MSG
+	var message string
+	if len(args) > 0 {
+		message = args[0]
+	} else if merging, err := isMergeInProgress(); err != nil {
+		return err
+	} else if merging {
+		if message, err = mergeMessage(); err != nil {
+			return err
+		}
+	} else {
+		return usageError(usage)
+	}
+
+	if len(paths) > 0 {
+		for i, path := range paths {
+			resolved, err := resolvePathspec(path)
+			if err != nil {
+				return err
+			}
+			paths[i] = resolved
+		}
+
+		partial, err := partialCommitIndex(context.Background(), paths, *include)
+		if err != nil {
+			return err
+		}
+
+		if headIndex, err := headCommitIndex(context.Background()); err == nil {
+			var changedPaths []string
+			for _, change := range diffIndexes(headIndex, partial) {
+				changedPaths = append(changedPaths, change.path)
+			}
+			warnForeignLocks(changedPaths)
+		}
+
+		commitHash, err := createPartialCommit(context.Background(), message, partial, paths)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%x\n", commitHash)
+		return nil
+	}
+
+	if *dryRun {
+		report, err := dryRunCommit(context.Background(), message)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(report)
+		if len(report.problems) > 0 {
+			return quietExit(exitFailure)
+		}
+		return nil
+	}
+
+	// warn about committing changes to paths locked by others
+	if index, err := readIndex(context.Background()); err == nil {
+		if headIndex, err := headCommitIndex(context.Background()); err == nil {
+			var changedPaths []string
+			for _, change := range diffIndexes(headIndex, index) {
+				changedPaths = append(changedPaths, change.path)
+			}
+			warnForeignLocks(changedPaths)
+		}
+	}
+
+	commitHash, err := createCommit(context.Background(), message)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", commitHash)
+
+	return nil
+}
+
+func handleDiff() error {
+	// define a flag set for diff
+	cmd := flag.NewFlagSet("diff", flag.ContinueOnError)
+	cached := cmd.Bool("cached", false, "compare with the index instead of the working tree")
+	renames := -1
+	cmd.Var(renameThresholdFlag{&renames}, "M", "detect renames; -M=<n> takes files at least n% alike for one")
+	stat := cmd.Bool("stat", false, "print the lines added and removed per file instead of the diff")
+	shortStat := cmd.Bool("shortstat", false, "print only the total of files changed and lines added and removed")
+	nameOnly := cmd.Bool("name-only", false, "print only the paths of changed files")
+	nameStatus := cmd.Bool("name-status", false, "print the paths of changed files with their status letters")
+	var opts diffOptions
+	cmd.Var(wordDiffFlag{&opts.wordDiff}, "word-diff", "diff changed lines word by word; --word-diff=color marks words in color")
+	algorithm := cmd.String("diff-algorithm", "", "the diff algorithm: myers, patience, or histogram (default: diff.algorithm, else myers)")
+	cmd.Var(colorWhenFlag{}, "color", "color the output: auto, always, or never")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	modes := 0
+	for _, mode := range []bool{*stat, *shortStat, *nameOnly, *nameStatus} {
+		if mode {
+			modes++
+		}
+	}
+	if len(args) > 2 || (*cached && len(args) > 1) || modes > 1 {
+		return usageError("usage: " + vcsName + " diff [--cached] [-M[=<n>]] [--diff-algorithm=<algorithm>] [--word-diff[=<mode>]] [--stat | --shortstat | --name-only | --name-status] [<commit> [<commit>]]")
+	}
+	if *algorithm != "" {
+		var err error
+		if opts.algorithm, err = parseDiffAlgorithm(*algorithm); err != nil {
+			return err
+		}
+	}
+	if opts.wordDiff == wordDiffColor && colorWhen != "never" {
+		applyColorWhen("always") // the words are only marked by color
+	}
+
+	oldIndex, newIndex, readBlob, err := diffSides(context.Background(), args, *cached)
+	if err != nil {
+		return err
+	}
+
+	changes := diffIndexes(oldIndex, newIndex)
+	if renames >= 0 {
+		if changes, err = detectRenames(changes, readBlob, renames); err != nil {
+			return err
+		}
+	}
+
+	if *nameOnly || *nameStatus {
+		fmt.Print(formatNameStatus(changes, *nameStatus))
+		return nil
+	}
+
+	if *stat || *shortStat {
+		if len(changes) == 0 {
+			return nil
+		}
+		stats, err := changeStats(changes, readBlob, opts.algorithm)
+		if err != nil {
+			return err
+		}
+		if *stat {
+			fmt.Print(formatDiffStat(stats))
+		} else {
+			fmt.Print(formatShortStat(stats))
+		}
+		return nil
+	}
+
+	diff, err := formatChanges(changes, readBlob, opts)
+	if err != nil {
+		return err
+	}
+	if opts.wordDiff != "" {
+		fmt.Print(colorWordDiff(diff))
+	} else {
+		fmt.Print(colorDiff(diff))
+	}
+
+	return nil
+}
+
+func handleLog() error {
+	// define a flag set for log
+	cmd := flag.NewFlagSet("log", flag.ContinueOnError)
+	cmd.BoolVar(&jsonOutput, "json", jsonOutput, "print the commits as a JSON array")
+	cmd.Var(colorWhenFlag{}, "color", "color the output: auto, always, or never")
+	follow := cmd.String("follow", "", "print only the commits that changed the file at this path, following its renames")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) > 1 || (jsonOutput && *follow != "") {
+		return usageError("usage: " + vcsName + " log [--json | --follow <path>] [<rev>]")
+	}
+
+	var refHash []byte
+	if len(args) == 1 {
+		hash, err := resolveRevision(args[0])
+		if err != nil {
+			return err
+		}
+		refHash = hash
+	} else {
+		// read the HEAD to get current branch
+		head, err := getHEAD()
+		if err != nil {
+			return err
+		}
+
+		// get the latest commit from HEAD
+		refHash, err = getRef(head)
+		if err != nil {
+			return err
+		}
+	}
+
+	if jsonOutput {
+		commits, err := commitLogJSON(context.Background(), refHash)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(commits); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if *follow != "" {
+		path, err := resolvePathspec(*follow)
+		if err != nil {
+			return err
+		}
+		return printFollowLog(context.Background(), refHash, path)
+	}
+
+	// traverse and print commit history
+	if err := printCommitHistory(context.Background(), refHash); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleBranch() error {
+	// define a flag set for branch
+	cmd := flag.NewFlagSet("branch", flag.ContinueOnError)
+	deleteBranch := cmd.Bool("d", false, "delete the named branch if it is merged into HEAD")
+	forceDelete := cmd.Bool("D", false, "delete the named branch even if it is not merged")
+	list := cmd.Bool("list", false, "list the branches matching the given patterns")
+	format := cmd.String("format", "", "format each listed branch with %(placeholder)s")
+	var sortKeys stringListFlag
+	cmd.Var(&sortKeys, "sort", "sort listed branches by key (refname, objectname, committerdate, upstream; -key descends)")
+	cmd.BoolVar(&jsonOutput, "json", jsonOutput, "list the branches as a JSON array")
+	cmd.Var(colorWhenFlag{}, "color", "color the output: auto, always, or never")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	deleting := *deleteBranch || *forceDelete
+	listing := len(args) == 0 || *list || *format != "" || len(sortKeys) > 0 || jsonOutput
+	if (!listing && len(args) > 1) || (deleting && (len(args) != 1 || *list || jsonOutput)) || (jsonOutput && *format != "") {
+		return usageError("usage: " + vcsName + " branch [-d | -D] [<branch-name>] | branch [--list] [--format=<format> | --json] [--sort=<key>] [<pattern>...]")
+	}
+
+	if deleting {
+		currentBranch, err := getCurrentBranch()
+		if err != nil {
+			return err
+		}
+		if args[0] == currentBranch {
+			return fmt.Errorf("cannot delete the current branch %s", currentBranch)
+		}
+		if other, ok, err := worktreeForBranch(args[0]); err != nil {
+			return err
+		} else if ok {
+			return fmt.Errorf("cannot delete branch %s checked out at %s", args[0], other)
+		}
+
+		if !*forceDelete {
+			merged, err := isBranchMerged(args[0])
+			if err != nil {
+				return err
+			}
+			if !merged {
+				return fmt.Errorf("branch %s is not merged into HEAD; use -D to delete it anyway", args[0])
+			}
+		}
+
+		if err := deleteRef(fmt.Sprintf("refs/heads/%s", args[0])); err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted branch %s\n", args[0])
+		return nil
+	}
+
+	if listing {
+		refs, err := collectRefs(context.Background(), []string{"refs/heads"}, args)
+		if err != nil {
+			return err
+		}
+
+		if *format != "" {
+			if err := printRefs(context.Background(), refs, *format, sortKeys, 0); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		lister, err := newRefLister()
+		if err != nil {
+			return err
+		}
+		if err := lister.sortRefs(refs, sortKeys); err != nil {
+			return err
+		}
+
+		if jsonOutput {
+			if err := printJSON(branchesJSON(refs)); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		for _, ref := range refs {
+			if ref.head {
+				fmt.Println(currentBranchStyle.Sprintf("* %s", shortRefName(ref.refPath)))
+			} else {
+				fmt.Printf("%s\n", shortRefName(ref.refPath))
+			}
+		}
+		return nil
+	}
+
+	// create new branch at current HEAD
+	head, err := getHEAD()
+	if err != nil {
+		return err
+	}
+
+	commitHash, err := getRef(head)
+	if err != nil {
+		return err
+	}
+
+	if commitHash == nil {
+		return errors.New("cannot create branch: no commits yet")
+	}
+
+	if err := createBranch(args[0], commitHash); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created new branch %s\n", args[0])
+
+	return nil
+}
+
+func handleCheckout() error {
+	// define a flag set for checkout
+	cmd := flag.NewFlagSet("checkout", flag.ContinueOnError)
+	resume := cmd.Bool("continue", false, "finish an interrupted checkout")
+	abort := cmd.Bool("abort", false, "undo an interrupted checkout")
+	ours := cmd.Bool("ours", false, "write our version of the given conflicted paths to the working tree")
+	theirs := cmd.Bool("theirs", false, "write their version of the given conflicted paths to the working tree")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	usage := "usage: " + vcsName + " checkout <branch-name> | checkout <revision> | checkout --continue | checkout --abort | checkout (--ours | --theirs) [--] <path>..."
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	if *ours || *theirs {
+		if len(args) == 0 || (*ours && *theirs) || *resume || *abort {
+			return usageError(usage)
+		}
+
+		paths := make([]string, len(args))
+		for i, arg := range args {
+			resolved, err := resolvePathspec(arg)
+			if err != nil {
+				return err
+			}
+			paths[i] = resolved
+		}
+
+		stage := stageOurs
+		if *theirs {
+			stage = stageTheirs
+		}
+		return checkoutStage(context.Background(), paths, stage)
+	}
+
+	if *resume || *abort {
+		if len(args) != 0 || (*resume && *abort) {
+			return usageError(usage)
+		}
+
+		journal, err := readCheckoutJournal()
+		if err != nil {
+			return err
+		}
+
+		if *resume {
+			if err := finishCheckout(context.Background(), journal); err != nil {
+				return err
+			}
+			fmt.Printf("Finished checkout of %s\n", abbrevHash(journal.target))
+			return nil
+		}
+
+		if err := abortCheckout(context.Background(), journal); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s\n", strings.TrimPrefix(journal.origHead, "refs/heads/"))
+		return nil
+	}
+
+	if len(args) != 1 {
+		return usageError(usage)
+	}
+
+	branchName := args[0]
+
+	switched, err := switchBranch(context.Background(), branchName)
+	if err != nil {
+		return err
+	}
+
+	head, err := getHEAD()
+	if err != nil {
+		return err
+	}
+	if head == detachedHead {
+		commitHash, err := getRef(detachedHead)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("HEAD is now at %s\n", abbrevHash(commitHash))
+		return nil
+	}
+
+	if !switched {
+		fmt.Printf("Already on branch %s\n", branchName)
+		return nil
+	}
+
+	fmt.Printf("Switched to branch %s\n", branchName)
+
+	return nil
+}
+
+func handleRemove() error {
+	// define a flag set for rm
+	cmd := flag.NewFlagSet("rm", flag.ContinueOnError)
+	cached := cmd.Bool("cached", false, "remove from index only, not from working directory")
+	recursive := cmd.Bool("r", false, "remove directories and everything tracked below them")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) == 0 {
+		return usageError("usage: " + vcsName + " rm [--cached] [-r] <pathspec>...")
+	}
+
+	// globs are matched against tracked files
+	index, err := readIndex(context.Background())
+	if err != nil {
+		return err
+	}
+	tracked := slices.Sorted(maps.Keys(index))
+
+	targetPaths, err := expandPathspecs(args, tracked)
+	if err != nil {
+		return err
+	}
+
+	removed, err := removeTrackedPaths(context.Background(), targetPaths, *cached, *recursive)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range removed {
+		fmt.Printf("Removed %s\n", displayPath(path))
+	}
+
+	return nil
+}
+
+func handleMerge() error {
+	// define a flag set for merge
+	cmd := flag.NewFlagSet("merge", flag.ContinueOnError)
+	reportPath := cmd.String("report", "", "write a JSON report of how every path was resolved to this file (- for stdout)")
+	abort := cmd.Bool("abort", false, "abandon the conflicted merge and restore the state before it")
+	cont := cmd.Bool("continue", false, "commit the resolved merge with the recorded merge message")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	usage := "usage: " + vcsName + " merge [--report <file>] <branch-name> | merge (--abort | --continue)"
+	switch {
+	case *abort && !*cont && len(args) == 0 && *reportPath == "":
+		if err := abortMerge(context.Background()); err != nil {
+			return err
+		}
+		fmt.Println("Merge aborted")
+		return nil
+	case *cont && !*abort && len(args) == 0 && *reportPath == "":
+		commitHash, err := continueMerge(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%x\n", commitHash)
+		return nil
+	case *abort || *cont || len(args) != 1:
+		return usageError(usage)
+	}
+
+	branchName := args[0]
+
+	if err := requireMergeable(context.Background()); err != nil {
+		return err
+	}
+
+	// merge the specified branch into the current branch
+	report, err := mergeBranchWithReport(context.Background(), branchName)
+	if err != nil {
+		return err
+	}
+
+	if *reportPath != "" {
+		if err := writeMergeReport(report, *reportPath); err != nil {
+			return err
+		}
+	}
+
+	if report.Result == "conflicted" {
+		if porcelainErrors {
+			if err := reportMergeConflicts(os.Stderr, report); err != nil {
+				return err
+			}
+		}
+		return quietExit(exitConflict)
+	}
+
+	return nil
+}
+
+func handleMergeTool() error {
+	// define a flag set for mergetool
+	cmd := flag.NewFlagSet("mergetool", flag.ContinueOnError)
+	tool := cmd.String("tool", "", "the merge tool to run instead of merge.tool")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, arg := range cmd.Args() {
+		resolved, err := resolvePathspec(arg)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, resolved)
+	}
+
+	return runMergeTool(context.Background(), *tool, paths)
+}
+
+func handleStatus() error {
+	// define a flag set for status
+	cmd := flag.NewFlagSet("status", flag.ContinueOnError)
+
+	porcelain := cmd.Bool("porcelain", false, "print one stable \"XY <path>\" line per changed path, for scripts")
+	nulTerminated := cmd.Bool("z", false, "end porcelain entries with NUL instead of newline and never quote paths (implies --porcelain)")
+	cmd.BoolVar(&jsonOutput, "json", jsonOutput, "print the branch, merge state, and changed paths as JSON")
+	cmd.Var(colorWhenFlag{}, "color", "color the output: auto, always, or never")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		if *porcelain || *nulTerminated {
+			return usageError("usage: " + vcsName + " status [--porcelain [-z] | --json]")
+		}
+
+		report, err := statusReportJSON(context.Background())
+		if err != nil {
+			return err
+		}
+		if err := printJSON(report); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if *porcelain || *nulTerminated {
+		entries, err := collectStatusEntries(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Print(formatPorcelainStatus(entries, *nulTerminated))
+		return nil
+	}
+
+	modifiedFiles, unstagedFiles, err := getStatus(context.Background())
+	if err != nil {
+		return err
+	}
+
+	printStatus(modifiedFiles, unstagedFiles)
+
+	return nil
+}
+
+func handleReset() error {
+	// define a flag set for reset
+	cmd := flag.NewFlagSet("reset", flag.ContinueOnError)
+
+	soft := cmd.Bool("soft", false, "move HEAD only (keep index and working tree)")
+	mixed := cmd.Bool("mixed", false, "move HEAD and reset index (keep working tree) (default)")
+	hard := cmd.Bool("hard", false, "move HEAD, reset index and working tree")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 {
+		return usageError("usage: " + vcsName + " reset [--soft|--mixed|--hard] <commit>")
+	}
+
+	// ensure only one is set
+	modeCount := 0
+	if *soft {
+		modeCount++
+	}
+	if *mixed {
+		modeCount++
+	}
+	if *hard {
+		modeCount++
+	}
+	if modeCount > 1 {
+		return usageError("please specify only one of --soft, --mixed, or --hard")
+	}
+
+	mode := resetModeMixed // default
+	if *soft {
+		mode = resetModeSoft
+	} else if *hard {
+		mode = resetModeHard
+	}
+
+	// resolve revision to binary hash
+	commitHash, err := resolveRevision(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := resetToCommit(context.Background(), commitHash, mode); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleConfig() error {
+	// define a flag set for config
+	cmd := flag.NewFlagSet("config", flag.ContinueOnError)
+	global := cmd.Bool("global", false, "use the global config file instead of the repository config")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 && len(args) != 2 {
+		return usageError("usage: " + vcsName + " config [--global] <section.key> [<value>]")
+	}
+
+	parts := strings.SplitN(args[0], ".", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid config key: %s", args[0])
+	}
+	key := parts[1]
+	if len(args) == 1 {
+		get := getConfig
+		if *global {
+			get = getGlobalConfig
+		}
+
+		value, err := get(key)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(value)
+		return nil
+	}
+
+	update := updateConfig
+	if *global {
+		update = updateGlobalConfig
+	}
+
+	if err := update(key, args[1]); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleGrep() error {
+	// define a flag set for grep
+	cmd := flag.NewFlagSet("grep", flag.ContinueOnError)
+	ignoreCase := cmd.Bool("i", false, "ignore case when matching")
+	lineNumbers := cmd.Bool("n", false, "prefix matches with their line number")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 && len(args) != 2 {
+		return usageError("usage: " + vcsName + " grep [-i] [-n] [<rev>] <pattern>")
+	}
+
+	re, err := compileGrepPattern(args[len(args)-1], *ignoreCase)
+	if err != nil {
+		return err
+	}
+
+	// search the index by default, or the tree of the given revision
+	var index map[string][]byte
+	prefix := ""
+	if len(args) == 2 {
+		hash, err := resolveRevision(args[0])
+		if err != nil {
+			return err
+		}
+
+		treeHash, err := resolveTreeHash(hash)
+		if err != nil {
+			return err
+		}
+
+		index, err = buildIndexFromTree(context.Background(), treeHash, "", false)
+		if err != nil {
+			return err
+		}
+		prefix = args[0] + ":"
+	} else {
+		index, err = readIndex(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+
+	// submodule contents are not stored here
+	index, err = withoutGitlinks(index)
+	if err != nil {
+		return err
+	}
+
+	matches, err := grepIndex(index, re, readBlobFromCatFile)
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		if *lineNumbers {
+			fmt.Printf("%s%s:%d:%s\n", prefix, match.path, match.lineNo, match.line)
+		} else {
+			fmt.Printf("%s%s:%s\n", prefix, match.path, match.line)
+		}
+	}
+
+	if len(matches) == 0 {
+		return quietExit(exitFailure) // like grep, signal no matches
+	}
+
+	return nil
+}
+
+func handleLsFiles() error {
+	// define a flag set for ls-files
+	cmd := flag.NewFlagSet("ls-files", flag.ContinueOnError)
+	stage := cmd.Bool("stage", false, "show mode, object hash, stage number, and path for each entry")
+	modified := cmd.Bool("modified", false, "show only entries whose working tree content differs from the index")
+	deleted := cmd.Bool("deleted", false, "show only entries missing from the working tree")
+	unmerged := cmd.Bool("unmerged", false, "show only the stages of paths in conflict (implies --stage)")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if len(cmd.Args()) != 0 || (*unmerged && (*modified || *deleted)) {
+		return usageError("usage: " + vcsName + " ls-files [--stage] [--modified] [--deleted] | ls-files --unmerged")
+	}
+
+	index, err := readIndex(context.Background())
+	if err != nil {
+		return err
+	}
+	stages, err := readConflictStages()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	if *unmerged {
+		*stage = true
+		for path := range stages {
+			paths = append(paths, path)
+		}
+	} else if *modified || *deleted {
+		modifiedFiles, deletedFiles, err := compareIndexToWorkingTree(context.Background(), index)
+		if err != nil {
+			return err
+		}
+
+		if *modified {
+			paths = append(paths, modifiedFiles...)
+		}
+		if *deleted {
+			paths = append(paths, deletedFiles...)
+		}
+	} else {
+		for path := range index {
+			paths = append(paths, path)
+		}
+		for path := range stages {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if *stage {
+			mode := entryTypeBlob
+			if gitlinks[path] {
+				mode = entryTypeGitlink
+			}
+			if hash, ok := index[path]; ok && !*unmerged {
+				fmt.Printf("%06o %x 0\t%s\n", mode, hash, path)
+			}
+			for _, n := range slices.Sorted(maps.Keys(stages[path])) {
+				fmt.Printf("%06o %x %d\t%s\n", entryTypeBlob, stages[path][n], n, path)
+			}
+		} else {
+			fmt.Println(path)
+		}
+	}
+
+	return nil
+}
+
+func handleSnapshot() error {
+	usage := "usage: " + vcsName + " snapshot [save | list | restore <hash> | autosave [--interval=<duration>]]"
+
+	subcommand := "save"
+	if len(os.Args) > 2 {
+		subcommand = os.Args[2]
+	}
+
+	switch subcommand {
+	case "save":
+		commitHash, err := createSnapshot(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if commitHash == nil {
+			fmt.Println("No changes since last snapshot")
+			return nil
+		}
+		fmt.Printf("%x\n", commitHash)
+
+	case "list":
+		if err := listSnapshots(); err != nil {
+			return err
+		}
+
+	case "restore":
+		if len(os.Args) != 4 {
+			return usageError(usage)
+		}
+
+		commitHash, err := resolveRevision(os.Args[3])
+		if err != nil {
+			return err
+		}
+
+		if err := restoreSnapshot(context.Background(), commitHash); err != nil {
+			return err
+		}
+		fmt.Printf("Restored snapshot %x\n", commitHash)
+
+	case "autosave":
+		// define a flag set for snapshot autosave
+		cmd := flag.NewFlagSet("snapshot autosave", flag.ContinueOnError)
+		interval := cmd.Duration("interval", 5*time.Minute, "time between snapshots")
+
+		if err := parseFlags(cmd, os.Args[3:]); err != nil {
+			return err
+		}
+
+		if *interval <= 0 {
+			return errors.New("interval must be positive")
+		}
+
+		if err := autosaveSnapshots(context.Background(), *interval); err != nil {
+			return err
+		}
+
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleLsTree() error {
+	// define a flag set for ls-tree
+	cmd := flag.NewFlagSet("ls-tree", flag.ContinueOnError)
+	recursive := cmd.Bool("r", false, "recurse into sub-trees and show full paths")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 {
+		return usageError("usage: " + vcsName + " ls-tree [-r] <tree-ish>")
+	}
+
+	hash, err := resolveRevision(args[0])
+	if err != nil {
+		return err
+	}
+
+	treeHash, err := resolveTreeHash(hash)
+	if err != nil {
+		return err
+	}
+
+	entries, err := listTreeEntries(treeHash, "", *recursive)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(treeObject{entries: entries})
+
+	return nil
+}
+
+func handleMergeTrain() error {
+	// define a flag set for merge-train
+	cmd := flag.NewFlagSet("merge-train", flag.ContinueOnError)
+	cont := cmd.Bool("continue", false, "commit the resolved merge and continue with the remaining branches")
+	skip := cmd.Bool("skip", false, "abandon the conflicted merge and continue with the next branch")
+	abort := cmd.Bool("abort", false, "abandon the train and restore the starting commit")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	usage := "usage: " + vcsName + " merge-train <branch>... | --continue | --skip | --abort"
+
+	var err error
+	switch {
+	case *cont && len(args) == 0:
+		err = continueMergeTrain(context.Background())
+	case *skip && len(args) == 0:
+		err = skipMergeTrain(context.Background())
+	case *abort && len(args) == 0:
+		err = abortMergeTrain(context.Background())
+	case !*cont && !*skip && !*abort && len(args) > 0:
+		// check for uncommitted changes
+		if err := checkUncommittedChanges(context.Background()); err != nil {
+			return fmt.Errorf("please commit your changes before merging branches: %w", err)
+		}
+
+		// check for unstaged changes
+		if err := checkUnstagedChanges(context.Background()); err != nil {
+			return fmt.Errorf("please stage your changes before merging branches: %w", err)
+		}
+
+		err = startMergeTrain(context.Background(), args)
+	default:
+		return usageError(usage)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// a train stopped at a conflict leaves the merge in progress
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if yes {
+		return quietExit(exitConflict)
+	}
+
+	return nil
+}
+
+func handleShow() error {
+	// define a flag set for show
+	cmd := flag.NewFlagSet("show", flag.ContinueOnError)
+	cmd.BoolVar(&jsonOutput, "json", jsonOutput, "print the object, and a commit's changes, as JSON")
+	cmd.Var(colorWhenFlag{}, "color", "color the output: auto, always, or never")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) > 1 {
+		return usageError("usage: " + vcsName + " show [<rev>]")
+	}
+
+	rev := "HEAD"
+	if len(args) == 1 {
+		rev = args[0]
+	}
+
+	hash, err := resolveRevision(rev)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		object, err := showObjectJSON(context.Background(), hash)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(object); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if err := showObject(context.Background(), hash); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleRevParse() error {
+	// define a flag set for rev-parse
+	cmd := flag.NewFlagSet("rev-parse", flag.ContinueOnError)
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) < 1 {
+		return usageError("usage: " + vcsName + " rev-parse <rev>...")
+	}
+
+	for _, rev := range args {
+		hash, err := resolveRevision(rev)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%x\n", hash)
+	}
+
+	return nil
+}
+
+func handleState() error {
+	usage := "usage: " + vcsName + " state export [<file>] | state apply <file>"
+
+	if len(os.Args) < 3 {
+		return usageError(usage)
+	}
+
+	switch os.Args[2] {
+	case "export":
+		if len(os.Args) > 4 {
+			return usageError(usage)
+		}
+
+		state, err := exportState(context.Background())
+		if err != nil {
+			return err
+		}
+
+		data, err := marshalState(state)
+		if err != nil {
+			return err
+		}
+
+		if len(os.Args) == 4 {
+			if err := os.WriteFile(os.Args[3], data, 0644); err != nil {
+				return fmt.Errorf("error writing state file: %w", err)
+			}
+			return nil
+		}
+		fmt.Print(string(data))
+
+	case "apply":
+		if len(os.Args) != 4 {
+			return usageError(usage)
+		}
+
+		data, err := os.ReadFile(os.Args[3])
+		if err != nil {
+			return fmt.Errorf("error reading state file: %w", err)
+		}
+
+		state, err := unmarshalState(data)
+		if err != nil {
+			return err
+		}
+
+		changes, err := applyState(context.Background(), state)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			fmt.Println("Already up to date")
+			return nil
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleLock() error {
+	// define a flag set for lock
+	cmd := flag.NewFlagSet("lock", flag.ContinueOnError)
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) > 1 {
+		return usageError("usage: " + vcsName + " lock [<path>]")
+	}
+
+	// without a path, list current locks
+	if len(args) == 0 {
+		locks, err := listLocks(context.Background())
+		if err != nil {
+			return err
+		}
+
+		paths := make([]string, 0, len(locks))
+		for path := range locks {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+
+		for _, path := range paths {
+			fmt.Printf("%s\t%s\n", path, locks[path])
+		}
+		return nil
+	}
+
+	path, err := resolvePathspec(args[0])
+	if err != nil {
+		return err
+	}
+	if err := lockFile(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Locked %s\n", args[0])
+
+	return nil
+}
+
+func handleUnlock() error {
+	// define a flag set for unlock
+	cmd := flag.NewFlagSet("unlock", flag.ContinueOnError)
+	force := cmd.Bool("force", false, "release a lock held by someone else")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 {
+		return usageError("usage: " + vcsName + " unlock [--force] <path>")
+	}
+
+	path, err := resolvePathspec(args[0])
+	if err != nil {
+		return err
+	}
+	if err := unlockFile(path, *force); err != nil {
+		return err
+	}
+
+	fmt.Printf("Unlocked %s\n", args[0])
+
+	return nil
+}
+
+func handleReadTree() error {
+	// define a flag set for read-tree
+	cmd := flag.NewFlagSet("read-tree", flag.ContinueOnError)
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 {
+		return usageError("usage: " + vcsName + " read-tree <tree-ish>")
+	}
+
+	hash, err := resolveRevision(args[0])
+	if err != nil {
+		return err
+	}
+
+	treeHash, err := resolveTreeHash(hash)
+	if err != nil {
+		return err
+	}
+
+	// load the tree into the index without touching the working directory
+	index, err := buildIndexFromTree(context.Background(), treeHash, "", false)
+	if err != nil {
+		return err
+	}
+
+	if err := writeIndex(context.Background(), index); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleCommitTree() error {
+	// define a flag set for commit-tree
+	cmd := flag.NewFlagSet("commit-tree", flag.ContinueOnError)
+	var parents stringListFlag
+	cmd.Var(&parents, "p", "parent commit (may be repeated)")
+	message := cmd.String("m", "", "commit message")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 || *message == "" {
+		return usageError("usage: " + vcsName + " commit-tree <tree> [-p <parent>]... -m <message>")
+	}
+	tree := args[0]
+
+	treeHash, err := resolveRevision(tree)
+	if err != nil {
+		return err
+	}
+
+	if _, objType, _, err := readRawObject(treeHash); err != nil {
+		return err
+	} else if objType != "tree" {
+		return fmt.Errorf("object %x is not a tree", treeHash)
+	}
+
+	var parentHashes [][]byte
+	for _, parent := range parents {
+		parentHash, err := resolveRevision(parent)
+		if err != nil {
+			return err
+		}
+
+		if _, objType, _, err := readRawObject(parentHash); err != nil {
+			return err
+		} else if objType != "commit" {
+			return fmt.Errorf("object %x is not a commit", parentHash)
+		}
+
+		parentHashes = append(parentHashes, parentHash)
+	}
+
+	commitHash, err := writeCommitObject(treeHash, parentHashes, *message)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", commitHash)
+
+	return nil
+}
+
+func handleGC() error {
+	// define a flag set for gc
+	cmd := flag.NewFlagSet("gc", flag.ContinueOnError)
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if len(cmd.Args()) != 0 {
+		return usageError("usage: " + vcsName + " gc")
+	}
+
+	// maintenance serve may be working on the same repository
+	err := withMaintenanceLock(func() error {
+		count, err := packRefs(context.Background())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Packed %d refs\n", count)
+
+		commits, err := writeCommitGraph(context.Background())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Wrote commit-graph with %d commits\n", commits)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleCompact() error {
+	// define a flag set for compact
+	cmd := flag.NewFlagSet("compact", flag.ContinueOnError)
+	grace := cmd.Duration("grace", defaultCompactGrace, "keep unreachable objects younger than this")
+	dryRun := cmd.Bool("dry-run", false, "report what would be removed without changing anything")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if len(cmd.Args()) != 0 {
+		return usageError("usage: " + vcsName + " compact [--grace=<duration>] [--dry-run]")
+	}
+
+	var report compactReport
+	err := withMaintenanceLock(func() error {
+		var err error
+		report, err = compactRepository(context.Background(), *grace, *dryRun)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+
+	slices.Sort(report.staleEntries)
+	for _, path := range report.staleEntries {
+		fmt.Printf("%s stale index entry %s\n", verb, path)
+	}
+
+	fmt.Printf("%s %d unreachable objects, reclaiming %d bytes\n", verb, len(report.prunedObjects), report.reclaimedBytes)
+	if report.tempFiles > 0 {
+		fmt.Printf("%s %d abandoned temporary object files\n", verb, report.tempFiles)
+	}
+
+	if report.encrypted > 0 {
+		encryptVerb := "Encrypted"
+		if *dryRun {
+			encryptVerb = "Would encrypt"
+		}
+		fmt.Printf("%s %d plaintext objects\n", encryptVerb, report.encrypted)
+	}
+
+	return nil
+}
+
+// handleFsck handles the fsck command.
+func handleFsck() error {
+	if len(os.Args) != 2 {
+		return usageError("usage: " + vcsName + " fsck")
+	}
+
+	report, err := checkObjectStore(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, err := range report.unknown {
+		fmt.Printf("warning: %v\n", err)
+	}
+	for _, err := range report.corrupt {
+		fmt.Printf("error: %v\n", err)
+	}
+
+	fmt.Printf("Checked %d objects: %d corrupt, %d of unknown type\n", report.checked, len(report.corrupt), len(report.unknown))
+	if len(report.corrupt) > 0 {
+		return quietExit(exitFailure)
+	}
+
+	return nil
+}
+
+func handleMigrateHash() error {
+	// define a flag set for migrate-hash
+	cmd := flag.NewFlagSet("migrate-hash", flag.ContinueOnError)
+	lookup := cmd.String("lookup", "", "print the other-format id of a migrated object")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if len(cmd.Args()) != 0 {
+		return usageError("usage: " + vcsName + " migrate-hash [--lookup <hash>]")
+	}
+
+	if *lookup != "" {
+		counterpart, ok, err := translateHash(*lookup)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("no mapping for %s", *lookup)
+		}
+
+		fmt.Println(counterpart)
+		return nil
+	}
+
+	count, err := migrateObjectFormat(context.Background())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated %d objects to sha256\n", count)
+
+	return nil
+}
+
+func handleMergeBase() error {
+	// define a flag set for merge-base
+	cmd := flag.NewFlagSet("merge-base", flag.ContinueOnError)
+	isAncestorCheck := cmd.Bool("is-ancestor", false, "exit with status 0 if the first commit is an ancestor of the second, 1 otherwise")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 2 {
+		return usageError("usage: " + vcsName + " merge-base [--is-ancestor] <commit> <commit>")
+	}
+
+	commitA, err := resolveRevision(args[0])
+	if err != nil {
+		return err
+	}
+
+	commitB, err := resolveRevision(args[1])
+	if err != nil {
+		return err
+	}
+
+	if *isAncestorCheck {
+		yes, err := isAncestor(commitA, commitB)
+		if err != nil {
+			return err
+		}
+		if !yes {
+			return quietExit(exitFailure)
+		}
+		return nil
+	}
+
+	base, err := findCommonAncestor(commitA, commitB)
+	if err != nil {
+		return err
+	}
+	if base == nil {
+		return quietExit(exitFailure) // unrelated histories
+	}
+
+	fmt.Printf("%x\n", base)
+
+	return nil
+}
+
+func handleTreeID() error {
+	// define a flag set for tree-id
+	cmd := flag.NewFlagSet("tree-id", flag.ContinueOnError)
+	path := cmd.String("path", ".", "print the tree hash of this subdirectory of the index")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	prefix, err := resolvePathspec(*path)
+	if err != nil {
+		return err
+	}
+
+	index, err := readIndex(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// limit the tree to the given paths, if any
+	paths, err := expandPathspecs(cmd.Args(), slices.Sorted(maps.Keys(index)))
+	if err != nil {
+		return err
+	}
+
+	treeHash, err := hashIndexSubtree(index, prefix, paths)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", treeHash)
+
+	return nil
+}
+
+func handleWorktree() error {
+	usage := "usage: " + vcsName + " worktree add <path> <branch> | worktree list | worktree remove [--force] <path>"
+
+	if len(os.Args) < 3 {
+		return usageError(usage)
+	}
+
+	switch os.Args[2] {
+	case "add":
+		cmd := flag.NewFlagSet("worktree add", flag.ContinueOnError)
+		if err := parseFlags(cmd, os.Args[3:]); err != nil {
+			return err
+		}
+
+		args := cmd.Args()
+		if len(args) != 2 {
+			return usageError(usage)
+		}
+
+		worktree, err := addWorktree(context.Background(), args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Prepared worktree %s on branch %s\n", worktree.path, worktree.branch)
+	case "list":
+		worktrees, err := listWorktrees()
+		if err != nil {
+			return err
+		}
+
+		for _, worktree := range worktrees {
+			fmt.Printf("%s [%s]\n", worktree.path, worktree.branch)
+		}
+	case "remove":
+		cmd := flag.NewFlagSet("worktree remove", flag.ContinueOnError)
+		force := cmd.Bool("force", false, "remove the worktree even if it has changes")
+		if err := parseFlags(cmd, os.Args[3:]); err != nil {
+			return err
+		}
+
+		args := cmd.Args()
+		if len(args) != 1 {
+			return usageError(usage)
+		}
+
+		if err := removeWorktree(context.Background(), args[0], *force); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed worktree %s\n", args[0])
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleSubmodule() error {
+	usage := "usage: " + vcsName + " submodule add <url> <path> | submodule init | submodule update"
+
+	if len(os.Args) < 3 {
+		return usageError(usage)
+	}
+
+	switch os.Args[2] {
+	case "add":
+		if len(os.Args) != 5 {
+			return usageError(usage)
+		}
+
+		path, err := resolvePathspec(os.Args[4])
+		if err != nil {
+			return err
+		}
+
+		if err := addSubmodule(context.Background(), os.Args[3], path); err != nil {
+			return err
+		}
+
+		fmt.Printf("Added submodule %s\n", displayPath(path))
+	case "init":
+		if len(os.Args) != 3 {
+			return usageError(usage)
+		}
+
+		initialized, err := initSubmodules(context.Background())
+		if err != nil {
+			return err
+		}
+
+		for _, path := range initialized {
+			fmt.Printf("Initialized submodule %s\n", displayPath(path))
+		}
+	case "update":
+		if len(os.Args) != 3 {
+			return usageError(usage)
+		}
+
+		updated, err := updateSubmodules(context.Background())
+		for _, path := range updated {
+			fmt.Printf("Updated submodule %s\n", displayPath(path))
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleArchive() error {
+	// define a flag set for archive
+	cmd := flag.NewFlagSet("archive", flag.ContinueOnError)
+	format := cmd.String("format", "tar", "archive format: tar or zip")
+	prefix := cmd.String("prefix", "", "directory to put every path in")
+	output := cmd.String("o", "", "write the archive to this file instead of stdout")
+	remote := cmd.String("remote", "", "archive a revision of this repository instead of the current one")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 {
+		return usageError("usage: " + vcsName + " archive [--format=tar|zip] [--prefix=<dir>/] [-o <file>] [--remote=<repository>] <tree-ish>")
+	}
+
+	var treeHash []byte
+	if *remote == "" {
+		hash, err := resolveRevision(args[0])
+		if err != nil {
+			return err
+		}
+
+		if treeHash, err = resolveTreeHash(hash); err != nil {
+			return err
+		}
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var err error
+	if *remote != "" {
+		url := *remote
+		if !filepath.IsAbs(url) {
+			url = filepath.Join(cwdPrefix, url)
+		}
+		err = fetchRemoteArchive(url, w, *format, args[0], *prefix)
+	} else {
+		err = writeArchive(w, *format, treeHash, *prefix)
+	}
+	if err != nil {
+		if *output != "" {
+			os.Remove(*output)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func handleBundle() error {
+	usage := "usage: " + vcsName + " bundle create <file> <rev>... | bundle verify <file> | bundle list-heads <file> | bundle unbundle <file> | bundle clone <file> <dir>"
+
+	if len(os.Args) < 4 {
+		return usageError(usage)
+	}
+
+	switch os.Args[2] {
+	case "create":
+		if len(os.Args) < 5 {
+			return usageError(usage)
+		}
+
+		f, err := os.Create(os.Args[3])
+		if err != nil {
+			return fmt.Errorf("error creating bundle: %w", err)
+		}
+
+		count, err := createBundle(context.Background(), f, os.Args[4:])
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("error writing bundle: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(os.Args[3])
+			return err
+		}
+
+		fmt.Printf("Created %s with %d objects\n", os.Args[3], count)
+	case "verify", "list-heads":
+		if len(os.Args) != 4 {
+			return usageError(usage)
+		}
+
+		f, _, b, err := openBundle(os.Args[3])
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		for _, refPath := range slices.Sorted(maps.Keys(b.refs)) {
+			fmt.Printf("%x %s\n", b.refs[refPath], refPath)
+		}
+
+		if os.Args[2] == "verify" {
+			if err := verifyBundle(b); err != nil {
+				return err
+			}
+			fmt.Printf("%s is okay\n", os.Args[3])
+		}
+	case "unbundle":
+		if len(os.Args) != 4 {
+			return usageError(usage)
+		}
+
+		results, err := fetchBundle(context.Background(), os.Args[3], false)
+		for _, result := range results {
+			fmt.Println(result)
+		}
+		if err != nil {
+			return err
+		}
+	case "clone":
+		if len(os.Args) != 5 {
+			return usageError(usage)
+		}
+
+		if err := cloneBundle(context.Background(), os.Args[3], os.Args[4]); err != nil {
+			return err
+		}
+
+		fmt.Printf("Cloned %s into %s\n", os.Args[3], os.Args[4])
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleFastExport() error {
+	// define a flag set for fast-export
+	cmd := flag.NewFlagSet("fast-export", flag.ContinueOnError)
+	output := cmd.String("o", "", "write the stream to this file instead of stdout")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := fastExport(context.Background(), w, cmd.Args()); err != nil {
+		if *output != "" {
+			os.Remove(*output)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func handleFastImport() error {
+	// define a flag set for fast-import
+	cmd := flag.NewFlagSet("fast-import", flag.ContinueOnError)
+	force := cmd.Bool("force", false, "update refs even if the imported commits do not descend from them")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if len(cmd.Args()) != 0 {
+		return usageError("usage: " + vcsName + " fast-import [--force] < <stream>")
+	}
+
+	stats, err := fastImport(os.Stdin, *force)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d blobs and %d commits\n", stats.blobs, stats.commits)
+	for _, refPath := range stats.refs {
+		fmt.Printf("Updated %s\n", refPath)
+	}
+
+	// the working tree is not touched, so it still shows the old commit
+	if head, err := getHEAD(); err == nil && !bareRepository && slices.Contains(stats.refs, head) {
+		fmt.Printf("%s is checked out; run '%s reset --hard HEAD' to update the working tree\n", head, vcsName)
+	}
+
+	return nil
+}
+
+func handleRequestPull() error {
+	// define a flag set for request-pull
+	cmd := flag.NewFlagSet("request-pull", flag.ContinueOnError)
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) < 2 || len(args) > 3 {
+		return usageError("usage: " + vcsName + " request-pull <start> <url> [<end>]")
+	}
+
+	end := "HEAD"
+	if len(args) == 3 {
+		end = args[2]
+	}
+
+	summary, err := requestPull(context.Background(), args[0], args[1], end)
+	if err != nil {
+		return err
+	}
+
+	// the summary is only useful once the commits have been published
+	endHash, err := resolveRevision(end)
+	if err != nil {
+		return err
+	}
+	if !repositoryHasCommit(args[1], endHash) {
+		fmt.Fprintf(os.Stderr, "warning: commit %s not found in the repository at %s; push it there before sending this request\n", abbrevHash(endHash), args[1])
+	}
+
+	fmt.Print(summary)
+
+	return nil
+}
+
+func handleAheadBehind() error {
+	// define a flag set for ahead-behind
+	cmd := flag.NewFlagSet("ahead-behind", flag.ContinueOnError)
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 2 {
+		return usageError("usage: " + vcsName + " ahead-behind <commit> <base>")
+	}
+
+	commit, err := resolveRevision(args[0])
+	if err != nil {
+		return err
+	}
+	base, err := resolveRevision(args[1])
+	if err != nil {
+		return err
+	}
+
+	ahead, behind, err := aheadBehind(context.Background(), commit, base)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d %d\n", ahead, behind)
+
+	return nil
+}
+
+func handleFormatPatch() error {
+	// define a flag set for format-patch
+	cmd := flag.NewFlagSet("format-patch", flag.ContinueOnError)
+	outputDir := cmd.String("o", ".", "directory to write the patch files to")
+	stdout := cmd.Bool("stdout", false, "print all patches as one mailbox instead of writing files")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 {
+		return usageError("usage: " + vcsName + " format-patch [-o <dir>] [--stdout] (<since> | <a>..<b>)")
+	}
+
+	patches, err := formatPatches(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if *stdout {
+		for _, patch := range patches {
+			fmt.Print(patch.content)
+		}
+		return nil
+	}
+
+	paths, err := writePatchFiles(patches, *outputDir)
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleApply() error {
+	// define a flag set for apply
+	cmd := flag.NewFlagSet("apply", flag.ContinueOnError)
+	index := cmd.Bool("index", false, "apply the patch to the index as well as the working tree")
+	reverse := cmd.Bool("reverse", false, "apply the patch in reverse")
+	cmd.BoolVar(reverse, "R", false, "shorthand for --reverse")
+	fuzz := cmd.Int("fuzz", 0, "number of context lines a hunk may ignore at each end")
+	strip := cmd.Int("p", 1, "number of leading path components to remove")
+	check := cmd.Bool("check", false, "only check that the patch applies")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if *fuzz < 0 || *strip < 0 {
+		return usageError("usage: " + vcsName + " apply [--index] [--reverse] [--fuzz=<n>] [-p <n>] [--check] [<patch>...]")
+	}
+
+	opts := applyOptions{strip: *strip, fuzz: *fuzz, reverse: *reverse, index: *index, check: *check}
+
+	var data []byte
+	if cmd.NArg() == 0 {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading patch: %w", err)
+		}
+		data = content
+	}
+	for _, arg := range cmd.Args() {
+		// the patch is named relative to where the command was started
+		path := arg
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwdPrefix, path)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading patch: %w", err)
+		}
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		data = append(data, content...)
+	}
+
+	results, err := applyPatch(context.Background(), data, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, applied := range results {
+		for _, note := range applied.notes {
+			fmt.Printf("%s: %s\n", displayPath(applied.path), note)
+		}
+	}
+
+	return nil
+}
+
+func handleTag() error {
+	// define a flag set for tag
+	cmd := flag.NewFlagSet("tag", flag.ContinueOnError)
+	deleteTag := cmd.Bool("d", false, "delete the named tag")
+	list := cmd.Bool("l", false, "list the tags matching the given patterns")
+	cmd.BoolVar(list, "list", false, "list the tags matching the given patterns")
+	format := cmd.String("format", "%(refname:short)", "format each listed tag with %(placeholder)s")
+	var sortKeys stringListFlag
+	cmd.Var(&sortKeys, "sort", "sort listed tags by key (refname, objectname, committerdate; -key descends)")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	listing := len(args) == 0 || *list
+	if (!listing && len(args) > 2) || (*deleteTag && (len(args) != 1 || *list)) {
+		return usageError("usage: " + vcsName + " tag [-d] <name> [<commit>] | tag [-l] [--format=<format>] [--sort=<key>] [<pattern>...]")
+	}
+
+	if *deleteTag {
+		refPath := "refs/tags/" + args[0]
+		hash, err := readRefIfExists(refPath)
+		if err != nil {
+			return err
+		}
+		if hash == nil {
+			return fmt.Errorf("tag %s not found", args[0])
+		}
+
+		if err := deleteRef(refPath); err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted tag %s (was %s)\n", args[0], abbrevHash(hash))
+		return nil
+	}
+
+	if listing {
+		refs, err := collectRefs(context.Background(), []string{"refs/tags"}, args)
+		if err != nil {
+			return err
+		}
+
+		if err := printRefs(context.Background(), refs, *format, sortKeys, 0); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// create a lightweight tag at the given commit (default HEAD)
+	rev := "HEAD"
+	if len(args) == 2 {
+		rev = args[1]
+	}
+
+	commitHash, err := resolveRevision(rev)
+	if err != nil {
+		return err
+	}
+
+	if err := createTag(args[0], commitHash); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleAm() error {
+	// define a flag set for am
+	cmd := flag.NewFlagSet("am", flag.ContinueOnError)
+	cont := cmd.Bool("continue", false, "commit the hand-applied patch and continue with the rest")
+	skip := cmd.Bool("skip", false, "drop the patch that failed and continue with the rest")
+	abort := cmd.Bool("abort", false, "abandon the series and restore the starting commit")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	usage := "usage: " + vcsName + " am [<mbox>...] | --continue | --skip | --abort"
+
+	var err error
+	switch {
+	case *cont && len(args) == 0:
+		err = continueAm(context.Background())
+	case *skip && len(args) == 0:
+		err = skipAm(context.Background())
+	case *abort && len(args) == 0:
+		err = abortAm(context.Background())
+	case !*cont && !*skip && !*abort:
+		var mailboxes [][]byte
+		if len(args) == 0 {
+			content, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("error reading patches: %w", err)
+			}
+			mailboxes = append(mailboxes, content)
+		}
+		for _, arg := range args {
+			// mailboxes are named relative to where the command was started
+			path := arg
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(cwdPrefix, path)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("error reading patches: %w", err)
+			}
+			mailboxes = append(mailboxes, content)
+		}
+
+		err = startAm(context.Background(), mailboxes)
+	default:
+		return usageError(usage)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleForEachRef() error {
+	// define a flag set for for-each-ref
+	cmd := flag.NewFlagSet("for-each-ref", flag.ContinueOnError)
+	format := cmd.String("format", "%(objectname) %(objecttype)\t%(refname)", "format each ref with %(placeholder)s")
+	var sortKeys stringListFlag
+	cmd.Var(&sortKeys, "sort", "sort refs by key (refname, objectname, committerdate, upstream; -key descends)")
+	count := cmd.Int("count", 0, "stop after this many refs")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if *count < 0 {
+		return usageError("usage: " + vcsName + " for-each-ref [--format=<format>] [--sort=<key>] [--count=<n>] [<pattern>...]")
+	}
+
+	refs, err := forEachRef(context.Background(), cmd.Args())
+	if err != nil {
+		return err
+	}
+
+	if err := printRefs(context.Background(), refs, *format, sortKeys, *count); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func handleNotes() error {
+	usage := "usage: " + vcsName + " notes add [-f] (-m <message> | -F <file>) [<commit>] | notes show [<commit>] | notes remove [<commit>]"
+
+	if len(os.Args) < 3 {
+		return usageError(usage)
+	}
+
+	// define a flag set for the subcommand
+	cmd := flag.NewFlagSet("notes "+os.Args[2], flag.ContinueOnError)
+	force := cmd.Bool("f", false, "replace an existing note (add)")
+	message := cmd.String("m", "", "note message (add)")
+	file := cmd.String("F", "", "read the note from this file, - for stdin (add)")
+
+	if err := parseFlags(cmd, os.Args[3:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) > 1 {
+		return usageError(usage)
+	}
+	rev := "HEAD"
+	if len(args) == 1 {
+		rev = args[0]
+	}
+
+	switch os.Args[2] {
+	case "add":
+		if (*message == "") == (*file == "") {
+			return usageError(usage)
+		}
+
+		note := *message
+		if *file != "" {
+			var content []byte
+			var err error
+			if *file == "-" {
+				content, err = io.ReadAll(os.Stdin)
+			} else {
+				path := *file
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(cwdPrefix, path)
+				}
+				content, err = os.ReadFile(path)
+			}
+			if err != nil {
+				return fmt.Errorf("error reading note: %w", err)
+			}
+			note = string(content)
+		}
+
+		if err := addNote(context.Background(), rev, note, *force); err != nil {
+			return err
+		}
+	case "show":
+		if *force || *message != "" || *file != "" {
+			return usageError(usage)
+		}
+
+		note, err := showNote(context.Background(), rev)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(note))
+	case "remove":
+		if *force || *message != "" || *file != "" {
+			return usageError(usage)
+		}
+
+		if err := removeNote(context.Background(), rev); err != nil {
+			return err
+		}
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleClone() error {
+	// define a flag set for clone
+	cmd := flag.NewFlagSet("clone", flag.ContinueOnError)
+	bundleURI := cmd.String("bundle-uri", "", "unbundle this file first, then copy only what the repository gained since")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	if len(args) != 1 && len(args) != 2 {
+		return usageError("usage: " + vcsName + " clone [--bundle-uri=<file>] <bundle-or-repository> [<dir>]")
+	}
+
+	// paths are relative to where the command was started
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(cwdPrefix, path)
+	}
+
+	source := resolve(args[0])
+	dir := defaultCloneDir(source)
+	if len(args) == 2 {
+		dir = args[1]
+	}
+	dir = resolve(dir)
+
+	uri := *bundleURI
+	if uri != "" {
+		uri = resolve(uri)
+	}
+
+	used, err := cloneRepository(context.Background(), source, dir, uri)
+	if err != nil {
+		return err
+	}
+
+	if used != "" {
+		fmt.Printf("Unbundled %s, then fetched newer objects from %s\n", used, args[0])
+	}
+	fmt.Printf("Cloned %s into %s\n", args[0], displayPath(dir))
+
+	return nil
+}
+
+func handleBisect() error {
+	usage := "usage: " + vcsName + " bisect start [<bad> [<good>...]] | bisect (good | bad | skip) [<rev>...] | bisect run <cmd> [<arg>...] | bisect reset"
+
+	if len(os.Args) < 3 {
+		return usageError(usage)
+	}
+
+	args := os.Args[3:]
+	switch os.Args[2] {
+	case "start":
+		bad := ""
+		var good []string
+		if len(args) > 0 {
+			bad, good = args[0], args[1:]
+		}
+
+		if err := startBisect(context.Background(), bad, good); err != nil {
+			return err
+		}
+	case "good", "bad", "skip":
+		if _, _, err := markBisect(context.Background(), os.Args[2], args); err != nil {
+			return err
+		}
+	case "run":
+		if len(args) == 0 {
+			return usageError(usage)
+		}
+
+		if _, err := runBisect(context.Background(), args); err != nil {
+			return err
+		}
+	case "reset":
+		if len(args) != 0 {
+			return usageError(usage)
+		}
+
+		if err := resetBisect(context.Background()); err != nil {
+			return err
+		}
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleClean() error {
+	// define a flag set for clean
+	cmd := flag.NewFlagSet("clean", flag.ContinueOnError)
+	dryRun := cmd.Bool("n", false, "only show what would be removed")
+	force := cmd.Bool("f", false, "remove untracked files")
+	directories := cmd.Bool("d", false, "remove untracked directories too")
+	ignored := cmd.Bool("x", false, "remove ignored files too")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if !*dryRun && !*force {
+		return errors.New("refusing to clean without -f; use -n to see what would be removed")
+	}
+
+	var paths []string
+	for _, arg := range cmd.Args() {
+		path, err := resolvePathspec(arg)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+
+	removed, err := cleanWorkTree(context.Background(), paths, cleanOptions{dryRun: *dryRun, directories: *directories, ignored: *ignored})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range removed {
+		// keep the slash that marks directories
+		shown := displayPath(path)
+		if strings.HasSuffix(path, "/") {
+			shown += "/"
+		}
+
+		if *dryRun {
+			fmt.Printf("Would remove %s\n", shown)
+		} else {
+			fmt.Printf("Removing %s\n", shown)
+		}
+	}
+
+	return nil
+}
+
+func handleCheckIgnore() error {
+	// define a flag set for check-ignore
+	cmd := flag.NewFlagSet("check-ignore", flag.ContinueOnError)
+	verbose := cmd.Bool("v", false, "show the file, line, and pattern deciding each path, negated patterns included")
+	noIndex := cmd.Bool("no-index", false, "check tracked paths too, as if they were untracked")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if len(cmd.Args()) == 0 {
+		return usageError("usage: " + vcsName + " check-ignore [-v] [--no-index] <path>...")
+	}
+
+	var paths []string
+	for _, arg := range cmd.Args() {
+		path, err := resolvePathspec(arg)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+
+	matches, err := checkIgnore(context.Background(), paths, *noIndex)
+	if err != nil {
+		return err
+	}
+
+	anyIgnored := false
+	for _, match := range matches {
+		anyIgnored = anyIgnored || match.ignored
+		switch {
+		case *verbose:
+			fmt.Println(match)
+		case match.ignored:
+			fmt.Println(displayPath(match.path))
+		}
+	}
+
+	// like grep, exit 1 when nothing matched
+	if !anyIgnored {
+		return quietExit(exitFailure)
+	}
+
+	return nil
+}
+
+func handleCheckAttr() error {
+	// define a flag set for check-attr
+	cmd := flag.NewFlagSet("check-attr", flag.ContinueOnError)
+	all := cmd.Bool("a", false, "list every attribute set on each path")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	// attribute names come first, then the paths, after "--" if given
+	args := cmd.Args()
+	var names, pathArgs []string
+	switch i := slices.Index(args, "--"); {
+	case *all:
+		pathArgs = args
+		if i == 0 {
+			pathArgs = args[1:]
+		}
+	case i >= 0:
+		names, pathArgs = args[:i], args[i+1:]
+	case len(args) > 0:
+		names, pathArgs = args[:1], args[1:]
+	}
+	if (len(names) == 0 && !*all) || len(pathArgs) == 0 {
+		return usageError("usage: " + vcsName + " check-attr (-a | <attr>...) [--] <path>...")
+	}
+
+	attrs, err := loadAttributes()
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range pathArgs {
+		path, err := resolvePathspec(arg)
+		if err != nil {
+			return err
+		}
+
+		if *all {
+			for _, setting := range attrs.all(path) {
+				fmt.Printf("%s: %s: %s\n", displayPath(path), setting.name, setting.value)
+			}
+			continue
+		}
+		for _, name := range names {
+			fmt.Printf("%s: %s: %s\n", displayPath(path), name, attrs.get(path, name))
+		}
+	}
+
+	return nil
+}
+
+func handleMaintenance() error {
+	usage := "usage: " + vcsName + " maintenance register [<dir>] | maintenance unregister [<dir>] | maintenance run | maintenance serve [--interval=<d>] [--idle=<d>]"
+
+	if len(os.Args) < 3 {
+		return usageError(usage)
+	}
+
+	// define a flag set for the subcommand
+	cmd := flag.NewFlagSet("maintenance "+os.Args[2], flag.ContinueOnError)
+	interval := cmd.Duration("interval", defaultMaintenanceInterval, "how often to check the registered repositories (serve)")
+	idle := cmd.Duration("idle", defaultMaintenanceIdle, "how long a repository must be unchanged before it is maintained (serve)")
+
+	if err := parseFlags(cmd, os.Args[3:]); err != nil {
+		return err
+	}
+
+	args := cmd.Args()
+	switch os.Args[2] {
+	case "register", "unregister":
+		if len(args) > 1 {
+			return usageError(usage)
+		}
+
+		// the repository this command runs in, or the given directory
+		root, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			root = args[0]
+			if !filepath.IsAbs(root) {
+				root = filepath.Join(cwdPrefix, root)
+			}
+		}
+
+		if os.Args[2] == "register" {
+			added, err := registerMaintenanceRepo(root)
+			if err != nil {
+				return err
+			}
+			if added {
+				fmt.Printf("Registered %s for maintenance\n", root)
+			}
+			return nil
+		}
+
+		removed, err := unregisterMaintenanceRepo(root)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("%s is not registered for maintenance", root)
+		}
+		fmt.Printf("Unregistered %s\n", root)
+	case "run":
+		if len(args) != 0 {
+			return usageError(usage)
+		}
+
+		report, err := runMaintenance(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Packed %d refs, wrote commit-graph with %d commits, pruned %d objects\n",
+			report.packedRefs, report.graphCommits, report.prunedObjects)
+	case "serve":
+		if len(args) != 0 || *interval <= 0 || *idle < 0 {
+			return usageError(usage)
+		}
+
+		// an interrupt ends the wait for the next round
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := serveMaintenance(ctx, *interval, *idle); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+// handleSynth handles the synth command, which generates test repositories.
+// It is left out of the documented commands.
+func handleSynth() error {
+	// define a flag set for synth
+	cmd := flag.NewFlagSet("synth", flag.ContinueOnError)
+	commits := cmd.Int("commits", 10, "number of commits on the current branch")
+	files := cmd.Int("files", 100, "number of files in every commit")
+	branches := cmd.Int("branches", 0, "number of extra branches forking off the current branch")
+	seed := cmd.Uint64("seed", 1, "seed for file contents and which files change")
+
+	if err := parseFlags(cmd, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if len(cmd.Args()) != 0 {
+		return usageError("usage: " + vcsName + " synth [--commits N] [--files M] [--branches K] [--seed S]")
+	}
+
+	report, err := generateSyntheticRepo(context.Background(), synthOptions{commits: *commits, files: *files, branches: *branches, seed: *seed})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated %d commits of %d files and %d branches; HEAD is %x\n", *commits, *files, len(report.branches), report.head)
+
+	return nil
+}
+
+func handleSparseCheckout() error {
+	usage := "usage: " + vcsName + " sparse-checkout set <dir>... | sparse-checkout list | sparse-checkout disable"
+
+	if len(os.Args) < 3 {
+		return usageError(usage)
+	}
+
+	args := os.Args[3:]
+	switch os.Args[2] {
+	case "set":
+		if len(args) == 0 {
+			return usageError(usage)
+		}
+
+		if err := setSparseCheckout(context.Background(), args); err != nil {
+			return err
+		}
+	case "list":
+		if len(args) != 0 {
+			return usageError(usage)
+		}
+
+		cone, err := loadSparseCone()
+		if err != nil {
+			return err
+		}
+		for _, dir := range cone.dirs {
+			fmt.Println(dir)
+		}
+	case "disable":
+		if len(args) != 0 {
+			return usageError(usage)
+		}
+
+		if err := setSparseCheckout(context.Background(), nil); err != nil {
+			return err
+		}
+	default:
+		return usageError(usage)
+	}
+
+	return nil
+}
+
+func handleCompletion() error {
+	if len(os.Args) != 3 {
+		return usageError("usage: " + vcsName + " completion (bash | zsh | fish)")
+	}
+
+	script, err := completionScript(os.Args[2])
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+
+	return nil
+}
+
+// handleComplete prints the completion candidates for the command line
+// given as its arguments, one per line, for the completion scripts. It
+// never fails, so the shell only ever sees candidates.
+func handleComplete() error {
+	for _, candidate := range completionCandidates(context.Background(), os.Args[2:]) {
+		fmt.Println(candidate)
+	}
+
+	return nil
+}
+
+func handleHelp() error {
+	args := os.Args[2:]
+	if len(args) > 1 {
+		return usageError("usage: " + vcsName + " help [<command>]")
+	}
+
+	if len(args) == 0 {
+		printHelp(os.Stdout)
+		return nil
+	}
+
+	info, ok := lookupCommand(args[0])
+	if !ok || info.hidden {
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+
+	// a command taking flags prints its usage and flags itself, and does
+	// nothing else, for -h; one with subcommands parses its flags only
+	// after them
+	if len(info.flags) > 0 && len(info.subcommands) == 0 {
+		os.Args = []string{os.Args[0], info.name, "-h"}
+		return info.run()
+	}
+
+	printCommandUsage(os.Stdout, info)
+	return nil
+}
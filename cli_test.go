@@ -0,0 +1,96 @@
+package mygit
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitStatus(t *testing.T) {
+	assert.Equal(t, exitFailure, exitStatus(errors.New("error reading file")))
+	assert.Equal(t, exitUsage, exitStatus(usageError("usage: "+vcsName+" fsck")))
+	assert.Equal(t, exitConflict, exitStatus(fmt.Errorf("cannot commit: %w", &ConflictError{Paths: []string{"a.txt"}})))
+	assert.Equal(t, exitConflict, exitStatus(errorOf(ErrConflict, "merge in progress")))
+	assert.Equal(t, exitFailure, exitStatus(quietExit(exitFailure)))
+
+	// handlers return their errors instead of exiting
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = []string{vcsName, "no-such-command"}
+	err := runCommand()
+	assert.EqualError(t, err, "unknown command: no-such-command")
+	assert.Equal(t, exitUsage, exitStatus(err))
+
+	// cat-file takes one mode at most
+	for _, modes := range [][]string{{"-t", "-s"}, {"-t", "-p"}, {"-s", "-p"}, {"-t", "-s", "-p"}} {
+		os.Args = append(append([]string{vcsName, "cat-file"}, modes...), "HEAD")
+		err = runCommand()
+		assert.EqualError(t, err, "please specify only one of -t, -s, or -p", "%v", modes)
+		assert.Equal(t, exitUsage, exitStatus(err), "%v", modes)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	newCmd := func() (*flag.FlagSet, *bool, *string) {
+		cmd := flag.NewFlagSet("grep", flag.ContinueOnError)
+		return cmd, cmd.Bool("n", false, ""), cmd.String("o", "", "")
+	}
+
+	// flags may follow the arguments
+	cmd, n, o := newCmd()
+	assert.NoError(t, parseFlags(cmd, []string{"main", "-n", "pattern", "-o", "out"}))
+	assert.True(t, *n)
+	assert.Equal(t, "out", *o)
+	assert.Equal(t, []string{"main", "pattern"}, cmd.Args())
+
+	// everything after "--" is an argument, and a "--" after an argument is kept
+	cmd, n, _ = newCmd()
+	assert.NoError(t, parseFlags(cmd, []string{"--", "-n", "a"}))
+	assert.False(t, *n)
+	assert.Equal(t, []string{"-n", "a"}, cmd.Args())
+
+	cmd, n, _ = newCmd()
+	assert.NoError(t, parseFlags(cmd, []string{"message", "--", "-n"}))
+	assert.False(t, *n)
+	assert.Equal(t, []string{"message", "--", "-n"}, cmd.Args())
+
+	cmd, _, _ = newCmd()
+	cmd.SetOutput(io.Discard)
+	assert.Equal(t, exitUsage, exitStatus(parseFlags(cmd, []string{"a", "-x"})))
+}
+
+func TestHelp(t *testing.T) {
+	assert.Equal(t, []string{"bisect start [<bad> [<good>...]]", "bisect (good | bad | skip) [<rev>...]", "bisect reset"},
+		usageForms("bisect start [<bad> [<good>...]] | bisect (good | bad | skip) [<rev>...] | bisect reset"))
+
+	var sb strings.Builder
+	printHelp(&sb)
+	assert.Contains(t, sb.String(), "   status ")
+	assert.NotContains(t, sb.String(), completeCommand)
+	// the benchmark generator is left out of help and completion, and still runs
+	assert.NotContains(t, sb.String(), "synth")
+	assert.Empty(t, completionCandidates(t.Context(), []string{"syn"}))
+	info, ok := lookupCommand("synth")
+	assert.True(t, ok)
+	assert.True(t, info.hidden)
+
+	info, ok = lookupCommand("clean")
+	assert.True(t, ok)
+	sb.Reset()
+	printCommandUsage(&sb, info)
+	assert.Equal(t, "usage: "+vcsName+" clean (-n | -f) [-d] [-x] [<path>...]\n\nRemove untracked files\n", sb.String())
+
+	// every command is registered once, with a handler and a summary
+	for _, info := range commands {
+		assert.NotNil(t, info.run, info.name)
+		assert.NotEmpty(t, info.summary, info.name)
+		assert.True(t, strings.HasPrefix(info.usage, info.name), info.name)
+	}
+}
@@ -0,0 +1,96 @@
+package mygit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isBundleFile reports whether path is a bundle rather than a repository.
+func isBundleFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	return err == nil && strings.TrimSpace(line) == bundleSignature
+}
+
+// advertisedBundleURI returns the bundle the repository at url offers to
+// clients for their initial download, set there with "config bundle.uri
+// <file>", or "" if it offers none. A relative file is relative to the
+// repository's root.
+func advertisedBundleURI(url string) (string, error) {
+	var uri string
+
+	err := withRepository(url, func() error {
+		value, err := getConfig("uri")
+		if err != nil {
+			return nil // not configured
+		}
+
+		uri = value
+		if !filepath.IsAbs(uri) {
+			uri, err = filepath.Abs(uri)
+		}
+		return err
+	})
+
+	return uri, err
+}
+
+// defaultCloneDir names the directory a clone of source goes into when
+// none is given: the last element of its path, without ".bundle".
+func defaultCloneDir(source string) string {
+	return strings.TrimSuffix(filepath.Base(filepath.Clean(source)), ".bundle")
+}
+
+// cloneRepository creates a repository at dir from source, which is a
+// bundle file or a local repository. A repository is cloned by first
+// unbundling bundleURI, or the bundle it advertises when bundleURI is
+// empty, and then copying only the objects and refs added since the bundle
+// was made. It returns the bundle that was used, if any.
+func cloneRepository(ctx context.Context, source, dir, bundleURI string) (string, error) {
+	if isBundleFile(source) {
+		return "", cloneBundle(ctx, source, dir)
+	}
+
+	if bundleURI == "" {
+		var err error
+		if bundleURI, err = advertisedBundleURI(source); err != nil {
+			return "", err
+		}
+	}
+	if bundleURI == "" {
+		return "", cloneLocalRepository(ctx, source, dir)
+	}
+
+	// check the source before spending time on the bundle
+	src, err := readCloneSource(ctx, source)
+	if err != nil {
+		return "", err
+	}
+
+	f, _, b, err := openBundle(bundleURI)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if b.format != src.format {
+		return "", fmt.Errorf("bundle %s uses %s object ids but %s uses %s", bundleURI, b.format, source, src.format)
+	}
+
+	if err := cloneBundle(ctx, bundleURI, dir); err != nil {
+		return "", err
+	}
+
+	// top up with what the repository gained after the bundle was made
+	return bundleURI, withRepository(dir, func() error {
+		return fillClone(ctx, src)
+	})
+}
@@ -0,0 +1,83 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneWithBundleURI(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "clone@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	commit := func(content string, parents ...[]byte) []byte {
+		blobHash, err := createObject([]byte(content))
+		assert.NoError(t, err)
+		treeHash, err := buildTreeObject(map[string][]byte{"file.txt": blobHash})
+		assert.NoError(t, err)
+		commitHash, err := writeCommitObject(treeHash, parents, content)
+		assert.NoError(t, err)
+		return commitHash
+	}
+
+	first := commit("first")
+	assert.NoError(t, updateRef("refs/heads/main", first))
+
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "snapshot.bundle")
+	f, err := os.Create(snapshot)
+	assert.NoError(t, err)
+	_, err = createBundle(t.Context(), f, []string{"--all"})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.NoError(t, updateConfig("uri", snapshot))
+
+	// the repository moves on after the bundle was made
+	second := commit("second", first)
+	assert.NoError(t, updateRef("refs/heads/main", second))
+	assert.NoError(t, createTag("v2", second))
+
+	assert.True(t, isBundleFile(snapshot))
+	assert.False(t, isBundleFile("."))
+	assert.Equal(t, "snapshot", defaultCloneDir(snapshot))
+
+	clonePath := filepath.Join(dir, "clone")
+	used, err := cloneRepository(t.Context(), ".", clonePath, "")
+	assert.NoError(t, err)
+	assert.Equal(t, snapshot, used)
+
+	content, err := os.ReadFile(filepath.Join(clonePath, "file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+
+	err = withRepository(clonePath, func() error {
+		head, err := resolveRevision("HEAD")
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, second, head)
+
+		tag, err := readRefIfExists("refs/tags/v2")
+		assert.Equal(t, second, tag)
+		return err
+	})
+	assert.NoError(t, err)
+
+	// a bundle is cloned directly, as it was when it was made
+	bundleClone := filepath.Join(dir, "from-bundle")
+	used, err = cloneRepository(t.Context(), snapshot, bundleClone, "")
+	assert.NoError(t, err)
+	assert.Empty(t, used)
+	content, err = os.ReadFile(filepath.Join(bundleClone, "file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(content))
+}
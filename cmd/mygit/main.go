@@ -0,0 +1,9 @@
+// Command mygit is the mygit command line. All of its work is done by the
+// github.com/KDT2006/mygit package.
+package main
+
+import "github.com/KDT2006/mygit"
+
+func main() {
+	mygit.Main()
+}
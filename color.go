@@ -0,0 +1,141 @@
+package mygit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// colorWhen is set by the global --color option, or by --color after the
+// command name, to "auto", "always", or "never". Empty defers to color.ui
+// in the config, and then to auto.
+var colorWhen = ""
+
+// autoNoColor is what auto decides: no color unless stdout is a terminal,
+// NO_COLOR is unset, and TERM is not dumb.
+var autoNoColor = color.NoColor
+
+// Styles of the colored output. They check whether color is on each time
+// they are used, so they follow the --color option and color.ui.
+var (
+	diffMetaStyle      = color.New(color.Bold)
+	diffHunkStyle      = color.New(color.FgCyan)
+	diffAddedStyle     = color.New(color.FgGreen)
+	diffRemovedStyle   = color.New(color.FgRed)
+	commitHashStyle    = color.New(color.FgYellow)
+	currentBranchStyle = color.New(color.FgGreen)
+)
+
+// parseColorWhen parses a --color or color.ui value. true and false are
+// taken as always and never.
+func parseColorWhen(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "auto":
+		return "auto", nil
+	case "always", "true":
+		return "always", nil
+	case "never", "false":
+		return "never", nil
+	}
+
+	return "", fmt.Errorf("invalid color setting %q: expected auto, always, or never", value)
+}
+
+// applyColorWhen turns colored output on or off as when says.
+func applyColorWhen(when string) {
+	switch when {
+	case "always":
+		color.NoColor = false
+	case "never":
+		color.NoColor = true
+	default:
+		color.NoColor = autoNoColor
+	}
+}
+
+// configureColor turns colored output on or off as the global --color
+// option says, else as color.ui says. Outside a repository only the option
+// counts.
+func configureColor() {
+	when := colorWhen
+	if when == "" {
+		if value, err := getConfig("ui"); err == nil {
+			when, _ = parseColorWhen(value)
+		}
+	}
+
+	applyColorWhen(when)
+}
+
+// colorWhenFlag is the --color flag of a command. Given without a value it
+// means always.
+type colorWhenFlag struct{}
+
+func (colorWhenFlag) String() string { return colorWhen }
+
+func (colorWhenFlag) Set(value string) error {
+	when, err := parseColorWhen(value)
+	if err != nil {
+		return err
+	}
+
+	colorWhen = when
+	applyColorWhen(when)
+	return nil
+}
+
+func (colorWhenFlag) IsBoolFlag() bool { return true }
+
+// colorDiff colors the output of formatIndexDiff for a terminal: file
+// headers in bold, hunk headers in cyan, and added and removed lines in
+// green and red. It returns diff unchanged when color is off.
+func colorDiff(diff string) string {
+	return colorDiffLines(diff, true)
+}
+
+// colorWordDiff colors the headers of a word diff as colorDiff does. Its
+// lines have no prefix to tell added from removed, so they are left alone.
+func colorWordDiff(diff string) string {
+	return colorDiffLines(diff, false)
+}
+
+// colorDiffLines colors the headers of a diff, and with changedLines its
+// added and removed lines.
+func colorDiffLines(diff string, changedLines bool) string {
+	if color.NoColor || diff == "" {
+		return diff
+	}
+
+	var sb strings.Builder
+	inHunk := false
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		style := (*color.Color)(nil)
+
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			inHunk = false
+			style = diffMetaStyle
+		case strings.HasPrefix(text, "@@"):
+			inHunk = true
+			style = diffHunkStyle
+		case !inHunk:
+			style = diffMetaStyle
+		case !changedLines:
+		case strings.HasPrefix(text, "+"):
+			style = diffAddedStyle
+		case strings.HasPrefix(text, "-"):
+			style = diffRemovedStyle
+		}
+
+		if style == nil || text == "" {
+			sb.WriteString(line)
+			continue
+		}
+		sb.WriteString(style.Sprint(text))
+		sb.WriteString(line[len(text):])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,52 @@
+package mygit
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColorOutput(t *testing.T) {
+	noColor, when := color.NoColor, colorWhen
+	defer func() { color.NoColor, colorWhen = noColor, when }()
+
+	diff := "diff --git a/a.txt b/a.txt\nindex 0000000..1111111\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-old\n+new\n context\n"
+
+	// never leaves the diff as it is
+	applyColorWhen("never")
+	assert.Equal(t, diff, colorDiff(diff))
+
+	applyColorWhen("always")
+	assert.Equal(t, "\x1b[1mdiff --git a/a.txt b/a.txt\x1b[22m\n"+
+		"\x1b[1mindex 0000000..1111111\x1b[22m\n"+
+		"\x1b[1m--- a/a.txt\x1b[22m\n"+
+		"\x1b[1m+++ b/a.txt\x1b[22m\n"+
+		"\x1b[36m@@ -1 +1 @@\x1b[0m\n"+
+		"\x1b[31m-old\x1b[0m\n"+
+		"\x1b[32m+new\x1b[0m\n"+
+		" context\n", colorDiff(diff))
+
+	// the option wins over color.ui, which wins over auto
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("ui", "never"))
+		colorWhen = ""
+		configureColor()
+		assert.True(t, color.NoColor)
+
+		colorWhen = "always"
+		configureColor()
+		assert.False(t, color.NoColor)
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for value, want := range map[string]string{"auto": "auto", "ALWAYS": "always", "true": "always", "never": "never", "false": "never"} {
+		got, err := parseColorWhen(value)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err = parseColorWhen("sometimes")
+	assert.EqualError(t, err, `invalid color setting "sometimes": expected auto, always, or never`)
+}
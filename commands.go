@@ -0,0 +1,584 @@
+package mygit
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// commandInfo is one command of the command line: its handler, what help
+// and completion say about it, and what runCommand sets up before running
+// it. A new command is added by registering it.
+type commandInfo struct {
+	name    string
+	usage   string // the synopsis, forms separated by " | " as in usage errors
+	summary string // one line for help
+	run     func() error
+
+	flags       []string // completed after the command name
+	subcommands []string // completed for the first argument
+	args        completionKind
+
+	json     bool // can print JSON with --json
+	index    bool // runs holding index.lock
+	workTree bool // reads or writes the working tree, so is refused in a bare repository
+	pager    bool // pages its output on a terminal
+	hidden   bool // left out of help and completion
+}
+
+// commands holds the registered commands in the order help lists them, and
+// commandIndex their positions by name.
+var (
+	commands     []commandInfo
+	commandIndex = make(map[string]int)
+)
+
+// registerCommand adds a command.
+func registerCommand(info commandInfo) {
+	if _, ok := commandIndex[info.name]; ok {
+		panic("command registered twice: " + info.name)
+	}
+	commandIndex[info.name] = len(commands)
+	commands = append(commands, info)
+}
+
+// lookupCommand returns the command registered under name.
+func lookupCommand(name string) (commandInfo, bool) {
+	i, ok := commandIndex[name]
+	if !ok {
+		return commandInfo{}, false
+	}
+
+	return commands[i], true
+}
+
+func init() {
+	registerCommand(commandInfo{
+		name:    "init",
+		usage:   "init [--template=<dir>] [--bare [<dir>]]",
+		summary: "Create an empty repository",
+		run:     handleInit,
+		flags:   []string{"--bare", "--template="},
+	})
+	registerCommand(commandInfo{
+		name:    "clone",
+		usage:   "clone [--bundle-uri=<file>] <bundle-or-repository> [<dir>]",
+		summary: "Create a repository from a bundle or a local repository",
+		run:     handleClone,
+		flags:   []string{"--bundle-uri="},
+	})
+	registerCommand(commandInfo{
+		name:     "add",
+		usage:    "add [--dry-run] [--verbose] [--ignore-errors] <pathspec>... | add -p [<pathspec>...] | add -u [<pathspec>...]",
+		summary:  "Stage files, changed hunks, or changed tracked files in the index",
+		run:      handleAdd,
+		flags:    []string{"-u", "-p", "--dry-run", "--verbose", "--ignore-errors"},
+		args:     completeTrackedPaths,
+		index:    true,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "rm",
+		usage:    "rm [--cached] [-r] <pathspec>...",
+		summary:  "Remove files from the index and the working tree",
+		run:      handleRemove,
+		flags:    []string{"--cached", "-r"},
+		args:     completeTrackedPaths,
+		index:    true,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "status",
+		usage:    "status [--porcelain [-z] | --json]",
+		summary:  "Show changed, unstaged, and untracked files",
+		run:      handleStatus,
+		flags:    []string{"--porcelain", "-z", "--json", "--color"},
+		json:     true,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "commit",
+		usage:    "commit [--dry-run] <message> | commit [--only] [--include] <message> [--] <path>...",
+		summary:  "Record the staged changes, or those of some paths, as a new commit",
+		run:      handleCommit,
+		flags:    []string{"--dry-run", "--only", "--include"},
+		args:     completeTrackedPaths,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "diff",
+		usage:    "diff [--cached] [-M[=<n>]] [--diff-algorithm=<algorithm>] [--word-diff[=<mode>]] [--stat | --shortstat | --name-only | --name-status] [<commit> [<commit>]]",
+		summary:  "Show changes between the working tree, the index, and commits",
+		run:      handleDiff,
+		flags:    []string{"--cached", "-M", "--stat", "--shortstat", "--name-only", "--name-status", "--word-diff", "--diff-algorithm", "--color"},
+		args:     completeRevisions,
+		workTree: true,
+		pager:    true,
+	})
+	registerCommand(commandInfo{
+		name:    "log",
+		usage:   "log [--json | --follow <path>] [<rev>]",
+		summary: "Print the commit history with any notes",
+		run:     handleLog,
+		flags:   []string{"--json", "--color", "--follow"},
+		args:    completeRevisions,
+		json:    true,
+		pager:   true,
+	})
+	registerCommand(commandInfo{
+		name:    "show",
+		usage:   "show [--json] [<rev>]",
+		summary: "Show a commit with its diff, a tree listing, or blob content",
+		run:     handleShow,
+		flags:   []string{"--json", "--color"},
+		args:    completeRevisions,
+		json:    true,
+		pager:   true,
+	})
+	registerCommand(commandInfo{
+		name:    "branch",
+		usage:   "branch [-d | -D] [<branch-name>] | branch [--list] [--format=<format> | --json] [--sort=<key>] [<pattern>...]",
+		summary: "List, create, or delete branches",
+		run:     handleBranch,
+		flags:   []string{"-d", "-D", "--list", "--format=", "--sort=", "--json", "--color"},
+		args:    completeRevisions,
+		json:    true,
+	})
+	registerCommand(commandInfo{
+		name:     "checkout",
+		usage:    "checkout <branch-name> | checkout <revision> | checkout --continue | checkout --abort | checkout (--ours | --theirs) [--] <path>...",
+		summary:  "Switch branches and restore the working tree",
+		run:      handleCheckout,
+		flags:    []string{"--continue", "--abort", "--ours", "--theirs"},
+		args:     completeRevisions,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "merge",
+		usage:    "merge [--report <file>] <branch> | merge (--abort | --continue)",
+		summary:  "Merge a branch into the current one",
+		run:      handleMerge,
+		flags:    []string{"--report", "--abort", "--continue"},
+		args:     completeRevisions,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "mergetool",
+		usage:    "mergetool [--tool <tool>] [<path>...]",
+		summary:  "Resolve conflicted paths with an external merge tool",
+		run:      handleMergeTool,
+		flags:    []string{"--tool"},
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "merge-train",
+		usage:    "merge-train <branch>... | merge-train (--continue | --skip | --abort)",
+		summary:  "Merge several branches in sequence",
+		run:      handleMergeTrain,
+		flags:    []string{"--continue", "--skip", "--abort"},
+		args:     completeRevisions,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:    "merge-base",
+		usage:   "merge-base [--is-ancestor] <a> <b>",
+		summary: "Print the common ancestor of two commits",
+		run:     handleMergeBase,
+		flags:   []string{"--is-ancestor"},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:     "reset",
+		usage:    "reset [--soft | --mixed | --hard] <commit>",
+		summary:  "Move the current branch, and reset the index and working tree",
+		run:      handleReset,
+		flags:    []string{"--soft", "--mixed", "--hard"},
+		args:     completeRevisions,
+		index:    true,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:    "tag",
+		usage:   "tag [-d] <name> [<commit>] | tag [-l] [--format=<format>] [--sort=<key>] [<pattern>...]",
+		summary: "Create, delete, or list tags",
+		run:     handleTag,
+		flags:   []string{"-d", "-l", "--list", "--format=", "--sort="},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:        "notes",
+		usage:       "notes add [-f] (-m <message> | -F <file>) [<commit>] | notes show [<commit>] | notes remove [<commit>]",
+		summary:     "Attach notes to commits without rewriting them",
+		run:         handleNotes,
+		flags:       []string{"-f", "-m", "-F"},
+		subcommands: []string{"add", "show", "remove"},
+		args:        completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:        "bisect",
+		usage:       "bisect start [<bad> [<good>...]] | bisect (good | bad | skip) [<rev>...] | bisect run <cmd> [<arg>...] | bisect reset",
+		summary:     "Binary-search the history for the commit that introduced a bug",
+		run:         handleBisect,
+		subcommands: []string{"start", "good", "bad", "skip", "run", "reset"},
+		args:        completeRevisions,
+		workTree:    true,
+	})
+	registerCommand(commandInfo{
+		name:    "grep",
+		usage:   "grep [-i] [-n] [<rev>] <pattern>",
+		summary: "Search tracked content",
+		run:     handleGrep,
+		flags:   []string{"-i", "-n"},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:     "clean",
+		usage:    "clean (-n | -f) [-d] [-x] [<path>...]",
+		summary:  "Remove untracked files",
+		run:      handleClean,
+		flags:    []string{"-n", "-f", "-d", "-x"},
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:        "sparse-checkout",
+		usage:       "sparse-checkout set <dir>... | sparse-checkout list | sparse-checkout disable",
+		summary:     "Check out only some directories",
+		run:         handleSparseCheckout,
+		subcommands: []string{"set", "list", "disable"},
+		workTree:    true,
+	})
+	registerCommand(commandInfo{
+		name:        "worktree",
+		usage:       "worktree add <path> <branch> | worktree list | worktree remove [--force] <path>",
+		summary:     "Manage linked working trees",
+		run:         handleWorktree,
+		flags:       []string{"--force"},
+		subcommands: []string{"add", "list", "remove"},
+	})
+	registerCommand(commandInfo{
+		name:        "submodule",
+		usage:       "submodule add <url> <path> | submodule init | submodule update",
+		summary:     "Record and check out nested repositories",
+		run:         handleSubmodule,
+		subcommands: []string{"add", "init", "update"},
+		workTree:    true,
+	})
+	registerCommand(commandInfo{
+		name:        "snapshot",
+		usage:       "snapshot [save | list | restore <hash> | autosave [--interval=<duration>]]",
+		summary:     "Record the working tree without touching the index or HEAD",
+		run:         handleSnapshot,
+		flags:       []string{"--interval="},
+		subcommands: []string{"save", "list", "restore", "autosave"},
+		workTree:    true,
+	})
+	registerCommand(commandInfo{
+		name:     "lock",
+		usage:    "lock [<path>]",
+		summary:  "Lock a path, or list locks",
+		run:      handleLock,
+		args:     completeTrackedPaths,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "unlock",
+		usage:    "unlock [--force] <path>",
+		summary:  "Release a lock",
+		run:      handleUnlock,
+		flags:    []string{"--force"},
+		args:     completeTrackedPaths,
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:    "format-patch",
+		usage:   "format-patch [-o <dir>] [--stdout] (<since> | <a>..<b>)",
+		summary: "Write commits as email-ready patches",
+		run:     handleFormatPatch,
+		flags:   []string{"-o", "--stdout"},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:     "apply",
+		usage:    "apply [--index] [--reverse] [--fuzz=<n>] [-p <n>] [--check] [<patch>...]",
+		summary:  "Apply patches to the working tree and index",
+		run:      handleApply,
+		flags:    []string{"--check", "--index", "-R", "--reverse", "-p", "--fuzz="},
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:     "am",
+		usage:    "am [<mbox>...] | am --continue | am --skip | am --abort",
+		summary:  "Commit a mailbox of patches",
+		run:      handleAm,
+		flags:    []string{"--continue", "--skip", "--abort"},
+		workTree: true,
+	})
+	registerCommand(commandInfo{
+		name:    "request-pull",
+		usage:   "request-pull <start> <url> [<end>]",
+		summary: "Summarize commits for a maintainer to pull",
+		run:     handleRequestPull,
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:    "archive",
+		usage:   "archive [--format=tar|zip] [--prefix=<dir>/] [-o <file>] [--remote=<repository>] <tree-ish>",
+		summary: "Write the files of a commit or tree as a tar or zip archive",
+		run:     handleArchive,
+		flags:   []string{"--format=", "--prefix=", "-o", "--remote="},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:        "bundle",
+		usage:       "bundle create <file> <rev>... | bundle verify <file> | bundle list-heads <file> | bundle unbundle <file> | bundle clone <file> <dir>",
+		summary:     "Move refs and objects through a file",
+		run:         handleBundle,
+		subcommands: []string{"create", "verify", "list-heads", "unbundle", "clone"},
+	})
+	registerCommand(commandInfo{
+		name:    "fast-export",
+		usage:   "fast-export [-o <file>] [<branch-or-tag>...]",
+		summary: "Write history as a git fast-import stream",
+		run:     handleFastExport,
+		flags:   []string{"-o"},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:    "fast-import",
+		usage:   "fast-import [--force]",
+		summary: "Read history from a fast-import stream on stdin",
+		run:     handleFastImport,
+		flags:   []string{"--force"},
+	})
+	registerCommand(commandInfo{
+		name:    "config",
+		usage:   "config [--global] <section.key> [<value>]",
+		summary: "Get or set a config value",
+		run:     handleConfig,
+		flags:   []string{"--global"},
+	})
+	registerCommand(commandInfo{
+		name:        "state",
+		usage:       "state export [<file>] | state apply <file>",
+		summary:     "Export or apply branches, tags, and config as JSON",
+		run:         handleState,
+		subcommands: []string{"export", "apply"},
+	})
+	registerCommand(commandInfo{
+		name:    "gc",
+		usage:   "gc",
+		summary: "Pack refs and write the commit-graph",
+		run:     handleGC,
+	})
+	registerCommand(commandInfo{
+		name:    "compact",
+		usage:   "compact [--grace=<duration>] [--dry-run]",
+		summary: "Drop stale index entries and unreachable objects",
+		run:     handleCompact,
+		flags:   []string{"--dry-run", "--grace="},
+	})
+	registerCommand(commandInfo{
+		name:        "maintenance",
+		usage:       "maintenance register [<dir>] | maintenance unregister [<dir>] | maintenance run | maintenance serve [--interval=<d>] [--idle=<d>]",
+		summary:     "Keep registered repositories tidy in the background",
+		run:         handleMaintenance,
+		flags:       []string{"--interval=", "--idle="},
+		subcommands: []string{"register", "unregister", "run", "serve"},
+	})
+	registerCommand(commandInfo{
+		name:    "fsck",
+		usage:   "fsck",
+		summary: "Check the object store",
+		run:     handleFsck,
+	})
+	registerCommand(commandInfo{
+		name:    "migrate-hash",
+		usage:   "migrate-hash [--lookup <hash>]",
+		summary: "Rewrite the repository from SHA-1 to SHA-256",
+		run:     handleMigrateHash,
+		flags:   []string{"--lookup="},
+	})
+	registerCommand(commandInfo{
+		name:    "ahead-behind",
+		usage:   "ahead-behind <commit> <base>",
+		summary: "Count the commits each of two commits has that the other lacks",
+		run:     handleAheadBehind,
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:    "for-each-ref",
+		usage:   "for-each-ref [--format=<format>] [--sort=<key>] [--count=<n>] [<pattern>...]",
+		summary: "List refs in every namespace",
+		run:     handleForEachRef,
+		flags:   []string{"--format=", "--sort=", "--count="},
+	})
+	registerCommand(commandInfo{
+		name:    "rev-parse",
+		usage:   "rev-parse <rev>...",
+		summary: "Resolve revisions to full hashes",
+		run:     handleRevParse,
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:    "hash-object",
+		usage:   "hash-object [-w] [-t <type>] (--stdin | <file>)",
+		summary: "Compute the object id of a file, and optionally store it",
+		run:     handleHashObject,
+		flags:   []string{"-w", "-t", "--stdin"},
+	})
+	registerCommand(commandInfo{
+		name:    "cat-file",
+		usage:   "cat-file [-t | -s | -p] <hash>",
+		summary: "Print an object, its type, or its size",
+		run:     handleCatFile,
+		flags:   []string{"-p", "-s", "-t"},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:    "ls-files",
+		usage:   "ls-files [--stage] [--modified] [--deleted] | ls-files --unmerged",
+		summary: "List the index entries",
+		run:     handleLsFiles,
+		flags:   []string{"--stage", "--modified", "--deleted", "--unmerged"},
+	})
+	registerCommand(commandInfo{
+		name:    "ls-tree",
+		usage:   "ls-tree [-r] <tree-ish>",
+		summary: "List a tree",
+		run:     handleLsTree,
+		flags:   []string{"-r"},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:    "write-tree",
+		usage:   "write-tree [--prefix=<dir>] [<pathspec>...]",
+		summary: "Write a tree object from the index",
+		run:     handleWriteTree,
+		flags:   []string{"--prefix="},
+	})
+	registerCommand(commandInfo{
+		name:    "tree-id",
+		usage:   "tree-id [--path <dir>] [<pathspec>...]",
+		summary: "Print the tree id of the index without writing anything",
+		run:     handleTreeID,
+		flags:   []string{"--path="},
+	})
+	registerCommand(commandInfo{
+		name:    "read-tree",
+		usage:   "read-tree <tree-ish>",
+		summary: "Replace the index with a tree",
+		run:     handleReadTree,
+		args:    completeRevisions,
+		index:   true,
+	})
+	registerCommand(commandInfo{
+		name:    "commit-tree",
+		usage:   "commit-tree <tree> [-p <parent>]... -m <message>",
+		summary: "Create a commit object from a tree",
+		run:     handleCommitTree,
+		flags:   []string{"-m", "-p"},
+		args:    completeRevisions,
+	})
+	registerCommand(commandInfo{
+		name:    "check-ignore",
+		usage:   "check-ignore [-v] [--no-index] <path>...",
+		summary: "Print the paths that are ignored",
+		run:     handleCheckIgnore,
+		flags:   []string{"-v", "--no-index"},
+	})
+	registerCommand(commandInfo{
+		name:    "check-attr",
+		usage:   "check-attr (-a | <attr>...) [--] <path>...",
+		summary: "Print the attributes of paths",
+		run:     handleCheckAttr,
+		flags:   []string{"-a"},
+		args:    completeTrackedPaths,
+	})
+	registerCommand(commandInfo{
+		name:     "synth",
+		usage:    "synth [--commits N] [--files M] [--branches K] [--seed S]",
+		summary:  "Generate a synthetic history for benchmarks",
+		run:      handleSynth,
+		flags:    []string{"--commits=", "--files=", "--branches=", "--seed="},
+		workTree: true,
+		hidden:   true,
+	})
+	registerCommand(commandInfo{
+		name:    "completion",
+		usage:   "completion (bash | zsh | fish)",
+		summary: "Print a shell completion script",
+		run:     handleCompletion,
+		args:    completeShells,
+	})
+	registerCommand(commandInfo{
+		name:    "help",
+		usage:   "help [<command>]",
+		summary: "Show the commands, or the usage and flags of one",
+		run:     handleHelp,
+		args:    completeCommands,
+	})
+	registerCommand(commandInfo{
+		name:    completeCommand,
+		usage:   completeCommand + " <word>...",
+		summary: "Print completion candidates",
+		run:     handleComplete,
+		hidden:  true,
+	})
+}
+
+// globalUsage is the synopsis of the command line as a whole.
+const globalUsage = vcsName + " [-q | --quiet] [-C <path>] [--git-dir=<dir>] [--work-tree=<dir>] [--json] [--color[=<when>]] [--no-pager] [--porcelain-errors] <command> [<args>]"
+
+// printHelp writes the synopsis of the command line and a line for each
+// command.
+func printHelp(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s\n\nCommands:\n", globalUsage)
+
+	width := 0
+	for _, info := range commands {
+		width = max(width, len(info.name))
+	}
+	for _, info := range commands {
+		if !info.hidden {
+			fmt.Fprintf(w, "   %-*s  %s\n", width, info.name, info.summary)
+		}
+	}
+
+	fmt.Fprintf(w, "\nRun '%s help <command>' for the usage and flags of a command.\n", vcsName)
+}
+
+// printCommandUsage writes the usage of a command, a form per line, and
+// what it does.
+func printCommandUsage(w io.Writer, info commandInfo) {
+	for i, form := range usageForms(info.usage) {
+		prefix := "usage: "
+		if i > 0 {
+			prefix = "   or: "
+		}
+		fmt.Fprintf(w, "%s%s %s\n", prefix, vcsName, form)
+	}
+
+	fmt.Fprintf(w, "\n%s\n", info.summary)
+}
+
+// usageForms splits a synopsis into its forms at each " | " outside
+// brackets and parentheses, so "(-n | -f)" stays within its form.
+func usageForms(usage string) []string {
+	var forms []string
+	depth, start := 0, 0
+	for i := 0; i < len(usage); i++ {
+		switch usage[i] {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case '|':
+			if depth == 0 && strings.HasPrefix(usage[i-1:], " | ") {
+				forms = append(forms, usage[start:i-1])
+				start = i + 2
+			}
+		}
+	}
+
+	return append(forms, usage[start:])
+}
@@ -0,0 +1,316 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"strings"
+)
+
+const (
+	maxSubjectLength = 72 // longest commit subject that passes the message check
+)
+
+// commitReport describes what a commit would record, as computed by dryRunCommit.
+type commitReport struct {
+	treeHash  []byte
+	author    string
+	committer string
+	changes   []fileChange
+	problems  []string // reasons the commit would be refused
+	warnings  []string // issues that would not block the commit
+	hookState string   // result of the pre-commit hook
+}
+
+// dryRunCommit computes what committing the current index with message
+// would record, without writing any objects, refs, or index changes.
+func dryRunCommit(ctx context.Context, message string) (commitReport, error) {
+	var report commitReport
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return report, err
+	}
+
+	// hash the tree without storing it, reusing cached trees where possible
+	cache, err := readCacheTree()
+	if err != nil {
+		return report, err
+	}
+	report.treeHash, err = buildTreeRecursive(index, ".", gitlinks, maps.Clone(cache), hashTreeObject)
+	if err != nil {
+		return report, err
+	}
+
+	headIndex, err := headCommitIndex(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.changes = diffIndexes(headIndex, index)
+
+	report.author, report.committer, err = commitIdentity()
+	if err != nil {
+		report.problems = append(report.problems, "user.email is not set")
+	}
+
+	parents, err := pendingCommitParents()
+	if err != nil {
+		return report, err
+	}
+
+	if yes, err := isMergeInProgress(); err != nil {
+		return report, err
+	} else if yes {
+		resolved, err := isConflictsResolved(ctx, index)
+		if err != nil {
+			return report, err
+		}
+		if !resolved {
+			report.problems = append(report.problems, "merge conflicts are not resolved")
+		}
+	}
+
+	subject, _, _ := strings.Cut(message, "\n")
+	switch {
+	case strings.TrimSpace(message) == "":
+		report.problems = append(report.problems, "commit message is empty")
+	case len(subject) > maxSubjectLength:
+		report.warnings = append(report.warnings, fmt.Sprintf("subject is longer than %d characters", maxSubjectLength))
+	}
+
+	if len(report.changes) == 0 {
+		report.warnings = append(report.warnings, "no changes staged")
+	}
+
+	switch {
+	case !hookExists("pre-commit"):
+		report.hookState = "not present"
+	default:
+		if err := runPreCommitHook(ctx, index, maps.Clone(cache), parents); err != nil {
+			report.hookState = err.Error()
+			report.problems = append(report.problems, err.Error())
+		} else {
+			report.hookState = "passed"
+		}
+	}
+
+	return report, nil
+}
+
+// pendingCommitParents returns the parents a commit of the index would
+// record: HEAD, if it points at a commit, and MERGE_HEAD during a merge.
+func pendingCommitParents() ([][]byte, error) {
+	head, err := getHEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	var parents [][]byte
+	if refHash, err := getRef(head); err != nil {
+		return nil, err
+	} else if refHash != nil {
+		parents = append(parents, refHash)
+	}
+
+	mergeHead, err := readMergeHeadIn(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	if mergeHead != nil {
+		parents = append(parents, mergeHead)
+	}
+
+	return parents, nil
+}
+
+// String returns the human-readable form of the report.
+func (r commitReport) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("tree %x\n", r.treeHash))
+	if r.author != "" {
+		sb.WriteString(fmt.Sprintf("author %s\n", r.author))
+		sb.WriteString(fmt.Sprintf("committer %s\n", r.committer))
+	}
+
+	sb.WriteString(fmt.Sprintf("\n%d file(s) changed\n", len(r.changes)))
+	for _, change := range r.changes {
+		sb.WriteString(fmt.Sprintf("\t%c %s\n", change.status, change.path))
+	}
+
+	sb.WriteString(fmt.Sprintf("\npre-commit hook: %s\n", r.hookState))
+	for _, warning := range r.warnings {
+		sb.WriteString(fmt.Sprintf("warning: %s\n", warning))
+	}
+	for _, problem := range r.problems {
+		sb.WriteString(fmt.Sprintf("error: %s\n", problem))
+	}
+
+	return sb.String()
+}
+
+// pathspecMatches reports whether an index path is the given path or lies
+// below it ("." matches everything).
+func pathspecMatches(spec, indexPath string) bool {
+	return spec == "." || indexPath == spec || strings.HasPrefix(indexPath, spec+"/")
+}
+
+// partialCommitIndex returns the index a partial commit of paths records:
+// the HEAD commit's entries, with the entries at or below each path taken
+// from the index. With fromWorkTree, the working tree state of the paths is
+// staged first, so it is what gets committed. Staged changes to other
+// paths are left in the index and are not part of the result.
+func partialCommitIndex(ctx context.Context, paths []string, fromWorkTree bool) (map[string][]byte, error) {
+	if yes, err := isMergeInProgress(); err != nil {
+		return nil, err
+	} else if yes {
+		return nil, fmt.Errorf("cannot commit only some paths while a merge is in progress")
+	}
+
+	headIndex, err := headCommitIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if fromWorkTree {
+		if err := stageWorkTreePaths(ctx, paths, headIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	partial := maps.Clone(headIndex)
+	for _, spec := range paths {
+		matched := false
+
+		for path := range headIndex {
+			if pathspecMatches(spec, path) {
+				delete(partial, path) // deleted unless still staged
+				matched = true
+			}
+		}
+		for path, hash := range index {
+			if pathspecMatches(spec, path) {
+				partial[path] = hash
+				matched = true
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("pathspec %s did not match any file known to %s", displayPath(spec), vcsName)
+		}
+	}
+
+	return partial, nil
+}
+
+// stageWorkTreePaths stages the working tree state of each path: files are
+// added, and tracked files that no longer exist are removed from the index.
+func stageWorkTreePaths(ctx context.Context, paths []string, headIndex map[string][]byte) error {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range paths {
+		info, err := os.Stat(workTreePath(spec))
+		switch {
+		case err == nil && info.IsDir():
+			_, err = addDirectory(ctx, spec, addOptions{})
+		case err == nil:
+			var content []byte
+			if content, err = os.ReadFile(workTreePath(spec)); err == nil {
+				var hash []byte
+				if hash, err = createObject(content); err == nil {
+					err = updateIndex(ctx, spec, hash)
+				}
+			}
+		case errors.Is(err, fs.ErrNotExist):
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("error staging %s: %w", displayPath(spec), err)
+		}
+
+		// tracked files that were deleted from the working tree
+		for _, tracked := range []map[string][]byte{index, headIndex} {
+			for path := range tracked {
+				if !pathspecMatches(spec, path) {
+					continue
+				}
+				if _, err := os.Lstat(workTreePath(path)); errors.Is(err, fs.ErrNotExist) {
+					if err := removeIndexEntry(ctx, path); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// createPartialCommit commits the given index, as built by
+// partialCommitIndex for paths, on top of HEAD. Trees of directories inside
+// the paths are taken from the index's cache-tree extension where possible.
+// The index file itself is not changed.
+func createPartialCommit(ctx context.Context, message string, partial map[string][]byte, paths []string) ([]byte, error) {
+	head, err := getHEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	refHash, err := getRef(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var parents [][]byte
+	if refHash != nil {
+		parents = append(parents, refHash)
+	}
+
+	// inside the paths the partial index matches the real one
+	cache, err := readCacheTree()
+	if err != nil {
+		return nil, err
+	}
+	cache = limitCacheTree(cache, paths)
+
+	if err := runPreCommitHook(ctx, partial, maps.Clone(cache), parents); err != nil {
+		return nil, fmt.Errorf("cannot commit: %w", err)
+	}
+
+	gitlinks, err := gitlinkPaths(partial)
+	if err != nil {
+		return nil, err
+	}
+
+	treeHash, err := buildTreeRecursive(partial, ".", gitlinks, cache, writeTreeObject)
+	if err != nil {
+		return nil, err
+	}
+
+	commitHash, err := writeCommitObject(treeHash, parents, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := compareAndSwapRef(head, refHash, commitHash); err != nil {
+		return nil, err
+	}
+
+	return commitHash, nil
+}
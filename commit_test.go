@@ -0,0 +1,93 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunCommit(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	hash, err := createObject([]byte("dry run content"))
+	if err != nil {
+		t.Fatalf("error creating object: %v", err)
+	}
+	if err := writeIndex(t.Context(), map[string][]byte{"dir/file.txt": hash}); err != nil {
+		t.Fatalf("error writing index: %v", err)
+	}
+
+	// without an identity the commit would be refused
+	report, err := dryRunCommit(t.Context(), "message")
+	assert.NoError(t, err)
+	assert.Contains(t, report.problems, "user.email is not set")
+	assert.False(t, objectExists(report.treeHash), "dry run must not write tree objects")
+
+	if err := updateConfig("email", "dry@example.com"); err != nil {
+		t.Fatalf("Failed to set config: %v", err)
+	}
+
+	report, err = dryRunCommit(t.Context(), "message")
+	assert.NoError(t, err)
+	assert.Empty(t, report.problems)
+	assert.Len(t, report.changes, 1)
+
+	// the reported tree matches the one a real commit writes
+	commitHash, err := createCommit(t.Context(), "message")
+	assert.NoError(t, err)
+
+	treeHash, err := resolveTreeHash(commitHash)
+	assert.NoError(t, err)
+	assert.Equal(t, report.treeHash, treeHash)
+
+	report, err = dryRunCommit(t.Context(), "  ")
+	assert.NoError(t, err)
+	assert.Contains(t, report.problems, "commit message is empty")
+}
+
+func TestPartialCommit(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "partial@example.com"); err != nil {
+		t.Fatalf("Failed to set config: %v", err)
+	}
+
+	oldHash, err := createObject([]byte("old"))
+	assert.NoError(t, err)
+	assert.NoError(t, writeIndex(t.Context(), map[string][]byte{"a.txt": oldHash, "dir/b.txt": oldHash, "gone.txt": oldHash}))
+	_, err = createCommit(t.Context(), "initial")
+	assert.NoError(t, err)
+
+	// stage changes to every path, then commit only dir/ and the deletion
+	newHash, err := createObject([]byte("new"))
+	assert.NoError(t, err)
+	staged := map[string][]byte{"a.txt": newHash, "dir/b.txt": newHash}
+	assert.NoError(t, writeIndex(t.Context(), staged))
+
+	partial, err := partialCommitIndex(t.Context(), []string{"dir", "gone.txt"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"a.txt": oldHash, "dir/b.txt": newHash}, partial)
+
+	commitHash, err := createPartialCommit(t.Context(), "partial", partial, []string{"dir", "gone.txt"})
+	assert.NoError(t, err)
+
+	committed, err := commitIndex(t.Context(), commitHash)
+	assert.NoError(t, err)
+	assert.Equal(t, partial, committed)
+
+	// the other staged change is still waiting in the index
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, staged, index)
+
+	_, err = partialCommitIndex(t.Context(), []string{"missing"}, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,306 @@
+package mygit
+
+import (
+	"container/heap"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const commitGraphHeader = "# commit-graph"
+
+// commitGraphPath returns the path of the commit-graph file.
+func commitGraphPath() string {
+	return fmt.Sprintf("%s/commit-graph", commonDir)
+}
+
+// commitGraph caches the parents and generation number of commits, so
+// history walks need not read and inflate every commit object. A commit's
+// generation is one more than the largest generation of its parents (root
+// commits have generation 1), so a commit is always processed before its
+// ancestors when walking in decreasing generation order.
+//
+// The file written by gc holds one "<hex id> <generation> <parent>..." line
+// per commit. Commits created since then are read from the object store
+// and added to the in-memory graph as they are met.
+type commitGraph struct {
+	parents     map[string][][]byte
+	generations map[string]int
+}
+
+// loadCommitGraph reads the commit-graph file. A missing file yields an
+// empty graph.
+func loadCommitGraph() (*commitGraph, error) {
+	graph := &commitGraph{parents: make(map[string][][]byte), generations: make(map[string]int)}
+
+	content, err := os.ReadFile(commitGraphPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return graph, nil
+		}
+		return nil, fmt.Errorf("error reading commit-graph: %w", err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("malformed commit-graph line: %q", line)
+		}
+
+		generation, err := strconv.Atoi(fields[1])
+		if err != nil || generation < 1 {
+			return nil, fmt.Errorf("malformed commit-graph line: %q", line)
+		}
+
+		var parents [][]byte
+		for _, parentHex := range fields[2:] {
+			parent, err := hex.DecodeString(parentHex)
+			if err != nil {
+				return nil, fmt.Errorf("malformed commit-graph line: %q", line)
+			}
+			parents = append(parents, parent)
+		}
+
+		graph.parents[fields[0]] = parents
+		graph.generations[fields[0]] = generation
+	}
+
+	return graph, nil
+}
+
+// parentsOf returns the parents of a commit.
+func (g *commitGraph) parentsOf(ctx context.Context, hash []byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hexHash := hex.EncodeToString(hash)
+	if parents, ok := g.parents[hexHash]; ok {
+		return parents, nil
+	}
+
+	commit, err := readCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	g.parents[hexHash] = commit.parents
+
+	return commit.parents, nil
+}
+
+// generation returns the generation number of a commit, computing it for
+// commits the graph does not know from their parents.
+func (g *commitGraph) generation(ctx context.Context, hash []byte) (int, error) {
+	pending := [][]byte{hash}
+
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		hexHash := hex.EncodeToString(current)
+		if _, ok := g.generations[hexHash]; ok {
+			pending = pending[:len(pending)-1]
+			continue
+		}
+
+		parents, err := g.parentsOf(ctx, current)
+		if err != nil {
+			return 0, err
+		}
+
+		// parents first; the commit is revisited once they are known
+		generation, ready := 1, true
+		for _, parent := range parents {
+			parentGeneration, ok := g.generations[hex.EncodeToString(parent)]
+			if !ok {
+				pending = append(pending, parent)
+				ready = false
+				continue
+			}
+			generation = max(generation, parentGeneration+1)
+		}
+
+		if ready {
+			g.generations[hexHash] = generation
+			pending = pending[:len(pending)-1]
+		}
+	}
+
+	return g.generations[hex.EncodeToString(hash)], nil
+}
+
+// writeCommitGraph records every commit reachable from the refs, HEAD, and
+// in-progress merges in the commit-graph file and returns how many
+// commits it holds. It stops between refs once ctx is done.
+func writeCommitGraph(ctx context.Context) (int, error) {
+	if err := checkVCSRepo(); err != nil {
+		return 0, err
+	}
+
+	roots, err := reachabilityRoots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// start from scratch, so commits that are gone are dropped
+	graph := &commitGraph{parents: make(map[string][][]byte), generations: make(map[string]int)}
+	for _, root := range roots {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if _, objType, _, err := readRawObject(root); err != nil {
+			return 0, err
+		} else if objType != "commit" {
+			continue // index entries are blobs
+		}
+
+		if _, err := graph.generation(ctx, root); err != nil {
+			return 0, err
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(commitGraphHeader + "\n")
+	for _, hexHash := range slices.Sorted(maps.Keys(graph.generations)) {
+		sb.WriteString(fmt.Sprintf("%s %d", hexHash, graph.generations[hexHash]))
+		for _, parent := range graph.parents[hexHash] {
+			sb.WriteString(fmt.Sprintf(" %x", parent))
+		}
+		sb.WriteString("\n")
+	}
+
+	lock, err := acquireLockFile(commitGraphPath())
+	if err != nil {
+		return 0, fmt.Errorf("error writing commit-graph: %w", err)
+	}
+	defer lock.release()
+
+	if _, err := lock.file.WriteString(sb.String()); err != nil {
+		return 0, fmt.Errorf("error writing commit-graph: %w", err)
+	}
+	if err := lock.commit(); err != nil {
+		return 0, fmt.Errorf("error writing commit-graph: %w", err)
+	}
+
+	return len(graph.generations), nil
+}
+
+// graphQueue is a max-heap of commits ordered by generation.
+type graphQueue struct {
+	hashes      [][]byte
+	generations []int
+}
+
+func (q *graphQueue) Len() int           { return len(q.hashes) }
+func (q *graphQueue) Less(i, j int) bool { return q.generations[i] > q.generations[j] }
+func (q *graphQueue) Swap(i, j int) {
+	q.hashes[i], q.hashes[j] = q.hashes[j], q.hashes[i]
+	q.generations[i], q.generations[j] = q.generations[j], q.generations[i]
+}
+func (q *graphQueue) Push(x any) {
+	entry := x.(graphQueueEntry)
+	q.hashes = append(q.hashes, entry.hash)
+	q.generations = append(q.generations, entry.generation)
+}
+func (q *graphQueue) Pop() any {
+	n := len(q.hashes) - 1
+	entry := graphQueueEntry{hash: q.hashes[n], generation: q.generations[n]}
+	q.hashes, q.generations = q.hashes[:n], q.generations[:n]
+	return entry
+}
+
+// graphQueueEntry is a commit waiting in a graphQueue.
+type graphQueueEntry struct {
+	hash       []byte
+	generation int
+}
+
+// aheadBehind returns how many commits are reachable from a but not from b
+// (ahead) and from b but not from a (behind). Commits are visited in
+// decreasing generation order, marked with the tips that reach them, and
+// the walk stops as soon as every queued commit is reachable from both, so
+// shared history below the fork point is never read.
+func aheadBehind(ctx context.Context, a, b []byte) (int, int, error) {
+	const (
+		fromA    = 1
+		fromB    = 2
+		fromBoth = fromA | fromB
+	)
+
+	graph, err := loadCommitGraph()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	colors := make(map[string]int)
+	queue := &graphQueue{}
+	unresolved := 0 // queued commits not yet known to be reachable from both
+
+	enqueue := func(hash []byte, color int) error {
+		hexHash := hex.EncodeToString(hash)
+		old, queued := colors[hexHash]
+		if old|color == old && queued {
+			return nil
+		}
+		colors[hexHash] = old | color
+
+		if !queued {
+			generation, err := graph.generation(ctx, hash)
+			if err != nil {
+				return err
+			}
+			heap.Push(queue, graphQueueEntry{hash: hash, generation: generation})
+			if old|color != fromBoth {
+				unresolved++
+			}
+		} else if old|color == fromBoth {
+			unresolved--
+		}
+
+		return nil
+	}
+
+	if err := enqueue(a, fromA); err != nil {
+		return 0, 0, err
+	}
+	if err := enqueue(b, fromB); err != nil {
+		return 0, 0, err
+	}
+
+	ahead, behind := 0, 0
+	for queue.Len() > 0 && unresolved > 0 {
+		entry := heap.Pop(queue).(graphQueueEntry)
+		color := colors[hex.EncodeToString(entry.hash)]
+
+		// every child has been popped already, so the color is final
+		switch color {
+		case fromA:
+			ahead++
+			unresolved--
+		case fromB:
+			behind++
+			unresolved--
+		}
+
+		parents, err := graph.parentsOf(ctx, entry.hash)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, parent := range parents {
+			if err := enqueue(parent, color); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	return ahead, behind, nil
+}
@@ -0,0 +1,81 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAheadBehind(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "graph@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	treeHash, err := buildTreeObject(map[string][]byte{})
+	assert.NoError(t, err)
+	commit := func(message string, parents ...[]byte) []byte {
+		hash, err := writeCommitObject(treeHash, parents, message)
+		assert.NoError(t, err)
+		return hash
+	}
+
+	// root - a1 - a2 ------- merge - a3     (main)
+	//          \            /
+	//           b1 - b2 - b3 - b4           (topic)
+	root := commit("root")
+	a1 := commit("a1", root)
+	a2 := commit("a2", a1)
+	b1 := commit("b1", a1)
+	b2 := commit("b2", b1)
+	b3 := commit("b3", b2)
+	merge := commit("merge", a2, b3)
+	a3 := commit("a3", merge)
+	b4 := commit("b4", b3)
+	assert.NoError(t, updateRef("refs/heads/main", a3))
+	assert.NoError(t, updateRef("refs/heads/topic", b4))
+
+	check := func() {
+		ahead, behind, err := aheadBehind(t.Context(), a3, b4)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, ahead) // a2, merge, a3
+		assert.Equal(t, 1, behind)
+
+		ahead, behind, err = aheadBehind(t.Context(), b2, a2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, ahead)
+		assert.Equal(t, 1, behind)
+
+		ahead, behind, err = aheadBehind(t.Context(), root, root)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, ahead)
+		assert.Equal(t, 0, behind)
+	}
+
+	// without a commit-graph generations are computed from the objects
+	check()
+
+	count, err := writeCommitGraph(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 9, count)
+
+	graph, err := loadCommitGraph()
+	assert.NoError(t, err)
+	generation, err := graph.generation(t.Context(), a3)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, generation) // root, a1, b1, b2, b3, merge, a3
+	check()
+
+	// commits newer than the graph are still counted
+	a4 := commit("a4", a3)
+	ahead, behind, err := aheadBehind(t.Context(), a4, b4)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, ahead)
+	assert.Equal(t, 1, behind)
+}
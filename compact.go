@@ -0,0 +1,344 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCompactGrace = 14 * 24 * time.Hour // unreachable objects younger than this are kept
+)
+
+// compactReport describes what compactRepository removed (or would remove).
+type compactReport struct {
+	staleEntries   []string // index paths whose objects no longer exist
+	staleTrees     []string // cache-tree directories whose trees no longer exist
+	prunedObjects  []string // hex ids of unreachable objects removed
+	reclaimedBytes int64
+	encrypted      int // plaintext objects rewritten encrypted
+	tempFiles      int // temporary object files left behind by interrupted writes
+}
+
+// compactRepository drops stale index entries and removes every loose object
+// that is not reachable from a ref, HEAD, an in-progress merge, or the index
+// and whose file is older than grace. When object encryption is enabled the
+// remaining plaintext objects are encrypted. With dryRun nothing is changed.
+// Once ctx is done it stops before the next object.
+func compactRepository(ctx context.Context, grace time.Duration, dryRun bool) (compactReport, error) {
+	if err := checkVCSRepo(); err != nil {
+		return compactReport{}, err
+	}
+
+	var report compactReport
+
+	// rewrite the index without entries pointing at missing objects
+	index, err := readIndex(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	cache, err := readCacheTree()
+	if err != nil {
+		return report, err
+	}
+
+	// submodule commits live in the submodule's own object store
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return report, err
+	}
+
+	compacted := maps.Clone(index)
+	for path, hash := range index {
+		if !gitlinks[path] && !objectExists(hash) {
+			delete(compacted, path)
+			report.staleEntries = append(report.staleEntries, path)
+		}
+	}
+
+	for dir, hash := range cache {
+		if !objectExists(hash) {
+			delete(cache, dir)
+			report.staleTrees = append(report.staleTrees, dir)
+		}
+	}
+
+	if !dryRun && (len(report.staleEntries) > 0 || len(report.staleTrees) > 0) {
+		invalidateCacheTree(cache, diffIndexes(index, compacted))
+		if err := writeIndexFile(compacted, cache); err != nil {
+			return report, err
+		}
+	}
+
+	roots, err := reachabilityRoots(ctx)
+	if err != nil {
+		return report, err
+	}
+	for path, hash := range compacted {
+		if !gitlinks[path] {
+			roots = append(roots, hash)
+		}
+	}
+	for _, hash := range cache {
+		roots = append(roots, hash)
+	}
+
+	reachable, err := reachableObjects(roots)
+	if err != nil {
+		return report, err
+	}
+
+	cutoff := time.Now().Add(-grace)
+	objectsDir := fmt.Sprintf("%s/objects", commonDir)
+
+	err = filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(objectsDir, path)
+		if err != nil {
+			return err
+		}
+
+		hexHash := strings.ReplaceAll(filepath.ToSlash(rel), "/", "")
+		temp, _ := filepath.Match(tempObjectPattern, d.Name())
+		if _, ok := reachable[hexHash]; ok || (!isHex(hexHash) && !temp) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			return nil // still within the grace period
+		}
+
+		// a temporary file this old belongs to a write that never finished
+		if temp {
+			if !dryRun {
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("error removing temporary file %s: %w", d.Name(), err)
+				}
+			}
+			report.tempFiles++
+			report.reclaimedBytes += info.Size()
+			return nil
+		}
+
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("error removing object %s: %w", hexHash, err)
+			}
+			os.Remove(filepath.Dir(path)) // only succeeds once the fan-out directory is empty
+		}
+
+		report.prunedObjects = append(report.prunedObjects, hexHash)
+		report.reclaimedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("error compacting objects: %w", err)
+	}
+
+	// objects written before encryption was enabled are encrypted now
+	report.encrypted, err = encryptLooseObjects(ctx, dryRun)
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// reachabilityRoots returns the commits referenced by refs (loose and
+// packed), HEAD, MERGE_HEAD, a paused merge train or am session, and the
+// index and merge state of other worktrees.
+func reachabilityRoots(ctx context.Context) ([][]byte, error) {
+	var roots [][]byte
+
+	refsDir := fmt.Sprintf("%s/refs", commonDir)
+	locksDir := filepath.Join(refsDir, "locks")
+
+	err := filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == locksDir {
+				return filepath.SkipDir // locks hold owners, not object ids
+			}
+			return nil
+		}
+		if isLockFileName(d.Name()) {
+			return nil // ref update in progress
+		}
+
+		rel, err := filepath.Rel(commonDir, path)
+		if err != nil {
+			return err
+		}
+
+		hash, err := getRef(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		if hash != nil {
+			roots = append(roots, hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading refs: %w", err)
+	}
+
+	packed, err := readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range packed {
+		roots = append(roots, hash)
+	}
+
+	mergeHead, err := readMergeHeadIn(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	if mergeHead != nil {
+		roots = append(roots, mergeHead)
+	}
+
+	// other worktrees keep their own index and merge state
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	absGitDir, err := filepath.Abs(gitDir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving repository directory: %w", err)
+	}
+
+	for _, worktree := range worktrees {
+		if worktree.metaDir == absGitDir {
+			continue
+		}
+
+		index, err := readIndexFile(ctx, filepath.Join(worktree.metaDir, "index"))
+		if err != nil {
+			return nil, err
+		}
+		if index, err = withoutGitlinks(index); err != nil {
+			return nil, err
+		}
+		for _, hash := range index {
+			roots = append(roots, hash)
+		}
+
+		mergeHead, err := readMergeHeadIn(worktree.metaDir)
+		if err != nil {
+			return nil, err
+		}
+		if mergeHead != nil {
+			roots = append(roots, mergeHead)
+		}
+	}
+
+	if yes, err := isMergeTrainInProgress(); err != nil {
+		return nil, err
+	} else if yes {
+		state, err := readMergeTrainState()
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, state.origHead)
+	}
+
+	if yes, err := isAmInProgress(); err != nil {
+		return nil, err
+	} else if yes {
+		state, err := readAmState()
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, state.origHead)
+	}
+
+	return roots, nil
+}
+
+// readMergeHeadIn returns the commit recorded in metaDir's MERGE_HEAD, or
+// nil if no merge is in progress there.
+func readMergeHeadIn(metaDir string) ([]byte, error) {
+	mergeHead, err := os.ReadFile(filepath.Join(metaDir, "MERGE_HEAD"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading MERGE_HEAD: %w", err)
+	}
+
+	hash, err := hex.DecodeString(strings.TrimSpace(string(mergeHead)))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding MERGE_HEAD: %w", err)
+	}
+
+	return hash, nil
+}
+
+// reachableObjects returns the hex ids of every object reachable from roots.
+// A missing object is an error, since pruning with an incomplete picture
+// could delete objects that are still needed.
+func reachableObjects(roots [][]byte) (map[string]struct{}, error) {
+	reachable := make(map[string]struct{})
+	pending := slices.Clone(roots) // the walk must not overwrite the caller's roots
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		hexHash := hex.EncodeToString(hash)
+		if _, ok := reachable[hexHash]; ok {
+			continue
+		}
+		reachable[hexHash] = struct{}{}
+
+		obj, err := catFile(hash)
+		if err != nil {
+			return nil, fmt.Errorf("error reading reachable object %s: %w", hexHash, err)
+		}
+
+		switch obj := obj.(type) {
+		case commitObject:
+			pending = append(pending, obj.hash)
+			pending = append(pending, obj.parents...)
+		case treeObject:
+			for _, entry := range obj.entries {
+				if entry.objType != "commit" { // submodule commits are not ours
+					pending = append(pending, entry.hash)
+				}
+			}
+		}
+	}
+
+	return reachable, nil
+}
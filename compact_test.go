@@ -0,0 +1,103 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactRepository(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "compact@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	// a committed blob reachable from main
+	keptHash, err := createObject([]byte("kept"))
+	assert.NoError(t, err)
+	index := map[string][]byte{"kept.txt": keptHash}
+	treeHash, err := buildTreeObject(index)
+	assert.NoError(t, err)
+	commitHash, err := writeCommitObject(treeHash, nil, "initial")
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef("refs/heads/main", commitHash))
+
+	// an orphaned blob and an index entry whose object is gone
+	orphanHash, err := createObject([]byte("orphan"))
+	assert.NoError(t, err)
+	index["missing.txt"] = hashObject([]byte("never stored"))
+	assert.NoError(t, writeIndex(t.Context(), index))
+
+	// the orphan is protected by the grace period
+	report, err := compactRepository(t.Context(), time.Hour, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing.txt"}, report.staleEntries)
+	assert.Empty(t, report.prunedObjects)
+	assert.True(t, objectExists(orphanHash))
+
+	// a dry run reports without deleting
+	report, err = compactRepository(t.Context(), 0, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("%x", orphanHash)}, report.prunedObjects)
+	assert.Positive(t, report.reclaimedBytes)
+	assert.True(t, objectExists(orphanHash))
+
+	report, err = compactRepository(t.Context(), 0, false)
+	assert.NoError(t, err)
+	assert.Len(t, report.prunedObjects, 1)
+	assert.False(t, objectExists(orphanHash))
+	assert.True(t, objectExists(keptHash))
+	assert.True(t, objectExists(commitHash))
+
+	index, err = readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"kept.txt": keptHash}, index)
+}
+
+func TestObjectWritesLeaveNoPartialFiles(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("fsyncObjectFiles", "true"))
+
+		hash, err := createObject([]byte("durable"))
+		assert.NoError(t, err)
+		objectsDir := fmt.Sprintf("%s/objects", commonDir)
+		temps, err := filepath.Glob(filepath.Join(objectsDir, tempObjectPattern))
+		assert.NoError(t, err)
+		assert.Empty(t, temps)
+
+		// an object that is already stored is not written again
+		objectPath := fmt.Sprintf("%s/%x/%x", objectsDir, hash[:1], hash[1:])
+		assert.NoError(t, os.WriteFile(objectPath, []byte("marker"), 0644))
+		_, err = createObject([]byte("durable"))
+		assert.NoError(t, err)
+		content, err := os.ReadFile(objectPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "marker", string(content))
+		assert.NoError(t, os.Remove(objectPath))
+
+		// files of interrupted writes are removed once past the grace period
+		abandoned := filepath.Join(objectsDir, "tmp-object-abandoned")
+		recent := filepath.Join(objectsDir, "tmp-object-recent")
+		assert.NoError(t, os.WriteFile(abandoned, []byte("partial"), 0644))
+		assert.NoError(t, os.WriteFile(recent, []byte("partial"), 0644))
+		old := time.Now().Add(-2 * time.Hour)
+		assert.NoError(t, os.Chtimes(abandoned, old, old))
+
+		report, err := compactRepository(t.Context(), time.Hour, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, report.tempFiles)
+		assert.NoFileExists(t, abandoned)
+		assert.FileExists(t, recent)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,208 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// completeCommand is the hidden command the completion scripts run to get
+// the candidates for the word under the cursor.
+const completeCommand = "__complete"
+
+// completionKind is what the non-flag arguments of a command are.
+type completionKind int
+
+const (
+	completeFiles        completionKind = iota // left to the shell
+	completeRevisions                          // branches and tags
+	completeTrackedPaths                       // paths in the index
+	completeShells                             // the shells completion supports
+	completeCommands                           // the command names
+)
+
+// completionGlobalOptions are the global options completed before the
+// command name.
+var completionGlobalOptions = []string{"-C", "--git-dir=", "--work-tree=", "--json", "--color", "--no-pager", "--porcelain-errors", "--quiet", "--help"}
+
+// completionShells are the shells completion writes scripts for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionCandidates returns the candidates for the last of words, the
+// command line after the program name, in the order the shell shows them.
+// The other words say what is being completed: a global option or the
+// command name, a flag of the command, a subcommand, or an argument.
+func completionCandidates(ctx context.Context, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	prefix := words[len(words)-1]
+
+	// skip the global options before the command name
+	before := words[:len(words)-1]
+	for len(before) > 0 && strings.HasPrefix(before[0], "-") {
+		if before[0] == "-C" || before[0] == "--git-dir" || before[0] == "--work-tree" {
+			before = before[1:]
+		}
+		before = before[1:]
+	}
+
+	if len(before) == 0 {
+		if strings.HasPrefix(prefix, "-") {
+			return matchingCandidates(completionGlobalOptions, prefix)
+		}
+		return matchingCandidates(completionCommandNames(), prefix)
+	}
+
+	info, ok := lookupCommand(before[0])
+	if !ok || info.hidden {
+		return nil
+	}
+	if strings.HasPrefix(prefix, "-") {
+		return matchingCandidates(info.flags, prefix)
+	}
+
+	hasSubcommand := slices.ContainsFunc(before[1:], func(word string) bool { return !strings.HasPrefix(word, "-") })
+	if len(info.subcommands) > 0 && !hasSubcommand {
+		return matchingCandidates(info.subcommands, prefix)
+	}
+
+	switch info.args {
+	case completeRevisions:
+		return matchingCandidates(completionRevisions(ctx), prefix)
+	case completeTrackedPaths:
+		return matchingCandidates(completionTrackedPaths(ctx), prefix)
+	case completeShells:
+		return matchingCandidates(completionShells, prefix)
+	case completeCommands:
+		return matchingCandidates(completionCommandNames(), prefix)
+	}
+
+	return nil // the shell completes file names
+}
+
+// completionCommandNames returns the names of the commands that are not
+// hidden, sorted.
+func completionCommandNames() []string {
+	var names []string
+	for _, info := range commands {
+		if !info.hidden {
+			names = append(names, info.name)
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// matchingCandidates returns the candidates starting with prefix.
+func matchingCandidates(candidates []string, prefix string) []string {
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	return matches
+}
+
+// completionRevisions returns HEAD and the names of the branches and tags,
+// or nothing outside a repository.
+func completionRevisions(ctx context.Context) []string {
+	if checkVCSRepo() != nil {
+		return nil
+	}
+	refs, err := collectRefs(ctx, []string{"refs/heads", "refs/tags"}, nil)
+	if err != nil {
+		return nil
+	}
+
+	names := []string{"HEAD"}
+	for _, ref := range refs {
+		names = append(names, shortRefName(ref.refPath))
+	}
+
+	return names
+}
+
+// completionTrackedPaths returns the paths in the index relative to the
+// directory the command was started from, or nothing outside a repository.
+func completionTrackedPaths(ctx context.Context) []string {
+	if checkVCSRepo() != nil {
+		return nil
+	}
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, indexPath := range slices.Sorted(maps.Keys(index)) {
+		if !isSparseDirEntry(indexPath) {
+			paths = append(paths, displayPath(indexPath))
+		}
+	}
+
+	return paths
+}
+
+// completionScript returns the completion script for shell. Each script
+// asks the hidden __complete command for candidates and falls back to file
+// names when there are none.
+func completionScript(shell string) (string, error) {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return "", fmt.Errorf("unsupported shell %q: expected bash, zsh, or fish", shell)
+	}
+
+	return strings.NewReplacer("@NAME@", vcsName, "@COMPLETE@", completeCommand).Replace(script), nil
+}
+
+const bashCompletion = `# bash completion for @NAME@; load with: source <(@NAME@ completion bash)
+_@NAME@() {
+	local IFS=$'\n'
+	COMPREPLY=($(@NAME@ @COMPLETE@ "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _@NAME@ @NAME@
+`
+
+const zshCompletion = `#compdef @NAME@
+# zsh completion for @NAME@; load with: source <(@NAME@ completion zsh)
+_@NAME@() {
+	local -a candidates
+	candidates=("${(@f)$(@NAME@ @COMPLETE@ "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+if [[ $funcstack[1] == _@NAME@ ]]; then
+	_@NAME@ "$@"
+else
+	compdef _@NAME@ @NAME@
+fi
+`
+
+const fishCompletion = `# fish completion for @NAME@; load with: @NAME@ completion fish | source
+function __@NAME@_complete
+	set -l words (commandline -opc)
+	set -l candidates (@NAME@ @COMPLETE@ $words[2..-1] (commandline -ct) 2>/dev/null)
+	if set -q candidates[1]
+		printf '%s\n' $candidates
+	else
+		__fish_complete_path (commandline -ct)
+	end
+end
+complete -c @NAME@ -f -a '(__@NAME@_complete)'
+`
@@ -0,0 +1,45 @@
+package mygit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletion(t *testing.T) {
+	assert.Equal(t, []string{"check-attr", "check-ignore", "checkout"}, completionCandidates(t.Context(), []string{"che"}))
+	assert.Equal(t, []string{"--no-pager"}, completionCandidates(t.Context(), []string{"--no"}))
+	assert.Equal(t, []string{"--soft"}, completionCandidates(t.Context(), []string{"--git-dir", "x", "reset", "--s"}))
+	assert.Equal(t, []string{"--soft"}, completionCandidates(t.Context(), []string{"-C", "sub", "reset", "--s"}))
+	assert.Equal(t, []string{"set"}, completionCandidates(t.Context(), []string{"sparse-checkout", "s"}))
+	assert.Equal(t, []string{"zsh"}, completionCandidates(t.Context(), []string{"completion", "z"}))
+	assert.Empty(t, completionCandidates(t.Context(), []string{"no-such-command", ""}))
+
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, os.WriteFile("a.txt", []byte("a\n"), 0644))
+		assert.NoError(t, os.WriteFile("b.txt", []byte("b\n"), 0644))
+		_, _, err := addPaths(t.Context(), []string{"a.txt", "b.txt"}, addOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, updateConfig("email", "completion@example.com"))
+		commitHash, err := createCommit(t.Context(), "first")
+		assert.NoError(t, err)
+		assert.NoError(t, createBranch("feature", commitHash))
+
+		assert.Equal(t, []string{"a.txt"}, completionCandidates(t.Context(), []string{"rm", "a"}))
+		assert.Equal(t, []string{"feature"}, completionCandidates(t.Context(), []string{"checkout", "f"}))
+		// only the first argument is a subcommand
+		assert.Equal(t, []string{"HEAD"}, completionCandidates(t.Context(), []string{"bisect", "good", "H"}))
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for _, shell := range completionShells {
+		script, err := completionScript(shell)
+		assert.NoError(t, err)
+		assert.Contains(t, script, vcsName+" "+completeCommand)
+	}
+	_, err = completionScript("tcsh")
+	assert.EqualError(t, err, `unsupported shell "tcsh": expected bash, zsh, or fish`)
+}
@@ -0,0 +1,192 @@
+package mygit
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// conflictStagePrefix marks the index lines that hold the versions of a
+// path left in conflict by a merge: "|STAGE|<path>|<stage>|<hash>".
+const conflictStagePrefix = "|STAGE|"
+
+// The stages of a conflicted path, numbered as in git. Stage 0 is the
+// ordinary entry of a path that is not in conflict.
+const (
+	stageBase   = 1 // the version in the merge base
+	stageOurs   = 2 // the version in HEAD
+	stageTheirs = 3 // the version in the merged branch
+)
+
+// conflictStages maps the stage numbers of a conflicted path to the blob
+// each side has. A side without the path has no stage.
+type conflictStages map[int][]byte
+
+// newConflictStages returns the stages of a path from the hashes the base,
+// our, and their side have for it, leaving out the nil ones.
+func newConflictStages(base, ours, theirs []byte) conflictStages {
+	stages := make(conflictStages)
+	if base != nil {
+		stages[stageBase] = base
+	}
+	if ours != nil {
+		stages[stageOurs] = ours
+	}
+	if theirs != nil {
+		stages[stageTheirs] = theirs
+	}
+
+	return stages
+}
+
+// readConflictStages reads the conflict stages of the index, by path.
+func readConflictStages() (map[string]conflictStages, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	stages := make(map[string]conflictStages)
+
+	f, err := os.Open(fmt.Sprintf("%s/index", gitDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stages, nil
+		}
+		return nil, fmt.Errorf("error opening index file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry, ok := strings.CutPrefix(scanner.Text(), conflictStagePrefix)
+		if !ok {
+			continue
+		}
+
+		parts := strings.Split(entry, "|")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid conflict stage entry: %s", scanner.Text())
+		}
+
+		stage, err := strconv.Atoi(parts[1])
+		if err != nil || stage < stageBase || stage > stageTheirs {
+			return nil, fmt.Errorf("invalid conflict stage entry: %s", scanner.Text())
+		}
+
+		hash, err := hex.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("error decoding conflict stage hash for %s: %w", parts[0], err)
+		}
+
+		if stages[parts[0]] == nil {
+			stages[parts[0]] = make(conflictStages)
+		}
+		stages[parts[0]][stage] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning index file: %w", err)
+	}
+
+	return stages, nil
+}
+
+// setConflictStages replaces the conflict stages of the index, keeping its
+// entries and cache-tree as they are.
+func setConflictStages(stages map[string]conflictStages) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	return withIndexLock(func() error {
+		index, err := parseIndexFile(fmt.Sprintf("%s/index", gitDir))
+		if err != nil {
+			return err
+		}
+
+		cache, err := readCacheTree()
+		if err != nil {
+			cache = nil
+		}
+
+		return writeIndexEntries(index, cache, stages)
+	})
+}
+
+// writeConflictStages writes the stage lines, sorted by path and stage.
+func writeConflictStages(w *bufio.Writer, stages map[string]conflictStages) error {
+	for _, filePath := range slices.Sorted(maps.Keys(stages)) {
+		for _, stage := range slices.Sorted(maps.Keys(stages[filePath])) {
+			_, err := fmt.Fprintf(w, "%s%s|%d|%x\n", conflictStagePrefix, filePath, stage, stages[filePath][stage])
+			if err != nil {
+				return fmt.Errorf("error writing to index file: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// stagedVersion returns the blob a conflicted path has in the given stage.
+func stagedVersion(stages map[string]conflictStages, filePath string, stage int) ([]byte, error) {
+	pathStages, ok := stages[filePath]
+	if !ok {
+		return nil, fmt.Errorf("path %s is not in conflict", displayPath(filePath))
+	}
+
+	hash, ok := pathStages[stage]
+	if !ok {
+		side := map[int]string{stageBase: "a base", stageOurs: "our", stageTheirs: "their"}[stage]
+		return nil, fmt.Errorf("path %s does not have %s version", displayPath(filePath), side)
+	}
+
+	return hash, nil
+}
+
+// checkoutStage writes the version of each conflicted path in the given
+// stage to the working tree, leaving the conflict unresolved.
+func checkoutStage(ctx context.Context, paths []string, stage int) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	stages, err := readConflictStages()
+	if err != nil {
+		return err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return err
+	}
+
+	// look every path up first, so nothing is written unless all have it
+	hashes := make([][]byte, len(paths))
+	for i, filePath := range paths {
+		if hashes[i], err = stagedVersion(stages, filePath, stage); err != nil {
+			return err
+		}
+	}
+
+	for i, filePath := range paths {
+		obj, err := catFile(hashes[i])
+		if err != nil {
+			return err
+		}
+		blob, ok := obj.(blobObject)
+		if !ok {
+			return fmt.Errorf("object %x is not a blob", hashes[i])
+		}
+
+		if err := conv.writeWorkTreeFile(ctx, filePath, filePath, blob.content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package mygit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConflictStages(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		base, err := createObject([]byte("base\n"))
+		assert.NoError(t, err)
+		ours, err := createObject([]byte("ours\n"))
+		assert.NoError(t, err)
+		theirs, err := createObject([]byte("theirs\n"))
+		assert.NoError(t, err)
+
+		index := map[string][]byte{"a.txt": base, "z.txt": base}
+		assert.NoError(t, writeIndexFile(index, nil))
+		stages := map[string]conflictStages{
+			"both.txt":    newConflictStages(base, ours, theirs),
+			"deleted.txt": newConflictStages(base, ours, nil),
+		}
+		assert.NoError(t, setConflictStages(stages))
+
+		read, err := readConflictStages()
+		assert.NoError(t, err)
+		assert.Equal(t, stages, read)
+
+		// stage lines leave the entries readable, and searchable in place
+		entries, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, index, entries)
+		hash, ok, err := lookupIndexEntry(t.Context(), "z.txt")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, base, hash)
+
+		assert.NoError(t, checkoutStage(t.Context(), []string{"both.txt"}, stageTheirs))
+		content, err := os.ReadFile("both.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "theirs\n", string(content))
+		assert.EqualError(t, checkoutStage(t.Context(), []string{"deleted.txt"}, stageTheirs), "path deleted.txt does not have their version")
+		assert.EqualError(t, checkoutStage(t.Context(), []string{"a.txt"}, stageOurs), "path a.txt is not in conflict")
+
+		// staging a path resolves it, and so does removing it
+		index["both.txt"] = theirs
+		assert.NoError(t, writeIndex(t.Context(), index))
+		read, err = readConflictStages()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]conflictStages{"deleted.txt": stages["deleted.txt"]}, read)
+
+		removed, err := removeTrackedPaths(t.Context(), []string{"deleted.txt"}, true, false)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"deleted.txt"}, removed)
+		read, err = readConflictStages()
+		assert.NoError(t, err)
+		assert.Empty(t, read)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
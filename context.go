@@ -0,0 +1,20 @@
+package mygit
+
+import (
+	"context"
+	"io"
+)
+
+// canceledReader is a reader that fails once ctx is done, so streaming a
+// large file stops part way.
+type canceledReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c canceledReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,214 @@
+package mygit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// contentConversion turns working tree content into what is stored in
+// blobs and back, as the attributes of each path and the config ask: a
+// clean or smudge filter runs, text gets its line endings converted, and
+// large files are kept in the large-file store behind a pointer blob.
+type contentConversion struct {
+	autocrlf           string // "true", "input", or "" when core.autocrlf is off
+	largeFileThreshold int64  // core.largeFileThreshold, 0 when off
+	attrs              attributeRules
+}
+
+// loadContentConversion reads the config and the attributes of the
+// working tree.
+func loadContentConversion() (contentConversion, error) {
+	attrs, err := loadAttributes()
+	if err != nil {
+		return contentConversion{}, err
+	}
+
+	return newContentConversion(attrs)
+}
+
+// loadTreeContentConversion is loadContentConversion for checking out the
+// root tree treeHash: the attributes are those of the tree's own
+// attributes file, if it has one, since the file in the working tree may
+// be about to be replaced.
+func loadTreeContentConversion(treeHash []byte) (contentConversion, error) {
+	attrs, err := loadTreeAttributes(treeHash)
+	if err != nil {
+		return contentConversion{}, err
+	}
+
+	return newContentConversion(attrs)
+}
+
+// newContentConversion returns the conversion the config and attrs ask
+// for.
+func newContentConversion(attrs attributeRules) (contentConversion, error) {
+	conv := contentConversion{attrs: attrs}
+
+	if value, err := getConfig("autocrlf"); err == nil {
+		switch strings.ToLower(value) {
+		case "true":
+			conv.autocrlf = "true"
+		case "input":
+			conv.autocrlf = "input"
+		}
+	}
+
+	if value, err := getConfig("largeFileThreshold"); err == nil {
+		if conv.largeFileThreshold, err = parseLargeFileThreshold(value); err != nil {
+			return conv, err
+		}
+	}
+
+	return conv, nil
+}
+
+// mayConvert reports whether the file at filePath could be changed on its
+// way into a blob by anything but the large-file store, before its
+// content is known.
+func (c contentConversion) mayConvert(filePath string) bool {
+	return c.mayConvertEOL(filePath) || c.attrs.get(filePath, "filter") != attrUnspecified
+}
+
+// toObject converts working tree content at filePath to what is stored in
+// its blob: the clean filter runs first, then text gets LF line endings,
+// and a large file becomes a pointer. With store set, the large file is
+// copied into the large-file store; otherwise only its pointer is computed.
+func (c contentConversion) toObject(ctx context.Context, filePath string, content []byte, store bool) ([]byte, error) {
+	content, err := c.runFilter(filePath, "clean", content)
+	if err != nil {
+		return nil, err
+	}
+	content = c.eolToObject(filePath, content)
+
+	if c.isLargeFile(filePath, int64(len(content))) {
+		return storeLargeFile(ctx, bytes.NewReader(content), store)
+	}
+
+	return content, nil
+}
+
+// toWorkTree converts blob content at filePath to what is written to the
+// working tree, undoing toObject: a pointer is replaced by its large file,
+// text gets the line endings of the working tree, then the smudge filter
+// runs.
+func (c contentConversion) toWorkTree(ctx context.Context, filePath string, content []byte) ([]byte, error) {
+	content, err := resolveLargeFile(ctx, filePath, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.runFilter(filePath, "smudge", c.eolToWorkTree(filePath, content))
+}
+
+// hashWorkTreeFile returns the blob hash of the converted content of the
+// file at filePath, storing the blob (and the large file) too if write is
+// set. Files that are only ever converted by the large-file store are
+// streamed, so they are never held in memory; the others are read into
+// memory.
+func (c contentConversion) hashWorkTreeFile(ctx context.Context, filePath string, write bool) ([]byte, error) {
+	if !c.mayConvert(filePath) {
+		return c.hashStreamedFile(ctx, filePath, write)
+	}
+
+	content, err := os.ReadFile(workTreePath(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", filePath, err)
+	}
+	if content, err = c.toObject(ctx, filePath, content, write); err != nil {
+		return nil, err
+	}
+
+	if write {
+		return createObject(content)
+	}
+	return hashObject(content), nil
+}
+
+// hashStreamedFile is hashWorkTreeFile for a file that is stored as it is,
+// or as a pointer if it is large.
+func (c contentConversion) hashStreamedFile(ctx context.Context, filePath string, write bool) ([]byte, error) {
+	info, err := os.Stat(workTreePath(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", filePath, err)
+	}
+	if !c.isLargeFile(filePath, info.Size()) {
+		if write {
+			return createObjectFromFile(ctx, filePath)
+		}
+		return hashFile(ctx, filePath)
+	}
+
+	f, err := os.Open(workTreePath(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	pointer, err := storeLargeFile(ctx, f, write)
+	if err != nil {
+		return nil, fmt.Errorf("error storing large file %s: %w", filePath, err)
+	}
+
+	if write {
+		return createObject(pointer)
+	}
+	return hashObject(pointer), nil
+}
+
+// hashWorkTreeContent returns the blob hash of working tree content at
+// filePath once converted, without storing anything.
+func (c contentConversion) hashWorkTreeContent(ctx context.Context, filePath string, content []byte) ([]byte, error) {
+	content, err := c.toObject(ctx, filePath, content, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return hashObject(content), nil
+}
+
+// writeWorkTreeFile writes blob content at filePath, converted for the
+// working tree, to diskPath. A large file that needs no other conversion
+// is copied straight from the large-file store.
+func (c contentConversion) writeWorkTreeFile(ctx context.Context, filePath, diskPath string, content []byte) error {
+	if oid, _, ok := parseLargeFilePointer(content); ok && !c.mayConvert(filePath) {
+		src, err := openLargeFile(ctx, oid)
+		if err == nil {
+			defer src.Close()
+			return copyToWorkTreeFile(ctx, diskPath, src)
+		}
+		// a missing large file is reported by toWorkTree below
+	}
+
+	content, err := c.toWorkTree(ctx, filePath, content)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(workTreePath(diskPath), content, workTreeFileMode); err != nil {
+		return fmt.Errorf("error writing file %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// copyToWorkTreeFile writes what r reads to the working tree file at
+// diskPath.
+func copyToWorkTreeFile(ctx context.Context, diskPath string, r io.Reader) error {
+	f, err := os.OpenFile(workTreePath(diskPath), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, workTreeFileMode)
+	if err != nil {
+		return fmt.Errorf("error writing file %s: %w", diskPath, err)
+	}
+
+	if _, err := io.Copy(f, canceledReader{ctx, r}); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing file %s: %w", diskPath, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing file %s: %w", diskPath, err)
+	}
+
+	return nil
+}
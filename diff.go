@@ -0,0 +1,652 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	diffContextLines = 3 // unchanged lines shown around each change
+)
+
+// diffLine represents a single line of an edit script.
+type diffLine struct {
+	kind byte // ' ' unchanged, '-' removed, '+' added
+	text string
+}
+
+// diffOptions are the ways a diff can be formatted differently from the
+// default.
+type diffOptions struct {
+	wordDiff  string // "plain" or "color" for a word diff, empty for lines
+	algorithm string // the diff algorithm, empty for the configured one
+}
+
+// fileChange represents a change to a single path between two indexes.
+type fileChange struct {
+	path       string
+	oldPath    string // renames: the path the file had before
+	status     byte   // 'A' added, 'M' modified, 'D' deleted, 'R' renamed
+	oldHash    []byte
+	newHash    []byte
+	similarity int // renames: how alike the old and new content are, in percent
+}
+
+// splitLines splits content into lines, keeping the trailing newline on
+// each line so that a missing newline at the end of the file compares different.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// myersDiff computes a shortest edit script between a and b using
+// Myers' O(ND) algorithm.
+func myersDiff(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	maxEdits := n + m
+	offset := maxEdits + 1
+	v := make([]int, 2*maxEdits+3)
+
+	// trace records v before each round so the path can be recovered
+	var trace [][]int
+
+search:
+	for d := 0; d <= maxEdits; d++ {
+		trace = append(trace, slices.Clone(v))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // move down (insertion)
+			} else {
+				x = v[offset+k-1] + 1 // move right (deletion)
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// backtrack from the end to build the edit script in reverse
+	var script []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			script = append(script, diffLine{kind: ' ', text: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				script = append(script, diffLine{kind: '+', text: b[y-1]})
+			} else {
+				script = append(script, diffLine{kind: '-', text: a[x-1]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	slices.Reverse(script)
+	return script
+}
+
+// unifiedHunks formats an edit script as unified diff hunks with the given
+// number of context lines.
+func unifiedHunks(script []diffLine, context int) string {
+	var sb strings.Builder
+
+	for _, r := range hunkRanges(script, context) {
+		sb.WriteString(formatHunk(script, r[0], r[1]))
+	}
+
+	return sb.String()
+}
+
+// hunkRanges returns the [start, end) ranges of the edit script that form
+// one hunk each: a run of changes with up to context unchanged lines
+// around it, merged with the next run when they are within 2*context lines.
+func hunkRanges(script []diffLine, context int) [][2]int {
+	var ranges [][2]int
+
+	i := 0
+	for i < len(script) {
+		// skip to next change
+		for i < len(script) && script[i].kind == ' ' {
+			i++
+		}
+		if i >= len(script) {
+			break
+		}
+
+		start := max(i-context, 0)
+
+		// extend while changes are within 2*context of each other
+		end := i
+		for j := i; j < len(script); j++ {
+			if script[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		end = min(end+context+1, len(script))
+
+		ranges = append(ranges, [2]int{start, end})
+		i = end
+	}
+
+	return ranges
+}
+
+// formatHunk formats script[start:end] as one unified diff hunk, with line
+// numbers counted from the beginning of the script.
+func formatHunk(script []diffLine, start, end int) string {
+	var sb strings.Builder
+
+	sb.WriteString(formatHunkHeader(script, start, end))
+	for _, line := range script[start:end] {
+		sb.WriteByte(line.kind)
+		sb.WriteString(line.text)
+		if !strings.HasSuffix(line.text, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// formatHunkHeader formats the "@@ -old +new @@" line of the hunk made of
+// script[start:end].
+func formatHunkHeader(script []diffLine, start, end int) string {
+	// compute line numbers at the start of the hunk
+	oldLine, newLine := 0, 0
+	for _, line := range script[:start] {
+		if line.kind != '+' {
+			oldLine++
+		}
+		if line.kind != '-' {
+			newLine++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, line := range script[start:end] {
+		if line.kind != '+' {
+			oldCount++
+		}
+		if line.kind != '-' {
+			newCount++
+		}
+	}
+
+	return fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+}
+
+// hunkRange formats the start,count part of a hunk header.
+func hunkRange(before, count int) string {
+	start := before + 1
+	if count == 0 {
+		start = before // empty ranges point at the line before
+	}
+
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffIndexes compares two indexes and returns the changed paths sorted by path.
+func diffIndexes(oldIndex, newIndex map[string][]byte) []fileChange {
+	var changes []fileChange
+
+	for path, oldHash := range oldIndex {
+		newHash, ok := newIndex[path]
+		switch {
+		case !ok:
+			changes = append(changes, fileChange{path: path, status: 'D', oldHash: oldHash})
+		case !slices.Equal(oldHash, newHash):
+			changes = append(changes, fileChange{path: path, status: 'M', oldHash: oldHash, newHash: newHash})
+		}
+	}
+
+	for path, newHash := range newIndex {
+		if _, ok := oldIndex[path]; !ok {
+			changes = append(changes, fileChange{path: path, status: 'A', newHash: newHash})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+
+	return changes
+}
+
+// formatFileDiff formats a git-style diff for a single changed path. A
+// binary path gets a line saying it differs instead of hunks.
+func formatFileDiff(change fileChange, oldContent, newContent []byte, binary bool, opts diffOptions) string {
+	var sb strings.Builder
+
+	oldPath := change.path
+	if change.status == 'R' {
+		oldPath = change.oldPath
+	}
+	sb.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", oldPath, change.path))
+
+	oldName := "a/" + oldPath
+	newName := "b/" + change.path
+	switch change.status {
+	case 'A':
+		sb.WriteString(fmt.Sprintf("new file mode %06o\n", entryTypeBlob))
+		oldName = "/dev/null"
+	case 'D':
+		sb.WriteString(fmt.Sprintf("deleted file mode %06o\n", entryTypeBlob))
+		newName = "/dev/null"
+	case 'R':
+		sb.WriteString(fmt.Sprintf("similarity index %d%%\n", change.similarity))
+		sb.WriteString(fmt.Sprintf("rename from %s\nrename to %s\n", change.oldPath, change.path))
+		if slices.Equal(change.oldHash, change.newHash) {
+			return sb.String() // renamed unchanged
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("index %s..%s\n", shortHash(change.oldHash), shortHash(change.newHash)))
+
+	if binary {
+		sb.WriteString(fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName))
+		return sb.String()
+	}
+
+	script := diffLines(splitLines(oldContent), splitLines(newContent), opts.algorithm)
+	hunks := unifiedHunks(script, diffContextLines)
+	if opts.wordDiff != "" {
+		hunks = wordDiffHunks(script, diffContextLines, opts.wordDiff == wordDiffColor)
+	}
+	if hunks == "" {
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("--- %s\n", oldName))
+	sb.WriteString(fmt.Sprintf("+++ %s\n", newName))
+	sb.WriteString(hunks)
+
+	return sb.String()
+}
+
+// isBinaryDiff reports whether a change to filePath is shown as a binary
+// one: always when its diff attribute is unset (as "binary" unsets it),
+// never when it is set, and otherwise when either side looks binary.
+func isBinaryDiff(attrs attributeRules, filePath string, oldContent, newContent []byte) bool {
+	switch attrs.get(filePath, "diff") {
+	case attrUnset:
+		return true
+	case attrSet:
+		return false
+	}
+
+	return looksBinary(oldContent) || looksBinary(newContent)
+}
+
+// formatIndexDiff formats the diff between two indexes, reading blob
+// content through readBlob. Binary paths are reported as differing, without
+// hunks.
+func formatIndexDiff(oldIndex, newIndex map[string][]byte, readBlob readBlobFunc) (string, error) {
+	return formatChanges(diffIndexes(oldIndex, newIndex), readBlob, diffOptions{})
+}
+
+// formatNameStatus lists the changed paths one per line: with status, a
+// status letter and a tab before each ("R<similarity>", the old path, and a
+// tab for a rename), else the paths alone.
+func formatNameStatus(changes []fileChange, status bool) string {
+	var sb strings.Builder
+
+	for _, change := range changes {
+		switch {
+		case !status:
+			sb.WriteString(change.path + "\n")
+		case change.status == 'R':
+			sb.WriteString(fmt.Sprintf("R%03d\t%s\t%s\n", change.similarity, change.oldPath, change.path))
+		default:
+			sb.WriteString(fmt.Sprintf("%c\t%s\n", change.status, change.path))
+		}
+	}
+
+	return sb.String()
+}
+
+// formatChanges formats the diff of the given changes, as formatIndexDiff
+// does, in the way opts asks for.
+func formatChanges(changes []fileChange, readBlob readBlobFunc, opts diffOptions) (string, error) {
+	attrs, err := loadAttributes()
+	if err != nil {
+		return "", err
+	}
+	if opts.algorithm == "" {
+		if opts.algorithm, err = configuredDiffAlgorithm(); err != nil {
+			return "", err
+		}
+	}
+
+	var sb strings.Builder
+
+	for _, change := range changes {
+		var oldContent, newContent []byte
+		var err error
+
+		if change.oldHash != nil {
+			if oldContent, err = readBlob(change.oldHash); err != nil {
+				return "", err
+			}
+		}
+
+		if change.newHash != nil {
+			if newContent, err = readBlob(change.newHash); err != nil {
+				return "", err
+			}
+		}
+
+		sb.WriteString(formatFileDiff(change, oldContent, newContent, isBinaryDiff(attrs, change.path, oldContent, newContent), opts))
+	}
+
+	return sb.String(), nil
+}
+
+// diffSides returns the two indexes the diff command compares, and the
+// reader for their blobs: with no revisions the index and the working
+// tree, with one that commit and the working tree, and with two the two
+// commits. With cached the index stands in for the working tree, and HEAD
+// for a missing revision.
+func diffSides(ctx context.Context, revs []string, cached bool) (map[string][]byte, map[string][]byte, readBlobFunc, error) {
+	var oldIndex, newIndex map[string][]byte
+	var err error
+
+	switch {
+	case len(revs) == 2:
+		if oldIndex, err = revisionIndex(ctx, revs[0]); err != nil {
+			return nil, nil, nil, err
+		}
+		if newIndex, err = revisionIndex(ctx, revs[1]); err != nil {
+			return nil, nil, nil, err
+		}
+		readBlob, err := gitlinkAwareReader(oldIndex, newIndex)
+		return oldIndex, newIndex, readBlob, err
+
+	case len(revs) == 1:
+		if oldIndex, err = revisionIndex(ctx, revs[0]); err != nil {
+			return nil, nil, nil, err
+		}
+	case cached:
+		if oldIndex, err = headCommitIndex(ctx); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if oldIndex == nil {
+		oldIndex = index
+	}
+
+	if cached {
+		readBlob, err := gitlinkAwareReader(oldIndex, index)
+		return oldIndex, index, readBlob, err
+	}
+
+	newIndex, readWorkTree, err := workTreeIndex(ctx, index)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	readBlob, err := gitlinkAwareReader(oldIndex, newIndex)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return oldIndex, newIndex, func(hash []byte) ([]byte, error) {
+		if content, ok := readWorkTree[hex.EncodeToString(hash)]; ok {
+			return content, nil
+		}
+		return readBlob(hash)
+	}, nil
+}
+
+// revisionIndex returns the flattened index of the tree a revision names.
+func revisionIndex(ctx context.Context, rev string) (map[string][]byte, error) {
+	hash, err := resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return commitIndex(ctx, hash)
+}
+
+// workTreeIndex returns index as the working tree has it, without the files
+// that are missing and with the blob hash of the converted content of those
+// that changed, and that content by hex hash. The content is not stored.
+func workTreeIndex(ctx context.Context, index map[string][]byte) (map[string][]byte, map[string][]byte, error) {
+	modifiedFiles, deletedFiles, err := compareIndexToWorkingTree(ctx, index)
+	if err != nil {
+		return nil, nil, err
+	}
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workTree := maps.Clone(index)
+	for _, path := range deletedFiles {
+		delete(workTree, path)
+	}
+
+	contents := make(map[string][]byte)
+	for _, path := range modifiedFiles {
+		if gitlinks[path] {
+			continue // a submodule's checkout is compared by its own diff
+		}
+
+		content, err := os.ReadFile(workTreePath(path))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading file %s: %w", path, err)
+		}
+		if content, err = conv.toObject(ctx, path, content, false); err != nil {
+			return nil, nil, err
+		}
+
+		hash := hashObject(content)
+		workTree[path] = hash
+		contents[hex.EncodeToString(hash)] = content
+	}
+
+	return workTree, contents, nil
+}
+
+// shortHash returns the abbreviated hex form of a hash, or zeros if nil.
+func shortHash(hash []byte) string {
+	if hash == nil {
+		return strings.Repeat("0", abbrevHashLen)
+	}
+
+	return abbrevHash(hash)
+}
+
+// fileStat counts the lines a change to one path adds and removes. A
+// renamed path has its old path too, and a binary one its sizes instead.
+type fileStat struct {
+	path    string
+	oldPath string
+	added   int
+	removed int
+
+	binary           bool
+	oldSize, newSize int
+}
+
+// name returns the path as --stat shows it, "old => new" for a rename.
+func (stat fileStat) name() string {
+	if stat.oldPath != "" {
+		return stat.oldPath + " => " + stat.path
+	}
+
+	return stat.path
+}
+
+// diffStat counts the added and removed lines of every path that differs
+// between two indexes, reading blob content through readBlob.
+func diffStat(oldIndex, newIndex map[string][]byte, readBlob readBlobFunc) ([]fileStat, error) {
+	return changeStats(diffIndexes(oldIndex, newIndex), readBlob, "")
+}
+
+// changeStats counts the added and removed lines of each change, as
+// diffStat does, with the given diff algorithm or the configured one.
+func changeStats(changes []fileChange, readBlob readBlobFunc, algorithm string) ([]fileStat, error) {
+	attrs, err := loadAttributes()
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "" {
+		if algorithm, err = configuredDiffAlgorithm(); err != nil {
+			return nil, err
+		}
+	}
+
+	var stats []fileStat
+
+	for _, change := range changes {
+		var oldContent, newContent []byte
+		var err error
+
+		if change.oldHash != nil {
+			if oldContent, err = readBlob(change.oldHash); err != nil {
+				return nil, err
+			}
+		}
+
+		if change.newHash != nil {
+			if newContent, err = readBlob(change.newHash); err != nil {
+				return nil, err
+			}
+		}
+
+		stat := fileStat{path: change.path, oldPath: change.oldPath}
+		if isBinaryDiff(attrs, change.path, oldContent, newContent) {
+			stat.binary, stat.oldSize, stat.newSize = true, len(oldContent), len(newContent)
+			stats = append(stats, stat)
+			continue
+		}
+		for _, line := range diffLines(splitLines(oldContent), splitLines(newContent), algorithm) {
+			switch line.kind {
+			case '+':
+				stat.added++
+			case '-':
+				stat.removed++
+			}
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// formatDiffStat formats stats like git's --stat: a " path | N ++--" line
+// per file, bars scaled to diffStatWidth, and a summary line.
+func formatDiffStat(stats []fileStat) string {
+	const diffStatWidth = 40
+
+	nameWidth, countWidth, maxChanges := 0, 1, 0
+	for _, stat := range stats {
+		nameWidth = max(nameWidth, len(stat.name()))
+		countWidth = max(countWidth, len(fmt.Sprint(stat.added+stat.removed)))
+		maxChanges = max(maxChanges, stat.added+stat.removed)
+	}
+
+	// scale a count to the bar width, keeping every change visible
+	scale := func(n int) int {
+		if maxChanges <= diffStatWidth || n == 0 {
+			return n
+		}
+		return max(1, n*diffStatWidth/maxChanges)
+	}
+
+	var sb strings.Builder
+	for _, stat := range stats {
+		if stat.binary {
+			sb.WriteString(fmt.Sprintf(" %-*s | Bin %d -> %d bytes\n", nameWidth, stat.name(), stat.oldSize, stat.newSize))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(" %-*s | %*d %s%s\n", nameWidth, stat.name(), countWidth, stat.added+stat.removed,
+			strings.Repeat("+", scale(stat.added)), strings.Repeat("-", scale(stat.removed))))
+	}
+	sb.WriteString(formatShortStat(stats))
+
+	return sb.String()
+}
+
+// formatShortStat formats the summary line of --stat alone, as
+// --shortstat prints it.
+func formatShortStat(stats []fileStat) string {
+	totalAdded, totalRemoved := 0, 0
+	for _, stat := range stats {
+		totalAdded += stat.added
+		totalRemoved += stat.removed
+	}
+
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, one)
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+
+	summary := " " + plural(len(stats), "file changed", "files changed")
+	if totalAdded > 0 || totalRemoved == 0 {
+		summary += ", " + plural(totalAdded, "insertion(+)", "insertions(+)")
+	}
+	if totalRemoved > 0 {
+		summary += ", " + plural(totalRemoved, "deletion(-)", "deletions(-)")
+	}
+
+	return summary + "\n"
+}
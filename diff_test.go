@@ -0,0 +1,118 @@
+package mygit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMyersDiff(t *testing.T) {
+	a := splitLines([]byte("a\nb\nc\n"))
+	b := splitLines([]byte("a\nc\nd\n"))
+
+	script := myersDiff(a, b)
+	expected := []diffLine{
+		{kind: ' ', text: "a\n"},
+		{kind: '-', text: "b\n"},
+		{kind: ' ', text: "c\n"},
+		{kind: '+', text: "d\n"},
+	}
+	assert.Equal(t, expected, script)
+
+	assert.Empty(t, unifiedHunks(myersDiff(a, a), diffContextLines), "identical input should produce no hunks")
+}
+
+func TestUnifiedHunks(t *testing.T) {
+	old := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	new := []byte("1\nX\n3\n4\n5\n6\n7\n8\n9\n10\n11\nY\n")
+
+	hunks := unifiedHunks(myersDiff(splitLines(old), splitLines(new)), diffContextLines)
+	expected := "@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n" +
+		"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+Y\n"
+	assert.Equal(t, expected, hunks)
+
+	hunks = unifiedHunks(myersDiff(nil, splitLines([]byte("new"))), diffContextLines)
+	assert.Equal(t, "@@ -0,0 +1 @@\n+new\n\\ No newline at end of file\n", hunks)
+}
+
+func TestDiffIndexes(t *testing.T) {
+	oldIndex := map[string][]byte{"kept": []byte("1"), "changed": []byte("1"), "removed": []byte("1")}
+	newIndex := map[string][]byte{"kept": []byte("1"), "changed": []byte("2"), "added": []byte("1")}
+
+	changes := diffIndexes(oldIndex, newIndex)
+	var summary []string
+	for _, change := range changes {
+		summary = append(summary, string(change.status)+" "+change.path)
+	}
+	assert.Equal(t, []string{"A added", "M changed", "D removed"}, summary)
+
+	changes = append(changes, fileChange{path: "new", oldPath: "old", status: 'R', similarity: 87})
+	assert.Equal(t, "added\nchanged\nremoved\nnew\n", formatNameStatus(changes, false))
+	assert.Equal(t, "A\tadded\nM\tchanged\nD\tremoved\nR087\told\tnew\n", formatNameStatus(changes, true))
+}
+
+func TestDiffStat(t *testing.T) {
+	blobs := map[string]string{"1": "a\nb\n", "2": "a\nc\nd\n", "3": "x\n"}
+	read := func(hash []byte) ([]byte, error) { return []byte(blobs[string(hash)]), nil }
+
+	oldIndex := map[string][]byte{"changed.txt": []byte("1"), "removed": []byte("3")}
+	newIndex := map[string][]byte{"changed.txt": []byte("2"), "added": []byte("3")}
+
+	stats, err := diffStat(oldIndex, newIndex, read)
+	assert.NoError(t, err)
+	assert.Equal(t, []fileStat{
+		{path: "added", added: 1},
+		{path: "changed.txt", added: 2, removed: 1},
+		{path: "removed", removed: 1},
+	}, stats)
+
+	expected := " added       | 1 +\n" +
+		" changed.txt | 3 ++-\n" +
+		" removed     | 1 -\n" +
+		" 3 files changed, 3 insertions(+), 2 deletions(-)\n"
+	assert.Equal(t, expected, formatDiffStat(stats))
+
+	// long bars are scaled down but every change stays visible
+	scaled := formatDiffStat([]fileStat{{path: "big", added: 400}, {path: "small", removed: 1}})
+	assert.Contains(t, scaled, " big   | 400 "+strings.Repeat("+", 40)+"\n")
+	assert.Contains(t, scaled, " small |   1 -\n")
+
+	// renames are named with both paths
+	renamed := []fileStat{{path: "new.txt", oldPath: "old.txt", added: 1}, {path: "x", removed: 2}}
+	assert.Equal(t, " old.txt => new.txt | 1 +\n"+
+		" x                  | 2 --\n"+
+		" 2 files changed, 1 insertion(+), 2 deletions(-)\n", formatDiffStat(renamed))
+	assert.Equal(t, " 2 files changed, 1 insertion(+), 2 deletions(-)\n", formatShortStat(renamed))
+}
+
+func TestBinaryDiff(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	text := []byte("one\ntwo\n")
+
+	var noAttrs attributeRules
+	assert.True(t, isBinaryDiff(noAttrs, "image.png", nil, png))
+	assert.True(t, isBinaryDiff(noAttrs, "image.png", png, text))
+	assert.False(t, isBinaryDiff(noAttrs, "a.txt", text, []byte("one\n")))
+
+	// the diff attribute overrides the content
+	attrs := parseAttributes([]byte("*.png diff\n*.dat -diff\n"))
+	assert.False(t, isBinaryDiff(attrs, "image.png", nil, png))
+	assert.True(t, isBinaryDiff(attrs, "table.dat", text, text))
+
+	blobs := map[string][]byte{"png": png, "text": text}
+	read := func(hash []byte) ([]byte, error) { return blobs[string(hash)], nil }
+	changes := diffIndexes(map[string][]byte{}, map[string][]byte{"image.png": []byte("png"), "a.txt": []byte("text")})
+
+	diff, err := formatChanges(changes, read, diffOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, diff, "Binary files /dev/null and b/image.png differ\n")
+	assert.NotContains(t, diff, "IHDR")
+	assert.Contains(t, diff, "+one\n+two\n")
+
+	stats, err := changeStats(changes, read, "")
+	assert.NoError(t, err)
+	assert.Equal(t, " a.txt     | 2 ++\n"+
+		" image.png | Bin 0 -> 16 bytes\n"+
+		" 2 files changed, 2 insertions(+)\n", formatDiffStat(stats))
+}
@@ -0,0 +1,205 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// The algorithms a diff can be computed with. Myers finds a shortest edit
+// script; patience and histogram first match lines that are rare on both
+// sides, which keeps reordered blocks and moved functions readable.
+const (
+	diffAlgorithmMyers     = "myers"
+	diffAlgorithmPatience  = "patience"
+	diffAlgorithmHistogram = "histogram"
+)
+
+// histogramMaxOccurrences is how often a line may occur in the old side
+// and still be matched first by the histogram algorithm; more common lines
+// are left to the Myers fallback.
+const histogramMaxOccurrences = 64
+
+// parseDiffAlgorithm checks the name of a diff algorithm. "default" is
+// taken for myers, as in git.
+func parseDiffAlgorithm(value string) (string, error) {
+	switch value {
+	case diffAlgorithmMyers, "default":
+		return diffAlgorithmMyers, nil
+	case diffAlgorithmPatience, diffAlgorithmHistogram:
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid diff algorithm %q: expected myers, patience, or histogram", value)
+}
+
+// configuredDiffAlgorithm returns the algorithm set with
+// "config diff.algorithm", or myers if it is not set or there is no
+// repository to set it in.
+func configuredDiffAlgorithm() (string, error) {
+	value, err := getConfig("algorithm")
+	if errors.Is(err, errConfigKeyNotFound) || errors.Is(err, ErrNotARepository) {
+		return diffAlgorithmMyers, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return parseDiffAlgorithm(value)
+}
+
+// diffLines computes an edit script between a and b with the given
+// algorithm, Myers if it is empty.
+func diffLines(a, b []string, algorithm string) []diffLine {
+	switch algorithm {
+	case diffAlgorithmPatience:
+		return anchoredDiff(a, b, patienceAnchors)
+	case diffAlgorithmHistogram:
+		return anchoredDiff(a, b, histogramAnchors)
+	}
+
+	return myersDiff(a, b)
+}
+
+// anchoredDiff computes an edit script by matching the lines anchors picks
+// as unchanged and diffing the ranges between them the same way. Common
+// leading and trailing lines are matched first, and a range without
+// anchors is left to myersDiff.
+func anchoredDiff(a, b []string, anchors func(a, b []string) [][2]int) []diffLine {
+	var script []diffLine
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		script = append(script, diffLine{kind: ' ', text: a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	var pairs [][2]int
+	if len(a) > 0 && len(b) > 0 {
+		pairs = anchors(a, b)
+	}
+
+	if len(pairs) == 0 {
+		script = append(script, myersDiff(a, b)...)
+	} else {
+		i, j := 0, 0
+		for _, pair := range pairs {
+			script = append(script, anchoredDiff(a[i:pair[0]], b[j:pair[1]], anchors)...)
+			script = append(script, diffLine{kind: ' ', text: a[pair[0]]})
+			i, j = pair[0]+1, pair[1]+1
+		}
+		script = append(script, anchoredDiff(a[i:], b[j:], anchors)...)
+	}
+
+	for _, line := range common {
+		script = append(script, diffLine{kind: ' ', text: line})
+	}
+
+	return script
+}
+
+// patienceAnchors returns the longest sequence of lines that occur exactly
+// once in a and once in b, in the same order in both, as pairs of indexes.
+func patienceAnchors(a, b []string) [][2]int {
+	type occurrences struct{ inA, inB, indexA, indexB int }
+	lines := make(map[string]*occurrences)
+	for i, line := range a {
+		if lines[line] == nil {
+			lines[line] = &occurrences{}
+		}
+		lines[line].inA++
+		lines[line].indexA = i
+	}
+	for j, line := range b {
+		if o := lines[line]; o != nil {
+			o.inB++
+			o.indexB = j
+		}
+	}
+
+	// the unique lines, in the order of a
+	var unique [][2]int
+	for i, line := range a {
+		if o := lines[line]; o.inA == 1 && o.inB == 1 && o.indexA == i {
+			unique = append(unique, [2]int{i, o.indexB})
+		}
+	}
+
+	// patience sorting: the longest run increasing in b as well
+	var piles []int // index in unique of the top of each pile
+	previous := make([]int, len(unique))
+	for k, pair := range unique {
+		pile := sort.Search(len(piles), func(p int) bool { return unique[piles[p]][1] > pair[1] })
+		previous[k] = -1
+		if pile > 0 {
+			previous[k] = piles[pile-1]
+		}
+		if pile == len(piles) {
+			piles = append(piles, k)
+		} else {
+			piles[pile] = k
+		}
+	}
+	if len(piles) == 0 {
+		return nil
+	}
+
+	anchors := make([][2]int, len(piles))
+	for k, n := piles[len(piles)-1], len(piles)-1; k >= 0; k, n = previous[k], n-1 {
+		anchors[n] = unique[k]
+	}
+
+	return anchors
+}
+
+// histogramAnchors returns the longest run of lines common to a and b that
+// holds the line occurring least often in a, as pairs of indexes. Lines
+// occurring more than histogramMaxOccurrences times are not matched.
+func histogramAnchors(a, b []string) [][2]int {
+	positions := make(map[string][]int)
+	for i, line := range a {
+		positions[line] = append(positions[line], i)
+	}
+
+	bestCount := histogramMaxOccurrences + 1
+	bestA, bestB, bestLen := 0, 0, 0
+	for j := 0; j < len(b); j++ {
+		matches := positions[b[j]]
+		if len(matches) == 0 || len(matches) > bestCount {
+			continue
+		}
+
+		for _, i := range matches {
+			startA, startB := i, j
+			for startA > 0 && startB > 0 && a[startA-1] == b[startB-1] {
+				startA--
+				startB--
+			}
+			endA, endB := i+1, j+1
+			for endA < len(a) && endB < len(b) && a[endA] == b[endB] {
+				endA++
+				endB++
+			}
+
+			if len(matches) < bestCount || endA-startA > bestLen {
+				bestCount = len(matches)
+				bestA, bestB, bestLen = startA, startB, endA-startA
+			}
+		}
+	}
+
+	anchors := make([][2]int, bestLen)
+	for n := range anchors {
+		anchors[n] = [2]int{bestA + n, bestB + n}
+	}
+
+	return anchors
+}
@@ -0,0 +1,97 @@
+package mygit
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptSides rebuilds the old and new sides of an edit script.
+func scriptSides(script []diffLine) ([]string, []string) {
+	var a, b []string
+	for _, line := range script {
+		if line.kind != '+' {
+			a = append(a, line.text)
+		}
+		if line.kind != '-' {
+			b = append(b, line.text)
+		}
+	}
+	return a, b
+}
+
+func TestDiffAlgorithms(t *testing.T) {
+	// blocks swapped: myers keeps the common closing braces and replaces
+	// the lines between them, patience and histogram keep the one line
+	// that is unique on both sides and move the rest around it
+	old := splitLines([]byte("x\n}\n}\ny\n}\n"))
+	new := splitLines([]byte("y\n}\n}\nx\n}\n"))
+	unchanged := func(script []diffLine) []string {
+		var lines []string
+		for _, line := range script {
+			if line.kind == ' ' {
+				lines = append(lines, line.text)
+			}
+		}
+		return lines
+	}
+
+	assert.Equal(t, []string{"}\n", "}\n", "}\n"}, unchanged(diffLines(old, new, diffAlgorithmMyers)))
+	assert.Equal(t, []string{"y\n", "}\n"}, unchanged(diffLines(old, new, diffAlgorithmPatience)))
+	assert.Equal(t, []string{"y\n", "}\n"}, unchanged(diffLines(old, new, diffAlgorithmHistogram)))
+
+	// every algorithm gives a script that turns the old side into the new
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = strings.Repeat("x", rng.Intn(5)) + "\n"
+		}
+		return lines
+	}
+	for range 200 {
+		a, b := randomLines(), randomLines()
+		for _, algorithm := range []string{diffAlgorithmMyers, diffAlgorithmPatience, diffAlgorithmHistogram} {
+			gotA, gotB := scriptSides(diffLines(a, b, algorithm))
+			assert.Equal(t, len(a), len(gotA), algorithm)
+			assert.Equal(t, strings.Join(a, ""), strings.Join(gotA, ""), algorithm)
+			assert.Equal(t, strings.Join(b, ""), strings.Join(gotB, ""), algorithm)
+		}
+	}
+
+	algorithm, err := parseDiffAlgorithm("default")
+	assert.NoError(t, err)
+	assert.Equal(t, diffAlgorithmMyers, algorithm)
+	_, err = parseDiffAlgorithm("minimal")
+	assert.Error(t, err)
+}
+
+func TestConfiguredDiffAlgorithm(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		algorithm, err := configuredDiffAlgorithm()
+		assert.NoError(t, err)
+		assert.Equal(t, diffAlgorithmMyers, algorithm)
+		threshold, err := renameThreshold()
+		assert.NoError(t, err)
+		assert.Equal(t, defaultRenameThreshold, threshold)
+
+		assert.NoError(t, updateConfig("algorithm", "histogram"))
+		algorithm, err = configuredDiffAlgorithm()
+		assert.NoError(t, err)
+		assert.Equal(t, diffAlgorithmHistogram, algorithm)
+
+		// a config file that cannot be read is an error, not the default
+		assert.NoError(t, os.Remove(filepath.Join(commonDir, "config")))
+		_, err = configuredDiffAlgorithm()
+		assert.ErrorContains(t, err, "error reading config file")
+		_, err = renameThreshold()
+		assert.ErrorContains(t, err, "error reading config file")
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
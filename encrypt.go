@@ -0,0 +1,210 @@
+package mygit
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// objectKeyEnv names the environment variable holding the object key.
+const objectKeyEnv = "MYGIT_OBJECT_KEY"
+
+// encryptedObjectMagic starts every encrypted object file. No deflate stream
+// can begin with these bytes (the stored-block length check would fail), so
+// encrypted and plaintext objects can be told apart and live side by side.
+var encryptedObjectMagic = []byte("\x00MGE1")
+
+// objectEncryptionEnabled reports whether new objects are written encrypted.
+func objectEncryptionEnabled() bool {
+	value, err := getConfig("objectEncryption")
+	return err == nil && value == "true"
+}
+
+// objectKey returns the 256-bit object key, given as 64 hex digits in
+// MYGIT_OBJECT_KEY or as objectKey in the global config. The repository
+// config is never consulted: it travels with the objects it would unlock.
+func objectKey() ([]byte, error) {
+	value := os.Getenv(objectKeyEnv)
+	if value == "" {
+		value, _ = getGlobalConfig("objectKey")
+	}
+	if value == "" {
+		return nil, fmt.Errorf("no object key: set %s or objectKey in the global config", objectKeyEnv)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid object key: expected 64 hex digits")
+	}
+
+	return key, nil
+}
+
+// objectCipher returns an AES-256-GCM cipher using the object key.
+func objectCipher() (cipher.AEAD, error) {
+	key, err := objectKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating object cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealObjectData encrypts compressed object data. The object hash is bound
+// in as additional data, so an encrypted file moved to another object's
+// path fails to decrypt.
+func sealObjectData(hash, compressed []byte) ([]byte, error) {
+	aead, err := objectCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	sealed := append(bytes.Clone(encryptedObjectMagic), nonce...)
+	return aead.Seal(sealed, nonce, compressed, hash), nil
+}
+
+// openObjectData returns the compressed data of a stored object file,
+// decrypting it if it is encrypted.
+func openObjectData(hash, stored []byte) ([]byte, error) {
+	if !isEncryptedObject(stored) {
+		return stored, nil
+	}
+
+	aead, err := objectCipher()
+	if err != nil {
+		return nil, fmt.Errorf("object %x is encrypted: %w", hash, err)
+	}
+
+	sealed := stored[len(encryptedObjectMagic):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("error decrypting object %x: truncated", hash)
+	}
+
+	compressed, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], hash)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting object %x: wrong key or corrupted object", hash)
+	}
+
+	return compressed, nil
+}
+
+// isEncryptedObject reports whether stored object file content is encrypted.
+func isEncryptedObject(stored []byte) bool {
+	return bytes.HasPrefix(stored, encryptedObjectMagic)
+}
+
+// sealingWriter compresses object data into memory and writes it to the
+// object file encrypted when closed.
+type sealingWriter struct {
+	f          *os.File
+	hash       []byte
+	compressed bytes.Buffer
+	w          *flate.Writer
+}
+
+func (s *sealingWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s *sealingWriter) Close() error {
+	if err := s.w.Close(); err != nil {
+		return err
+	}
+
+	sealed, err := sealObjectData(s.hash, s.compressed.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.f.Write(sealed)
+	return err
+}
+
+// newObjectWriter returns a writer that compresses object data into f,
+// encrypting it when object encryption is enabled.
+func newObjectWriter(f *os.File, hash []byte) (io.WriteCloser, error) {
+	if !objectEncryptionEnabled() {
+		return flate.NewWriter(f, flate.BestCompression)
+	}
+
+	// fail before anything is written rather than when the file is closed
+	if _, err := objectKey(); err != nil {
+		return nil, err
+	}
+
+	s := &sealingWriter{f: f, hash: hash}
+	w, err := flate.NewWriter(&s.compressed, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	s.w = w
+
+	return s, nil
+}
+
+// encryptLooseObjects rewrites every plaintext object in the store
+// encrypted and returns how many objects were (or, with dryRun, would be)
+// rewritten. It is a no-op unless object encryption is enabled.
+func encryptLooseObjects(ctx context.Context, dryRun bool) (int, error) {
+	if !objectEncryptionEnabled() {
+		return 0, nil
+	}
+
+	hashes, err := listObjectHashes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, hash := range hashes {
+		objectPath := fmt.Sprintf("%s/objects/%x/%x", commonDir, hash[:1], hash[1:])
+
+		stored, err := os.ReadFile(objectPath)
+		if err != nil {
+			return count, fmt.Errorf("error reading object %x: %w", hash, err)
+		}
+		if isEncryptedObject(stored) {
+			continue
+		}
+
+		count++
+		if dryRun {
+			continue
+		}
+
+		sealed, err := sealObjectData(hash, stored)
+		if err != nil {
+			return count, err
+		}
+
+		// write next to the object and rename, so a crash never leaves it half encrypted
+		tmpPath := objectPath + ".tmp"
+		if err := os.WriteFile(tmpPath, sealed, 0644); err != nil {
+			return count, fmt.Errorf("error encrypting object %x: %w", hash, err)
+		}
+		if err := os.Rename(tmpPath, objectPath); err != nil {
+			os.Remove(tmpPath)
+			return count, fmt.Errorf("error encrypting object %x: %w", hash, err)
+		}
+	}
+
+	return count, nil
+}
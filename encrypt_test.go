@@ -0,0 +1,53 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectEncryption(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	t.Setenv(objectKeyEnv, strings.Repeat("ab", 32))
+
+	plainHash, err := createObject([]byte("written before encryption"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, updateConfig("objectEncryption", "true"))
+
+	secret := []byte("top secret source code")
+	hash, err := createObject(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, hashObject(secret), hash, "ids do not depend on encryption")
+
+	stored, err := os.ReadFile(fmt.Sprintf("%s/objects/%x/%x", commonDir, hash[:1], hash[1:]))
+	assert.NoError(t, err)
+	assert.True(t, isEncryptedObject(stored))
+	assert.False(t, bytes.Contains(stored, secret))
+
+	obj, err := catFile(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, obj.(blobObject).content)
+
+	// compact encrypts objects stored before the mode was enabled
+	report, err := compactRepository(t.Context(), time.Hour, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.encrypted)
+	obj, err = catFile(plainHash)
+	assert.NoError(t, err)
+	assert.Equal(t, "written before encryption", string(obj.(blobObject).content))
+
+	// a different key cannot read the objects
+	t.Setenv(objectKeyEnv, strings.Repeat("cd", 32))
+	_, err = catFile(hash)
+	assert.Error(t, err)
+}
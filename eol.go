@@ -0,0 +1,78 @@
+package mygit
+
+import (
+	"bytes"
+	"runtime"
+)
+
+// binarySniffLen is how much of a file is looked at to tell text from
+// binary content: a file with a NUL byte in it is binary.
+const binarySniffLen = 8000
+
+// looksBinary reports whether content has a NUL byte near its start.
+func looksBinary(content []byte) bool {
+	return bytes.Contains(content[:min(len(content), binarySniffLen)], []byte{0})
+}
+
+// mayConvertEOL reports whether the file at filePath could have its line
+// endings converted, before its content is known.
+func (c contentConversion) mayConvertEOL(filePath string) bool {
+	text := c.attrs.get(filePath, "text")
+	return text != attrUnset && (text != attrUnspecified || c.attrs.get(filePath, "eol") != attrUnspecified || c.autocrlf != "")
+}
+
+// isText reports whether content at filePath is converted as text: always
+// when the text attribute is set, never when it is unset, and otherwise,
+// if autocrlf or an eol attribute asks for conversion, when the content
+// has no NUL byte near its start.
+func (c contentConversion) isText(filePath string, content []byte) bool {
+	if !c.mayConvertEOL(filePath) {
+		return false
+	}
+	if c.attrs.get(filePath, "text") == attrSet {
+		return true
+	}
+
+	return !looksBinary(content)
+}
+
+// checkoutCRLF reports whether text at filePath is written out with CRLF
+// line endings: as its eol attribute says, else as core.autocrlf says, else
+// as is native to the platform.
+func (c contentConversion) checkoutCRLF(filePath string) bool {
+	switch c.attrs.get(filePath, "eol") {
+	case "crlf":
+		return true
+	case "lf":
+		return false
+	}
+
+	switch c.autocrlf {
+	case "true":
+		return true
+	case "input":
+		return false
+	}
+
+	return runtime.GOOS == "windows"
+}
+
+// eolToObject gives text at filePath the LF line endings it is stored with.
+func (c contentConversion) eolToObject(filePath string, content []byte) []byte {
+	if !c.isText(filePath, content) {
+		return content
+	}
+
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// eolToWorkTree gives text at filePath CRLF line endings if checkoutCRLF
+// says it should have them.
+func (c contentConversion) eolToWorkTree(filePath string, content []byte) []byte {
+	if !c.isText(filePath, content) || !c.checkoutCRLF(filePath) {
+		return content
+	}
+
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+}
@@ -0,0 +1,65 @@
+package mygit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextConversion(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("autocrlf", "true"))
+		assert.NoError(t, os.WriteFile(attributesFileName, []byte("*.sh eol=lf\n*.dat binary\n"), 0644))
+		assert.NoError(t, os.WriteFile("notes.txt", []byte("one\r\ntwo\r\n"), 0644))
+		assert.NoError(t, os.WriteFile("run.sh", []byte("echo hi\r\n"), 0644))
+		assert.NoError(t, os.WriteFile("table.dat", []byte("a\r\nb\r\n"), 0644))
+		assert.NoError(t, os.WriteFile("image.png", []byte("\x89PNG\r\n\x00\r\n"), 0644))
+
+		_, _, err := addPaths(t.Context(), []string{"."}, addOptions{})
+		assert.NoError(t, err)
+		index, err := readIndex(t.Context())
+		assert.NoError(t, err)
+
+		// text is stored with LF line endings, binary content as it is
+		assert.Equal(t, hashObject([]byte("one\ntwo\n")), index["notes.txt"])
+		assert.Equal(t, hashObject([]byte("echo hi\n")), index["run.sh"])
+		assert.Equal(t, hashObject([]byte("a\r\nb\r\n")), index["table.dat"])
+		assert.Equal(t, hashObject([]byte("\x89PNG\r\n\x00\r\n")), index["image.png"])
+
+		modified, unstaged, err := getStatus(t.Context())
+		assert.NoError(t, err)
+		assert.Empty(t, modified)
+		assert.Empty(t, unstaged)
+
+		// checkout writes CRLF text unless the attributes say otherwise
+		tree, err := writeIndexTree(index)
+		assert.NoError(t, err)
+		for path := range index {
+			assert.NoError(t, os.Remove(path))
+		}
+		_, err = buildIndexFromTree(t.Context(), tree, "", true)
+		assert.NoError(t, err)
+
+		for path, want := range map[string]string{
+			"notes.txt": "one\r\ntwo\r\n",
+			"run.sh":    "echo hi\n",
+			"table.dat": "a\r\nb\r\n",
+			"image.png": "\x89PNG\r\n\x00\r\n",
+		} {
+			content, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(content), path)
+		}
+
+		// "input" only normalizes on the way in
+		assert.NoError(t, updateConfig("autocrlf", "input"))
+		conv, err := loadContentConversion()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("x\ny\n"), conv.eolToObject("a.txt", []byte("x\r\ny\r\n")))
+		assert.Equal(t, []byte("x\ny\n"), conv.eolToWorkTree("a.txt", []byte("x\ny\n")))
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
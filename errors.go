@@ -0,0 +1,99 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors the library returns, matchable with errors.Is however deeply
+// they are wrapped. The messages callers see are unchanged: the sentinels
+// are attached to the errors of the command line, not substituted for them.
+var (
+	// ErrNotARepository is returned when a directory is not inside a
+	// repository.
+	ErrNotARepository = errors.New("not a " + vcsName + " repository")
+
+	// ErrObjectNotFound is returned when an object is not in the store or
+	// a revision names nothing.
+	ErrObjectNotFound = errors.New("object not found")
+
+	// ErrConflict is returned when unresolved merge conflicts stop an
+	// operation, a merge is already in progress, or a ref moved since it
+	// was read.
+	ErrConflict = errors.New("conflict")
+
+	// ErrDirtyWorktree is returned when the index or working tree has
+	// changes an operation would lose.
+	ErrDirtyWorktree = errors.New("uncommitted changes")
+
+	// ErrUnknownObjectType is returned for an object whose type no
+	// registered kind handles, for example one written by a newer version.
+	ErrUnknownObjectType = errors.New("unknown object type")
+)
+
+// RevisionError is returned for a revision that names no object.
+type RevisionError struct {
+	Rev string
+}
+
+func (e *RevisionError) Error() string { return "unknown revision: " + e.Rev }
+
+// Is makes a RevisionError match ErrObjectNotFound.
+func (e *RevisionError) Is(target error) bool { return target == ErrObjectNotFound }
+
+// DirtyWorktreeError is returned for a file whose changes an operation
+// would lose.
+type DirtyWorktreeError struct {
+	Path   string
+	Change string // "has uncommitted changes", "has uncommitted deletions", or "has been modified"
+}
+
+func (e *DirtyWorktreeError) Error() string { return fmt.Sprintf("file %s %s", e.Path, e.Change) }
+
+// Is makes a DirtyWorktreeError match ErrDirtyWorktree.
+func (e *DirtyWorktreeError) Is(target error) bool { return target == ErrDirtyWorktree }
+
+// ConflictError is returned when paths with unresolved merge conflicts
+// stop an operation.
+type ConflictError struct {
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return "merge conflicts exist in " + strings.Join(e.Paths, ", ")
+}
+
+// Is makes a ConflictError match ErrConflict.
+func (e *ConflictError) Is(target error) bool { return target == ErrConflict }
+
+// UnknownObjectTypeError is returned for an object type with no
+// registered kind. Hash is empty when no stored object is involved.
+type UnknownObjectTypeError struct {
+	Type string
+	Hash string
+}
+
+func (e *UnknownObjectTypeError) Error() string {
+	if e.Hash == "" {
+		return "unknown object type: " + e.Type
+	}
+	return fmt.Sprintf("unknown object type %s in object %s", e.Type, e.Hash)
+}
+
+// Is makes an UnknownObjectTypeError match ErrUnknownObjectType.
+func (e *UnknownObjectTypeError) Is(target error) bool { return target == ErrUnknownObjectType }
+
+// kindError is an error with its own message that also matches a sentinel.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// errorOf formats an error as fmt.Errorf does and makes it match kind.
+func errorOf(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
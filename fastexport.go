@@ -0,0 +1,316 @@
+package mygit
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// identTimestamp matches the "<seconds> <offset>" git expects after an
+// identity. mygit commits carry no timestamps, so exported identities get
+// the epoch unless one is already present.
+var identTimestamp = regexp.MustCompile(` \d+ [+-]\d{4}$`)
+
+// fastExporter writes a git fast-import stream. Every blob and commit is
+// written once and given a mark, which later commands refer to.
+type fastExporter struct {
+	w     *bufio.Writer
+	marks map[string]int // hex id -> mark
+}
+
+// fastExportRefs returns the ref paths to export: the named branches and
+// tags, or every branch and tag when names is empty. Refs without commits
+// are left out.
+func fastExportRefs(ctx context.Context, names []string) ([]string, error) {
+	var refPaths []string
+
+	if len(names) == 0 {
+		for _, dir := range []string{"refs/heads", "refs/tags"} {
+			refNames, err := listRefNames(ctx, dir)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range refNames {
+				refPaths = append(refPaths, dir+"/"+name)
+			}
+		}
+	}
+
+	for _, name := range names {
+		found := false
+		for _, refPath := range []string{name, "refs/heads/" + name, "refs/tags/" + name} {
+			if !strings.HasPrefix(refPath, "refs/") {
+				continue
+			}
+			exists, err := refExists(refPath)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				refPaths = append(refPaths, refPath)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown branch or tag: %s", name)
+		}
+	}
+
+	var withCommits []string
+	for _, refPath := range refPaths {
+		hash, err := readRefIfExists(refPath)
+		if err != nil {
+			return nil, err
+		}
+		if hash != nil {
+			withCommits = append(withCommits, refPath)
+		}
+	}
+
+	return withCommits, nil
+}
+
+// fastExport writes the history of the given branches and tags (all of them
+// when names is empty) as a git fast-import stream: blobs, then each commit
+// after its parents, then a reset setting every ref to its commit.
+func fastExport(ctx context.Context, w io.Writer, names []string) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	refPaths, err := fastExportRefs(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	e := &fastExporter{w: bufio.NewWriter(w), marks: make(map[string]int)}
+
+	tips := make(map[string][]byte)
+	for _, refPath := range refPaths {
+		hash, err := readRefIfExists(refPath)
+		if err != nil {
+			return err
+		}
+		tips[refPath] = hash
+
+		if err := e.exportHistory(refPath, hash); err != nil {
+			return err
+		}
+	}
+
+	for _, refPath := range refPaths {
+		fmt.Fprintf(e.w, "reset %s\nfrom :%d\n\n", refPath, e.marks[hex.EncodeToString(tips[refPath])])
+	}
+
+	if err := e.w.Flush(); err != nil {
+		return fmt.Errorf("error writing export stream: %w", err)
+	}
+
+	return nil
+}
+
+// exportHistory writes every commit reachable from tip that has not been
+// written yet, parents before children, on the given ref.
+func (e *fastExporter) exportHistory(refPath string, tip []byte) error {
+	type pendingCommit struct {
+		hash     []byte
+		expanded bool
+	}
+
+	pending := []pendingCommit{{hash: tip}}
+	visited := make(map[string]bool)
+
+	for len(pending) > 0 {
+		top := pending[len(pending)-1]
+		hexHash := hex.EncodeToString(top.hash)
+
+		if _, done := e.marks[hexHash]; done {
+			pending = pending[:len(pending)-1]
+			continue
+		}
+
+		obj, err := catFile(top.hash)
+		if err != nil {
+			return err
+		}
+		commit, ok := obj.(commitObject)
+		if !ok {
+			return fmt.Errorf("object %s is not a commit", hexHash)
+		}
+
+		if top.expanded {
+			// every parent has been written by now
+			pending = pending[:len(pending)-1]
+			if err := e.exportCommit(refPath, top.hash, commit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if visited[hexHash] {
+			return fmt.Errorf("commit %s is its own ancestor", hexHash)
+		}
+		visited[hexHash] = true
+
+		pending[len(pending)-1].expanded = true
+		for i := len(commit.parents) - 1; i >= 0; i-- {
+			pending = append(pending, pendingCommit{hash: commit.parents[i]})
+		}
+	}
+
+	return nil
+}
+
+// exportCommit writes the blobs new in a commit, then the commit itself
+// with its changes relative to its first parent.
+func (e *fastExporter) exportCommit(refPath string, hash []byte, commit commitObject) error {
+	files, err := fastExportFiles(commit.hash)
+	if err != nil {
+		return err
+	}
+
+	parentFiles := make(map[string]treeEntry)
+	if len(commit.parents) > 0 {
+		parent, err := catFile(commit.parents[0])
+		if err != nil {
+			return err
+		}
+		parentCommit, ok := parent.(commitObject)
+		if !ok {
+			return fmt.Errorf("object %x is not a commit", commit.parents[0])
+		}
+		if parentFiles, err = fastExportFiles(parentCommit.hash); err != nil {
+			return err
+		}
+	}
+
+	paths := slices.Sorted(maps.Keys(files))
+
+	// blobs first, so the commit can refer to them by mark
+	for _, path := range paths {
+		entry := files[path]
+		if entry.objType != "blob" {
+			continue
+		}
+		if err := e.exportBlob(entry.hash); err != nil {
+			return err
+		}
+	}
+
+	// a root commit must not continue whatever the ref points at so far
+	if len(commit.parents) == 0 {
+		fmt.Fprintf(e.w, "reset %s\n", refPath)
+	}
+
+	mark := len(e.marks) + 1
+	e.marks[hex.EncodeToString(hash)] = mark
+
+	fmt.Fprintf(e.w, "commit %s\nmark :%d\n", refPath, mark)
+	fmt.Fprintf(e.w, "author %s\n", fastExportIdent(commit.author))
+	fmt.Fprintf(e.w, "committer %s\n", fastExportIdent(commit.committer))
+	e.writeData([]byte(commit.message + "\n"))
+
+	for i, parent := range commit.parents {
+		command := "merge"
+		if i == 0 {
+			command = "from"
+		}
+		fmt.Fprintf(e.w, "%s :%d\n", command, e.marks[hex.EncodeToString(parent)])
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(parentFiles)) {
+		if _, ok := files[path]; !ok {
+			fmt.Fprintf(e.w, "D %s\n", fastExportPath(path))
+		}
+	}
+
+	for _, path := range paths {
+		entry := files[path]
+		if old, ok := parentFiles[path]; ok && old.mode == entry.mode && slices.Equal(old.hash, entry.hash) {
+			continue
+		}
+
+		if entry.objType == "commit" {
+			// submodule commits are referenced by id, not exported
+			fmt.Fprintf(e.w, "M 160000 %x %s\n", entry.hash, fastExportPath(path))
+			continue
+		}
+		fmt.Fprintf(e.w, "M %s :%d %s\n", entry.mode, e.marks[hex.EncodeToString(entry.hash)], fastExportPath(path))
+	}
+	fmt.Fprintln(e.w)
+
+	return nil
+}
+
+// exportBlob writes a blob command unless the blob was written before.
+func (e *fastExporter) exportBlob(hash []byte) error {
+	hexHash := hex.EncodeToString(hash)
+	if _, ok := e.marks[hexHash]; ok {
+		return nil
+	}
+
+	fullData, _, size, err := readRawObject(hash)
+	if err != nil {
+		return err
+	}
+
+	mark := len(e.marks) + 1
+	e.marks[hexHash] = mark
+
+	fmt.Fprintf(e.w, "blob\nmark :%d\n", mark)
+	e.writeData(fullData[len(fullData)-size:])
+	fmt.Fprintln(e.w)
+
+	return nil
+}
+
+// writeData writes a data command carrying content.
+func (e *fastExporter) writeData(content []byte) {
+	fmt.Fprintf(e.w, "data %d\n", len(content))
+	e.w.Write(content)
+}
+
+// fastExportFiles returns the files and submodules of a tree by path.
+func fastExportFiles(treeHash []byte) (map[string]treeEntry, error) {
+	entries, err := listTreeEntries(treeHash, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]treeEntry, len(entries))
+	for _, entry := range entries {
+		files[entry.name] = entry
+	}
+
+	return files, nil
+}
+
+// fastExportIdent returns an identity in the "Name <email> <time> <offset>"
+// form fast-import requires.
+func fastExportIdent(ident string) string {
+	if !strings.Contains(ident, "<") {
+		ident = fmt.Sprintf("%s <>", strings.TrimSpace(ident))
+	}
+	if identTimestamp.MatchString(ident) {
+		return ident
+	}
+
+	return ident + " 0 +0000"
+}
+
+// fastExportPath quotes a path that fast-import would otherwise misread.
+func fastExportPath(path string) string {
+	if strings.ContainsAny(path, "\"\n\\") || strings.HasPrefix(path, " ") {
+		return strconv.Quote(path)
+	}
+
+	return path
+}
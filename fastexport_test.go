@@ -0,0 +1,75 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFastExport(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "export@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	readme, err := createObject([]byte("readme\n"))
+	assert.NoError(t, err)
+	source, err := createObject([]byte("package main\n"))
+	assert.NoError(t, err)
+
+	firstTree, err := buildTreeObject(map[string][]byte{"README": readme, "src/main.go": source})
+	assert.NoError(t, err)
+	first, err := writeCommitObject(firstTree, nil, "first")
+	assert.NoError(t, err)
+
+	secondTree, err := buildTreeObject(map[string][]byte{"README": source})
+	assert.NoError(t, err)
+	second, err := writeCommitObject(secondTree, [][]byte{first}, "second")
+	assert.NoError(t, err)
+
+	assert.NoError(t, updateRef("refs/heads/main", second))
+	assert.NoError(t, os.MkdirAll(fmt.Sprintf("%s/refs/tags", commonDir), 0755))
+	assert.NoError(t, updateRef("refs/tags/v1", first))
+
+	var buf bytes.Buffer
+	assert.NoError(t, fastExport(t.Context(), &buf, nil))
+
+	expected := strings.Join([]string{
+		"blob", "mark :1", "data 7", "readme", "",
+		"blob", "mark :2", "data 13", "package main", "",
+		"reset refs/heads/main",
+		"commit refs/heads/main", "mark :3",
+		"author Author <export@example.com> 0 +0000",
+		"committer Committer <export@example.com> 0 +0000",
+		"data 6", "first",
+		"M 100644 :1 README",
+		"M 100644 :2 src/main.go", "",
+		// the blob is already known, so only the commit is written
+		"commit refs/heads/main", "mark :4",
+		"author Author <export@example.com> 0 +0000",
+		"committer Committer <export@example.com> 0 +0000",
+		"data 7", "second",
+		"from :3",
+		"D src/main.go",
+		"M 100644 :2 README", "",
+		"reset refs/heads/main", "from :4", "",
+		"reset refs/tags/v1", "from :3", "", "",
+	}, "\n")
+	assert.Equal(t, expected, buf.String())
+
+	// naming a ref exports only its history
+	buf.Reset()
+	assert.NoError(t, fastExport(t.Context(), &buf, []string{"v1"}))
+	assert.Contains(t, buf.String(), "commit refs/tags/v1\nmark :3\n")
+	assert.NotContains(t, buf.String(), "refs/heads/main")
+
+	assert.Error(t, fastExport(t.Context(), &buf, []string{"missing"}))
+}
@@ -0,0 +1,694 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// fastImportTree is the file list of the commit a ref was last given in
+// the stream, with the tree ids of unchanged directories so each commit
+// only writes the trees it touches.
+type fastImportTree struct {
+	files    map[string][]byte // path -> blob id, or commit id for a submodule
+	gitlinks map[string]bool
+	cache    map[string][]byte // directory -> tree id
+}
+
+// fastImportStats counts what a fast-import stream created.
+type fastImportStats struct {
+	blobs   int
+	commits int
+	refs    []string // refs updated
+}
+
+// fastImporter reads a git fast-import stream and writes its objects
+// directly to the object store. Refs are only updated once the whole
+// stream has been read.
+type fastImporter struct {
+	r     *bufio.Reader
+	line  string // the command being processed
+	eof   bool
+	force bool
+
+	marks map[int][]byte
+	refs  map[string][]byte // ref path -> commit set by the stream
+	trees map[string]fastImportTree
+	stats fastImportStats
+}
+
+// fastImport reads a fast-import stream from r and creates its blobs,
+// trees, commits, branches, and tags. The working tree and index are left
+// alone. Existing refs are only moved forward unless force is set.
+func fastImport(r io.Reader, force bool) (fastImportStats, error) {
+	if err := checkVCSRepo(); err != nil {
+		return fastImportStats{}, err
+	}
+
+	imp := &fastImporter{
+		r:     bufio.NewReader(r),
+		force: force,
+		marks: make(map[int][]byte),
+		refs:  make(map[string][]byte),
+		trees: make(map[string]fastImportTree),
+	}
+
+	if err := imp.readLine(); err != nil {
+		return imp.stats, err
+	}
+
+	for !imp.eof {
+		var err error
+		switch command, _, _ := strings.Cut(imp.line, " "); command {
+		case "blob":
+			err = imp.importBlob()
+		case "commit":
+			err = imp.importCommit()
+		case "reset":
+			err = imp.importReset()
+		case "tag":
+			err = imp.importTag()
+		case "done":
+			imp.eof = true
+		case "progress", "checkpoint", "feature", "option":
+			err = imp.readLine()
+		default:
+			err = fmt.Errorf("unsupported fast-import command: %s", imp.line)
+		}
+		if err != nil {
+			return imp.stats, err
+		}
+	}
+
+	if err := imp.updateRefs(); err != nil {
+		return imp.stats, err
+	}
+
+	return imp.stats, nil
+}
+
+// readLine reads the next command line, skipping comments and blank lines.
+func (imp *fastImporter) readLine() error {
+	for {
+		line, err := imp.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			imp.eof = true
+			imp.line = ""
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("error reading fast-import stream: %w", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		imp.line = line
+		return nil
+	}
+}
+
+// readData reads the data command on the current line and the content
+// that follows it, then moves to the next command.
+func (imp *fastImporter) readData() ([]byte, error) {
+	arg, ok := strings.CutPrefix(imp.line, "data ")
+	if !ok {
+		return nil, fmt.Errorf("expected data command, got: %s", imp.line)
+	}
+
+	var content []byte
+	if delim, ok := strings.CutPrefix(arg, "<<"); ok {
+		// delimited format: lines up to one consisting of the delimiter
+		var buf bytes.Buffer
+		for {
+			line, err := imp.r.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("unterminated data ending with %s", delim)
+			}
+			if strings.TrimSuffix(line, "\n") == delim {
+				break
+			}
+			buf.WriteString(line)
+		}
+		content = buf.Bytes()
+	} else {
+		size, err := strconv.Atoi(arg)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid data length: %s", arg)
+		}
+
+		content = make([]byte, size)
+		if _, err := io.ReadFull(imp.r, content); err != nil {
+			return nil, fmt.Errorf("error reading data: %w", err)
+		}
+	}
+
+	return content, imp.readLine()
+}
+
+// readMark reads an optional mark command, returning 0 if there is none.
+// An original-oid command is accepted and ignored.
+func (imp *fastImporter) readMark() (int, error) {
+	mark := 0
+	if arg, ok := strings.CutPrefix(imp.line, "mark :"); ok {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid mark: %s", imp.line)
+		}
+		mark = n
+		if err := imp.readLine(); err != nil {
+			return 0, err
+		}
+	}
+
+	if strings.HasPrefix(imp.line, "original-oid ") {
+		if err := imp.readLine(); err != nil {
+			return 0, err
+		}
+	}
+
+	return mark, nil
+}
+
+// importBlob handles: blob, mark?, original-oid?, data.
+func (imp *fastImporter) importBlob() error {
+	if err := imp.readLine(); err != nil {
+		return err
+	}
+
+	mark, err := imp.readMark()
+	if err != nil {
+		return err
+	}
+
+	content, err := imp.readData()
+	if err != nil {
+		return err
+	}
+
+	hash, err := createObject(content)
+	if err != nil {
+		return err
+	}
+	imp.stats.blobs++
+
+	if mark != 0 {
+		imp.marks[mark] = hash
+	}
+
+	return nil
+}
+
+// resolveCommitish resolves a from/merge argument: a mark, a ref set
+// earlier in the stream or in the repository, or a full object id.
+func (imp *fastImporter) resolveCommitish(arg string) ([]byte, error) {
+	if n, ok := strings.CutPrefix(arg, ":"); ok {
+		mark, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mark: %s", arg)
+		}
+		hash, ok := imp.marks[mark]
+		if !ok {
+			return nil, fmt.Errorf("unknown mark: %s", arg)
+		}
+		return hash, nil
+	}
+
+	if hash, ok := imp.refs[arg]; ok {
+		return hash, nil
+	}
+
+	if strings.HasPrefix(arg, "refs/") {
+		hash, err := readRefIfExists(arg)
+		if err != nil {
+			return nil, err
+		}
+		if hash != nil {
+			return hash, nil
+		}
+	}
+
+	if hash, err := hex.DecodeString(arg); err == nil && len(hash) == hashSize() && objectExists(hash) {
+		return hash, nil
+	}
+
+	return nil, fmt.Errorf("unknown commit: %s", arg)
+}
+
+// refTip returns the commit a ref points to: its value in the stream so
+// far, or in the repository.
+func (imp *fastImporter) refTip(refPath string) ([]byte, error) {
+	if hash, ok := imp.refs[refPath]; ok {
+		return hash, nil
+	}
+
+	return readRefIfExists(refPath)
+}
+
+// treeOf returns the file list of a commit, reusing the ref's cached list
+// when the ref was last set to that commit.
+func (imp *fastImporter) treeOf(refPath string, commitHash []byte) (fastImportTree, error) {
+	tree := fastImportTree{
+		files:    make(map[string][]byte),
+		gitlinks: make(map[string]bool),
+		cache:    make(map[string][]byte),
+	}
+	if commitHash == nil {
+		return tree, nil
+	}
+
+	if cached, ok := imp.trees[refPath]; ok && slices.Equal(imp.refs[refPath], commitHash) {
+		return fastImportTree{
+			files:    maps.Clone(cached.files),
+			gitlinks: maps.Clone(cached.gitlinks),
+			cache:    maps.Clone(cached.cache),
+		}, nil
+	}
+
+	treeHash, err := resolveTreeHash(commitHash)
+	if err != nil {
+		return tree, err
+	}
+	entries, err := listTreeEntries(treeHash, "", true)
+	if err != nil {
+		return tree, err
+	}
+
+	for _, entry := range entries {
+		tree.files[entry.name] = entry.hash
+		if entry.objType == "commit" {
+			tree.gitlinks[entry.name] = true
+		}
+	}
+	tree.cache["."] = treeHash
+
+	return tree, nil
+}
+
+// importCommit handles: commit <ref>, mark?, original-oid?, author?,
+// committer, encoding?, data, from?, merge*, then file commands.
+func (imp *fastImporter) importCommit() error {
+	refPath := strings.TrimPrefix(imp.line, "commit ")
+	if !strings.HasPrefix(refPath, "refs/") {
+		return fmt.Errorf("invalid ref in commit command: %s", refPath)
+	}
+	if err := imp.readLine(); err != nil {
+		return err
+	}
+
+	mark, err := imp.readMark()
+	if err != nil {
+		return err
+	}
+
+	var author, committer string
+	if arg, ok := strings.CutPrefix(imp.line, "author "); ok {
+		author = arg
+		if err := imp.readLine(); err != nil {
+			return err
+		}
+	}
+	committer, ok := strings.CutPrefix(imp.line, "committer ")
+	if !ok {
+		return fmt.Errorf("expected committer command, got: %s", imp.line)
+	}
+	if author == "" {
+		author = committer
+	}
+	if err := imp.readLine(); err != nil {
+		return err
+	}
+	if strings.HasPrefix(imp.line, "encoding ") {
+		if err := imp.readLine(); err != nil {
+			return err
+		}
+	}
+
+	message, err := imp.readData()
+	if err != nil {
+		return err
+	}
+
+	// without from, a commit continues the ref
+	var parents [][]byte
+	if arg, ok := strings.CutPrefix(imp.line, "from "); ok {
+		from, err := imp.resolveCommitish(arg)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, from)
+		if err := imp.readLine(); err != nil {
+			return err
+		}
+	} else if tip, err := imp.refTip(refPath); err != nil {
+		return err
+	} else if tip != nil {
+		parents = append(parents, tip)
+	}
+
+	for {
+		arg, ok := strings.CutPrefix(imp.line, "merge ")
+		if !ok {
+			break
+		}
+		parent, err := imp.resolveCommitish(arg)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, parent)
+		if err := imp.readLine(); err != nil {
+			return err
+		}
+	}
+
+	var base []byte
+	if len(parents) > 0 {
+		base = parents[0]
+	}
+	tree, err := imp.treeOf(refPath, base)
+	if err != nil {
+		return err
+	}
+
+	if err := imp.applyFileCommands(&tree); err != nil {
+		return err
+	}
+
+	treeHash, err := buildTreeRecursive(tree.files, ".", tree.gitlinks, tree.cache, writeTreeObject)
+	if err != nil {
+		return err
+	}
+
+	commitHash, err := writeCommitObjectAs(treeHash, parents, author, committer, strings.TrimSuffix(string(message), "\n"))
+	if err != nil {
+		return err
+	}
+	imp.stats.commits++
+
+	if mark != 0 {
+		imp.marks[mark] = commitHash
+	}
+	imp.refs[refPath] = commitHash
+	imp.trees[refPath] = tree
+
+	return nil
+}
+
+// applyFileCommands applies the M, D, C, R, and deleteall commands that
+// end a commit to its file list.
+func (imp *fastImporter) applyFileCommands(tree *fastImportTree) error {
+	var changes []fileChange
+
+	remove := func(path string) {
+		for file := range tree.files {
+			if file == path || strings.HasPrefix(file, path+"/") {
+				delete(tree.files, file)
+				delete(tree.gitlinks, file)
+				changes = append(changes, fileChange{path: file})
+			}
+		}
+	}
+
+	for !imp.eof {
+		command, rest, _ := strings.Cut(imp.line, " ")
+
+		switch command {
+		case "M":
+			fields := strings.SplitN(rest, " ", 3)
+			if len(fields) != 3 {
+				return fmt.Errorf("invalid filemodify command: %s", imp.line)
+			}
+			mode, dataref := fields[0], fields[1]
+			path, err := fastImportPath(fields[2])
+			if err != nil {
+				return err
+			}
+
+			var hash []byte
+			switch {
+			case dataref == "inline":
+				if err := imp.readLine(); err != nil {
+					return err
+				}
+				content, err := imp.readData()
+				if err != nil {
+					return err
+				}
+				if hash, err = createObject(content); err != nil {
+					return err
+				}
+				imp.stats.blobs++
+			case strings.HasPrefix(dataref, ":"):
+				mark, err := strconv.Atoi(dataref[1:])
+				if err != nil || imp.marks[mark] == nil {
+					return fmt.Errorf("unknown mark: %s", dataref)
+				}
+				hash = imp.marks[mark]
+			default:
+				if hash, err = hex.DecodeString(dataref); err != nil {
+					return fmt.Errorf("invalid object id: %s", dataref)
+				}
+			}
+
+			switch mode {
+			case "100644", "644", "100755", "755", "120000":
+				// modes other than a plain file are not kept
+				delete(tree.gitlinks, path)
+			case "160000":
+				tree.gitlinks[path] = true
+			default:
+				return fmt.Errorf("unsupported file mode %s for %s", mode, path)
+			}
+
+			remove(path) // a file may replace a directory
+			tree.files[path] = hash
+			changes = append(changes, fileChange{path: path})
+
+			if dataref == "inline" {
+				continue // readData already moved to the next command
+			}
+		case "D":
+			path, err := fastImportPath(rest)
+			if err != nil {
+				return err
+			}
+			remove(path)
+		case "C", "R":
+			src, dst, err := fastImportPathPair(rest)
+			if err != nil {
+				return err
+			}
+
+			copied := make(map[string][]byte)
+			for file, hash := range tree.files {
+				if file == src {
+					copied[dst] = hash
+				} else if sub, ok := strings.CutPrefix(file, src+"/"); ok {
+					copied[dst+"/"+sub] = hash
+				}
+			}
+			if len(copied) == 0 {
+				return fmt.Errorf("path %s not in commit", src)
+			}
+
+			gitlinks := make(map[string]bool)
+			for file := range copied {
+				src := src + strings.TrimPrefix(file, dst)
+				gitlinks[file] = tree.gitlinks[src]
+			}
+
+			if command == "R" {
+				remove(src)
+			}
+			remove(dst)
+			for file, hash := range copied {
+				tree.files[file] = hash
+				if gitlinks[file] {
+					tree.gitlinks[file] = true
+				}
+				changes = append(changes, fileChange{path: file})
+			}
+		case "deleteall":
+			for file := range tree.files {
+				changes = append(changes, fileChange{path: file})
+			}
+			clear(tree.files)
+			clear(tree.gitlinks)
+		default:
+			// any other command starts the next section
+			invalidateCacheTree(tree.cache, changes)
+			return nil
+		}
+
+		if err := imp.readLine(); err != nil {
+			return err
+		}
+	}
+
+	invalidateCacheTree(tree.cache, changes)
+	return nil
+}
+
+// importReset handles: reset <ref>, from?. Without from the ref is
+// dropped from the stream's updates, so the next commit starts a new root.
+func (imp *fastImporter) importReset() error {
+	refPath := strings.TrimPrefix(imp.line, "reset ")
+	if !strings.HasPrefix(refPath, "refs/") {
+		return fmt.Errorf("invalid ref in reset command: %s", refPath)
+	}
+	if err := imp.readLine(); err != nil {
+		return err
+	}
+
+	arg, ok := strings.CutPrefix(imp.line, "from ")
+	if !ok {
+		imp.refs[refPath] = nil
+		delete(imp.trees, refPath)
+		return nil
+	}
+
+	hash, err := imp.resolveCommitish(arg)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(imp.refs[refPath], hash) {
+		delete(imp.trees, refPath)
+	}
+	imp.refs[refPath] = hash
+
+	return imp.readLine()
+}
+
+// importTag handles: tag <name>, mark?, from, original-oid?, tagger?,
+// data. mygit tags are plain refs, so the tag message is not kept.
+func (imp *fastImporter) importTag() error {
+	name := strings.TrimPrefix(imp.line, "tag ")
+	if err := imp.readLine(); err != nil {
+		return err
+	}
+	if _, err := imp.readMark(); err != nil {
+		return err
+	}
+
+	arg, ok := strings.CutPrefix(imp.line, "from ")
+	if !ok {
+		return fmt.Errorf("expected from command in tag %s, got: %s", name, imp.line)
+	}
+	hash, err := imp.resolveCommitish(arg)
+	if err != nil {
+		return err
+	}
+	if err := imp.readLine(); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(imp.line, "original-oid ") {
+		if err := imp.readLine(); err != nil {
+			return err
+		}
+	}
+	if strings.HasPrefix(imp.line, "tagger ") {
+		if err := imp.readLine(); err != nil {
+			return err
+		}
+	}
+	if _, err := imp.readData(); err != nil {
+		return err
+	}
+
+	imp.refs["refs/tags/"+name] = hash
+	return nil
+}
+
+// updateRefs writes the refs set by the stream. An existing ref that the
+// new commit does not descend from is refused unless forced.
+func (imp *fastImporter) updateRefs() error {
+	var rejected []string
+
+	for _, refPath := range slices.Sorted(maps.Keys(imp.refs)) {
+		hash := imp.refs[refPath]
+		if hash == nil {
+			continue // reset without a commit on top
+		}
+
+		old, err := readRefIfExists(refPath)
+		if err != nil {
+			return err
+		}
+		if slices.Equal(old, hash) {
+			continue
+		}
+		if old != nil && !imp.force {
+			if ok, err := isAncestor(old, hash); err != nil {
+				return err
+			} else if !ok {
+				rejected = append(rejected, refPath)
+				continue
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fmt.Sprintf("%s/%s", commonDir, refPath)), 0755); err != nil {
+			return fmt.Errorf("error creating ref directory: %w", err)
+		}
+		if err := compareAndSwapRef(refPath, old, hash); err != nil {
+			return err
+		}
+		imp.stats.refs = append(imp.stats.refs, refPath)
+	}
+
+	if len(rejected) > 0 {
+		return fmt.Errorf("not updating %s: the imported commits do not descend from the current ones (use --force)", strings.Join(rejected, ", "))
+	}
+
+	return nil
+}
+
+// fastImportPath decodes a path that may be C-style quoted, refusing one
+// the index could not hold.
+func fastImportPath(s string) (string, error) {
+	path := s
+	if strings.HasPrefix(s, `"`) {
+		var err error
+		if path, err = strconv.Unquote(s); err != nil {
+			return "", fmt.Errorf("invalid quoted path: %s", s)
+		}
+	}
+
+	if err := checkIndexPath(path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// fastImportPathPair splits the source and destination of a copy or
+// rename. An unquoted source cannot contain a space.
+func fastImportPathPair(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		prefix, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid quoted path: %s", s)
+		}
+		src, _ := strconv.Unquote(prefix)
+		dst, err := fastImportPath(strings.TrimPrefix(s[len(prefix):], " "))
+		return src, dst, err
+	}
+
+	src, dst, ok := strings.Cut(s, " ")
+	if !ok {
+		return "", "", fmt.Errorf("missing destination path: %s", s)
+	}
+	dst, err := fastImportPath(dst)
+
+	return src, dst, err
+}
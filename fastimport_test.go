@@ -0,0 +1,89 @@
+package mygit
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFastImport(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	stream := strings.Join([]string{
+		"# a comment",
+		"blob", "mark :1", "data 6", "hello", "",
+		"commit refs/heads/main", "mark :2",
+		"author A U Thor <author@example.com> 1700000000 +0100",
+		"committer C O Mitter <committer@example.com> 1700000000 +0100",
+		"data 6", "first",
+		"M 100644 :1 docs/readme.txt",
+		"M 100644 inline src/main.go", "data <<EOF", "package main", "EOF",
+		"",
+		"commit refs/heads/main", "mark :3",
+		"committer C O Mitter <committer@example.com> 1700000100 +0100",
+		"data 7", "second",
+		"R docs/readme.txt README",
+		"D src",
+		"",
+		"reset refs/heads/topic", "from :2", "",
+		"tag v1", "from :2", "tagger T <t@example.com> 1700000000 +0000", "data 8", "release", "",
+		"done", "",
+	}, "\n")
+
+	stats, err := fastImport(strings.NewReader(stream), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.blobs)
+	assert.Equal(t, 2, stats.commits)
+	assert.Equal(t, []string{"refs/heads/main", "refs/heads/topic", "refs/tags/v1"}, stats.refs)
+
+	main, err := getRef("refs/heads/main")
+	assert.NoError(t, err)
+	first, err := getRef("refs/heads/topic")
+	assert.NoError(t, err)
+	tag, err := getRef("refs/tags/v1")
+	assert.NoError(t, err)
+	assert.Equal(t, first, tag)
+
+	obj, err := catFile(first)
+	assert.NoError(t, err)
+	commit := obj.(commitObject)
+	assert.Equal(t, "A U Thor <author@example.com> 1700000000 +0100", commit.author)
+	assert.Equal(t, "first", commit.message)
+	assert.Empty(t, commit.parents)
+
+	files, err := fastExportFiles(commit.hash)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docs/readme.txt", "src/main.go"}, slices.Sorted(maps.Keys(files)))
+	assert.Equal(t, hashObject([]byte("package main\n")), files["src/main.go"].hash)
+
+	// without a from command the second commit continued main
+	obj, err = catFile(main)
+	assert.NoError(t, err)
+	commit = obj.(commitObject)
+	assert.Equal(t, [][]byte{first}, commit.parents)
+	assert.Equal(t, commit.author, commit.committer)
+
+	files, err = fastExportFiles(commit.hash)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"README"}, slices.Sorted(maps.Keys(files)))
+	assert.Equal(t, hashObject([]byte("hello\n")), files["README"].hash)
+
+	// a stream that would rewind main is refused unless forced
+	rewind := "reset refs/heads/main\nfrom " + fmt.Sprintf("%x", first) + "\n"
+	_, err = fastImport(strings.NewReader(rewind), false)
+	assert.ErrorContains(t, err, "refs/heads/main")
+
+	_, err = fastImport(strings.NewReader(rewind), true)
+	assert.NoError(t, err)
+	main, err = getRef("refs/heads/main")
+	assert.NoError(t, err)
+	assert.Equal(t, first, main)
+}
@@ -0,0 +1,64 @@
+package mygit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runFilter pipes content at filePath through the clean or smudge command
+// (kind) of the filter driver its filter attribute names. The driver is
+// configured with "config filter.<driver>.clean <command>" and
+// "filter.<driver>.smudge"; "%f" in a command stands for the quoted path.
+// A missing command leaves content as it is, and a failing one is warned
+// about and does the same, unless "filter.<driver>.required" is true, in
+// which case both are errors.
+func (c contentConversion) runFilter(filePath, kind string, content []byte) ([]byte, error) {
+	driver := c.attrs.get(filePath, "filter")
+	if driver == attrUnspecified || driver == attrSet || driver == attrUnset {
+		return content, nil
+	}
+
+	required := false
+	if value, err := getConfig(string(driver) + ".required"); err == nil {
+		required = strings.EqualFold(value, "true")
+	}
+
+	command, err := getConfig(string(driver) + "." + kind)
+	if err != nil {
+		if required {
+			return nil, fmt.Errorf("filter %s has no %s command but is required", driver, kind)
+		}
+		return content, nil
+	}
+	command = strings.ReplaceAll(command, "%f", shellQuote(filePath))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = workTreeRoot
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("exit code %d: %s", exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+		if required {
+			return nil, fmt.Errorf("%s filter %s failed for %s: %w", kind, driver, filePath, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "warning: %s filter %s failed for %s: %v\n", kind, driver, filePath, err)
+		return content, nil
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// shellQuote quotes s as one word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
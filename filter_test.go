@@ -0,0 +1,66 @@
+package mygit
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentFilters(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("filters need sh")
+	}
+
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("rot13.clean", "tr a-z n-za-m"))
+		assert.NoError(t, updateConfig("rot13.smudge", "tr a-z n-za-m"))
+		assert.NoError(t, updateConfig("name.clean", "cat >/dev/null; echo %f"))
+		assert.NoError(t, os.WriteFile(attributesFileName, []byte("*.secret filter=rot13\n*.name filter=name\n"), 0644))
+		assert.NoError(t, os.WriteFile("key.secret", []byte("hello\n"), 0644))
+		assert.NoError(t, os.WriteFile("it's.name", []byte("anything\n"), 0644))
+
+		_, _, err := addPaths(t.Context(), []string{"key.secret", "it's.name"}, addOptions{})
+		assert.NoError(t, err)
+		index, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, hashObject([]byte("uryyb\n")), index["key.secret"])
+		assert.Equal(t, hashObject([]byte("it's.name\n")), index["it's.name"])
+
+		// status compares the cleaned content
+		modified, _, err := compareIndexToWorkingTree(t.Context(), index)
+		assert.NoError(t, err)
+		assert.Empty(t, modified)
+
+		// checkout smudges the blob back
+		attributesBlob, err := createObject([]byte("*.secret filter=rot13\n"))
+		assert.NoError(t, err)
+		tree, err := writeIndexTree(map[string][]byte{attributesFileName: attributesBlob, "key.secret": index["key.secret"]})
+		assert.NoError(t, err)
+		assert.NoError(t, os.Remove("key.secret"))
+		_, err = buildIndexFromTree(t.Context(), tree, "", true)
+		assert.NoError(t, err)
+		content, err := os.ReadFile("key.secret")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello\n", string(content))
+
+		// a failing filter passes content through, unless it is required
+		assert.NoError(t, updateConfig("broken.clean", "exit 3"))
+		assert.NoError(t, os.WriteFile("a.broken", []byte("plain\n"), 0644))
+		conv, err := newContentConversion(parseAttributes([]byte("*.broken filter=broken\n")))
+		assert.NoError(t, err)
+		hash, err := conv.hashWorkTreeFile(t.Context(), "a.broken", false)
+		assert.NoError(t, err)
+		assert.Equal(t, hashObject([]byte("plain\n")), hash)
+
+		assert.NoError(t, updateConfig("broken.required", "true"))
+		_, err = conv.hashWorkTreeFile(t.Context(), "a.broken", false)
+		assert.ErrorContains(t, err, "clean filter broken failed for a.broken: exit code 3")
+		_, err = conv.toWorkTree(t.Context(), "a.broken", []byte("plain\n"))
+		assert.ErrorContains(t, err, "filter broken has no smudge command but is required")
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
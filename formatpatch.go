@@ -0,0 +1,221 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// patchFromLine starts every patch, so a file of several patches can be
+// split like an mbox. The date is the fixed one git uses for this line.
+const patchFromLine = "From %x Mon Sep 17 00:00:00 2001\n"
+
+// patchDateLayout is the RFC 2822 date format of the Date header.
+const patchDateLayout = "Mon, 2 Jan 2006 15:04:05 -0700"
+
+// patchFileNameChars matches runs of characters left out of patch file names.
+var patchFileNameChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// formattedPatch is one commit rendered as an email.
+type formattedPatch struct {
+	fileName string
+	content  string
+}
+
+// splitIdent splits an identity into its "Name <email>" part and the time
+// that follows it. Identities without a time (mygit records none) get the
+// Unix epoch.
+func splitIdent(ident string) (string, time.Time) {
+	if !identTimestamp.MatchString(ident) {
+		return ident, time.Unix(0, 0).UTC()
+	}
+
+	fields := strings.Fields(ident)
+	who := strings.Join(fields[:len(fields)-2], " ")
+	seconds, _ := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	offset := fields[len(fields)-1]
+
+	hours, _ := strconv.Atoi(offset[1:3])
+	minutes, _ := strconv.Atoi(offset[3:5])
+	zoneOffset := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		zoneOffset = -zoneOffset
+	}
+
+	return who, time.Unix(seconds, 0).In(time.FixedZone("", zoneOffset))
+}
+
+// patchCommits returns the commits to format for a range argument: either
+// "<since>", meaning since..HEAD, or "<a>..<b>". Merge commits are left
+// out, and the rest are ordered so every commit comes after its parents.
+func patchCommits(ctx context.Context, rangeArg string) ([][]byte, error) {
+	since, until, ok := strings.Cut(rangeArg, "..")
+	if !ok {
+		until = "HEAD"
+	}
+	if until == "" {
+		until = "HEAD"
+	}
+
+	start, err := resolveRevision(since)
+	if err != nil {
+		return nil, err
+	}
+	end, err := resolveRevision(until)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := commitsBetween(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := loadCommitGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	generations := make(map[string]int)
+	var patches [][]byte
+	for _, hash := range commits {
+		parents, err := graph.parentsOf(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if len(parents) > 1 {
+			continue // a merge has no single diff to send
+		}
+
+		if generations[string(hash)], err = graph.generation(ctx, hash); err != nil {
+			return nil, err
+		}
+		patches = append(patches, hash)
+	}
+
+	slices.SortStableFunc(patches, func(a, b []byte) int {
+		return generations[string(a)] - generations[string(b)]
+	})
+
+	return patches, nil
+}
+
+// formatPatch renders a commit as an email: From, Date, and Subject
+// headers, the rest of the message, a diffstat, and the diff against the
+// commit's parent.
+func formatPatch(ctx context.Context, hash []byte, number, total int) (formattedPatch, error) {
+	commit, err := readCommit(hash)
+	if err != nil {
+		return formattedPatch{}, err
+	}
+
+	oldIndex := map[string][]byte{}
+	if len(commit.parents) > 0 {
+		if oldIndex, err = commitIndex(ctx, commit.parents[0]); err != nil {
+			return formattedPatch{}, err
+		}
+	}
+	newIndex, err := commitIndex(ctx, hash)
+	if err != nil {
+		return formattedPatch{}, err
+	}
+
+	readBlob, err := gitlinkAwareReader(oldIndex, newIndex)
+	if err != nil {
+		return formattedPatch{}, err
+	}
+	stats, err := diffStat(oldIndex, newIndex, readBlob)
+	if err != nil {
+		return formattedPatch{}, err
+	}
+	diff, err := formatIndexDiff(oldIndex, newIndex, readBlob)
+	if err != nil {
+		return formattedPatch{}, err
+	}
+
+	subject, body, _ := strings.Cut(commit.message, "\n")
+	body = strings.TrimSpace(body)
+
+	prefix := "[PATCH]"
+	if total > 1 {
+		prefix = fmt.Sprintf("[PATCH %d/%d]", number, total)
+	}
+
+	author, date := splitIdent(commit.author)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(patchFromLine, hash))
+	sb.WriteString(fmt.Sprintf("From: %s\n", author))
+	sb.WriteString(fmt.Sprintf("Date: %s\n", date.Format(patchDateLayout)))
+	sb.WriteString(fmt.Sprintf("Subject: %s %s\n", prefix, subject))
+	sb.WriteString("\n")
+	if body != "" {
+		sb.WriteString(body + "\n\n")
+	}
+	sb.WriteString("---\n")
+	sb.WriteString(formatDiffStat(stats))
+	sb.WriteString("\n")
+	sb.WriteString(diff)
+	sb.WriteString("-- \n" + vcsName + "\n\n")
+
+	return formattedPatch{fileName: patchFileName(number, subject), content: sb.String()}, nil
+}
+
+// patchFileName returns "NNNN-<subject>.patch", the subject reduced to
+// letters, digits, and dashes.
+func patchFileName(number int, subject string) string {
+	slug := strings.Trim(patchFileNameChars.ReplaceAllString(subject, "-"), "-")
+	if len(slug) > 52 {
+		slug = strings.TrimRight(slug[:52], "-")
+	}
+
+	return fmt.Sprintf("%04d-%s.patch", number, slug)
+}
+
+// formatPatches renders every commit of the range as a patch.
+func formatPatches(ctx context.Context, rangeArg string) ([]formattedPatch, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	commits, err := patchCommits(ctx, rangeArg)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []formattedPatch
+	for i, hash := range commits {
+		patch, err := formatPatch(ctx, hash, i+1, len(commits))
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, patch)
+	}
+
+	return patches, nil
+}
+
+// writePatchFiles writes each patch to its own file in dir and returns the
+// paths written.
+func writePatchFiles(patches []formattedPatch, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", dir, err)
+	}
+
+	var paths []string
+	for _, patch := range patches {
+		path := filepath.Join(dir, patch.fileName)
+		if err := os.WriteFile(path, []byte(patch.content), 0644); err != nil {
+			return paths, fmt.Errorf("error writing %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,91 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatPatches(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "patch@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	commit := func(content, message string, parents ...[]byte) []byte {
+		blobHash, err := createObject([]byte(content))
+		assert.NoError(t, err)
+		treeHash, err := buildTreeObject(map[string][]byte{"notes.txt": blobHash})
+		assert.NoError(t, err)
+		hash, err := writeCommitObject(treeHash, parents, message)
+		assert.NoError(t, err)
+		return hash
+	}
+
+	base := commit("one\n", "base")
+	first := commit("one\ntwo\n", "Add line two: the sequel\n\nIt was missing.", base)
+	second := commit("one\n2\n", "Fix line two", first)
+	assert.NoError(t, updateRef("refs/heads/main", second))
+
+	patches, err := formatPatches(t.Context(), fmt.Sprintf("%x", base))
+	assert.NoError(t, err)
+	assert.Len(t, patches, 2)
+
+	assert.Equal(t, "0001-Add-line-two-the-sequel.patch", patches[0].fileName)
+	assert.Equal(t, "0002-Fix-line-two.patch", patches[1].fileName)
+
+	expected := strings.Join([]string{
+		fmt.Sprintf("From %x Mon Sep 17 00:00:00 2001", first),
+		"From: Author <patch@example.com>",
+		"Date: Thu, 1 Jan 1970 00:00:00 +0000",
+		"Subject: [PATCH 1/2] Add line two: the sequel",
+		"",
+		"It was missing.",
+		"",
+		"---",
+		" notes.txt | 1 +",
+		" 1 file changed, 1 insertion(+)",
+		"",
+		"diff --git a/notes.txt b/notes.txt",
+		fmt.Sprintf("index %s..%s", abbrevHash(hashObject([]byte("one\n"))), abbrevHash(hashObject([]byte("one\ntwo\n")))),
+		"--- a/notes.txt",
+		"+++ b/notes.txt",
+		"@@ -1 +1,2 @@",
+		" one",
+		"+two",
+		"-- ",
+		vcsName,
+		"", "",
+	}, "\n")
+	assert.Equal(t, expected, patches[0].content)
+	assert.Contains(t, patches[1].content, "Subject: [PATCH 2/2] Fix line two\n\n---\n")
+
+	// a single commit gets no numbering in its subject
+	patches, err = formatPatches(t.Context(), fmt.Sprintf("%x..%x", first, second))
+	assert.NoError(t, err)
+	assert.Len(t, patches, 1)
+	assert.Contains(t, patches[0].content, "Subject: [PATCH] Fix line two\n")
+
+	dir := t.TempDir()
+	paths, err := writePatchFiles(patches, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "0001-Fix-line-two.patch")}, paths)
+}
+
+func TestSplitIdent(t *testing.T) {
+	who, when := splitIdent("A U Thor <author@example.com> 1700000000 -0130")
+	assert.Equal(t, "A U Thor <author@example.com>", who)
+	assert.Equal(t, "Tue, 14 Nov 2023 20:43:20 -0130", when.Format(patchDateLayout))
+
+	who, when = splitIdent("Author <author@example.com>")
+	assert.Equal(t, "Author <author@example.com>", who)
+	assert.Equal(t, int64(0), when.Unix())
+}
@@ -0,0 +1,59 @@
+package mygit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// fsckReport describes what checkObjectStore found.
+type fsckReport struct {
+	checked int
+	unknown []error // objects of a type no registered kind handles
+	corrupt []error // objects that cannot be read or parsed, or whose id does not match
+}
+
+// checkObjectStore reads and parses every object in the store. Objects of
+// an unknown type are reported rather than treated as damage, since a
+// newer version may have written them; everything else that cannot be
+// parsed is corrupt.
+func checkObjectStore(ctx context.Context) (fsckReport, error) {
+	if err := checkVCSRepo(); err != nil {
+		return fsckReport{}, err
+	}
+
+	hashes, err := listObjectHashes(ctx)
+	if err != nil {
+		return fsckReport{}, err
+	}
+
+	var report fsckReport
+	for _, hash := range hashes {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.checked++
+
+		data, objType, _, err := readRawObject(hash)
+		if err == nil && !bytes.Equal(sumObject(data), hash) {
+			err = fmt.Errorf("hash mismatch, content hashes to %x", sumObject(data))
+		}
+		if err == nil {
+			_, err = parseObject(hash, objType, data)
+		}
+		if err == nil {
+			err = validateTypedObject(objType, data)
+		}
+
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrUnknownObjectType):
+			report.unknown = append(report.unknown, err)
+		default:
+			report.corrupt = append(report.corrupt, fmt.Errorf("object %x: %w", hash, err))
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,51 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectTypeRegistry(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		blobHash, err := createObject([]byte("content"))
+		assert.NoError(t, err)
+		obj, err := catFile(blobHash)
+		assert.NoError(t, err)
+		assert.Equal(t, blobObject{content: []byte("content")}, obj)
+
+		// an object of a type this version does not know
+		chunkedHash, err := writeObject("chunked-blob", []byte("chunks"))
+		assert.NoError(t, err)
+		_, err = catFile(chunkedHash)
+		var typeErr *UnknownObjectTypeError
+		if assert.ErrorAs(t, err, &typeErr) {
+			assert.Equal(t, "chunked-blob", typeErr.Type)
+			assert.Equal(t, fmt.Sprintf("%x", chunkedHash), typeErr.Hash)
+		}
+		assert.ErrorIs(t, err, ErrUnknownObjectType)
+
+		_, err = createTypedObject("chunked-blob", []byte("chunks"))
+		assert.ErrorIs(t, err, ErrUnknownObjectType)
+		assert.Error(t, validateTypedObject("commit", []byte("commit 0\x00")))
+
+		// an object stored under an id its content does not hash to
+		wrongHash := hashObject([]byte("something else"))
+		assert.NoError(t, writeObjectFile(wrongHash, []byte("blob 5\x00other")))
+
+		report, err := checkObjectStore(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, report.checked)
+		if assert.Len(t, report.unknown, 1) {
+			assert.True(t, errors.Is(report.unknown[0], ErrUnknownObjectType))
+		}
+		if assert.Len(t, report.corrupt, 1) {
+			assert.Contains(t, report.corrupt[0].Error(), "hash mismatch")
+		}
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
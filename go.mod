@@ -2,11 +2,13 @@ module github.com/KDT2006/mygit
 
 go 1.25.5
 
-require github.com/stretchr/testify v1.11.1
+require (
+	github.com/fatih/color v1.18.0
+	github.com/stretchr/testify v1.11.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fatih/color v1.18.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -0,0 +1,64 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// grepMatch represents a single matching line in a tracked file.
+type grepMatch struct {
+	path   string
+	lineNo int
+	line   string
+}
+
+// grepIndex searches the blobs referenced by index for lines matching re.
+// Matches are returned ordered by path and line number.
+func grepIndex(index map[string][]byte, re *regexp.Regexp, readBlob readBlobFunc) ([]grepMatch, error) {
+	paths := make([]string, 0, len(index))
+	for path := range index {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var matches []grepMatch
+	for _, path := range paths {
+		content, err := readBlob(index[path])
+		if err != nil {
+			return nil, fmt.Errorf("error reading blob for %s: %w", path, err)
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+		lineNo := 0
+		for scanner.Scan() {
+			lineNo++
+			if re.MatchString(scanner.Text()) {
+				matches = append(matches, grepMatch{path: path, lineNo: lineNo, line: scanner.Text()})
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error scanning %s: %w", path, err)
+		}
+	}
+
+	return matches, nil
+}
+
+// compileGrepPattern compiles the grep pattern, optionally case-insensitive.
+func compileGrepPattern(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	return re, nil
+}
@@ -0,0 +1,39 @@
+package mygit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrepIndex(t *testing.T) {
+	contents := map[string][]byte{
+		"a": []byte("hello world\nfoo\nHello again\n"),
+		"b": []byte("nothing here\n"),
+	}
+	readContent := func(hash []byte) ([]byte, error) {
+		return contents[string(hash)], nil
+	}
+	index := map[string][]byte{
+		"b.txt":     []byte("b"),
+		"dir/a.txt": []byte("a"),
+	}
+
+	re, err := compileGrepPattern("hello", false)
+	assert.NoError(t, err)
+
+	matches, err := grepIndex(index, re, readContent)
+	assert.NoError(t, err)
+	assert.Equal(t, []grepMatch{{path: "dir/a.txt", lineNo: 1, line: "hello world"}}, matches)
+
+	re, err = compileGrepPattern("hello", true)
+	assert.NoError(t, err)
+
+	matches, err = grepIndex(index, re, readContent)
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, 3, matches[1].lineNo)
+
+	_, err = compileGrepPattern("(", false)
+	assert.Error(t, err)
+}
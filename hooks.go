@@ -0,0 +1,136 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables describing the prospective commit to the
+// pre-commit hook.
+const (
+	commitTreeEnv    = "MYGIT_COMMIT_TREE"    // tree the commit would record
+	commitParentsEnv = "MYGIT_COMMIT_PARENTS" // space-separated, empty for a root commit
+	stagedFilesEnv   = "MYGIT_STAGED_FILES"   // file listing "<status>\t<path>" per staged change
+)
+
+// hookPath returns the path of the named hook script.
+func hookPath(name string) string {
+	return filepath.Join(commonDir, "hooks", name)
+}
+
+// hookExists reports whether the named hook is present and executable.
+func hookExists(name string) bool {
+	info, err := os.Stat(hookPath(name))
+	if err != nil {
+		return false
+	}
+
+	return !info.IsDir() && info.Mode().Perm()&0111 != 0
+}
+
+// runHook runs the named hook with the given arguments and extra environment
+// variables. A missing hook is not an error; a hook exiting non-zero is.
+func runHook(name string, env []string, args ...string) error {
+	if !hookExists(name) {
+		return nil
+	}
+
+	absPath, err := filepath.Abs(hookPath(name))
+	if err != nil {
+		return fmt.Errorf("error locating %s hook: %w", name, err)
+	}
+
+	cmd := exec.Command(absPath, args...)
+	cmd.Dir = workTreeRoot
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%s hook failed with exit code %d", name, exitErr.ExitCode())
+		}
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("%s hook is not executable", name)
+		}
+		return fmt.Errorf("error running %s hook: %w", name, err)
+	}
+
+	return nil
+}
+
+// runPreCommitHook runs the pre-commit hook for a commit of index on top of
+// parents, telling it the tree the commit would record, its parents, and
+// the staged changes against the first parent. The tree is hashed, not
+// written; cache holds known tree hashes of the index, or is nil.
+func runPreCommitHook(ctx context.Context, index map[string][]byte, cache map[string][]byte, parents [][]byte) error {
+	if !hookExists("pre-commit") {
+		return nil
+	}
+
+	// the hook sees every staged file, inside the sparse-checkout cone or not
+	index, err := expandSparseIndex(ctx, maps.Clone(index))
+	if err != nil {
+		return err
+	}
+
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return err
+	}
+	treeHash, err := buildTreeRecursive(index, ".", gitlinks, cache, hashTreeObject)
+	if err != nil {
+		return err
+	}
+
+	parentIndex := map[string][]byte{}
+	parentHexes := make([]string, len(parents))
+	for i, parent := range parents {
+		parentHexes[i] = hex.EncodeToString(parent)
+	}
+	if len(parents) > 0 {
+		if parentIndex, err = commitIndex(ctx, parents[0]); err != nil {
+			return err
+		}
+	}
+
+	staged, err := os.CreateTemp(gitDir, "STAGED_FILES-*")
+	if err != nil {
+		return fmt.Errorf("error creating staged file list: %w", err)
+	}
+	defer os.Remove(staged.Name())
+
+	var list strings.Builder
+	for _, change := range diffIndexes(parentIndex, index) {
+		list.WriteString(fmt.Sprintf("%c\t%s\n", change.status, filepath.ToSlash(change.path)))
+	}
+	_, err = staged.WriteString(list.String())
+	if closeErr := staged.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing staged file list: %w", err)
+	}
+
+	// the hook may run from anywhere, so hand it an absolute path
+	stagedPath, err := filepath.Abs(staged.Name())
+	if err != nil {
+		return fmt.Errorf("error locating staged file list: %w", err)
+	}
+
+	return runHook("pre-commit", []string{
+		commitTreeEnv + "=" + hex.EncodeToString(treeHash),
+		commitParentsEnv + "=" + strings.Join(parentHexes, " "),
+		stagedFilesEnv + "=" + stagedPath,
+	})
+}
@@ -0,0 +1,67 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreCommitHookContext(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "hooks@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	oldBlob, err := createObject([]byte("old\n"))
+	assert.NoError(t, err)
+	goneBlob, err := createObject([]byte("gone\n"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{"file.txt": oldBlob, "gone.txt": goneBlob})
+	assert.NoError(t, err)
+	baseHash, err := writeCommitObject(treeHash, nil, "base")
+	assert.NoError(t, err)
+	head, err := getHEAD()
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef(head, baseHash))
+
+	// stage a modification and an addition; gone.txt is not in the index
+	newBlob, err := createObject([]byte("new\n"))
+	assert.NoError(t, err)
+	addedBlob, err := createObject([]byte("added\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "file.txt", newBlob))
+	assert.NoError(t, updateIndex(t.Context(), "dir/added.txt", addedBlob))
+
+	// the hook records what it was told
+	out := filepath.Join(t.TempDir(), "context")
+	hook := fmt.Sprintf("#!/bin/sh\n{ echo \"$%s\"; echo \"$%s\"; cat \"$%s\"; } > %s\n",
+		commitTreeEnv, commitParentsEnv, stagedFilesEnv, out)
+	if err := os.MkdirAll(filepath.Dir(hookPath("pre-commit")), 0755); err != nil {
+		t.Fatalf("Failed to create hooks dir: %v", err)
+	}
+	if err := os.WriteFile(hookPath("pre-commit"), []byte(hook), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+
+	commitHash, err := createCommit(t.Context(), "change files")
+	assert.NoError(t, err)
+	commit, err := readCommit(commitHash)
+	assert.NoError(t, err)
+
+	context, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x\n%x\nA\tdir/added.txt\nM\tfile.txt\nD\tgone.txt\n", commit.hash, baseHash), string(context))
+
+	// the list does not outlive the hook
+	leftovers, err := filepath.Glob(filepath.Join(gitDir, "STAGED_FILES-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, leftovers)
+
+}
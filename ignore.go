@@ -0,0 +1,219 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the tracked file at the root of the working tree that
+// lists untracked paths to leave alone.
+const ignoreFileName = "." + vcsName + "ignore"
+
+// gitignoreFileName is git's ignore file, read as well when
+// core.readGitignore is set so repositories converted from git keep their
+// ignore rules.
+const gitignoreFileName = ".gitignore"
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	pattern  string
+	negate   bool   // "!pattern" re-includes what earlier rules ignored
+	dirOnly  bool   // "pattern/" matches directories only
+	anchored bool   // a pattern with a slash is matched from the root
+	source   string // file the rule was read from
+	line     int    // line number in source
+	text     string // the line as written
+}
+
+// ignoreRules are the rules of the ignore files, in order. The last rule
+// matching a path decides whether it is ignored.
+type ignoreRules []ignoreRule
+
+// loadIgnoreRules reads the repository's own info/exclude file, .gitignore
+// if core.readGitignore is set, and the ignore file of the working tree, in
+// that order, so a rule in the ignore file overrides one in .gitignore,
+// which overrides info/exclude. Missing files have no rules.
+func loadIgnoreRules() (ignoreRules, error) {
+	var rules ignoreRules
+
+	files := []string{filepath.Join(commonDir, "info", "exclude")}
+	if value, err := getConfig("readGitignore"); err == nil && strings.EqualFold(value, "true") {
+		files = append(files, gitignoreFileName)
+	}
+	files = append(files, ignoreFileName)
+
+	for _, file := range files {
+		content, err := os.ReadFile(workTreePath(file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file, err)
+		}
+
+		for _, rule := range parseIgnoreRules(content) {
+			rule.source = file
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// parseIgnoreRules parses ignore file content: one shell pattern per line,
+// with blank lines and lines starting with "#" skipped.
+func parseIgnoreRules(content []byte) ignoreRules {
+	var rules ignoreRules
+
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{line: i + 1, text: line}
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			rule.negate, line = true, rest
+		}
+		if rest, ok := strings.CutSuffix(line, "/"); ok {
+			rule.dirOnly, line = true, rest
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// ignored reports whether the repository-relative path is ignored. A path
+// inside an ignored directory is ignored too, whatever later rules say.
+func (r ignoreRules) ignored(filePath string, isDir bool) bool {
+	rule, ok := r.deciding(filePath, isDir)
+	return ok && !rule.negate
+}
+
+// deciding returns the rule that decides whether the repository-relative
+// path is ignored: the rule ignoring a directory above it, or else the last
+// rule matching the path itself, which may be a negated one. It reports
+// false if no rule matches.
+func (r ignoreRules) deciding(filePath string, isDir bool) (ignoreRule, bool) {
+	if len(r) == 0 {
+		return ignoreRule{}, false
+	}
+
+	filePath = filepath.ToSlash(filePath)
+	var dirs []string
+	for dir := path.Dir(filePath); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if rule, ok := r.lastMatch(dirs[i], true); ok && !rule.negate {
+			return rule, true
+		}
+	}
+
+	return r.lastMatch(filePath, isDir)
+}
+
+// lastMatch returns the last rule matching the path alone.
+func (r ignoreRules) lastMatch(filePath string, isDir bool) (ignoreRule, bool) {
+	var last ignoreRule
+	found := false
+
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		target := filePath
+		if !rule.anchored {
+			target = path.Base(filePath)
+		}
+		if matchIgnorePattern(strings.Split(rule.pattern, "/"), strings.Split(target, "/")) {
+			last, found = rule, true
+		}
+	}
+
+	return last, found
+}
+
+// ignoreMatch is the rule deciding whether one path given to check-ignore is
+// ignored.
+type ignoreMatch struct {
+	path    string
+	rule    ignoreRule
+	ignored bool // false when the rule is a negated one
+}
+
+// String formats the match as check-ignore -v prints it:
+// "<source>:<line>:<pattern>\t<path>".
+func (m ignoreMatch) String() string {
+	return fmt.Sprintf("%s:%d:%s\t%s", filepath.ToSlash(m.rule.source), m.rule.line, m.rule.text, displayPath(m.path))
+}
+
+// checkIgnore returns the deciding rule of each repository-relative path
+// that some rule matches. Unless noIndex is set, tracked paths are left out,
+// as ignore rules do not apply to them.
+func checkIgnore(ctx context.Context, paths []string, noIndex bool) ([]ignoreMatch, error) {
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []ignoreMatch
+	for _, filePath := range paths {
+		if _, tracked := index[filePath]; tracked && !noIndex {
+			continue
+		}
+
+		info, err := os.Stat(workTreePath(filePath))
+		isDir := err == nil && info.IsDir()
+
+		if rule, ok := rules.deciding(filePath, isDir); ok {
+			matches = append(matches, ignoreMatch{path: filePath, rule: rule, ignored: !rule.negate})
+		}
+	}
+
+	return matches, nil
+}
+
+// matchIgnorePattern matches path segments against pattern segments, each a
+// shell pattern. A "**" segment matches any number of segments.
+func matchIgnorePattern(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchIgnorePattern(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+
+	return matchIgnorePattern(pattern[1:], segments[1:])
+}
@@ -0,0 +1,67 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// probeIgnoreCase reports whether the filesystem holding the existing file
+// at probePath treats names differing only in case as the same file, by
+// looking the file up under its name in upper case.
+func probeIgnoreCase(probePath string) (bool, error) {
+	dir, name := filepath.Split(probePath)
+	if strings.ToUpper(name) == name {
+		return false, fmt.Errorf("cannot probe case sensitivity with %s", probePath)
+	}
+
+	_, err := os.Lstat(filepath.Join(dir, strings.ToUpper(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error probing case sensitivity: %w", err)
+	}
+
+	return true, nil
+}
+
+// ignoreCaseEnabled reports whether core.ignorecase is true, which init
+// sets on filesystems where Readme.md and README.md are one file.
+func ignoreCaseEnabled() bool {
+	value, err := getConfig("ignorecase")
+	return err == nil && strings.EqualFold(value, "true")
+}
+
+// pathFolder maps index paths, folded to lower case, to the spelling the
+// index tracks them under. It is nil when case matters, and then every
+// path is its own spelling.
+type pathFolder map[string]string
+
+// newPathFolder returns the pathFolder of index if core.ignorecase is set,
+// and nil otherwise.
+func newPathFolder(index map[string][]byte) pathFolder {
+	if !ignoreCaseEnabled() {
+		return nil
+	}
+
+	folder := make(pathFolder, len(index))
+	for indexPath := range index {
+		folder[strings.ToLower(indexPath)] = indexPath
+	}
+
+	return folder
+}
+
+// tracked returns the spelling the index tracks filePath under, or
+// filePath itself if no entry matches it.
+func (f pathFolder) tracked(filePath string) string {
+	if indexPath, ok := f[strings.ToLower(filePath)]; ok {
+		return indexPath
+	}
+
+	return filePath
+}
@@ -0,0 +1,55 @@
+package mygit
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreCase(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		// init records what the filesystem does
+		_, statErr := os.Stat(gitDir + "/CONFIG")
+		value, err := getConfig("ignorecase")
+		assert.NoError(t, err)
+		assert.Equal(t, strconv.FormatBool(statErr == nil), value)
+
+		assert.NoError(t, updateConfig("ignorecase", "true"))
+		assert.NoError(t, os.Mkdir("docs", 0755))
+		assert.NoError(t, os.WriteFile("docs/README.md", []byte("v2"), 0644))
+		assert.NoError(t, updateIndex(t.Context(), "docs/Readme.md", hashObject([]byte("v1"))))
+
+		// the entry keeps its spelling, whichever spelling is added
+		_, err = addDirectory(t.Context(), "docs", addOptions{})
+		assert.NoError(t, err)
+		_, _, err = addPaths(t.Context(), []string{"docs/README.md"}, addOptions{})
+		assert.NoError(t, err)
+		index, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"docs/Readme.md": hashObject([]byte("v2"))}, index)
+
+		hash, ok, err := lookupIndexEntry(t.Context(), "DOCS/readme.MD")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, hashObject([]byte("v2")), hash)
+
+		assert.NoError(t, removeIndexEntry(t.Context(), "docs/README.md"))
+		index, err = readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Empty(t, index)
+
+		// with case mattering again the spellings are separate paths
+		assert.NoError(t, updateConfig("ignorecase", "false"))
+		assert.NoError(t, updateIndex(t.Context(), "docs/Readme.md", hashObject([]byte("v1"))))
+		_, _, err = addPaths(t.Context(), []string{"docs/README.md"}, addOptions{})
+		assert.NoError(t, err)
+		index, err = readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Len(t, index, 2)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -1,38 +1,75 @@
-package main
+package mygit
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"io/fs"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 )
 
-// readIndex reads and parses the index file into a map.
-func readIndex() (map[string][]byte, error) {
+const (
+	cacheTreePrefix = "|TREE|" // marks cache-tree extension lines in the index
+)
+
+// readIndex reads and parses the index file into a map, with the sparse
+// directory entries of a sparse index expanded to the files they hold.
+func readIndex(ctx context.Context) (map[string][]byte, error) {
 	if err := checkVCSRepo(); err != nil {
 		return nil, err
 	}
 
+	return readIndexFile(ctx, fmt.Sprintf("%s/index", gitDir))
+}
+
+// readIndexFile parses the index file at the given path, expanding sparse
+// directory entries. A missing file is an empty index.
+func readIndexFile(ctx context.Context, indexPath string) (map[string][]byte, error) {
+	index, err := parseIndexFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return expandSparseIndex(ctx, index)
+}
+
+// parseIndexFile parses the index file at the given path as stored. A
+// missing file is an empty index.
+func parseIndexFile(indexPath string) (map[string][]byte, error) {
 	// index map represents the parsed index file
 	index := make(map[string][]byte)
 
-	f, err := os.Open(fmt.Sprintf(".%s/index", vcsName))
+	f, err := os.Open(indexPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return index, nil
 		}
-		return nil, fmt.Errorf("error opening index file: %v", err)
+		return nil, fmt.Errorf("error opening index file: %w", err)
 	}
 	defer f.Close()
 
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), cacheTreePrefix) {
+			continue // extension entry, see readCacheTree
+		}
+		if strings.HasPrefix(scanner.Text(), conflictStagePrefix) {
+			continue // extension entry, see readConflictStages
+		}
+		if scanner.Text() == sortedIndexMarker {
+			continue
+		}
+
 		parts := strings.Split(scanner.Text(), "|")
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("invalid index entry: %s", scanner.Text())
@@ -42,6 +79,9 @@ func readIndex() (map[string][]byte, error) {
 		if filepath == "" {
 			return nil, fmt.Errorf("empty filepath in index entry: %s", scanner.Text())
 		}
+		if isIndexTombstone(parts[1]) {
+			continue // removed in place
+		}
 
 		// decode hex string to byte slice
 		hash, err := hex.DecodeString(parts[1])
@@ -53,95 +93,567 @@ func readIndex() (map[string][]byte, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error scanning index file: %v", err)
+		return nil, fmt.Errorf("error scanning index file: %w", err)
 	}
 
 	return index, nil
 }
 
-// updateIndex updates the index file with the new object entry.
-func updateIndex(filepath string, dataHash []byte) error {
+// updateIndex updates the index file with the new object entry. An
+// existing entry is updated in place; a new one rewrites the index.
+func updateIndex(ctx context.Context, filepath string, dataHash []byte) error {
 	if err := checkVCSRepo(); err != nil {
 		return err
 	}
 
-	// read current index
-	index, err := readIndex()
+	return withIndexLock(func() error {
+		if done, err := setIndexEntryInPlace(filepath, dataHash); err != nil || done {
+			return err
+		}
+
+		// read current index, leaving sparse directories collapsed
+		index, err := readSparseIndex()
+		if err != nil {
+			return err
+		}
+
+		// update current index, under the entry's own spelling if
+		// core.ignorecase matches one
+		index[newPathFolder(index).tracked(filepath)] = dataHash
+
+		// write back the entire index
+		return writeIndex(ctx, index)
+	})
+}
+
+// writeIndex writes the entire index map back to the index file.
+// Cache-tree entries for directories containing changed paths are dropped.
+// With a sparse index, directories outside the sparse-checkout cone are
+// collapsed to sparse directory entries; the index may hold either form.
+func writeIndex(ctx context.Context, index map[string][]byte) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	// paths are stored with forward slashes, and only ones checkout can write
+	index, err := normalizeIndexPaths(index)
 	if err != nil {
 		return err
 	}
 
-	// update current index
-	index[filepath] = dataHash
+	cone, err := loadSparseCone()
+	if err != nil {
+		return err
+	}
+	sparse := sparseIndexEnabled(cone)
+
+	// an unreadable old index just means there is no cache to carry over
+	cache, err := readCacheTree()
+	if err != nil {
+		cache = nil
+	}
 
-	// write back the entire index
-	return writeIndex(index)
+	if cache != nil {
+		oldIndex, err := parseIndexFile(fmt.Sprintf("%s/index", gitDir))
+		if err != nil {
+			cache = nil
+		} else {
+			invalidateCacheTree(cache, diffIndexes(oldIndex, index))
+		}
+	}
+
+	if sparse {
+		if index, err = collapseSparseIndex(index, cone, cache); err != nil {
+			return err
+		}
+	} else if slices.ContainsFunc(slices.Collect(maps.Keys(index)), isSparseDirEntry) {
+		if index, err = expandSparseIndex(ctx, maps.Clone(index)); err != nil {
+			return err
+		}
+	}
+
+	return writeIndexFile(index, cache)
 }
 
-// writeIndex writes the entire index map back to the index file.
-func writeIndex(index map[string][]byte) error {
+// heldIndexLocks records, by absolute path, the index files whose
+// index.lock this process holds, so the index writes of one operation
+// share its lock instead of tripping over it. Operations on one
+// repository run one at a time, so a held lock is always the caller's own.
+var heldIndexLocks = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// withIndexLock runs fn holding index.lock. The lock is created
+// exclusively, so a second process updating the index at the same time
+// fails at once with a message naming the lock, rather than writing over
+// this one's entries. Nested calls share the outermost lock.
+func withIndexLock(fn func() error) error {
 	if err := checkVCSRepo(); err != nil {
 		return err
 	}
 
-	f, err := os.Create(fmt.Sprintf(".%s/index", vcsName))
+	indexPath, err := filepath.Abs(fmt.Sprintf("%s/index", gitDir))
 	if err != nil {
-		return fmt.Errorf("error creating index file: %v", err)
+		return err
 	}
-	defer f.Close()
 
-	for filepath, hash := range index {
-		_, err := fmt.Fprintf(f, "%s|%x\n", filepath, hash)
+	heldIndexLocks.Lock()
+	held := heldIndexLocks.paths[indexPath]
+	heldIndexLocks.Unlock()
+	if held {
+		return fn()
+	}
+
+	lock, err := acquireLockFile(indexPath)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	heldIndexLocks.Lock()
+	heldIndexLocks.paths[indexPath] = true
+	heldIndexLocks.Unlock()
+	defer func() {
+		heldIndexLocks.Lock()
+		delete(heldIndexLocks.paths, indexPath)
+		heldIndexLocks.Unlock()
+	}()
+
+	return fn()
+}
+
+// writeIndexFile writes the index entries followed by the cache-tree
+// extension. The conflict stages of a path are kept until the path is
+// staged again.
+func writeIndexFile(index map[string][]byte, cache map[string][]byte) error {
+	return withIndexLock(func() error {
+		stages, err := readConflictStages()
+		if err != nil {
+			return err
+		}
+		for filePath := range index {
+			delete(stages, filePath)
+		}
+
+		return writeIndexEntries(index, cache, stages)
+	})
+}
+
+// writeIndexEntries writes the index entries followed by the cache-tree and
+// conflict stage extensions, all sorted so single entries can be found by
+// binary search. The entries go to a temporary file that is renamed over
+// the index, under index.lock, so readers see either the old index or the
+// new one.
+func writeIndexEntries(index, cache map[string][]byte, stages map[string]conflictStages) error {
+	return withIndexLock(func() error {
+		f, err := createTempFile(gitDir, "index-*.tmp")
+		if err != nil {
+			return fmt.Errorf("error creating index file: %w", err)
+		}
+		defer os.Remove(f.Name()) // no-op once the file has been moved into place
+		defer f.Close()
+
+		w := bufio.NewWriter(f)
+		if _, err := fmt.Fprintln(w, sortedIndexMarker); err != nil {
+			return fmt.Errorf("error writing to index file: %w", err)
+		}
+
+		for _, filepath := range slices.Sorted(maps.Keys(index)) {
+			_, err := fmt.Fprintf(w, "%s|%x\n", filepath, index[filepath])
+			if err != nil {
+				return fmt.Errorf("error writing to index file: %w", err)
+			}
+		}
+
+		for _, dir := range slices.Sorted(maps.Keys(cache)) {
+			_, err := fmt.Fprintf(w, "%s%s|%x\n", cacheTreePrefix, dir, cache[dir])
+			if err != nil {
+				return fmt.Errorf("error writing to index file: %w", err)
+			}
+		}
+
+		if err := writeConflictStages(w, stages); err != nil {
+			return err
+		}
+
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("error writing to index file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("error writing to index file: %w", err)
+		}
+		if err := adjustSharedPerm(f.Name()); err != nil {
+			return err
+		}
+
+		if err := os.Rename(f.Name(), fmt.Sprintf("%s/index", gitDir)); err != nil {
+			return fmt.Errorf("error replacing index file: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// readCacheTree reads the cache-tree extension of the index file, which maps
+// directory paths ("." for the root) to the tree hash last built for them.
+func readCacheTree() (map[string][]byte, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	cache := make(map[string][]byte)
+
+	content, err := os.ReadFile(fmt.Sprintf("%s/index", gitDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("error reading index file: %w", err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		entry, ok := strings.CutPrefix(line, cacheTreePrefix)
+		if !ok {
+			continue
+		}
+
+		dir, hexHash, ok := strings.Cut(entry, "|")
+		if !ok || dir == "" {
+			return nil, fmt.Errorf("invalid cache-tree entry: %s", line)
+		}
+		if isIndexTombstone(hexHash) {
+			continue // invalidated in place
+		}
+
+		hash, err := hex.DecodeString(hexHash)
 		if err != nil {
-			return fmt.Errorf("error writing to index file: %v", err)
+			return nil, fmt.Errorf("error decoding cache-tree hash for %s: %w", dir, err)
 		}
+
+		cache[dir] = hash
 	}
 
-	return nil
+	return cache, nil
 }
 
-// addDirectory adds all the files within the given directory to the staging area.
-func addDirectory(dirPath string) error {
-	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+// invalidateCacheTree removes the cached tree of every directory that
+// contains one of the changed paths, up to and including the root.
+func invalidateCacheTree(cache map[string][]byte, changes []fileChange) {
+	for _, change := range changes {
+		dir := change.path
+		for dir != "." {
+			dir = path.Dir(dir)
+			delete(cache, dir)
+		}
+	}
+}
+
+// specialFileModes are the file types add never stages: reading a FIFO
+// would block, and sockets and devices have no content to record.
+const specialFileModes = fs.ModeNamedPipe | fs.ModeSocket | fs.ModeDevice | fs.ModeCharDevice | fs.ModeIrregular
+
+// addFailure is a file add could not stage.
+type addFailure struct {
+	path string
+	err  error
+}
+
+// addOptions controls how add stages files.
+type addOptions struct {
+	ignoreErrors bool      // skip unreadable files and report them instead of stopping
+	dryRun       bool      // only report what would be staged, writing nothing
+	verbose      bool      // report each path whose entry changes
+	progress     io.Writer // where adding a directory reports progress, if anywhere
+}
+
+// stageFile stages the file at path, or with options.dryRun only hashes it,
+// and reports whether its index entry changes.
+func stageFile(ctx context.Context, path string, options addOptions) (bool, error) {
+	oldHash, _, err := lookupIndexEntry(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return false, err
+	}
+
+	dataHash, err := conv.hashWorkTreeFile(ctx, path, !options.dryRun)
+	if err != nil {
+		return false, err
+	}
+
+	if slices.Equal(oldHash, dataHash) {
+		return false, nil
+	}
+
+	if options.verbose || options.dryRun {
+		fmt.Printf("add '%s'\n", displayPath(path))
+	}
+	if options.dryRun {
+		return true, nil
+	}
+
+	if err := updateIndex(ctx, path, dataHash); err != nil {
+		return false, fmt.Errorf("error updating index for file %s: %w", path, err)
+	}
+
+	return true, nil
+}
+
+// addDirectory adds all the files within the given directory to the
+// staging area. Untracked files matching the ignore rules are left out, and
+// special files (sockets, FIFOs, devices) are skipped with a warning. A
+// file or directory that cannot be read stops the add, unless
+// options.ignoreErrors is set, in which case it is skipped and returned
+// among the failures. The files are hashed in parallel and the index is
+// written once at the end, so a failed add stages none of them. The add
+// stops with ctx's error once ctx is done.
+func addDirectory(ctx context.Context, dirPath string, options addOptions) ([]addFailure, error) {
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, err
+	}
+	tracked, err := readSparseIndex()
+	if err != nil {
+		return nil, err
+	}
+	cone, err := loadSparseCone()
+	if err != nil {
+		return nil, err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return nil, err
+	}
+	folder := newPathFolder(tracked)
+
+	var failures []addFailure
+	var files []string
+	fail := func(path string, err error) error {
+		if !options.ignoreErrors {
+			return err
+		}
+		failures = append(failures, addFailure{path: path, err: err})
+		return nil
+	}
+
+	err = walkWorkTree(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err != nil {
+			if d != nil && d.IsDir() && path != dirPath {
+				// an unreadable directory is reported once and left out
+				if err := fail(path, err); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
 			return err
 		}
 
-		if d.IsDir() && d.Name() == "."+vcsName {
-			return filepath.SkipDir // skip VCS dir
+		if isVCSEntry(path, d) {
+			return skipWalkEntry(d) // skip VCS dir
+		}
+
+		if !cone.containsEntry(path, d.IsDir()) {
+			return skipWalkEntry(d) // outside the sparse-checkout cone
+		}
+
+		if _, ok := tracked[folder.tracked(path)]; !ok && !d.IsDir() && rules.ignored(path, false) {
+			return nil
+		}
+
+		if d.IsDir() && isNestedRepository(path) {
+			return addNestedRepository(ctx, path, options)
+		}
+
+		if d.Type()&specialFileModes != 0 {
+			fmt.Printf("warning: skipping special file %s\n", displayPath(path))
+			return nil
 		}
 
 		if !d.IsDir() {
-			content, err := os.ReadFile(path)
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return failures, fmt.Errorf("error adding directory %s: %w", dirPath, err)
+	}
+
+	changes := make(map[string][]byte)
+	for _, file := range hashFilesParallel(ctx, files, conv, options) {
+		if file.path == "" {
+			break // left out after a failure
+		}
+		if file.err != nil {
+			if err := fail(file.path, file.err); err != nil {
+				return failures, fmt.Errorf("error adding directory %s: %w", dirPath, err)
+			}
+			continue
+		}
+		indexPath := folder.tracked(file.path)
+		if slices.Equal(tracked[indexPath], file.hash) {
+			continue
+		}
+
+		if options.verbose || options.dryRun {
+			fmt.Printf("add '%s'\n", displayPath(indexPath))
+		}
+		changes[indexPath] = file.hash
+	}
+
+	if options.dryRun || len(changes) == 0 {
+		return failures, nil
+	}
+
+	// nested repositories may have been staged while walking
+	index, err := readSparseIndex()
+	if err != nil {
+		return failures, err
+	}
+	maps.Copy(index, changes)
+
+	if err := writeIndex(ctx, index); err != nil {
+		return failures, fmt.Errorf("error updating index: %w", err)
+	}
+
+	return failures, nil
+}
+
+// addPaths stages the files and directories at the given repository-relative
+// paths as add does, skipping special files with a warning. It returns the
+// paths whose index entry changed and, with options.ignoreErrors, the files
+// that could not be staged. It stops with ctx's error once ctx is done.
+func addPaths(ctx context.Context, targetPaths []string, options addOptions) ([]string, []addFailure, error) {
+	var changedPaths []string
+	var failures []addFailure
+
+	cone, err := loadSparseCone()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, targetPath := range targetPaths {
+		if err := ctx.Err(); err != nil {
+			return changedPaths, failures, err
+		}
+
+		stat, err := os.Stat(workTreePath(targetPath))
+		if err != nil {
+			return changedPaths, failures, err
+		}
+		if !cone.containsEntry(targetPath, stat.IsDir()) {
+			return changedPaths, failures, fmt.Errorf("path %s is outside the sparse-checkout cone; run '%s sparse-checkout set' to include it", targetPath, vcsName)
+		}
+
+		if stat.IsDir() {
+			oldIndex, err := readSparseIndex()
+			if err != nil {
+				return changedPaths, failures, err
+			}
+
+			// handle all files within directory
+			dirFailures, err := addDirectory(ctx, targetPath, options)
+			failures = append(failures, dirFailures...)
 			if err != nil {
-				return fmt.Errorf("error reading file %s: %v", path, err)
+				return changedPaths, failures, err
 			}
 
-			// create object and store it
-			dataHash, err := createObject(content)
+			newIndex, err := readSparseIndex()
 			if err != nil {
-				return fmt.Errorf("error creating object for file %s: %v", path, err)
+				return changedPaths, failures, err
 			}
 
-			// update the index file
-			if err = updateIndex(path, dataHash); err != nil {
-				return fmt.Errorf("error updating index for file %s: %v", path, err)
+			for _, change := range diffIndexes(oldIndex, newIndex) {
+				changedPaths = append(changedPaths, change.path)
 			}
+			continue
 		}
 
-		return nil
-	})
+		if stat.Mode()&specialFileModes != 0 {
+			fmt.Printf("warning: skipping special file %s\n", displayPath(targetPath))
+			continue
+		}
+
+		// a single file only needs its own index entry
+		changed, err := stageFile(ctx, targetPath, options)
+		if err != nil && options.ignoreErrors {
+			failures = append(failures, addFailure{path: targetPath, err: err})
+			continue
+		}
+		if err != nil {
+			return changedPaths, failures, err
+		}
+
+		if changed && !options.dryRun {
+			changedPaths = append(changedPaths, targetPath)
+		}
+	}
 
+	return changedPaths, failures, nil
+}
+
+// addNestedRepository stages the current commit of a nested repository
+// found while adding a directory if it is a registered submodule, and
+// otherwise leaves it out with a warning. It returns filepath.SkipDir so the
+// nested repository's files are never staged as our own.
+func addNestedRepository(ctx context.Context, path string, options addOptions) error {
+	index, err := readIndex(ctx)
 	if err != nil {
-		return fmt.Errorf("error adding directory %s: %v", dirPath, err)
+		return err
 	}
 
-	return nil
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return err
+	}
+	if !gitlinks[path] {
+		fmt.Printf("warning: skipping nested repository %s (use '%s submodule add' to track it)\n", displayPath(path), vcsName)
+		return filepath.SkipDir
+	}
+
+	head, err := submoduleHead(path)
+	if err != nil {
+		return err
+	}
+	if head == nil || slices.Equal(head, index[path]) {
+		return filepath.SkipDir
+	}
+
+	if options.verbose || options.dryRun {
+		fmt.Printf("add '%s'\n", displayPath(path))
+	}
+	if !options.dryRun {
+		if err := updateIndex(ctx, path, head); err != nil {
+			return fmt.Errorf("error updating index for submodule %s: %w", path, err)
+		}
+	}
+
+	return filepath.SkipDir
 }
 
 // getStatus computes the status of the working directory
-func getStatus() ([]string, []string, error) {
-	index, err := readIndex()
+func getStatus(ctx context.Context) ([]string, []string, error) {
+	cone, err := loadSparseCone()
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := readConeIndex(ctx, cone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	conv, err := loadContentConversion()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -151,29 +663,69 @@ func getStatus() ([]string, []string, error) {
 
 	// Check for modified files
 	for path, hash := range index {
-		content, err := os.ReadFile(path)
+		if isSparseDirEntry(path) || !cone.contains(path) {
+			continue // not checked out
+		}
+
+		if gitlinks[path] {
+			if modified, err := gitlinkModified(path, hash); err != nil {
+				return nil, nil, err
+			} else if modified {
+				modifiedFiles = append(modifiedFiles, path)
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(workTreePath(path))
 		if err != nil {
-			return nil, nil, fmt.Errorf("error reading file %s: %v", path, err)
+			return nil, nil, fmt.Errorf("error reading file %s: %w", path, err)
 		}
 
-		hashed := hashObject(content)
+		hashed, err := conv.hashWorkTreeContent(ctx, path, content)
+		if err != nil {
+			return nil, nil, err
+		}
 		if !slices.Equal(hashed, hash) {
 			modifiedFiles = append(modifiedFiles, path)
 		}
 	}
 
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, nil, err
+	}
+	folder := newPathFolder(index)
+
 	// check for unstaged files
-	err = filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+	err = walkWorkTree(".", func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err != nil {
 			return err
 		}
 
-		if d.IsDir() && d.Name() == "."+vcsName {
-			return filepath.SkipDir // skip VCS dir
+		if isVCSEntry(path, d) {
+			return skipWalkEntry(d) // skip VCS dir
+		}
+
+		if _, tracked := index[folder.tracked(path)]; !tracked && path != "." && rules.ignored(path, d.IsDir()) {
+			return skipWalkEntry(d) // ignored and untracked
+		}
+
+		if !cone.containsEntry(path, d.IsDir()) {
+			return skipWalkEntry(d) // outside the sparse-checkout cone
+		}
+
+		if d.IsDir() && isNestedRepository(path) {
+			if _, ok := index[folder.tracked(path)]; !ok {
+				unstagedFiles = append(unstagedFiles, path)
+			}
+			return filepath.SkipDir
 		}
 
 		if !d.IsDir() {
-			if _, ok := index[path]; !ok {
+			if _, ok := index[folder.tracked(path)]; !ok {
 				unstagedFiles = append(unstagedFiles, path)
 			}
 		}
@@ -182,7 +734,7 @@ func getStatus() ([]string, []string, error) {
 	})
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("error walking directory for unstaged files: %v", err)
+		return nil, nil, fmt.Errorf("error walking directory for unstaged files: %w", err)
 	}
 
 	return modifiedFiles, unstagedFiles, nil
@@ -197,7 +749,7 @@ func printStatus(modifiedFiles, unstagedFiles []string) {
 
 	// print modified files
 	for _, file := range modifiedFiles {
-		color.Red("modified:   %s", file)
+		color.Red("modified:   %s", displayPath(file))
 	}
 
 	if len(modifiedFiles) > 0 && len(unstagedFiles) > 0 {
@@ -208,6 +760,65 @@ func printStatus(modifiedFiles, unstagedFiles []string) {
 
 	// print unstaged files
 	for _, file := range unstagedFiles {
-		color.Yellow("unstaged:   %s", file)
+		color.Yellow("unstaged:   %s", displayPath(file))
+	}
+}
+
+// compareIndexToWorkingTree compares each index entry with the working tree
+// and returns the sorted paths whose content differs and those that are missing.
+// Entries outside the sparse-checkout cone are not checked out and are
+// never reported.
+func compareIndexToWorkingTree(ctx context.Context, index map[string][]byte) ([]string, []string, error) {
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	cone, err := loadSparseCone()
+	if err != nil {
+		return nil, nil, err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var modifiedFiles []string
+	var deletedFiles []string
+
+	for path, hash := range index {
+		if isSparseDirEntry(path) || !cone.contains(path) {
+			continue
+		}
+
+		if gitlinks[path] {
+			if modified, err := gitlinkModified(path, hash); err != nil {
+				return nil, nil, err
+			} else if modified {
+				modifiedFiles = append(modifiedFiles, path)
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(workTreePath(path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				deletedFiles = append(deletedFiles, path)
+				continue
+			}
+			return nil, nil, fmt.Errorf("error reading file %s: %w", path, err)
+		}
+
+		contentHash, err := conv.hashWorkTreeContent(ctx, path, content)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !slices.Equal(contentHash, hash) {
+			modifiedFiles = append(modifiedFiles, path)
+		}
 	}
+
+	slices.Sort(modifiedFiles)
+	slices.Sort(deletedFiles)
+
+	return modifiedFiles, deletedFiles, nil
 }
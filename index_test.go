@@ -1,4 +1,4 @@
-package main
+package mygit
 
 import (
 	"crypto/rand"
@@ -42,7 +42,7 @@ func TestReadIndex(t *testing.T) {
 		t.Fatalf("Failed to write index file: %v", err)
 	}
 
-	index, err := readIndex()
+	index, err := readIndex(t.Context())
 	assert.NoError(t, err, "Failed to read valid index file")
 
 	for _, entry := range validIndex {
@@ -67,7 +67,7 @@ func TestReadIndex(t *testing.T) {
 	err = os.WriteFile(fmt.Sprintf(".%s/index", vcsName), []byte(content), 0644)
 	assert.NoError(t, err, "Failed to write valid index file")
 
-	index, err = readIndex()
+	index, err = readIndex(t.Context())
 	assert.Error(t, err, "Expected error for invalid index entries")
 
 }
@@ -108,7 +108,7 @@ func TestUpdateIndex(t *testing.T) {
 		}
 
 		// update index
-		err = updateIndex(tc.name, hash)
+		err = updateIndex(t.Context(), tc.name, hash)
 		if err != nil {
 			t.Fatalf("error updating index for %s: %v", tc.name, err)
 		}
@@ -116,7 +116,7 @@ func TestUpdateIndex(t *testing.T) {
 		expectedState[tc.name] = hash
 	}
 
-	actualState, err := readIndex()
+	actualState, err := readIndex(t.Context())
 	if err != nil {
 		t.Fatalf("error reading index: %v", err)
 	}
@@ -133,6 +133,106 @@ func TestUpdateIndex(t *testing.T) {
 	}
 }
 
+func TestCompareIndexToWorkingTree(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	files := map[string][]byte{
+		"lsfiles_clean.txt":    []byte("clean"),
+		"lsfiles_modified.txt": []byte("original"),
+	}
+	index := make(map[string][]byte)
+	for name, content := range files {
+		if err := os.WriteFile(name, content, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		defer os.Remove(name)
+		index[name] = hashObject(content)
+	}
+	index["lsfiles_deleted.txt"] = hashObject([]byte("gone"))
+
+	if err := os.WriteFile("lsfiles_modified.txt", []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+
+	modified, deleted, err := compareIndexToWorkingTree(t.Context(), index)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lsfiles_modified.txt"}, modified)
+	assert.Equal(t, []string{"lsfiles_deleted.txt"}, deleted)
+}
+
+func TestCacheTree(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	hash, err := createObject([]byte("cache tree content"))
+	if err != nil {
+		t.Fatalf("error creating object: %v", err)
+	}
+
+	index := map[string][]byte{
+		"top.txt":         hash,
+		"dir/a.txt":       hash,
+		"other/b.txt":     hash,
+		"other/sub/c.txt": hash,
+	}
+	if err := writeIndex(t.Context(), index); err != nil {
+		t.Fatalf("error writing index: %v", err)
+	}
+
+	treeHash, err := writeIndexTree(index)
+	assert.NoError(t, err)
+
+	cache, err := readCacheTree()
+	assert.NoError(t, err)
+	assert.Equal(t, treeHash, cache["."], "root tree should be cached")
+	assert.Contains(t, cache, "dir")
+	assert.Contains(t, cache, "other/sub")
+
+	// readIndex must ignore the extension
+	readBack, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, len(index), len(readBack))
+
+	// changing a nested path invalidates it and its ancestors only
+	newHash, err := createObject([]byte("changed"))
+	if err != nil {
+		t.Fatalf("error creating object: %v", err)
+	}
+	assert.NoError(t, updateIndex(t.Context(), "other/sub/c.txt", newHash))
+
+	cache, err = readCacheTree()
+	assert.NoError(t, err)
+	assert.NotContains(t, cache, ".")
+	assert.NotContains(t, cache, "other")
+	assert.NotContains(t, cache, "other/sub")
+	assert.Contains(t, cache, "dir")
+
+	// the cached build matches a full rebuild
+	index["other/sub/c.txt"] = newHash
+	cachedHash, err := writeIndexTree(index)
+	assert.NoError(t, err)
+
+	fullHash, err := buildTreeObject(index)
+	assert.NoError(t, err)
+	assert.Equal(t, fullHash, cachedHash)
+
+	// a prefix writes just that subdirectory's tree
+	subHash, err := writeIndexSubtree(index, "other/", nil)
+	assert.NoError(t, err)
+
+	cache, err = readCacheTree()
+	assert.NoError(t, err)
+	assert.Equal(t, cache["other"], subHash)
+
+	_, err = writeIndexSubtree(index, "missing", nil)
+	assert.Error(t, err)
+}
+
 // generateHexString is a helper which generates a dummy 20-byte hex string.
 func generateHexString() (string, error) {
 	bytes := make([]byte, 20)
@@ -142,3 +242,151 @@ func generateHexString() (string, error) {
 
 	return hex.EncodeToString(bytes), nil
 }
+
+func TestAddDirectoryIgnoreErrors(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("add-errors-test")
+
+	assert.NoError(t, os.MkdirAll("add-errors-test", 0755))
+	assert.NoError(t, os.WriteFile("add-errors-test/a.txt", []byte("a\n"), 0644))
+	assert.NoError(t, os.WriteFile("add-errors-test/c.txt", []byte("c\n"), 0644))
+	if err := os.Symlink("missing", "add-errors-test/b.txt"); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	// a file that cannot be read stops the add by default
+	_, err := addDirectory(t.Context(), "add-errors-test", addOptions{})
+	assert.Error(t, err)
+
+	failures, err := addDirectory(t.Context(), "add-errors-test", addOptions{ignoreErrors: true})
+	assert.NoError(t, err)
+	assert.Len(t, failures, 1)
+	assert.Equal(t, "add-errors-test/b.txt", failures[0].path)
+
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Contains(t, index, "add-errors-test/a.txt")
+	assert.Contains(t, index, "add-errors-test/c.txt")
+	assert.NotContains(t, index, "add-errors-test/b.txt")
+}
+
+func TestAddDirectoryDryRun(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("add-dry-run-test")
+
+	assert.NoError(t, os.MkdirAll("add-dry-run-test", 0755))
+	assert.NoError(t, os.WriteFile("add-dry-run-test/a.txt", []byte("dry run\n"), 0644))
+
+	_, err := addDirectory(t.Context(), "add-dry-run-test", addOptions{dryRun: true})
+	assert.NoError(t, err)
+
+	// nothing is staged or stored
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Empty(t, index)
+	assert.False(t, objectExists(hashObject([]byte("dry run\n"))))
+
+	hash, err := hashFile(t.Context(), "add-dry-run-test/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, hashObject([]byte("dry run\n")), hash)
+
+	_, err = addDirectory(t.Context(), "add-dry-run-test", addOptions{})
+	assert.NoError(t, err)
+	assert.True(t, objectExists(hash))
+}
+
+func TestWriteIndexSubtreePathspecs(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	blobHash, err := createObject([]byte("content"))
+	assert.NoError(t, err)
+	index := map[string][]byte{
+		"services/api/main.go": blobHash,
+		"services/web/app.js":  blobHash,
+		"lib/util.go":          blobHash,
+	}
+
+	// plant cached trees: one inside the path, one above it
+	plantedAPI, err := buildTreeObject(map[string][]byte{"cached.go": blobHash})
+	assert.NoError(t, err)
+	assert.NoError(t, writeIndexFile(index, map[string][]byte{"services/api": plantedAPI, "services": plantedAPI}))
+
+	treeHash, err := writeIndexSubtree(index, ".", []string{"services/api"})
+	assert.NoError(t, err)
+
+	// the tree inside the path comes from the cache, the one above does not
+	written, err := buildIndexFromTree(t.Context(), treeHash, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"services/api/cached.go": blobHash}, written)
+
+	hashed, err := hashIndexSubtree(index, ".", []string{"services/api"})
+	assert.NoError(t, err)
+	assert.Equal(t, treeHash, hashed)
+
+	// without the planted tree, the result is the entries under the paths
+	assert.NoError(t, writeIndexFile(index, nil))
+	treeHash, err = writeIndexSubtree(index, ".", []string{"services/api", "lib"})
+	assert.NoError(t, err)
+	written, err = buildIndexFromTree(t.Context(), treeHash, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"services/api/main.go": blobHash, "lib/util.go": blobHash}, written)
+
+	// the full index's cache only gains trees inside the paths
+	cache, err := readCacheTree()
+	assert.NoError(t, err)
+	assert.Contains(t, cache, "services/api")
+	assert.Contains(t, cache, "lib")
+	assert.NotContains(t, cache, "services")
+	assert.NotContains(t, cache, ".")
+
+	_, err = writeIndexSubtree(index, ".", []string{"missing"})
+	assert.Error(t, err)
+}
+
+func TestIndexLock(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		blobHash, err := createObject([]byte("locked"))
+		assert.NoError(t, err)
+		lockPath := fmt.Sprintf("%s/index.lock", gitDir)
+
+		// writes nested in a held lock share it
+		err = withIndexLock(func() error {
+			assert.FileExists(t, lockPath)
+			return updateIndex(t.Context(), "a.txt", blobHash)
+		})
+		assert.NoError(t, err)
+		assert.NoFileExists(t, lockPath)
+
+		// the lock of one repository is not taken for another's
+		err = withIndexLock(func() error {
+			return withRepositoryInit(t.TempDir(), func() error {
+				assert.NoError(t, os.WriteFile(fmt.Sprintf("%s/index.lock", gitDir), nil, 0644))
+				assert.ErrorContains(t, updateIndex(t.Context(), "other.txt", blobHash), "index.lock exists")
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+
+		// a lock held by another process stops the write and leaves the index alone
+		assert.NoError(t, os.WriteFile(lockPath, nil, 0644))
+		err = updateIndex(t.Context(), "b.txt", blobHash)
+		assert.ErrorContains(t, err, "index.lock exists")
+
+		index, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a.txt": blobHash}, index)
+		assert.FileExists(t, lockPath)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
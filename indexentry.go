@@ -0,0 +1,328 @@
+package mygit
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sortedIndexMarker is the first line of an index whose entries are sorted
+// by path and followed by its cache-tree entries sorted by directory. Only
+// such an index can be searched and updated in place.
+const sortedIndexMarker = "|SORTED|"
+
+// indexTombstone fills the hash field of a removed entry (or an
+// invalidated cache-tree entry) that has not been compacted away yet.
+const indexTombstone = '-'
+
+// isIndexTombstone reports whether a hex hash field marks a removed entry.
+func isIndexTombstone(hexHash string) bool {
+	return hexHash != "" && strings.Trim(hexHash, string(indexTombstone)) == ""
+}
+
+// indexLineKey returns the sort key of an index line: the marker first,
+// then file entries by path, then cache-tree entries by directory, then
+// conflict stages by path and stage.
+func indexLineKey(line string) string {
+	if line == sortedIndexMarker {
+		return ""
+	}
+	if entry, ok := strings.CutPrefix(line, cacheTreePrefix); ok {
+		dir, _, _ := strings.Cut(entry, "|")
+		return "\x01" + dir
+	}
+	if entry, ok := strings.CutPrefix(line, conflictStagePrefix); ok {
+		filePath, rest, _ := strings.Cut(entry, "|")
+		stage, _, _ := strings.Cut(rest, "|")
+		return "\x02" + filePath + "|" + stage
+	}
+
+	filePath, _, _ := strings.Cut(line, "|")
+	return "\x00" + filePath
+}
+
+// indexEntryKey and cacheTreeKey return the sort keys of the lines for a
+// file entry and a cache-tree entry.
+func indexEntryKey(filePath string) string { return "\x00" + filePath }
+func cacheTreeKey(dir string) string       { return "\x01" + dir }
+
+// readLineAt returns the line starting at offset off, without its newline.
+func readLineAt(r io.ReaderAt, off, size int64) (string, error) {
+	var line []byte
+	buf := make([]byte, 256)
+
+	for off < size {
+		n, err := r.ReadAt(buf, off)
+		if i := bytes.IndexByte(buf[:n], '\n'); i != -1 {
+			return string(append(line, buf[:i]...)), nil
+		}
+		line = append(line, buf[:n]...)
+		off += int64(n)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(line), nil
+}
+
+// nextLineStart returns the offset of the first line starting at or after off.
+func nextLineStart(r io.ReaderAt, off, size int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+
+	// the line starts at off exactly if the byte before it ends a line
+	buf := make([]byte, 256)
+	pos := off - 1
+	for pos < size {
+		n, err := r.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i != -1 {
+			return pos + int64(i) + 1, nil
+		}
+		pos += int64(n)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
+
+// searchIndexFile binary searches a sorted index for the line with the
+// given key and returns its offset and content. It reads O(log n) lines.
+func searchIndexFile(r io.ReaderAt, size int64, key string) (int64, string, bool, error) {
+	lo, hi := int64(0), size // the line, if present, starts in [lo, hi)
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := nextLineStart(r, mid, size)
+		if err != nil {
+			return 0, "", false, err
+		}
+		if start >= hi {
+			break // every line left starts before mid; scan them below
+		}
+
+		line, err := readLineAt(r, start, size)
+		if err != nil {
+			return 0, "", false, err
+		}
+
+		switch lineKey := indexLineKey(line); {
+		case lineKey == key:
+			return start, line, true, nil
+		case lineKey < key:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = start
+		}
+	}
+
+	// the few lines left between lo and mid
+	for lo < hi {
+		line, err := readLineAt(r, lo, size)
+		if err != nil {
+			return 0, "", false, err
+		}
+		if indexLineKey(line) == key {
+			return lo, line, true, nil
+		}
+		lo += int64(len(line)) + 1
+	}
+
+	return 0, "", false, nil
+}
+
+// openSortedIndex opens the index for keyed access. It returns a nil file,
+// and no error, if the index is missing or not sorted, in which case the
+// caller falls back to reading the whole index.
+func openSortedIndex(flag int) (*os.File, int64, error) {
+	f, err := os.OpenFile(fmt.Sprintf("%s/index", gitDir), flag, 0644)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error opening index file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("error reading index file: %w", err)
+	}
+
+	first, err := readLineAt(f, 0, info.Size())
+	if err != nil || first != sortedIndexMarker {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
+// lookupIndexEntry returns the staged hash of a single path without
+// reading the whole index. With core.ignorecase, a path that is not staged
+// as spelled matches an entry spelled in another case.
+func lookupIndexEntry(ctx context.Context, filePath string) ([]byte, bool, error) {
+	filePath = filepath.ToSlash(filePath)
+	if err := checkVCSRepo(); err != nil {
+		return nil, false, err
+	}
+
+	f, size, err := openSortedIndex(os.O_RDONLY)
+	if err != nil {
+		return nil, false, err
+	}
+	if f == nil {
+		index, err := readIndex(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		hash, ok := index[newPathFolder(index).tracked(filePath)]
+		return hash, ok, nil
+	}
+	defer f.Close()
+
+	_, line, found, err := searchIndexFile(f, size, indexEntryKey(filePath))
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading index file: %w", err)
+	}
+	if !found {
+		if !ignoreCaseEnabled() {
+			return nil, false, nil
+		}
+
+		// the entry may be spelled in another case
+		index, err := readIndex(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		hash, ok := index[newPathFolder(index).tracked(filePath)]
+		return hash, ok, nil
+	}
+
+	_, hexHash, _ := strings.Cut(line, "|")
+	if isIndexTombstone(hexHash) {
+		return nil, false, nil
+	}
+
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid index entry: %s", line)
+	}
+
+	return hash, true, nil
+}
+
+// setIndexEntryInPlace overwrites the hash field of an existing entry of
+// the sorted index, or marks it removed if hash is nil, and invalidates the
+// cached trees of the directories containing it. It reports false if the
+// entry cannot be updated in place, in which case nothing was changed.
+func setIndexEntryInPlace(filePath string, hash []byte) (bool, error) {
+	filePath = filepath.ToSlash(filePath)
+	f, size, err := openSortedIndex(os.O_RDWR)
+	if err != nil || f == nil {
+		return false, err
+	}
+	defer f.Close()
+
+	offset, line, found, err := searchIndexFile(f, size, indexEntryKey(filePath))
+	if err != nil {
+		return false, fmt.Errorf("error reading index file: %w", err)
+	}
+	if !found {
+		return false, nil // new entries change the file's layout
+	}
+
+	_, oldHex, _ := strings.Cut(line, "|")
+	newHex := fmt.Sprintf("%x", hash)
+	if hash == nil {
+		newHex = strings.Repeat(string(indexTombstone), len(oldHex))
+	}
+	if len(newHex) != len(oldHex) {
+		return false, nil
+	}
+	if newHex == oldHex {
+		return true, nil
+	}
+
+	// drop cached trees first, so a crash in between only costs a rehash
+	for dir := filePath; dir != "."; {
+		dir = path.Dir(dir)
+		if err := invalidateCacheTreeEntry(f, size, dir); err != nil {
+			return false, err
+		}
+	}
+
+	hashOffset := offset + int64(len(filePath)) + 1
+	if _, err := f.WriteAt([]byte(newHex), hashOffset); err != nil {
+		return false, fmt.Errorf("error writing index file: %w", err)
+	}
+
+	return true, nil
+}
+
+// invalidateCacheTreeEntry marks the cached tree of dir as invalid, if any.
+func invalidateCacheTreeEntry(f *os.File, size int64, dir string) error {
+	offset, line, found, err := searchIndexFile(f, size, cacheTreeKey(dir))
+	if err != nil {
+		return fmt.Errorf("error reading index file: %w", err)
+	}
+	if !found {
+		return nil
+	}
+
+	entry := strings.TrimPrefix(line, cacheTreePrefix)
+	_, hexHash, _ := strings.Cut(entry, "|")
+	if isIndexTombstone(hexHash) {
+		return nil
+	}
+
+	hashOffset := offset + int64(len(line)-len(hexHash))
+	tombstone := strings.Repeat(string(indexTombstone), len(hexHash))
+	if _, err := f.WriteAt([]byte(tombstone), hashOffset); err != nil {
+		return fmt.Errorf("error writing index file: %w", err)
+	}
+
+	return nil
+}
+
+// removeIndexEntry removes a single path from the index, in place when the
+// index is sorted.
+func removeIndexEntry(ctx context.Context, filePath string) error {
+	filePath = filepath.ToSlash(filePath)
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	return withIndexLock(func() error {
+		if done, err := setIndexEntryInPlace(filePath, nil); err != nil || done {
+			return err
+		}
+
+		index, err := readIndex(ctx)
+		if err != nil {
+			return err
+		}
+		delete(index, newPathFolder(index).tracked(filePath))
+
+		return writeIndex(ctx, index)
+	})
+}
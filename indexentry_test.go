@@ -0,0 +1,86 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexKeyedAccess(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	index := make(map[string][]byte)
+	for i := range 200 {
+		path := fmt.Sprintf("dir%d/file%03d.txt", i%7, i)
+		index[path] = hashObject([]byte(path))
+	}
+	cache := map[string][]byte{
+		".":    hashObject([]byte("root")),
+		"dir3": hashObject([]byte("dir3")),
+		"dir4": hashObject([]byte("dir4")),
+	}
+	assert.NoError(t, writeIndexFile(index, cache))
+
+	for path, hash := range index {
+		got, ok, err := lookupIndexEntry(t.Context(), path)
+		assert.NoError(t, err)
+		assert.True(t, ok, path)
+		assert.Equal(t, hash, got, path)
+	}
+
+	_, ok, err := lookupIndexEntry(t.Context(), "dir3/missing.txt")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// an existing entry is updated in place, dropping its directories' cached trees
+	newHash := hashObject([]byte("changed"))
+	done, err := setIndexEntryInPlace("dir3/file003.txt", newHash)
+	assert.NoError(t, err)
+	assert.True(t, done)
+
+	index["dir3/file003.txt"] = newHash
+	stored, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, index, stored)
+
+	storedCache, err := readCacheTree()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"dir4": cache["dir4"]}, storedCache)
+
+	// removal leaves a tombstone that lookups and reads skip
+	assert.NoError(t, removeIndexEntry(t.Context(), "dir4/file004.txt"))
+	_, ok, err = lookupIndexEntry(t.Context(), "dir4/file004.txt")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	delete(index, "dir4/file004.txt")
+	stored, err = readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, index, stored)
+
+	// re-adding the path fills the tombstone again
+	assert.NoError(t, updateIndex(t.Context(), "dir4/file004.txt", newHash))
+	got, ok, err := lookupIndexEntry(t.Context(), "dir4/file004.txt")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, newHash, got)
+
+	// new paths and unsorted indexes fall back to a full rewrite
+	done, err = setIndexEntryInPlace("new.txt", newHash)
+	assert.NoError(t, err)
+	assert.False(t, done)
+
+	assert.NoError(t, os.WriteFile(fmt.Sprintf("%s/index", gitDir), []byte(fmt.Sprintf("b.txt|%x\na.txt|%x\n", newHash, newHash)), 0644))
+	done, err = setIndexEntryInPlace("a.txt", hashObject([]byte("a")))
+	assert.NoError(t, err)
+	assert.False(t, done)
+	got, ok, err = lookupIndexEntry(t.Context(), "a.txt")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, newHash, got)
+}
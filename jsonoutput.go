@@ -0,0 +1,308 @@
+package mygit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// jsonOutput is set by the global --json option, or by --json after the
+// command name, to print structured output instead of text.
+var jsonOutput = false
+
+// commitJSON is a commit as log and show print it with --json. Hashes are
+// always given in full.
+type commitJSON struct {
+	Hash      string   `json:"hash"`
+	Tree      string   `json:"tree"`
+	Parents   []string `json:"parents"`
+	Author    string   `json:"author"`
+	Committer string   `json:"committer"`
+	Message   string   `json:"message"`
+	Note      string   `json:"note,omitempty"`
+}
+
+// fileChangeJSON is the change to one path between two trees.
+type fileChangeJSON struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"` // added, modified or deleted
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	Patch   string `json:"patch"` // unified diff, as show prints it
+}
+
+// statusEntryJSON is one path of status --json, with the same states as
+// status --porcelain spelled out. A side that is unchanged is left out.
+type statusEntryJSON struct {
+	Path     string `json:"path"`
+	Index    string `json:"index,omitempty"`    // index against HEAD
+	WorkTree string `json:"worktree,omitempty"` // working tree against index
+}
+
+// statusJSON is the output of status --json.
+type statusJSON struct {
+	Branch  string            `json:"branch"`
+	Merging bool              `json:"merging"`
+	Entries []statusEntryJSON `json:"entries"`
+}
+
+// branchJSON is one branch as branch --json lists it.
+type branchJSON struct {
+	Name    string `json:"name"`
+	Commit  string `json:"commit,omitempty"` // empty for a branch without commits
+	Current bool   `json:"current"`
+}
+
+// treeEntryJSON is one entry of a tree shown with --json.
+type treeEntryJSON struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+}
+
+// objectJSON is the output of show --json. Only the fields of the
+// object's type are set.
+type objectJSON struct {
+	Type    string           `json:"type"`
+	Hash    string           `json:"hash"`
+	Commit  *commitJSON      `json:"commit,omitempty"`
+	Changes []fileChangeJSON `json:"changes,omitempty"`
+	Entries []treeEntryJSON  `json:"entries,omitempty"`
+	Content string           `json:"content,omitempty"`
+}
+
+// statusNames spells out the one-letter change and status codes.
+var statusNames = map[byte]string{
+	'A': "added",
+	'M': "modified",
+	'D': "deleted",
+	'?': "untracked",
+	'U': "unmerged",
+}
+
+// printJSON writes v to stdout as indented JSON. Characters such as < and >
+// in author lines are kept as they are rather than escaped.
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+
+	return nil
+}
+
+// newCommitJSON describes the commit with the given hash, with its note
+// if it has one.
+func newCommitJSON(commitHash []byte, commitObj commitObject, notes map[string][]byte) (commitJSON, error) {
+	result := commitJSON{
+		Hash:      fmt.Sprintf("%x", commitHash),
+		Tree:      fmt.Sprintf("%x", commitObj.hash),
+		Parents:   []string{},
+		Author:    commitObj.author,
+		Committer: commitObj.committer,
+		Message:   commitObj.message,
+	}
+	for _, parent := range commitObj.parents {
+		result.Parents = append(result.Parents, fmt.Sprintf("%x", parent))
+	}
+
+	note, err := readNote(notes, commitHash)
+	if err != nil {
+		return result, err
+	}
+	result.Note = string(note)
+
+	return result, nil
+}
+
+// commitLogJSON describes the commit and its first parents, newest first,
+// as log prints them.
+func commitLogJSON(ctx context.Context, commitHash []byte) ([]commitJSON, error) {
+	notes, _, err := readNotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []commitJSON{}
+	for len(commitHash) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		commitObj, err := readCommit(commitHash)
+		if err != nil {
+			return nil, err
+		}
+
+		commit, err := newCommitJSON(commitHash, commitObj, notes)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+
+		commitHash = nil
+		if len(commitObj.parents) > 0 {
+			commitHash = commitObj.parents[0]
+		}
+	}
+
+	return commits, nil
+}
+
+// indexDiffJSON describes every path that differs between two indexes,
+// reading blob content through readBlob.
+func indexDiffJSON(oldIndex, newIndex map[string][]byte, readBlob readBlobFunc) ([]fileChangeJSON, error) {
+	attrs, err := loadAttributes()
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := configuredDiffAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []fileChangeJSON{}
+
+	for _, change := range diffIndexes(oldIndex, newIndex) {
+		var oldContent, newContent []byte
+		var err error
+
+		entry := fileChangeJSON{Path: change.path, Status: statusNames[change.status]}
+		if change.oldHash != nil {
+			entry.OldHash = fmt.Sprintf("%x", change.oldHash)
+			if oldContent, err = readBlob(change.oldHash); err != nil {
+				return nil, err
+			}
+		}
+		if change.newHash != nil {
+			entry.NewHash = fmt.Sprintf("%x", change.newHash)
+			if newContent, err = readBlob(change.newHash); err != nil {
+				return nil, err
+			}
+		}
+		entry.Patch = formatFileDiff(change, oldContent, newContent, isBinaryDiff(attrs, change.path, oldContent, newContent), diffOptions{algorithm: algorithm})
+
+		changes = append(changes, entry)
+	}
+
+	return changes, nil
+}
+
+// statusReportJSON describes the state of the working tree and index, as
+// status --porcelain does.
+func statusReportJSON(ctx context.Context) (statusJSON, error) {
+	var report statusJSON
+
+	branch, err := getCurrentBranch()
+	if err != nil {
+		return report, err
+	}
+	report.Branch = branch
+
+	if report.Merging, err = isMergeInProgress(); err != nil {
+		return report, err
+	}
+
+	entries, err := collectStatusEntries(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	report.Entries = []statusEntryJSON{}
+	for _, e := range entries {
+		report.Entries = append(report.Entries, statusEntryJSON{
+			Path:     e.path,
+			Index:    statusNames[e.staged],
+			WorkTree: statusNames[e.unstaged],
+		})
+	}
+
+	return report, nil
+}
+
+// branchesJSON describes the given branch refs.
+func branchesJSON(refs []refInfo) []branchJSON {
+	branches := []branchJSON{}
+
+	for _, ref := range refs {
+		branch := branchJSON{Name: shortRefName(ref.refPath), Current: ref.head}
+		if ref.hash != nil {
+			branch.Commit = fmt.Sprintf("%x", ref.hash)
+		}
+		branches = append(branches, branch)
+	}
+
+	return branches
+}
+
+// showObjectJSON describes the object with the given hash as show --json
+// prints it: a commit with its changes against the first parent, a tree
+// with its entries, or a blob with its content.
+func showObjectJSON(ctx context.Context, hash []byte) (objectJSON, error) {
+	result := objectJSON{Hash: fmt.Sprintf("%x", hash)}
+
+	obj, err := catFile(hash)
+	if err != nil {
+		return result, err
+	}
+
+	switch o := obj.(type) {
+	case commitObject:
+		result.Type = "commit"
+
+		notes, _, err := readNotes(ctx)
+		if err != nil {
+			return result, err
+		}
+		commit, err := newCommitJSON(hash, o, notes)
+		if err != nil {
+			return result, err
+		}
+		result.Commit = &commit
+
+		newIndex, err := buildIndexFromTree(ctx, o.hash, "", false)
+		if err != nil {
+			return result, err
+		}
+
+		oldIndex := map[string][]byte{}
+		if len(o.parents) > 0 && len(o.parents[0]) > 0 {
+			if oldIndex, err = commitIndex(ctx, o.parents[0]); err != nil {
+				return result, err
+			}
+		}
+
+		readBlob, err := gitlinkAwareReader(oldIndex, newIndex)
+		if err != nil {
+			return result, err
+		}
+		if result.Changes, err = indexDiffJSON(oldIndex, newIndex, readBlob); err != nil {
+			return result, err
+		}
+
+	case treeObject:
+		result.Type = "tree"
+		result.Entries = []treeEntryJSON{}
+		for _, entry := range o.entries {
+			result.Entries = append(result.Entries, treeEntryJSON{
+				Name: entry.name,
+				Mode: entry.mode,
+				Type: entry.objType,
+				Hash: fmt.Sprintf("%x", entry.hash),
+			})
+		}
+
+	case blobObject:
+		result.Type = "blob"
+		result.Content = string(o.content)
+
+	default:
+		return result, fmt.Errorf("error object %x cannot be shown as JSON", hash)
+	}
+
+	return result, nil
+}
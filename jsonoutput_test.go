@@ -0,0 +1,64 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitLogJSON(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "json@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	oldBlob, err := createObject([]byte("old\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "file.txt", oldBlob))
+	baseHash, err := createCommit(t.Context(), "base")
+	assert.NoError(t, err)
+
+	newBlob, err := createObject([]byte("new\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "file.txt", newBlob))
+	headHash, err := createCommit(t.Context(), "change <file>")
+	assert.NoError(t, err)
+
+	commits, err := commitLogJSON(t.Context(), headHash)
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, fmt.Sprintf("%x", headHash), commits[0].Hash)
+		assert.Equal(t, []string{fmt.Sprintf("%x", baseHash)}, commits[0].Parents)
+		assert.Equal(t, "change <file>", commits[0].Message)
+		assert.Equal(t, fmt.Sprintf("%x", baseHash), commits[1].Hash)
+		assert.Equal(t, []string{}, commits[1].Parents)
+	}
+
+	object, err := showObjectJSON(t.Context(), headHash)
+	assert.NoError(t, err)
+	assert.Equal(t, "commit", object.Type)
+	if assert.Len(t, object.Changes, 1) {
+		assert.Equal(t, "file.txt", object.Changes[0].Path)
+		assert.Equal(t, "modified", object.Changes[0].Status)
+		assert.Equal(t, fmt.Sprintf("%x", oldBlob), object.Changes[0].OldHash)
+		assert.Equal(t, fmt.Sprintf("%x", newBlob), object.Changes[0].NewHash)
+		assert.Contains(t, object.Changes[0].Patch, "-old\n+new\n")
+	}
+
+	object, err = showObjectJSON(t.Context(), newBlob)
+	assert.NoError(t, err)
+	assert.Equal(t, objectJSON{Type: "blob", Hash: fmt.Sprintf("%x", newBlob), Content: "new\n"}, object)
+
+	assert.NoError(t, createBranch("feature", baseHash))
+	refs, err := collectRefs(t.Context(), []string{"refs/heads"}, nil)
+	assert.NoError(t, err)
+	branches := branchesJSON(refs)
+	assert.Contains(t, branches, branchJSON{Name: "feature", Commit: fmt.Sprintf("%x", baseHash)})
+	assert.Contains(t, branches, branchJSON{Name: "main", Commit: fmt.Sprintf("%x", headHash), Current: true})
+}
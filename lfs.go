@@ -0,0 +1,255 @@
+package mygit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// largeFilePointerVersion is the first line of a large-file pointer blob.
+// It is git-lfs's, so pointers read the same in both.
+const largeFilePointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+// maxLargeFilePointerSize bounds the blobs looked at as possible pointers.
+const maxLargeFilePointerSize = 200
+
+// tempLargeFilePattern names the temporary files large files are copied
+// into before they are renamed to their id.
+const tempLargeFilePattern = "tmp-lfs-*"
+
+// largeFilesDir returns the directory of the repository's own large-file
+// store.
+func largeFilesDir() string {
+	return filepath.Join(commonDir, "lfs", "objects")
+}
+
+// largeFilePath returns where the large file oid is kept below dir.
+func largeFilePath(dir, oid string) string {
+	return filepath.Join(dir, oid[:2], oid[2:4], oid)
+}
+
+// parseLargeFileThreshold parses a size in bytes with an optional k, m, or
+// g suffix, as core.largeFileThreshold is given.
+func parseLargeFileThreshold(value string) (int64, error) {
+	number, unit := value, int64(1)
+	switch strings.ToLower(value[max(len(value)-1, 0):]) {
+	case "k":
+		number, unit = value[:len(value)-1], 1<<10
+	case "m":
+		number, unit = value[:len(value)-1], 1<<20
+	case "g":
+		number, unit = value[:len(value)-1], 1<<30
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid largeFileThreshold %q: expected a size such as 100m", value)
+	}
+
+	return n * unit, nil
+}
+
+// isLargeFile reports whether content of size bytes at filePath is kept in
+// the large-file store: as its lfs attribute says, else if it is at least
+// core.largeFileThreshold.
+func (c contentConversion) isLargeFile(filePath string, size int64) bool {
+	switch c.attrs.get(filePath, "lfs") {
+	case attrSet:
+		return true
+	case attrUnset:
+		return false
+	}
+
+	return c.largeFileThreshold > 0 && size >= c.largeFileThreshold
+}
+
+// formatLargeFilePointer returns the pointer blob content for a large file.
+func formatLargeFilePointer(oid string, size int64) []byte {
+	return fmt.Appendf(nil, "%s\noid sha256:%s\nsize %d\n", largeFilePointerVersion, oid, size)
+}
+
+// parseLargeFilePointer returns the id and size of the large file content
+// points to, and false if content is not a pointer. The id must be a full
+// SHA-256 in lowercase hex, as largeFilePath splits it into directories.
+func parseLargeFilePointer(content []byte) (string, int64, bool) {
+	if len(content) > maxLargeFilePointerSize || !bytes.HasPrefix(content, []byte(largeFilePointerVersion+"\n")) {
+		return "", 0, false
+	}
+
+	var oid string
+	var size int64
+	_, err := fmt.Sscanf(string(content), largeFilePointerVersion+"\noid sha256:%64s\nsize %d\n", &oid, &size)
+	if err != nil || !bytes.Equal(content, formatLargeFilePointer(oid, size)) {
+		return "", 0, false
+	}
+	if len(oid) != sha256.Size*2 || strings.ToLower(oid) != oid {
+		return "", 0, false
+	}
+	if _, err := hex.DecodeString(oid); err != nil {
+		return "", 0, false
+	}
+
+	return oid, size, true
+}
+
+// storeLargeFile copies the content read from r into the large-file store
+// and returns the pointer blob content for it. With write unset it only
+// computes the pointer. Content already in the store is not copied again.
+// If core.largeFileStore names a shared store directory, the content is
+// copied there too.
+func storeLargeFile(ctx context.Context, r io.Reader, write bool) ([]byte, error) {
+	h := sha256.New()
+	if !write {
+		size, err := io.Copy(h, canceledReader{ctx, r})
+		if err != nil {
+			return nil, fmt.Errorf("error reading large file: %w", err)
+		}
+		return formatLargeFilePointer(hex.EncodeToString(h.Sum(nil)), size), nil
+	}
+
+	dir := largeFilesDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating large-file store: %w", err)
+	}
+	tmp, err := createTempFile(dir, tempLargeFilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("error creating large file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	size, err := io.Copy(io.MultiWriter(h, tmp), canceledReader{ctx, r})
+	if err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("error writing large file: %w", err)
+	}
+
+	oid := hex.EncodeToString(h.Sum(nil))
+	localPath := largeFilePath(dir, oid)
+	if _, err := os.Stat(localPath); err == nil {
+		tmp.Close()
+	} else if err := installObjectFile(tmp, localPath); err != nil {
+		return nil, err
+	}
+
+	if err := uploadLargeFile(ctx, oid, localPath); err != nil {
+		return nil, err
+	}
+
+	return formatLargeFilePointer(oid, size), nil
+}
+
+// largeFileStore returns the shared store directory named by
+// core.largeFileStore, or "" if there is none.
+func largeFileStore() string {
+	store, err := getConfig("largeFileStore")
+	if err != nil {
+		return ""
+	}
+
+	return workTreePath(store)
+}
+
+// uploadLargeFile copies the large file oid at localPath to the shared
+// store, if one is configured and lacks it.
+func uploadLargeFile(ctx context.Context, oid, localPath string) error {
+	store := largeFileStore()
+	if store == "" {
+		return nil
+	}
+
+	storePath := largeFilePath(store, oid)
+	if _, err := os.Stat(storePath); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("error reading large file %s: %w", oid, err)
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
+		return fmt.Errorf("error creating large-file store %s: %w", store, err)
+	}
+	tmp, err := createTempFile(filepath.Dir(storePath), tempLargeFilePattern)
+	if err != nil {
+		return fmt.Errorf("error writing to large-file store %s: %w", store, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, canceledReader{ctx, src}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing to large-file store %s: %w", store, err)
+	}
+
+	return installObjectFile(tmp, storePath)
+}
+
+// openLargeFile opens the content of the large file oid, fetching it from
+// the shared store into the repository's own store first if needed. It
+// returns an error wrapping fs.ErrNotExist if neither store has it.
+func openLargeFile(ctx context.Context, oid string) (*os.File, error) {
+	localPath := largeFilePath(largeFilesDir(), oid)
+	if f, err := os.Open(localPath); !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+
+	store := largeFileStore()
+	if store == "" {
+		return nil, fmt.Errorf("large file %s is not in the store: %w", oid, fs.ErrNotExist)
+	}
+
+	src, err := os.Open(largeFilePath(store, oid))
+	if err != nil {
+		return nil, fmt.Errorf("large file %s is not in the store: %w", oid, err)
+	}
+	defer src.Close()
+
+	// copying checks the content against its id on the way
+	pointer, err := storeLargeFile(ctx, src, true)
+	if err != nil {
+		return nil, err
+	}
+	if got, _, _ := parseLargeFilePointer(pointer); got != oid {
+		return nil, fmt.Errorf("large file %s in %s is corrupt, its content hashes to %s", oid, store, got)
+	}
+
+	return os.Open(localPath)
+}
+
+// resolveLargeFile returns the content of the large file content points
+// to, or content itself if it is not a pointer. A pointer to a file
+// neither store has is left as it is with a warning, so the rest of a
+// checkout still happens.
+func resolveLargeFile(ctx context.Context, filePath string, content []byte) ([]byte, error) {
+	oid, _, ok := parseLargeFilePointer(content)
+	if !ok {
+		return content, nil
+	}
+
+	f, err := openLargeFile(ctx, oid)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v; leaving the pointer in place\n", filePath, err)
+		return content, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(canceledReader{ctx, f})
+	if err != nil {
+		return nil, fmt.Errorf("error reading large file %s: %w", oid, err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,105 @@
+package mygit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLargeFiles(t *testing.T) {
+	big := []byte(strings.Repeat("large file content\n", 100))
+	sum := sha256.Sum256(big)
+	oid := hex.EncodeToString(sum[:])
+	pointer := formatLargeFilePointer(oid, int64(len(big)))
+	store := t.TempDir()
+
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("largeFileThreshold", "1k"))
+		assert.NoError(t, updateConfig("largeFileStore", store))
+		assert.NoError(t, os.WriteFile("big.bin", big, 0644))
+		assert.NoError(t, os.WriteFile("small.txt", []byte("small\n"), 0644))
+
+		// files at the threshold are stored as pointers
+		_, _, err := addPaths(t.Context(), []string{"big.bin", "small.txt"}, addOptions{})
+		assert.NoError(t, err)
+		index, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, hashObject(pointer), index["big.bin"])
+		assert.Equal(t, hashObject([]byte("small\n")), index["small.txt"])
+		assert.FileExists(t, largeFilePath(largeFilesDir(), oid))
+		assert.FileExists(t, largeFilePath(store, oid))
+
+		gotOid, size, ok := parseLargeFilePointer(pointer)
+		assert.True(t, ok)
+		assert.Equal(t, oid, gotOid)
+		assert.Equal(t, int64(len(big)), size)
+
+		// a pointer with a short or uppercase id is ordinary content
+		for _, badOid := range []string{"ab", strings.ToUpper(oid)} {
+			bad := formatLargeFilePointer(badOid, 1)
+			_, _, ok := parseLargeFilePointer(bad)
+			assert.False(t, ok, badOid)
+
+			badBlob, err := createObject(bad)
+			assert.NoError(t, err)
+			badTree, err := buildTreeObject(map[string][]byte{"bad.bin": badBlob})
+			assert.NoError(t, err)
+			_, err = buildIndexFromTree(t.Context(), badTree, "", true)
+			assert.NoError(t, err)
+			content, err := os.ReadFile("bad.bin")
+			assert.NoError(t, err)
+			assert.Equal(t, bad, content)
+		}
+
+		modified, _, err := compareIndexToWorkingTree(t.Context(), index)
+		assert.NoError(t, err)
+		assert.Empty(t, modified)
+
+		// checkout writes the content back, fetching it from the shared store
+		// if the repository's own store lacks it
+		tree, err := writeIndexTree(index)
+		assert.NoError(t, err)
+		assert.NoError(t, os.RemoveAll(largeFilesDir()))
+		assert.NoError(t, os.Remove("big.bin"))
+		_, err = buildIndexFromTree(t.Context(), tree, "", true)
+		assert.NoError(t, err)
+		content, err := os.ReadFile("big.bin")
+		assert.NoError(t, err)
+		assert.Equal(t, big, content)
+		assert.FileExists(t, largeFilePath(largeFilesDir(), oid))
+
+		// without the content anywhere, the pointer is left in place
+		assert.NoError(t, os.RemoveAll(largeFilesDir()))
+		assert.NoError(t, os.RemoveAll(filepath.Join(store, oid[:2])))
+		assert.NoError(t, os.Remove("big.bin"))
+		_, err = buildIndexFromTree(t.Context(), tree, "", true)
+		assert.NoError(t, err)
+		content, err = os.ReadFile("big.bin")
+		assert.NoError(t, err)
+		assert.Equal(t, pointer, content)
+
+		// the lfs attribute overrides the threshold
+		conv, err := newContentConversion(parseAttributes([]byte("*.bin -lfs\nsmall.txt lfs\n")))
+		assert.NoError(t, err)
+		assert.False(t, conv.isLargeFile("big.bin", int64(len(big))))
+		assert.True(t, conv.isLargeFile("small.txt", 6))
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for value, want := range map[string]int64{"0": 0, "512": 512, "2k": 2 << 10, "100M": 100 << 20, "1g": 1 << 30} {
+		got, err := parseLargeFileThreshold(value)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, value)
+	}
+	for _, value := range []string{"", "m", "-1", "ten"} {
+		_, err := parseLargeFileThreshold(value)
+		assert.Error(t, err, value)
+	}
+}
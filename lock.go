@@ -0,0 +1,195 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lockPath returns the path of the lock ref for the given repository-relative
+// file. A path checkIndexPath refuses, or one that would land outside
+// refs/locks, is an error, so a lock can never name another file.
+func lockPath(path string) (string, error) {
+	if err := checkIndexPath(path); err != nil {
+		return "", err
+	}
+
+	root := filepath.Join(commonDir, "refs", "locks")
+	target := filepath.Join(root, filepath.FromSlash(path))
+	relPath, err := filepath.Rel(root, target)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path %s: outside the lock directory", path)
+	}
+
+	return target, nil
+}
+
+// currentIdentity returns the identity recorded as the owner of new locks.
+func currentIdentity() (string, error) {
+	email, err := getConfig("email")
+	if err != nil {
+		return "", fmt.Errorf("please set user.email before using locks: %w", err)
+	}
+
+	return email, nil
+}
+
+// getLockOwner returns the owner of the lock on path, or "" if it is not locked.
+func getLockOwner(path string) (string, error) {
+	target, err := lockPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error reading lock for %s: %w", path, err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// lockFile records the current identity as the owner of path.
+func lockFile(path string) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	owner, err := currentIdentity()
+	if err != nil {
+		return err
+	}
+
+	existing, err := getLockOwner(path)
+	if err != nil {
+		return err
+	}
+
+	if existing != "" && existing != owner {
+		return fmt.Errorf("%s is already locked by %s", path, existing)
+	}
+
+	target, err := lockPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("error creating lock directory: %w", err)
+	}
+
+	if err := os.WriteFile(target, []byte(owner+"\n"), 0644); err != nil {
+		return fmt.Errorf("error writing lock for %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// unlockFile releases the lock on path. Locks held by someone else can only
+// be released with force.
+func unlockFile(path string, force bool) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	existing, err := getLockOwner(path)
+	if err != nil {
+		return err
+	}
+
+	if existing == "" {
+		return fmt.Errorf("%s is not locked", path)
+	}
+
+	if !force {
+		owner, err := currentIdentity()
+		if err != nil {
+			return err
+		}
+
+		if existing != owner {
+			return fmt.Errorf("%s is locked by %s; use --force to break the lock", path, existing)
+		}
+	}
+
+	target, err := lockPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil {
+		return fmt.Errorf("error removing lock for %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// listLocks returns all locked paths mapped to their owners.
+func listLocks(ctx context.Context) (map[string]string, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	locks := make(map[string]string)
+	root := fmt.Sprintf("%s/refs/locks", commonDir)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		locks[filepath.ToSlash(relPath)] = strings.TrimSpace(string(content))
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing locks: %w", err)
+	}
+
+	return locks, nil
+}
+
+// warnForeignLocks prints a warning for every path that is locked by
+// someone other than the current user.
+func warnForeignLocks(paths []string) {
+	owner, err := getConfig("email")
+	if err != nil {
+		owner = ""
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		existing, err := getLockOwner(path)
+		if err != nil || existing == "" || existing == owner {
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "warning: %s is locked by %s\n", path, existing)
+	}
+}
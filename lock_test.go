@@ -0,0 +1,65 @@
+package mygit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocks(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("email", "alice@example.com"))
+
+		assert.NoError(t, lockFile("docs/design.psd"))
+		owner, err := getLockOwner("docs/design.psd")
+		assert.NoError(t, err)
+		assert.Equal(t, "alice@example.com", owner)
+
+		// locking again as the owner is fine, as someone else is not
+		assert.NoError(t, lockFile("docs/design.psd"))
+		assert.NoError(t, updateConfig("email", "bob@example.com"))
+		assert.EqualError(t, lockFile("docs/design.psd"), "docs/design.psd is already locked by alice@example.com")
+
+		locks, err := listLocks(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"docs/design.psd": "alice@example.com"}, locks)
+
+		// only the owner unlocks, unless forced
+		assert.EqualError(t, unlockFile("docs/design.psd", false),
+			"docs/design.psd is locked by alice@example.com; use --force to break the lock")
+		assert.NoError(t, unlockFile("docs/design.psd", true))
+		owner, err = getLockOwner("docs/design.psd")
+		assert.NoError(t, err)
+		assert.Empty(t, owner)
+		assert.EqualError(t, unlockFile("docs/design.psd", true), "docs/design.psd is not locked")
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestLockPathTraversal(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("email", "alice@example.com"))
+		assert.NoError(t, os.WriteFile("wt.txt", []byte("tracked\n"), 0644))
+
+		for _, path := range []string{"../../../wt.txt", "a/../../wt.txt", "/etc/passwd", ".mygit/HEAD", ""} {
+			assert.Error(t, lockFile(path), path)
+			assert.Error(t, unlockFile(path, true), path)
+		}
+
+		// the command line refuses paths outside the repository too
+		_, err := resolvePathspec("../../../wt.txt")
+		assert.Error(t, err)
+
+		content, err := os.ReadFile("wt.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "tracked\n", string(content))
+		_, err = os.Stat(".mygit/HEAD")
+		assert.NoError(t, err)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,314 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultMaintenanceInterval is how often maintenance serve checks the
+// registered repositories.
+const defaultMaintenanceInterval = 10 * time.Minute
+
+// defaultMaintenanceIdle is how long a repository must be left alone
+// before maintenance serve works on it.
+const defaultMaintenanceIdle = 5 * time.Minute
+
+// maintenanceReport sums up one maintenance pass over a repository.
+type maintenanceReport struct {
+	packedRefs    int
+	graphCommits  int
+	prunedObjects int
+}
+
+// maintenanceListPath returns the path of the user-level file listing the
+// repositories maintenance serve looks after, one absolute path per line.
+func maintenanceListPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating home directory: %w", err)
+	}
+
+	return filepath.Join(home, "."+vcsName+"maintenance"), nil
+}
+
+// readMaintenanceRepos returns the registered repositories.
+func readMaintenanceRepos() ([]string, error) {
+	listPath, err := maintenanceListPath()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(listPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", listPath, err)
+	}
+
+	var repos []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			repos = append(repos, line)
+		}
+	}
+
+	return repos, nil
+}
+
+// writeMaintenanceRepos replaces the list of registered repositories.
+func writeMaintenanceRepos(repos []string) error {
+	listPath, err := maintenanceListPath()
+	if err != nil {
+		return err
+	}
+
+	content := strings.Join(repos, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if err := os.WriteFile(listPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", listPath, err)
+	}
+
+	return nil
+}
+
+// registerMaintenanceRepo adds the repository at root to the list, unless
+// it is there already. It reports whether the list changed.
+func registerMaintenanceRepo(root string) (bool, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return false, fmt.Errorf("error resolving %s: %w", root, err)
+	}
+	if err := withRepository(root, checkVCSRepo); err != nil {
+		return false, err
+	}
+
+	repos, err := readMaintenanceRepos()
+	if err != nil || slices.Contains(repos, root) {
+		return false, err
+	}
+
+	return true, writeMaintenanceRepos(append(repos, root))
+}
+
+// unregisterMaintenanceRepo removes the repository at root from the list.
+// It reports whether the repository was registered.
+func unregisterMaintenanceRepo(root string) (bool, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return false, fmt.Errorf("error resolving %s: %w", root, err)
+	}
+
+	repos, err := readMaintenanceRepos()
+	if err != nil || !slices.Contains(repos, root) {
+		return false, err
+	}
+
+	return true, writeMaintenanceRepos(slices.DeleteFunc(repos, func(repo string) bool { return repo == root }))
+}
+
+// maintenanceLockPath returns the path whose lock file is held while
+// refs are packed, the commit-graph is written, or objects are pruned, so
+// gc, compact, and maintenance never run at the same time.
+func maintenanceLockPath() string {
+	return filepath.Join(commonDir, "maintenance")
+}
+
+// withMaintenanceLock runs fn while holding the maintenance lock.
+func withMaintenanceLock(fn func() error) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	lock, err := acquireLockFile(maintenanceLockPath())
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	return fn()
+}
+
+// foregroundBusy reports whether another command holds a lock in the
+// repository: a ref, packed-refs, or commit-graph update, or a running
+// gc, compact, or maintenance pass.
+func foregroundBusy(ctx context.Context) (bool, error) {
+	busy := false
+	locksDir := filepath.Join(commonDir, "refs", "locks")
+	objectsDir := filepath.Join(commonDir, "objects")
+
+	err := filepath.WalkDir(commonDir, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // removed while walking
+			}
+			return err
+		}
+		if d.IsDir() && (path == locksDir || path == objectsDir) {
+			return filepath.SkipDir // path locks and objects take no lock files
+		}
+		if !d.IsDir() && isLockFileName(d.Name()) {
+			busy = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking for running commands: %w", err)
+	}
+
+	return busy, nil
+}
+
+// lastActivity returns when the repository last changed: the newest
+// modification time of HEAD, the index, packed-refs, any ref, or any
+// object directory.
+func lastActivity(ctx context.Context) (time.Time, error) {
+	var latest time.Time
+	note := func(info fs.FileInfo) {
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	for _, path := range []string{filepath.Join(gitDir, "HEAD"), filepath.Join(gitDir, "index"), packedRefsPath()} {
+		if info, err := os.Stat(path); err == nil {
+			note(info)
+		}
+	}
+
+	for _, dir := range []string{filepath.Join(commonDir, "refs"), filepath.Join(commonDir, "objects")} {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil // removed while walking
+			}
+			note(info)
+
+			// new objects show in their fan-out directory's time
+			if filepath.Dir(path) == filepath.Join(commonDir, "objects") && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return latest, fmt.Errorf("error checking repository activity: %w", err)
+		}
+	}
+
+	return latest, nil
+}
+
+// runMaintenance packs loose refs, rewrites the commit-graph, and prunes
+// unreachable objects past the compact grace period, holding the
+// maintenance lock throughout.
+func runMaintenance(ctx context.Context) (maintenanceReport, error) {
+	var report maintenanceReport
+
+	err := withMaintenanceLock(func() error {
+		var err error
+		if report.packedRefs, err = packRefs(ctx); err != nil {
+			return err
+		}
+		if report.graphCommits, err = writeCommitGraph(ctx); err != nil {
+			return err
+		}
+
+		compacted, err := compactRepository(ctx, defaultCompactGrace, false)
+		report.prunedObjects = len(compacted.prunedObjects)
+		return err
+	})
+
+	return report, err
+}
+
+// maintainIfIdle runs maintenance in the current repository if it changed
+// since done and has been left alone for idle, and no other command holds
+// a lock. It returns the new value for done and whether it ran.
+func maintainIfIdle(ctx context.Context, done time.Time, idle time.Duration) (time.Time, maintenanceReport, bool, error) {
+	changed, err := lastActivity(ctx)
+	if err != nil {
+		return done, maintenanceReport{}, false, err
+	}
+	if !changed.After(done) || time.Since(changed) < idle {
+		return done, maintenanceReport{}, false, nil
+	}
+
+	if busy, err := foregroundBusy(ctx); err != nil || busy {
+		return done, maintenanceReport{}, false, err
+	}
+
+	report, err := runMaintenance(ctx)
+	if err != nil {
+		return done, report, false, err
+	}
+
+	// maintenance itself changes the repository
+	if done, err = lastActivity(ctx); err != nil {
+		return done, report, true, err
+	}
+
+	return done, report, true, nil
+}
+
+// serveMaintenance checks the registered repositories every interval until
+// ctx is done, maintaining each that is idle, and then returns ctx's error.
+// A repository that fails is reported and tried again on the next round.
+func serveMaintenance(ctx context.Context, interval, idle time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	done := make(map[string]time.Time)
+	for {
+		repos, err := readMaintenanceRepos()
+		if err != nil {
+			return err
+		}
+
+		for _, repo := range repos {
+			var report maintenanceReport
+			ran := false
+
+			err := withRepository(repo, func() error {
+				var err error
+				done[repo], report, ran, err = maintainIfIdle(ctx, done[repo], idle)
+				return err
+			})
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "%s: maintenance failed: %v\n", repo, err)
+			case ran:
+				fmt.Printf("%s: packed %d refs, wrote commit-graph with %d commits, pruned %d objects\n",
+					repo, report.packedRefs, report.graphCommits, report.prunedObjects)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
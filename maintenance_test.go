@@ -0,0 +1,110 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceRegistry(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	t.Setenv("HOME", t.TempDir())
+
+	added, err := registerMaintenanceRepo(".")
+	assert.NoError(t, err)
+	assert.True(t, added)
+	added, err = registerMaintenanceRepo(".")
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	root, err := filepath.Abs(".")
+	assert.NoError(t, err)
+	repos, err := readMaintenanceRepos()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{root}, repos)
+
+	_, err = registerMaintenanceRepo(t.TempDir())
+	assert.Error(t, err) // not a repository
+
+	removed, err := unregisterMaintenanceRepo(".")
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	repos, err = readMaintenanceRepos()
+	assert.NoError(t, err)
+	assert.Empty(t, repos)
+}
+
+func TestMaintainIfIdle(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "maintenance@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	blobHash, err := createObject([]byte("content\n"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{"file.txt": blobHash})
+	assert.NoError(t, err)
+	commitHash, err := writeCommitObject(treeHash, nil, "base")
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef("refs/heads/main", commitHash))
+
+	// a repository still being worked on is left alone
+	_, _, ran, err := maintainIfIdle(t.Context(), time.Time{}, time.Hour)
+	assert.NoError(t, err)
+	assert.False(t, ran)
+
+	// so is one where another command holds a lock
+	lock, err := acquireLockFile(filepath.Join(commonDir, "refs", "heads", "main"))
+	assert.NoError(t, err)
+	_, _, ran, err = maintainIfIdle(t.Context(), time.Time{}, 0)
+	assert.NoError(t, err)
+	assert.False(t, ran)
+	lock.release()
+
+	done, report, ran, err := maintainIfIdle(t.Context(), time.Time{}, 0)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, 1, report.packedRefs)
+	assert.Equal(t, 1, report.graphCommits)
+
+	// nothing changed since, so there is nothing to do
+	_, _, ran, err = maintainIfIdle(t.Context(), done, 0)
+	assert.NoError(t, err)
+	assert.False(t, ran)
+
+	// the lock keeps gc, compact, and maintenance apart
+	lock, err = acquireLockFile(maintenanceLockPath())
+	assert.NoError(t, err)
+	defer lock.release()
+	_, err = runMaintenance(t.Context())
+	assert.Error(t, err)
+}
+
+func TestServeMaintenanceStops(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	served := make(chan error, 1)
+	go func() { served <- serveMaintenance(ctx, time.Hour, 0) }()
+
+	// the wait for the next round ends as soon as ctx is done
+	cancel()
+	select {
+	case err := <-served:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveMaintenance did not return after its context was canceled")
+	}
+}
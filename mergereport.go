@@ -0,0 +1,138 @@
+package mygit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+)
+
+// mergeResolution describes how a single path was resolved by a merge.
+type mergeResolution string
+
+const (
+	resolutionBase     mergeResolution = "base"     // unchanged on both sides
+	resolutionOurs     mergeResolution = "ours"     // only our side changed
+	resolutionTheirs   mergeResolution = "theirs"   // only their side changed
+	resolutionBoth     mergeResolution = "both"     // both sides made the same change
+	resolutionConflict mergeResolution = "conflict" // both sides changed differently
+)
+
+// conflictHunk gives the line numbers of the conflict markers written to a file.
+type conflictHunk struct {
+	Start     int `json:"start"`     // line of <<<<<<<
+	Separator int `json:"separator"` // line of =======
+	End       int `json:"end"`       // line of >>>>>>>
+}
+
+// pathResolution is the report entry for a single path.
+type pathResolution struct {
+	Path       string          `json:"path"`
+	Resolution mergeResolution `json:"resolution"`
+	Deleted    bool            `json:"deleted,omitempty"`
+	Kind       conflictKind    `json:"kind,omitempty"`       // file/directory or case for structural conflicts
+	MovedFrom  string          `json:"moved_from,omitempty"` // where a file moved aside by a structural conflict belonged
+	Binary     bool            `json:"binary,omitempty"`     // a binary conflict, left as our version without markers
+	Hunks      []conflictHunk  `json:"hunks,omitempty"`
+}
+
+// mergeReport is a structured description of a merge. Paths are only
+// reported for three-way merges.
+type mergeReport struct {
+	Branch string           `json:"branch"`
+	Result string           `json:"result"` // up-to-date, fast-forward, merged or conflicted
+	Base   string           `json:"base,omitempty"`
+	Ours   string           `json:"ours"`
+	Theirs string           `json:"theirs"`
+	Commit string           `json:"commit,omitempty"`
+	Paths  []pathResolution `json:"paths,omitempty"`
+}
+
+// classifyMergePaths reports the resolution of every path in a three-way
+// merge, sorted by path.
+func classifyMergePaths(base, ours, theirs map[string][]byte, conflicts map[string]Conflict) []pathResolution {
+	uniquePaths := make(map[string]struct{})
+	for _, index := range []map[string][]byte{base, ours, theirs} {
+		for path := range index {
+			uniquePaths[path] = struct{}{}
+		}
+	}
+	// a file moved aside by a structural conflict is reported at its new path
+	for path, conflict := range conflicts {
+		uniquePaths[path] = struct{}{}
+		if conflict.MovedFrom != "" {
+			delete(uniquePaths, conflict.MovedFrom)
+		}
+	}
+
+	var paths []pathResolution
+	for path := range uniquePaths {
+		entry := pathResolution{Path: path}
+
+		if conflict, ok := conflicts[path]; ok {
+			entry.Resolution = resolutionConflict
+			if conflict.Kind == conflictFileDirectory || conflict.Kind == conflictCase {
+				entry.Kind = conflict.Kind
+				entry.MovedFrom = conflict.MovedFrom
+			} else if conflict.Binary {
+				entry.Binary = true
+			} else {
+				entry.Hunks = []conflictHunk{conflictMarkerHunk(conflict)}
+			}
+			paths = append(paths, entry)
+			continue
+		}
+
+		baseHash, oursHash, theirsHash := base[path], ours[path], theirs[path]
+		switch {
+		case slices.Equal(oursHash, theirsHash) && slices.Equal(oursHash, baseHash):
+			entry.Resolution = resolutionBase
+		case slices.Equal(oursHash, theirsHash):
+			entry.Resolution = resolutionBoth
+			entry.Deleted = oursHash == nil
+		case slices.Equal(oursHash, baseHash):
+			entry.Resolution = resolutionTheirs
+			entry.Deleted = theirsHash == nil
+		default:
+			entry.Resolution = resolutionOurs
+			entry.Deleted = oursHash == nil
+		}
+
+		paths = append(paths, entry)
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Path < paths[j].Path
+	})
+
+	return paths
+}
+
+// conflictMarkerHunk returns the marker positions writeConflictMarkers
+// produces for the given conflict.
+func conflictMarkerHunk(conflict Conflict) conflictHunk {
+	_, hunk := conflictMarkerContent(conflict)
+	return hunk
+}
+
+// writeMergeReport writes the report as indented JSON to path, or to
+// stdout if path is "-".
+func writeMergeReport(report *mergeReport, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding merge report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing merge report %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package mygit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyMergePaths(t *testing.T) {
+	base := map[string][]byte{
+		"same.txt":    []byte("s"),
+		"ours.txt":    []byte("o1"),
+		"theirs.txt":  []byte("t1"),
+		"gone.txt":    []byte("g"),
+		"clash.txt":   []byte("c1"),
+		"dropped.txt": []byte("d"),
+	}
+	ours := map[string][]byte{
+		"same.txt":    []byte("s"),
+		"ours.txt":    []byte("o2"),
+		"theirs.txt":  []byte("t1"),
+		"clash.txt":   []byte("c2"),
+		"dropped.txt": []byte("d"),
+		"added.txt":   []byte("a"),
+	}
+	theirs := map[string][]byte{
+		"same.txt":   []byte("s"),
+		"ours.txt":   []byte("o1"),
+		"theirs.txt": []byte("t2"),
+		"clash.txt":  []byte("c3"),
+		"added.txt":  []byte("a"),
+	}
+	conflicts := map[string]Conflict{
+		"clash.txt": {OurContent: []byte("one\ntwo\n"), TheirContent: []byte("three\n")},
+	}
+
+	paths := classifyMergePaths(base, ours, theirs, conflicts)
+
+	expected := []pathResolution{
+		{Path: "added.txt", Resolution: resolutionBoth},
+		{Path: "clash.txt", Resolution: resolutionConflict, Hunks: []conflictHunk{{Start: 1, Separator: 4, End: 6}}},
+		{Path: "dropped.txt", Resolution: resolutionTheirs, Deleted: true},
+		{Path: "gone.txt", Resolution: resolutionBoth, Deleted: true},
+		{Path: "ours.txt", Resolution: resolutionOurs},
+		{Path: "same.txt", Resolution: resolutionBase},
+		{Path: "theirs.txt", Resolution: resolutionTheirs},
+	}
+	assert.Equal(t, expected, paths)
+}
+
+func TestClassifyMovedAsidePaths(t *testing.T) {
+	ours := map[string][]byte{"docs/a.txt": []byte("a")}
+	theirs := map[string][]byte{"docs": []byte("d")}
+	conflicts := map[string]Conflict{
+		"docs~branch": {Kind: conflictFileDirectory, MovedFrom: "docs", TheirContent: []byte("d\n")},
+	}
+
+	// the file is reported where it was moved, not where it came from
+	paths := classifyMergePaths(map[string][]byte{}, ours, theirs, conflicts)
+
+	expected := []pathResolution{
+		{Path: "docs/a.txt", Resolution: resolutionOurs},
+		{Path: "docs~branch", Resolution: resolutionConflict, Kind: conflictFileDirectory, MovedFrom: "docs"},
+	}
+	assert.Equal(t, expected, paths)
+}
+
+func TestConflictMarkerHunk(t *testing.T) {
+	// the reported lines are those the markers are written on, also when a
+	// side does not end in a newline
+	for _, conflict := range []Conflict{
+		{OurContent: []byte("one\ntwo\n"), TheirContent: []byte("three\n"), BranchName: "feature"},
+		{OurContent: []byte("one\ntwo"), TheirContent: []byte("three"), BranchName: "feature"},
+		{OurContent: []byte(""), TheirContent: []byte("three"), BranchName: "feature"},
+	} {
+		content, _ := conflictMarkerContent(conflict)
+		lines := strings.Split(string(content), "\n")
+		hunk := conflictMarkerHunk(conflict)
+
+		assert.Equal(t, "<<<<<<< HEAD", lines[hunk.Start-1], "%q", conflict.OurContent)
+		assert.Equal(t, "=======", lines[hunk.Separator-1], "%q", conflict.OurContent)
+		assert.Equal(t, ">>>>>>> feature", lines[hunk.End-1], "%q", conflict.OurContent)
+	}
+}
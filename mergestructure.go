@@ -0,0 +1,166 @@
+package mygit
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// conflictKind tells apart the ways a path can conflict in a merge.
+type conflictKind string
+
+const (
+	conflictContent       conflictKind = "content"        // both sides changed the file differently
+	conflictFileDirectory conflictKind = "file/directory" // a file on one side, a directory on the other
+	conflictCase          conflictKind = "case"           // paths that differ only in case
+)
+
+// describe returns the line reported for a conflict at path, with what to
+// do about it.
+func (c Conflict) describe(path string) string {
+	switch c.Kind {
+	case conflictFileDirectory:
+		return fmt.Sprintf("Conflict (file/directory) in %s: %s is a file on one side and a directory on the other; "+
+			"the file was moved to %s. Add it under a new name or remove it, then commit.",
+			path, c.MovedFrom, path)
+	case conflictCase:
+		return fmt.Sprintf("Conflict (case) in %s: %s and %s differ only in case and cannot both exist on this file system; "+
+			"%s was moved to %s. Add it under a name that does not collide or remove it, then commit.",
+			path, c.KeptPath, c.MovedFrom, c.MovedFrom, path)
+	}
+	if c.Binary {
+		return fmt.Sprintf("Conflict (binary) in %s: binary files cannot be merged; our version was kept. "+
+			"Use checkout --ours or --theirs to pick one, then add it and commit.", path)
+	}
+
+	return fmt.Sprintf("Conflict in file: %s", path)
+}
+
+// movedAsidePath returns the name a file is moved to when it cannot keep
+// its path: "<path>~HEAD" for our side or "<path>~<branch>" for theirs.
+func movedAsidePath(filePath, side string) string {
+	return filePath + "~" + strings.ReplaceAll(side, "/", "_")
+}
+
+// detectStructuralConflicts looks for paths in the merge result that cannot
+// exist together in a working tree and moves one of each pair aside,
+// recording a conflict at the new path. When a file on one side has the
+// name of a directory on the other, the file is moved. When ignoreCase is
+// set and their side brings a path that differs only in case from one of
+// ours, their file is moved. merged and conflicts are updated in place.
+func detectStructuralConflicts(
+	ours, theirs, merged map[string][]byte, conflicts map[string]Conflict,
+	branchName string, ignoreCase bool, readBlob readBlobFunc,
+) error {
+	// moveAside replaces the merge result for filePath with a conflict at
+	// a new path holding the file from the given side
+	moveAside := func(filePath string, fromOurs bool, kind conflictKind, keptPath string) error {
+		conflict := Conflict{Kind: kind, BranchName: branchName, MovedFrom: filePath, KeptPath: keptPath}
+		side, hash := branchName, theirs[filePath]
+		if fromOurs {
+			side, hash = "HEAD", ours[filePath]
+		}
+
+		content, err := readBlob(hash)
+		if err != nil {
+			return err
+		}
+		if fromOurs {
+			conflict.OurHash, conflict.OurContent = hash, content
+		} else {
+			conflict.TheirHash, conflict.TheirContent = hash, content
+		}
+
+		delete(merged, filePath)
+		delete(conflicts, filePath)
+		conflicts[movedAsidePath(filePath, side)] = conflict
+		return nil
+	}
+
+	// every path the merge leaves as a file in the working tree
+	files := func() map[string]bool {
+		paths := make(map[string]bool)
+		for filePath := range merged {
+			paths[filePath] = true
+		}
+		for filePath := range conflicts {
+			paths[filePath] = true
+		}
+		return paths
+	}
+
+	hasDirectory := func(index map[string][]byte, dir string) bool {
+		for filePath := range index {
+			if strings.HasPrefix(filePath, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	current := files()
+	var fileDirs []string
+	for filePath := range current {
+		for dir := path.Dir(filePath); dir != "."; dir = path.Dir(dir) {
+			if current[dir] && !slices.Contains(fileDirs, dir) {
+				fileDirs = append(fileDirs, dir)
+			}
+		}
+	}
+	slices.Sort(fileDirs)
+
+	for _, filePath := range fileDirs {
+		// the file moves when the other side brought the directory
+		_, oursHasFile := ours[filePath]
+		fromOurs := oursHasFile && hasDirectory(theirs, filePath)
+		if !fromOurs {
+			if _, ok := theirs[filePath]; !ok {
+				continue // both names come from one side's tree
+			}
+		}
+
+		if err := moveAside(filePath, fromOurs, conflictFileDirectory, filePath+"/"); err != nil {
+			return err
+		}
+	}
+
+	if !ignoreCase {
+		return nil
+	}
+
+	folded := make(map[string][]string)
+	for filePath := range files() {
+		key := strings.ToLower(filePath)
+		folded[key] = append(folded[key], filePath)
+	}
+
+	for _, group := range folded {
+		if len(group) < 2 {
+			continue
+		}
+		slices.Sort(group)
+
+		// our path keeps its place; any other spelling from their side moves
+		var kept []string
+		for _, filePath := range group {
+			if _, ok := ours[filePath]; ok {
+				kept = append(kept, filePath)
+			}
+		}
+		if len(kept) != 1 {
+			continue // the collision is already in one side's tree
+		}
+
+		for _, filePath := range group {
+			if _, ok := theirs[filePath]; filePath == kept[0] || !ok {
+				continue
+			}
+			if err := moveAside(filePath, false, conflictCase, kept[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
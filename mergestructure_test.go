@@ -0,0 +1,78 @@
+package mygit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructuralConflicts(t *testing.T) {
+	// the tests use contents as hashes
+	readContent := func(hash []byte) ([]byte, error) { return hash, nil }
+
+	tests := []struct {
+		name               string
+		base, ours, theirs map[string][]byte
+		ignoreCase         bool
+		expectedIndex      map[string][]byte
+		expectedConflicts  map[string]Conflict
+	}{
+		{
+			name:          "their file where we have a directory",
+			base:          map[string][]byte{"README": []byte("r")},
+			ours:          map[string][]byte{"README": []byte("r"), "docs/a.txt": []byte("a")},
+			theirs:        map[string][]byte{"README": []byte("r"), "docs": []byte("d")},
+			expectedIndex: map[string][]byte{"README": []byte("r"), "docs/a.txt": []byte("a")},
+			expectedConflicts: map[string]Conflict{
+				"docs~branch": {Kind: conflictFileDirectory, MovedFrom: "docs", KeptPath: "docs/"},
+			},
+		},
+		{
+			name:          "our file where they add a directory",
+			base:          map[string][]byte{"x": []byte("x")},
+			ours:          map[string][]byte{"x": []byte("x")},
+			theirs:        map[string][]byte{"x": []byte("x"), "x/y": []byte("y")},
+			expectedIndex: map[string][]byte{"x/y": []byte("y")},
+			expectedConflicts: map[string]Conflict{
+				"x~HEAD": {Kind: conflictFileDirectory, MovedFrom: "x", KeptPath: "x/"},
+			},
+		},
+		{
+			name:          "paths differing in case on a case-sensitive file system",
+			base:          map[string][]byte{},
+			ours:          map[string][]byte{"README.md": []byte("ours")},
+			theirs:        map[string][]byte{"readme.md": []byte("theirs")},
+			expectedIndex: map[string][]byte{"README.md": []byte("ours"), "readme.md": []byte("theirs")},
+		},
+		{
+			name:          "paths differing in case on a case-insensitive file system",
+			base:          map[string][]byte{},
+			ours:          map[string][]byte{"README.md": []byte("ours")},
+			theirs:        map[string][]byte{"readme.md": []byte("theirs")},
+			ignoreCase:    true,
+			expectedIndex: map[string][]byte{"README.md": []byte("ours")},
+			expectedConflicts: map[string]Conflict{
+				"readme.md~branch": {Kind: conflictCase, MovedFrom: "readme.md", KeptPath: "README.md"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts, err := calculateMerge(tt.base, tt.ours, tt.theirs, "branch", tt.ignoreCase, readContent)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedIndex, merged)
+
+			assert.Len(t, conflicts, len(tt.expectedConflicts))
+			for path, expected := range tt.expectedConflicts {
+				conflict, ok := conflicts[path]
+				if !assert.True(t, ok, "missing conflict %s", path) {
+					continue
+				}
+				assert.Equal(t, expected.Kind, conflict.Kind)
+				assert.Equal(t, expected.MovedFrom, conflict.MovedFrom)
+				assert.Equal(t, expected.KeptPath, conflict.KeptPath)
+			}
+		})
+	}
+}
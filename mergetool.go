@@ -0,0 +1,147 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// mergeToolCommands are the commands of the merge tools known without
+// configuration. They run through sh -c with $BASE, $LOCAL, $REMOTE, and
+// $MERGED naming the files, as a configured command does.
+var mergeToolCommands = map[string]string{
+	"meld":    `meld "$LOCAL" "$BASE" "$REMOTE" --output "$MERGED"`,
+	"kdiff3":  `kdiff3 --auto "$BASE" "$LOCAL" "$REMOTE" -o "$MERGED"`,
+	"vimdiff": `vim -f -d -c '4wincmd w | wincmd J' "$LOCAL" "$BASE" "$REMOTE" "$MERGED"`,
+}
+
+// mergeToolCommand returns the command of the merge tool to run: the one
+// named, else the one in merge.tool. "config mergetool.<tool>.cmd" gives a
+// tool its command, or overrides that of a known one.
+func mergeToolCommand(tool string) (string, string, error) {
+	if tool == "" {
+		var err error
+		if tool, err = getConfig("tool"); err != nil {
+			return "", "", fmt.Errorf("no merge tool configured; set merge.tool or use --tool")
+		}
+	}
+
+	if command, err := getConfig(tool + ".cmd"); err == nil {
+		return tool, command, nil
+	}
+	if command, ok := mergeToolCommands[tool]; ok {
+		return tool, command, nil
+	}
+
+	return "", "", fmt.Errorf("unknown merge tool %s; set mergetool.%s.cmd", tool, tool)
+}
+
+// runMergeTool runs the merge tool on each of the conflicted paths, or on
+// all of them if none are given. Each path's base, our, and their versions
+// are written next to it, and the tool writes its result over the path,
+// which is staged when the tool exits successfully. A tool that fails stops
+// the run and leaves the path in conflict.
+func runMergeTool(ctx context.Context, tool string, paths []string) error {
+	tool, command, err := mergeToolCommand(tool)
+	if err != nil {
+		return err
+	}
+
+	stages, err := readConflictStages()
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		paths = slices.Sorted(maps.Keys(stages))
+		if len(paths) == 0 {
+			fmt.Println("No files need merging")
+			return nil
+		}
+	}
+	for _, path := range paths {
+		if _, ok := stages[path]; !ok {
+			return fmt.Errorf("path %s is not in conflict", displayPath(path))
+		}
+	}
+
+	conv, err := loadContentConversion()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		fmt.Printf("Merging %s with %s\n", displayPath(path), tool)
+
+		files, err := writeMergeToolFiles(ctx, conv, path, stages[path])
+		if err == nil {
+			cmd := exec.Command("sh", "-c", command)
+			cmd.Dir = workTreeRoot
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+			cmd.Env = append(os.Environ(),
+				"BASE="+files[stageBase],
+				"LOCAL="+files[stageOurs],
+				"REMOTE="+files[stageTheirs],
+				"MERGED="+filepath.FromSlash(path),
+			)
+			if err = cmd.Run(); err != nil {
+				err = fmt.Errorf("merge tool %s failed for %s, which is left in conflict: %w", tool, displayPath(path), err)
+			}
+		}
+
+		for _, file := range files {
+			os.Remove(workTreePath(file))
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, _, err := addPaths(ctx, []string{path}, addOptions{}); err != nil {
+			return err
+		}
+		fmt.Printf("Resolved %s\n", displayPath(path))
+	}
+
+	return nil
+}
+
+// writeMergeToolFiles writes the base, our, and their versions of a
+// conflicted path to temporary files beside it, named as git names them
+// (a.txt gives a_BASE_<pid>.txt), and returns their paths by stage. A side
+// without the path gets an empty file.
+func writeMergeToolFiles(ctx context.Context, conv contentConversion, path string, stages conflictStages) (map[int]string, error) {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(filepath.FromSlash(path), ext)
+	names := map[int]string{stageBase: "BASE", stageOurs: "LOCAL", stageTheirs: "REMOTE"}
+
+	files := make(map[int]string)
+	for _, stage := range []int{stageBase, stageOurs, stageTheirs} {
+		var content []byte
+		if hash, ok := stages[stage]; ok {
+			obj, err := catFile(hash)
+			if err != nil {
+				return files, err
+			}
+			blob, ok := obj.(blobObject)
+			if !ok {
+				return files, fmt.Errorf("object %x is not a blob", hash)
+			}
+			if content, err = conv.toWorkTree(ctx, path, blob.content); err != nil {
+				return files, err
+			}
+		}
+
+		file := fmt.Sprintf("%s_%s_%d%s", stem, names[stage], os.Getpid(), ext)
+		if err := os.WriteFile(workTreePath(file), content, workTreeFileMode); err != nil {
+			return files, fmt.Errorf("error writing %s: %w", file, err)
+		}
+		files[stage] = file
+	}
+
+	return files, nil
+}
@@ -0,0 +1,65 @@
+package mygit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeTool(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		_, _, err := mergeToolCommand("")
+		assert.EqualError(t, err, "no merge tool configured; set merge.tool or use --tool")
+		_, _, err = mergeToolCommand("nano")
+		assert.EqualError(t, err, "unknown merge tool nano; set mergetool.nano.cmd")
+		tool, command, err := mergeToolCommand("meld")
+		assert.NoError(t, err)
+		assert.Equal(t, "meld", tool)
+		assert.Equal(t, mergeToolCommands["meld"], command)
+
+		ours, err := createObject([]byte("ours\n"))
+		assert.NoError(t, err)
+		theirs, err := createObject([]byte("theirs\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.MkdirAll("dir", 0755))
+		for _, path := range []string{"dir/a.txt", "b.txt"} {
+			assert.NoError(t, os.WriteFile(path, []byte("<<<<<<< HEAD\n"), 0644))
+		}
+		assert.NoError(t, setConflictStages(map[string]conflictStages{
+			"dir/a.txt": newConflictStages(nil, ours, theirs),
+			"b.txt":     newConflictStages(nil, ours, theirs),
+		}))
+
+		// a failing tool leaves the path in conflict and cleans up
+		assert.NoError(t, updateConfig("fail.cmd", "false"))
+		err = runMergeTool(t.Context(), "fail", []string{"dir/a.txt"})
+		assert.ErrorContains(t, err, "merge tool fail failed for dir/a.txt")
+		entries, err := os.ReadDir("dir")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		// the tool's result is staged
+		assert.NoError(t, updateConfig("tool", "take"))
+		assert.NoError(t, updateConfig("take.cmd", `test -f "$BASE" && cat "$REMOTE" > "$MERGED"`))
+		assert.NoError(t, runMergeTool(t.Context(), "", []string{"dir/a.txt"}))
+		content, err := os.ReadFile(filepath.Join("dir", "a.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "theirs\n", string(content))
+
+		stages, err := readConflictStages()
+		assert.NoError(t, err)
+		assert.Contains(t, stages, "b.txt")
+		assert.NotContains(t, stages, "dir/a.txt")
+		hash, ok, err := lookupIndexEntry(t.Context(), "dir/a.txt")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, theirs, hash)
+
+		assert.EqualError(t, runMergeTool(t.Context(), "", []string{"dir/a.txt"}), "path dir/a.txt is not in conflict")
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
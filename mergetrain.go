@@ -0,0 +1,211 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// mergeTrainState records a paused merge train.
+type mergeTrainState struct {
+	origHead []byte   // commit the train started from (for --abort)
+	current  string   // branch whose merge stopped on conflicts
+	pending  []string // branches still to merge after current
+}
+
+// mergeTrainPath returns the path of the merge train state file.
+func mergeTrainPath() string {
+	return fmt.Sprintf("%s/MERGE_TRAIN", gitDir)
+}
+
+// isMergeTrainInProgress checks if a paused merge train exists.
+func isMergeTrainInProgress() (bool, error) {
+	_, err := os.Stat(mergeTrainPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking %s: %w", mergeTrainPath(), err)
+	}
+
+	return true, nil
+}
+
+// readMergeTrainState reads the paused merge train state from disk.
+func readMergeTrainState() (mergeTrainState, error) {
+	content, err := os.ReadFile(mergeTrainPath())
+	if err != nil {
+		return mergeTrainState{}, fmt.Errorf("error reading merge train state: %w", err)
+	}
+
+	var state mergeTrainState
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return mergeTrainState{}, fmt.Errorf("invalid merge train entry: %s", line)
+		}
+
+		switch key {
+		case "orig":
+			hash, err := hex.DecodeString(value)
+			if err != nil {
+				return mergeTrainState{}, fmt.Errorf("error decoding merge train origin: %w", err)
+			}
+			state.origHead = hash
+		case "current":
+			state.current = value
+		case "pending":
+			state.pending = append(state.pending, value)
+		default:
+			return mergeTrainState{}, fmt.Errorf("invalid merge train entry: %s", line)
+		}
+	}
+
+	return state, nil
+}
+
+// writeMergeTrainState writes the merge train state to disk.
+func writeMergeTrainState(state mergeTrainState) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("orig %x\n", state.origHead))
+	sb.WriteString(fmt.Sprintf("current %s\n", state.current))
+	for _, branch := range state.pending {
+		sb.WriteString(fmt.Sprintf("pending %s\n", branch))
+	}
+
+	if err := os.WriteFile(mergeTrainPath(), []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("error writing merge train state: %w", err)
+	}
+
+	return nil
+}
+
+// removeMergeTrainState deletes the merge train state file.
+func removeMergeTrainState() error {
+	if err := os.Remove(mergeTrainPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing merge train state: %w", err)
+	}
+
+	return nil
+}
+
+// runMergeTrain merges the given branches one after another into the current
+// branch. On the first conflict it records the remaining branches and stops.
+func runMergeTrain(ctx context.Context, origHead []byte, branches []string) error {
+	for i, branchName := range branches {
+		fmt.Printf("Merging %s\n", branchName)
+
+		if err := mergeBranch(ctx, branchName); err != nil {
+			return err
+		}
+
+		yes, err := isMergeInProgress()
+		if err != nil {
+			return err
+		}
+
+		if yes {
+			state := mergeTrainState{
+				origHead: origHead,
+				current:  branchName,
+				pending:  branches[i+1:],
+			}
+			if err := writeMergeTrainState(state); err != nil {
+				return err
+			}
+
+			fmt.Printf("Merge train stopped at %s; resolve conflicts and run '%s merge-train --continue'\n", branchName, vcsName)
+			return nil
+		}
+	}
+
+	fmt.Println("Merge train complete")
+	return removeMergeTrainState()
+}
+
+// startMergeTrain begins a new merge train for the given branches.
+func startMergeTrain(ctx context.Context, branches []string) error {
+	if yes, err := isMergeTrainInProgress(); err != nil {
+		return err
+	} else if yes {
+		return fmt.Errorf("merge train in progress; use --continue, --skip, or --abort")
+	}
+
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if yes {
+		return errorOf(ErrConflict, "merge in progress; please resolve conflicts and commit before merging again")
+	}
+
+	origHead, err := resolveRevision("HEAD")
+	if err != nil {
+		return err
+	}
+
+	return runMergeTrain(ctx, origHead, branches)
+}
+
+// continueMergeTrain commits the resolved merge and resumes the train.
+func continueMergeTrain(ctx context.Context) error {
+	state, err := readMergeTrainState()
+	if err != nil {
+		return err
+	}
+
+	// commit the resolved merge unless the user already did so
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if yes {
+		if _, err := continueMerge(ctx); err != nil {
+			return err
+		}
+	}
+
+	return runMergeTrain(ctx, state.origHead, state.pending)
+}
+
+// skipMergeTrain abandons the conflicted merge and resumes with the next branch.
+func skipMergeTrain(ctx context.Context) error {
+	state, err := readMergeTrainState()
+	if err != nil {
+		return err
+	}
+
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if yes {
+		if err := abortMerge(ctx); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Skipped %s\n", state.current)
+	return runMergeTrain(ctx, state.origHead, state.pending)
+}
+
+// abortMergeTrain abandons the train and restores the commit it started from.
+func abortMergeTrain(ctx context.Context) error {
+	state, err := readMergeTrainState()
+	if err != nil {
+		return err
+	}
+
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if yes {
+		if err := abortMerge(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := resetToCommit(ctx, state.origHead, resetModeHard); err != nil {
+		return err
+	}
+
+	fmt.Printf("Merge train aborted; reset to %x\n", state.origHead)
+	return removeMergeTrainState()
+}
@@ -0,0 +1,153 @@
+package mygit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withMergeTrainRepository runs fn in a repository whose main branch and
+// the branches clean1, clean2, and conflict all fork off one base commit:
+// clean1 and clean2 add b.txt and c.txt, conflict changes a.txt as main
+// does. fn gets the head of main.
+func withMergeTrainRepository(t *testing.T, fn func(origHead []byte)) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("email", "train@example.com"))
+
+		commitFile := func(name, content, message string) []byte {
+			assert.NoError(t, os.WriteFile(name, []byte(content), 0644))
+			_, _, err := addPaths(t.Context(), []string{name}, addOptions{})
+			assert.NoError(t, err)
+			hash, err := createCommit(t.Context(), message)
+			assert.NoError(t, err)
+			return hash
+		}
+
+		switchTo := func(name string) {
+			_, err := switchBranch(t.Context(), name)
+			assert.NoError(t, err)
+		}
+
+		base := commitFile("a.txt", "base\n", "base")
+		for _, branch := range []struct{ name, file, content string }{
+			{"clean1", "b.txt", "b\n"},
+			{"clean2", "c.txt", "c\n"},
+			{"conflict", "a.txt", "theirs\n"},
+		} {
+			assert.NoError(t, createBranch(branch.name, base))
+			switchTo(branch.name)
+			commitFile(branch.file, branch.content, branch.name)
+		}
+		switchTo("main")
+		origHead := commitFile("a.txt", "ours\n", "ours")
+
+		fn(origHead)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+// assertWorkTreeFile checks the content of a file, "" for a missing one.
+func assertWorkTreeFile(t *testing.T, name, expected string) {
+	content, err := os.ReadFile(name)
+	if expected == "" {
+		assert.True(t, os.IsNotExist(err), "%s should not exist", name)
+		return
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(content), name)
+}
+
+func TestMergeTrainClean(t *testing.T) {
+	withMergeTrainRepository(t, func(origHead []byte) {
+		assert.NoError(t, startMergeTrain(t.Context(), []string{"clean1", "clean2"}))
+
+		assertWorkTreeFile(t, "a.txt", "ours\n")
+		assertWorkTreeFile(t, "b.txt", "b\n")
+		assertWorkTreeFile(t, "c.txt", "c\n")
+
+		inProgress, err := isMergeTrainInProgress()
+		assert.NoError(t, err)
+		assert.False(t, inProgress)
+		merging, err := isMergeInProgress()
+		assert.NoError(t, err)
+		assert.False(t, merging)
+	})
+}
+
+func TestMergeTrainConflict(t *testing.T) {
+	// the train stops at the conflicting branch and records the rest
+	stopAtConflict := func(t *testing.T) {
+		assert.NoError(t, startMergeTrain(t.Context(), []string{"clean1", "conflict", "clean2"}))
+
+		inProgress, err := isMergeTrainInProgress()
+		assert.NoError(t, err)
+		assert.True(t, inProgress)
+		merging, err := isMergeInProgress()
+		assert.NoError(t, err)
+		assert.True(t, merging)
+
+		state, err := readMergeTrainState()
+		assert.NoError(t, err)
+		assert.Equal(t, "conflict", state.current)
+		assert.Equal(t, []string{"clean2"}, state.pending)
+
+		assertWorkTreeFile(t, "b.txt", "b\n")
+		assertWorkTreeFile(t, "c.txt", "")
+		assert.Error(t, startMergeTrain(t.Context(), []string{"clean2"}), "a second train should not start")
+	}
+
+	t.Run("continue", func(t *testing.T) {
+		withMergeTrainRepository(t, func(origHead []byte) {
+			stopAtConflict(t)
+
+			assert.NoError(t, os.WriteFile("a.txt", []byte("resolved\n"), 0644))
+			_, _, err := addPaths(t.Context(), []string{"a.txt"}, addOptions{})
+			assert.NoError(t, err)
+			assert.NoError(t, continueMergeTrain(t.Context()))
+
+			assertWorkTreeFile(t, "a.txt", "resolved\n")
+			assertWorkTreeFile(t, "b.txt", "b\n")
+			assertWorkTreeFile(t, "c.txt", "c\n")
+			inProgress, err := isMergeTrainInProgress()
+			assert.NoError(t, err)
+			assert.False(t, inProgress)
+		})
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		withMergeTrainRepository(t, func(origHead []byte) {
+			stopAtConflict(t)
+
+			assert.NoError(t, skipMergeTrain(t.Context()))
+
+			assertWorkTreeFile(t, "a.txt", "ours\n")
+			assertWorkTreeFile(t, "b.txt", "b\n")
+			assertWorkTreeFile(t, "c.txt", "c\n")
+			inProgress, err := isMergeTrainInProgress()
+			assert.NoError(t, err)
+			assert.False(t, inProgress)
+			merging, err := isMergeInProgress()
+			assert.NoError(t, err)
+			assert.False(t, merging)
+		})
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		withMergeTrainRepository(t, func(origHead []byte) {
+			stopAtConflict(t)
+
+			assert.NoError(t, abortMergeTrain(t.Context()))
+
+			head, err := resolveRevision("HEAD")
+			assert.NoError(t, err)
+			assert.Equal(t, origHead, head)
+			assertWorkTreeFile(t, "a.txt", "ours\n")
+			assertWorkTreeFile(t, "b.txt", "")
+			inProgress, err := isMergeTrainInProgress()
+			assert.NoError(t, err)
+			assert.False(t, inProgress)
+		})
+	})
+}
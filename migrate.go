@@ -0,0 +1,371 @@
+package mygit
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// hashMapPath returns the path of the file mapping SHA-1 ids to their
+// SHA-256 replacements after a migration.
+func hashMapPath() string {
+	return fmt.Sprintf("%s/hash-map", commonDir)
+}
+
+// hashMigration rewrites objects from SHA-1 to SHA-256, remembering the new
+// id of every object it has already converted.
+type hashMigration struct {
+	mapping map[string][]byte // old hex id -> new binary id
+}
+
+// convert rewrites the object with the given SHA-1 id (and everything it
+// references) as SHA-256 objects and returns its new id.
+func (m *hashMigration) convert(oldHash []byte) ([]byte, error) {
+	oldHex := hex.EncodeToString(oldHash)
+	if newHash, ok := m.mapping[oldHex]; ok {
+		return newHash, nil
+	}
+
+	data, objType, _, err := readRawObject(oldHash)
+	if err != nil {
+		return nil, fmt.Errorf("error reading object %s: %w", oldHex, err)
+	}
+
+	switch objType {
+	case "blob":
+		// content is unchanged, only the id differs
+	case "tree":
+		tree, err := parseTreeObject(data)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := make([]treeEntry, 0, len(tree.entries))
+		for _, entry := range tree.entries {
+			if entry.objType == "commit" {
+				return nil, fmt.Errorf("tree %s contains submodule %s, which cannot be migrated", oldHex, entry.name)
+			}
+
+			newEntryHash, err := m.convert(entry.hash)
+			if err != nil {
+				return nil, err
+			}
+			entry.hash = newEntryHash
+			entries = append(entries, entry)
+		}
+
+		data = encodeTreeObject(entries)
+	case "commit":
+		if data, err = m.rewriteCommitHeader(data); err != nil {
+			return nil, fmt.Errorf("error rewriting commit %s: %w", oldHex, err)
+		}
+	default:
+		return nil, &UnknownObjectTypeError{Type: objType, Hash: oldHex}
+	}
+
+	newHash := sumObjectAs("sha256", data)
+	if err := writeObjectFile(newHash, data); err != nil {
+		return nil, err
+	}
+
+	m.mapping[oldHex] = newHash
+	return newHash, nil
+}
+
+// rewriteCommitHeader replaces the tree and parent ids of a commit, leaving
+// the identity lines and message byte for byte unchanged.
+func (m *hashMigration) rewriteCommitHeader(data []byte) ([]byte, error) {
+	headerEnd := bytes.IndexByte(data, 0)
+	if headerEnd == -1 {
+		return nil, fmt.Errorf("missing header terminator")
+	}
+
+	lines := strings.SplitAfter(string(data[headerEnd+1:]), "\n")
+	for i, line := range lines {
+		if line == "\n" {
+			break // end of the commit header
+		}
+
+		field, value, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		if !ok || (field != "tree" && field != "parent") {
+			continue
+		}
+
+		oldHash, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s id: %w", field, err)
+		}
+
+		newHash, err := m.convert(oldHash)
+		if err != nil {
+			return nil, err
+		}
+
+		lines[i] = fmt.Sprintf("%s %x\n", field, newHash)
+	}
+
+	content := strings.Join(lines, "")
+	return append([]byte(fmt.Sprintf("commit %d\x00", len(content))), content...), nil
+}
+
+// migrateObjectFormat rewrites every object, ref, and index entry of a SHA-1
+// repository as SHA-256, records the old-to-new mapping in hash-map, and
+// removes the SHA-1 objects. It returns the number of objects migrated.
+func migrateObjectFormat(ctx context.Context) (int, error) {
+	if err := checkVCSRepo(); err != nil {
+		return 0, err
+	}
+
+	if objectFormat() != "sha1" {
+		return 0, fmt.Errorf("repository already uses %s", objectFormat())
+	}
+
+	// merge state files hold ids that would go stale
+	if yes, err := isMergeInProgress(); err != nil {
+		return 0, err
+	} else if yes {
+		return 0, errorOf(ErrConflict, "merge in progress; commit or abort it before migrating")
+	}
+	if yes, err := isMergeTrainInProgress(); err != nil {
+		return 0, err
+	} else if yes {
+		return 0, fmt.Errorf("merge train in progress; finish or abort it before migrating")
+	}
+
+	// linked worktrees have indexes and merge state of their own
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return 0, err
+	}
+	for _, worktree := range worktrees {
+		if worktree.linked {
+			return 0, fmt.Errorf("linked worktree at %s; remove it before migrating", worktree.path)
+		}
+	}
+
+	oldHashes, err := listObjectHashes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// write every new object before touching refs, so a failure leaves the
+	// repository usable as SHA-1
+	migration := &hashMigration{mapping: make(map[string][]byte)}
+	for _, oldHash := range oldHashes {
+		if _, err := migration.convert(oldHash); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := writeHashMap(migration.mapping); err != nil {
+		return 0, err
+	}
+
+	if err := migrateRefs(ctx, migration.mapping); err != nil {
+		return 0, err
+	}
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for path, hash := range index {
+		newHash, ok := migration.mapping[hex.EncodeToString(hash)]
+		if !ok {
+			return 0, fmt.Errorf("object %x for %s is missing from the object store", hash, path)
+		}
+		index[path] = newHash
+	}
+	// cached trees are rebuilt on the next write-tree
+	if err := writeIndexFile(index, nil); err != nil {
+		return 0, err
+	}
+
+	if err := updateConfig("objectFormat", "sha256"); err != nil {
+		return 0, err
+	}
+
+	// the commit-graph names SHA-1 commits; gc writes a new one
+	if err := os.Remove(commitGraphPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("error removing commit-graph: %w", err)
+	}
+
+	for _, oldHash := range oldHashes {
+		objectPath := fmt.Sprintf("%s/objects/%x/%x", commonDir, oldHash[:1], oldHash[1:])
+		if err := os.Remove(objectPath); err != nil {
+			return 0, fmt.Errorf("error removing object %x: %w", oldHash, err)
+		}
+		os.Remove(filepath.Dir(objectPath)) // only succeeds once the fan-out directory is empty
+	}
+
+	return len(oldHashes), nil
+}
+
+// listObjectHashes returns the ids of all objects in the store.
+func listObjectHashes(ctx context.Context) ([][]byte, error) {
+	var hashes [][]byte
+
+	objectsDir := fmt.Sprintf("%s/objects", commonDir)
+	err := filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(objectsDir, path)
+		if err != nil {
+			return err
+		}
+
+		hash, err := hex.DecodeString(strings.ReplaceAll(filepath.ToSlash(rel), "/", ""))
+		if err != nil {
+			return nil // not an object file
+		}
+
+		hashes = append(hashes, hash)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// migrateRefs points every loose and packed ref at the migrated ids.
+func migrateRefs(ctx context.Context, mapping map[string][]byte) error {
+	refsDir := fmt.Sprintf("%s/refs", commonDir)
+	locksDir := filepath.Join(refsDir, "locks")
+
+	err := filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == locksDir {
+				return filepath.SkipDir // locks hold owners, not object ids
+			}
+			return nil
+		}
+		if isLockFileName(d.Name()) {
+			return nil // ref update in progress
+		}
+
+		rel, err := filepath.Rel(commonDir, path)
+		if err != nil {
+			return err
+		}
+		refPath := filepath.ToSlash(rel)
+
+		hash, err := getRef(refPath)
+		if err != nil {
+			return err
+		}
+		if hash == nil {
+			return nil // branch without commits
+		}
+
+		newHash, ok := mapping[hex.EncodeToString(hash)]
+		if !ok {
+			return fmt.Errorf("object %x for %s is missing from the object store", hash, refPath)
+		}
+
+		return updateRef(refPath, newHash)
+	})
+	if err != nil {
+		return fmt.Errorf("error migrating refs: %w", err)
+	}
+
+	packed, err := readPackedRefs()
+	if err != nil {
+		return err
+	}
+	for refPath, hash := range packed {
+		newHash, ok := mapping[hex.EncodeToString(hash)]
+		if !ok {
+			return fmt.Errorf("object %x for %s is missing from the object store", hash, refPath)
+		}
+		packed[refPath] = newHash
+	}
+
+	return writePackedRefs(packed)
+}
+
+// writeHashMap writes the migration mapping as "<sha1> <sha256>" lines
+// sorted by the old id.
+func writeHashMap(mapping map[string][]byte) error {
+	oldHexes := make([]string, 0, len(mapping))
+	for oldHex := range mapping {
+		oldHexes = append(oldHexes, oldHex)
+	}
+	slices.Sort(oldHexes)
+
+	var sb strings.Builder
+	for _, oldHex := range oldHexes {
+		sb.WriteString(fmt.Sprintf("%s %x\n", oldHex, mapping[oldHex]))
+	}
+
+	if err := os.WriteFile(hashMapPath(), []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("error writing hash map: %w", err)
+	}
+
+	return nil
+}
+
+// translateHash looks up a hex id, or a prefix of one at least
+// minHashPrefixLen characters long, in the migration mapping and returns
+// its counterpart in the other format. ok is false when no id matches or
+// the repository was never migrated; a prefix matching several ids is an
+// error.
+func translateHash(hexHash string) (string, bool, error) {
+	content, err := os.ReadFile(hashMapPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("error reading hash map: %w", err)
+	}
+
+	hexHash = strings.ToLower(hexHash)
+	isPrefix := len(hexHash) >= minHashPrefixLen && isHex(hexHash)
+
+	var matches []string
+	for _, line := range strings.Split(string(content), "\n") {
+		oldHex, newHex, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+
+		switch {
+		case hexHash == oldHex:
+			return newHex, true, nil
+		case hexHash == newHex:
+			return oldHex, true, nil
+		case isPrefix && strings.HasPrefix(oldHex, hexHash):
+			matches = append(matches, newHex)
+		case isPrefix && strings.HasPrefix(newHex, hexHash):
+			matches = append(matches, oldHex)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", false, nil
+	case 1:
+		return matches[0], true, nil
+	default:
+		return "", false, fmt.Errorf("short hash %s is ambiguous (%d migrated ids match)", hexHash, len(matches))
+	}
+}
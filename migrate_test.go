@@ -0,0 +1,89 @@
+package mygit
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateObjectFormat(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "migrate@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	blobHash, err := createObject([]byte("content\n"))
+	assert.NoError(t, err)
+	index := map[string][]byte{"dir/file.txt": blobHash}
+	assert.NoError(t, writeIndex(t.Context(), index))
+
+	treeHash, err := writeIndexTree(index)
+	assert.NoError(t, err)
+	firstCommit, err := writeCommitObject(treeHash, nil, "first")
+	assert.NoError(t, err)
+	secondCommit, err := writeCommitObject(treeHash, [][]byte{firstCommit}, fmt.Sprintf("revert of %x", firstCommit))
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef("refs/heads/main", secondCommit))
+
+	count, err := migrateObjectFormat(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count) // blob, two trees, two commits
+	assert.Equal(t, "sha256", objectFormat())
+	assert.False(t, objectExists(firstCommit), "sha1 objects should be removed")
+
+	head, err := getRef("refs/heads/main")
+	assert.NoError(t, err)
+	assert.Len(t, head, 32)
+
+	// history, trees and content survive the rewrite
+	obj, err := catFile(head)
+	assert.NoError(t, err)
+	commit := obj.(commitObject)
+	assert.Equal(t, fmt.Sprintf("revert of %x", firstCommit), commit.message)
+	assert.Len(t, commit.parents, 1)
+
+	entries, err := listTreeEntries(commit.hash, "", true)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "dir/file.txt", entries[0].name)
+	assert.Equal(t, hashObject([]byte("content\n")), entries[0].hash)
+
+	index, err = readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, entries[0].hash, index["dir/file.txt"])
+
+	// old ids resolve through the hash map in both directions
+	resolved, err := resolveRevision(hex.EncodeToString(firstCommit))
+	assert.NoError(t, err)
+	assert.Equal(t, commit.parents[0], resolved)
+
+	oldHex, ok, err := translateHash(hex.EncodeToString(resolved))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, hex.EncodeToString(firstCommit), oldHex)
+
+	// so do abbreviated old ids, unless several ids share the prefix
+	short := hex.EncodeToString(firstCommit)[:12]
+	resolved, err = resolveRevision(short)
+	assert.NoError(t, err)
+	assert.Equal(t, commit.parents[0], resolved)
+
+	hashMap, err := os.OpenFile(hashMapPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = fmt.Fprintf(hashMap, "%s%s %s\n", short, strings.Repeat("0", 28), strings.Repeat("f", 64))
+	assert.NoError(t, err)
+	assert.NoError(t, hashMap.Close())
+	_, _, err = translateHash(short)
+	assert.ErrorContains(t, err, "ambiguous")
+
+	_, err = migrateObjectFormat(t.Context())
+	assert.Error(t, err)
+}
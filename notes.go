@@ -0,0 +1,160 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// notesRef is the ref whose commits record the notes attached to commits.
+const notesRef = "refs/notes/commits"
+
+// readNotes returns the notes tree as a map from the hex id of each
+// annotated commit to the blob holding its note, along with the notes
+// commit it was read from (nil when no note was ever added).
+func readNotes(ctx context.Context) (map[string][]byte, []byte, error) {
+	notesCommit, err := readRefIfExists(notesRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	if notesCommit == nil {
+		return map[string][]byte{}, nil, nil
+	}
+
+	notes, err := commitIndex(ctx, notesCommit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading notes: %w", err)
+	}
+
+	return notes, notesCommit, nil
+}
+
+// writeNotes records notes as a new notes commit on top of parent. The
+// previous notes stay in the history of refs/notes/commits.
+func writeNotes(notes map[string][]byte, parent []byte, message string) error {
+	treeHash, err := buildTreeObject(notes)
+	if err != nil {
+		return err
+	}
+
+	var parents [][]byte
+	if parent != nil {
+		parents = [][]byte{parent}
+	}
+
+	notesCommit, err := writeCommitObject(treeHash, parents, message)
+	if err != nil {
+		return err
+	}
+
+	return compareAndSwapRef(notesRef, parent, notesCommit)
+}
+
+// addNote attaches message to the commit named by rev. A commit has at
+// most one note; an existing one is replaced only with force.
+func addNote(ctx context.Context, rev, message string, force bool) error {
+	commitHash, err := resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	notes, parent, err := readNotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%x", commitHash)
+	if _, ok := notes[key]; ok && !force {
+		return fmt.Errorf("a note already exists for commit %s; use -f to overwrite it", abbrevHash(commitHash))
+	}
+
+	blobHash, err := createObject([]byte(strings.TrimRight(message, "\n") + "\n"))
+	if err != nil {
+		return err
+	}
+	notes[key] = blobHash
+
+	return writeNotes(notes, parent, fmt.Sprintf("Notes added by 'notes add' for %s", key))
+}
+
+// readNote returns the note attached to commitHash, or nil if it has none.
+func readNote(notes map[string][]byte, commitHash []byte) ([]byte, error) {
+	blobHash, ok := notes[fmt.Sprintf("%x", commitHash)]
+	if !ok {
+		return nil, nil
+	}
+
+	return readBlobFromCatFile(blobHash)
+}
+
+// showNote returns the note attached to the commit named by rev.
+func showNote(ctx context.Context, rev string) ([]byte, error) {
+	commitHash, err := resolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, _, err := readNotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := readNote(notes, commitHash)
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		return nil, fmt.Errorf("no note found for commit %s", abbrevHash(commitHash))
+	}
+
+	return note, nil
+}
+
+// removeNote detaches the note from the commit named by rev.
+func removeNote(ctx context.Context, rev string) error {
+	commitHash, err := resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	notes, parent, err := readNotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%x", commitHash)
+	if _, ok := notes[key]; !ok {
+		return fmt.Errorf("no note found for commit %s", abbrevHash(commitHash))
+	}
+	delete(notes, key)
+
+	return writeNotes(notes, parent, fmt.Sprintf("Notes removed by 'notes remove' for %s", key))
+}
+
+// resolveCommit resolves rev and checks that it names a commit.
+func resolveCommit(rev string) ([]byte, error) {
+	hash, err := resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := catFile(hash)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := obj.(commitObject); !ok {
+		return nil, fmt.Errorf("object %x is not a commit", hash)
+	}
+
+	return hash, nil
+}
+
+// printNote prints a commit's note below its log entry, indented like the
+// message.
+func printNote(note []byte) {
+	fmt.Println("Notes:")
+	for _, line := range strings.Split(strings.TrimRight(string(note), "\n"), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+	fmt.Println()
+}
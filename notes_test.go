@@ -0,0 +1,65 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotes(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "notes@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	blobHash, err := createObject([]byte("content\n"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{"file.txt": blobHash})
+	assert.NoError(t, err)
+	commitHash, err := writeCommitObject(treeHash, nil, "base")
+	assert.NoError(t, err)
+	head, err := getHEAD()
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef(head, commitHash))
+
+	_, err = showNote(t.Context(), "HEAD")
+	assert.Error(t, err)
+
+	assert.NoError(t, addNote(t.Context(), "HEAD", "build: passed", false))
+	note, err := showNote(t.Context(), "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "build: passed\n", string(note))
+
+	// the commit itself is untouched
+	after, err := resolveRevision("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, commitHash, after)
+
+	// a note is only replaced when asked to
+	assert.Error(t, addNote(t.Context(), "HEAD", "build: failed", false))
+	assert.NoError(t, addNote(t.Context(), "HEAD", "build: failed", true))
+	note, err = showNote(t.Context(), "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "build: failed\n", string(note))
+
+	// every change is a commit on refs/notes/commits
+	notesCommit, err := readRefIfExists(notesRef)
+	assert.NoError(t, err)
+	commit, err := readCommit(notesCommit)
+	assert.NoError(t, err)
+	assert.Len(t, commit.parents, 1)
+
+	assert.NoError(t, removeNote(t.Context(), "HEAD"))
+	_, err = showNote(t.Context(), "HEAD")
+	assert.Error(t, err)
+	assert.Error(t, removeNote(t.Context(), "HEAD"))
+
+	_, err = resolveCommit(fmt.Sprintf("%x", treeHash))
+	assert.Error(t, err)
+}
@@ -1,21 +1,28 @@
-package main
+package mygit
 
 import (
 	"bytes"
 	"compress/flate"
+	"context"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 )
 
 const (
-	entryTypeBlob = 0100644 // regular file
-	entryTypeTree = 0040000 // directory
+	entryTypeBlob    = 0100644 // regular file
+	entryTypeTree    = 0040000 // directory
+	entryTypeGitlink = 0160000 // submodule commit
 )
 
 // Object represents a generic VCS object.
@@ -37,7 +44,7 @@ func (b blobObject) String() string {
 type treeEntry struct {
 	mode    string
 	objType string
-	hash    []byte // 20-byte binary hash
+	hash    []byte // binary hash
 	name    string
 }
 
@@ -57,8 +64,8 @@ func (t treeObject) String() string {
 
 // commitObject represents a commit object.
 type commitObject struct {
-	hash      []byte   // tree hash (20-byte binary)
-	parents   [][]byte // parent commit hashes (20-byte binary)
+	hash      []byte   // tree hash (binary)
+	parents   [][]byte // parent commit hashes (binary)
 	author    string
 	committer string
 	message   string
@@ -83,46 +90,55 @@ func (c commitObject) String() string {
 func createDirectoriesFiles() error {
 	// create directories
 	dirs := []string{
-		fmt.Sprintf(".%s", vcsName),
-		fmt.Sprintf(".%s/objects", vcsName),
-		fmt.Sprintf(".%s/refs", vcsName),
-		fmt.Sprintf(".%s/refs/heads", vcsName),
+		gitDir,
+		fmt.Sprintf("%s/objects", commonDir),
+		fmt.Sprintf("%s/refs", commonDir),
+		fmt.Sprintf("%s/refs/heads", commonDir),
 	}
 
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("error creating directory %s: %v", dir, err)
+			return fmt.Errorf("error creating directory %s: %w", dir, err)
 		}
 	}
 
 	// create files
 	// HEAD file
-	headPath := fmt.Sprintf(".%s/HEAD", vcsName)
+	headPath := fmt.Sprintf("%s/HEAD", gitDir)
 	if err := os.WriteFile(headPath, []byte("ref: refs/heads/main"), 0644); err != nil {
-		return fmt.Errorf("error creating HEAD file: %v", err)
+		return fmt.Errorf("error creating HEAD file: %w", err)
 	}
 
 	// index file
-	indexPath := fmt.Sprintf(".%s/index", vcsName)
+	indexPath := fmt.Sprintf("%s/index", gitDir)
 	f, err := os.Create(indexPath)
 	if err != nil {
-		return fmt.Errorf("error creating index file: %v", err)
+		return fmt.Errorf("error creating index file: %w", err)
 	}
 	f.Close()
 
 	// config file
-	configPath := fmt.Sprintf(".%s/config", vcsName)
+	configPath := fmt.Sprintf("%s/config", commonDir)
 	f, err = os.Create(configPath)
 	if err != nil {
-		return fmt.Errorf("error creating config file: %v", err)
+		return fmt.Errorf("error creating config file: %w", err)
 	}
 	f.Close()
 
+	// record whether file names that differ only in case are one file
+	ignoreCase, err := probeIgnoreCase(configPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, fmt.Appendf(nil, "ignorecase=%t", ignoreCase), 0644); err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+
 	// main branch ref file (empty initially)
-	mainRefPath := fmt.Sprintf(".%s/refs/heads/main", vcsName)
+	mainRefPath := fmt.Sprintf("%s/refs/heads/main", commonDir)
 	f, err = os.Create(mainRefPath)
 	if err != nil {
-		return fmt.Errorf("error creating main ref file: %v", err)
+		return fmt.Errorf("error creating main ref file: %w", err)
 	}
 	f.Close()
 
@@ -131,55 +147,185 @@ func createDirectoriesFiles() error {
 
 // checkVCSRepo checks if the current directory is a VCS repository.
 func checkVCSRepo() error {
-	_, err := os.Stat("." + vcsName)
+	_, err := os.Stat(gitDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return fmt.Errorf("error: not a %s repository", vcsName)
+			return fmt.Errorf("error: %w", ErrNotARepository)
 		}
-		return fmt.Errorf("error accessing %s repository: %v", vcsName, err)
+		return fmt.Errorf("error accessing %s repository: %w", vcsName, err)
 	}
 	return nil
 }
 
 // createObject creates a blob object from the given data and returns its hash.
 func createObject(data []byte) ([]byte, error) {
+	return writeObject("blob", data)
+}
+
+// createObjectFromFile stores the file at path as a blob without reading
+// it into memory and returns its hash.
+func createObjectFromFile(ctx context.Context, path string) ([]byte, error) {
+	f, err := os.Open(workTreePath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+
+	return writeObjectStream(ctx, "blob", info.Size(), f)
+}
+
+// hashFile returns the blob hash of the file at path without storing it or
+// reading it into memory.
+func hashFile(ctx context.Context, path string) ([]byte, error) {
+	f, err := os.Open(workTreePath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+
+	h := newObjectHasher(objectFormat())
+	fmt.Fprintf(h, "blob %d\x00", info.Size())
+	if _, err := io.Copy(h, canceledReader{ctx, f}); err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// writeObject stores content as an object of the given type and returns
+// its hash. Every object is written through writeObject or
+// writeObjectStream, which share writeObjectFile's storage format.
+func writeObject(objType string, content []byte) ([]byte, error) {
 	if err := checkVCSRepo(); err != nil {
 		return nil, err
 	}
 
-	// create blob header: "blob <size>\0"
-	header := fmt.Sprintf("blob %d\x00", len(data))
-	fullData := append([]byte(header), data...)
+	// create header: "<type> <size>\0"
+	header := fmt.Sprintf("%s %d\x00", objType, len(content))
+	fullData := append([]byte(header), content...)
 
-	// compute SHA-1 hash
-	hash := sha1.Sum(fullData)
+	hash := sumObject(fullData)
+	if err := writeObjectFile(hash, fullData); err != nil {
+		return nil, err
+	}
 
-	// create object directory and file
-	dirPath := fmt.Sprintf(".%s/objects/%x", vcsName, hash[:1])
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return nil, fmt.Errorf("error creating object directory: %v", err)
+	return hash, nil
+}
+
+// writeObjectStream stores size bytes read from r as an object of the
+// given type and returns its hash. The content is hashed and compressed
+// into a temporary file as it is read, so large files are never held in
+// memory; the file is moved into place once the hash is known.
+func writeObjectStream(ctx context.Context, objType string, size int64, r io.Reader) ([]byte, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
 	}
 
-	filePath := fmt.Sprintf("%s/%x", dirPath, hash[1:])
+	objectsDir := fmt.Sprintf("%s/objects", commonDir)
+	tmp, err := createTempFile(objectsDir, tempObjectPattern)
+	if err != nil {
+		return nil, fmt.Errorf("error creating object file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once the file has been moved into place
+	defer tmp.Close()
 
-	// compress and write
-	f, err := os.Create(filePath)
+	hasher := newObjectHasher(objectFormat())
+	zw, err := flate.NewWriter(tmp, flate.BestCompression)
 	if err != nil {
-		return nil, fmt.Errorf("error creating object file: %v", err)
+		return nil, fmt.Errorf("error creating object writer: %w", err)
 	}
-	defer f.Close()
+	w := io.MultiWriter(hasher, zw)
 
-	w, err := flate.NewWriter(f, flate.BestCompression)
+	fmt.Fprintf(w, "%s %d\x00", objType, size)
+	n, err := io.Copy(w, io.LimitReader(canceledReader{ctx, r}, size))
 	if err != nil {
-		return nil, fmt.Errorf("error creating flate writer: %v", err)
+		return nil, fmt.Errorf("error writing object data: %w", err)
+	}
+	if n != size {
+		return nil, fmt.Errorf("error writing object data: read %d of %d bytes", n, size)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error writing object data: %w", err)
 	}
-	defer w.Close()
 
-	if _, err := w.Write(fullData); err != nil {
-		return nil, fmt.Errorf("error writing object data: %v", err)
+	hash := hasher.Sum(nil)
+	objectPath := fmt.Sprintf("%s/%x/%x", objectsDir, hash[:1], hash[1:])
+	if _, err := os.Stat(objectPath); err == nil {
+		return hash, nil // already stored; the temporary file is dropped
+	}
+
+	// the sealed data binds the hash, which is only known now
+	if objectEncryptionEnabled() {
+		compressed, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading object data: %w", err)
+		}
+		sealed, err := sealObjectData(hash, compressed)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(tmp.Name(), sealed, 0644); err != nil {
+			return nil, fmt.Errorf("error writing object data: %w", err)
+		}
+	}
+
+	if err := installObjectFile(tmp, objectPath); err != nil {
+		return nil, err
 	}
 
-	return hash[:], nil
+	return hash, nil
+}
+
+// objectFormat returns the hash algorithm of the repository's objects,
+// either "sha1" (the default) or "sha256".
+func objectFormat() string {
+	format, err := getConfig("objectFormat")
+	if err != nil || format == "" {
+		return "sha1"
+	}
+
+	return format
+}
+
+// hashSize returns the length in bytes of the repository's object hashes.
+func hashSize() int {
+	if objectFormat() == "sha256" {
+		return sha256.Size
+	}
+
+	return sha1.Size
+}
+
+// sumObject hashes full object data (header included) with the
+// repository's hash algorithm.
+func sumObject(fullData []byte) []byte {
+	return sumObjectAs(objectFormat(), fullData)
+}
+
+// sumObjectAs hashes full object data with the given hash algorithm.
+func sumObjectAs(format string, fullData []byte) []byte {
+	h := newObjectHasher(format)
+	h.Write(fullData)
+	return h.Sum(nil)
+}
+
+// newObjectHasher returns a hash.Hash for the given hash algorithm.
+func newObjectHasher(format string) hash.Hash {
+	if format == "sha256" {
+		return sha256.New()
+	}
+
+	return sha1.New()
 }
 
 // hashObject hashes the given data and returns its hash without storing it.
@@ -188,18 +334,133 @@ func hashObject(data []byte) []byte {
 	header := fmt.Sprintf("blob %d\x00", len(data))
 	fullData := append([]byte(header), data...)
 
-	// compute SHA-1 hash
-	hash := sha1.Sum(fullData)
+	// compute object hash
+	return sumObject(fullData)
+}
 
-	return hash[:]
+// hashTypedObject hashes data as an object of the given type without storing it.
+func hashTypedObject(objType string, data []byte) []byte {
+	header := fmt.Sprintf("%s %d\x00", objType, len(data))
+	return sumObject(append([]byte(header), data...))
 }
 
-// writeTreeObject creates a tree object and returns its hash.
-func writeTreeObject(entries []treeEntry) ([]byte, error) {
-	if err := checkVCSRepo(); err != nil {
+// createTypedObject stores data as an object of the given type and returns
+// its hash. Tree and commit payloads are validated before being written.
+func createTypedObject(objType string, data []byte) ([]byte, error) {
+	header := fmt.Sprintf("%s %d\x00", objType, len(data))
+	if err := validateTypedObject(objType, append([]byte(header), data...)); err != nil {
 		return nil, err
 	}
 
+	return writeObject(objType, data)
+}
+
+// writeObjectFile compresses full object data (header included) into the
+// object store under the given hash. An object that is already stored is
+// left as it is.
+func writeObjectFile(hash, fullData []byte) error {
+	objectPath := fmt.Sprintf("%s/objects/%x/%x", commonDir, hash[:1], hash[1:])
+	if _, err := os.Stat(objectPath); err == nil {
+		return nil
+	}
+
+	tmp, err := createTempFile(fmt.Sprintf("%s/objects", commonDir), tempObjectPattern)
+	if err != nil {
+		return fmt.Errorf("error creating object file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once the file has been moved into place
+	defer tmp.Close()
+
+	w, err := newObjectWriter(tmp, hash)
+	if err != nil {
+		return fmt.Errorf("error creating object writer: %w", err)
+	}
+
+	if _, err := w.Write(fullData); err != nil {
+		return fmt.Errorf("error writing object data: %w", err)
+	}
+
+	// flush the compressor (and seal the data) before the file is moved
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing object data: %w", err)
+	}
+
+	return installObjectFile(tmp, objectPath)
+}
+
+// tempObjectPattern names the temporary files objects are written to
+// before they are moved into place. compact removes abandoned ones.
+const tempObjectPattern = "tmp-object-*"
+
+// installObjectFile closes tmp, a complete object file in the objects
+// directory, and renames it to objectPath, so a reader, or a crash, never
+// sees a partly written object. With fsyncObjectFiles set to true in the
+// repository config, the file is flushed to disk first, so the object also
+// survives a power failure right after the rename.
+func installObjectFile(tmp *os.File, objectPath string) error {
+	if value, err := getConfig("fsyncObjectFiles"); err == nil && value == "true" {
+		if err := tmp.Sync(); err != nil {
+			return fmt.Errorf("error writing object data: %w", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing object data: %w", err)
+	}
+
+	dirPath := filepath.Dir(objectPath)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return fmt.Errorf("error creating object directory: %w", err)
+	}
+	if err := adjustSharedPerm(dirPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return fmt.Errorf("error storing object: %w", err)
+	}
+
+	return adjustSharedPerm(objectPath)
+}
+
+// validateTypedObject checks that fullData parses as an object of objType.
+func validateTypedObject(objType string, fullData []byte) error {
+	kind, err := lookupObjectKind(objType)
+	if err != nil {
+		return err
+	}
+
+	obj, err := kind.parse(fullData)
+	if err == nil && kind.check != nil {
+		err = kind.check(obj)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s object: %w", objType, err)
+	}
+
+	return nil
+}
+
+// writeTreeObject creates a tree object and returns its hash.
+func writeTreeObject(entries []treeEntry) ([]byte, error) {
+	return writeObject("tree", encodeTreeContent(entries))
+}
+
+// hashTreeObject computes the hash of a tree object without storing it.
+func hashTreeObject(entries []treeEntry) ([]byte, error) {
+	return sumObject(encodeTreeObject(entries)), nil
+}
+
+// encodeTreeObject sorts the entries and returns the tree object data
+// including its header.
+func encodeTreeObject(entries []treeEntry) []byte {
+	content := encodeTreeContent(entries)
+	header := fmt.Sprintf("tree %d\x00", len(content))
+	return append([]byte(header), content...)
+}
+
+// encodeTreeContent sorts the entries and returns the tree object content
+// without its header.
+func encodeTreeContent(entries []treeEntry) []byte {
 	// sort entries by name
 	sort.Slice(entries, func(i, j int) bool {
 		return entries[i].name < entries[j].name
@@ -208,7 +469,7 @@ func writeTreeObject(entries []treeEntry) ([]byte, error) {
 	// build tree content in git's binary format
 	var buf bytes.Buffer
 	for _, entry := range entries {
-		// format: "<mode> <name>\0<20-byte hash>"
+		// format: "<mode> <name>\0<binary hash>"
 		buf.WriteString(entry.mode)
 		buf.WriteByte(' ')
 		buf.WriteString(entry.name)
@@ -216,70 +477,207 @@ func writeTreeObject(entries []treeEntry) ([]byte, error) {
 		buf.Write(entry.hash) // hash is already binary
 	}
 
-	// create tree header
-	content := buf.Bytes()
-	header := fmt.Sprintf("tree %d\x00", len(content))
-	fullData := append([]byte(header), content...)
+	return buf.Bytes()
+}
 
-	// compute hash
-	hash := sha1.Sum(fullData)
+// buildTreeObject builds a tree object from the index and returns its hash.
+func buildTreeObject(index map[string][]byte) ([]byte, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
 
-	// write to object store
-	dirPath := fmt.Sprintf(".%s/objects/%x", vcsName, hash[:1])
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return nil, fmt.Errorf("error creating object directory: %v", err)
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, err
 	}
 
-	filePath := fmt.Sprintf("%s/%x", dirPath, hash[1:])
+	return buildTreeRecursive(index, ".", gitlinks, nil, writeTreeObject)
+}
+
+// writeIndexTree builds the tree object for the on-disk index. Tree hashes
+// of unchanged directories are taken from the index's cache-tree extension,
+// and newly computed ones are stored back into it.
+func writeIndexTree(index map[string][]byte) ([]byte, error) {
+	return writeIndexSubtree(index, ".", nil)
+}
+
+// writeIndexSubtree is like writeIndexTree but only writes the tree for the
+// entries below the given directory ("." for the whole index). Given paths,
+// only the entries at or below one of them are included.
+func writeIndexSubtree(index map[string][]byte, prefix string, paths []string) ([]byte, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
 
-	f, err := os.Create(filePath)
+	gitlinks, err := gitlinkPaths(index)
 	if err != nil {
-		return nil, fmt.Errorf("error creating object file: %v", err)
+		return nil, err
 	}
-	defer f.Close()
 
-	w, err := flate.NewWriter(f, flate.BestCompression)
+	cache, err := readCacheTree()
 	if err != nil {
-		return nil, fmt.Errorf("error creating flate writer: %v", err)
+		return nil, err
 	}
-	defer w.Close()
 
-	if _, err := w.Write(fullData); err != nil {
-		return nil, fmt.Errorf("error writing tree data: %v", err)
+	limited, limitedCache, err := limitIndex(index, cache, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, subIndex, err := indexSubtree(limited, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	treeHash, err := buildTreeRecursive(subIndex, prefix, gitlinks, limitedCache, writeTreeObject)
+	if err != nil {
+		return nil, err
 	}
 
-	return hash[:], nil
+	// only trees of directories inside the paths match the full index
+	for dir, hash := range limitedCache {
+		if withinPaths(dir, paths) {
+			cache[dir] = hash
+		}
+	}
+
+	if err := writeIndexFile(index, cache); err != nil {
+		return nil, err
+	}
+
+	return treeHash, nil
 }
 
-// buildTreeObject builds a tree object from the index and returns its hash.
-func buildTreeObject(index map[string][]byte) ([]byte, error) {
+// hashIndexSubtree returns the tree hash writeIndexSubtree would produce,
+// without writing any objects or touching the index.
+func hashIndexSubtree(index map[string][]byte, prefix string, paths []string) ([]byte, error) {
 	if err := checkVCSRepo(); err != nil {
 		return nil, err
 	}
 
-	return buildTreeRecursive(index, "")
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := readCacheTree()
+	if err != nil {
+		return nil, err
+	}
+
+	limited, limitedCache, err := limitIndex(index, cache, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, subIndex, err := indexSubtree(limited, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildTreeRecursive(subIndex, prefix, gitlinks, limitedCache, hashTreeObject)
+}
+
+// limitIndex returns the entries of index at or below one of paths, and the
+// cache-tree entries that still hold for them: those of directories at or
+// below one of paths, which keep all their entries. Without paths, index
+// and cache are returned as they are.
+func limitIndex(index, cache map[string][]byte, paths []string) (map[string][]byte, map[string][]byte, error) {
+	if len(paths) == 0 {
+		return index, cache, nil
+	}
+
+	limited := make(map[string][]byte)
+	for path, hash := range index {
+		if withinPaths(path, paths) {
+			limited[path] = hash
+		}
+	}
+	if len(limited) == 0 {
+		return nil, nil, fmt.Errorf("no index entries under %s", strings.Join(paths, ", "))
+	}
+
+	return limited, limitCacheTree(cache, paths), nil
 }
 
-// buildTreeRecursive recursively builds tree objects for the given prefix.
-func buildTreeRecursive(index map[string][]byte, prefix string) ([]byte, error) {
+// limitCacheTree returns the cache-tree entries of directories at or below
+// one of paths.
+func limitCacheTree(cache map[string][]byte, paths []string) map[string][]byte {
+	limited := make(map[string][]byte)
+	for dir, hash := range cache {
+		if withinPaths(dir, paths) {
+			limited[dir] = hash
+		}
+	}
+
+	return limited
+}
+
+// indexSubtree normalizes prefix and returns the index entries below it,
+// with paths relative to prefix ("." selects the whole index).
+func indexSubtree(index map[string][]byte, prefix string) (string, map[string][]byte, error) {
+	prefix = strings.Trim(filepath.ToSlash(filepath.Clean(prefix)), "/")
+	if prefix == "" {
+		prefix = "."
+	}
+
+	if prefix == "." {
+		return prefix, index, nil
+	}
+
+	subIndex := make(map[string][]byte)
+	for path, hash := range index {
+		if relPath, ok := strings.CutPrefix(path, prefix+"/"); ok {
+			subIndex[relPath] = hash
+		}
+	}
+
+	if len(subIndex) == 0 {
+		return "", nil, fmt.Errorf("no index entries under %s", prefix)
+	}
+
+	return prefix, subIndex, nil
+}
+
+// treeWriteFunc is a function type for turning tree entries into a tree hash.
+type treeWriteFunc func([]treeEntry) ([]byte, error)
+
+// buildTreeRecursive recursively builds tree objects for the given directory.
+// Index paths are relative to dir; gitlinks holds the full paths of
+// submodules, which are recorded as commit entries. If cache is non-nil, it maps directory
+// paths to known tree hashes and is updated with every tree written.
+func buildTreeRecursive(index map[string][]byte, dir string, gitlinks map[string]bool, cache map[string][]byte, writeTree treeWriteFunc) ([]byte, error) {
+	if hash, ok := cache[dir]; ok && objectExists(hash) {
+		return hash, nil
+	}
+
 	var entries []treeEntry
 	subdirs := make(map[string]map[string][]byte)
 
 	for path, hash := range index {
-		// check if this path belongs under current prefix
-		var relativePath string
-		if prefix == "" {
-			relativePath = path
-		} else if strings.HasPrefix(path, prefix+"/") {
-			relativePath = strings.TrimPrefix(path, prefix+"/")
-		} else {
+		if name, ok := strings.CutSuffix(path, "/"); ok && !strings.Contains(name, "/") {
+			// direct child - a sparse directory entry, already a tree
+			entries = append(entries, treeEntry{
+				mode:    fmt.Sprintf("%06o", entryTypeTree),
+				objType: "tree",
+				hash:    hash,
+				name:    name,
+			})
 			continue
 		}
 
 		// split into first component and rest
-		parts := strings.SplitN(relativePath, "/", 2)
+		parts := strings.SplitN(path, "/", 2)
 
-		if len(parts) == 1 {
+		if len(parts) == 1 && gitlinks[joinTreePath(dir, parts[0])] {
+			// direct child - a submodule pinned at a commit
+			entries = append(entries, treeEntry{
+				mode:    fmt.Sprintf("%06o", entryTypeGitlink),
+				objType: "commit",
+				hash:    hash,
+				name:    parts[0],
+			})
+		} else if len(parts) == 1 {
 			// direct child - it's a blob
 			entries = append(entries, treeEntry{
 				mode:    fmt.Sprintf("%06o", entryTypeBlob),
@@ -299,7 +697,9 @@ func buildTreeRecursive(index map[string][]byte, prefix string) ([]byte, error)
 
 	// recursively build subdirectories
 	for subdir, subIndex := range subdirs {
-		subTreeHash, err := buildTreeRecursive(subIndex, "")
+		subdirPath := joinTreePath(dir, subdir)
+
+		subTreeHash, err := buildTreeRecursive(subIndex, subdirPath, gitlinks, cache, writeTree)
 		if err != nil {
 			return nil, err
 		}
@@ -312,7 +712,75 @@ func buildTreeRecursive(index map[string][]byte, prefix string) ([]byte, error)
 		})
 	}
 
-	return writeTreeObject(entries)
+	hash, err := writeTree(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		cache[dir] = hash
+	}
+
+	return hash, nil
+}
+
+// joinTreePath returns the path of name inside dir ("." for the root).
+func joinTreePath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+
+	return dir + "/" + name
+}
+
+// objectExists reports whether an object with the given hash is stored.
+func objectExists(hash []byte) bool {
+	if len(hash) == 0 {
+		return false
+	}
+
+	_, err := os.Stat(fmt.Sprintf("%s/objects/%x/%x", commonDir, hash[:1], hash[1:]))
+	return err == nil
+}
+
+// listTreeEntries returns the entries of the given tree. If recursive is true,
+// nested trees are flattened and only blobs and submodule commits are
+// returned, named by full path.
+func listTreeEntries(treeHash []byte, prefix string, recursive bool) ([]treeEntry, error) {
+	obj, err := catFile(treeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, ok := obj.(treeObject)
+	if !ok {
+		return nil, fmt.Errorf("object %x is not a tree", treeHash)
+	}
+
+	var entries []treeEntry
+	for _, entry := range tree.entries {
+		if recursive {
+			// names become paths that may be written to the working tree
+			if err := checkPathName(entry.name); err != nil {
+				return nil, fmt.Errorf("tree %x: %w", treeHash, err)
+			}
+		}
+		entry.name = prefix + entry.name
+
+		if recursive && entry.objType == "tree" {
+			subEntries, err := listTreeEntries(entry.hash, entry.name+"/", true)
+			if err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, subEntries...)
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
 }
 
 // writeCommitObject creates a commit object and returns its hash.
@@ -321,6 +789,17 @@ func writeCommitObject(treeHash []byte, parentHashes [][]byte, message string) (
 		return nil, err
 	}
 
+	author, committer, err := commitIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	return writeCommitObjectAs(treeHash, parentHashes, author, committer, message)
+}
+
+// writeCommitObjectAs creates a commit object with the given identities,
+// for commits recreated from elsewhere, and returns its hash.
+func writeCommitObjectAs(treeHash []byte, parentHashes [][]byte, author, committer, message string) ([]byte, error) {
 	// build commit content
 	var buf bytes.Buffer
 
@@ -330,108 +809,95 @@ func writeCommitObject(treeHash []byte, parentHashes [][]byte, message string) (
 		buf.WriteString(fmt.Sprintf("parent %x\n", parentHash))
 	}
 
-	// replace with actual author/committer info (use same for both here)
-	user, err := getConfig("email")
-	if err != nil {
-		return nil, err
-	}
-
-	author := fmt.Sprintf("Author <%s>", user)
-	committer := fmt.Sprintf("Committer <%s>", user)
-
 	buf.WriteString(fmt.Sprintf("author %s\n", author))
 	buf.WriteString(fmt.Sprintf("committer %s\n", committer))
 	buf.WriteString("\n")
 	buf.WriteString(message)
 	buf.WriteString("\n")
 
-	content := buf.Bytes()
-
-	// create commit header
-	header := fmt.Sprintf("commit %d\x00", len(content))
-	fullData := append([]byte(header), content...)
-
-	// compute hash
-	hash := sha1.Sum(fullData)
+	return writeObject("commit", buf.Bytes())
+}
 
-	// write to object store
-	dirPath := fmt.Sprintf(".%s/objects/%x", vcsName, hash[:1])
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return nil, fmt.Errorf("error creating object directory: %v", err)
+// commitIdentity returns the author and committer recorded in new commits.
+func commitIdentity() (string, string, error) {
+	// replace with actual author/committer info (use same for both here)
+	user, err := getConfig("email")
+	if err != nil {
+		return "", "", err
 	}
 
-	filePath := fmt.Sprintf("%s/%x", dirPath, hash[1:])
+	author := fmt.Sprintf("Author <%s>", user)
+	committer := fmt.Sprintf("Committer <%s>", user)
 
-	f, err := os.Create(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error creating object file: %v", err)
-	}
-	defer f.Close()
+	return author, committer, nil
+}
 
-	w, err := flate.NewWriter(f, flate.BestCompression)
+// catFile reads and parses an object file by its hash.
+func catFile(fileHash []byte) (object, error) {
+	data, objType, _, err := readRawObject(fileHash)
 	if err != nil {
-		return nil, fmt.Errorf("error creating flate writer: %v", err)
-	}
-	defer w.Close()
-
-	if _, err := w.Write(fullData); err != nil {
-		return nil, fmt.Errorf("error writing commit data: %v", err)
+		return nil, err
 	}
 
-	return hash[:], nil
+	return parseObject(fileHash, objType, data)
 }
 
-// catFile reads and parses an object file by its hash.
-func catFile(fileHash []byte) (object, error) {
+// readRawObject reads and decompresses an object file by its hash and
+// returns the full data along with the type and size from its header.
+func readRawObject(fileHash []byte) ([]byte, string, int, error) {
 	if err := checkVCSRepo(); err != nil {
-		return nil, err
+		return nil, "", 0, err
 	}
 
 	// convert binary hash to hex string for file path
 	hashStr := fmt.Sprintf("%x", fileHash)
+	if len(hashStr) < 3 {
+		return nil, "", 0, fmt.Errorf("error invalid object hash: %s", hashStr)
+	}
 
 	// build file path
-	filePath := fmt.Sprintf(".%s/objects/%s/%s", vcsName, hashStr[:2], hashStr[2:])
+	filePath := fmt.Sprintf("%s/objects/%s/%s", commonDir, hashStr[:2], hashStr[2:])
 
-	f, err := os.Open(filePath)
+	stored, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", 0, fmt.Errorf("error opening object file: %w: %s", ErrObjectNotFound, hashStr)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error opening object file: %v", err)
+		return nil, "", 0, fmt.Errorf("error opening object file: %w", err)
+	}
+
+	// decrypt, if needed, and decompress
+	compressed, err := openObjectData(fileHash, stored)
+	if err != nil {
+		return nil, "", 0, err
 	}
-	defer f.Close()
 
-	// decompress
-	r := flate.NewReader(f)
+	r := flate.NewReader(bytes.NewReader(compressed))
 	defer r.Close()
 
 	data, err := io.ReadAll(r)
 	if err != nil {
-		return nil, fmt.Errorf("error reading object file: %v", err)
+		return nil, "", 0, fmt.Errorf("error reading object file: %w", err)
 	}
 
 	// parse header to determine type
 	nullIndex := bytes.IndexByte(data, 0)
 	if nullIndex == -1 {
-		return nil, fmt.Errorf("error invalid object: missing header terminator")
+		return nil, "", 0, fmt.Errorf("error invalid object: missing header terminator")
 	}
 
 	header := string(data[:nullIndex])
 	parts := strings.SplitN(header, " ", 2)
 	if len(parts) != 2 {
-		return nil, fmt.Errorf("error invalid object header")
+		return nil, "", 0, fmt.Errorf("error invalid object header")
 	}
 
-	objType := parts[0]
-
-	switch objType {
-	case "blob":
-		return parseBlobObject(data)
-	case "tree":
-		return parseTreeObject(data)
-	case "commit":
-		return parseCommitObject(data)
-	default:
-		return nil, fmt.Errorf("error unknown object type: %s", objType)
+	size, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("error invalid object size: %w", err)
 	}
+
+	return data, parts[0], size, nil
 }
 
 // parseBlobObject parses a blob object and returns its content.
@@ -466,7 +932,7 @@ func parseTreeObject(data []byte) (treeObject, error) {
 		modeString := string(data[i : i+spaceIndex])
 		mode, err := strconv.ParseInt(modeString, 8, 0)
 		if err != nil {
-			return treeObject{}, fmt.Errorf("error parsing mode in tree object: %v", err)
+			return treeObject{}, fmt.Errorf("error parsing mode in tree object: %w", err)
 		}
 		i = spaceIndex + i + 1
 
@@ -478,12 +944,13 @@ func parseTreeObject(data []byte) (treeObject, error) {
 		name := string(data[i : i+nullIndex])
 		i = i + nullIndex + 1
 
-		// extract the 20-byte hash
-		if i+20 > len(data) {
+		// extract the binary hash
+		size := hashSize()
+		if i+size > len(data) {
 			return treeObject{}, fmt.Errorf("error invalid tree object: incomplete hash")
 		}
-		hash := data[i : i+20]
-		i += 20
+		hash := data[i : i+size]
+		i += size
 
 		// determine the type based on mode
 		var objectType string
@@ -492,6 +959,8 @@ func parseTreeObject(data []byte) (treeObject, error) {
 			objectType = "blob"
 		case entryTypeTree:
 			objectType = "tree"
+		case entryTypeGitlink:
+			objectType = "commit"
 		default:
 			return treeObject{}, fmt.Errorf("error unknown entry type in tree object: %o", mode)
 		}
@@ -500,7 +969,7 @@ func parseTreeObject(data []byte) (treeObject, error) {
 		entry := treeEntry{
 			mode:    fmt.Sprintf("%06o", mode),
 			objType: objectType,
-			hash:    hash, // store as binary (already 20 bytes)
+			hash:    hash, // store as binary
 			name:    name,
 		}
 		obj.entries = append(obj.entries, entry)
@@ -526,7 +995,7 @@ func parseCommitObject(data []byte) (commitObject, error) {
 			treeHex := strings.TrimPrefix(line, "tree ")
 			treeHash, err := hex.DecodeString(treeHex)
 			if err != nil {
-				return commitObject{}, fmt.Errorf("error decoding tree hash in commit object: %v", err)
+				return commitObject{}, fmt.Errorf("error decoding tree hash in commit object: %w", err)
 			}
 			object.hash = treeHash
 			continue
@@ -536,7 +1005,7 @@ func parseCommitObject(data []byte) (commitObject, error) {
 			parentHex := strings.TrimPrefix(line, "parent ")
 			parentHash, err := hex.DecodeString(parentHex)
 			if err != nil {
-				return commitObject{}, fmt.Errorf("error decoding parent hash in commit object: %v", err)
+				return commitObject{}, fmt.Errorf("error decoding parent hash in commit object: %w", err)
 			}
 			object.parents = append(object.parents, parentHash)
 			continue
@@ -562,8 +1031,19 @@ func parseCommitObject(data []byte) (commitObject, error) {
 	return object, nil
 }
 
-// printCommitHistory prints the commit history starting from the given commit hash.
-func printCommitHistory(commitHash []byte) error {
+// printCommitHistory prints the commit history starting from the given
+// commit hash, with the note attached to each commit.
+func printCommitHistory(ctx context.Context, commitHash []byte) error {
+	notes, _, err := readNotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	return printCommitLog(commitHash, notes)
+}
+
+// printCommitLog prints a commit and, recursively, its first parents.
+func printCommitLog(commitHash []byte, notes map[string][]byte) error {
 	if len(commitHash) == 0 {
 		return nil // base case: no more commits
 	}
@@ -571,7 +1051,7 @@ func printCommitHistory(commitHash []byte) error {
 	// read the commit object (commitHash is already binary)
 	obj, err := catFile(commitHash)
 	if err != nil {
-		return fmt.Errorf("error reading commit object %x: %v", commitHash, err)
+		return fmt.Errorf("error reading commit object %x: %w", commitHash, err)
 	}
 
 	commitObj, ok := obj.(commitObject)
@@ -580,67 +1060,140 @@ func printCommitHistory(commitHash []byte) error {
 	}
 
 	// print commit details
-	fmt.Printf("commit %x\n", commitHash)
-	fmt.Printf("Author: %s\n", commitObj.author)
-	fmt.Printf("Committer: %s\n\n", commitObj.committer)
-	fmt.Printf("    %s\n\n", commitObj.message)
+	printCommitHeader(commitHash, commitObj)
+
+	note, err := readNote(notes, commitHash)
+	if err != nil {
+		return err
+	}
+	if note != nil {
+		printNote(note)
+	}
 
 	// recursive call to print parent commit
 	if len(commitObj.parents) == 0 {
 		return nil
 	}
 
-	return printCommitHistory(commitObj.parents[0])
+	return printCommitLog(commitObj.parents[0], notes)
+}
+
+// printCommitHeader prints the hash, author, committer, and message of a commit.
+func printCommitHeader(commitHash []byte, commitObj commitObject) {
+	fmt.Println(commitHashStyle.Sprintf("commit %s", abbrevHash(commitHash)))
+	fmt.Printf("Author: %s\n", commitObj.author)
+	fmt.Printf("Committer: %s\n\n", commitObj.committer)
+	fmt.Printf("    %s\n\n", commitObj.message)
+}
+
+// errConfigKeyNotFound is matched by the error for a key the config file
+// does not set, as opposed to a config file that cannot be read.
+var errConfigKeyNotFound = errors.New("not found in config")
+
+// configKeyError is returned for a key the config file does not set.
+type configKeyError struct {
+	key string
 }
 
+func (e *configKeyError) Error() string { return fmt.Sprintf("key %s not found in config", e.key) }
+
+// Is makes a configKeyError match errConfigKeyNotFound.
+func (e *configKeyError) Is(target error) bool { return target == errConfigKeyNotFound }
+
 // getConfig retrieves the value for the given key from the config file.
 func getConfig(key string) (string, error) {
 	if err := checkVCSRepo(); err != nil {
 		return "", err
 	}
 
-	configPath := fmt.Sprintf(".%s/config", vcsName)
+	return readConfigValue(fmt.Sprintf("%s/config", commonDir), key)
+}
+
+// updateConfig updates the config file with the new key-value pair.
+func updateConfig(key, value string) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	return writeConfigValue(fmt.Sprintf("%s/config", commonDir), key, value)
+}
+
+// globalConfigPath returns the path of the user-level config file.
+func globalConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating home directory: %w", err)
+	}
+
+	return filepath.Join(home, "."+vcsName+"config"), nil
+}
+
+// getGlobalConfig retrieves the value for the given key from the global config file.
+func getGlobalConfig(key string) (string, error) {
+	configPath, err := globalConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return readConfigValue(configPath, key)
+}
+
+// updateGlobalConfig updates the global config file with the new key-value pair.
+func updateGlobalConfig(key, value string) error {
+	configPath, err := globalConfigPath()
+	if err != nil {
+		return err
+	}
+
+	// the global config file is created lazily on first write
+	if _, err := os.Stat(configPath); errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(configPath, nil, 0644); err != nil {
+			return fmt.Errorf("error creating config file: %w", err)
+		}
+	}
+
+	return writeConfigValue(configPath, key, value)
+}
+
+// readConfigValue retrieves the value for the given key from the config file at configPath.
+func readConfigValue(configPath, key string) (string, error) {
 	content, err := os.ReadFile(configPath)
 	if err != nil {
-		return "", fmt.Errorf("error reading config file: %v", err)
+		return "", fmt.Errorf("error reading config file: %w", err)
 	}
 
+	// the key ends at the first "=", so values may contain one
 	lines := strings.Split(string(content), "\n")
 	for _, line := range lines {
-		parts := strings.Split(line, "=")
-		if len(parts) != 2 {
+		lineKey, value, ok := strings.Cut(line, "=")
+		if !ok {
 			continue
 		}
 
-		if strings.TrimSpace(parts[0]) == key {
-			return strings.TrimSpace(parts[1]), nil
+		if strings.TrimSpace(lineKey) == key {
+			return strings.TrimSpace(value), nil
 		}
 	}
 
-	return "", fmt.Errorf("key %s not found in config", key)
+	return "", &configKeyError{key: key}
 }
 
-// updateConfig updates the config file with the new key-value pair.
-func updateConfig(key, value string) error {
-	if err := checkVCSRepo(); err != nil {
-		return err
-	}
-
-	configPath := fmt.Sprintf(".%s/config", vcsName)
+// writeConfigValue updates the config file at configPath with the new key-value pair.
+func writeConfigValue(configPath, key, value string) error {
 	content, err := os.ReadFile(configPath)
 	if err != nil {
-		return fmt.Errorf("error reading config file: %v", err)
+		return fmt.Errorf("error reading config file: %w", err)
 	}
 
 	lines := strings.Split(string(content), "\n")
 	updated := false
 	for i, line := range lines {
-		parts := strings.Split(line, "=")
-		if len(parts) != 2 {
+		lineKey, _, ok := strings.Cut(line, "=")
+		if !ok {
 			continue
 		}
 
-		if strings.TrimSpace(parts[0]) == key {
+		if strings.TrimSpace(lineKey) == key {
 			lines[i] = fmt.Sprintf("%s=%s", key, value)
 			updated = true
 			break
@@ -654,7 +1207,7 @@ func updateConfig(key, value string) error {
 	newContent := strings.Join(lines, "\n")
 	err = os.WriteFile(configPath, []byte(newContent), 0644)
 	if err != nil {
-		return fmt.Errorf("error writing config file: %v", err)
+		return fmt.Errorf("error writing config file: %w", err)
 	}
 
 	return nil
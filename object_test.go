@@ -1,10 +1,12 @@
-package main
+package mygit
 
 import (
+	"bytes"
 	"compress/flate"
 	"crypto/sha1"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -84,6 +86,38 @@ func TestCreateObject(t *testing.T) {
 	assert.Equal(t, expectedFileContent, buf[:len(expectedFileContent)], "File contents do not match expected object data")
 }
 
+func TestWriteObjectStream(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	content := bytes.Repeat([]byte("streamed content\n"), 10000)
+
+	// streaming and in-memory writes store the same object
+	streamed, err := writeObjectStream(t.Context(), "blob", int64(len(content)), bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, hashObject(content), streamed)
+
+	stored, err := createObject(content)
+	assert.NoError(t, err)
+	assert.Equal(t, streamed, stored)
+
+	fullData, objType, size, err := readRawObject(streamed)
+	assert.NoError(t, err)
+	assert.Equal(t, "blob", objType)
+	assert.Equal(t, len(content), size)
+	assert.True(t, bytes.HasSuffix(fullData, content))
+
+	// a short reader is an error and leaves no temporary file behind
+	_, err = writeObjectStream(t.Context(), "blob", int64(len(content))+1, bytes.NewReader(content))
+	assert.Error(t, err)
+
+	matches, err := filepath.Glob(fmt.Sprintf(".%s/objects/tmp-object-*", vcsName))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
 func TestBuildTreeObject(t *testing.T) {
 	if err := createDirectoriesFiles(); err != nil {
 		t.Fatalf("Failed to create directories: %v", err)
@@ -271,3 +305,106 @@ func TestCatFile(t *testing.T) {
 	assert.Equal(t, hash3, catfile3Entry.hash, "catfile3.txt hash mismatch")
 	assert.Equal(t, fmt.Sprintf("%06o", entryTypeBlob), catfile3Entry.mode, "catfile3.txt mode mismatch")
 }
+
+func TestListTreeEntries(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	dummyHash := []byte("1234567890abcdef1234")
+	index := map[string][]byte{
+		"file1.txt":         dummyHash,
+		"dir/file2.txt":     dummyHash,
+		"dir/sub/file3.txt": dummyHash,
+	}
+
+	rootHash, err := buildTreeObject(index)
+	if err != nil {
+		t.Fatalf("error building tree object: %v", err)
+	}
+
+	entries, err := listTreeEntries(rootHash, "", false)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2, "non-recursive listing should show top-level entries only")
+
+	entries, err = listTreeEntries(rootHash, "", true)
+	assert.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		assert.Equal(t, "blob", entry.objType, "recursive listing should only contain blobs")
+		names = append(names, entry.name)
+	}
+	assert.Equal(t, []string{"dir/file2.txt", "dir/sub/file3.txt", "file1.txt"}, names)
+}
+
+func TestReadRawObject(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	sampleData := []byte("raw object data")
+	hash, err := createObject(sampleData)
+	if err != nil {
+		t.Fatalf("error creating object: %v", err)
+	}
+
+	_, objType, size, err := readRawObject(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, "blob", objType)
+	assert.Equal(t, len(sampleData), size)
+
+	treeHash, err := buildTreeObject(map[string][]byte{"file.txt": hash})
+	if err != nil {
+		t.Fatalf("error building tree object: %v", err)
+	}
+
+	_, objType, _, err = readRawObject(treeHash)
+	assert.NoError(t, err)
+	assert.Equal(t, "tree", objType)
+}
+
+func TestHashIndexSubtree(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	dummyHash := []byte("1234567890abcdef1234")
+	index := map[string][]byte{
+		"file1.txt":     dummyHash,
+		"dir/file2.txt": dummyHash,
+	}
+	if err := writeIndex(t.Context(), index); err != nil {
+		t.Fatalf("error writing index: %v", err)
+	}
+
+	indexBefore, err := os.ReadFile(fmt.Sprintf(".%s/index", vcsName))
+	assert.NoError(t, err)
+
+	rootHash, err := hashIndexSubtree(index, ".", nil)
+	assert.NoError(t, err)
+	dirHash, err := hashIndexSubtree(index, "dir", nil)
+	assert.NoError(t, err)
+
+	// nothing is written: no objects, no cache-tree update
+	assert.False(t, objectExists(rootHash))
+	assert.False(t, objectExists(dirHash))
+	indexAfter, err := os.ReadFile(fmt.Sprintf(".%s/index", vcsName))
+	assert.NoError(t, err)
+	assert.Equal(t, indexBefore, indexAfter)
+
+	// and the ids match what write-tree would produce
+	writtenDirHash, err := writeIndexSubtree(index, "dir", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, writtenDirHash, dirHash)
+
+	writtenRootHash, err := writeIndexTree(index)
+	assert.NoError(t, err)
+	assert.Equal(t, writtenRootHash, rootHash)
+
+	_, err = hashIndexSubtree(index, "missing", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package mygit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// objectKind is how one type of object is parsed and checked. A new kind
+// of object is added by registering it; catFile, hash-object, WriteObject,
+// and fsck all look types up here.
+type objectKind struct {
+	// parse decodes full object data, header included.
+	parse func(data []byte) (object, error)
+	// check, if set, rejects an object that parses but is incomplete or
+	// unsafe. It runs before an object is written and in fsck, not on
+	// every read.
+	check func(obj object) error
+}
+
+// objectKinds holds the registered kinds by type name.
+var objectKinds = make(map[string]objectKind)
+
+// registerObjectKind adds a kind of object under its type name.
+func registerObjectKind(name string, kind objectKind) {
+	if _, ok := objectKinds[name]; ok {
+		panic("object type registered twice: " + name)
+	}
+	objectKinds[name] = kind
+}
+
+func init() {
+	registerObjectKind("blob", objectKind{
+		parse: func(data []byte) (object, error) { return parseBlobObject(data) },
+	})
+	registerObjectKind("tree", objectKind{
+		parse: func(data []byte) (object, error) { return parseTreeObject(data) },
+		check: func(obj object) error {
+			for _, entry := range obj.(treeObject).entries {
+				if err := checkPathName(entry.name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	registerObjectKind("commit", objectKind{
+		parse: func(data []byte) (object, error) { return parseCommitObject(data) },
+		check: func(obj object) error {
+			if obj.(commitObject).hash == nil {
+				return fmt.Errorf("missing tree line")
+			}
+			return nil
+		},
+	})
+}
+
+// lookupObjectKind returns the kind registered for objType, or an
+// *UnknownObjectTypeError.
+func lookupObjectKind(objType string) (objectKind, error) {
+	kind, ok := objectKinds[objType]
+	if !ok {
+		return objectKind{}, &UnknownObjectTypeError{Type: objType}
+	}
+
+	return kind, nil
+}
+
+// objectTypeNames lists the registered type names for messages, as in
+// "blob, commit, or tree".
+func objectTypeNames() string {
+	names := make([]string, 0, len(objectKinds))
+	for name := range objectKinds {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+}
+
+// parseObject parses full object data (header included) of type objType.
+// An unregistered type is reported as an *UnknownObjectTypeError naming
+// hash, so callers can tell it apart from a corrupt object.
+func parseObject(hash []byte, objType string, data []byte) (object, error) {
+	kind, err := lookupObjectKind(objType)
+	if err != nil {
+		return nil, &UnknownObjectTypeError{Type: objType, Hash: fmt.Sprintf("%x", hash)}
+	}
+
+	return kind.parse(data)
+}
@@ -0,0 +1,277 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const packedRefsHeader = "# pack-refs"
+
+// packedRefsPath returns the path of the packed refs file.
+func packedRefsPath() string {
+	return fmt.Sprintf("%s/packed-refs", commonDir)
+}
+
+// readPackedRefs returns every ref stored in the packed refs file, keyed by
+// ref path. A missing file yields an empty map.
+func readPackedRefs() (map[string][]byte, error) {
+	refs := make(map[string][]byte)
+
+	content, err := os.ReadFile(packedRefsPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return refs, nil
+		}
+		return nil, fmt.Errorf("error reading packed-refs: %w", err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hexHash, refPath, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed packed-refs line: %q", line)
+		}
+
+		hash, err := hex.DecodeString(hexHash)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding packed ref %s: %w", refPath, err)
+		}
+
+		refs[refPath] = hash
+	}
+
+	return refs, nil
+}
+
+// writePackedRefs replaces the packed refs file with the given refs.
+// The file is removed when there are no refs left.
+func writePackedRefs(refs map[string][]byte) error {
+	if len(refs) == 0 {
+		if err := os.Remove(packedRefsPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error removing packed-refs: %w", err)
+		}
+		return nil
+	}
+
+	refPaths := make([]string, 0, len(refs))
+	for refPath := range refs {
+		refPaths = append(refPaths, refPath)
+	}
+	slices.Sort(refPaths)
+
+	var sb strings.Builder
+	sb.WriteString(packedRefsHeader + "\n")
+	for _, refPath := range refPaths {
+		sb.WriteString(fmt.Sprintf("%x %s\n", refs[refPath], refPath))
+	}
+
+	lock, err := acquireLockFile(packedRefsPath())
+	if err != nil {
+		return fmt.Errorf("error writing packed-refs: %w", err)
+	}
+	defer lock.release()
+
+	if _, err := lock.file.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("error writing packed-refs: %w", err)
+	}
+
+	if err := lock.commit(); err != nil {
+		return fmt.Errorf("error writing packed-refs: %w", err)
+	}
+
+	return nil
+}
+
+// refExists reports whether the ref exists as a loose file or in packed-refs.
+func refExists(refPath string) (bool, error) {
+	if _, err := os.Stat(refFilePath(refPath)); err == nil {
+		return true, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("error checking ref %s: %w", refPath, err)
+	}
+
+	packed, err := readPackedRefs()
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := packed[refPath]
+	return ok, nil
+}
+
+// listRefNames returns the sorted names of all refs under dir, combining
+// loose and packed refs. Refs in nested namespaces, such as
+// refs/heads/feature/x, are named by their path below dir.
+func listRefNames(ctx context.Context, dir string) ([]string, error) {
+	names := make(map[string]struct{})
+
+	root := fmt.Sprintf("%s/%s", commonDir, dir)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isLockFileName(d.Name()) {
+			return nil
+		}
+
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		names[filepath.ToSlash(name)] = struct{}{}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+
+	packed, err := readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	for refPath := range packed {
+		if name, ok := strings.CutPrefix(refPath, dir+"/"); ok {
+			names[name] = struct{}{}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	slices.Sort(sorted)
+
+	return sorted, nil
+}
+
+// deleteRef removes a ref, whether it is stored loose, packed, or both.
+func deleteRef(refPath string) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	exists, err := refExists(refPath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("ref %s does not exist", refPath)
+	}
+
+	// hold the ref lock so a concurrent update cannot recreate it halfway
+	fullRefPath := fmt.Sprintf("%s/%s", commonDir, refPath)
+	lock, err := acquireLockFile(fullRefPath)
+	if err != nil {
+		return fmt.Errorf("error deleting ref %s: %w", refPath, err)
+	}
+	defer lock.release()
+
+	// drop the packed entry first so the ref cannot reappear from packed-refs
+	packed, err := readPackedRefs()
+	if err != nil {
+		return err
+	}
+	if _, ok := packed[refPath]; ok {
+		delete(packed, refPath)
+		if err := writePackedRefs(packed); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(fullRefPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing ref file %s: %w", refPath, err)
+	}
+
+	return nil
+}
+
+// packRefs moves every loose branch and tag ref, including those in
+// namespaces such as refs/heads/feature/x, into packed-refs and returns the
+// number of refs packed. Branches without commits stay loose.
+// It stops between refs once ctx is done.
+func packRefs(ctx context.Context) (int, error) {
+	if err := checkVCSRepo(); err != nil {
+		return 0, err
+	}
+
+	packed, err := readPackedRefs()
+	if err != nil {
+		return 0, err
+	}
+
+	var loose []string
+	for _, dir := range []string{"refs/heads", "refs/tags"} {
+		err := filepath.WalkDir(fmt.Sprintf("%s/%s", commonDir, dir), func(path string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || isLockFileName(d.Name()) {
+				return nil
+			}
+
+			name, err := filepath.Rel(commonDir, path)
+			if err != nil {
+				return err
+			}
+			refPath := filepath.ToSlash(name)
+			hash, err := getRef(refPath)
+			if err != nil {
+				return err
+			}
+			if hash == nil {
+				return nil // branch without commits
+			}
+
+			packed[refPath] = hash
+			loose = append(loose, refPath)
+			return nil
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading %s: %w", dir, err)
+		}
+	}
+
+	if len(loose) == 0 {
+		return 0, nil
+	}
+
+	if err := writePackedRefs(packed); err != nil {
+		return 0, err
+	}
+
+	// loose files are only removed once their values are safely packed
+	for _, refPath := range loose {
+		if err := os.Remove(fmt.Sprintf("%s/%s", commonDir, refPath)); err != nil {
+			return 0, fmt.Errorf("error removing ref file %s: %w", refPath, err)
+		}
+	}
+
+	return len(loose), nil
+}
+
+// isLockFileName reports whether a file name is a <ref>.lock file held
+// by an in-progress update.
+func isLockFileName(name string) bool {
+	return strings.HasSuffix(name, ".lock")
+}
@@ -0,0 +1,70 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackRefs(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	hashA := hashObject([]byte("a"))
+	hashB := hashObject([]byte("b"))
+
+	assert.NoError(t, updateRef("refs/heads/feature", hashA))
+	assert.NoError(t, updateRef("refs/heads/synth/01", hashA))
+	assert.NoError(t, os.MkdirAll(fmt.Sprintf(".%s/refs/tags", vcsName), 0755))
+	assert.NoError(t, updateRef("refs/tags/v1", hashB))
+	assert.NoError(t, os.WriteFile(fmt.Sprintf(".%s/refs/heads/synth/02.lock", vcsName), nil, 0644))
+
+	count, err := packRefs(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count) // main has no commits and stays loose
+
+	for _, refPath := range []string{"refs/heads/feature", "refs/heads/synth/01"} {
+		_, err = os.Stat(fmt.Sprintf(".%s/%s", vcsName, refPath))
+		assert.True(t, os.IsNotExist(err), "loose ref %s should be removed after packing", refPath)
+	}
+
+	// a lock file is an update in progress, not a ref
+	_, err = os.Stat(fmt.Sprintf(".%s/refs/heads/synth/02.lock", vcsName))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(fmt.Sprintf(".%s/refs/heads/synth/02.lock", vcsName)))
+
+	// packed refs are still readable and listed
+	hash, err := getRef("refs/heads/feature")
+	assert.NoError(t, err)
+	assert.Equal(t, hashA, hash)
+
+	hash, err = getRef("refs/heads/synth/01")
+	assert.NoError(t, err)
+	assert.Equal(t, hashA, hash)
+
+	branches, err := getBranches(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"feature", "main", "synth/01"}, branches)
+
+	// a loose ref shadows the packed one
+	assert.NoError(t, updateRef("refs/heads/feature", hashB))
+	hash, err = getRef("refs/heads/feature")
+	assert.NoError(t, err)
+	assert.Equal(t, hashB, hash)
+
+	// deleting removes both the loose file and the packed entry
+	assert.NoError(t, deleteRef("refs/heads/feature"))
+	exists, err := refExists("refs/heads/feature")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	packed, err := readPackedRefs()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"refs/heads/synth/01": hashA, "refs/tags/v1": hashB}, packed)
+
+	assert.Error(t, deleteRef("refs/heads/feature"))
+}
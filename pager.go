@@ -0,0 +1,108 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// noPager is set by the global --no-pager option to never page output.
+var noPager = false
+
+// quiet is set by the global -q or --quiet option to discard what a command
+// prints to stdout, and its progress. Errors and warnings still go to
+// stderr.
+var quiet = false
+
+// defaultPagerEnv is given to the pager unless already set: less quits if
+// the output fits on one screen, passes colors through, and leaves the
+// screen as it was.
+var defaultPagerEnv = map[string]string{
+	"LESS": "FRX",
+	"LV":   "-c",
+}
+
+// pagerCommand returns the command output is paged through: MYGIT_PAGER,
+// else core.pager, else PAGER, else less. An empty command or "cat" means
+// no pager.
+func pagerCommand() string {
+	if pager, ok := os.LookupEnv("MYGIT_PAGER"); ok {
+		return pager
+	}
+	if pager, err := getConfig("pager"); err == nil {
+		return pager
+	}
+	if pager, ok := os.LookupEnv("PAGER"); ok {
+		return pager
+	}
+
+	return "less"
+}
+
+// stdoutIsTerminal reports whether stdout is a terminal.
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startPager sends stdout through the pager, if stdout is a terminal and
+// paging is not turned off, and returns the function that waits for the
+// pager to finish once everything is written. The pager is started with
+// sh -c, so core.pager can hold arguments.
+func startPager() (func(), error) {
+	pager := strings.TrimSpace(pagerCommand())
+	if noPager || pager == "" || pager == "cat" || !stdoutIsTerminal() {
+		return func() {}, nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("error starting pager: %w", err)
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for name, value := range defaultPagerEnv {
+		if _, ok := os.LookupEnv(name); !ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, fmt.Errorf("error starting pager %s: %w", pager, err)
+	}
+	r.Close()
+
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = w, w
+
+	return func() {
+		os.Stdout, color.Output = stdout, colorOutput
+		w.Close()
+		cmd.Wait() // quitting the pager early is not an error of ours
+	}, nil
+}
+
+// discardOutput sends stdout to the null device, for --quiet, and returns
+// the function that restores it.
+func discardOutput() (func(), error) {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", os.DevNull, err)
+	}
+
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = null, null
+
+	return func() {
+		os.Stdout, color.Output = stdout, colorOutput
+		null.Close()
+	}, nil
+}
@@ -0,0 +1,34 @@
+package mygit
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPager(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		t.Setenv("PAGER", "more")
+		t.Setenv("MYGIT_PAGER", "")
+		os.Unsetenv("MYGIT_PAGER")
+		assert.Equal(t, "more", pagerCommand())
+
+		assert.NoError(t, updateConfig("pager", "less -S"))
+		assert.Equal(t, "less -S", pagerCommand())
+
+		t.Setenv("MYGIT_PAGER", "")
+		assert.Equal(t, "", pagerCommand())
+
+		// output that is not a terminal is never paged
+		t.Setenv("MYGIT_PAGER", "false")
+		stdout := os.Stdout
+		stopPager, err := startPager()
+		assert.NoError(t, err)
+		stopPager()
+		assert.Equal(t, stdout, os.Stdout)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,645 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// cwdPrefix is the directory the command was started from, relative to the
+// repository root, using forward slashes ("." when started at the root).
+var cwdPrefix = "."
+
+// gitDir is the repository metadata directory. It is relative to the
+// working tree root unless overridden, in which case it is absolute.
+// Per-worktree state (HEAD, index, merge state) lives here.
+var gitDir = "." + vcsName
+
+// commonDir holds the state shared by all worktrees: objects, refs, config,
+// and hooks. It equals gitDir except in linked worktrees.
+var commonDir = gitDir
+
+// bareRepository is set when the repository has no working tree.
+var bareRepository = false
+
+// workTreeRoot is the absolute root of the working tree when it is not the
+// current directory, as for library calls, which leave the process's
+// directory alone. The command line changes into the root and leaves it
+// empty. Paths in the working tree go through workTreePath.
+var workTreeRoot = ""
+
+// workTreePath returns where the working tree path filePath, relative to
+// the root, is on disk: itself when the root is the current directory,
+// and joined onto workTreeRoot otherwise.
+func workTreePath(filePath string) string {
+	if workTreeRoot == "" || filepath.IsAbs(filePath) {
+		return filePath
+	}
+
+	return filepath.Join(workTreeRoot, filePath)
+}
+
+// repoOverrides holds repository locations given by global options or
+// environment variables.
+type repoOverrides struct {
+	chdirs   []string // each -C, in order
+	gitDir   string   // --git-dir or MYGIT_DIR
+	workTree string   // --work-tree or MYGIT_WORK_TREE
+}
+
+// parseGlobalOptions reads the -C, --git-dir, and --work-tree options that
+// precede the command name, falling back to the MYGIT_DIR and
+// MYGIT_WORK_TREE environment variables, and sets jsonOutput for --json,
+// porcelainErrors for --porcelain-errors, colorWhen for --color, noPager for
+// --no-pager, and quiet for -q or --quiet. --help stands for the help
+// command.
+// It returns the remaining arguments starting with the command name.
+func parseGlobalOptions(args []string) (repoOverrides, []string, error) {
+	overrides := repoOverrides{
+		gitDir:   os.Getenv("MYGIT_DIR"),
+		workTree: os.Getenv("MYGIT_WORK_TREE"),
+	}
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-h", "--help":
+			// "--help <command>" is "help <command>"
+			return overrides, append([]string{"help"}, args[1:]...), nil
+		case "-q", "--quiet":
+			quiet = true
+			args = args[1:]
+			continue
+		case "-C":
+			if len(args) < 2 {
+				return overrides, nil, fmt.Errorf("option -C requires a value")
+			}
+			overrides.chdirs = append(overrides.chdirs, args[1])
+			args = args[2:]
+			continue
+		case "--json":
+			jsonOutput = true
+			args = args[1:]
+			continue
+		case "--porcelain-errors":
+			porcelainErrors = true
+			args = args[1:]
+			continue
+		case "--no-pager":
+			noPager = true
+			args = args[1:]
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(args[0], "=")
+
+		if name == "--color" {
+			when := "always"
+			if hasValue {
+				var err error
+				if when, err = parseColorWhen(value); err != nil {
+					return overrides, nil, err
+				}
+			}
+			colorWhen = when
+			args = args[1:]
+			continue
+		}
+
+		var target *string
+		switch name {
+		case "--git-dir":
+			target = &overrides.gitDir
+		case "--work-tree":
+			target = &overrides.workTree
+		default:
+			return overrides, nil, fmt.Errorf("unknown option: %s", name)
+		}
+
+		if !hasValue {
+			if len(args) < 2 {
+				return overrides, nil, fmt.Errorf("option %s requires a value", name)
+			}
+			value = args[1]
+			args = args[1:]
+		}
+
+		*target = value
+		args = args[1:]
+	}
+
+	return overrides, args, nil
+}
+
+// setupRepository locates the repository and changes into the root of its
+// working tree. Each -C directory is changed into first, in order, so it
+// stands for the directory the command was started in: relative paths,
+// --git-dir and --work-tree included, are taken from there. Without
+// overrides the repository is discovered by walking up from the current
+// directory. A --git-dir without --work-tree uses the current directory as
+// the working tree. When creating is set, a missing repository is not an
+// error.
+func setupRepository(overrides repoOverrides, creating bool) error {
+	for _, dir := range overrides.chdirs {
+		if dir == "" {
+			continue // as in git, -C "" leaves the directory as it is
+		}
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("cannot change to %s: %w", dir, err)
+		}
+	}
+
+	if overrides.gitDir == "" && overrides.workTree == "" {
+		if creating {
+			return nil
+		}
+		return discoverRepository()
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	workTree := cwd
+	if overrides.workTree != "" {
+		if workTree, err = filepath.Abs(overrides.workTree); err != nil {
+			return fmt.Errorf("error resolving work tree %s: %w", overrides.workTree, err)
+		}
+	}
+
+	switch {
+	case overrides.gitDir != "":
+		absGitDir, err := filepath.Abs(overrides.gitDir)
+		if err != nil {
+			return fmt.Errorf("error resolving git dir %s: %w", overrides.gitDir, err)
+		}
+		if err := useGitDir(absGitDir); err != nil {
+			return err
+		}
+		if overrides.workTree == "" && isBareRepositoryDir(gitDir) {
+			bareRepository = true
+			return nil
+		}
+	case creating:
+		if err := useGitDir(filepath.Join(workTree, "."+vcsName)); err != nil {
+			return err
+		}
+	default:
+		// only the working tree was given, so find the metadata as usual
+		root, bare, found := findRepositoryRoot(cwd)
+		if !found {
+			return fmt.Errorf("error: %w", ErrNotARepository)
+		}
+
+		metaDir := root
+		if !bare {
+			if metaDir, err = repositoryMetaDir(root); err != nil {
+				return err
+			}
+		}
+		if err := useGitDir(metaDir); err != nil {
+			return err
+		}
+	}
+
+	// paths on the command line stay relative to where the command was
+	// started, as long as that is inside the working tree
+	cwdPrefix = "."
+	if relPath, err := filepath.Rel(workTree, cwd); err == nil && relPath != ".." && !strings.HasPrefix(relPath, "../") {
+		cwdPrefix = filepath.ToSlash(relPath)
+	}
+
+	if err := os.Chdir(workTree); err != nil {
+		return fmt.Errorf("error changing to work tree %s: %w", workTree, err)
+	}
+
+	return nil
+}
+
+// discoverRepository walks up from the current directory looking for a VCS
+// directory. When found, it changes into the repository root and records
+// where the command was started in cwdPrefix. If no repository is found the
+// current directory is left unchanged.
+func discoverRepository() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error getting current directory: %w", err)
+	}
+
+	dir, bare, found := findRepositoryRoot(cwd)
+	if !found {
+		return nil // not inside a repository
+	}
+
+	if bare {
+		// metadata lives directly in dir and there is no working tree
+		bareRepository = true
+		return useGitDir(dir)
+	}
+
+	// a linked worktree has a .mygit file pointing at its metadata
+	if info, err := os.Stat(filepath.Join(dir, "."+vcsName)); err == nil && !info.IsDir() {
+		metaDir, err := repositoryMetaDir(dir)
+		if err != nil {
+			return err
+		}
+		if err := useGitDir(metaDir); err != nil {
+			return err
+		}
+	}
+
+	relPath, err := filepath.Rel(dir, cwd)
+	if err != nil {
+		return fmt.Errorf("error resolving working directory: %w", err)
+	}
+	cwdPrefix = filepath.ToSlash(relPath)
+
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("error changing to repository root %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// findRepositoryRoot returns the closest directory at or above start that
+// contains a VCS directory or is itself a bare repository.
+func findRepositoryRoot(start string) (string, bool, bool) {
+	dir := start
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "."+vcsName)); err == nil {
+			return dir, false, true // directory, or file of a linked worktree
+		}
+
+		if isBareRepositoryDir(dir) {
+			return dir, true, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false, false
+		}
+		dir = parent
+	}
+}
+
+// isBareRepositoryDir reports whether dir holds repository metadata directly
+// and is marked bare in its config.
+func isBareRepositoryDir(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, "objects")); err != nil || !info.IsDir() {
+		return false
+	}
+
+	bare, err := readConfigValue(filepath.Join(dir, "config"), "bare")
+	return err == nil && bare == "true"
+}
+
+// skipWalkEntry returns the WalkDir result that skips d: the whole
+// directory, or just the file.
+func skipWalkEntry(d fs.DirEntry) error {
+	if d.IsDir() {
+		return filepath.SkipDir
+	}
+
+	return nil
+}
+
+// walkWorkTree walks the working tree below root like filepath.WalkDir,
+// but hands fn paths with forward slashes, the form the index and trees
+// store on every platform.
+func walkWorkTree(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(workTreePath(root), func(path string, d fs.DirEntry, err error) error {
+		if workTreeRoot != "" && !filepath.IsAbs(root) {
+			relPath, relErr := filepath.Rel(workTreeRoot, path)
+			if relErr != nil {
+				return relErr
+			}
+			path = relPath
+		}
+		return fn(filepath.ToSlash(path), d, err)
+	})
+}
+
+// checkPathName rejects a name the index and trees cannot hold as a path
+// component: empty, "." or "..", which checkout would resolve outside the
+// directory it writes to, anything containing a slash, a "|", or a line
+// break, which would split an index line, and the repository directory in
+// any case, which would let checkout write into the repository itself.
+func checkPathName(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Errorf("invalid path component %q", name)
+	case strings.Contains(name, "/"):
+		return fmt.Errorf("invalid path component %q: contains a slash", name)
+	case strings.ContainsAny(name, "|\n\r"):
+		return fmt.Errorf("invalid path component %q: contains a separator of the index format", name)
+	case strings.EqualFold(name, "."+vcsName):
+		return fmt.Errorf("invalid path component %q: reserved for the repository", name)
+	}
+
+	return nil
+}
+
+// checkIndexPath rejects a repository-relative path with a component
+// checkPathName refuses. A sparse directory entry's trailing slash is
+// allowed.
+func checkIndexPath(filePath string) error {
+	for _, name := range strings.Split(strings.TrimSuffix(filePath, "/"), "/") {
+		if err := checkPathName(name); err != nil {
+			return fmt.Errorf("invalid path %s: %w", filePath, err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeIndexPaths returns index with every path using forward slashes,
+// the same map when none needs converting, or an error for a path that
+// checkIndexPath refuses. A converted path replaces an entry already
+// stored under its normalized form, since only new entries are unconverted.
+func normalizeIndexPaths(index map[string][]byte) (map[string][]byte, error) {
+	var converted map[string][]byte
+	for filePath, hash := range index {
+		if slashPath := filepath.ToSlash(filePath); slashPath != filePath {
+			if converted == nil {
+				converted = make(map[string][]byte)
+			}
+			converted[slashPath] = hash
+			continue
+		}
+		if err := checkIndexPath(filePath); err != nil {
+			return nil, err
+		}
+	}
+	if converted == nil {
+		return index, nil
+	}
+
+	normalized := make(map[string][]byte, len(index))
+	for filePath, hash := range index {
+		if filepath.ToSlash(filePath) == filePath {
+			normalized[filePath] = hash
+		}
+	}
+	for filePath, hash := range converted {
+		if err := checkIndexPath(filePath); err != nil {
+			return nil, err
+		}
+		normalized[filePath] = hash
+	}
+
+	return normalized, nil
+}
+
+// requireWorkTree fails for commands that need a working tree when the
+// repository is bare.
+func requireWorkTree(command string) error {
+	if bareRepository {
+		return fmt.Errorf("%s must be run in a work tree; this repository is bare", command)
+	}
+
+	return nil
+}
+
+// useGitDir switches to the given metadata directory. If it belongs to a
+// linked worktree, its commondir file names the shared directory.
+func useGitDir(dir string) error {
+	common, err := resolveCommonDir(dir)
+	if err != nil {
+		return err
+	}
+
+	gitDir, commonDir = dir, common
+	return nil
+}
+
+// resolveCommonDir returns the shared directory of the metadata directory
+// dir: the one its commondir file names, or dir itself.
+func resolveCommonDir(dir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "commondir"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return dir, nil
+		}
+		return "", fmt.Errorf("error reading commondir: %w", err)
+	}
+
+	common := strings.TrimSpace(string(content))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(dir, common)
+	}
+
+	return filepath.Clean(common), nil
+}
+
+// repositoryMetaDir returns the metadata directory of the working tree at
+// root: root/.mygit itself, or the directory a linked worktree's .mygit
+// file points to with a "gitdir: <path>" line.
+func repositoryMetaDir(root string) (string, error) {
+	vcsPath := filepath.Join(root, "."+vcsName)
+
+	info, err := os.Stat(vcsPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", vcsPath, err)
+	}
+	if info.IsDir() {
+		return vcsPath, nil
+	}
+
+	content, err := os.ReadFile(vcsPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", vcsPath, err)
+	}
+
+	metaDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("invalid %s file: missing gitdir line", vcsPath)
+	}
+	if !filepath.IsAbs(metaDir) {
+		metaDir = filepath.Join(root, metaDir)
+	}
+
+	return filepath.Clean(metaDir), nil
+}
+
+// isVCSEntry reports whether an entry met while walking the working tree
+// holds repository metadata (or, in a linked worktree, points to it) and
+// must be skipped.
+func isVCSEntry(path string, d fs.DirEntry) bool {
+	if d.Name() == "."+vcsName {
+		return true
+	}
+
+	if !filepath.IsAbs(gitDir) {
+		return false // default layout, matched by name above
+	}
+
+	absPath, err := filepath.Abs(workTreePath(path))
+	return err == nil && absPath == gitDir
+}
+
+// resolvePathspec converts a path given on the command line into a path
+// relative to the repository root. Paths are interpreted relative to the
+// directory the command was started from, unless they start with ":/",
+// which makes them relative to the repository root. An absolute path must
+// lie inside the working tree.
+func resolvePathspec(spec string) (string, error) {
+	var resolved string
+	if rest, ok := strings.CutPrefix(spec, ":/"); ok {
+		resolved = filepath.Clean(rest)
+	} else if filepath.IsAbs(spec) {
+		root, err := filepath.Abs(workTreePath("."))
+		if err != nil {
+			return "", fmt.Errorf("error resolving the working tree: %w", err)
+		}
+		if resolved, err = filepath.Rel(root, spec); err != nil {
+			return "", fmt.Errorf("path %s is outside the repository", spec)
+		}
+	} else {
+		resolved = filepath.Join(cwdPrefix, spec)
+	}
+
+	resolved = filepath.ToSlash(resolved)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") || filepath.IsAbs(resolved) {
+		return "", fmt.Errorf("path %s is outside the repository", spec)
+	}
+
+	return resolved, nil
+}
+
+// displayPath converts a repository-relative path into one relative to the
+// directory the command was started from.
+func displayPath(path string) string {
+	relPath, err := filepath.Rel(cwdPrefix, path)
+	if err != nil {
+		return path
+	}
+
+	return filepath.ToSlash(relPath)
+}
+
+// isGlobPathspec reports whether a pathspec is a shell glob pattern rather
+// than a plain path.
+func isGlobPathspec(spec string) bool {
+	return strings.ContainsAny(spec, "*?[")
+}
+
+// matchPathspec reports whether the repository-relative path matches a
+// resolved glob pathspec. As in ignore files, "*" stays within one
+// directory and a "**" segment matches any number of directories.
+func matchPathspec(pattern, filePath string) bool {
+	return matchIgnorePattern(strings.Split(pattern, "/"), strings.Split(filepath.ToSlash(filePath), "/"))
+}
+
+// expandPathspecs resolves the pathspecs given on the command line into
+// repository-relative paths. A glob is replaced by the candidates it
+// matches, in order, and must match at least one; other pathspecs are
+// passed through. Each path is returned once.
+func expandPathspecs(specs []string, candidates []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, spec := range specs {
+		resolved, err := resolvePathspec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if !isGlobPathspec(spec) {
+			add(resolved)
+			continue
+		}
+
+		matched := false
+		for _, candidate := range candidates {
+			if matchPathspec(resolved, candidate) {
+				matched = true
+				add(candidate)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("pathspec '%s' did not match any files", spec)
+		}
+	}
+
+	return paths, nil
+}
+
+// withinPaths reports whether the repository-relative path is at or below
+// one of paths. Every path is within an empty list.
+func withinPaths(filePath string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(paths, func(spec string) bool { return pathspecMatches(spec, filePath) })
+}
+
+// workTreeFiles returns the files of the working tree that add would
+// consider, sorted: tracked files and untracked files that are not
+// ignored, outside nested repositories. The walk stops with ctx's error
+// once ctx is done.
+func workTreeFiles(ctx context.Context) ([]string, error) {
+	cone, err := loadSparseCone()
+	if err != nil {
+		return nil, err
+	}
+	index, err := readConeIndex(ctx, cone)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = walkWorkTree(".", func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+
+		if isVCSEntry(path, d) {
+			return skipWalkEntry(d) // skip VCS dir
+		}
+
+		if _, tracked := index[path]; !tracked && rules.ignored(path, d.IsDir()) {
+			return skipWalkEntry(d)
+		}
+
+		if !cone.containsEntry(path, d.IsDir()) {
+			return skipWalkEntry(d) // outside the sparse-checkout cone
+		}
+
+		if d.IsDir() {
+			if isNestedRepository(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking working tree: %w", err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,180 @@
+package mygit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePathspec(t *testing.T) {
+	defer func() { cwdPrefix = "." }()
+	cwdPrefix = "src/pkg"
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"file.go", "src/pkg/file.go"},
+		{"./file.go", "src/pkg/file.go"},
+		{"../other/file.go", "src/other/file.go"},
+		{".", "src/pkg"},
+		{":/README.md", "README.md"},
+		{":/", "."},
+	}
+
+	for _, tt := range tests {
+		resolved, err := resolvePathspec(tt.spec)
+		assert.NoError(t, err, "resolving %s", tt.spec)
+		assert.Equal(t, tt.expected, resolved, "resolving %s", tt.spec)
+	}
+
+	_, err := resolvePathspec("../../../outside")
+	assert.Error(t, err)
+
+	// absolute paths are taken relative to the working tree, not cwdPrefix
+	root, err := filepath.Abs(".")
+	assert.NoError(t, err)
+	resolved, err := resolvePathspec(filepath.Join(root, "src", "main.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, "src/main.go", resolved)
+	resolved, err = resolvePathspec(root)
+	assert.NoError(t, err)
+	assert.Equal(t, ".", resolved)
+	_, err = resolvePathspec(filepath.Join(filepath.Dir(root), "outside"))
+	assert.Error(t, err)
+
+	assert.Equal(t, "file.go", displayPath("src/pkg/file.go"))
+	assert.Equal(t, "../../README.md", displayPath("README.md"))
+}
+
+func TestParseGlobalOptions(t *testing.T) {
+	t.Setenv("MYGIT_DIR", "/env/repo")
+	t.Setenv("MYGIT_WORK_TREE", "")
+
+	overrides, args, err := parseGlobalOptions([]string{"--work-tree", "/src", "status", "--porcelain"})
+	assert.NoError(t, err)
+	assert.Equal(t, repoOverrides{gitDir: "/env/repo", workTree: "/src"}, overrides)
+	assert.Equal(t, []string{"status", "--porcelain"}, args)
+
+	// flags take precedence over the environment
+	overrides, args, err = parseGlobalOptions([]string{"--git-dir=/flag/repo", "log"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/flag/repo", overrides.gitDir)
+	assert.Equal(t, []string{"log"}, args)
+
+	_, _, err = parseGlobalOptions([]string{"--git-dir"})
+	assert.Error(t, err)
+
+	_, _, err = parseGlobalOptions([]string{"--unknown", "log"})
+	assert.Error(t, err)
+
+	overrides, args, err = parseGlobalOptions([]string{"-C", "a", "-C", "b", "--git-dir=.git", "status"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, overrides.chdirs)
+	assert.Equal(t, []string{"status"}, args)
+
+	_, _, err = parseGlobalOptions([]string{"-C"})
+	assert.EqualError(t, err, "option -C requires a value")
+}
+
+func TestChangeDirectoryOption(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		root, err := os.Getwd()
+		assert.NoError(t, err)
+		assert.NoError(t, os.MkdirAll(filepath.Join("sub", "dir"), 0755))
+
+		elsewhere := t.TempDir()
+		assert.NoError(t, os.Chdir(elsewhere))
+		defer func() { cwdPrefix = "." }()
+
+		// each -C is relative to the one before; an empty one is ignored
+		overrides := repoOverrides{chdirs: []string{root, "sub", "", "dir"}}
+		assert.NoError(t, setupRepository(overrides, false))
+		assert.Equal(t, "sub/dir", cwdPrefix)
+
+		assert.NoError(t, os.Chdir(elsewhere))
+		err = setupRepository(repoOverrides{chdirs: []string{"missing"}}, false)
+		assert.ErrorContains(t, err, "cannot change to missing")
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestBareRepositoryDiscovery(t *testing.T) {
+	bareDir := t.TempDir()
+
+	defer func(savedGitDir, savedCommonDir string) {
+		gitDir, commonDir, bareRepository = savedGitDir, savedCommonDir, false
+	}(gitDir, commonDir)
+	assert.NoError(t, useGitDir(bareDir))
+
+	assert.NoError(t, createDirectoriesFiles())
+	assert.False(t, isBareRepositoryDir(bareDir), "not bare until configured")
+
+	assert.NoError(t, updateConfig("bare", "true"))
+	assert.True(t, isBareRepositoryDir(bareDir))
+
+	nested := filepath.Join(bareDir, "refs", "heads")
+	root, bare, found := findRepositoryRoot(nested)
+	assert.True(t, found)
+	assert.True(t, bare)
+	assert.Equal(t, bareDir, root)
+
+	assert.NoError(t, requireWorkTree("status"))
+	bareRepository = true
+	assert.Error(t, requireWorkTree("status"))
+}
+
+func TestExpandPathspecs(t *testing.T) {
+	defer func() { cwdPrefix = "." }()
+	cwdPrefix = "src"
+
+	candidates := []string{"a.log", "src/b.log", "src/b.go", "src/sub/c.log"}
+
+	paths, err := expandPathspecs([]string{"*.log", "b.go", "missing.txt", "b.go"}, candidates)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"src/b.log", "src/b.go", "src/missing.txt"}, paths)
+
+	// "**" reaches into subdirectories, ":/" starts from the root
+	paths, err = expandPathspecs([]string{"**/*.log", ":/*.log"}, candidates)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"src/b.log", "src/sub/c.log", "a.log"}, paths)
+
+	_, err = expandPathspecs([]string{"*.txt"}, candidates)
+	assert.Error(t, err)
+}
+
+func TestCheckIndexPath(t *testing.T) {
+	for _, valid := range []string{"a.txt", "docs/guide.md", ".mygitignore", "dir/", "a..b/c"} {
+		assert.NoError(t, checkIndexPath(valid), valid)
+	}
+	for _, invalid := range []string{"", "../escape", "a/../b", "./a", "a//b", ".mygit/config", "sub/.MYGIT/HEAD", "a|b", "dir/a\nb", "a\r"} {
+		assert.Error(t, checkIndexPath(invalid), invalid)
+	}
+
+	err := withRepositoryInit(t.TempDir(), func() error {
+		blobHash, err := createObject([]byte("payload"))
+		assert.NoError(t, err)
+
+		// the index never stores a path checkout could not write back
+		assert.ErrorContains(t, writeIndex(t.Context(), map[string][]byte{".mygit/hooks/pre-commit": blobHash}), "reserved for the repository")
+
+		// nor does checkout follow a tree whose names escape the working tree
+		evil, err := writeObject("tree", encodeTreeContent([]treeEntry{
+			{mode: "100644", objType: "blob", hash: blobHash, name: ".."},
+		}))
+		assert.NoError(t, err)
+		_, err = buildIndexFromTree(t.Context(), evil, "", true)
+		assert.ErrorContains(t, err, `invalid path component ".."`)
+
+		report, err := checkObjectStore(t.Context())
+		assert.NoError(t, err)
+		assert.Len(t, report.corrupt, 1)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
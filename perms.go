@@ -0,0 +1,102 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Modes working tree files and directories are created with. As for any
+// other program, the process umask then decides which bits stay, so a umask
+// of 002 gives group-writable files. Existing files keep their mode when
+// their content is replaced.
+const (
+	workTreeFileMode fs.FileMode = 0666
+	workTreeDirMode  fs.FileMode = 0777
+)
+
+// sharedRepositoryPerm returns the permission bits core.sharedRepository
+// asks for on repository files, and whether they replace the file's own
+// bits rather than being added to them. "group" (or "true") adds group read
+// and write, "all" (or "world", "everybody") also adds read for others, and
+// an octal mode such as 0640 is used as it is. Unset, "umask", and "false"
+// leave files to the umask, returning 0.
+func sharedRepositoryPerm() (fs.FileMode, bool, error) {
+	value, err := getConfig("sharedRepository")
+	if err != nil {
+		return 0, false, nil // not configured
+	}
+
+	switch strings.ToLower(value) {
+	case "", "umask", "false":
+		return 0, false, nil
+	case "group", "true":
+		return 0660, false, nil
+	case "all", "world", "everybody":
+		return 0664, false, nil
+	}
+
+	perm, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || perm&^0777 != 0 {
+		return 0, false, fmt.Errorf("invalid core.sharedRepository value %q", value)
+	}
+	if perm&0600 != 0600 {
+		return 0, false, fmt.Errorf("core.sharedRepository %q would make files unusable by their owner", value)
+	}
+
+	return fs.FileMode(perm), true, nil
+}
+
+// adjustSharedPerm applies core.sharedRepository to a file or directory just
+// written in the repository. Directories get execute wherever they get read,
+// and the setgid bit so files created in them keep the shared group.
+func adjustSharedPerm(path string) error {
+	perm, exact, err := sharedRepositoryPerm()
+	if err != nil || perm == 0 {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error adjusting permissions of %s: %w", path, err)
+	}
+
+	mode := info.Mode().Perm() | perm
+	if exact {
+		mode = perm
+	}
+	if info.IsDir() {
+		mode |= (mode & 0444) >> 2 // read implies search
+		mode |= fs.ModeSetgid
+	}
+
+	if mode == info.Mode()&(fs.ModePerm|fs.ModeSetgid) {
+		return nil
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("error adjusting permissions of %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// createTempFile is like os.CreateTemp, but creates the file with the mode
+// os.Create uses (0666 before the umask) instead of 0600, for files that are
+// renamed into the repository and must be as readable as any other there.
+func createTempFile(dir, pattern string) (*os.File, error) {
+	for range 10000 {
+		name := filepath.Join(dir, strings.Replace(pattern, "*", strconv.FormatUint(rand.Uint64(), 36), 1))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) {
+			continue // taken, try another name
+		}
+		return f, err
+	}
+
+	return nil, fmt.Errorf("error creating temporary file in %s: too many attempts", dir)
+}
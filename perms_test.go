@@ -0,0 +1,86 @@
+package mygit
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedRepositoryPerm(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	tests := []struct {
+		value string
+		perm  fs.FileMode
+		exact bool
+		fails bool
+	}{
+		{"umask", 0, false, false},
+		{"group", 0660, false, false},
+		{"true", 0660, false, false},
+		{"all", 0664, false, false},
+		{"0640", 0640, true, false},
+		{"0440", 0, false, true},
+		{"shared", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		assert.NoError(t, updateConfig("sharedRepository", tt.value))
+		perm, exact, err := sharedRepositoryPerm()
+		if tt.fails {
+			assert.Error(t, err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.perm, perm, tt.value)
+		assert.Equal(t, tt.exact, exact, tt.value)
+	}
+
+	// group sharing opens new objects and their directories to the group
+	assert.NoError(t, updateConfig("sharedRepository", "group"))
+	blobHash, err := createObject([]byte("shared"))
+	assert.NoError(t, err)
+	objectPath := fmt.Sprintf(".%s/objects/%x/%x", vcsName, blobHash[:1], blobHash[1:])
+
+	info, err := os.Stat(objectPath)
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0660), info.Mode().Perm()&0660)
+
+	info, err = os.Stat(filepath.Dir(objectPath))
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0770), info.Mode().Perm()&0770)
+	assert.NotZero(t, info.Mode()&fs.ModeSetgid)
+
+	// an exact mode replaces the bits
+	assert.NoError(t, updateConfig("sharedRepository", "0600"))
+	assert.NoError(t, adjustSharedPerm(objectPath))
+	info, err = os.Stat(objectPath)
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+}
+
+func TestCreateTempFile(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := createTempFile(dir, "tmp-*")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	// the umask decides, as for os.Create, rather than a fixed 0600
+	created, err := os.Create(filepath.Join(dir, "reference"))
+	assert.NoError(t, err)
+	defer created.Close()
+
+	tempInfo, err := f.Stat()
+	assert.NoError(t, err)
+	refInfo, err := created.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, refInfo.Mode().Perm(), tempInfo.Mode().Perm())
+}
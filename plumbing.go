@@ -0,0 +1,237 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Plumbing is the low-level layer of the library: objects, the index, and
+// refs, with no policy of their own. Hashes are hexadecimal, and anything
+// that takes one also takes a revision such as "HEAD~2", a branch, or an
+// abbreviated hash. Porcelain workflows can be written using nothing else.
+type Plumbing interface {
+	// ReadObject returns the type and content of an object.
+	ReadObject(ctx context.Context, hash string) (Object, error)
+	// WriteObject stores content as an object of the given type ("blob",
+	// "tree", or "commit") and returns its hash.
+	WriteObject(ctx context.Context, objType string, content []byte) (string, error)
+	// ReadIndex returns the staged blob hash of every path.
+	ReadIndex(ctx context.Context) (map[string]string, error)
+	// WriteIndex replaces the index with the given paths and blob hashes.
+	WriteIndex(ctx context.Context, entries map[string]string) error
+	// WriteTree writes the tree objects for the index and returns the
+	// hash of the root tree.
+	WriteTree(ctx context.Context) (string, error)
+	// WriteCommit writes a commit of tree with the given parents, recording
+	// user.email as author and committer, and returns its hash.
+	WriteCommit(ctx context.Context, tree string, parents []string, message string) (string, error)
+	// ResolveRef returns the object a revision names.
+	ResolveRef(ctx context.Context, rev string) (string, error)
+	// SymbolicRef returns the ref HEAD points at, such as "refs/heads/main".
+	SymbolicRef(ctx context.Context) (string, error)
+	// UpdateRef points ref at newHash if it still points at oldHash, with
+	// an empty oldHash expecting the ref to have no commits.
+	UpdateRef(ctx context.Context, ref, newHash, oldHash string) error
+}
+
+// Porcelain is the high-level layer: the workflows of the command line,
+// with its checks and hooks. Repository implements it on the same state as
+// Plumbing.
+type Porcelain interface {
+	Add(ctx context.Context, paths ...string) error
+	AddBlobs(ctx context.Context, sources iter.Seq2[string, io.Reader]) ([]string, error)
+	Commit(ctx context.Context, message string) (string, error)
+	Log(ctx context.Context, rev string) ([]Commit, error)
+	Checkout(ctx context.Context, branch string) error
+	Merge(ctx context.Context, branch string) (MergeResult, error)
+}
+
+// Repository implements both layers.
+var (
+	_ Plumbing  = (*Repository)(nil)
+	_ Porcelain = (*Repository)(nil)
+)
+
+// Object is an object as Plumbing.ReadObject returns it.
+type Object struct {
+	Type    string // blob, tree, or commit
+	Content []byte // the object's data without its header
+}
+
+// decodeHashes turns hexadecimal hashes into binary ones.
+func decodeHashes(hashes ...string) ([][]byte, error) {
+	decoded := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		var err error
+		if decoded[i], err = hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("invalid object id %s", hash)
+		}
+	}
+
+	return decoded, nil
+}
+
+// ReadObject returns the type and content of an object.
+func (r *Repository) ReadObject(ctx context.Context, hash string) (Object, error) {
+	var object Object
+
+	err := r.run(ctx, func() error {
+		objectHash, err := resolveRevision(hash)
+		if err != nil {
+			return err
+		}
+
+		data, objType, _, err := readRawObject(objectHash)
+		if err != nil {
+			return err
+		}
+
+		object = Object{Type: objType, Content: objectContent(data)}
+		return nil
+	})
+
+	return object, err
+}
+
+// objectContent returns raw object data without its "<type> <size>\0"
+// header.
+func objectContent(data []byte) []byte {
+	_, content, _ := strings.Cut(string(data), "\x00")
+	return []byte(content)
+}
+
+// WriteObject stores content as an object of the given type and returns
+// its hash.
+func (r *Repository) WriteObject(ctx context.Context, objType string, content []byte) (string, error) {
+	if _, err := lookupObjectKind(objType); err != nil {
+		return "", err
+	}
+
+	var hash []byte
+	err := r.run(ctx, func() error {
+		var err error
+		hash, err = writeObject(objType, content)
+		return err
+	})
+
+	return hex.EncodeToString(hash), err
+}
+
+// ReadIndex returns the staged blob hash of every path.
+func (r *Repository) ReadIndex(ctx context.Context) (map[string]string, error) {
+	entries := make(map[string]string)
+
+	err := r.run(ctx, func() error {
+		index, err := readIndex(ctx)
+		for path, hash := range index {
+			entries[path] = hex.EncodeToString(hash)
+		}
+		return err
+	})
+
+	return entries, err
+}
+
+// WriteIndex replaces the index with the given paths and blob hashes.
+func (r *Repository) WriteIndex(ctx context.Context, entries map[string]string) error {
+	index := make(map[string][]byte, len(entries))
+	for _, path := range slices.Sorted(maps.Keys(entries)) {
+		hashes, err := decodeHashes(entries[path])
+		if err != nil {
+			return err
+		}
+		index[path] = hashes[0]
+	}
+
+	return r.run(ctx, func() error { return writeIndex(ctx, index) })
+}
+
+// WriteTree writes the tree objects for the index and returns the hash of
+// the root tree.
+func (r *Repository) WriteTree(ctx context.Context) (string, error) {
+	var treeHash []byte
+
+	err := r.run(ctx, func() error {
+		index, err := readIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		treeHash, err = writeIndexTree(index)
+		return err
+	})
+
+	return hex.EncodeToString(treeHash), err
+}
+
+// WriteCommit writes a commit of tree with the given parents and returns
+// its hash.
+func (r *Repository) WriteCommit(ctx context.Context, tree string, parents []string, message string) (string, error) {
+	hashes, err := decodeHashes(append([]string{tree}, parents...)...)
+	if err != nil {
+		return "", err
+	}
+
+	var commitHash []byte
+	err = r.run(ctx, func() error {
+		commitHash, err = writeCommitObject(hashes[0], hashes[1:], message)
+		return err
+	})
+
+	return hex.EncodeToString(commitHash), err
+}
+
+// ResolveRef returns the object a revision names.
+func (r *Repository) ResolveRef(ctx context.Context, rev string) (string, error) {
+	var hash []byte
+
+	err := r.run(ctx, func() error {
+		var err error
+		hash, err = resolveRevision(rev)
+		return err
+	})
+
+	return hex.EncodeToString(hash), err
+}
+
+// SymbolicRef returns the ref HEAD points at.
+func (r *Repository) SymbolicRef(ctx context.Context) (string, error) {
+	var head string
+
+	err := r.run(ctx, func() error {
+		var err error
+		head, err = getHEAD()
+		return err
+	})
+
+	return head, err
+}
+
+// UpdateRef points ref at newHash if it still points at oldHash.
+func (r *Repository) UpdateRef(ctx context.Context, ref, newHash, oldHash string) error {
+	if !strings.HasPrefix(ref, "refs/") {
+		return fmt.Errorf("invalid ref name %s: refs start with refs/", ref)
+	}
+
+	hashes, err := decodeHashes(newHash)
+	if err != nil {
+		return err
+	}
+
+	var oldBinary []byte
+	if oldHash != "" {
+		old, err := decodeHashes(oldHash)
+		if err != nil {
+			return err
+		}
+		oldBinary = old[0]
+	}
+
+	return r.run(ctx, func() error { return compareAndSwapRef(ref, oldBinary, hashes[0]) })
+}
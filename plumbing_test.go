@@ -0,0 +1,86 @@
+package mygit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plumbingCommit commits a file using only the plumbing layer, the way a
+// reimplemented porcelain would.
+func plumbingCommit(ctx context.Context, p Plumbing, path, content, message string) (string, error) {
+	blob, err := p.WriteObject(ctx, "blob", []byte(content))
+	if err != nil {
+		return "", err
+	}
+
+	index, err := p.ReadIndex(ctx)
+	if err != nil {
+		return "", err
+	}
+	index[path] = blob
+	if err := p.WriteIndex(ctx, index); err != nil {
+		return "", err
+	}
+
+	tree, err := p.WriteTree(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := p.SymbolicRef(ctx)
+	if err != nil {
+		return "", err
+	}
+	var parents []string
+	parent, err := p.ResolveRef(ctx, "HEAD")
+	if err == nil {
+		parents = append(parents, parent)
+	}
+
+	commit, err := p.WriteCommit(ctx, tree, parents, message)
+	if err != nil {
+		return "", err
+	}
+
+	return commit, p.UpdateRef(ctx, head, commit, parent)
+}
+
+func TestPlumbing(t *testing.T) {
+	ctx := t.Context()
+	repo, err := Init(filepath.Join(t.TempDir(), "work"))
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	assert.NoError(t, repo.SetConfig(ctx, "user.email", "plumbing@example.com"))
+
+	first, err := plumbingCommit(ctx, repo, "a.txt", "a\n", "first")
+	assert.NoError(t, err)
+	second, err := plumbingCommit(ctx, repo, "dir/b.txt", "b\n", "second")
+	assert.NoError(t, err)
+
+	// the porcelain sees what the plumbing wrote
+	commits, err := repo.Log(ctx, "")
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, second, commits[0].Hash)
+		assert.Equal(t, []string{first}, commits[0].Parents)
+	}
+
+	object, err := repo.ReadObject(ctx, second[:8])
+	assert.NoError(t, err)
+	assert.Equal(t, "commit", object.Type)
+	assert.Contains(t, string(object.Content), "\n\nsecond\n")
+
+	tree, err := repo.ResolveRef(ctx, commits[0].Tree)
+	assert.NoError(t, err)
+	object, err = repo.ReadObject(ctx, tree)
+	assert.NoError(t, err)
+	assert.Equal(t, "tree", object.Type)
+
+	// a stale old hash is refused
+	assert.Error(t, repo.UpdateRef(ctx, "refs/heads/main", first, first))
+	assert.Error(t, repo.UpdateRef(ctx, "HEAD", first, second))
+}
@@ -0,0 +1,113 @@
+package mygit
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// statusEntry is the state of one path for status --porcelain: how the
+// index differs from HEAD (staged) and how the working tree differs from
+// the index (unstaged), each ' ' (unchanged), 'A', 'M', or 'D'. Untracked
+// paths are "??" and unresolved merge conflicts "UU".
+type statusEntry struct {
+	staged   byte
+	unstaged byte
+	path     string // repository-relative, with forward slashes
+}
+
+// collectStatusEntries compares HEAD, the index, and the working tree and
+// returns an entry for every path that differs anywhere, sorted by path.
+// Ignored files are left out.
+func collectStatusEntries(ctx context.Context) ([]statusEntry, error) {
+	headIndex, index, err := statusIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*statusEntry)
+	entry := func(path string) *statusEntry {
+		if entries[path] == nil {
+			entries[path] = &statusEntry{staged: ' ', unstaged: ' ', path: path}
+		}
+		return entries[path]
+	}
+
+	for _, change := range diffIndexes(headIndex, index) {
+		entry(change.path).staged = change.status
+	}
+
+	modified, deleted, err := compareIndexToWorkingTree(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range modified {
+		entry(path).unstaged = 'M'
+	}
+	for _, path := range deleted {
+		entry(path).unstaged = 'D'
+	}
+
+	files, err := workTreeFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if _, tracked := index[path]; !tracked {
+			e := entry(path)
+			e.staged, e.unstaged = '?', '?'
+		}
+	}
+
+	if merging, err := isMergeInProgress(); err != nil {
+		return nil, err
+	} else if merging {
+		conflicts, err := unresolvedConflicts(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range conflicts {
+			e := entry(path)
+			e.staged, e.unstaged = 'U', 'U'
+		}
+	}
+
+	result := make([]statusEntry, 0, len(entries))
+	for _, path := range slices.Sorted(maps.Keys(entries)) {
+		result = append(result, *entries[path])
+	}
+
+	return result, nil
+}
+
+// formatPorcelainStatus formats entries as "XY <path>" lines, the stable
+// status --porcelain format. Paths are relative to the repository root.
+// With nulTerminated each entry ends in a NUL byte and paths are written
+// as they are; otherwise entries end in a newline and a path containing a
+// quote, backslash, or control character is quoted C-style.
+func formatPorcelainStatus(entries []statusEntry, nulTerminated bool) string {
+	var sb strings.Builder
+
+	for _, e := range entries {
+		sb.WriteByte(e.staged)
+		sb.WriteByte(e.unstaged)
+		sb.WriteByte(' ')
+
+		if nulTerminated {
+			sb.WriteString(e.path)
+			sb.WriteByte(0)
+			continue
+		}
+
+		if strings.ContainsFunc(e.path, func(r rune) bool { return r == '"' || r == '\\' || r < ' ' || r == 0x7f }) {
+			sb.WriteString(strconv.Quote(e.path))
+		} else {
+			sb.WriteString(e.path)
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
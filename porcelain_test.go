@@ -0,0 +1,70 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectStatusEntries(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("porcelain-test")
+
+	if err := updateConfig("email", "porcelain@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	assert.NoError(t, os.MkdirAll("porcelain-test", 0755))
+	for _, file := range []string{"porcelain-test/same.txt", "porcelain-test/edited.txt", "porcelain-test/deleted.txt", "porcelain-test/staged.txt"} {
+		assert.NoError(t, os.WriteFile(file, []byte(file), 0644))
+		blobHash, err := createObject([]byte(file))
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), file, blobHash))
+	}
+	_, err := createCommit(t.Context(), "base")
+	assert.NoError(t, err)
+
+	// staged, then changed again in the working tree
+	assert.NoError(t, os.WriteFile("porcelain-test/staged.txt", []byte("staged\n"), 0644))
+	blobHash, err := createObject([]byte("staged\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "porcelain-test/staged.txt", blobHash))
+	assert.NoError(t, os.WriteFile("porcelain-test/staged.txt", []byte("changed again\n"), 0644))
+
+	assert.NoError(t, os.WriteFile("porcelain-test/added.txt", []byte("added\n"), 0644))
+	blobHash, err = createObject([]byte("added\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, updateIndex(t.Context(), "porcelain-test/added.txt", blobHash))
+
+	assert.NoError(t, os.WriteFile("porcelain-test/edited.txt", []byte("edited\n"), 0644))
+	assert.NoError(t, os.Remove("porcelain-test/deleted.txt"))
+	assert.NoError(t, os.WriteFile("porcelain-test/new\tfile.txt", []byte("new\n"), 0644))
+
+	entries, err := collectStatusEntries(t.Context())
+	assert.NoError(t, err)
+
+	var ours []statusEntry
+	for _, e := range entries {
+		if strings.HasPrefix(e.path, "porcelain-test/") {
+			ours = append(ours, e)
+		}
+	}
+
+	assert.Equal(t, "A  porcelain-test/added.txt\n"+
+		" D porcelain-test/deleted.txt\n"+
+		" M porcelain-test/edited.txt\n"+
+		"?? \"porcelain-test/new\\tfile.txt\"\n"+
+		"MM porcelain-test/staged.txt\n", formatPorcelainStatus(ours, false))
+
+	assert.Equal(t, "A  porcelain-test/added.txt\x00"+
+		" D porcelain-test/deleted.txt\x00"+
+		" M porcelain-test/edited.txt\x00"+
+		"?? porcelain-test/new\tfile.txt\x00"+
+		"MM porcelain-test/staged.txt\x00", formatPorcelainStatus(ours, true))
+}
@@ -0,0 +1,174 @@
+package mygit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+)
+
+// porcelainErrors is set by the global --porcelain-errors option to report
+// errors on stderr as JSON records instead of text.
+var porcelainErrors = false
+
+// errorRecord is one error reported with --porcelain-errors. Code is one of
+// the codes in errorRules, "merge-conflict", or "error" for anything else;
+// codes never change meaning between versions, though messages may.
+type errorRecord struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Path    string `json:"path,omitempty"` // the file, ref, or revision the error is about
+	Hint    string `json:"hint,omitempty"` // what to do about it
+}
+
+// errorRule gives the code and hint of the errors match recognizes, by
+// the typed errors they wrap, and returns the path they are about. Errors
+// no rule's match recognizes are classified by their message, against
+// pattern, where a "path" group fills in the record's path.
+type errorRule struct {
+	code    string
+	match   func(err error) (string, bool)
+	pattern *regexp.Regexp
+	hint    string
+}
+
+// errorIs returns a match func recognizing the errors that match target.
+func errorIs(target error) func(error) (string, bool) {
+	return func(err error) (string, bool) {
+		return "", errors.Is(err, target)
+	}
+}
+
+// errorRules classify errors, the first match winning.
+var errorRules = []errorRule{
+	{"not-a-repository", errorIs(ErrNotARepository), regexp.MustCompile(`not a ` + vcsName + ` repository`),
+		"run the command inside a repository, or create one with init"},
+	{"merge-in-progress", nil, regexp.MustCompile(`^merge in progress`),
+		"resolve the conflicts and commit first"},
+	{"unresolved-conflicts", func(err error) (string, bool) {
+		var conflict *ConflictError
+		return "", errors.As(err, &conflict)
+	}, regexp.MustCompile(`merge conflicts exist`),
+		"edit the conflicted files, add them, and commit"},
+	{"unstaged-changes", func(err error) (string, bool) {
+		var dirty *DirtyWorktreeError
+		if errors.As(err, &dirty) && dirty.Change == "has been modified" {
+			return dirty.Path, true
+		}
+		return "", false
+	}, regexp.MustCompile(`please stage your changes`),
+		"add or restore the changed files first"},
+	{"uncommitted-changes", func(err error) (string, bool) {
+		var dirty *DirtyWorktreeError
+		if errors.As(err, &dirty) {
+			return dirty.Path, true
+		}
+		return "", errors.Is(err, ErrDirtyWorktree)
+	}, regexp.MustCompile(`please commit your changes|your index has uncommitted changes|^file (?P<path>.+) has uncommitted (changes|deletions)$`),
+		"commit or reset the changes first"},
+	{"pathspec-no-match", nil, regexp.MustCompile(`^pathspec '?(?P<path>.+?)'? did not match any file`),
+		"check the path; untracked and ignored files are not matched by every command"},
+	{"unknown-revision", func(err error) (string, bool) {
+		var revision *RevisionError
+		if errors.As(err, &revision) {
+			return revision.Rev, true
+		}
+		return "", false
+	}, regexp.MustCompile(`^unknown revision: (?P<path>.+)$|^invalid revision (?P<path>\S+):`),
+		"give a branch, tag, or commit hash that exists"},
+	{"locked", nil, regexp.MustCompile(`^(?P<path>.+) exists; another .* process may be running|^(?P<path>.+) is (already )?locked by `),
+		"wait for the other command to finish, or remove the stale lock"},
+	{"missing-identity", func(err error) (string, bool) {
+		var missing *configKeyError
+		return "", errors.As(err, &missing) && missing.key == "email"
+	}, regexp.MustCompile(`user\.email`),
+		"set it with config user.email <address>"},
+	{"not-found", func(err error) (string, bool) {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) && errors.Is(pathErr, fs.ErrNotExist) {
+			return pathErr.Path, true
+		}
+		return "", errors.Is(err, ErrObjectNotFound)
+	}, regexp.MustCompile(`^(branch|ref) (?P<path>\S+) does not exist$|^(?P<path>.+): does not exist in (working directory|index)$|^file (?P<path>.+) is not in the index$`),
+		"check the name"},
+	{"already-exists", nil, regexp.MustCompile(`^(tag|a branch named) (?P<path>\S+) already exists|^(?P<path>.+?):? already exists`),
+		"choose another name or remove the existing one"},
+	{"usage", func(err error) (string, bool) {
+		var exit *exitError
+		return "", errors.As(err, &exit) && exit.code == exitUsage
+	}, regexp.MustCompile(`^usage: |^unknown command: |^expected a valid command$|^please specify only one of `),
+		"check the command's arguments"},
+}
+
+// classifyError turns an error into a record: by the typed errors it
+// wraps, or failing that by its message.
+func classifyError(err error) errorRecord {
+	message := err.Error()
+	record := errorRecord{Code: "error", Message: message}
+
+	for _, rule := range errorRules {
+		if rule.match == nil {
+			continue
+		}
+		if path, ok := rule.match(err); ok {
+			record.Code, record.Path, record.Hint = rule.code, path, rule.hint
+			return record
+		}
+	}
+
+	for _, rule := range errorRules {
+		match := rule.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+
+		record.Code, record.Hint = rule.code, rule.hint
+		for i, name := range rule.pattern.SubexpNames() {
+			if name == "path" && match[i] != "" {
+				record.Path = match[i]
+			}
+		}
+		break
+	}
+
+	return record
+}
+
+// writeErrorRecord writes a record to out as one line of JSON.
+func writeErrorRecord(out io.Writer, record errorRecord) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(record); err != nil {
+		return fmt.Errorf("error writing error record: %w", err)
+	}
+
+	return nil
+}
+
+// reportMergeConflicts writes a merge-conflict record to out for every
+// conflicted path of a merge.
+func reportMergeConflicts(out io.Writer, report *mergeReport) error {
+	for _, path := range report.Paths {
+		if path.Resolution != resolutionConflict {
+			continue
+		}
+
+		kind := path.Kind
+		if kind == "" {
+			kind = conflictContent
+		}
+		err := writeErrorRecord(out, errorRecord{
+			Code:    "merge-conflict",
+			Message: fmt.Sprintf("%s conflict merging %s", kind, report.Branch),
+			Path:    path.Path,
+			Hint:    "edit the file to resolve the conflict, add it, and commit",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package mygit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		message string
+		code    string
+		path    string
+	}{
+		{"error: not a mygit repository", "not-a-repository", ""},
+		{"merge in progress; please resolve conflicts and commit first", "merge-in-progress", ""},
+		{"cannot commit: merge conflicts exist, please resolve them first", "unresolved-conflicts", ""},
+		{"please commit your changes before switching branches", "uncommitted-changes", ""},
+		{"file docs/a.txt has uncommitted changes", "uncommitted-changes", "docs/a.txt"},
+		{"pathspec '*.log' did not match any files", "pathspec-no-match", "*.log"},
+		{"pathspec docs did not match any file known to mygit", "pathspec-no-match", "docs"},
+		{"unknown revision: feature~3", "unknown-revision", "feature~3"},
+		{".mygit/index.lock exists; another mygit process may be running (remove the file if not)", "locked", ".mygit/index.lock"},
+		{"big.psd is already locked by a@example.com", "locked", "big.psd"},
+		{"branch topic does not exist", "not-found", "topic"},
+		{"file notes.txt is not in the index", "not-found", "notes.txt"},
+		{"tag v1.0 already exists", "already-exists", "v1.0"},
+		{"something unexpected happened", "error", ""},
+	}
+
+	// errors that wrap no typed error are classified by their message
+	for _, tt := range tests {
+		record := classifyError(errors.New(tt.message))
+		assert.Equal(t, tt.code, record.Code, tt.message)
+		assert.Equal(t, tt.path, record.Path, tt.message)
+		assert.Equal(t, tt.message, record.Message)
+	}
+}
+
+func TestClassifyTypedError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+		path string
+	}{
+		{fmt.Errorf("error: %w", ErrNotARepository), "not-a-repository", ""},
+		{fmt.Errorf("cannot commit: %w", &ConflictError{Paths: []string{"a.txt"}}), "unresolved-conflicts", ""},
+		{fmt.Errorf("switching: %w", &DirtyWorktreeError{Path: "a.txt", Change: "has uncommitted changes"}), "uncommitted-changes", "a.txt"},
+		{fmt.Errorf("switching: %w", &DirtyWorktreeError{Path: "b.txt", Change: "has been modified"}), "unstaged-changes", "b.txt"},
+		{errorOf(ErrDirtyWorktree, "cannot leave docs out"), "uncommitted-changes", ""},
+		{fmt.Errorf("resolving: %w", &RevisionError{Rev: "nope"}), "unknown-revision", "nope"},
+		{fmt.Errorf("reading: %w", ErrObjectNotFound), "not-found", ""},
+		{fmt.Errorf("adding: %w", &fs.PathError{Op: "stat", Path: "nope", Err: fs.ErrNotExist}), "not-found", "nope"},
+		{fmt.Errorf("please set user.email: %w", &configKeyError{key: "email"}), "missing-identity", ""},
+		{&configKeyError{key: "algorithm"}, "error", ""},
+		{usageError("cat-file takes one mode"), "usage", ""},
+	}
+
+	for _, tt := range tests {
+		record := classifyError(tt.err)
+		assert.Equal(t, tt.code, record.Code, tt.err.Error())
+		assert.Equal(t, tt.path, record.Path, tt.err.Error())
+		assert.Equal(t, tt.err.Error(), record.Message)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	var out bytes.Buffer
+	reportError(&out, errors.New("tag v1.0 already exists"))
+	assert.Equal(t, "tag v1.0 already exists\n", out.String())
+
+	out.Reset()
+	porcelainErrors = true
+	defer func() { porcelainErrors = false }()
+
+	reportError(&out, quietExit(exitConflict))
+	assert.Empty(t, out.String())
+
+	reportError(&out, errors.New("tag v1.0 already exists"))
+	assert.Equal(t, `{"code":"already-exists","message":"tag v1.0 already exists","path":"v1.0","hint":"choose another name or remove the existing one"}`+"\n", out.String())
+
+	out.Reset()
+	err := reportMergeConflicts(&out, &mergeReport{Branch: "topic", Paths: []pathResolution{
+		{Path: "a.txt", Resolution: resolutionOurs},
+		{Path: "b.txt", Resolution: resolutionConflict},
+		{Path: "c~topic", Resolution: resolutionConflict, Kind: conflictFileDirectory},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"code":"merge-conflict","message":"content conflict merging topic","path":"b.txt","hint":"edit the file to resolve the conflict, add it, and commit"}`+"\n"+
+		`{"code":"merge-conflict","message":"file/directory conflict merging topic","path":"c~topic","hint":"edit the file to resolve the conflict, add it, and commit"}`+"\n", out.String())
+}
@@ -0,0 +1,443 @@
+package mygit
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// refDateLayout is the default format of date placeholders.
+const refDateLayout = "Mon Jan 2 15:04:05 2006 -0700"
+
+// refInfo is a ref being listed, with what its placeholders are filled from.
+type refInfo struct {
+	refPath string
+	hash    []byte       // nil for a branch without commits
+	objType string       // type of the object hash names
+	commit  commitObject // zero unless the ref points at a commit
+	date    time.Time
+	head    bool // the current branch
+}
+
+// refLister fills in ref placeholders. It remembers the config and the
+// refs it resolved so listing many refs reads each only once.
+type refLister struct {
+	config   map[string]string
+	resolved map[string][]byte // ahead-behind bases by name
+}
+
+// newRefLister prepares a refLister for the current repository.
+func newRefLister() (*refLister, error) {
+	config, err := readConfigEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	return &refLister{config: config, resolved: make(map[string][]byte)}, nil
+}
+
+// collectRefs returns the refs under each of dirs whose short names match
+// one of patterns, or all of them when patterns is empty.
+func collectRefs(ctx context.Context, dirs []string, patterns []string) ([]refInfo, error) {
+	return collectMatchingRefs(ctx, dirs, func(refPath string) bool {
+		return matchesRefPatterns(shortRefName(refPath), patterns)
+	})
+}
+
+// collectMatchingRefs returns the refs under each of dirs for which match
+// returns true. File locks kept under refs/locks are not refs and are
+// never returned.
+func collectMatchingRefs(ctx context.Context, dirs []string, match func(refPath string) bool) ([]refInfo, error) {
+	currentBranch := ""
+	if head, err := getHEAD(); err == nil {
+		currentBranch = head
+	}
+
+	var refs []refInfo
+	for _, dir := range dirs {
+		names, err := listRefNames(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			refPath := dir + "/" + name
+			if strings.HasPrefix(refPath, "refs/locks/") || !match(refPath) {
+				continue
+			}
+
+			ref, err := loadRefInfo(refPath)
+			if err != nil {
+				return nil, err
+			}
+			ref.head = refPath == currentBranch
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// loadRefInfo reads the ref, the type of the object it names, and, when
+// that is a commit, the commit.
+func loadRefInfo(refPath string) (refInfo, error) {
+	ref := refInfo{refPath: refPath}
+
+	hash, err := readRefIfExists(refPath)
+	if err != nil {
+		return ref, err
+	}
+	ref.hash = hash
+	if hash == nil {
+		return ref, nil
+	}
+
+	// a tag may name a tree or a blob, which has no date
+	obj, err := catFile(hash)
+	if err != nil {
+		return ref, err
+	}
+	switch obj := obj.(type) {
+	case commitObject:
+		ref.objType = "commit"
+		ref.commit = obj
+		_, ref.date = splitIdent(obj.committer)
+	case treeObject:
+		ref.objType = "tree"
+	case blobObject:
+		ref.objType = "blob"
+	}
+
+	return ref, nil
+}
+
+// matchesRefPatterns reports whether name matches one of the shell
+// patterns, or whether patterns is empty. A pattern also matches every ref
+// in the namespace it names, so "feature" matches "feature/x".
+func matchesRefPatterns(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if strings.HasPrefix(name, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shortRefName strips the refs/heads/, refs/tags/, or refs/ prefix.
+func shortRefName(refPath string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/"} {
+		if name, ok := strings.CutPrefix(refPath, prefix); ok {
+			return name
+		}
+	}
+
+	return refPath
+}
+
+// upstream returns the ref path configured as the upstream of a branch,
+// set with "config branch.<name>.merge <ref>", or "" if there is none.
+func (l *refLister) upstream(ref refInfo) string {
+	name, ok := strings.CutPrefix(ref.refPath, "refs/heads/")
+	if !ok {
+		return ""
+	}
+
+	upstream := l.config[name+".merge"]
+	if upstream != "" && !strings.HasPrefix(upstream, "refs/") {
+		upstream = "refs/heads/" + upstream
+	}
+
+	return upstream
+}
+
+// aheadBehindRev counts the commits of ref ahead of and behind rev. ok is
+// false when either side has no commit.
+func (l *refLister) aheadBehindRev(ctx context.Context, ref refInfo, rev string) (int, int, bool, error) {
+	base, seen := l.resolved[rev]
+	if !seen {
+		var err error
+		if strings.HasPrefix(rev, "refs/") {
+			base, err = readRefIfExists(rev)
+		} else {
+			base, err = resolveRevision(rev)
+		}
+		if err != nil {
+			return 0, 0, false, err
+		}
+		l.resolved[rev] = base
+	}
+
+	if ref.commit.hash == nil || base == nil {
+		return 0, 0, false, nil
+	}
+
+	ahead, behind, err := aheadBehind(ctx, ref.hash, base)
+	return ahead, behind, err == nil, err
+}
+
+// expandRefFormat fills in the %(atom) placeholders of format for ref. "%%"
+// is a literal percent sign.
+func (l *refLister) expandRefFormat(ctx context.Context, format string, ref refInfo) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+
+		rest := format[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "%"):
+			sb.WriteByte('%')
+			i++
+		case strings.HasPrefix(rest, "("):
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				return "", fmt.Errorf("malformed format string: unclosed %%(%s", rest[1:])
+			}
+
+			value, err := l.refAtom(ctx, rest[1:end], ref)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i += end + 1
+		default:
+			sb.WriteByte('%')
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// refAtom returns the value of one placeholder, written "name" or
+// "name:modifier".
+func (l *refLister) refAtom(ctx context.Context, atom string, ref refInfo) (string, error) {
+	name, modifier, _ := strings.Cut(atom, ":")
+
+	switch name {
+	case "refname":
+		switch modifier {
+		case "":
+			return ref.refPath, nil
+		case "short":
+			return shortRefName(ref.refPath), nil
+		}
+		if n, ok := strings.CutPrefix(modifier, "lstrip="); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return "", fmt.Errorf("invalid %%(refname) modifier: %s", modifier)
+			}
+			parts := strings.Split(ref.refPath, "/")
+			return strings.Join(parts[min(count, len(parts)):], "/"), nil
+		}
+
+	case "objectname":
+		if ref.hash == nil {
+			return "", nil
+		}
+		switch modifier {
+		case "":
+			return fmt.Sprintf("%x", ref.hash), nil
+		case "short":
+			return abbrevHash(ref.hash), nil
+		}
+
+	case "objecttype":
+		if modifier == "" {
+			return ref.objType, nil
+		}
+
+	case "subject":
+		if modifier == "" {
+			return commitSubject(ref.commit), nil
+		}
+
+	case "committerdate":
+		if ref.commit.hash == nil {
+			return "", nil
+		}
+		switch modifier {
+		case "":
+			return ref.date.Format(refDateLayout), nil
+		case "unix":
+			return strconv.FormatInt(ref.date.Unix(), 10), nil
+		case "iso":
+			return ref.date.Format("2006-01-02 15:04:05 -0700"), nil
+		}
+
+	case "HEAD":
+		if modifier == "" {
+			if ref.head {
+				return "*", nil
+			}
+			return " ", nil
+		}
+
+	case "upstream":
+		upstream := l.upstream(ref)
+		switch modifier {
+		case "":
+			return upstream, nil
+		case "short":
+			return shortRefName(upstream), nil
+		case "track", "trackshort":
+			if upstream == "" {
+				return "", nil
+			}
+			return l.trackingSummary(ctx, ref, upstream, modifier == "trackshort")
+		}
+
+	case "ahead-behind":
+		if modifier == "" {
+			return "", fmt.Errorf("%%(ahead-behind) requires a commit: %%(ahead-behind:<commit>)")
+		}
+		ahead, behind, ok, err := l.aheadBehindRev(ctx, ref, modifier)
+		if err != nil || !ok {
+			return "", err
+		}
+		return fmt.Sprintf("%d %d", ahead, behind), nil
+
+	default:
+		return "", fmt.Errorf("unknown field name: %s", name)
+	}
+
+	return "", fmt.Errorf("unknown %%(%s) modifier: %s", name, modifier)
+}
+
+// trackingSummary describes how a branch relates to its upstream:
+// "[ahead 1, behind 2]", or with short, "<", ">", "<>", or "=".
+func (l *refLister) trackingSummary(ctx context.Context, ref refInfo, upstream string, short bool) (string, error) {
+	exists, err := refExists(upstream)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		if short {
+			return "", nil
+		}
+		return "[gone]", nil
+	}
+
+	ahead, behind, ok, err := l.aheadBehindRev(ctx, ref, upstream)
+	if err != nil || !ok {
+		return "", err
+	}
+
+	if short {
+		switch {
+		case ahead > 0 && behind > 0:
+			return "<>", nil
+		case ahead > 0:
+			return ">", nil
+		case behind > 0:
+			return "<", nil
+		}
+		return "=", nil
+	}
+
+	var parts []string
+	if ahead > 0 {
+		parts = append(parts, fmt.Sprintf("ahead %d", ahead))
+	}
+	if behind > 0 {
+		parts = append(parts, fmt.Sprintf("behind %d", behind))
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+
+	return "[" + strings.Join(parts, ", ") + "]", nil
+}
+
+// sortRefs orders refs by the given keys. A key prefixed with "-" sorts in
+// descending order. As with repeated --sort options in git, the last key
+// is the primary one and earlier keys break its ties.
+func (l *refLister) sortRefs(refs []refInfo, keys []string) error {
+	for _, key := range keys {
+		field, descending := strings.CutPrefix(key, "-")
+
+		var compare func(a, b refInfo) int
+		switch field {
+		case "refname":
+			compare = func(a, b refInfo) int { return strings.Compare(a.refPath, b.refPath) }
+		case "objectname":
+			compare = func(a, b refInfo) int { return slices.Compare(a.hash, b.hash) }
+		case "committerdate":
+			compare = func(a, b refInfo) int { return a.date.Compare(b.date) }
+		case "upstream":
+			compare = func(a, b refInfo) int { return cmp.Compare(l.upstream(a), l.upstream(b)) }
+		default:
+			return fmt.Errorf("unsupported sort key: %s", key)
+		}
+
+		slices.SortStableFunc(refs, func(a, b refInfo) int {
+			if descending {
+				return compare(b, a)
+			}
+			return compare(a, b)
+		})
+	}
+
+	return nil
+}
+
+// printRefs prints each ref with format, after sorting by keys. A positive
+// count stops after that many refs.
+func printRefs(ctx context.Context, refs []refInfo, format string, keys []string, count int) error {
+	lister, err := newRefLister()
+	if err != nil {
+		return err
+	}
+
+	if err := lister.sortRefs(refs, keys); err != nil {
+		return err
+	}
+	if count > 0 && count < len(refs) {
+		refs = refs[:count]
+	}
+
+	for _, ref := range refs {
+		line, err := lister.expandRefFormat(ctx, format, ref)
+		if err != nil {
+			return err
+		}
+		fmt.Println(line)
+	}
+
+	return nil
+}
+
+// forEachRef returns every ref that names an object and matches one of
+// patterns, by default sorted by name. Patterns are matched against the
+// full ref name: "refs/tags" selects every tag, and shell globs such as
+// "refs/heads/feature/*" match within one level.
+func forEachRef(ctx context.Context, patterns []string) ([]refInfo, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	refs, err := collectMatchingRefs(ctx, []string{"refs"}, func(refPath string) bool {
+		return matchesRefPatterns(refPath, patterns)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// branches without commits do not name an object yet
+	return slices.DeleteFunc(refs, func(ref refInfo) bool { return ref.hash == nil }), nil
+}
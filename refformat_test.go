@@ -0,0 +1,121 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefFormat(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "refs@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	blobHash, err := createObject([]byte("content\n"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{"file.txt": blobHash})
+	assert.NoError(t, err)
+	base, err := writeCommitObject(treeHash, nil, "base")
+	assert.NoError(t, err)
+	feature, err := writeCommitObject(treeHash, [][]byte{base}, "Add feature\n\nDetails.")
+	assert.NoError(t, err)
+
+	head, err := getHEAD()
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef(head, base))
+	assert.NoError(t, createBranch("feature/login", feature))
+	assert.NoError(t, createBranch("feature/gone", base))
+	assert.NoError(t, updateConfig("feature/login.merge", shortRefName(head)))
+	assert.NoError(t, updateConfig("feature/gone.merge", "refs/heads/missing"))
+
+	// branches in a namespace are listed by their full short name
+	refs, err := collectRefs(t.Context(), []string{"refs/heads"}, []string{"feature"})
+	assert.NoError(t, err)
+
+	lister, err := newRefLister()
+	assert.NoError(t, err)
+	assert.NoError(t, lister.sortRefs(refs, []string{"-refname"}))
+
+	format := "%(HEAD)%(refname:short) %(refname:lstrip=2) %(upstream:short) %(upstream:track)%(upstream:trackshort) %(subject) %%"
+	var lines []string
+	for _, ref := range refs {
+		line, err := lister.expandRefFormat(t.Context(), format, ref)
+		assert.NoError(t, err)
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{
+		" feature/login feature/login " + shortRefName(head) + " [ahead 1]> Add feature %",
+		" feature/gone feature/gone missing [gone] base %",
+	}, lines)
+
+	ref := refs[0]
+	line, err := lister.expandRefFormat(t.Context(), "%(objectname) %(ahead-behind:"+shortRefName(head)+") %(committerdate:unix)", ref)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x 1 0 0", feature), line)
+
+	_, err = lister.expandRefFormat(t.Context(), "%(nosuchfield)", ref)
+	assert.Error(t, err)
+	assert.Error(t, lister.sortRefs(refs, []string{"nosuchkey"}))
+
+	// tags are never moved once created
+	assert.NoError(t, createTag("release/v1", base))
+	assert.Error(t, createTag("release/v1", feature))
+	tags, err := collectRefs(t.Context(), []string{"refs/tags"}, []string{"release/*"})
+	assert.NoError(t, err)
+	assert.Len(t, tags, 1)
+	assert.Equal(t, "refs/tags/release/v1", tags[0].refPath)
+	assert.Equal(t, base, tags[0].hash)
+}
+
+func TestForEachRef(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "refs@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	blobHash, err := createObject([]byte("content\n"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{"file.txt": blobHash})
+	assert.NoError(t, err)
+	commitHash, err := writeCommitObject(treeHash, nil, "base")
+	assert.NoError(t, err)
+
+	assert.NoError(t, createBranch("topic", commitHash))
+	assert.NoError(t, createTag("v1", commitHash))
+	assert.NoError(t, updateRef("refs/snapshots/topic", commitHash))
+	assert.NoError(t, createTag("tree", treeHash))
+
+	// main has no commits yet and is left out
+	refs, err := forEachRef(t.Context(), nil)
+	assert.NoError(t, err)
+
+	lister, err := newRefLister()
+	assert.NoError(t, err)
+	var lines []string
+	for _, ref := range refs {
+		line, err := lister.expandRefFormat(t.Context(), "%(objecttype) %(refname)", ref)
+		assert.NoError(t, err)
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{
+		"commit refs/heads/topic",
+		"commit refs/snapshots/topic",
+		"tree refs/tags/tree",
+		"commit refs/tags/v1",
+	}, lines)
+
+	refs, err = forEachRef(t.Context(), []string{"refs/tags", "refs/heads/t*"})
+	assert.NoError(t, err)
+	assert.Len(t, refs, 3)
+}
@@ -1,11 +1,14 @@
-package main
+package mygit
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -13,12 +16,16 @@ import (
 
 // Conflict represents a merge conflict for a file between two branches.
 type Conflict struct {
+	Kind         conflictKind
 	BaseHash     []byte
 	OurHash      []byte
 	TheirHash    []byte
 	OurContent   []byte
 	TheirContent []byte
 	BranchName   string
+	MovedFrom    string // structural conflicts: where the moved file belonged
+	KeptPath     string // structural conflicts: the path that kept its place
+	Binary       bool   // content conflicts: our version is kept, without markers
 }
 
 // readBlobFunc is a function type for reading blob content given its hash.
@@ -33,24 +40,47 @@ const (
 	resetModeHard
 )
 
-// getHEAD reads the HEAD file to get the current branch reference.
+// detachedHead is the ref getHEAD returns when HEAD holds a commit id
+// instead of naming a branch. getRef and updateRef read and move HEAD
+// itself then, so commits on a detached HEAD advance it.
+const detachedHead = "HEAD"
+
+// getHEAD reads the HEAD file to get the current branch reference, or
+// detachedHead if HEAD is detached.
 func getHEAD() (string, error) {
 	if err := checkVCSRepo(); err != nil {
 		return "", err
 	}
 
-	headPath := fmt.Sprintf(".%s/HEAD", vcsName)
+	headPath := fmt.Sprintf("%s/HEAD", gitDir)
 	content, err := os.ReadFile(headPath)
 	if err != nil {
-		return "", fmt.Errorf("error reading HEAD file: %v", err)
+		return "", fmt.Errorf("error reading HEAD file: %w", err)
 	}
 
 	if after, ok := strings.CutPrefix(string(content), "ref: "); ok {
 		return strings.TrimSpace(after), nil
-	} else {
-		// detached HEAD state (not handled...)
-		return "", fmt.Errorf("error detached HEAD state not supported")
 	}
+	if _, err := hex.DecodeString(strings.TrimSpace(string(content))); err != nil {
+		return "", fmt.Errorf("invalid HEAD file: %q", content)
+	}
+
+	return detachedHead, nil
+}
+
+// refFilePath returns the file a ref is stored in: HEAD in the current
+// worktree's metadata directory, other refs in the shared one.
+func refFilePath(refPath string) string {
+	if refPath == detachedHead {
+		return fmt.Sprintf("%s/HEAD", gitDir)
+	}
+
+	return fmt.Sprintf("%s/%s", commonDir, refPath)
+}
+
+// detachHead points HEAD at commitHash instead of a branch.
+func detachHead(commitHash []byte) error {
+	return updateRef(detachedHead, commitHash)
 }
 
 // getRef reads the given ref file and returns the hash it points to.
@@ -59,10 +89,20 @@ func getRef(refPath string) ([]byte, error) {
 		return nil, err
 	}
 
-	fullRefPath := fmt.Sprintf(".%s/%s", vcsName, refPath)
+	fullRefPath := refFilePath(refPath)
 	content, err := os.ReadFile(fullRefPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// fall back to packed-refs
+		packed, packedErr := readPackedRefs()
+		if packedErr != nil {
+			return nil, packedErr
+		}
+		if hash, ok := packed[refPath]; ok {
+			return hash, nil
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error reading ref file %s: %v", refPath, err)
+		return nil, fmt.Errorf("error reading ref file %s: %w", refPath, err)
 	}
 
 	if len(content) == 0 {
@@ -71,48 +111,170 @@ func getRef(refPath string) ([]byte, error) {
 
 	hash, err := hex.DecodeString(strings.TrimSpace(string(content)))
 	if err != nil {
-		return nil, fmt.Errorf("error decoding ref hash from %s: %v", refPath, err)
+		return nil, fmt.Errorf("error decoding ref hash from %s: %w", refPath, err)
 	}
 
 	return hash, nil
 }
 
+// checkRefName rejects a ref name, relative to its namespace such as
+// refs/heads, that could name a file outside it or one git would refuse:
+// an empty, "." or ".." component (which a leading or trailing slash or
+// "//" also gives), a component ending in ".lock", or a backslash.
+func checkRefName(name string) error {
+	if strings.Contains(name, "\\") {
+		return fmt.Errorf("invalid ref name %q: contains a backslash", name)
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		switch {
+		case component == "" || component == "." || component == "..":
+			return fmt.Errorf("invalid ref name %q: invalid component %q", name, component)
+		case strings.HasSuffix(component, ".lock"):
+			return fmt.Errorf("invalid ref name %q: a component ends in .lock", name)
+		}
+	}
+
+	return nil
+}
+
 // updateRef updates the given ref file with the new hash.
 func updateRef(refPath string, hash []byte) error {
+	return writeRef(refPath, hash, nil, false)
+}
+
+// compareAndSwapRef updates the ref only if it still points at oldHash.
+// A nil oldHash expects the ref to be missing or to have no commits.
+func compareAndSwapRef(refPath string, oldHash, newHash []byte) error {
+	return writeRef(refPath, newHash, oldHash, true)
+}
+
+// writeRef writes the ref through a <ref>.lock file that is renamed into
+// place, so readers never see a partial value and concurrent writers fail
+// instead of overwriting each other. If verify is set, the current value
+// must equal expected while the lock is held.
+func writeRef(refPath string, hash, expected []byte, verify bool) error {
 	if err := checkVCSRepo(); err != nil {
 		return err
 	}
 
-	fullRefPath := fmt.Sprintf(".%s/%s", vcsName, refPath)
-	hexHash := fmt.Sprintf("%x", hash)
-	err := os.WriteFile(fullRefPath, []byte(hexHash), 0644)
+	fullRefPath := refFilePath(refPath)
+
+	// refs in a namespace such as refs/heads/feature/ need its directory
+	if err := os.MkdirAll(filepath.Dir(fullRefPath), 0755); err != nil {
+		return fmt.Errorf("error updating ref %s: %w", refPath, err)
+	}
+	if err := adjustSharedPerm(filepath.Dir(fullRefPath)); err != nil {
+		return err
+	}
+
+	lock, err := acquireLockFile(fullRefPath)
 	if err != nil {
-		return fmt.Errorf("error writing ref file %s: %v", refPath, err)
+		return fmt.Errorf("error updating ref %s: %w", refPath, err)
+	}
+	defer lock.release()
+
+	if verify {
+		current, err := readRefIfExists(refPath)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Equal(current, expected) {
+			return errorOf(ErrConflict, "ref %s was updated concurrently: expected %s, found %s",
+				refPath, describeRefValue(expected), describeRefValue(current))
+		}
+	}
+
+	if _, err := fmt.Fprintf(lock.file, "%x", hash); err != nil {
+		return fmt.Errorf("error writing ref file %s: %w", refPath, err)
+	}
+
+	if err := lock.commit(); err != nil {
+		return fmt.Errorf("error writing ref file %s: %w", refPath, err)
 	}
 
 	return nil
 }
 
-// getBranches returns a list of all branch names.
-func getBranches() ([]string, error) {
-	if err := checkVCSRepo(); err != nil {
+// readRefIfExists returns the hash of a ref, or nil if it does not exist.
+func readRefIfExists(refPath string) ([]byte, error) {
+	exists, err := refExists(refPath)
+	if err != nil || !exists {
 		return nil, err
 	}
 
-	branchesDir := fmt.Sprintf(".%s/refs/heads", vcsName)
-	entries, err := os.ReadDir(branchesDir)
-	if err != nil {
-		return nil, fmt.Errorf("error reading heads directory: %v", err)
+	return getRef(refPath)
+}
+
+// describeRefValue formats a ref value for error messages.
+func describeRefValue(hash []byte) string {
+	if hash == nil {
+		return "no commit"
 	}
 
-	var branches []string
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			branches = append(branches, entry.Name())
+	return fmt.Sprintf("%x", hash)
+}
+
+// fileLock is an exclusively created <path>.lock file that replaces path
+// when committed.
+type fileLock struct {
+	path string // the file being replaced
+	file *os.File
+	done bool
+}
+
+// acquireLockFile creates <path>.lock, failing if it already exists.
+func acquireLockFile(path string) (*fileLock, error) {
+	lockPath := path + ".lock"
+
+	f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%s exists; another %s process may be running (remove the file if not)", lockPath, vcsName)
 		}
+		return nil, fmt.Errorf("error creating %s: %w", lockPath, err)
+	}
+
+	return &fileLock{path: path, file: f}, nil
+}
+
+// commit closes the lock file and renames it over the locked path.
+func (l *fileLock) commit() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	if err := adjustSharedPerm(l.file.Name()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(l.file.Name(), l.path); err != nil {
+		return err
+	}
+
+	l.done = true
+	return nil
+}
+
+// release removes the lock file unless it was committed.
+func (l *fileLock) release() {
+	if l.done {
+		return
+	}
+
+	l.file.Close()
+	os.Remove(l.file.Name())
+	l.done = true
+}
+
+// getBranches returns a list of all branch names.
+func getBranches(ctx context.Context) ([]string, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
 	}
 
-	return branches, nil
+	return listRefNames(ctx, "refs/heads")
 }
 
 // getCurrentBranch returns the name of the current branch.
@@ -122,7 +284,7 @@ func getCurrentBranch() (string, error) {
 		return "", err
 	}
 
-	return filepath.Base(head), nil
+	return strings.TrimPrefix(head, "refs/heads/"), nil
 }
 
 // createBranch creates a new branch with the given name at the specified commit hash.
@@ -131,10 +293,37 @@ func createBranch(branchName string, commitHash []byte) error {
 		return err
 	}
 
+	if isLockFileName(branchName) {
+		return fmt.Errorf("invalid branch name %s: names ending in .lock are reserved", branchName)
+	}
+
 	branchRefPath := fmt.Sprintf("refs/heads/%s", branchName)
 	return updateRef(branchRefPath, commitHash)
 }
 
+// createTag creates a lightweight tag with the given name at the specified
+// commit hash. Unlike branches, existing tags are never moved.
+func createTag(tagName string, commitHash []byte) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	if isLockFileName(tagName) {
+		return fmt.Errorf("invalid tag name %s: names ending in .lock are reserved", tagName)
+	}
+
+	tagRefPath := fmt.Sprintf("refs/tags/%s", tagName)
+	existing, err := readRefIfExists(tagRefPath)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("tag %s already exists", tagName)
+	}
+
+	return compareAndSwapRef(tagRefPath, nil, commitHash)
+}
+
 // checkoutBranch switches the current branch to branchName
 // and updates the working directory to match the branch's latest commit.
 func checkoutBranch(branchName string) error {
@@ -143,24 +332,58 @@ func checkoutBranch(branchName string) error {
 	}
 
 	// verify if branch exists
-	branchRefPath := fmt.Sprintf(".%s/refs/heads/%s", vcsName, branchName)
-	if _, err := os.Stat(branchRefPath); errors.Is(err, fs.ErrNotExist) {
+	exists, err := refExists(fmt.Sprintf("refs/heads/%s", branchName))
+	if err != nil {
+		return err
+	}
+	if !exists {
 		return fmt.Errorf("branch %s does not exist", branchName)
 	}
 
 	// update HEAD
-	headPath := fmt.Sprintf(".%s/HEAD", vcsName)
+	headPath := fmt.Sprintf("%s/HEAD", gitDir)
 	newRef := fmt.Sprintf("ref: refs/heads/%s", branchName)
 	if err := os.WriteFile(headPath, []byte(newRef), 0644); err != nil {
-		return fmt.Errorf("error updating HEAD: %v", err)
+		return fmt.Errorf("error updating HEAD: %w", err)
 	}
 
 	return nil
 }
 
 // buildIndexFromTree builds an index map from the given tree hash
-// and writes files to the working directory if write is true.
-func buildIndexFromTree(treeHash []byte, dirPath string, write bool) (map[string][]byte, error) {
+// and writes files to the working directory if write is true, with their
+// line endings converted for the working tree. Files outside the
+// sparse-checkout cone are never written.
+func buildIndexFromTree(ctx context.Context, treeHash []byte, dirPath string, write bool) (map[string][]byte, error) {
+	return restoreTree(ctx, treeHash, dirPath, write)
+}
+
+// restoreTree is buildIndexFromTree stopping with ctx's error once it is
+// done, so a canceled checkout leaves the rest of the tree unwritten.
+func restoreTree(ctx context.Context, treeHash []byte, dirPath string, write bool) (map[string][]byte, error) {
+	var cone sparseCone
+	var conv contentConversion
+	if write {
+		var err error
+		if cone, err = loadSparseCone(); err != nil {
+			return nil, err
+		}
+		if dirPath == "" {
+			conv, err = loadTreeContentConversion(treeHash)
+		} else {
+			conv, err = loadContentConversion()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buildConeIndexFromTree(ctx, treeHash, dirPath, write, cone, conv)
+}
+
+// buildConeIndexFromTree is restoreTree with the cone and line-ending
+// conversion loaded.
+func buildConeIndexFromTree(ctx context.Context, treeHash []byte, dirPath string, write bool, cone sparseCone, conv contentConversion) (map[string][]byte, error) {
 	index := make(map[string][]byte)
 
 	obj, err := catFile(treeHash) // treeHash is already binary
@@ -174,7 +397,16 @@ func buildIndexFromTree(treeHash []byte, dirPath string, write bool) (map[string
 	}
 
 	for _, entry := range tree.entries {
-		entryPath := filepath.Join(dirPath, entry.name)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// a tree can come from anywhere; its names must not escape the working tree
+		if err := checkPathName(entry.name); err != nil {
+			return nil, fmt.Errorf("tree %x: %w", treeHash, err)
+		}
+		entryPath := path.Join(dirPath, entry.name)
+		diskPath := filepath.FromSlash(entryPath)
 
 		switch entry.objType {
 		case "blob":
@@ -190,17 +422,17 @@ func buildIndexFromTree(treeHash []byte, dirPath string, write bool) (map[string
 			}
 
 			// write to disk if needed
-			if write {
+			if write && cone.contains(entryPath) {
 				// create parent directories if needed
-				if dir := filepath.Dir(entryPath); dir != "." {
-					if err := os.MkdirAll(dir, 0755); err != nil {
-						return nil, fmt.Errorf("error creating directory %s: %v", dir, err)
+				if dir := filepath.Dir(diskPath); dir != "." {
+					if err := os.MkdirAll(workTreePath(dir), workTreeDirMode); err != nil {
+						return nil, fmt.Errorf("error creating directory %s: %w", dir, err)
 					}
 				}
 
 				// write file content
-				if err := os.WriteFile(entryPath, blob.content, 0644); err != nil {
-					return nil, fmt.Errorf("error writing file %s: %v", entryPath, err)
+				if err := conv.writeWorkTreeFile(ctx, entryPath, diskPath, blob.content); err != nil {
+					return nil, err
 				}
 			}
 
@@ -208,7 +440,7 @@ func buildIndexFromTree(treeHash []byte, dirPath string, write bool) (map[string
 			index[entryPath] = entry.hash // hash is already binary
 		case "tree":
 			// restore sub-tree (hash is already binary)
-			subIndex, err := buildIndexFromTree(entry.hash, entryPath, write)
+			subIndex, err := buildConeIndexFromTree(ctx, entry.hash, entryPath, write, cone, conv)
 			if err != nil {
 				return nil, err
 			}
@@ -217,6 +449,15 @@ func buildIndexFromTree(treeHash []byte, dirPath string, write bool) (map[string
 			for k, v := range subIndex {
 				index[k] = v
 			}
+		case "commit":
+			// submodule: the nested repository is restored by submodule update
+			if write && cone.contains(entryPath) {
+				if err := os.MkdirAll(workTreePath(diskPath), workTreeDirMode); err != nil {
+					return nil, fmt.Errorf("error creating directory %s: %w", entryPath, err)
+				}
+			}
+
+			index[entryPath] = entry.hash
 		}
 	}
 
@@ -226,10 +467,21 @@ func buildIndexFromTree(treeHash []byte, dirPath string, write bool) (map[string
 // removeObsoleteFiles removes files from the working directory that are present in the
 // old index but not in the new index.
 func removeObsoleteFiles(oldIndex, newIndex map[string][]byte) error {
-	for filepath := range oldIndex {
-		if _, exists := newIndex[filepath]; !exists {
-			if err := os.Remove(filepath); err != nil {
-				return fmt.Errorf("error removing obsolete file %s: %v", filepath, err)
+	for path := range oldIndex {
+		if _, exists := newIndex[path]; !exists {
+			if isNestedRepository(path) {
+				continue // a submodule's checkout is never deleted
+			}
+			if err := os.Remove(workTreePath(path)); err != nil {
+				return fmt.Errorf("error removing obsolete file %s: %w", path, err)
+			}
+
+			// only succeeds once the directory is empty, making room
+			// for a file of the same name
+			for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+				if os.Remove(workTreePath(dir)) != nil {
+					break
+				}
 			}
 		}
 	}
@@ -238,50 +490,15 @@ func removeObsoleteFiles(oldIndex, newIndex map[string][]byte) error {
 }
 
 // checkoutCommit checks out the working directory to match the state
-// of the given commit hash.
-func checkoutCommit(commitHash []byte) error {
-	obj, err := catFile(commitHash) // commitHash is already binary
-	if err != nil {
-		return err
-	}
-
-	commit, ok := obj.(commitObject)
-	if !ok {
-		return fmt.Errorf("object %x is not a commit", commitHash)
-	}
-
-	// retrieve the tree object hash (already binary)
-	treeHash := commit.hash
-
-	// read the old index
-	oldIndex, err := readIndex()
-	if err != nil {
-		return fmt.Errorf("error reading old index: %v", err)
-	}
-
-	// restore the working dir from tree
-	index, err := buildIndexFromTree(treeHash, "", true)
-	if err != nil {
-		return fmt.Errorf("error restoring tree: %v", err)
-	}
-
-	// update the index file
-	err = writeIndex(index)
-	if err != nil {
-		return fmt.Errorf("error updating index: %v", err)
-	}
-
-	// remove files not in the new index
-	if err := removeObsoleteFiles(oldIndex, index); err != nil {
-		return fmt.Errorf("error removing non-indexed files: %v", err)
-	}
-
-	return nil
+// of the given commit hash. The checkout is journaled, so an interrupted
+// checkout can be finished or rolled back.
+func checkoutCommit(ctx context.Context, commitHash []byte) error {
+	return checkoutJournaled(ctx, commitHash, "")
 }
 
 // checkUncommittedChanges checks if there are any uncommitted changes in the working directory
-func checkUncommittedChanges() error {
-	index, err := readIndex()
+func checkUncommittedChanges(ctx context.Context) error {
+	index, err := readIndex(ctx)
 	if err != nil {
 		return err
 	}
@@ -310,23 +527,23 @@ func checkUncommittedChanges() error {
 	commitTreeHash := commit.hash
 
 	// build index from commit tree without writing files
-	commitIndex, err := buildIndexFromTree(commitTreeHash, "", false)
+	commitIndex, err := buildIndexFromTree(ctx, commitTreeHash, "", false)
 	if err != nil {
-		return fmt.Errorf("error building index from commit tree: %v", err)
+		return fmt.Errorf("error building index from commit tree: %w", err)
 	}
 
 	// check for staged changes
 	for path, storedHash := range index {
 		commitHash, exists := commitIndex[path]
 		if !exists || !slices.Equal(storedHash, commitHash) {
-			return fmt.Errorf("file %s has uncommitted changes", path)
+			return &DirtyWorktreeError{Path: path, Change: "has uncommitted changes"}
 		}
 	}
 
 	// check for staged deletions
 	for path := range commitIndex {
 		if _, exists := index[path]; !exists {
-			return fmt.Errorf("file %s has uncommitted deletions", path)
+			return &DirtyWorktreeError{Path: path, Change: "has uncommitted deletions"}
 		}
 	}
 
@@ -334,21 +551,50 @@ func checkUncommittedChanges() error {
 }
 
 // checkUnstagedChanges checks if there's any unstaged changes in the working directory
-func checkUnstagedChanges() error {
-	index, err := readIndex()
+func checkUnstagedChanges(ctx context.Context) error {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return err
+	}
+	cone, err := loadSparseCone()
+	if err != nil {
+		return err
+	}
+	conv, err := loadContentConversion()
 	if err != nil {
 		return err
 	}
 
 	for targetPath, storedHash := range index {
-		content, err := os.ReadFile(targetPath)
+		if !cone.contains(targetPath) {
+			continue // not checked out
+		}
+
+		if gitlinks[targetPath] {
+			if modified, err := gitlinkModified(targetPath, storedHash); err != nil {
+				return err
+			} else if modified {
+				return fmt.Errorf("submodule %s has a different commit checked out", targetPath)
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(workTreePath(targetPath))
 		if err != nil {
-			return fmt.Errorf("error reading file %s: %v", targetPath, err)
+			return fmt.Errorf("error reading file %s: %w", targetPath, err)
 		}
 
-		contentHash := hashObject(content)
+		contentHash, err := conv.hashWorkTreeContent(ctx, targetPath, content)
+		if err != nil {
+			return err
+		}
 		if !slices.Equal(storedHash, contentHash) {
-			return fmt.Errorf("file %s has been modified", targetPath)
+			return &DirtyWorktreeError{Path: targetPath, Change: "has been modified"}
 		}
 	}
 
@@ -407,7 +653,7 @@ func findCommonAncestor(commitA, commitB []byte) ([]byte, error) {
 				mostRecentDepth = depthB
 				ancestorHash, err := hex.DecodeString(hashStr)
 				if err != nil {
-					return nil, fmt.Errorf("error decoding ancestor hash: %v", err)
+					return nil, fmt.Errorf("error decoding ancestor hash: %w", err)
 				}
 				mostRecentCommonAncestor = ancestorHash
 			}
@@ -417,6 +663,65 @@ func findCommonAncestor(commitA, commitB []byte) ([]byte, error) {
 	return mostRecentCommonAncestor, nil
 }
 
+// isAncestor reports whether ancestor is reachable from descendant by
+// following parent links (any parent, not just the first). A commit counts
+// as its own ancestor.
+func isAncestor(ancestor, descendant []byte) (bool, error) {
+	seen := make(map[string]struct{})
+	pending := [][]byte{descendant}
+
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		if slices.Equal(current, ancestor) {
+			return true, nil
+		}
+
+		hashStr := fmt.Sprintf("%x", current)
+		if _, ok := seen[hashStr]; ok {
+			continue
+		}
+		seen[hashStr] = struct{}{}
+
+		obj, err := catFile(current)
+		if err != nil {
+			return false, err
+		}
+
+		commitObj, ok := obj.(commitObject)
+		if !ok {
+			return false, fmt.Errorf("object %s is not a commit", hashStr)
+		}
+
+		for _, parent := range commitObj.parents {
+			if len(parent) > 0 {
+				pending = append(pending, parent)
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// isBranchMerged reports whether the tip of the branch is reachable from HEAD.
+func isBranchMerged(branchName string) (bool, error) {
+	branchHash, err := getRef(fmt.Sprintf("refs/heads/%s", branchName))
+	if err != nil {
+		return false, err
+	}
+	if branchHash == nil {
+		return true, nil // nothing to lose
+	}
+
+	headHash, err := resolveRevision("HEAD")
+	if err != nil {
+		return false, err
+	}
+
+	return isAncestor(branchHash, headHash)
+}
+
 // readBlobFromCatFile reads a blob object using catFile and returns its content.
 // This is used as a pass-in function for calculateMerge for readBlobFunc type.
 func readBlobFromCatFile(hash []byte) ([]byte, error) {
@@ -433,14 +738,19 @@ func readBlobFromCatFile(hash []byte) ([]byte, error) {
 	return blobObj.content, nil
 }
 
-// calculateMergeWithReadBlob is a wrapper around calculateMerge that uses readBlobFromCatFile.
+// calculateMergeWithReadBlob is a wrapper around calculateMerge that uses
+// readBlobFromCatFile and checks for case collisions when core.ignorecase
+// says the working tree is on a case-insensitive file system.
 func calculateMergeWithReadBlob(base, ours, theirs map[string][]byte, branchName string) (map[string][]byte, map[string]Conflict, error) {
-	return calculateMerge(base, ours, theirs, branchName, readBlobFromCatFile)
+	return calculateMerge(base, ours, theirs, branchName, ignoreCaseEnabled(), readBlobFromCatFile)
 }
 
-// calculateMerge performs a three-way merge between base, ours, and theirs indexes
+// calculateMerge performs a three-way merge between base, ours, and theirs
+// indexes. Besides content conflicts it reports paths that cannot coexist
+// in the merged tree: a file on one side where the other has a directory,
+// and, with ignoreCase, paths that differ only in case.
 func calculateMerge(
-	base, ours, theirs map[string][]byte, branchName string, readBlob readBlobFunc,
+	base, ours, theirs map[string][]byte, branchName string, ignoreCase bool, readBlob readBlobFunc,
 ) (map[string][]byte, map[string]Conflict, error) {
 	if readBlob == nil {
 		return nil, nil, fmt.Errorf("readBlob function cannot be nil")
@@ -494,6 +804,7 @@ func calculateMerge(
 
 				// add to conflicts map to write markers
 				conflicts[path] = Conflict{
+					Kind:         conflictContent,
 					BaseHash:     baseHash,
 					OurHash:      currentHash,
 					TheirHash:    branchHash,
@@ -519,6 +830,7 @@ func calculateMerge(
 
 				// add to conflicts map to write markers
 				conflicts[path] = Conflict{
+					Kind:         conflictContent,
 					BaseHash:     baseHash,
 					OurHash:      currentHash,
 					TheirHash:    branchHash,
@@ -541,6 +853,7 @@ func calculateMerge(
 
 				// add to conflicts map to write markers
 				conflicts[path] = Conflict{
+					Kind:         conflictContent,
 					BaseHash:     baseHash,
 					OurHash:      currentHash,
 					TheirHash:    branchHash,
@@ -587,6 +900,7 @@ func calculateMerge(
 
 				// add to conflicts map to write markers
 				conflicts[path] = Conflict{
+					Kind:         conflictContent,
 					BaseHash:     baseHash,
 					OurHash:      currentHash,
 					TheirHash:    branchHash,
@@ -598,192 +912,306 @@ func calculateMerge(
 		}
 	}
 
+	if err := detectStructuralConflicts(ours, theirs, mergedIndex, conflicts, branchName, ignoreCase, readBlob); err != nil {
+		return nil, nil, err
+	}
+
 	return mergedIndex, conflicts, nil
 }
 
 // mergeBranch merges the specified branch into the current branch.
-func mergeBranch(branchName string) error {
-	if err := checkVCSRepo(); err != nil {
+func mergeBranch(ctx context.Context, branchName string) error {
+	_, err := mergeBranchWithReport(ctx, branchName)
+	return err
+}
+
+// requireMergeable refuses to start a merge while another merge is in
+// progress or there are uncommitted or unstaged changes.
+func requireMergeable(ctx context.Context) error {
+	// check for existing merge in progress, whose conflicts also count as changes
+	if yes, err := isMergeInProgress(); err != nil {
 		return err
+	} else if yes {
+		return errorOf(ErrConflict, "merge in progress; please resolve conflicts and commit before merging again")
+	}
+
+	// check for uncommitted changes
+	if err := checkUncommittedChanges(ctx); err != nil {
+		return fmt.Errorf("please commit your changes before merging branches: %w", err)
+	}
+
+	// check for unstaged changes
+	if err := checkUnstagedChanges(ctx); err != nil {
+		return fmt.Errorf("please stage your changes before merging branches: %w", err)
+	}
+
+	return nil
+}
+
+// mergeBranchWithReport merges the specified branch into the current branch
+// and returns a report describing how every path was resolved.
+func mergeBranchWithReport(ctx context.Context, branchName string) (*mergeReport, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
 	}
 
 	// find commit hash of branch to merge
 	branchRefPath := fmt.Sprintf("refs/heads/%s", branchName)
 	branchCommitHash, err := getRef(branchRefPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if branchCommitHash == nil {
-		return fmt.Errorf("branch %s has no commits", branchName)
+		return nil, fmt.Errorf("branch %s has no commits", branchName)
 	}
 
 	// find current branch commit hash
 	currentBranch, err := getCurrentBranch()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	currentBranchRefPath := fmt.Sprintf("refs/heads/%s", currentBranch)
 	currentCommitHash, err := getRef(currentBranchRefPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if currentCommitHash == nil {
-		return fmt.Errorf("current branch %s has no commits", currentBranch)
+		return nil, fmt.Errorf("current branch %s has no commits", currentBranch)
 	}
 
-	// find common ancestor
-	baseHash, err := findCommonAncestor(currentCommitHash, branchCommitHash)
+	report := &mergeReport{
+		Branch: branchName,
+		Ours:   hex.EncodeToString(currentCommitHash),
+		Theirs: hex.EncodeToString(branchCommitHash),
+	}
+
+	fastForward, err := isAncestor(currentCommitHash, branchCommitHash)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	upToDate, err := isAncestor(branchCommitHash, currentCommitHash)
+	if err != nil {
+		return nil, err
 	}
 
 	// check for fast-forward possibility
-	if slices.Equal(baseHash, currentCommitHash) {
+	if fastForward && !upToDate {
+		report.Base = report.Ours
+
 		// fast-forward (A is ancestor of B)
-		if err := checkoutCommit(branchCommitHash); err != nil {
-			return err
+		if err := checkoutCommit(ctx, branchCommitHash); err != nil {
+			return nil, err
 		}
 
 		// update current branch (A) to point to B
-		if err := updateRef(currentBranchRefPath, branchCommitHash); err != nil {
-			return err
+		if err := compareAndSwapRef(currentBranchRefPath, currentCommitHash, branchCommitHash); err != nil {
+			return nil, err
 		}
 
 		fmt.Printf("Fast-forwarded to branch %s and commit %x\n", branchName, branchCommitHash)
 
-		return nil
-	} else if slices.Equal(baseHash, branchCommitHash) {
+		report.Result = "fast-forward"
+		report.Commit = report.Theirs
+		return report, nil
+	} else if upToDate {
 		// already up to date (B is ancestor of A)
 		fmt.Println("Already up to date")
-		return nil
+		report.Base = report.Theirs
+		report.Result = "up-to-date"
+		report.Commit = report.Ours
+		return report, nil
+	}
+
+	// find common ancestor
+	baseHash, err := findCommonAncestor(currentCommitHash, branchCommitHash)
+	if err != nil {
+		return nil, err
 	}
+	report.Base = hex.EncodeToString(baseHash)
 
 	// three-way merge required
 	// get trees for base, current, and branch commits
 	baseObj, err := catFile(baseHash)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	baseCommit, ok := baseObj.(commitObject)
 	if !ok {
-		return fmt.Errorf("object %x is not a commit", baseHash)
+		return nil, fmt.Errorf("object %x is not a commit", baseHash)
 	}
 
 	currentObj, err := catFile(currentCommitHash)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	currentCommit, ok := currentObj.(commitObject)
 	if !ok {
-		return fmt.Errorf("object %x is not a commit", currentCommitHash)
+		return nil, fmt.Errorf("object %x is not a commit", currentCommitHash)
 	}
 
 	branchObj, err := catFile(branchCommitHash)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	branchCommit, ok := branchObj.(commitObject)
 	if !ok {
-		return fmt.Errorf("object %x is not a commit", branchCommitHash)
+		return nil, fmt.Errorf("object %x is not a commit", branchCommitHash)
 	}
 
 	// build indexes for the three commits
-	baseIndex, err := buildIndexFromTree(baseCommit.hash, "", false)
+	baseIndex, err := buildIndexFromTree(ctx, baseCommit.hash, "", false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	currentIndex, err := buildIndexFromTree(currentCommit.hash, "", false)
+	currentIndex, err := buildIndexFromTree(ctx, currentCommit.hash, "", false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	branchIndex, err := buildIndexFromTree(branchCommit.hash, "", false)
+	branchIndex, err := buildIndexFromTree(ctx, branchCommit.hash, "", false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	mergedIndex, conflicts, err := calculateMergeWithReadBlob(baseIndex, currentIndex, branchIndex, branchName)
+	// a file renamed on one side takes the other side's changes with it
+	threshold, err := renameThreshold()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	readBlob, err := gitlinkAwareReader(baseIndex, currentIndex, branchIndex)
+	if err != nil {
+		return nil, err
+	}
+	mergeBase, mergeOurs, mergeTheirs, err := alignRenames(baseIndex, currentIndex, branchIndex, readBlob, threshold)
+	if err != nil {
+		return nil, err
 	}
 
-	// write merged index to working directory
-	for path, hash := range mergedIndex {
-		obj, err := catFile(hash)
+	mergedIndex, conflicts, err := calculateMergeWithReadBlob(mergeBase, mergeOurs, mergeTheirs, branchName)
+	if err != nil {
+		return nil, err
+	}
+	if err := markBinaryConflicts(conflicts); err != nil {
+		return nil, err
+	}
+
+	report.Paths = classifyMergePaths(mergeBase, mergeOurs, mergeTheirs, conflicts)
+
+	gitlinks, err := gitlinkPaths(mergedIndex)
+	if err != nil {
+		return nil, err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return nil, err
+	}
+
+	// remove obsolete files first, so a file can give way to a directory
+	// of the same name and the other way round
+	if err := removeObsoleteFiles(currentIndex, mergedIndex); err != nil {
+		return nil, err
+	}
+
+	// write merged index to working directory
+	for path, hash := range mergedIndex {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if gitlinks[path] {
+			continue // submodules are brought up to date by submodule update
+		}
+
+		obj, err := catFile(hash)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		blob, ok := obj.(blobObject)
 		if !ok {
-			return fmt.Errorf("object %x is not a blob", hash)
+			return nil, fmt.Errorf("object %x is not a blob", hash)
 		}
 
 		// create parent directories if needed
 		if dir := filepath.Dir(path); dir != "." {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return fmt.Errorf("error creating directory %s: %v", dir, err)
+			if err := os.MkdirAll(workTreePath(dir), workTreeDirMode); err != nil {
+				return nil, fmt.Errorf("error creating directory %s: %w", dir, err)
 			}
 		}
 
 		// write file content
-		if err := os.WriteFile(path, blob.content, 0644); err != nil {
-			return fmt.Errorf("error writing file %s: %v", path, err)
+		if err := conv.writeWorkTreeFile(ctx, path, path, blob.content); err != nil {
+			return nil, err
 		}
 
 	}
 
 	// update index file
-	if err := writeIndex(mergedIndex); err != nil {
-		return err
-	}
-
-	// remove obsolete files from working directory
-	if err := removeObsoleteFiles(currentIndex, mergedIndex); err != nil {
-		return err
+	if err := writeIndex(ctx, mergedIndex); err != nil {
+		return nil, err
 	}
 
 	// write conflict markers
 	for path, conflict := range conflicts {
 		if err := writeConflictMarkers(path, conflict); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	// report if conflicts exist
 	if len(conflicts) > 0 {
+		// record the three versions of each content conflict in the index;
+		// structural conflicts are resolved by moving files, not merging them
+		stages := make(map[string]conflictStages)
+		for path, conflict := range conflicts {
+			if conflict.Kind == conflictContent {
+				stages[path] = newConflictStages(conflict.BaseHash, conflict.OurHash, conflict.TheirHash)
+			}
+		}
+		if err := setConflictStages(stages); err != nil {
+			return nil, err
+		}
+
 		// write to MERGE_HEAD to indicate conflict state
-		mergeHeadPath := fmt.Sprintf(".%s/MERGE_HEAD", vcsName)
+		mergeHeadPath := fmt.Sprintf("%s/MERGE_HEAD", gitDir)
 		if err := os.WriteFile(mergeHeadPath, []byte(fmt.Sprintf("%x", branchCommitHash)), 0644); err != nil {
-			return fmt.Errorf("error writing MERGE_HEAD: %v", err)
+			return nil, fmt.Errorf("error writing MERGE_HEAD: %w", err)
 		}
 
 		// write conflicted paths to MERGE_CONFLICTS
-		mergeConflictsPath := fmt.Sprintf(".%s/MERGE_CONFLICTS", vcsName)
+		mergeConflictsPath := fmt.Sprintf("%s/MERGE_CONFLICTS", gitDir)
 		var conflictPaths []string
 		for path := range conflicts {
 			conflictPaths = append(conflictPaths, path)
 		}
 		if err := os.WriteFile(mergeConflictsPath, []byte(strings.Join(conflictPaths, "\n")), 0644); err != nil {
-			return fmt.Errorf("error writing MERGE_CONFLICTS: %v", err)
+			return nil, fmt.Errorf("error writing MERGE_CONFLICTS: %w", err)
+		}
+
+		// write the message for the merge commit that concludes the merge
+		mergeMsgPath := fmt.Sprintf("%s/MERGE_MSG", gitDir)
+		mergeMsg := fmt.Sprintf("Merge branch '%s' into %s\n", branchName, currentBranch)
+		if err := os.WriteFile(mergeMsgPath, []byte(mergeMsg), 0644); err != nil {
+			return nil, fmt.Errorf("error writing MERGE_MSG: %w", err)
 		}
 
 		fmt.Printf("Automatic merge failed; fix conflicts and then commit.\n")
-		for path := range conflicts {
-			fmt.Printf("Conflict in file: %s\n", path)
+		for path, conflict := range conflicts {
+			fmt.Println(conflict.describe(path))
 		}
 
-		return nil
+		report.Result = "conflicted"
+		return report, nil
 	}
 
 	// build the tree object and make a merge commit
 	treeHash, err := buildTreeObject(mergedIndex)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	commitHash, err := writeCommitObject(
@@ -792,87 +1220,172 @@ func mergeBranch(branchName string) error {
 		fmt.Sprintf("Merge branch '%s' into %s", branchName, currentBranch),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// update current branch to point to new merge commit
-	if err := updateRef(currentBranchRefPath, commitHash); err != nil {
-		return err
+	if err := compareAndSwapRef(currentBranchRefPath, currentCommitHash, commitHash); err != nil {
+		return nil, err
 	}
 
 	fmt.Printf("Merged %s into %s, commit %x\n", branchName, currentBranch, commitHash)
 
+	report.Result = "merged"
+	report.Commit = hex.EncodeToString(commitHash)
+	return report, nil
+}
+
+// markBinaryConflicts marks the content conflicts between binary files,
+// which cannot be merged line by line: those whose merge attribute is unset
+// (as "binary" unsets it), and unless it is set, those where either side
+// looks binary.
+func markBinaryConflicts(conflicts map[string]Conflict) error {
+	attrs, err := loadAttributes()
+	if err != nil {
+		return err
+	}
+
+	for path, conflict := range conflicts {
+		if conflict.Kind != conflictContent {
+			continue
+		}
+
+		switch attrs.get(path, "merge") {
+		case attrUnset:
+			conflict.Binary = true
+		case attrSet:
+			conflict.Binary = false
+		default:
+			conflict.Binary = looksBinary(conflict.OurContent) || looksBinary(conflict.TheirContent)
+		}
+		conflicts[path] = conflict
+	}
+
 	return nil
 }
 
-// writeConflictMarkers writes conflict markers to the specified file path
+// writeConflictMarkers writes conflict markers to the specified file path.
+// A file moved aside by a structural conflict is written as it was, and
+// a binary file as our side has it.
 func writeConflictMarkers(path string, conflict Conflict) error {
+	if conflict.Binary {
+		return os.WriteFile(workTreePath(path), conflict.OurContent, workTreeFileMode)
+	}
+	if conflict.Kind == conflictFileDirectory || conflict.Kind == conflictCase {
+		content := conflict.TheirContent
+		if conflict.OurHash != nil {
+			content = conflict.OurContent
+		}
+		return os.WriteFile(workTreePath(path), content, workTreeFileMode)
+	}
+
+	content, _ := conflictMarkerContent(conflict)
+	return os.WriteFile(workTreePath(path), content, workTreeFileMode)
+}
+
+// conflictMarkerContent returns the content writeConflictMarkers writes for
+// a content conflict, and the lines its markers are on. A side without a
+// trailing newline gets one, so that every marker starts a line.
+func conflictMarkerContent(conflict Conflict) ([]byte, conflictHunk) {
 	content := []byte{}
+	appendSide := func(side []byte) {
+		content = append(content, side...)
+		if len(side) > 0 && side[len(side)-1] != '\n' {
+			content = append(content, '\n')
+		}
+	}
+	nextLine := func() int { return bytes.Count(content, []byte("\n")) + 1 }
+
+	hunk := conflictHunk{Start: nextLine()}
 	content = append(content, []byte("<<<<<<< HEAD\n")...)
-	content = append(content, conflict.OurContent...)
+	appendSide(conflict.OurContent)
+	hunk.Separator = nextLine()
 	content = append(content, []byte("=======\n")...)
-	content = append(content, conflict.TheirContent...)
+	appendSide(conflict.TheirContent)
+	hunk.End = nextLine()
 	content = append(content, []byte(fmt.Sprintf(">>>>>>> %s\n", conflict.BranchName))...)
 
-	return os.WriteFile(path, content, 0644)
+	return content, hunk
 }
 
 // hasMergeConflicts checks if there are any merge conflicts present
 func isMergeInProgress() (bool, error) {
-	mergeHeadPath := fmt.Sprintf(".%s/MERGE_HEAD", vcsName)
+	mergeHeadPath := fmt.Sprintf("%s/MERGE_HEAD", gitDir)
 	_, err := os.Stat(mergeHeadPath)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return false, nil
 		}
-		return false, fmt.Errorf("error checking %s: %v", mergeHeadPath, err)
+		return false, fmt.Errorf("error checking %s: %w", mergeHeadPath, err)
 	}
 
 	return true, nil
 }
 
 // isConflictsResolved checks if all merge conflicts have been resolved
-func isConflictsResolved(index map[string][]byte) (bool, error) {
-	mergeConflictsPath := fmt.Sprintf(".%s/MERGE_CONFLICTS", vcsName)
-	content, err := os.ReadFile(mergeConflictsPath)
+func isConflictsResolved(ctx context.Context, index map[string][]byte) (bool, error) {
+	unresolved, err := unresolvedConflicts(ctx, index)
 	if err != nil {
 		return false, err
 	}
 
+	return len(unresolved) == 0, nil
+}
+
+// unresolvedConflicts returns the paths recorded in MERGE_CONFLICTS that
+// are still in conflict: present in the working tree but not staged as they
+// are there.
+func unresolvedConflicts(ctx context.Context, index map[string][]byte) ([]string, error) {
+	mergeConflictsPath := fmt.Sprintf("%s/MERGE_CONFLICTS", gitDir)
+	content, err := os.ReadFile(mergeConflictsPath)
+	if err != nil {
+		return nil, err
+	}
+
 	if string(content) == "" {
-		return true, nil // no conflicts
+		return nil, nil // no conflicts
 	}
 
+	conv, err := loadContentConversion()
+	if err != nil {
+		return nil, err
+	}
+
+	var unresolved []string
 	paths := strings.Split(strings.TrimSpace(string(content)), "\n")
 	for _, path := range paths {
 		hash, ok := index[path]
 		if !ok {
 			// check if file was deleted
-			_, err := os.Stat(path)
+			_, err := os.Stat(workTreePath(path))
 			if errors.Is(err, fs.ErrNotExist) {
 				continue // file deleted, so resolved
 			}
 
-			return false, nil // still in conflict
+			unresolved = append(unresolved, path) // still in conflict
+			continue
 		}
 
-		content, err := os.ReadFile(path)
+		content, err := os.ReadFile(workTreePath(path))
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 
-		contentHash := hashObject(content)
+		contentHash, err := conv.hashWorkTreeContent(ctx, path, content)
+		if err != nil {
+			return nil, err
+		}
 
 		if !slices.Equal(hash, contentHash) {
-			return false, nil // still in conflict
+			unresolved = append(unresolved, path) // still in conflict
 		}
 	}
 
-	return true, nil
+	return unresolved, nil
 }
 
 // resetToCommit resets the current branch to the specified commit hash
-func resetToCommit(commitHash []byte, mode resetMode) error {
+func resetToCommit(ctx context.Context, commitHash []byte, mode resetMode) error {
 	if err := checkVCSRepo(); err != nil {
 		return err
 	}
@@ -904,7 +1417,7 @@ func resetToCommit(commitHash []byte, mode resetMode) error {
 	// read old index in case of hard reset
 	var oldIndex map[string][]byte
 	if mode == resetModeHard {
-		oldIndex, err = readIndex()
+		oldIndex, err = readIndex(ctx)
 		if err != nil {
 			return err
 		}
@@ -922,21 +1435,21 @@ func resetToCommit(commitHash []byte, mode resetMode) error {
 
 	case resetModeMixed:
 		// build new index from commit without writing files
-		newIndex, err := buildIndexFromTree(commit.hash, "", false)
+		newIndex, err := buildIndexFromTree(ctx, commit.hash, "", false)
 		if err != nil {
 			return err
 		}
 
-		return writeIndex(newIndex)
+		return writeIndex(ctx, newIndex)
 
 	case resetModeHard:
 		// build new index from commit and write files to working dir
-		newIndex, err := buildIndexFromTree(commit.hash, "", true)
+		newIndex, err := buildIndexFromTree(ctx, commit.hash, "", true)
 		if err != nil {
 			return err
 		}
 
-		if err := writeIndex(newIndex); err != nil {
+		if err := writeIndex(ctx, newIndex); err != nil {
 			return err
 		}
 
@@ -950,3 +1463,303 @@ func resetToCommit(commitHash []byte, mode resetMode) error {
 
 	return nil
 }
+
+// resolveTreeHash returns the tree hash for the given object hash, which
+// may refer either to a commit or directly to a tree.
+func resolveTreeHash(hash []byte) ([]byte, error) {
+	obj, err := catFile(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case commitObject:
+		return o.hash, nil
+	case treeObject:
+		return hash, nil
+	default:
+		return nil, fmt.Errorf("object %x is not a commit or tree", hash)
+	}
+}
+
+// createCommit commits the current index on top of HEAD and returns the new
+// commit hash. If a merge is in progress, all conflicts must be resolved and
+// the commit records MERGE_HEAD as a second parent.
+func createCommit(ctx context.Context, message string) ([]byte, error) {
+	// read the index file, leaving sparse directories collapsed
+	index, err := readSparseIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	// check if merge conflicts exist
+	hasConflicts, err := isMergeInProgress()
+	if err != nil {
+		return nil, err
+	}
+
+	if hasConflicts {
+		unresolved, err := unresolvedConflicts(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(unresolved) > 0 {
+			return nil, fmt.Errorf("cannot commit: %w, please resolve them first", &ConflictError{Paths: unresolved})
+		}
+	}
+
+	// get parent commit hash from HEAD
+	head, err := getHEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	refHash, err := getRef(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var commitParents [][]byte
+	if refHash != nil {
+		commitParents = append(commitParents, refHash)
+	}
+
+	// a merge commit also records MERGE_HEAD
+	if hasConflicts {
+		mergeHead, err := os.ReadFile(fmt.Sprintf("%s/MERGE_HEAD", gitDir))
+		if err != nil {
+			return nil, err
+		}
+
+		mergeHeadBinary, err := hex.DecodeString(strings.TrimSpace(string(mergeHead)))
+		if err != nil {
+			return nil, err
+		}
+
+		commitParents = append(commitParents, mergeHeadBinary)
+
+		fmt.Println("All conflicts resolved. Creating merge commit.")
+	}
+
+	cache, err := readCacheTree()
+	if err != nil {
+		return nil, err
+	}
+	if err := runPreCommitHook(ctx, index, cache, commitParents); err != nil {
+		return nil, fmt.Errorf("cannot commit: %w", err)
+	}
+
+	// build the tree structure and write to disk
+	treeHash, err := writeIndexTree(index)
+	if err != nil {
+		return nil, err
+	}
+
+	commitHash, err := writeCommitObject(treeHash, commitParents, message)
+	if err != nil {
+		return nil, err
+	}
+
+	// update HEAD to point to new commit, unless another commit got there first
+	if err := compareAndSwapRef(head, refHash, commitHash); err != nil {
+		return nil, err
+	}
+
+	if hasConflicts {
+		if err := clearMergeState(); err != nil {
+			return nil, err
+		}
+	}
+
+	return commitHash, nil
+}
+
+// clearMergeState deletes the merge state files and the conflict stages
+// left in the index.
+func clearMergeState() error {
+	files := []string{
+		fmt.Sprintf("%s/MERGE_HEAD", gitDir),
+		fmt.Sprintf("%s/MERGE_CONFLICTS", gitDir),
+		fmt.Sprintf("%s/MERGE_MSG", gitDir),
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error removing %s: %w", file, err)
+		}
+	}
+
+	// the stages of paths that were never staged again go with the merge
+	stages, err := readConflictStages()
+	if err != nil {
+		return err
+	}
+	if len(stages) > 0 {
+		return setConflictStages(nil)
+	}
+
+	return nil
+}
+
+// mergeMessage returns the message recorded in MERGE_MSG for the commit that
+// concludes a conflicted merge.
+func mergeMessage() (string, error) {
+	content, err := os.ReadFile(fmt.Sprintf("%s/MERGE_MSG", gitDir))
+	if err != nil {
+		return "", fmt.Errorf("error reading MERGE_MSG: %w", err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// continueMerge concludes an in-progress conflicted merge whose conflicts
+// are resolved, committing the index with the message in MERGE_MSG.
+func continueMerge(ctx context.Context) ([]byte, error) {
+	if yes, err := isMergeInProgress(); err != nil {
+		return nil, err
+	} else if !yes {
+		return nil, fmt.Errorf("no merge in progress")
+	}
+
+	message, err := mergeMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	return createCommit(ctx, message)
+}
+
+// abortMerge abandons an in-progress conflicted merge, restoring the index
+// and working tree to the current HEAD commit.
+func abortMerge(ctx context.Context) error {
+	if yes, err := isMergeInProgress(); err != nil {
+		return err
+	} else if !yes {
+		return fmt.Errorf("no merge in progress")
+	}
+
+	// conflicted paths are not in the index, so collect them before resetting
+	content, err := os.ReadFile(fmt.Sprintf("%s/MERGE_CONFLICTS", gitDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading MERGE_CONFLICTS: %w", err)
+	}
+
+	var conflictPaths []string
+	if trimmed := strings.TrimSpace(string(content)); trimmed != "" {
+		conflictPaths = strings.Split(trimmed, "\n")
+	}
+
+	if err := clearMergeState(); err != nil {
+		return err
+	}
+
+	headHash, err := resolveRevision("HEAD")
+	if err != nil {
+		return err
+	}
+
+	if err := resetToCommit(ctx, headHash, resetModeHard); err != nil {
+		return err
+	}
+
+	// remove conflict marker files that do not exist at HEAD
+	index, err := readIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range conflictPaths {
+		if _, ok := index[path]; ok {
+			continue
+		}
+
+		if err := os.Remove(workTreePath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error removing conflicted file %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// commitIndex returns the flattened index of the tree recorded in a commit.
+func commitIndex(ctx context.Context, commitHash []byte) (map[string][]byte, error) {
+	treeHash, err := resolveTreeHash(commitHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildIndexFromTree(ctx, treeHash, "", false)
+}
+
+// showObject prints an object in human-readable form: commits with their
+// diff against the first parent, trees as a listing, and blobs as content.
+func showObject(ctx context.Context, hash []byte) error {
+	obj, err := catFile(hash)
+	if err != nil {
+		return err
+	}
+
+	switch o := obj.(type) {
+	case commitObject:
+		printCommitHeader(hash, o)
+
+		newIndex, err := buildIndexFromTree(ctx, o.hash, "", false)
+		if err != nil {
+			return err
+		}
+
+		oldIndex := map[string][]byte{}
+		if len(o.parents) > 0 && len(o.parents[0]) > 0 {
+			if oldIndex, err = commitIndex(ctx, o.parents[0]); err != nil {
+				return err
+			}
+		}
+
+		readBlob, err := gitlinkAwareReader(oldIndex, newIndex)
+		if err != nil {
+			return err
+		}
+
+		diff, err := formatIndexDiff(oldIndex, newIndex, readBlob)
+		if err != nil {
+			return err
+		}
+		fmt.Print(colorDiff(diff))
+
+	case treeObject:
+		fmt.Printf("tree %x\n\n", hash)
+		for _, entry := range o.entries {
+			if entry.objType == "tree" {
+				fmt.Printf("%s/\n", entry.name)
+			} else {
+				fmt.Println(entry.name)
+			}
+		}
+
+	default:
+		fmt.Print(o.String())
+	}
+
+	return nil
+}
+
+// headCommitIndex returns the flattened index of the HEAD commit, or an
+// empty index if the current branch has no commits yet.
+func headCommitIndex(ctx context.Context) (map[string][]byte, error) {
+	head, err := getHEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	headHash, err := getRef(head)
+	if err != nil {
+		return nil, err
+	}
+
+	if headHash == nil {
+		return map[string][]byte{}, nil
+	}
+
+	return commitIndex(ctx, headHash)
+}
@@ -1,7 +1,10 @@
-package main
+package mygit
 
 import (
+	"fmt"
+	"os"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -12,7 +15,7 @@ var readBlob readBlobFunc = func(hash []byte) ([]byte, error) {
 
 // calculateMergeTest is a test wrapper around calculateMerge that uses readBlob.
 func calculateMergeTest(base, ours, theirs map[string][]byte, branchName string) (map[string][]byte, map[string]Conflict, error) {
-	return calculateMerge(base, ours, theirs, branchName, readBlob)
+	return calculateMerge(base, ours, theirs, branchName, false, readBlob)
 }
 
 func TestCalculateMerge(t *testing.T) {
@@ -205,3 +208,278 @@ func TestCalculateMerge(t *testing.T) {
 		})
 	}
 }
+
+func TestCompareAndSwapRef(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	first := hashObject([]byte("first"))
+	second := hashObject([]byte("second"))
+
+	// main exists without commits, so nil is the expected old value
+	if err := compareAndSwapRef("refs/heads/main", nil, first); err != nil {
+		t.Fatalf("compareAndSwapRef() from empty error = %v", err)
+	}
+
+	// a stale expectation is rejected and leaves the ref alone
+	err := compareAndSwapRef("refs/heads/main", second, second)
+	if err == nil || !strings.Contains(err.Error(), "updated concurrently") {
+		t.Fatalf("compareAndSwapRef() with stale value error = %v, expected concurrent update error", err)
+	}
+
+	if hash, _ := getRef("refs/heads/main"); !slices.Equal(hash, first) {
+		t.Errorf("getRef() = %x, expected %x", hash, first)
+	}
+
+	// a held lock makes the update fail instead of racing
+	lockPath := fmt.Sprintf(".%s/refs/heads/main.lock", vcsName)
+	if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatalf("Failed to create lock: %v", err)
+	}
+
+	err = compareAndSwapRef("refs/heads/main", first, second)
+	if err == nil || !strings.Contains(err.Error(), "main.lock exists") {
+		t.Fatalf("compareAndSwapRef() with held lock error = %v, expected lock error", err)
+	}
+
+	branches, err := getBranches(t.Context())
+	if err != nil || !slices.Equal(branches, []string{"main"}) {
+		t.Errorf("getBranches() = %v, %v; lock files should not be listed", branches, err)
+	}
+
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatalf("Failed to remove lock: %v", err)
+	}
+
+	if err := compareAndSwapRef("refs/heads/main", first, second); err != nil {
+		t.Fatalf("compareAndSwapRef() error = %v", err)
+	}
+
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file should be gone after a successful update")
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "ancestry@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	treeHash, err := buildTreeObject(map[string][]byte{})
+	if err != nil {
+		t.Fatalf("buildTreeObject() error = %v", err)
+	}
+
+	commit := func(message string, parents ...[]byte) []byte {
+		hash, err := writeCommitObject(treeHash, parents, message)
+		if err != nil {
+			t.Fatalf("writeCommitObject() error = %v", err)
+		}
+		return hash
+	}
+
+	// root <- main1 <- merge, with side as the second parent of merge
+	root := commit("root")
+	main1 := commit("main1", root)
+	side := commit("side", root)
+	merge := commit("merge", main1, side)
+
+	tests := []struct {
+		name                 string
+		ancestor, descendant []byte
+		expected             bool
+	}{
+		{"self", root, root, true},
+		{"first parent chain", root, merge, true},
+		{"second parent", side, merge, true},
+		{"descendant is not ancestor", merge, side, false},
+		{"siblings", main1, side, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isAncestor(tt.ancestor, tt.descendant)
+			if err != nil {
+				t.Fatalf("isAncestor() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("isAncestor() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergeAbortContinue(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		if err := updateConfig("email", "merge@example.com"); err != nil {
+			return err
+		}
+
+		commitFile := func(content, message string) []byte {
+			if err := os.WriteFile("a.txt", []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write a.txt: %v", err)
+			}
+			if _, _, err := addPaths(t.Context(), []string{"a.txt"}, addOptions{}); err != nil {
+				t.Fatalf("addPaths(t.Context(), ) error = %v", err)
+			}
+			hash, err := createCommit(t.Context(), message)
+			if err != nil {
+				t.Fatalf("createCommit() error = %v", err)
+			}
+			return hash
+		}
+
+		base := commitFile("base\n", "base")
+		mainBranch, err := getCurrentBranch()
+		if err != nil {
+			return err
+		}
+		if err := createBranch("topic", base); err != nil {
+			return err
+		}
+		ours := commitFile("ours\n", "ours")
+		if err := checkoutBranch("topic"); err != nil {
+			return err
+		}
+		theirs := commitFile("theirs\n", "theirs")
+		if err := checkoutBranch(mainBranch); err != nil {
+			return err
+		}
+
+		if err := mergeBranch(t.Context(), "topic"); err != nil {
+			return err
+		}
+		if stages, err := readConflictStages(); err != nil || len(stages["a.txt"]) != 3 {
+			t.Fatalf("readConflictStages() = %v, %v; expected three stages of a.txt", stages, err)
+		}
+		expectedMessage := fmt.Sprintf("Merge branch 'topic' into %s", mainBranch)
+		if message, err := mergeMessage(); err != nil || message != expectedMessage {
+			t.Fatalf("mergeMessage() = %q, %v; expected %q", message, err, expectedMessage)
+		}
+
+		// abort restores the state before the merge
+		if err := abortMerge(t.Context()); err != nil {
+			t.Fatalf("abortMerge() error = %v", err)
+		}
+		if content, _ := os.ReadFile("a.txt"); string(content) != "ours\n" {
+			t.Errorf("a.txt after abort = %q, expected our version", content)
+		}
+		if merging, _ := isMergeInProgress(); merging {
+			t.Errorf("merge still in progress after abort")
+		}
+		if _, err := mergeMessage(); err == nil {
+			t.Errorf("MERGE_MSG should be removed by abort")
+		}
+
+		// continue refuses to commit until the conflict is resolved
+		if err := mergeBranch(t.Context(), "topic"); err != nil {
+			return err
+		}
+		if _, err := continueMerge(t.Context()); err == nil {
+			t.Fatalf("continueMerge() with unresolved conflicts should fail")
+		}
+
+		if err := os.WriteFile("a.txt", []byte("resolved\n"), 0644); err != nil {
+			return err
+		}
+		if _, _, err := addPaths(t.Context(), []string{"a.txt"}, addOptions{}); err != nil {
+			return err
+		}
+		mergeHash, err := continueMerge(t.Context())
+		if err != nil {
+			t.Fatalf("continueMerge() error = %v", err)
+		}
+
+		obj, err := catFile(mergeHash)
+		if err != nil {
+			return err
+		}
+		commit := obj.(commitObject)
+		if commit.message != expectedMessage {
+			t.Errorf("merge commit message = %q, expected %q", commit.message, expectedMessage)
+		}
+		if len(commit.parents) != 2 || !slices.Equal(commit.parents[0], ours) || !slices.Equal(commit.parents[1], theirs) {
+			t.Errorf("merge commit parents = %x, expected %x and %x", commit.parents, ours, theirs)
+		}
+
+		if stages, err := readConflictStages(); err != nil || len(stages) != 0 {
+			t.Errorf("readConflictStages() after the merge = %v, %v; expected none", stages, err)
+		}
+		if _, err := continueMerge(t.Context()); err == nil || err.Error() != "no merge in progress" {
+			t.Errorf("continueMerge() without a merge error = %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeBinaryConflict(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		if err := updateConfig("email", "merge@example.com"); err != nil {
+			return err
+		}
+
+		commitFile := func(content, message string) {
+			if err := os.WriteFile("image.png", []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write image.png: %v", err)
+			}
+			if _, _, err := addPaths(t.Context(), []string{"image.png"}, addOptions{}); err != nil {
+				t.Fatalf("addPaths(t.Context(), ) error = %v", err)
+			}
+			if _, err := createCommit(t.Context(), message); err != nil {
+				t.Fatalf("createCommit() error = %v", err)
+			}
+		}
+
+		commitFile("\x00base", "base")
+		mainBranch, err := getCurrentBranch()
+		if err != nil {
+			return err
+		}
+		base, err := resolveRevision("HEAD")
+		if err != nil {
+			return err
+		}
+		if err := createBranch("topic", base); err != nil {
+			return err
+		}
+		commitFile("\x00ours", "ours")
+		if err := checkoutBranch("topic"); err != nil {
+			return err
+		}
+		commitFile("\x00theirs", "theirs")
+		if err := checkoutBranch(mainBranch); err != nil {
+			return err
+		}
+
+		// binary files are left as our version, without markers
+		report, err := mergeBranchWithReport(t.Context(), "topic")
+		if err != nil {
+			return err
+		}
+		if content, _ := os.ReadFile("image.png"); string(content) != "\x00ours" {
+			t.Errorf("image.png after the merge = %q, expected our version", content)
+		}
+		if len(report.Paths) != 1 || !report.Paths[0].Binary || len(report.Paths[0].Hunks) != 0 {
+			t.Errorf("report paths = %+v, expected a binary conflict without hunks", report.Paths)
+		}
+		if stages, err := readConflictStages(); err != nil || len(stages["image.png"]) != 3 {
+			t.Errorf("readConflictStages() = %v, %v; expected three stages of image.png", stages, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
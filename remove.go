@@ -0,0 +1,103 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// removeTrackedPaths removes the given repository-relative paths from the
+// index and, unless cached, from the working tree, and returns the files
+// removed. A directory stands for every tracked file below it and is only
+// accepted when recursive is set. A path in conflict counts as tracked, and
+// removing it resolves the conflict. Nothing is removed unless every path
+// is tracked.
+func removeTrackedPaths(ctx context.Context, paths []string, cached, recursive bool) ([]string, error) {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stages, err := readConflictStages()
+	if err != nil {
+		return nil, err
+	}
+
+	folder := newPathFolder(index)
+
+	var removed []string
+	seen := make(map[string]bool)
+	for _, target := range paths {
+		target = folder.tracked(target)
+		_, tracked := index[target]
+		if _, conflicted := stages[target]; tracked || conflicted {
+			if !seen[target] {
+				seen[target] = true
+				removed = append(removed, target)
+			}
+			continue
+		}
+
+		var below []string
+		for path := range index {
+			if target == "." || strings.HasPrefix(path, target+"/") {
+				below = append(below, path)
+			}
+		}
+		if len(below) == 0 {
+			return nil, fmt.Errorf("file %s is not in the index", displayPath(target))
+		}
+		if !recursive {
+			return nil, fmt.Errorf("not removing %s recursively without -r", displayPath(target))
+		}
+
+		slices.Sort(below)
+		for _, path := range below {
+			if !seen[path] {
+				seen[path] = true
+				removed = append(removed, path)
+			}
+		}
+	}
+
+	if !cached {
+		for _, path := range removed {
+			if isNestedRepository(path) {
+				continue // a submodule's checkout is never deleted
+			}
+			if err := os.Remove(workTreePath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("error removing file %s: %w", displayPath(path), err)
+			}
+
+			// drop directories the removal left empty
+			for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+				if os.Remove(workTreePath(dir)) != nil {
+					break
+				}
+			}
+		}
+	}
+
+	resolved := false
+	for _, path := range removed {
+		delete(index, path)
+		if _, ok := stages[path]; ok {
+			delete(stages, path)
+			resolved = true
+		}
+	}
+	if err := writeIndex(ctx, index); err != nil {
+		return nil, err
+	}
+	if resolved {
+		if err := setConflictStages(stages); err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,53 @@
+package mygit
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveTrackedPaths(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("rm-test")
+
+	assert.NoError(t, os.MkdirAll("rm-test/src/sub", 0755))
+	for _, file := range []string{"rm-test/keep.txt", "rm-test/src/a.go", "rm-test/src/sub/b.go"} {
+		assert.NoError(t, os.WriteFile(file, []byte(file), 0644))
+		blobHash, err := createObject([]byte(file))
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), file, blobHash))
+	}
+
+	// directories need -r, untracked paths are refused, and neither removes anything
+	_, err := removeTrackedPaths(t.Context(), []string{"rm-test/keep.txt", "rm-test/src"}, false, false)
+	assert.Error(t, err)
+	_, err = removeTrackedPaths(t.Context(), []string{"rm-test/keep.txt", "rm-test/none.txt"}, false, true)
+	assert.Error(t, err)
+	_, err = os.Stat("rm-test/keep.txt")
+	assert.NoError(t, err)
+
+	// --cached leaves the files in place
+	removed, err := removeTrackedPaths(t.Context(), []string{"rm-test/src/sub"}, true, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rm-test/src/sub/b.go"}, removed)
+	_, err = os.Stat("rm-test/src/sub/b.go")
+	assert.NoError(t, err)
+
+	// a file named twice, alone and through its directory, goes once
+	removed, err = removeTrackedPaths(t.Context(), []string{"rm-test/src/a.go", "rm-test/src"}, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rm-test/src/a.go"}, removed)
+	_, err = os.Stat("rm-test/src/a.go")
+	assert.True(t, os.IsNotExist(err))
+
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rm-test/keep.txt"}, slices.Sorted(maps.Keys(index)))
+}
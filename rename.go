@@ -0,0 +1,363 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultRenameThreshold is the similarity, in percent, at which a deleted
+// file and an added one are taken for one renamed file, unless
+// diff.renameThreshold or -M says otherwise.
+const defaultRenameThreshold = 50
+
+// renameLimit caps the deleted and added files whose content is compared
+// with each other; past it only files renamed unchanged are found, as
+// every pair would have to be compared.
+const renameLimit = 1000
+
+// parseRenameThreshold parses a similarity threshold given as a percentage,
+// with or without the % sign.
+func parseRenameThreshold(value string) (int, error) {
+	threshold, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil || threshold < 0 || threshold > 100 {
+		return 0, fmt.Errorf("invalid rename threshold %q: expected a percentage from 0 to 100", value)
+	}
+
+	return threshold, nil
+}
+
+// renameThreshold returns the similarity threshold set with
+// "config diff.renameThreshold", or the default if it is not set or there
+// is no repository to set it in.
+func renameThreshold() (int, error) {
+	value, err := getConfig("renameThreshold")
+	if errors.Is(err, errConfigKeyNotFound) || errors.Is(err, ErrNotARepository) {
+		return defaultRenameThreshold, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return parseRenameThreshold(value)
+}
+
+// renameThresholdFlag is a flag.Value for -M: given alone it finds renames
+// at the configured threshold, and -M=<n> sets the threshold. A threshold
+// below zero means renames are not looked for.
+type renameThresholdFlag struct{ threshold *int }
+
+func (f renameThresholdFlag) String() string {
+	if f.threshold == nil || *f.threshold < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d%%", *f.threshold)
+}
+
+func (f renameThresholdFlag) Set(value string) error {
+	if value == "true" {
+		threshold, err := renameThreshold()
+		if err != nil {
+			return err
+		}
+		*f.threshold = threshold
+		return nil
+	}
+
+	threshold, err := parseRenameThreshold(value)
+	if err != nil {
+		return err
+	}
+	*f.threshold = threshold
+	return nil
+}
+
+func (renameThresholdFlag) IsBoolFlag() bool { return true }
+
+// contentFingerprint sums up content for similarity scoring: the number of
+// bytes in lines of each hash, and the total size.
+type contentFingerprint struct {
+	lines map[uint64]int
+	size  int
+}
+
+// fingerprint returns the fingerprint of content.
+func fingerprint(content []byte) contentFingerprint {
+	fp := contentFingerprint{lines: make(map[uint64]int), size: len(content)}
+	for _, line := range splitLines(content) {
+		h := fnv.New64a()
+		h.Write([]byte(line))
+		fp.lines[h.Sum64()] += len(line)
+	}
+
+	return fp
+}
+
+// similarity returns how alike two files are, in percent: the bytes in
+// lines they share over the size of the larger one.
+func similarity(a, b contentFingerprint) int {
+	if a.size == 0 && b.size == 0 {
+		return 100
+	}
+
+	common := 0
+	for line, n := range a.lines {
+		common += min(n, b.lines[line])
+	}
+
+	return common * 100 / max(a.size, b.size)
+}
+
+// detectRenames pairs deleted paths with added ones whose content is at
+// least threshold percent similar, and returns the changes with each pair
+// replaced by one rename ('R') at the new path, sorted by path. Files with
+// the same content are paired first, then the most similar pairs. Empty
+// files are never taken for renames, as any two are alike.
+func detectRenames(changes []fileChange, readBlob readBlobFunc, threshold int) ([]fileChange, error) {
+	var deleted, added []int
+	for i, change := range changes {
+		switch change.status {
+		case 'D':
+			deleted = append(deleted, i)
+		case 'A':
+			added = append(added, i)
+		}
+	}
+	if len(deleted) == 0 || len(added) == 0 {
+		return changes, nil
+	}
+
+	paired := make(map[int]bool)
+	var renames []fileChange
+	pair := func(from, to, score int) {
+		paired[from], paired[to] = true, true
+		renames = append(renames, fileChange{
+			path:       changes[to].path,
+			oldPath:    changes[from].path,
+			status:     'R',
+			oldHash:    changes[from].oldHash,
+			newHash:    changes[to].newHash,
+			similarity: score,
+		})
+	}
+
+	// contents are read once each, and empty ones left out
+	contents := make(map[int][]byte)
+	for _, i := range slices.Concat(deleted, added) {
+		hash := changes[i].oldHash
+		if changes[i].status == 'A' {
+			hash = changes[i].newHash
+		}
+		content, err := readBlob(hash)
+		if err != nil {
+			return nil, err
+		}
+		if len(content) > 0 {
+			contents[i] = content
+		}
+	}
+
+	// files renamed unchanged
+	for _, to := range added {
+		if contents[to] == nil {
+			continue
+		}
+		for _, from := range deleted {
+			if !paired[from] && contents[from] != nil && slices.Equal(changes[from].oldHash, changes[to].newHash) {
+				pair(from, to, 100)
+				break
+			}
+		}
+	}
+
+	// files renamed with changes, most similar first
+	if len(deleted) <= renameLimit && len(added) <= renameLimit {
+		type candidate struct{ from, to, score int }
+		var candidates []candidate
+
+		prints := make(map[int]contentFingerprint)
+		for i, content := range contents {
+			if !paired[i] {
+				prints[i] = fingerprint(content)
+			}
+		}
+		for _, from := range deleted {
+			for _, to := range added {
+				fromPrint, ok1 := prints[from]
+				toPrint, ok2 := prints[to]
+				if !ok1 || !ok2 {
+					continue
+				}
+				if score := similarity(fromPrint, toPrint); score >= threshold {
+					candidates = append(candidates, candidate{from, to, score})
+				}
+			}
+		}
+
+		// the order of changes breaks ties, so the result is stable
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+		for _, c := range candidates {
+			if !paired[c.from] && !paired[c.to] {
+				pair(c.from, c.to, c.score)
+			}
+		}
+	}
+
+	result := renames
+	for i, change := range changes {
+		if !paired[i] {
+			result = append(result, change)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].path < result[j].path })
+
+	return result, nil
+}
+
+// renamesBetween returns the paths of oldIndex that are renamed in
+// newIndex, mapped to their new paths.
+func renamesBetween(oldIndex, newIndex map[string][]byte, readBlob readBlobFunc, threshold int) (map[string]string, error) {
+	changes, err := detectRenames(diffIndexes(oldIndex, newIndex), readBlob, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	renames := make(map[string]string)
+	for _, change := range changes {
+		if change.status == 'R' {
+			renames[change.oldPath] = change.path
+		}
+	}
+
+	return renames, nil
+}
+
+// alignRenames prepares base, ours, and theirs for a three-way merge by
+// moving a file one side renamed to its new path in the other two, so the
+// rename and the other side's changes to the file merge as one file. A
+// file both sides renamed to the same path is moved in the base; one they
+// renamed to different paths, or that the other side deleted or replaced,
+// is left alone. The indexes given are not changed.
+func alignRenames(base, ours, theirs map[string][]byte, readBlob readBlobFunc, threshold int) (map[string][]byte, map[string][]byte, map[string][]byte, error) {
+	ourRenames, err := renamesBetween(base, ours, readBlob, threshold)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	theirRenames, err := renamesBetween(base, theirs, readBlob, threshold)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	base, ours, theirs = maps.Clone(base), maps.Clone(ours), maps.Clone(theirs)
+	move := func(index map[string][]byte, from, to string) {
+		index[to] = index[from]
+		delete(index, from)
+	}
+
+	// follow one side's renames in the other, oldest path first so the
+	// result does not depend on map order
+	follow := func(renames, otherRenames map[string]string, other map[string][]byte) {
+		for _, from := range slices.Sorted(maps.Keys(renames)) {
+			to := renames[from]
+			if otherTo, ok := otherRenames[from]; ok {
+				if otherTo == to {
+					move(base, from, to)
+				}
+				continue
+			}
+			if _, ok := other[from]; !ok {
+				continue // deleted on the other side
+			}
+			if _, ok := other[to]; ok {
+				continue // the other side has a file of its own there
+			}
+			move(other, from, to)
+			move(base, from, to)
+		}
+	}
+	follow(theirRenames, ourRenames, ours)
+	for from := range theirRenames {
+		delete(ourRenames, from) // already followed, or left alone
+	}
+	follow(ourRenames, nil, theirs)
+
+	return base, ours, theirs, nil
+}
+
+// printFollowLog prints the first-parent history of commitHash that
+// touched path, following the file back through renames.
+func printFollowLog(ctx context.Context, commitHash []byte, path string) error {
+	threshold, err := renameThreshold()
+	if err != nil {
+		return err
+	}
+	notes, _, err := readNotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	for len(commitHash) > 0 {
+		commit, err := readCommit(commitHash)
+		if err != nil {
+			return err
+		}
+
+		newIndex, err := commitIndex(ctx, commitHash)
+		if err != nil {
+			return err
+		}
+		oldIndex := map[string][]byte{}
+		if len(commit.parents) > 0 {
+			if oldIndex, err = commitIndex(ctx, commit.parents[0]); err != nil {
+				return err
+			}
+		}
+
+		if !slices.Equal(oldIndex[path], newIndex[path]) {
+			printCommitHeader(commitHash, commit)
+			note, err := readNote(notes, commitHash)
+			if err != nil {
+				return err
+			}
+			if note != nil {
+				printNote(note)
+			}
+
+			// a file added here either starts here or was renamed
+			if _, existed := oldIndex[path]; !existed {
+				readBlob, err := gitlinkAwareReader(oldIndex, newIndex)
+				if err != nil {
+					return err
+				}
+				renames, err := renamesBetween(oldIndex, newIndex, readBlob, threshold)
+				if err != nil {
+					return err
+				}
+
+				renamedFrom := ""
+				for from, to := range renames {
+					if to == path {
+						renamedFrom = from
+					}
+				}
+				if renamedFrom == "" {
+					return nil
+				}
+				path = renamedFrom
+			}
+		}
+
+		if len(commit.parents) == 0 {
+			return nil
+		}
+		commitHash = commit.parents[0]
+	}
+
+	return nil
+}
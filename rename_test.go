@@ -0,0 +1,157 @@
+package mygit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectRenames(t *testing.T) {
+	lines := func(from, to int, changed ...int) []byte {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			if slices.Contains(changed, i) {
+				fmt.Fprintf(&sb, "changed %d\n", i)
+			} else {
+				fmt.Fprintf(&sb, "line %d\n", i)
+			}
+		}
+		return []byte(sb.String())
+	}
+
+	oldIndex := map[string][]byte{
+		"same.txt":    []byte("unchanged content\n"),
+		"similar.txt": lines(1, 20),
+		"rewrite.txt": lines(1, 10),
+		"empty.txt":   {},
+		"kept.txt":    []byte("kept\n"),
+	}
+	newIndex := map[string][]byte{
+		"moved/same.txt": []byte("unchanged content\n"),
+		"renamed.txt":    lines(1, 20, 3, 7),
+		"other.txt":      lines(1, 10, 1, 2, 3, 4, 5, 6, 7, 8),
+		"empty2.txt":     {},
+		"kept.txt":       []byte("kept\n"),
+	}
+
+	changes, err := detectRenames(diffIndexes(oldIndex, newIndex), readBlob, defaultRenameThreshold)
+	assert.NoError(t, err)
+
+	var summary []string
+	for _, change := range changes {
+		if change.status == 'R' {
+			summary = append(summary, fmt.Sprintf("R%d %s -> %s", change.similarity, change.oldPath, change.path))
+		} else {
+			summary = append(summary, fmt.Sprintf("%c %s", change.status, change.path))
+		}
+	}
+	assert.Equal(t, []string{
+		"D empty.txt",
+		"A empty2.txt",
+		"R100 same.txt -> moved/same.txt",
+		"A other.txt",
+		"R87 similar.txt -> renamed.txt",
+		"D rewrite.txt",
+	}, summary)
+
+	// a lower threshold takes the rewritten file for a rename too
+	changes, err = detectRenames(diffIndexes(oldIndex, newIndex), readBlob, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, byte('R'), changes[3].status)
+	assert.Equal(t, "rewrite.txt", changes[3].oldPath)
+
+	threshold, err := parseRenameThreshold("75%")
+	assert.NoError(t, err)
+	assert.Equal(t, 75, threshold)
+	_, err = parseRenameThreshold("150")
+	assert.Error(t, err)
+
+	diff := formatFileDiff(changes[2], oldIndex["same.txt"], newIndex["moved/same.txt"], false, diffOptions{})
+	assert.Equal(t, "diff --git a/same.txt b/moved/same.txt\nsimilarity index 100%\nrename from same.txt\nrename to moved/same.txt\n", diff)
+}
+
+func TestAlignRenames(t *testing.T) {
+	content := []byte("one\ntwo\nthree\nfour\n")
+	edited := []byte("one\ntwo\nthree\nfour!\n")
+
+	// they renamed the file, we changed it: the change follows the rename
+	base := map[string][]byte{"old.txt": content}
+	ours := map[string][]byte{"old.txt": edited}
+	theirs := map[string][]byte{"new.txt": content}
+
+	alignedBase, alignedOurs, alignedTheirs, err := alignRenames(base, ours, theirs, readBlob, defaultRenameThreshold)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"new.txt": content}, alignedBase)
+	assert.Equal(t, map[string][]byte{"new.txt": edited}, alignedOurs)
+	assert.Equal(t, theirs, alignedTheirs)
+	assert.Equal(t, map[string][]byte{"old.txt": content}, base, "the indexes given are left alone")
+
+	merged, conflicts, err := calculateMergeTest(alignedBase, alignedOurs, alignedTheirs, "branch")
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, map[string][]byte{"new.txt": edited}, merged)
+
+	// renamed to different paths on both sides: both are kept
+	ours = map[string][]byte{"ours.txt": content}
+	theirs = map[string][]byte{"theirs.txt": content}
+	alignedBase, alignedOurs, alignedTheirs, err = alignRenames(base, ours, theirs, readBlob, defaultRenameThreshold)
+	assert.NoError(t, err)
+	assert.Equal(t, base, alignedBase)
+	assert.Equal(t, ours, alignedOurs)
+	assert.Equal(t, theirs, alignedTheirs)
+}
+
+func TestFollowLog(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("email", "follow@example.com"))
+
+		commitFiles := func(message string, files map[string]string, removed ...string) []byte {
+			for path, content := range files {
+				assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+			}
+			var paths []string
+			for path := range files {
+				paths = append(paths, path)
+			}
+			if len(paths) > 0 {
+				_, _, err := addPaths(t.Context(), paths, addOptions{})
+				assert.NoError(t, err)
+			}
+			if len(removed) > 0 {
+				_, err := removeTrackedPaths(t.Context(), removed, false, false)
+				assert.NoError(t, err)
+			}
+			hash, err := createCommit(t.Context(), message)
+			assert.NoError(t, err)
+			return hash
+		}
+
+		body := "alpha\nbeta\ngamma\ndelta\n"
+		commitFiles("add old", map[string]string{"old.txt": body})
+		commitFiles("unrelated", map[string]string{"other.txt": "other\n"})
+		head := commitFiles("rename", map[string]string{"new.txt": body + "epsilon\n"}, "old.txt")
+
+		stdout := os.Stdout
+		r, w, err := os.Pipe()
+		assert.NoError(t, err)
+		os.Stdout = w
+		err = printFollowLog(t.Context(), head, "new.txt")
+		os.Stdout = stdout
+		w.Close()
+		assert.NoError(t, err)
+
+		output, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Contains(t, string(output), "    rename\n")
+		assert.Contains(t, string(output), "    add old\n")
+		assert.NotContains(t, string(output), "unrelated")
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,306 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// repositoryMu serializes library calls. The package keeps the paths of
+// the repository it works on in package state, so only one call can be in
+// progress at a time.
+var repositoryMu sync.Mutex
+
+// Repository is a mygit repository opened for use from Go. Its methods do
+// what the commands of the same name do, returning errors instead of
+// exiting. Paths are resolved against the repository's own; the process's
+// current directory is never changed.
+//
+// Every method takes a context. Once it is done, the method stops at the
+// next object, directory entry, or commit and returns the context's error.
+// A checkout or merge stopped while writing the working tree leaves it as
+// an interrupted checkout does, to be finished or undone from the command
+// line with checkout --continue or --abort.
+type Repository struct {
+	root      string // the working tree
+	gitDir    string // the metadata directory: HEAD, index, merge state
+	commonDir string // objects, refs, and config, shared with linked worktrees
+}
+
+// Commit is a commit as Repository.Log returns it. Hashes are hexadecimal.
+type Commit struct {
+	Hash      string
+	Tree      string
+	Parents   []string
+	Author    string
+	Committer string
+	Message   string
+}
+
+// MergeResult is the outcome of Repository.Merge.
+type MergeResult struct {
+	Result    string      // up-to-date, fast-forward, merged, or conflicted
+	Commit    string      // the merge commit, when one was made
+	Conflicts []string    // conflicted paths, sorted, when the merge stopped
+	Paths     []MergePath // how each path was resolved, sorted, for three-way merges
+}
+
+// MergePath is how a merge resolved one path, as merge --report gives it.
+type MergePath struct {
+	Path       string
+	Resolution string      // base, ours, theirs, both, or conflict
+	Deleted    bool        // the side taken deleted the path
+	Kind       string      // file/directory or case for structural conflicts
+	MovedFrom  string      // where a file moved aside by a structural conflict belonged
+	Binary     bool        // a binary conflict, left as our version without markers
+	Hunks      []MergeHunk // the conflict markers written to the file
+}
+
+// MergeHunk gives the line numbers of the conflict markers of one hunk.
+type MergeHunk struct {
+	Start     int // line of <<<<<<<
+	Separator int // line of =======
+	End       int // line of >>>>>>>
+}
+
+// Init creates a repository whose working tree is dir, creating dir if
+// needed, and opens it.
+func Init(dir string) (*Repository, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(root, workTreeDirMode); err != nil {
+		return nil, fmt.Errorf("error creating directory %s: %w", root, err)
+	}
+
+	metaDir := filepath.Join(root, "."+vcsName)
+	repo := &Repository{root: root, gitDir: metaDir, commonDir: metaDir}
+	if err := repo.run(context.Background(), createDirectoriesFiles); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Open opens the repository whose working tree contains dir, looking in dir
+// and then its parents as the command line does.
+func Open(dir string) (*Repository, error) {
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", dir, err)
+	}
+
+	root, bare, found := findRepositoryRoot(start)
+	if !found {
+		return nil, fmt.Errorf("error: %w", ErrNotARepository)
+	}
+	if bare {
+		return nil, fmt.Errorf("%s is a bare repository, which has no working tree to open", root)
+	}
+
+	metaDir, err := repositoryMetaDir(root)
+	if err != nil {
+		return nil, err
+	}
+	common, err := resolveCommonDir(metaDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{root: root, gitDir: metaDir, commonDir: common}, nil
+}
+
+// Root returns the absolute path of the repository's working tree.
+func (r *Repository) Root() string {
+	return r.root
+}
+
+// run calls fn with the package state switched to the repository's paths.
+// fn passes ctx on to the operations it calls; a failure caused by ctx
+// being done is reported as the context's error.
+func (r *Repository) run(ctx context.Context, fn func() error) error {
+	repositoryMu.Lock()
+	defer repositoryMu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := withRepositoryPaths(r.root, r.gitDir, r.commonDir, fn)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// SetConfig sets a repository config value, as config <section.key>
+// <value> does.
+func (r *Repository) SetConfig(ctx context.Context, key, value string) error {
+	_, name, ok := strings.Cut(key, ".")
+	if !ok {
+		return fmt.Errorf("invalid config key: %s", key)
+	}
+
+	return r.run(ctx, func() error { return updateConfig(name, value) })
+}
+
+// Add stages the files at the given paths, relative to the repository root
+// and possibly globs, adding directories recursively as add does.
+func (r *Repository) Add(ctx context.Context, paths ...string) error {
+	return r.run(ctx, func() error {
+		// globs are matched against the files add would pick up
+		var candidates []string
+		if slices.ContainsFunc(paths, isGlobPathspec) {
+			var err error
+			if candidates, err = workTreeFiles(ctx); err != nil {
+				return err
+			}
+		}
+
+		targetPaths, err := expandPathspecs(paths, candidates)
+		if err != nil {
+			return err
+		}
+
+		return withIndexLock(func() error {
+			_, _, err := addPaths(ctx, targetPaths, addOptions{})
+			return err
+		})
+	})
+}
+
+// AddBlobs stores the content of every (path, reader) pair sources yields
+// and stages it under path, relative to the repository root, without
+// touching the working tree. Content is hashed on one worker per CPU and
+// the index is written once; if any entry fails, including an invalid path,
+// nothing is staged. It returns the staged paths, sorted.
+func (r *Repository) AddBlobs(ctx context.Context, sources iter.Seq2[string, io.Reader]) ([]string, error) {
+	var paths []string
+
+	err := r.run(ctx, func() error {
+		var err error
+		paths, err = addBlobs(ctx, sources, 0)
+		return err
+	})
+
+	return paths, err
+}
+
+// Commit records the staged changes on the current branch with the given
+// message and returns the new commit's hash.
+func (r *Repository) Commit(ctx context.Context, message string) (string, error) {
+	var commitHash []byte
+
+	err := r.run(ctx, func() error {
+		var err error
+		commitHash, err = createCommit(ctx, message)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", commitHash), nil
+}
+
+// Log returns the commit named by rev, or HEAD if rev is empty, followed by
+// its first parents, newest first. A branch without commits has no log.
+func (r *Repository) Log(ctx context.Context, rev string) ([]Commit, error) {
+	var commits []Commit
+
+	err := r.run(ctx, func() error {
+		var commitHash []byte
+		if rev == "" {
+			head, err := getHEAD()
+			if err != nil {
+				return err
+			}
+			if commitHash, err = getRef(head); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			if commitHash, err = resolveRevision(rev); err != nil {
+				return err
+			}
+		}
+
+		log, err := commitLogJSON(ctx, commitHash)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range log {
+			commits = append(commits, Commit{
+				Hash:      c.Hash,
+				Tree:      c.Tree,
+				Parents:   c.Parents,
+				Author:    c.Author,
+				Committer: c.Committer,
+				Message:   c.Message,
+			})
+		}
+		return nil
+	})
+
+	return commits, err
+}
+
+// Checkout switches the working tree, index, and HEAD to the named branch,
+// or detaches HEAD at the commit of any other revision. It refuses while
+// there are uncommitted or unstaged changes.
+func (r *Repository) Checkout(ctx context.Context, branch string) error {
+	return r.run(ctx, func() error {
+		_, err := switchBranch(ctx, branch)
+		return err
+	})
+}
+
+// Merge merges the named branch into the current one. A merge that stops
+// on conflicts is not an error: the conflicted paths are returned, with
+// markers written to the files, to be resolved and committed.
+func (r *Repository) Merge(ctx context.Context, branch string) (MergeResult, error) {
+	var result MergeResult
+
+	err := r.run(ctx, func() error {
+		if err := requireMergeable(ctx); err != nil {
+			return err
+		}
+
+		report, err := mergeBranchWithReport(ctx, branch)
+		if err != nil {
+			return err
+		}
+
+		result = MergeResult{Result: report.Result, Commit: report.Commit}
+		for _, path := range report.Paths {
+			if path.Resolution == resolutionConflict {
+				result.Conflicts = append(result.Conflicts, path.Path)
+			}
+
+			mergePath := MergePath{
+				Path:       path.Path,
+				Resolution: string(path.Resolution),
+				Deleted:    path.Deleted,
+				Kind:       string(path.Kind),
+				MovedFrom:  path.MovedFrom,
+				Binary:     path.Binary,
+			}
+			for _, hunk := range path.Hunks {
+				mergePath.Hunks = append(mergePath.Hunks, MergeHunk(hunk))
+			}
+			result.Paths = append(result.Paths, mergePath)
+		}
+		return nil
+	})
+
+	return result, err
+}
@@ -0,0 +1,184 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	ctx := t.Context()
+	root := filepath.Join(t.TempDir(), "work")
+
+	// work from somewhere else, which the repository must not touch
+	elsewhere := t.TempDir()
+	t.Chdir(elsewhere)
+
+	repo, err := Init(root)
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	assert.NoError(t, repo.SetConfig(ctx, "user.email", "library@example.com"))
+
+	// nothing committed yet
+	commits, err := repo.Log(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, commits)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("a\n"), 0644))
+	assert.NoError(t, repo.Add(ctx, "docs"))
+	baseHash, err := repo.Commit(ctx, "base")
+	assert.NoError(t, err)
+
+	// opening from a subdirectory finds the same repository
+	opened, err := Open(filepath.Join(root, "docs"))
+	assert.NoError(t, err)
+	assert.Equal(t, repo.Root(), opened.Root())
+
+	base, err := hex.DecodeString(baseHash)
+	assert.NoError(t, err)
+	assert.NoError(t, opened.run(ctx, func() error { return createBranch("feature", base) }))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "b.txt"), []byte("b\n"), 0644))
+	assert.NoError(t, opened.Add(ctx, "*.txt"))
+	headHash, err := opened.Commit(ctx, "add b")
+	assert.NoError(t, err)
+
+	commits, err = repo.Log(ctx, "")
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, headHash, commits[0].Hash)
+		assert.Equal(t, []string{baseHash}, commits[0].Parents)
+		assert.Equal(t, "add b", commits[0].Message)
+		assert.Equal(t, baseHash, commits[1].Hash)
+	}
+
+	assert.NoError(t, repo.Checkout(ctx, "feature"))
+	_, err = os.Stat(filepath.Join(root, "b.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	commits, err = repo.Log(ctx, "main")
+	assert.NoError(t, err)
+	assert.Len(t, commits, 2)
+
+	// a three-way merge of diverged branches makes a merge commit
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "c.txt"), []byte("c\n"), 0644))
+	assert.NoError(t, repo.Add(ctx, "c.txt"))
+	_, err = repo.Commit(ctx, "add c")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Checkout(ctx, "main"))
+	result, err := repo.Merge(ctx, "feature")
+	assert.NoError(t, err)
+	assert.Equal(t, "merged", result.Result)
+	assert.NotEmpty(t, result.Commit)
+	assert.Empty(t, result.Conflicts)
+	assert.Contains(t, result.Paths, MergePath{Path: "c.txt", Resolution: "theirs"})
+
+	// a done context stops an operation before or while it runs
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = repo.Log(canceled, "")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "d.txt"), []byte("d\n"), 0644))
+	stopping, stop := context.WithCancel(ctx)
+	stop()
+	err = repo.run(ctx, func() error {
+		_, _, err := addPaths(stopping, []string{"d.txt"}, addOptions{})
+		return err
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	index, err := repo.ReadIndex(ctx)
+	assert.NoError(t, err)
+	assert.NotContains(t, index, "d.txt")
+
+	// the caller's directory is left alone, during calls and after
+	assert.NoError(t, repo.run(ctx, func() error {
+		cwd, err := os.Getwd()
+		assert.Equal(t, elsewhere, cwd)
+		return err
+	}))
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, elsewhere, cwd)
+	entries, err := os.ReadDir(elsewhere)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	ctx := t.Context()
+
+	_, err := Open(t.TempDir())
+	assert.ErrorIs(t, err, ErrNotARepository)
+
+	root := filepath.Join(t.TempDir(), "work")
+	repo, err := Init(root)
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	assert.NoError(t, repo.SetConfig(ctx, "user.email", "errors@example.com"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("base\n"), 0644))
+	assert.NoError(t, repo.Add(ctx, "a.txt"))
+	_, err = repo.Commit(ctx, "base")
+	assert.NoError(t, err)
+
+	_, err = repo.ReadObject(ctx, "no-such-branch")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+	var revErr *RevisionError
+	if assert.ErrorAs(t, err, &revErr) {
+		assert.Equal(t, "no-such-branch", revErr.Rev)
+	}
+	_, err = repo.ReadObject(ctx, strings.Repeat("ab", 20))
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+
+	// diverge a.txt on two branches
+	head, err := repo.ResolveRef(ctx, "HEAD")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateRef(ctx, "refs/heads/feature", head, ""))
+	assert.ErrorIs(t, repo.UpdateRef(ctx, "refs/heads/feature", head, ""), ErrConflict)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("main\n"), 0644))
+	assert.NoError(t, repo.Add(ctx, "a.txt"))
+	_, err = repo.Commit(ctx, "main")
+	assert.NoError(t, err)
+
+	// an unstaged change stops a checkout
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("dirty\n"), 0644))
+	err = repo.Checkout(ctx, "feature")
+	assert.ErrorIs(t, err, ErrDirtyWorktree)
+	var dirty *DirtyWorktreeError
+	if assert.ErrorAs(t, err, &dirty) {
+		assert.Equal(t, "a.txt", dirty.Path)
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("main\n"), 0644))
+
+	assert.NoError(t, repo.Checkout(ctx, "feature"))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("feature\n"), 0644))
+	assert.NoError(t, repo.Add(ctx, "a.txt"))
+	_, err = repo.Commit(ctx, "feature")
+	assert.NoError(t, err)
+
+	// a conflicted merge cannot be committed, or merged again, until resolved
+	result, err := repo.Merge(ctx, "main")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, result.Conflicts)
+	assert.Contains(t, result.Paths, MergePath{
+		Path:       "a.txt",
+		Resolution: "conflict",
+		Hunks:      []MergeHunk{{Start: 1, Separator: 3, End: 5}},
+	})
+	_, err = repo.Commit(ctx, "merge")
+	assert.ErrorIs(t, err, ErrConflict)
+	var conflict *ConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, []string{"a.txt"}, conflict.Paths)
+	}
+	_, err = repo.Merge(ctx, "main")
+	assert.ErrorIs(t, err, ErrConflict)
+}
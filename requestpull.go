@@ -0,0 +1,202 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// commitsBetween returns the commits reachable from end but not from
+// start, newest first.
+func commitsBetween(start, end []byte) ([][]byte, error) {
+	excluded := make(map[string]bool)
+	pending := [][]byte{start}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		hexHash := hex.EncodeToString(hash)
+		if excluded[hexHash] {
+			continue
+		}
+		excluded[hexHash] = true
+
+		commit, err := readCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, commit.parents...)
+	}
+
+	var commits [][]byte
+	seen := make(map[string]bool)
+	queue := [][]byte{end}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+
+		hexHash := hex.EncodeToString(hash)
+		if excluded[hexHash] || seen[hexHash] {
+			continue
+		}
+		seen[hexHash] = true
+		commits = append(commits, hash)
+
+		commit, err := readCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, commit.parents...)
+	}
+
+	return commits, nil
+}
+
+// readCommit reads the commit object with the given hash.
+func readCommit(hash []byte) (commitObject, error) {
+	obj, err := catFile(hash)
+	if err != nil {
+		return commitObject{}, err
+	}
+
+	commit, ok := obj.(commitObject)
+	if !ok {
+		return commitObject{}, fmt.Errorf("object %x is not a commit", hash)
+	}
+
+	return commit, nil
+}
+
+// commitSubject returns the first line of a commit message.
+func commitSubject(commit commitObject) string {
+	subject, _, _ := strings.Cut(commit.message, "\n")
+	return subject
+}
+
+// identName returns the name part of an "Name <email> ..." identity.
+func identName(ident string) string {
+	name, _, _ := strings.Cut(ident, " <")
+	return strings.TrimSpace(name)
+}
+
+// formatShortlog groups commits by author name, in name order, listing
+// each author's subjects oldest first.
+func formatShortlog(commits [][]byte) (string, error) {
+	subjects := make(map[string][]string)
+	for _, hash := range slices.Backward(commits) {
+		commit, err := readCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		name := identName(commit.author)
+		subjects[name] = append(subjects[name], commitSubject(commit))
+	}
+
+	var sb strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(subjects)) {
+		sb.WriteString(fmt.Sprintf("%s (%d):\n", name, len(subjects[name])))
+		for _, subject := range subjects[name] {
+			sb.WriteString(fmt.Sprintf("      %s\n", subject))
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String(), nil
+}
+
+// requestPull summarizes the changes from startRev up to endRev for a
+// maintainer to pull from url: the commit range, a shortlog, and a
+// diffstat against the point where the two histories meet.
+func requestPull(ctx context.Context, startRev, url, endRev string) (string, error) {
+	start, err := resolveRevision(startRev)
+	if err != nil {
+		return "", err
+	}
+	end, err := resolveRevision(endRev)
+	if err != nil {
+		return "", err
+	}
+
+	commits, err := commitsBetween(start, end)
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no commits in %s..%s", startRev, endRev)
+	}
+
+	base, err := findCommonAncestor(start, end)
+	if err != nil {
+		return "", err
+	}
+	if base == nil {
+		return "", fmt.Errorf("%s and %s have no common commit", startRev, endRev)
+	}
+
+	startCommit, err := readCommit(start)
+	if err != nil {
+		return "", err
+	}
+	endCommit, err := readCommit(end)
+	if err != nil {
+		return "", err
+	}
+
+	// name the branch to pull when the end is one
+	location := url
+	if exists, err := refExists("refs/heads/" + endRev); err != nil {
+		return "", err
+	} else if exists {
+		location += " " + endRev
+	}
+
+	shortlog, err := formatShortlog(commits)
+	if err != nil {
+		return "", err
+	}
+
+	oldIndex, err := commitIndex(ctx, base)
+	if err != nil {
+		return "", err
+	}
+	newIndex, err := commitIndex(ctx, end)
+	if err != nil {
+		return "", err
+	}
+	readBlob, err := gitlinkAwareReader(oldIndex, newIndex)
+	if err != nil {
+		return "", err
+	}
+	stats, err := diffStat(oldIndex, newIndex, readBlob)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("The following changes since commit %x:\n\n", start))
+	sb.WriteString(fmt.Sprintf("  %s\n\n", commitSubject(startCommit)))
+	sb.WriteString("are available in the repository at:\n\n")
+	sb.WriteString(fmt.Sprintf("  %s\n\n", location))
+	sb.WriteString(fmt.Sprintf("for you to fetch changes up to %x:\n\n", end))
+	sb.WriteString(fmt.Sprintf("  %s\n\n", commitSubject(endCommit)))
+	sb.WriteString(strings.Repeat("-", 64) + "\n")
+	sb.WriteString(shortlog)
+	sb.WriteString(formatDiffStat(stats))
+
+	return sb.String(), nil
+}
+
+// repositoryHasCommit reports whether the local repository at url holds
+// the commit. A url that is not a local repository is reported as missing.
+func repositoryHasCommit(url string, hash []byte) bool {
+	found := false
+	withRepository(url, func() error {
+		found = objectExists(hash)
+		return nil
+	})
+
+	return found
+}
@@ -0,0 +1,70 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestPull(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "pull@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	commit := func(files map[string]string, message string, parents ...[]byte) []byte {
+		index := make(map[string][]byte)
+		for path, content := range files {
+			hash, err := createObject([]byte(content))
+			assert.NoError(t, err)
+			index[path] = hash
+		}
+		treeHash, err := buildTreeObject(index)
+		assert.NoError(t, err)
+		hash, err := writeCommitObject(treeHash, parents, message)
+		assert.NoError(t, err)
+		return hash
+	}
+
+	base := commit(map[string]string{"README": "hello\n"}, "base")
+	first := commit(map[string]string{"README": "hello\nworld\n"}, "extend readme", base)
+	second := commit(map[string]string{"README": "hello\nworld\n", "NEWS": "news\n"}, "add news\n\nwith a body", first)
+	assert.NoError(t, updateRef("refs/heads/main", base))
+	assert.NoError(t, updateRef("refs/heads/topic", second))
+
+	commits, err := commitsBetween(base, second)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{second, first}, commits)
+
+	summary, err := requestPull(t.Context(), "main", "/srv/project", "topic")
+	assert.NoError(t, err)
+
+	expected := strings.Join([]string{
+		fmt.Sprintf("The following changes since commit %x:", base), "",
+		"  base", "",
+		"are available in the repository at:", "",
+		"  /srv/project topic", "",
+		fmt.Sprintf("for you to fetch changes up to %x:", second), "",
+		"  add news", "",
+		strings.Repeat("-", 64),
+		"Author (2):",
+		"      extend readme",
+		"      add news",
+		"",
+		" NEWS   | 1 +",
+		" README | 1 +",
+		" 2 files changed, 2 insertions(+)",
+		"",
+	}, "\n")
+	assert.Equal(t, expected, summary)
+
+	_, err = requestPull(t.Context(), "topic", "/srv/project", "main")
+	assert.ErrorContains(t, err, "no commits")
+}
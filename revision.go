@@ -0,0 +1,228 @@
+package mygit
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	minHashPrefixLen = 4 // shortest abbreviated hash accepted
+	abbrevHashLen    = 7 // default length of printed abbreviated hashes
+)
+
+// resolveRevision resolves a revision expression to a binary object hash.
+// The base may be HEAD, a branch, a tag, or a full or abbreviated hex hash,
+// optionally followed by any number of ~N (N-th first-parent ancestor) and
+// ^N (N-th parent) suffixes.
+func resolveRevision(rev string) ([]byte, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	base := rev
+	suffix := ""
+	if i := strings.IndexAny(rev, "~^"); i != -1 {
+		base, suffix = rev[:i], rev[i:]
+	}
+
+	if base == "" {
+		return nil, &RevisionError{Rev: rev}
+	}
+
+	hash, err := resolveRevisionBase(base)
+	if err != nil {
+		return nil, err
+	}
+
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+
+		// read the optional number following the operator
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+
+		n := 1
+		if digits > 0 {
+			n, err = strconv.Atoi(suffix[:digits])
+			if err != nil {
+				return nil, fmt.Errorf("invalid revision %s: %w", rev, err)
+			}
+		}
+		suffix = suffix[digits:]
+
+		switch op {
+		case '~':
+			for range n {
+				if hash, err = nthParent(hash, 1); err != nil {
+					return nil, fmt.Errorf("invalid revision %s: %w", rev, err)
+				}
+			}
+		case '^':
+			if hash, err = nthParent(hash, n); err != nil {
+				return nil, fmt.Errorf("invalid revision %s: %w", rev, err)
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+// resolveRevisionBase resolves a revision without ancestry suffixes.
+func resolveRevisionBase(name string) ([]byte, error) {
+	if name == "HEAD" {
+		head, err := getHEAD()
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err := getRef(head)
+		if err != nil {
+			return nil, err
+		}
+		if hash == nil {
+			return nil, fmt.Errorf("HEAD has no commits")
+		}
+
+		return hash, nil
+	}
+
+	// branch and tag names take precedence over hashes
+	for _, refPath := range []string{
+		fmt.Sprintf("refs/heads/%s", name),
+		fmt.Sprintf("refs/tags/%s", name),
+	} {
+		exists, err := refExists(refPath)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		hash, err := getRef(refPath)
+		if err != nil {
+			return nil, err
+		}
+		if hash == nil {
+			return nil, fmt.Errorf("%s has no commits", name)
+		}
+
+		return hash, nil
+	}
+
+	if hash, err := hex.DecodeString(name); err == nil && len(hash) == hashSize() {
+		return hash, nil
+	}
+
+	// ids from before a hash migration resolve to their replacements
+	if newHex, ok, err := translateHash(name); err != nil {
+		return nil, err
+	} else if ok && len(newHex) == 2*hashSize() {
+		return hex.DecodeString(newHex)
+	}
+
+	if len(name) >= minHashPrefixLen && isHex(name) {
+		return resolveHashPrefix(name)
+	}
+
+	return nil, &RevisionError{Rev: name}
+}
+
+// nthParent returns the n-th parent of a commit; n == 0 returns the commit itself.
+func nthParent(commitHash []byte, n int) ([]byte, error) {
+	if n == 0 {
+		return commitHash, nil
+	}
+
+	obj, err := catFile(commitHash)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, ok := obj.(commitObject)
+	if !ok {
+		return nil, fmt.Errorf("object %x is not a commit", commitHash)
+	}
+
+	if n > len(commit.parents) || len(commit.parents[n-1]) == 0 {
+		return nil, fmt.Errorf("commit %x has no parent %d", commitHash, n)
+	}
+
+	return commit.parents[n-1], nil
+}
+
+// resolveHashPrefix finds the unique stored object whose hex hash starts
+// with prefix. It is an error if none or several objects match.
+func resolveHashPrefix(prefix string) ([]byte, error) {
+	prefix = strings.ToLower(prefix)
+
+	dirPath := fmt.Sprintf("%s/objects/%s", commonDir, prefix[:2])
+	entries, err := os.ReadDir(dirPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading object directory: %w", err)
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix[2:]) {
+			matches = append(matches, prefix[:2]+entry.Name())
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, &RevisionError{Rev: prefix}
+	case 1:
+		return hex.DecodeString(matches[0])
+	default:
+		return nil, fmt.Errorf("short hash %s is ambiguous (%d objects match)", prefix, len(matches))
+	}
+}
+
+// abbrevHash returns the shortest prefix of the hash, at least abbrevHashLen
+// characters long, that does not match any other stored object.
+func abbrevHash(hash []byte) string {
+	full := fmt.Sprintf("%x", hash)
+	if len(full) < abbrevHashLen {
+		return full
+	}
+
+	entries, err := os.ReadDir(fmt.Sprintf("%s/objects/%s", commonDir, full[:2]))
+	if err != nil {
+		return full[:abbrevHashLen]
+	}
+
+	length := abbrevHashLen
+	for _, entry := range entries {
+		other := full[:2] + entry.Name()
+		if other == full {
+			continue
+		}
+
+		// grow the prefix until it no longer matches this object
+		for length < len(full) && strings.HasPrefix(other, full[:length]) {
+			length++
+		}
+	}
+
+	return full[:length]
+}
+
+// isHex reports whether s consists only of hexadecimal digits.
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+
+	return true
+}
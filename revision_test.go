@@ -0,0 +1,108 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRevision(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "test@example.com"); err != nil {
+		t.Fatalf("Failed to set config: %v", err)
+	}
+
+	// build a small history: c1 <- c2 <- merge(c2, side)
+	treeHash, err := buildTreeObject(map[string][]byte{})
+	if err != nil {
+		t.Fatalf("error building tree: %v", err)
+	}
+
+	c1, err := writeCommitObject(treeHash, nil, "first")
+	if err != nil {
+		t.Fatalf("error writing commit: %v", err)
+	}
+	c2, err := writeCommitObject(treeHash, [][]byte{c1}, "second")
+	if err != nil {
+		t.Fatalf("error writing commit: %v", err)
+	}
+	side, err := writeCommitObject(treeHash, [][]byte{c1}, "side")
+	if err != nil {
+		t.Fatalf("error writing commit: %v", err)
+	}
+	merge, err := writeCommitObject(treeHash, [][]byte{c2, side}, "merge")
+	if err != nil {
+		t.Fatalf("error writing commit: %v", err)
+	}
+
+	if err := updateRef("refs/heads/main", merge); err != nil {
+		t.Fatalf("error updating ref: %v", err)
+	}
+	if err := createBranch("side", side); err != nil {
+		t.Fatalf("error creating branch: %v", err)
+	}
+
+	tests := []struct {
+		rev      string
+		expected []byte
+	}{
+		{"HEAD", merge},
+		{"main", merge},
+		{"HEAD^", c2},
+		{"HEAD^1", c2},
+		{"HEAD^2", side},
+		{"HEAD~2", c1},
+		{"HEAD^2~1", c1},
+		{"HEAD^0", merge},
+		{"side", side},
+		{fmt.Sprintf("%x", c2), c2},
+	}
+
+	for _, tt := range tests {
+		hash, err := resolveRevision(tt.rev)
+		assert.NoError(t, err, "resolving %s", tt.rev)
+		assert.Equal(t, tt.expected, hash, "resolving %s", tt.rev)
+	}
+
+	_, err = resolveRevision("HEAD~5")
+	assert.Error(t, err, "walking past the root commit should fail")
+
+	_, err = resolveRevision("nonexistent")
+	assert.Error(t, err, "unknown names should fail")
+}
+
+func TestHashPrefixes(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	// two fake objects sharing their first 9 hex digits
+	names := []string{
+		"abcdef012" + "3456789abcdef0123456789abcdef01",
+		"abcdef012" + "fedcba9876543210fedcba987654321",
+	}
+	if err := os.MkdirAll(fmt.Sprintf(".%s/objects/ab", vcsName), 0755); err != nil {
+		t.Fatalf("Failed to create object dir: %v", err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(fmt.Sprintf(".%s/objects/ab/%s", vcsName, name[2:]), nil, 0644); err != nil {
+			t.Fatalf("Failed to write fake object: %v", err)
+		}
+	}
+
+	_, err := resolveRevision("abcdef")
+	assert.Error(t, err, "ambiguous prefix should fail")
+
+	hash, err := resolveRevision("abcdef0123")
+	assert.NoError(t, err)
+	assert.Equal(t, names[0], fmt.Sprintf("%x", hash))
+
+	assert.Equal(t, "abcdef0123", abbrevHash(hash), "abbreviation should grow until unique")
+}
@@ -0,0 +1,228 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// snapshotRefPath returns the hidden ref that holds snapshots for the given branch.
+func snapshotRefPath(branchName string) string {
+	return fmt.Sprintf("refs/snapshots/%s", branchName)
+}
+
+// getSnapshotRef returns the latest snapshot commit for the given branch,
+// or nil if no snapshot has been recorded yet.
+func getSnapshotRef(branchName string) ([]byte, error) {
+	refPath := snapshotRefPath(branchName)
+	exists, err := refExists(refPath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	return getRef(refPath)
+}
+
+// indexWorkingTree stores every file in the working directory that add
+// would consider, tracked or not ignored, as a blob and returns the
+// resulting path to hash mapping. The real index is not touched.
+func indexWorkingTree(ctx context.Context) (map[string][]byte, error) {
+	tracked, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	folder := newPathFolder(tracked)
+
+	rules, err := loadIgnoreRules()
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string][]byte)
+	err = walkWorkTree(".", func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if isVCSEntry(path, d) {
+			return skipWalkEntry(d) // skip VCS dir
+		}
+
+		if _, ok := tracked[folder.tracked(path)]; !ok && path != "." && rules.ignored(path, d.IsDir()) {
+			return skipWalkEntry(d) // ignored and untracked
+		}
+
+		if d.IsDir() {
+			if isNestedRepository(path) {
+				return filepath.SkipDir // submodules keep their own history
+			}
+			return nil
+		}
+
+		content, err := os.ReadFile(workTreePath(path))
+		if err != nil {
+			return fmt.Errorf("error reading file %s: %w", path, err)
+		}
+
+		hash, err := createObject(content)
+		if err != nil {
+			return fmt.Errorf("error creating object for file %s: %w", path, err)
+		}
+
+		index[path] = hash
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error snapshotting working tree: %w", err)
+	}
+
+	return index, nil
+}
+
+// createSnapshot records the working tree as a commit on the snapshot ref of
+// the current branch. It returns nil if the working tree is unchanged since
+// the previous snapshot.
+func createSnapshot(ctx context.Context) ([]byte, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	branchName, err := getCurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := indexWorkingTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	treeHash, err := buildTreeObject(index)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := getSnapshotRef(branchName)
+	if err != nil {
+		return nil, err
+	}
+
+	var parents [][]byte
+	if previous != nil {
+		obj, err := catFile(previous)
+		if err != nil {
+			return nil, err
+		}
+
+		commit, ok := obj.(commitObject)
+		if !ok {
+			return nil, fmt.Errorf("object %x is not a commit", previous)
+		}
+
+		if slices.Equal(commit.hash, treeHash) {
+			return nil, nil // nothing changed
+		}
+
+		parents = append(parents, previous)
+	}
+
+	message := fmt.Sprintf("snapshot of %s at %s", branchName, time.Now().Format(time.RFC3339))
+	commitHash, err := writeCommitObject(treeHash, parents, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(fmt.Sprintf("%s/refs/snapshots", commonDir), 0755); err != nil {
+		return nil, fmt.Errorf("error creating snapshots directory: %w", err)
+	}
+
+	if err := compareAndSwapRef(snapshotRefPath(branchName), previous, commitHash); err != nil {
+		return nil, err
+	}
+
+	return commitHash, nil
+}
+
+// listSnapshots prints the snapshot history of the current branch, newest first.
+func listSnapshots() error {
+	branchName, err := getCurrentBranch()
+	if err != nil {
+		return err
+	}
+
+	current, err := getSnapshotRef(branchName)
+	if err != nil {
+		return err
+	}
+
+	for len(current) > 0 {
+		obj, err := catFile(current)
+		if err != nil {
+			return err
+		}
+
+		commit, ok := obj.(commitObject)
+		if !ok {
+			return fmt.Errorf("object %x is not a commit", current)
+		}
+
+		fmt.Printf("%x %s\n", current, commit.message)
+
+		if len(commit.parents) == 0 {
+			break
+		}
+		current = commit.parents[0]
+	}
+
+	return nil
+}
+
+// restoreSnapshot writes the files recorded in the given snapshot commit to
+// the working directory. The index and HEAD are left untouched.
+func restoreSnapshot(ctx context.Context, commitHash []byte) error {
+	obj, err := catFile(commitHash)
+	if err != nil {
+		return err
+	}
+
+	commit, ok := obj.(commitObject)
+	if !ok {
+		return fmt.Errorf("object %x is not a commit", commitHash)
+	}
+
+	if _, err := buildIndexFromTree(ctx, commit.hash, "", true); err != nil {
+		return fmt.Errorf("error restoring snapshot %x: %w", commitHash, err)
+	}
+
+	return nil
+}
+
+// autosaveSnapshots records a snapshot every interval until the process is stopped.
+func autosaveSnapshots(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		commitHash, err := createSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+
+		if commitHash != nil {
+			fmt.Printf("Saved snapshot %x\n", commitHash)
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,78 @@
+package mygit
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshots(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("email", "snapshot@example.com"))
+		assert.NoError(t, os.WriteFile(ignoreFileName, []byte("*.log\nbuild/\n"), 0644))
+		assert.NoError(t, os.WriteFile("a.txt", []byte("first\n"), 0644))
+		assert.NoError(t, os.WriteFile("debug.log", []byte("noise\n"), 0644))
+		assert.NoError(t, os.MkdirAll("build", 0755))
+		assert.NoError(t, os.WriteFile("build/out.bin", []byte("binary\n"), 0644))
+
+		// a tracked file is kept even if it matches an ignore rule
+		assert.NoError(t, os.WriteFile("kept.log", []byte("tracked\n"), 0644))
+		blobHash, err := createObject([]byte("tracked\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, updateIndex(t.Context(), "kept.log", blobHash))
+
+		first, err := createSnapshot(t.Context())
+		assert.NoError(t, err)
+		assert.NotNil(t, first)
+
+		obj, err := catFile(first)
+		assert.NoError(t, err)
+		files, err := buildIndexFromTree(t.Context(), obj.(commitObject).hash, "", false)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{ignoreFileName, "a.txt", "kept.log"}, slices.Collect(maps.Keys(files)))
+
+		// nothing changed, nothing saved, even if ignored files did
+		assert.NoError(t, os.WriteFile("debug.log", []byte("more noise\n"), 0644))
+		unchanged, err := createSnapshot(t.Context())
+		assert.NoError(t, err)
+		assert.Nil(t, unchanged)
+
+		assert.NoError(t, os.WriteFile("a.txt", []byte("second\n"), 0644))
+		second, err := createSnapshot(t.Context())
+		assert.NoError(t, err)
+		assert.NotNil(t, second)
+
+		// list shows the newest snapshot first
+		stdout := os.Stdout
+		r, w, err := os.Pipe()
+		assert.NoError(t, err)
+		os.Stdout = w
+		err = listSnapshots()
+		os.Stdout = stdout
+		w.Close()
+		assert.NoError(t, err)
+
+		output, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Regexp(t, fmt.Sprintf("^%x snapshot of main at .*\n%x snapshot of main at .*\n$", second, first), string(output))
+
+		// restore brings back the files of the snapshot and leaves the index alone
+		assert.NoError(t, os.WriteFile("a.txt", []byte("lost\n"), 0644))
+		assert.NoError(t, restoreSnapshot(t.Context(), first))
+		content, err := os.ReadFile("a.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "first\n", string(content))
+
+		index, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"kept.log": blobHash}, index)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,428 @@
+package mygit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sparseCheckoutFile lists the directories of the sparse-checkout cone, one
+// per line. It lives in the worktree's metadata directory, so each linked
+// worktree can have its own cone.
+const sparseCheckoutFile = "info/sparse-checkout"
+
+// sparseCone is a cone-mode sparse checkout: the working tree holds every
+// file directly in the root, every file below one of dirs, and the files
+// directly in the parents of those directories. Everything else stays in
+// the index only. A cone without dirs checks out everything.
+type sparseCone struct {
+	dirs []string // repository-relative directories, sorted, without trailing slashes
+}
+
+// sparseCheckoutPath returns the path of the cone file of the current
+// worktree.
+func sparseCheckoutPath() string {
+	return filepath.Join(gitDir, filepath.FromSlash(sparseCheckoutFile))
+}
+
+// loadSparseCone reads the cone of the current worktree. Without a cone
+// file, the checkout is not sparse.
+func loadSparseCone() (sparseCone, error) {
+	f, err := os.Open(sparseCheckoutPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return sparseCone{}, nil
+	}
+	if err != nil {
+		return sparseCone{}, fmt.Errorf("error reading %s: %w", sparseCheckoutFile, err)
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if dir := strings.TrimSpace(scanner.Text()); dir != "" && !strings.HasPrefix(dir, "#") {
+			dirs = append(dirs, dir)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return sparseCone{}, fmt.Errorf("error reading %s: %w", sparseCheckoutFile, err)
+	}
+
+	return newSparseCone(dirs)
+}
+
+// newSparseCone returns the cone of the given directories, cleaned, sorted,
+// and without those already inside another.
+func newSparseCone(dirs []string) (sparseCone, error) {
+	var cleaned []string
+	for _, dir := range dirs {
+		clean := path.Clean(filepath.ToSlash(dir))
+		if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+			return sparseCone{}, fmt.Errorf("invalid sparse-checkout directory %s: directories are relative to the repository root", dir)
+		}
+		cleaned = append(cleaned, clean)
+	}
+	slices.Sort(cleaned)
+
+	var cone sparseCone
+	for _, dir := range slices.Compact(cleaned) {
+		if !slices.ContainsFunc(cone.dirs, func(outer string) bool { return isPathWithin(dir, outer) }) {
+			cone.dirs = append(cone.dirs, dir)
+		}
+	}
+
+	return cone, nil
+}
+
+// isPathWithin reports whether p is dir or below it.
+func isPathWithin(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// enabled reports whether the checkout is sparse.
+func (c sparseCone) enabled() bool {
+	return len(c.dirs) > 0
+}
+
+// outsideDir returns the outermost directory containing filePath that lies
+// entirely outside the cone, or false if filePath is checked out. Every
+// path below that directory is outside too, so a sparse index stores it
+// as a single entry.
+func (c sparseCone) outsideDir(filePath string) (string, bool) {
+	if !c.enabled() {
+		return "", false
+	}
+
+	for i := 0; i < len(filePath); i++ {
+		if filePath[i] != '/' {
+			continue
+		}
+
+		dir := filePath[:i]
+		if slices.ContainsFunc(c.dirs, func(coneDir string) bool { return isPathWithin(dir, coneDir) }) {
+			return "", false // inside the cone
+		}
+		if !slices.ContainsFunc(c.dirs, func(coneDir string) bool { return isPathWithin(coneDir, dir) }) {
+			return dir, true // neither in the cone nor leading to it
+		}
+	}
+
+	// a file directly in the root or in a parent of a cone directory
+	return "", false
+}
+
+// contains reports whether filePath is checked out.
+func (c sparseCone) contains(filePath string) bool {
+	_, outside := c.outsideDir(filePath)
+	return !outside
+}
+
+// containsEntry reports whether a working tree entry is in the cone. A
+// directory is when some of the files below it are.
+func (c sparseCone) containsEntry(entryPath string, isDir bool) bool {
+	entryPath = filepath.ToSlash(entryPath)
+	if entryPath == "." {
+		return true
+	}
+	if isDir {
+		entryPath += "/"
+	}
+
+	return c.contains(entryPath)
+}
+
+// isSparseDirEntry reports whether an index path is a sparse directory
+// entry: a directory outside the cone, stored with a trailing slash and the
+// hash of its tree in place of the entries of its files.
+func isSparseDirEntry(indexPath string) bool {
+	return strings.HasSuffix(indexPath, "/")
+}
+
+// sparseIndexEnabled reports whether the index of the current worktree is
+// kept sparse: core.sparseIndex is true and the checkout is sparse.
+func sparseIndexEnabled(cone sparseCone) bool {
+	if !cone.enabled() {
+		return false
+	}
+
+	value, err := getConfig("sparseIndex")
+	return err == nil && strings.EqualFold(value, "true")
+}
+
+// expandSparseIndex replaces the sparse directory entries of an index with
+// the files of their trees, giving the index every command understands.
+func expandSparseIndex(ctx context.Context, index map[string][]byte) (map[string][]byte, error) {
+	for indexPath, hash := range index {
+		if !isSparseDirEntry(indexPath) {
+			continue
+		}
+
+		dir := strings.TrimSuffix(indexPath, "/")
+		files, err := buildIndexFromTree(ctx, hash, dir, false)
+		if err != nil {
+			return nil, fmt.Errorf("error expanding sparse directory %s: %w", dir, err)
+		}
+
+		delete(index, indexPath)
+		for filePath, fileHash := range files {
+			index[filepath.ToSlash(filePath)] = fileHash
+		}
+	}
+
+	return index, nil
+}
+
+// collapseSparseIndex replaces the entries of every directory outside the
+// cone with one sparse directory entry for its tree. The tree hash comes
+// from the cache tree when it is still valid, so an unchanged directory
+// costs nothing; otherwise its tree objects are written.
+func collapseSparseIndex(index map[string][]byte, cone sparseCone, cache map[string][]byte) (map[string][]byte, error) {
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, err
+	}
+
+	collapsed := make(map[string][]byte, len(index))
+	outside := make(map[string]map[string][]byte) // directory -> its entries, relative to it
+
+	for indexPath, hash := range index {
+		dir, ok := cone.outsideDir(indexPath)
+		if !ok {
+			collapsed[indexPath] = hash
+			continue
+		}
+
+		if outside[dir] == nil {
+			outside[dir] = make(map[string][]byte)
+		}
+		outside[dir][strings.TrimPrefix(indexPath, dir+"/")] = hash
+	}
+
+	for dir, entries := range outside {
+		if hash, ok := entries[""]; ok && len(entries) == 1 {
+			collapsed[dir+"/"] = hash // already a sparse entry
+			continue
+		}
+
+		treeHash, err := buildTreeRecursive(entries, dir, gitlinks, cache, writeTreeObject)
+		if err != nil {
+			return nil, fmt.Errorf("error collapsing sparse directory %s: %w", dir, err)
+		}
+		collapsed[dir+"/"] = treeHash
+	}
+
+	return collapsed, nil
+}
+
+// readSparseIndex reads the index as stored, keeping sparse directory
+// entries collapsed. Commands that only look inside the cone use it so
+// their cost follows the cone rather than the whole repository.
+func readSparseIndex() (map[string][]byte, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	return parseIndexFile(fmt.Sprintf("%s/index", gitDir))
+}
+
+// sparseTreeIndex is like buildIndexFromTree without writing files, but
+// directories outside the cone become sparse directory entries instead of
+// being read.
+func sparseTreeIndex(treeHash []byte, dir string, cone sparseCone) (map[string][]byte, error) {
+	index := make(map[string][]byte)
+
+	entries, err := listTreeEntries(treeHash, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		entryPath := joinTreePath(dir, entry.name)
+
+		if entry.objType != "tree" {
+			index[entryPath] = entry.hash
+			continue
+		}
+
+		if outside, ok := cone.outsideDir(entryPath + "/"); ok && outside == entryPath {
+			index[entryPath+"/"] = entry.hash
+			continue
+		}
+
+		subIndex, err := sparseTreeIndex(entry.hash, entryPath, cone)
+		if err != nil {
+			return nil, err
+		}
+		for subPath, hash := range subIndex {
+			index[subPath] = hash
+		}
+	}
+
+	return index, nil
+}
+
+// readConeIndex reads the index the way commands that only look inside the
+// cone want it: collapsed with a sparse index, expanded otherwise.
+func readConeIndex(ctx context.Context, cone sparseCone) (map[string][]byte, error) {
+	if sparseIndexEnabled(cone) {
+		return readSparseIndex()
+	}
+
+	return readIndex(ctx)
+}
+
+// statusIndexes returns the index of HEAD and the index, for comparing.
+// With a sparse index both keep directories outside the cone collapsed, so
+// an untouched directory compares as one entry.
+func statusIndexes(ctx context.Context) (map[string][]byte, map[string][]byte, error) {
+	cone, err := loadSparseCone()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !sparseIndexEnabled(cone) {
+		headIndex, err := headCommitIndex(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		index, err := readIndex(ctx)
+		return headIndex, index, err
+	}
+
+	headIndex := make(map[string][]byte)
+	head, err := getHEAD()
+	if err != nil {
+		return nil, nil, err
+	}
+	headHash, err := getRef(head)
+	if err != nil {
+		return nil, nil, err
+	}
+	if headHash != nil {
+		treeHash, err := resolveTreeHash(headHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if headIndex, err = sparseTreeIndex(treeHash, ".", cone); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	index, err := readSparseIndex()
+	return headIndex, index, err
+}
+
+// setSparseCheckout makes dirs the cone of the current worktree, or with
+// no dirs turns sparse checkout off: files leaving the cone are removed
+// from the working tree and files entering it are written, and the index
+// is rewritten, collapsed if core.sparseIndex is set. It refuses, changing
+// nothing, if a file to be removed has changes that are not committed to
+// the index.
+func setSparseCheckout(ctx context.Context, dirs []string) error {
+	if err := requireNoInterruptedCheckout(); err != nil {
+		return err
+	}
+
+	cone, err := newSparseCone(dirs)
+	if err != nil {
+		return err
+	}
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return err
+	}
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return err
+	}
+	conv, err := loadContentConversion()
+	if err != nil {
+		return err
+	}
+
+	var remove, restore []string
+	for _, filePath := range slices.Sorted(maps.Keys(index)) {
+		if gitlinks[filePath] {
+			continue // submodules are left as they are
+		}
+
+		_, statErr := os.Lstat(workTreePath(filePath))
+		present := statErr == nil
+
+		switch {
+		case cone.contains(filePath) && !present:
+			restore = append(restore, filePath)
+		case !cone.contains(filePath) && present:
+			content, err := os.ReadFile(workTreePath(filePath))
+			if err != nil {
+				return fmt.Errorf("error reading file %s: %w", filePath, err)
+			}
+			contentHash, err := conv.hashWorkTreeContent(ctx, filePath, content)
+			if err != nil {
+				return err
+			}
+			if !slices.Equal(contentHash, index[filePath]) {
+				return errorOf(ErrDirtyWorktree, "cannot leave %s out of the sparse checkout: it has changes that are not staged", filePath)
+			}
+			remove = append(remove, filePath)
+		}
+	}
+
+	for _, filePath := range restore {
+		if err := restoreJournaledFile(ctx, filePath, index[filePath]); err != nil {
+			return err
+		}
+	}
+	for _, filePath := range remove {
+		if err := os.Remove(workTreePath(filePath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error removing %s: %w", filePath, err)
+		}
+		removeEmptyParents(filePath)
+	}
+
+	if err := writeSparseCone(cone); err != nil {
+		return err
+	}
+
+	return writeIndex(ctx, index)
+}
+
+// writeSparseCone stores the cone, removing the cone file when it is empty.
+func writeSparseCone(cone sparseCone) error {
+	if !cone.enabled() {
+		if err := os.Remove(sparseCheckoutPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error removing %s: %w", sparseCheckoutFile, err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sparseCheckoutPath()), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", filepath.Dir(sparseCheckoutFile), err)
+	}
+
+	content := strings.Join(cone.dirs, "\n") + "\n"
+	if err := os.WriteFile(sparseCheckoutPath(), []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", sparseCheckoutFile, err)
+	}
+
+	return nil
+}
+
+// removeEmptyParents removes the directories above filePath that are left
+// empty, stopping at the first one that is not.
+func removeEmptyParents(filePath string) {
+	for dir := filepath.Dir(filePath); dir != "."; dir = filepath.Dir(dir) {
+		if os.Remove(workTreePath(dir)) != nil {
+			return
+		}
+	}
+}
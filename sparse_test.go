@@ -0,0 +1,113 @@
+package mygit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparseConeOutsideDir(t *testing.T) {
+	cone, err := newSparseCone([]string{"a/b", "a/b/c", "x/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/b", "x"}, cone.dirs)
+
+	for filePath, outside := range map[string]string{
+		"top.txt":     "",
+		"a/file":      "",
+		"a/b/c/d/e":   "",
+		"x/y/z":       "",
+		"a/c/file":    "a/c",
+		"a/bb/file":   "a/bb",
+		"d/e/f":       "d",
+		"a/c/":        "a/c",
+		"xylophone/f": "xylophone",
+	} {
+		dir, ok := cone.outsideDir(filePath)
+		assert.Equal(t, outside != "", ok, filePath)
+		assert.Equal(t, outside, dir, filePath)
+	}
+
+	_, err = newSparseCone([]string{"../up"})
+	assert.Error(t, err)
+	assert.True(t, sparseCone{}.contains("any/path"))
+}
+
+func TestSparseIndex(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repo")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+
+	err := withRepositoryInit(dir, func() error {
+		files := []string{"top.txt", "a/x.txt", "a/b/y.txt", "a/c/z.txt", "d/e/w.txt"}
+		for _, path := range files {
+			assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			assert.NoError(t, os.WriteFile(path, []byte(path+"\n"), 0644))
+		}
+		_, _, err := addPaths(t.Context(), []string{"."}, addOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, updateConfig("email", "sparse@example.com"))
+		base, err := createCommit(t.Context(), "base")
+		assert.NoError(t, err)
+		baseTree, err := resolveTreeHash(base)
+		assert.NoError(t, err)
+
+		// the cone checks out a/b and the files of a, and nothing else
+		assert.NoError(t, updateConfig("sparseIndex", "true"))
+		assert.NoError(t, setSparseCheckout(t.Context(), []string{"a/b"}))
+		checkedOut, err := workTreeFiles(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a/b/y.txt", "a/x.txt", "top.txt"}, checkedOut)
+
+		// a/c and d are single entries on disk, but every command sees the files
+		stored, err := readSparseIndex()
+		assert.NoError(t, err)
+		assert.Contains(t, stored, "a/c/")
+		assert.Contains(t, stored, "d/")
+		assert.NotContains(t, stored, "d/e/w.txt")
+		full, err := readIndex(t.Context())
+		assert.NoError(t, err)
+		assert.Len(t, full, len(files))
+
+		entries, err := collectStatusEntries(t.Context())
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		// paths outside the cone cannot be added
+		assert.NoError(t, os.MkdirAll("d", 0755))
+		assert.NoError(t, os.WriteFile("d/new.txt", []byte("new\n"), 0644))
+		_, _, err = addPaths(t.Context(), []string{"d"}, addOptions{})
+		assert.ErrorContains(t, err, "outside the sparse-checkout cone")
+
+		assert.NoError(t, os.RemoveAll("d"))
+
+		// a commit inside the cone keeps the collapsed trees as they were
+		assert.NoError(t, os.WriteFile("a/b/y.txt", []byte("changed\n"), 0644))
+		_, _, err = addPaths(t.Context(), []string{"a/b/y.txt"}, addOptions{})
+		assert.NoError(t, err)
+		entries, err = collectStatusEntries(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, []statusEntry{{staged: 'M', unstaged: ' ', path: "a/b/y.txt"}}, entries)
+		commit, err := createCommit(t.Context(), "in cone")
+		assert.NoError(t, err)
+		commitFiles, err := commitIndex(t.Context(), commit)
+		assert.NoError(t, err)
+		baseFiles, err := buildIndexFromTree(t.Context(), baseTree, "", false)
+		assert.NoError(t, err)
+		assert.Len(t, commitFiles, len(files))
+		assert.Equal(t, baseFiles["d/e/w.txt"], commitFiles["d/e/w.txt"])
+
+		// leaving sparse checkout brings every file back
+		assert.NoError(t, setSparseCheckout(t.Context(), nil))
+		checkedOut, err = workTreeFiles(t.Context())
+		assert.NoError(t, err)
+		assert.Len(t, checkedOut, len(files))
+		stored, err = readSparseIndex()
+		assert.NoError(t, err)
+		assert.Equal(t, commitFiles, stored)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to run in repository: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package mygit
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// repoState is a declarative description of a repository's refs and config.
+type repoState struct {
+	Branches map[string]string `json:"branches"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Config   map[string]string `json:"config,omitempty"`
+}
+
+// readRefDir reads every ref directly under the given refs directory
+// and returns a map of ref name to hex hash. Empty refs are skipped.
+func readRefDir(ctx context.Context, dir string) (map[string]string, error) {
+	refs := make(map[string]string)
+
+	names, err := listRefNames(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		hash, err := getRef(fmt.Sprintf("%s/%s", dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if hash == nil {
+			continue // branch without commits
+		}
+
+		refs[name] = fmt.Sprintf("%x", hash)
+	}
+
+	return refs, nil
+}
+
+// readConfigEntries returns all key-value pairs of the repository config.
+func readConfigEntries() (map[string]string, error) {
+	content, err := os.ReadFile(fmt.Sprintf("%s/config", commonDir))
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	config := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		config[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return config, nil
+}
+
+// exportState captures the branches, tags, and config of the repository.
+func exportState(ctx context.Context) (repoState, error) {
+	if err := checkVCSRepo(); err != nil {
+		return repoState{}, err
+	}
+
+	branches, err := readRefDir(ctx, "refs/heads")
+	if err != nil {
+		return repoState{}, err
+	}
+
+	tags, err := readRefDir(ctx, "refs/tags")
+	if err != nil {
+		return repoState{}, err
+	}
+
+	config, err := readConfigEntries()
+	if err != nil {
+		return repoState{}, err
+	}
+
+	return repoState{Branches: branches, Tags: tags, Config: config}, nil
+}
+
+// applyState makes the repository's refs and config match the given state.
+// Refs and config keys not mentioned in the state are left untouched, and
+// applying the same state twice changes nothing the second time. It returns
+// a description of every change made.
+func applyState(ctx context.Context, state repoState) ([]string, error) {
+	current, err := exportState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate all names and targets before changing anything
+	for _, refs := range []map[string]string{state.Branches, state.Tags} {
+		for name, hexHash := range refs {
+			if err := checkRefName(name); err != nil {
+				return nil, err
+			}
+			hash, err := hex.DecodeString(hexHash)
+			if err != nil || len(hash) != hashSize() {
+				return nil, fmt.Errorf("invalid hash %q for %s", hexHash, name)
+			}
+			if !objectExists(hash) {
+				return nil, fmt.Errorf("object %s for %s does not exist in this repository", hexHash, name)
+			}
+		}
+	}
+
+	var changes []string
+
+	apply := func(kind, dir string, desired, existing map[string]string) error {
+		names := make([]string, 0, len(desired))
+		for name := range desired {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			if existing[name] == desired[name] {
+				continue
+			}
+
+			hash, _ := hex.DecodeString(desired[name])
+			if err := os.MkdirAll(fmt.Sprintf("%s/%s", commonDir, dir), 0755); err != nil {
+				return fmt.Errorf("error creating %s: %w", dir, err)
+			}
+			if err := updateRef(fmt.Sprintf("%s/%s", dir, name), hash); err != nil {
+				return err
+			}
+
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", kind, name, desired[name][:abbrevHashLen]))
+		}
+
+		return nil
+	}
+
+	if err := apply("branch", "refs/heads", state.Branches, current.Branches); err != nil {
+		return nil, err
+	}
+	if err := apply("tag", "refs/tags", state.Tags, current.Tags); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(state.Config))
+	for key := range state.Config {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if value, ok := current.Config[key]; ok && value == state.Config[key] {
+			continue
+		}
+
+		if err := updateConfig(key, state.Config[key]); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("config %s = %s", key, state.Config[key]))
+	}
+
+	return changes, nil
+}
+
+// marshalState encodes the state as indented JSON.
+func marshalState(state repoState) ([]byte, error) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding state: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// unmarshalState decodes a JSON state document.
+func unmarshalState(data []byte) (repoState, error) {
+	var state repoState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return repoState{}, fmt.Errorf("error decoding state: %w", err)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,94 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyState(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "state@example.com"); err != nil {
+		t.Fatalf("Failed to set config: %v", err)
+	}
+
+	treeHash, err := buildTreeObject(map[string][]byte{})
+	if err != nil {
+		t.Fatalf("error building tree: %v", err)
+	}
+	commitHash, err := writeCommitObject(treeHash, nil, "state")
+	if err != nil {
+		t.Fatalf("error writing commit: %v", err)
+	}
+
+	state := repoState{
+		Branches: map[string]string{"release": fmt.Sprintf("%x", commitHash)},
+		Config:   map[string]string{"email": "state@example.com", "name": "State"},
+	}
+
+	changes, err := applyState(t.Context(), state)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"branch release -> " + state.Branches["release"][:abbrevHashLen],
+		"config name = State",
+	}, changes)
+
+	// applying again is a no-op
+	changes, err = applyState(t.Context(), state)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	exported, err := exportState(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, state.Branches["release"], exported.Branches["release"])
+	assert.Equal(t, "State", exported.Config["name"])
+
+	// unknown objects are rejected before anything changes
+	state.Branches["broken"] = "0000000000000000000000000000000000000000"
+	_, err = applyState(t.Context(), state)
+	assert.Error(t, err)
+}
+
+func TestApplyStateRejectsRefNames(t *testing.T) {
+	err := withRepositoryInit(t.TempDir(), func() error {
+		assert.NoError(t, updateConfig("email", "state@example.com"))
+		treeHash, err := buildTreeObject(map[string][]byte{})
+		assert.NoError(t, err)
+		commitHash, err := writeCommitObject(treeHash, nil, "state")
+		assert.NoError(t, err)
+
+		head, err := os.ReadFile(fmt.Sprintf("%s/HEAD", commonDir))
+		assert.NoError(t, err)
+		config, err := os.ReadFile(fmt.Sprintf("%s/config", commonDir))
+		assert.NoError(t, err)
+
+		for _, name := range []string{"../HEAD", "../../config", "/release", "a//b", "topic.lock", "a/b.lock/c", `a\b`} {
+			document := fmt.Sprintf(`{"branches": {"good": "%x", %q: "%x"}}`, commitHash, name, commitHash)
+			state, err := unmarshalState([]byte(document))
+			assert.NoError(t, err)
+
+			_, err = applyState(t.Context(), state)
+			assert.Error(t, err, name)
+		}
+
+		// nothing was written, not even the valid branch
+		exported, err := exportState(t.Context())
+		assert.NoError(t, err)
+		assert.Empty(t, exported.Branches)
+		newHead, err := os.ReadFile(fmt.Sprintf("%s/HEAD", commonDir))
+		assert.NoError(t, err)
+		assert.Equal(t, head, newHead)
+		newConfig, err := os.ReadFile(fmt.Sprintf("%s/config", commonDir))
+		assert.NoError(t, err)
+		assert.Equal(t, config, newConfig)
+
+		return nil
+	})
+	assert.NoError(t, err)
+}
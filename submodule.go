@@ -0,0 +1,565 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// submodulesFile lists the submodules of a repository, one "<path>|<url>"
+// line each. It is tracked like any other file.
+const submodulesFile = "." + vcsName + "modules"
+
+// submodule is a nested repository pinned at a commit by a gitlink entry.
+type submodule struct {
+	path string // path relative to the repository root
+	url  string // repository the submodule is cloned from
+}
+
+// parseSubmodules parses the content of a submodules file.
+func parseSubmodules(content []byte) ([]submodule, error) {
+	var submodules []submodule
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		path, url, ok := strings.Cut(line, "|")
+		if !ok || path == "" || url == "" {
+			return nil, fmt.Errorf("invalid %s entry: %s", submodulesFile, line)
+		}
+
+		submodules = append(submodules, submodule{path: path, url: url})
+	}
+
+	return submodules, nil
+}
+
+// indexSubmodules returns the submodules listed in the staged submodules file.
+func indexSubmodules(index map[string][]byte) ([]submodule, error) {
+	hash, ok := index[submodulesFile]
+	if !ok {
+		return nil, nil
+	}
+
+	content, err := readBlobFromCatFile(hash)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", submodulesFile, err)
+	}
+
+	return parseSubmodules(content)
+}
+
+// gitlinkPaths returns the index paths that are submodule commits rather
+// than file blobs.
+func gitlinkPaths(index map[string][]byte) (map[string]bool, error) {
+	submodules, err := indexSubmodules(index)
+	if err != nil {
+		return nil, err
+	}
+
+	gitlinks := make(map[string]bool)
+	for _, sub := range submodules {
+		if _, ok := index[sub.path]; ok {
+			gitlinks[sub.path] = true
+		}
+	}
+
+	return gitlinks, nil
+}
+
+// withoutGitlinks returns a copy of the index holding only file entries.
+func withoutGitlinks(index map[string][]byte) (map[string][]byte, error) {
+	gitlinks, err := gitlinkPaths(index)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(index))
+	for path, hash := range index {
+		if !gitlinks[path] {
+			files[path] = hash
+		}
+	}
+
+	return files, nil
+}
+
+// gitlinkAwareReader returns a readBlobFunc that renders the commits pinned
+// by gitlinks in the given indexes as "Subproject commit <hash>" lines and
+// reads everything else from the object store.
+func gitlinkAwareReader(indexes ...map[string][]byte) (readBlobFunc, error) {
+	pinned := make(map[string]bool)
+	for _, index := range indexes {
+		gitlinks, err := gitlinkPaths(index)
+		if err != nil {
+			return nil, err
+		}
+		for path := range gitlinks {
+			pinned[fmt.Sprintf("%x", index[path])] = true
+		}
+	}
+
+	return func(hash []byte) ([]byte, error) {
+		if pinned[fmt.Sprintf("%x", hash)] {
+			return []byte(fmt.Sprintf("Subproject commit %x\n", hash)), nil
+		}
+		return readBlobFromCatFile(hash)
+	}, nil
+}
+
+// isNestedRepository reports whether path is a directory below the
+// repository root holding a repository of its own.
+func isNestedRepository(path string) bool {
+	if filepath.Clean(path) == "." {
+		return false
+	}
+
+	_, err := os.Stat(workTreePath(filepath.Join(path, "."+vcsName)))
+	return err == nil
+}
+
+// withRepository runs fn with the repository state switched to the
+// repository at root, which may be bare.
+func withRepository(root string, fn func() error) error {
+	absRoot, err := filepath.Abs(workTreePath(root))
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", root, err)
+	}
+
+	metaDir := absRoot
+	if !isBareRepositoryDir(absRoot) {
+		if metaDir, err = repositoryMetaDir(absRoot); err != nil {
+			return fmt.Errorf("%s is %w", root, ErrNotARepository)
+		}
+	}
+
+	return withWorktree(worktreeInfo{path: absRoot, metaDir: metaDir}, fn)
+}
+
+// submoduleHead returns the commit checked out in the submodule at path,
+// or nil if it has no commits.
+func submoduleHead(path string) ([]byte, error) {
+	var head []byte
+
+	err := withRepository(path, func() error {
+		ref, err := getHEAD()
+		if err != nil {
+			return err
+		}
+
+		head, err = getRef(ref)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading submodule %s: %w", path, err)
+	}
+
+	return head, nil
+}
+
+// gitlinkModified reports whether the submodule at path has a different
+// commit checked out than the one pinned. Submodules that have not been
+// cloned yet are not modified.
+func gitlinkModified(path string, pinned []byte) (bool, error) {
+	if !isNestedRepository(path) {
+		return false, nil
+	}
+
+	head, err := submoduleHead(path)
+	if err != nil {
+		return false, err
+	}
+
+	return !slices.Equal(head, pinned), nil
+}
+
+// copyMissingObjects copies every object file of the repository whose
+// shared metadata lives in srcDir that is missing from dstDir, and returns
+// how many were copied. It stops between files once ctx is done.
+func copyMissingObjects(ctx context.Context, srcDir, dstDir string) (int, error) {
+	srcObjects := filepath.Join(srcDir, "objects")
+	copied := 0
+
+	err := filepath.WalkDir(srcObjects, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcObjects, path)
+		if err != nil {
+			return err
+		}
+		if !isHex(strings.ReplaceAll(filepath.ToSlash(rel), "/", "")) {
+			return nil // not an object file
+		}
+
+		dstPath := filepath.Join(dstDir, "objects", rel)
+		if _, err := os.Stat(dstPath); err == nil {
+			return nil
+		}
+
+		// object files are copied as stored, compressed and possibly encrypted
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tmp, err := createTempFile(filepath.Join(dstDir, "objects"), tempObjectPattern)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name()) // no-op once the file has been moved into place
+		defer tmp.Close()
+
+		if _, err := tmp.Write(content); err != nil {
+			return err
+		}
+		if err := installObjectFile(tmp, dstPath); err != nil {
+			return err
+		}
+
+		copied++
+		return nil
+	})
+	if err != nil {
+		return copied, fmt.Errorf("error copying objects: %w", err)
+	}
+
+	return copied, nil
+}
+
+// cloneSource is what a clone takes from a local repository: where its
+// objects are, its branches and tags, the branch that is current there,
+// and the settings needed to read its objects.
+type cloneSource struct {
+	objectsDir string // the source's common directory
+	branch     string
+	format     string
+	encryption string
+	lfsStore   string // where the clone fetches large files from, if anywhere
+	lfsSize    string // the source's largeFileThreshold, if set
+	state      repoState
+}
+
+// readCloneSource reads what a clone needs from the local repository at url.
+func readCloneSource(ctx context.Context, url string) (cloneSource, error) {
+	var src cloneSource
+
+	err := withRepository(url, func() error {
+		var err error
+		if src.objectsDir, err = filepath.Abs(commonDir); err != nil {
+			return err
+		}
+		if src.branch, err = getCurrentBranch(); err != nil {
+			return err
+		}
+
+		src.state, err = exportState(ctx)
+		src.format = objectFormat()
+		src.encryption, _ = getConfig("objectEncryption")
+		src.lfsSize, _ = getConfig("largeFileThreshold")
+		if err != nil {
+			return err
+		}
+
+		// large files come from the source's shared store, else its own
+		src.lfsStore = largeFileStore()
+		if src.lfsStore == "" {
+			if _, statErr := os.Stat(largeFilesDir()); statErr == nil {
+				src.lfsStore = largeFilesDir()
+			}
+		}
+		if src.lfsStore != "" {
+			src.lfsStore, err = filepath.Abs(src.lfsStore)
+		}
+		return err
+	})
+
+	// identity and other settings stay with the source repository
+	src.state.Config = nil
+
+	return src, err
+}
+
+// cloneLocalRepository creates a repository at path with the objects,
+// branches, and tags of the local repository at url, and checks out the
+// branch that is current there.
+func cloneLocalRepository(ctx context.Context, url, path string) error {
+	if entries, err := os.ReadDir(workTreePath(path)); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty", path)
+	}
+
+	src, err := readCloneSource(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(workTreePath(path), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	absPath, err := filepath.Abs(workTreePath(path))
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", path, err)
+	}
+
+	clone := worktreeInfo{path: absPath, metaDir: filepath.Join(absPath, "."+vcsName)}
+	return withWorktree(clone, func() error {
+		if err := createDirectoriesFiles(); err != nil {
+			return err
+		}
+
+		return fillClone(ctx, src)
+	})
+}
+
+// fillClone copies the objects of src that the current repository lacks,
+// sets its branches and tags to match, and checks out the branch that is
+// current in src. It runs in a new clone, possibly already holding some of
+// the objects.
+func fillClone(ctx context.Context, src cloneSource) error {
+	// objects can only be read back with the source's format and encryption
+	if err := updateConfig("objectFormat", src.format); err != nil {
+		return err
+	}
+	if src.encryption != "" {
+		if err := updateConfig("objectEncryption", src.encryption); err != nil {
+			return err
+		}
+	}
+	// large files are stored and fetched as in the source
+	if src.lfsSize != "" {
+		if err := updateConfig("largeFileThreshold", src.lfsSize); err != nil {
+			return err
+		}
+	}
+	if src.lfsStore != "" {
+		if err := updateConfig("largeFileStore", src.lfsStore); err != nil {
+			return err
+		}
+	}
+
+	if _, err := copyMissingObjects(ctx, src.objectsDir, commonDir); err != nil {
+		return err
+	}
+	if _, err := applyState(ctx, src.state); err != nil {
+		return err
+	}
+	if _, ok := src.state.Branches["main"]; !ok {
+		if err := deleteRef("refs/heads/main"); err != nil {
+			return err
+		}
+	}
+
+	commitHash, err := readRefIfExists(fmt.Sprintf("refs/heads/%s", src.branch))
+	if err != nil {
+		return err
+	}
+	if err := checkoutBranch(src.branch); err != nil {
+		return err
+	}
+	if commitHash == nil {
+		return nil // nothing to check out yet
+	}
+
+	return checkoutCommit(ctx, commitHash)
+}
+
+// addSubmodule records the repository at path, cloning it from url first
+// if path is not a repository yet, as a submodule pinned at its current
+// commit. The submodule is listed in the submodules file, which is staged
+// together with the gitlink.
+func addSubmodule(ctx context.Context, url, path string) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	index, err := readIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := index[path]; ok {
+		return fmt.Errorf("%s is already in the index", path)
+	}
+
+	content, err := os.ReadFile(workTreePath(submodulesFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading %s: %w", submodulesFile, err)
+	}
+	submodules, err := parseSubmodules(content)
+	if err != nil {
+		return err
+	}
+	for _, sub := range submodules {
+		if sub.path == path {
+			return fmt.Errorf("submodule %s already exists", path)
+		}
+	}
+
+	if !isNestedRepository(path) {
+		if err := cloneLocalRepository(ctx, url, path); err != nil {
+			return err
+		}
+	}
+
+	head, err := submoduleHead(path)
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		return fmt.Errorf("submodule %s has no commits", path)
+	}
+
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, fmt.Sprintf("%s|%s\n", path, url)...)
+	if err := os.WriteFile(workTreePath(submodulesFile), content, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", submodulesFile, err)
+	}
+
+	hash, err := createObject(content)
+	if err != nil {
+		return err
+	}
+
+	index[submodulesFile] = hash
+	index[path] = head
+	if err := writeIndex(ctx, index); err != nil {
+		return err
+	}
+
+	return updateConfig(submoduleURLKey(path), url)
+}
+
+// submoduleURLKey returns the config key holding the url of an initialized
+// submodule.
+func submoduleURLKey(path string) string {
+	return fmt.Sprintf("submodule.%s.url", path)
+}
+
+// initSubmodules copies the url of every staged submodule that is not yet
+// initialized into the repository config and returns the paths initialized.
+func initSubmodules(ctx context.Context) ([]string, error) {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	submodules, err := indexSubmodules(index)
+	if err != nil {
+		return nil, err
+	}
+
+	var initialized []string
+	for _, sub := range submodules {
+		if _, err := getConfig(submoduleURLKey(sub.path)); err == nil {
+			continue // already initialized; a changed url is kept
+		}
+
+		if err := updateConfig(submoduleURLKey(sub.path), sub.url); err != nil {
+			return nil, err
+		}
+		initialized = append(initialized, sub.path)
+	}
+
+	return initialized, nil
+}
+
+// updateSubmodules brings every initialized submodule to the commit pinned
+// in the index, cloning it first if needed, and returns the paths updated.
+// mygit has no detached HEAD, so the submodule's current branch is moved to
+// the pinned commit; submodules with local changes are refused.
+func updateSubmodules(ctx context.Context) ([]string, error) {
+	index, err := readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	submodules, err := indexSubmodules(index)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []string
+	for _, sub := range submodules {
+		pinned, ok := index[sub.path]
+		if !ok {
+			continue
+		}
+
+		url, err := getConfig(submoduleURLKey(sub.path))
+		if err != nil {
+			continue // not initialized
+		}
+
+		if !isNestedRepository(sub.path) {
+			if err := cloneLocalRepository(ctx, url, sub.path); err != nil {
+				return updated, fmt.Errorf("error cloning submodule %s: %w", sub.path, err)
+			}
+		}
+
+		var srcDir string
+		err = withRepository(url, func() error {
+			srcDir, err = filepath.Abs(commonDir)
+			return err
+		})
+		if err != nil {
+			return updated, err
+		}
+
+		changed := false
+		err = withRepository(sub.path, func() error {
+			ref, err := getHEAD()
+			if err != nil {
+				return err
+			}
+			head, err := getRef(ref)
+			if err != nil {
+				return err
+			}
+			if slices.Equal(head, pinned) {
+				return nil
+			}
+
+			if err := checkUncommittedChanges(ctx); err != nil {
+				return err
+			}
+			if err := checkUnstagedChanges(ctx); err != nil {
+				return err
+			}
+
+			// fetch commits recorded since the submodule was cloned
+			if !objectExists(pinned) {
+				if _, err := copyMissingObjects(ctx, srcDir, commonDir); err != nil {
+					return err
+				}
+			}
+
+			if err := checkoutCommit(ctx, pinned); err != nil {
+				return err
+			}
+
+			changed = true
+			return compareAndSwapRef(ref, head, pinned)
+		})
+		if err != nil {
+			return updated, fmt.Errorf("error updating submodule %s: %w", sub.path, err)
+		}
+
+		if changed {
+			updated = append(updated, sub.path)
+		}
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,126 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmoduleGitlinks(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+	defer os.RemoveAll("sub")
+	defer os.Remove(submodulesFile)
+
+	// a nested repository with one commit
+	var subCommit []byte
+	assert.NoError(t, os.MkdirAll("sub", 0755))
+	err := withRepositoryInit("sub", func() error {
+		if err := updateConfig("email", "sub@example.com"); err != nil {
+			return err
+		}
+		if err := os.WriteFile("lib.txt", []byte("v1"), 0644); err != nil {
+			return err
+		}
+		blobHash, err := createObject([]byte("v1"))
+		if err != nil {
+			return err
+		}
+		subIndex := map[string][]byte{"lib.txt": blobHash}
+		if err := writeIndex(t.Context(), subIndex); err != nil {
+			return err
+		}
+		treeHash, err := buildTreeObject(subIndex)
+		if err != nil {
+			return err
+		}
+		subCommit, err = writeCommitObject(treeHash, nil, "lib v1")
+		if err != nil {
+			return err
+		}
+		return updateRef("refs/heads/main", subCommit)
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, addSubmodule(t.Context(), "../lib", "sub"))
+
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, subCommit, index["sub"])
+
+	gitlinks, err := gitlinkPaths(index)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"sub": true}, gitlinks)
+
+	// the gitlink is stored as a commit entry and read back as one
+	treeHash, err := buildTreeObject(index)
+	assert.NoError(t, err)
+	entries, err := listTreeEntries(treeHash, "", true)
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		if entry.name == "sub" {
+			assert.Equal(t, "160000", entry.mode)
+			assert.Equal(t, "commit", entry.objType)
+		}
+	}
+
+	restored, err := buildIndexFromTree(t.Context(), treeHash, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, index, restored)
+
+	// the nested repository's files are never staged as our own
+	_, err = addDirectory(t.Context(), "sub", addOptions{})
+	assert.NoError(t, err)
+	index, err = readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.NotContains(t, index, "sub/lib.txt")
+
+	modified, err := gitlinkModified("sub", subCommit)
+	assert.NoError(t, err)
+	assert.False(t, modified)
+	modified, err = gitlinkModified("sub", hashObject([]byte("other")))
+	assert.NoError(t, err)
+	assert.True(t, modified)
+
+	// a clone carries the objects and checks out the current branch
+	clonePath := filepath.Join(t.TempDir(), "clone")
+	assert.NoError(t, cloneLocalRepository(t.Context(), "sub", clonePath))
+	content, err := os.ReadFile(filepath.Join(clonePath, "lib.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	head, err := submoduleHead(clonePath)
+	assert.NoError(t, err)
+	assert.Equal(t, subCommit, head)
+}
+
+// withRepositoryInit creates a repository in dir and runs fn inside it,
+// from its root, so tests can use paths relative to it.
+func withRepositoryInit(dir string, fn func() error) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(absDir); err != nil {
+		return err
+	}
+	defer os.Chdir(cwd)
+
+	worktree := worktreeInfo{path: absDir, metaDir: filepath.Join(absDir, "."+vcsName)}
+	return withWorktree(worktree, func() error {
+		if err := createDirectoriesFiles(); err != nil {
+			return err
+		}
+		return fn()
+	})
+}
@@ -0,0 +1,187 @@
+package mygit
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// synthIdentity is the author and committer of generated commits, fixed so
+// the same options always give the same hashes.
+const synthIdentity = "Synth <synth@example.com>"
+
+// synthFilesPerDir is how many generated files share a directory.
+const synthFilesPerDir = 16
+
+// synthOptions describes the shape of a generated repository.
+type synthOptions struct {
+	commits  int    // commits on the current branch
+	files    int    // files in every commit
+	branches int    // extra branches, each one commit off the current branch
+	seed     uint64 // seed for file contents and which files change
+}
+
+// synthReport sums up a generated repository.
+type synthReport struct {
+	head     []byte   // last commit on the current branch
+	branches []string // names of the extra branches
+}
+
+// synthPath returns the path of the nth generated file.
+func synthPath(n int) string {
+	return fmt.Sprintf("dir%03d/file%05d.txt", n/synthFilesPerDir, n)
+}
+
+// synthContent returns a few lines of pseudo-random content.
+func synthContent(rng *rand.Rand) []byte {
+	var sb strings.Builder
+	for i := range 1 + rng.IntN(8) {
+		fmt.Fprintf(&sb, "line %d: %016x\n", i, rng.Uint64())
+	}
+	return []byte(sb.String())
+}
+
+// generateSyntheticRepo fills the current repository, which must have no
+// commits and an empty index, with a history of the given shape. The first
+// commit adds every file; each later one changes a few of them, going
+// through the index as commit would. Branch synth/NN forks off the current
+// branch at evenly spaced commits and changes one file. The working tree
+// and index end up matching the current branch. Nothing depends on the
+// clock or the config, so the same options always produce the same hashes.
+func generateSyntheticRepo(ctx context.Context, options synthOptions) (synthReport, error) {
+	var report synthReport
+	if options.commits < 1 || options.files < 1 || options.branches < 0 {
+		return report, fmt.Errorf("synth needs at least one commit and one file")
+	}
+
+	head, err := getHEAD()
+	if err != nil {
+		return report, err
+	}
+	if headHash, err := getRef(head); err != nil {
+		return report, err
+	} else if headHash != nil {
+		return report, fmt.Errorf("synth needs a repository without commits, but %s has some", shortRefName(head))
+	}
+	if index, err := readIndex(ctx); err != nil {
+		return report, err
+	} else if len(index) > 0 {
+		return report, fmt.Errorf("synth needs an empty index")
+	}
+
+	rng := rand.New(rand.NewPCG(options.seed, options.seed))
+
+	// branches fork off evenly spaced commits of the current branch
+	forkAt := make(map[int][]int)
+	for b := range options.branches {
+		commit := (b + 1) * options.commits / (options.branches + 1)
+		forkAt[commit] = append(forkAt[commit], b)
+	}
+
+	index := make(map[string][]byte, options.files)
+	var parent []byte
+	for c := range options.commits {
+		changes := options.files
+		if c > 0 {
+			changes = 1 + rng.IntN(min(options.files, 5))
+		}
+
+		for i := range changes {
+			n := i
+			if c > 0 {
+				n = rng.IntN(options.files)
+			}
+			blobHash, err := createObject(synthContent(rng))
+			if err != nil {
+				return report, err
+			}
+			index[synthPath(n)] = blobHash
+		}
+
+		if err := writeIndex(ctx, index); err != nil {
+			return report, err
+		}
+		treeHash, err := writeIndexTree(index)
+		if err != nil {
+			return report, err
+		}
+
+		var parents [][]byte
+		if parent != nil {
+			parents = [][]byte{parent}
+		}
+		commitHash, err := writeCommitObjectAs(treeHash, parents, synthIdentity, synthIdentity, fmt.Sprintf("synth commit %d", c+1))
+		if err != nil {
+			return report, err
+		}
+		if err := updateRef(head, commitHash); err != nil {
+			return report, err
+		}
+		parent = commitHash
+
+		for _, b := range forkAt[c+1] {
+			name, err := generateSyntheticBranch(b, index, commitHash, rng, options.files)
+			if err != nil {
+				return report, err
+			}
+			report.branches = append(report.branches, name)
+		}
+	}
+	report.head = parent
+
+	return report, writeSyntheticWorkTree(ctx, index)
+}
+
+// generateSyntheticBranch creates branch synth/NN with one commit on top
+// of base that changes one file of index, leaving the on-disk index alone.
+func generateSyntheticBranch(b int, index map[string][]byte, base []byte, rng *rand.Rand, files int) (string, error) {
+	branchIndex := maps.Clone(index)
+
+	blobHash, err := createObject(synthContent(rng))
+	if err != nil {
+		return "", err
+	}
+	branchIndex[synthPath(rng.IntN(files))] = blobHash
+
+	treeHash, err := buildTreeObject(branchIndex)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("synth/%02d", b+1)
+	commitHash, err := writeCommitObjectAs(treeHash, [][]byte{base}, synthIdentity, synthIdentity, "synth branch "+name)
+	if err != nil {
+		return "", err
+	}
+
+	return name, createBranch(name, commitHash)
+}
+
+// writeSyntheticWorkTree writes every file of index to the working tree.
+func writeSyntheticWorkTree(ctx context.Context, index map[string][]byte) error {
+	conv, err := loadContentConversion()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(index)) {
+		content, err := readBlobFromCatFile(index[path])
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(workTreePath(filepath.Dir(path)), workTreeDirMode); err != nil {
+			return fmt.Errorf("error creating directory %s: %w", filepath.Dir(path), err)
+		}
+		if err := conv.writeWorkTreeFile(ctx, path, path, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package mygit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSyntheticRepo(t *testing.T) {
+	options := synthOptions{commits: 6, files: 40, branches: 2, seed: 7}
+
+	var reports []synthReport
+	for _, dir := range []string{"one", "two"} {
+		dir = filepath.Join(t.TempDir(), dir)
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+
+		err := withRepositoryInit(dir, func() error {
+			report, err := generateSyntheticRepo(t.Context(), options)
+			if err != nil {
+				return err
+			}
+			reports = append(reports, report)
+
+			commits, err := commitLogJSON(t.Context(), report.head)
+			assert.NoError(t, err)
+			assert.Len(t, commits, options.commits)
+
+			// the working tree and index match HEAD
+			index, err := readIndex(t.Context())
+			assert.NoError(t, err)
+			assert.Len(t, index, options.files)
+			modified, deleted, err := compareIndexToWorkingTree(t.Context(), index)
+			assert.NoError(t, err)
+			assert.Empty(t, modified)
+			assert.Empty(t, deleted)
+
+			_, err = generateSyntheticRepo(t.Context(), options)
+			assert.ErrorContains(t, err, "without commits")
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to generate repository: %v", err)
+		}
+	}
+
+	// the same options give the same history
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, reports[0], reports[1])
+		assert.Equal(t, []string{"synth/01", "synth/02"}, reports[0].branches)
+	}
+}
@@ -0,0 +1,134 @@
+package mygit
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveTemplateDir returns the template directory to use for init.
+// An explicit directory takes precedence over the templateDir value
+// from the global config. An empty string means no template is used.
+func resolveTemplateDir(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+
+	dir, err := getGlobalConfig("templateDir")
+	if err != nil {
+		return "" // no global template configured
+	}
+
+	return dir
+}
+
+// templateSkipped holds the top-level names init creates itself; a
+// template must not replace the repository's HEAD, index, objects, or refs.
+var templateSkipped = map[string]bool{
+	"HEAD":    true,
+	"index":   true,
+	"objects": true,
+	"refs":    true,
+}
+
+// applyTemplate copies the contents of templateDir into the VCS directory.
+// A top-level "config" file is treated as a fragment and merged into the
+// repository config instead of replacing it, and the entries in
+// templateSkipped and lock files are left out. File modes are preserved
+// so hook scripts stay executable.
+func applyTemplate(templateDir string) error {
+	if err := checkVCSRepo(); err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(templateDir)
+	if err != nil {
+		return fmt.Errorf("error reading template directory %s: %w", templateDir, err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("template %s is not a directory", templateDir)
+	}
+
+	err = filepath.WalkDir(templateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(templateDir, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+
+		if templateSkipped[relPath] || strings.HasSuffix(relPath, ".lock") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		targetPath := filepath.Join(commonDir, relPath)
+
+		if d.IsDir() {
+			return os.MkdirAll(targetPath, 0755)
+		}
+
+		if relPath == "config" {
+			return mergeConfigFragment(path)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading template file %s: %w", path, err)
+		}
+
+		if err := os.WriteFile(targetPath, content, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("error writing template file %s: %w", targetPath, err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error applying template %s: %w", templateDir, err)
+	}
+
+	return nil
+}
+
+// mergeConfigFragment merges every key=value line of the given file
+// into the repository config.
+func mergeConfigFragment(fragmentPath string) error {
+	content, err := os.ReadFile(fragmentPath)
+	if err != nil {
+		return fmt.Errorf("error reading config fragment %s: %w", fragmentPath, err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.Split(line, "=")
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			continue
+		}
+
+		if err := updateConfig(key, strings.TrimSpace(parts[1])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
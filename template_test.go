@@ -0,0 +1,69 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	// build a template with a hook, an info file, and a config fragment
+	templateDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(templateDir, "hooks"), 0755); err != nil {
+		t.Fatalf("Failed to create template hooks dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templateDir, "hooks", "pre-commit"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templateDir, "description"), []byte("template repo\n"), 0644); err != nil {
+		t.Fatalf("Failed to write description: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templateDir, "config"), []byte("email=team@example.com\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config fragment: %v", err)
+	}
+
+	// the repository's own files are not replaced
+	for _, name := range []string{"HEAD", "index", "index.lock", filepath.Join("refs", "heads", "main"), filepath.Join("objects", "ab", "cdef")} {
+		path := filepath.Join(templateDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create template dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("from template\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	err := applyTemplate(templateDir)
+	assert.NoError(t, err, "Failed to apply template")
+
+	info, err := os.Stat(fmt.Sprintf(".%s/hooks/pre-commit", vcsName))
+	assert.NoError(t, err, "hook should be copied")
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), "hook mode should be preserved")
+
+	content, err := os.ReadFile(fmt.Sprintf(".%s/description", vcsName))
+	assert.NoError(t, err, "description should be copied")
+	assert.Equal(t, "template repo\n", string(content))
+
+	email, err := getConfig("email")
+	assert.NoError(t, err, "config fragment should be merged")
+	assert.Equal(t, "team@example.com", email)
+
+	head, err := os.ReadFile(fmt.Sprintf(".%s/HEAD", vcsName))
+	assert.NoError(t, err)
+	assert.Equal(t, "ref: refs/heads/main", string(head))
+	index, err := os.ReadFile(fmt.Sprintf(".%s/index", vcsName))
+	assert.NoError(t, err)
+	assert.Empty(t, index)
+	for _, name := range []string{"index.lock", "refs/heads/main", "objects/ab/cdef"} {
+		content, _ := os.ReadFile(fmt.Sprintf(".%s/%s", vcsName, name))
+		assert.NotEqual(t, "from template\n", string(content), name)
+	}
+}
@@ -0,0 +1,171 @@
+package mygit
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The ways --word-diff marks changed words: between [- -] and {+ +}, or
+// in red and green.
+const (
+	wordDiffPlain = "plain"
+	wordDiffColor = "color"
+)
+
+// wordDiffFlag is a flag.Value for --word-diff: given alone it means plain,
+// and --word-diff=<mode> takes plain, color, or none.
+type wordDiffFlag struct{ mode *string }
+
+func (f wordDiffFlag) String() string {
+	if f.mode == nil {
+		return ""
+	}
+	return *f.mode
+}
+
+func (f wordDiffFlag) Set(value string) error {
+	switch value {
+	case "true", wordDiffPlain:
+		*f.mode = wordDiffPlain
+	case wordDiffColor:
+		*f.mode = wordDiffColor
+	case "none", "false":
+		*f.mode = ""
+	default:
+		return fmt.Errorf("invalid word diff mode %q: expected plain, color, or none", value)
+	}
+
+	return nil
+}
+
+func (wordDiffFlag) IsBoolFlag() bool { return true }
+
+// splitWords splits text into the tokens a word diff compares: runs of
+// letters, digits, and underscores, runs of spaces and tabs, newlines, and
+// any other character on its own.
+func splitWords(text string) []string {
+	var words []string
+
+	class := func(r rune) int {
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return 1
+		case r != '\n' && unicode.IsSpace(r):
+			return 2
+		}
+		return 0 // a token of its own
+	}
+
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		end := size
+		if c := class(r); c != 0 {
+			for end < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[end:])
+				if class(next) != c {
+					break
+				}
+				end += nextSize
+			}
+		}
+		words = append(words, text[:end])
+		text = text[end:]
+	}
+
+	return words
+}
+
+// wordDiffHunks formats an edit script as the hunks of a word diff: the
+// same hunks unifiedHunks gives, with each run of removed and added lines
+// diffed word by word and shown inline, and unchanged lines without a
+// prefix. colored marks the words in red and green instead of brackets.
+func wordDiffHunks(script []diffLine, context int, colored bool) string {
+	var sb strings.Builder
+
+	for _, r := range hunkRanges(script, context) {
+		sb.WriteString(formatHunkHeader(script, r[0], r[1]))
+
+		lines := script[r[0]:r[1]]
+		for i := 0; i < len(lines); {
+			if lines[i].kind == ' ' {
+				sb.WriteString(lines[i].text)
+				if !strings.HasSuffix(lines[i].text, "\n") {
+					sb.WriteString("\n")
+				}
+				i++
+				continue
+			}
+
+			var removed, added strings.Builder
+			for ; i < len(lines) && lines[i].kind != ' '; i++ {
+				if lines[i].kind == '-' {
+					removed.WriteString(lines[i].text)
+				} else {
+					added.WriteString(lines[i].text)
+				}
+			}
+			sb.WriteString(formatWordChanges(removed.String(), added.String(), colored))
+		}
+	}
+
+	return sb.String()
+}
+
+// formatWordChanges shows the word diff between the removed and the added
+// text of a run of changed lines. Newlines are never marked, so markers
+// open and close on the line they belong to.
+func formatWordChanges(removed, added string, colored bool) string {
+	var sb strings.Builder
+
+	mark := func(kind byte, text string) {
+		switch {
+		case colored && kind == '-':
+			sb.WriteString(diffRemovedStyle.Sprint(text))
+		case colored:
+			sb.WriteString(diffAddedStyle.Sprint(text))
+		case kind == '-':
+			sb.WriteString("[-" + text + "-]")
+		default:
+			sb.WriteString("{+" + text + "+}")
+		}
+	}
+
+	// gather words of one kind, so each run gets one pair of markers
+	var run strings.Builder
+	runKind := byte(' ')
+	flush := func() {
+		if run.Len() > 0 {
+			if runKind == ' ' {
+				sb.WriteString(run.String())
+			} else {
+				mark(runKind, run.String())
+			}
+		}
+		run.Reset()
+	}
+
+	for _, word := range myersDiff(splitWords(removed), splitWords(added)) {
+		if word.text == "\n" {
+			if word.kind == '-' && strings.HasSuffix(added, "\n") {
+				continue // the added text's newline ends the line
+			}
+			flush()
+			sb.WriteString("\n")
+			continue
+		}
+		if word.kind != runKind {
+			flush()
+			runKind = word.kind
+		}
+		run.WriteString(word.text)
+	}
+	flush()
+
+	if !strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,43 @@
+package mygit
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitWords(t *testing.T) {
+	assert.Equal(t, []string{"key", " ", "=", " ", "value_1", ";", "\t\t", "héllo", "\n"},
+		splitWords("key = value_1;\t\théllo\n"))
+	assert.Empty(t, splitWords(""))
+}
+
+func TestWordDiff(t *testing.T) {
+	old := []byte("The quick brown fox\njumps over\nthe lazy dog.\n")
+	new := []byte("The quick red fox\njumps over\nthe sleepy dog!\nnew line\n")
+	script := myersDiff(splitLines(old), splitLines(new))
+
+	assert.Equal(t, "@@ -1,3 +1,4 @@\n"+
+		"The quick [-brown-]{+red+} fox\n"+
+		"jumps over\n"+
+		"the [-lazy-]{+sleepy+} dog[-.-]{+!+}\n"+
+		"{+new line+}\n", wordDiffHunks(script, diffContextLines, false))
+
+	// removed lines keep their own lines, and joined lines stay on one
+	assert.Equal(t, "[-gone-]\n[-too-]\n", formatWordChanges("gone\ntoo\n", "", false))
+	assert.Equal(t, "a{+ +}b\n", formatWordChanges("a\nb\n", "a b\n", false))
+
+	noColor := color.NoColor
+	defer func() { color.NoColor = noColor }()
+	color.NoColor = false
+	assert.Equal(t, "x \x1b[31mold\x1b[0m\x1b[32mnew\x1b[0m\n", formatWordChanges("x old\n", "x new\n", true))
+
+	var mode string
+	flag := wordDiffFlag{&mode}
+	assert.NoError(t, flag.Set("true"))
+	assert.Equal(t, wordDiffPlain, mode)
+	assert.NoError(t, flag.Set("color"))
+	assert.Equal(t, wordDiffColor, mode)
+	assert.Error(t, flag.Set("words"))
+}
@@ -0,0 +1,293 @@
+package mygit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// worktreeInfo describes one working tree of the repository.
+type worktreeInfo struct {
+	path    string // absolute path of the working tree
+	metaDir string // absolute path of its per-worktree metadata
+	branch  string // checked out branch
+	linked  bool   // false for the main working tree
+}
+
+// worktreesDir returns the directory holding the metadata of linked worktrees.
+func worktreesDir() (string, error) {
+	absCommonDir, err := filepath.Abs(commonDir)
+	if err != nil {
+		return "", fmt.Errorf("error resolving repository directory: %w", err)
+	}
+
+	return filepath.Join(absCommonDir, "worktrees"), nil
+}
+
+// readWorktreeBranch returns the branch named by the HEAD file in metaDir,
+// or detachedHead if HEAD is detached.
+func readWorktreeBranch(metaDir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(metaDir, "HEAD"))
+	if err != nil {
+		return "", fmt.Errorf("error reading HEAD file: %w", err)
+	}
+
+	ref, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref: refs/heads/")
+	if !ok {
+		return detachedHead, nil
+	}
+
+	return ref, nil
+}
+
+// listWorktrees returns the main working tree (unless the repository is
+// bare) followed by every linked worktree.
+func listWorktrees() ([]worktreeInfo, error) {
+	if err := checkVCSRepo(); err != nil {
+		return nil, err
+	}
+
+	absCommonDir, err := filepath.Abs(commonDir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving repository directory: %w", err)
+	}
+
+	var worktrees []worktreeInfo
+
+	if !isBareRepositoryDir(absCommonDir) {
+		branch, err := readWorktreeBranch(absCommonDir)
+		if err != nil {
+			return nil, err
+		}
+
+		worktrees = append(worktrees, worktreeInfo{
+			path:    filepath.Dir(absCommonDir),
+			metaDir: absCommonDir,
+			branch:  branch,
+		})
+	}
+
+	dir, err := worktreesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading worktrees: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		metaDir := filepath.Join(dir, entry.Name())
+
+		pointer, err := os.ReadFile(filepath.Join(metaDir, "gitdir"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading worktree %s: %w", entry.Name(), err)
+		}
+
+		branch, err := readWorktreeBranch(metaDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading worktree %s: %w", entry.Name(), err)
+		}
+
+		worktrees = append(worktrees, worktreeInfo{
+			path:    filepath.Dir(strings.TrimSpace(string(pointer))),
+			metaDir: metaDir,
+			branch:  branch,
+			linked:  true,
+		})
+	}
+
+	return worktrees, nil
+}
+
+// worktreeForBranch returns the path of the working tree that has the
+// branch checked out, if any.
+func worktreeForBranch(branchName string) (string, bool, error) {
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, worktree := range worktrees {
+		if worktree.branch == branchName {
+			return worktree.path, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// withWorktree runs fn with the repository state switched to the given
+// worktree, restoring it afterwards. The current directory is left alone;
+// paths in the worktree are resolved against its root.
+func withWorktree(worktree worktreeInfo, fn func() error) error {
+	root, err := filepath.Abs(workTreePath(worktree.path))
+	if err != nil {
+		return fmt.Errorf("error resolving worktree %s: %w", worktree.path, err)
+	}
+	metaDir, err := filepath.Abs(workTreePath(worktree.metaDir))
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", worktree.metaDir, err)
+	}
+
+	common, err := resolveCommonDir(metaDir)
+	if err != nil {
+		return err
+	}
+
+	return withRepositoryPaths(root, metaDir, common, fn)
+}
+
+// withRepositoryPaths runs fn with the repository state switched to the
+// working tree at root, the metadata directory gitDir, and the shared
+// directory commonDir, all absolute, restoring it afterwards.
+func withRepositoryPaths(root, metaDir, common string, fn func() error) error {
+	savedGitDir, savedCommonDir, savedPrefix, savedRoot, savedBare := gitDir, commonDir, cwdPrefix, workTreeRoot, bareRepository
+	defer func() {
+		gitDir, commonDir, cwdPrefix, workTreeRoot, bareRepository = savedGitDir, savedCommonDir, savedPrefix, savedRoot, savedBare
+	}()
+
+	gitDir, commonDir, cwdPrefix, workTreeRoot, bareRepository = metaDir, common, ".", root, false
+
+	return fn()
+}
+
+// addWorktree creates a linked working tree at path with the branch checked
+// out. The new tree shares objects, refs, and config with this repository
+// but has its own HEAD and index.
+func addWorktree(ctx context.Context, path, branchName string) (worktreeInfo, error) {
+	if err := checkVCSRepo(); err != nil {
+		return worktreeInfo{}, err
+	}
+
+	commitHash, err := readRefIfExists(fmt.Sprintf("refs/heads/%s", branchName))
+	if err != nil {
+		return worktreeInfo{}, err
+	}
+	if commitHash == nil {
+		return worktreeInfo{}, fmt.Errorf("branch %s does not exist or has no commits", branchName)
+	}
+
+	if other, ok, err := worktreeForBranch(branchName); err != nil {
+		return worktreeInfo{}, err
+	} else if ok {
+		return worktreeInfo{}, fmt.Errorf("branch %s is already checked out at %s", branchName, other)
+	}
+
+	absPath, err := filepath.Abs(workTreePath(path))
+	if err != nil {
+		return worktreeInfo{}, fmt.Errorf("error resolving %s: %w", path, err)
+	}
+
+	if entries, err := os.ReadDir(absPath); err == nil && len(entries) > 0 {
+		return worktreeInfo{}, fmt.Errorf("%s already exists and is not empty", path)
+	}
+
+	dir, err := worktreesDir()
+	if err != nil {
+		return worktreeInfo{}, err
+	}
+
+	// name the metadata after the directory, adding a number on clashes
+	name := filepath.Base(absPath)
+	metaDir := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(metaDir); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		metaDir = filepath.Join(dir, name+strconv.Itoa(i))
+	}
+
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		return worktreeInfo{}, fmt.Errorf("error creating worktree metadata: %w", err)
+	}
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		return worktreeInfo{}, fmt.Errorf("error creating worktree %s: %w", path, err)
+	}
+
+	pointerPath := filepath.Join(absPath, "."+vcsName)
+	files := map[string]string{
+		filepath.Join(metaDir, "HEAD"):      fmt.Sprintf("ref: refs/heads/%s", branchName),
+		filepath.Join(metaDir, "commondir"): "../..\n",
+		filepath.Join(metaDir, "gitdir"):    pointerPath + "\n",
+		filepath.Join(metaDir, "index"):     "",
+		pointerPath:                         fmt.Sprintf("gitdir: %s\n", metaDir),
+	}
+	for filePath, content := range files {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			return worktreeInfo{}, fmt.Errorf("error writing %s: %w", filePath, err)
+		}
+	}
+
+	worktree := worktreeInfo{path: absPath, metaDir: metaDir, branch: branchName, linked: true}
+	if err := withWorktree(worktree, func() error { return checkoutCommit(ctx, commitHash) }); err != nil {
+		return worktreeInfo{}, err
+	}
+
+	return worktree, nil
+}
+
+// removeWorktree deletes a linked worktree and its metadata. Unless force is
+// set, worktrees with uncommitted or unstaged changes are kept.
+func removeWorktree(ctx context.Context, path string, force bool) error {
+	absPath, err := filepath.Abs(workTreePath(path))
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", path, err)
+	}
+
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return err
+	}
+
+	absGitDir, err := filepath.Abs(gitDir)
+	if err != nil {
+		return fmt.Errorf("error resolving repository directory: %w", err)
+	}
+
+	for _, worktree := range worktrees {
+		if worktree.path != absPath {
+			continue
+		}
+
+		if !worktree.linked {
+			return fmt.Errorf("%s is the main working tree and cannot be removed", path)
+		}
+		if worktree.metaDir == absGitDir {
+			return fmt.Errorf("cannot remove the worktree you are in")
+		}
+
+		if !force {
+			err := withWorktree(worktree, func() error {
+				if err := checkUncommittedChanges(ctx); err != nil {
+					return err
+				}
+				return checkUnstagedChanges(ctx)
+			})
+			if err != nil {
+				return fmt.Errorf("worktree %s has changes (%w); use --force to remove it anyway", path, err)
+			}
+		}
+
+		if err := os.RemoveAll(worktree.path); err != nil {
+			return fmt.Errorf("error removing worktree %s: %w", path, err)
+		}
+		if err := os.RemoveAll(worktree.metaDir); err != nil {
+			return fmt.Errorf("error removing worktree metadata: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%s is not a worktree of this repository", path)
+}
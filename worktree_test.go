@@ -0,0 +1,72 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorktreeAddListRemove(t *testing.T) {
+	if err := createDirectoriesFiles(); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	defer os.RemoveAll(fmt.Sprintf(".%s", vcsName))
+
+	if err := updateConfig("email", "worktree@example.com"); err != nil {
+		t.Fatalf("Failed to set email: %v", err)
+	}
+
+	blobHash, err := createObject([]byte("feature"))
+	assert.NoError(t, err)
+	treeHash, err := buildTreeObject(map[string][]byte{"feature.txt": blobHash})
+	assert.NoError(t, err)
+	commitHash, err := writeCommitObject(treeHash, nil, "feature")
+	assert.NoError(t, err)
+	assert.NoError(t, updateRef("refs/heads/main", commitHash))
+	assert.NoError(t, updateRef("refs/heads/feature", commitHash))
+
+	path := filepath.Join(t.TempDir(), "feature-wt")
+
+	// the current branch cannot be checked out a second time
+	_, err = addWorktree(t.Context(), path, "main")
+	assert.Error(t, err)
+
+	worktree, err := addWorktree(t.Context(), path, "feature")
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(path, "feature.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "feature", string(content))
+
+	// the main index is untouched; the worktree has its own
+	index, err := readIndex(t.Context())
+	assert.NoError(t, err)
+	assert.Empty(t, index)
+	index, err = readIndexFile(t.Context(), filepath.Join(worktree.metaDir, "index"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"feature.txt": blobHash}, index)
+
+	worktrees, err := listWorktrees()
+	assert.NoError(t, err)
+	assert.Len(t, worktrees, 2)
+	assert.Equal(t, "main", worktrees[0].branch)
+	assert.Equal(t, "feature", worktrees[1].branch)
+
+	other, ok, err := worktreeForBranch("feature")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, worktree.path, other)
+
+	// local changes keep the worktree unless forced
+	assert.NoError(t, os.WriteFile(filepath.Join(path, "feature.txt"), []byte("edited"), 0644))
+	assert.Error(t, removeWorktree(t.Context(), path, false))
+	assert.NoError(t, removeWorktree(t.Context(), path, true))
+
+	worktrees, err = listWorktrees()
+	assert.NoError(t, err)
+	assert.Len(t, worktrees, 1)
+	assert.NoDirExists(t, path)
+}